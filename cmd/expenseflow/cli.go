@@ -0,0 +1,283 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/i18n"
+)
+
+
+const usage = `Usage: expenseflow [global flags] <command> [arguments]
+
+Global flags:
+  --json                 print results as JSON
+  --config FILE          JSON config file
+  --db FILE              database file
+  --receipts-dir DIR     receipts directory
+  --log FILE             log file
+  --listen ADDR          API listen address
+  --locale en|fr         language of messages and reports (default: from LANG)
+  --time-zone ZONE       IANA time zone of new expenses and sessions (default: UTC)
+  --week-start DAY       first day of the weeks in reports (default: monday)
+  --sync-server URL      sync server of this device
+  --sync-token TOKEN     token of the sync API, shared by the server and its devices
+  --max-float N          hard limit on amounts and distances
+  --models A,B           standard expense types to seed a new database with
+  --receipt-max-side N   longest side in pixels of stored receipts (0 keeps it)
+  --receipt-quality N    JPEG quality of re-encoded receipts (1-100)
+  --thumbnail-side N     longest side in pixels of receipt thumbnails (0 for none)
+  Each flag can also be set with EXPENSEFLOW_* env vars (EXPENSEFLOW_DB_PATH...)
+
+Commands:
+  client add NAME | client list
+  type add NAME [--taxes 10,20] [--code CODE] [--reimbursable=false]
+                [--vat-recoverable=false] [--description TEXT]
+  type list
+  session start --client NAME|ID --location LOCATION [--from LOCATION] [--to LOCATION] [--at DATE]
+                [--tz ZONE] [--tag NAME]... [--field NAME=VALUE]...
+  session close SESSION_ID [--at DATE] | session list [--tag NAME]... [--field NAME=VALUE]...
+  expense add --type NAME --total AMOUNT [--tax PERCENT] [--currency CODE]
+              [--session SESSION_ID] [--receipt FILE]... [--notes TEXT] [--merchant NAME] [--date DATE]
+              [--country CODE] [--tz ZONE] [--days N] [--tag NAME]... [--field NAME=VALUE]...
+  expense attach EXPENSE_ID FILE...
+  expense duplicates [--threshold 0.6] | expense merge KEEP_ID DROP_ID
+  expense allocate EXPENSE_ID SESSION_ID=PERCENT%|AMOUNT...
+  expense allocate EXPENSE_ID --clear [--session SESSION_ID]
+  expense list [--session SESSION_ID] [--tag NAME]... [--field NAME=VALUE]...
+  expense|session tag ID NAME... [--remove] | expense|session set ID NAME=VALUE...
+  tag list | tag rename OLD_NAME NEW_NAME | tag delete NAME
+  field add NAME --on expense|session [--type text|number|date|enum] [--options A,B]
+  field list [--on expense|session] | field delete NAME --on expense|session
+  expense scan FILE [--save --type NAME] [--session SESSION_ID] [--currency CODE]
+              [--country CODE] [--lang fra+eng]   (needs tesseract installed)
+  recurring add NAME --type NAME (--total AMOUNT [--tax PERCENT] | --line RATE:TOTAL...)
+                --schedule RULE [--start DATE] [--currency CODE] [--notes TEXT] [--country CODE]
+                [--session SESSION_ID | --client NAME|ID]
+  recurring list | recurring delete NAME|ID
+  recurring run [--catch-up] [--dry-run] [--on DATE]
+  trip add DATE DISTANCE [--session SESSION_ID] | trip list
+  report SESSION_ID [--format text|json|csv|pdf] [--out FILE] [--locale en|fr]
+  report vat --from DATE --to DATE [--format text|json|csv|pdf] [--out FILE] [--locale en|fr]
+  report week|month|quarter [--on DATE] [--format text|json|csv|pdf] [--out FILE] [--locale en|fr]
+  report period --from DATE --to DATE [--format text|json|csv|pdf] [--out FILE] [--locale en|fr]
+  export FILE | import FILE [--rename]
+  models list | models install NAME...
+  models diff NAME | models upgrade NAME [--overwrite]
+  rates list [--country CODE] [--on DATE]
+  search QUERY... [--limit 20]   (expense notes, session locations, client and type names)
+  serve                  run the sync server on --listen (needs --sync-token)
+  sync | sync status     push the local changes to --sync-server, then pull the others
+
+DATE is yyyy-mm-dd, yyyy-mm-ddThh:mm or RFC 3339, DISTANCE is in km ("42" or "42km").
+Expense and session dates without offset are local to --tz (Europe/Paris...), reports use local dates.
+Taxe rates are percentages, like everywhere in ExpenseFlow: --tax 10 for 10%.
+With --country, a taxe rate unknown in that country on the expense date is logged as a warning.
+New and imported expenses are checked for duplicates (same day, total, type or receipt file).
+Custom fields are typed: numbers like 12.5, dates as yyyy-mm-dd, enums among their options.
+"set ID NAME=" unsets a field, list filters keep the rows having every given tag and value.
+RULE is an RRULE subset: FREQ=DAILY|WEEKLY|MONTHLY|YEARLY, INTERVAL, BYMONTHDAY (-1 for the last day),
+BYDAY=MO,FR (weekly), COUNT, UNTIL. "recurring run" generates the latest due occurrence of each one,
+--catch-up also the missed ones. A generated date is never generated again.
+An allocated expense is split across sessions ("expense allocate 7 3=60% 4=40%"), the allocations
+must add up to its total. Each session report and "expense list --session" include its share.
+Period reports slice the sessions crossing their bounds, an expense covering several days (--days 3
+for 3 hotel nights) counts for its days in the period.
+Sync conflicts: the latest change of a row wins, rows with the same name are merged, a row still
+referenced is not deleted. Receipt files are transferred with their expenses.
+Receipts are JPEG, PNG, GIF, BMP, WebP, PDF (preview needs pdftoppm) or HEIC (needs heif-convert).
+Reports use the numbers and dates of their locale, French CSV files are ";" separated.
+`
+
+var errUsage = errors.New("invalid usage")
+
+type cli struct {
+    database   *sql.DB
+    out        io.Writer
+    jsonOutput bool
+    printer    *i18n.Printer
+}
+
+func run(database *sql.DB, args []string, out io.Writer, jsonOutput bool) error {
+    c := cli{
+        database: database, out: out, jsonOutput: jsonOutput,
+        printer: i18n.NewPrinter(config.Locale),
+    }
+    if len(args) == 0 {
+        return errUsage
+    }
+
+    switch args[0] {
+    case "client":
+        return c.client(args[1:])
+    case "type":
+        return c.expenseType(args[1:])
+    case "session":
+        return c.session(args[1:])
+    case "expense":
+        return c.expense(args[1:])
+    case "trip":
+        return c.trip(args[1:])
+    case "recurring":
+        return c.recurring(args[1:])
+    case "report":
+        return c.report(args[1:])
+    case "export":
+        return c.exportArchive(args[1:])
+    case "import":
+        return c.importArchive(args[1:])
+    case "models":
+        return c.standardModels(args[1:])
+    case "rates":
+        return c.taxRates(args[1:])
+    case "search":
+        return c.search(args[1:])
+    case "tag":
+        return c.tag(args[1:])
+    case "field":
+        return c.customField(args[1:])
+    case "serve":
+        return c.serve(args[1:])
+    case "sync":
+        return c.sync(args[1:])
+    case "help":
+        _, err := io.WriteString(c.out, usage)
+        return err
+    default:
+        return fmt.Errorf("%w: unknown command %q", errUsage, args[0])
+    }
+}
+
+// Print either the JSON encoding of value, or the human rows as a table
+func (c cli) print(value any, rows ...[]string) error {
+    if c.jsonOutput {
+        encoder := json.NewEncoder(c.out)
+        encoder.SetIndent("", "  ")
+        return encoder.Encode(value)
+    }
+
+    table := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+    for _, row := range rows {
+        fmt.Fprintln(table, strings.Join(row, "\t"))
+    }
+    return table.Flush()
+}
+
+// flag stops at the first positional argument, this allows flags after them:
+// "trip add 2024-10-03 42km --session 3"
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+    fs.SetOutput(io.Discard)
+    var positional []string
+    for {
+        if err := fs.Parse(args); err != nil {
+            return nil, fmt.Errorf("%w: %v", errUsage, err)
+        }
+        args = fs.Args()
+        if len(args) == 0 {
+            return positional, nil
+        }
+        if args[0] == "--" {
+            return append(positional, args[1:]...), nil
+        }
+        positional = append(positional, args[0])
+        args = args[1:]
+    }
+}
+
+// Subcommands sharing a flag set only accept the flags they use: "expense list
+// --total 3" is refused instead of ignored
+func onlyFlags(fs *flag.FlagSet, names ...string) error {
+    var unused []string
+    fs.Visit(func(f *flag.Flag) {
+        if !slices.Contains(names, f.Name) {
+            unused = append(unused, "--"+f.Name)
+        }
+    })
+    if len(unused) > 0 {
+        return fmt.Errorf("%w: %s doesn't take %s", errUsage, fs.Name(), strings.Join(unused, ", "))
+    }
+    return nil
+}
+
+// Flag given several times: --receipt a.pdf --receipt b.jpg
+type repeatedFlag []string
+
+func (r *repeatedFlag) String() string {
+    return strings.Join(*r, ",")
+}
+
+func (r *repeatedFlag) Set(value string) error {
+    *r = append(*r, value)
+    return nil
+}
+
+func expectArgs(positional []string, count int, names string) error {
+    if len(positional) != count {
+        return fmt.Errorf("%w: expected %s", errUsage, names)
+    }
+    return nil
+}
+
+func parseID(value string) (int64, error) {
+    id, err := strconv.ParseInt(value, 10, 64)
+    if err != nil || id <= 0 {
+        return 0, fmt.Errorf("%w: invalid ID %q", errUsage, value)
+    }
+    return id, nil
+}
+
+// Dates without time are taken at midnight UTC
+func parseDateTime(value string) (time.Time, error) {
+    return parseDateTimeIn(value, time.UTC)
+}
+
+// Dates and times without offset are local to location
+func parseDateTimeIn(value string, location *time.Location) (time.Time, error) {
+    for _, layout := range []string{time.DateOnly, "2006-01-02T15:04", "2006-01-02 15:04"} {
+        if t, err := time.ParseInLocation(layout, value, location); err == nil {
+            return t.UTC(), nil
+        }
+    }
+    t, err := time.Parse(time.RFC3339, value)
+    if err != nil {
+        return time.Time{}, fmt.Errorf(
+            "%w: invalid date %q, expected yyyy-mm-dd, yyyy-mm-ddThh:mm or RFC 3339",
+            errUsage, value,
+        )
+    }
+    return t.UTC(), nil
+}
+
+// Value of a --date or --at flag in the time zone of the row, now without one
+func parseAt(value string, timeZone sql.NullString) (time.Time, error) {
+    if value == "" {
+        return time.Now().UTC(), nil
+    }
+    return parseDateTimeIn(value, db.TimeZoneLocation(timeZone))
+}
+
+// IANA name of a --tz flag, none is UTC
+func parseTimeZone(value string) (sql.NullString, error) {
+    if value == "" {
+        return sql.NullString{}, nil
+    }
+    if err := db.ValidTimeZone(value); err != nil {
+        return sql.NullString{}, err
+    }
+    return sql.NullString{String: value, Valid: true}, nil
+}
+
+func formatAmount(value float64) string {
+    return strconv.FormatFloat(value, 'f', 2, 64)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+)
+
+
+type tagView struct {
+    ID       int64  `json:"id"`
+    PublicID string `json:"public_id,omitempty"`
+    Name     string `json:"name"`
+}
+
+type customFieldView struct {
+    ID        int64    `json:"id"`
+    PublicID  string   `json:"public_id,omitempty"`
+    Name      string   `json:"name"`
+    AppliesTo string   `json:"applies_to"`
+    Type      string   `json:"type"`
+    Options   []string `json:"options,omitempty"`
+}
+
+// --tag and --field flags of the commands creating or listing expenses and sessions
+type attributeFlags struct {
+    tags   repeatedFlag
+    fields repeatedFlag
+}
+
+func newAttributeFlags(fs *flag.FlagSet) *attributeFlags {
+    af := &attributeFlags{}
+    fs.Var(&af.tags, "tag", "tag name, can be repeated")
+    fs.Var(&af.fields, "field", "custom field value NAME=VALUE, can be repeated")
+    return af
+}
+
+func (af *attributeFlags) attributes() (services.Attributes, error) {
+    fields, err := parseFieldAssignments(af.fields)
+    if err != nil {
+        return services.Attributes{}, err
+    }
+    return services.Attributes{Tags: af.tags, Fields: fields}, nil
+}
+
+// Filter on every given tag and field value
+func (af *attributeFlags) filter(c cli, kind string) (crud.AttributeFilter, error) {
+    attributes, err := af.attributes()
+    if err != nil {
+        return crud.AttributeFilter{}, err
+    }
+    return services.ResolveAttributes(c.database, kind, attributes, false)
+}
+
+// "NAME=VALUE" pairs, an empty VALUE unsets the field
+func parseFieldAssignments(assignments []string) (map[string]string, error) {
+    fields := make(map[string]string)
+    for _, assignment := range assignments {
+        name, value, ok := strings.Cut(assignment, "=")
+        if !ok || name == "" {
+            return nil, fmt.Errorf("%w: expected NAME=VALUE, got %q", errUsage, assignment)
+        }
+        fields[name] = value
+    }
+    return fields, nil
+}
+
+func (c cli) tag(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("%w: expected tag list|rename|delete", errUsage)
+    }
+
+    switch args[0] {
+    case "list":
+        tags, err := crud.ListTags(c.database)
+        if err != nil {
+            return err
+        }
+        views := make([]tagView, 0, len(tags))
+        rows := [][]string{{"ID", "NAME"}}
+        for _, tag := range tags {
+            views = append(views, tagView{tag.ID, tag.PublicID, tag.Name})
+            rows = append(rows, []string{strconv.FormatInt(tag.ID, 10), tag.Name})
+        }
+        return c.print(views, rows...)
+    case "rename":
+        if err := expectArgs(args[1:], 2, "OLD_NAME NEW_NAME"); err != nil {
+            return err
+        }
+        tag, err := c.resolveTag(args[1])
+        if err != nil {
+            return err
+        }
+        tag.Name = args[2]
+        if err := crud.UpdateTag(c.database, *tag); err != nil {
+            return err
+        }
+        return c.print(
+            tagView{tag.ID, tag.PublicID, tag.Name},
+            []string{fmt.Sprintf("tag #%d renamed: %s", tag.ID, tag.Name)},
+        )
+    case "delete":
+        if err := expectArgs(args[1:], 1, "NAME"); err != nil {
+            return err
+        }
+        tag, err := c.resolveTag(args[1])
+        if err != nil {
+            return err
+        }
+        if err := crud.DeleteTagByID(c.database, tag.ID); err != nil {
+            return err
+        }
+        return c.print(
+            tagView{tag.ID, tag.PublicID, tag.Name},
+            []string{fmt.Sprintf("tag #%d deleted: %s", tag.ID, tag.Name)},
+        )
+    default:
+        return fmt.Errorf("%w: unknown tag command %q", errUsage, args[0])
+    }
+}
+
+func (c cli) customField(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("%w: expected field add|list|delete", errUsage)
+    }
+    fs := flag.NewFlagSet("field "+args[0], flag.ContinueOnError)
+    appliesTo := fs.String("on", "", "expense or session")
+    fieldType := fs.String("type", db.CustomFieldText, "text, number, date or enum")
+    options := fs.String("options", "", "comma separated choices of an enum")
+    positional, err := parseArgs(fs, args[1:])
+    if err != nil {
+        return err
+    }
+
+    switch args[0] {
+    case "add":
+        if err := onlyFlags(fs, "on", "type", "options"); err != nil {
+            return err
+        }
+        if err := expectArgs(positional, 1, "NAME"); err != nil {
+            return err
+        }
+        field := db.CustomField{Name: positional[0], AppliesTo: *appliesTo, Type: *fieldType}
+        if *options != "" {
+            field.Options = db.CustomFieldOptions(strings.Split(*options, ","))
+            for i := range field.Options {
+                field.Options[i] = strings.TrimSpace(field.Options[i])
+            }
+        }
+        if field.ID, err = crud.CreateCustomField(c.database, field); err != nil {
+            return err
+        }
+        return c.print(
+            newCustomFieldView(field),
+            []string{fmt.Sprintf("custom field #%d created: %s", field.ID, field)},
+        )
+    case "list":
+        if err := onlyFlags(fs, "on"); err != nil {
+            return err
+        }
+        if err := expectArgs(positional, 0, "no argument"); err != nil {
+            return err
+        }
+        fields, err := crud.ListCustomFields(c.database, *appliesTo)
+        if err != nil {
+            return err
+        }
+        views := make([]customFieldView, 0, len(fields))
+        rows := [][]string{{"ID", "ON", "NAME", "TYPE", "OPTIONS"}}
+        for _, field := range fields {
+            views = append(views, newCustomFieldView(field))
+            rows = append(rows, []string{
+                strconv.FormatInt(field.ID, 10),
+                field.AppliesTo,
+                field.Name,
+                field.Type,
+                strings.Join(field.Options, ", "),
+            })
+        }
+        return c.print(views, rows...)
+    case "delete":
+        if err := onlyFlags(fs, "on"); err != nil {
+            return err
+        }
+        if err := expectArgs(positional, 1, "NAME"); err != nil {
+            return err
+        }
+        field, err := crud.GetCustomFieldByName(c.database, *appliesTo, positional[0])
+        if err != nil {
+            return err
+        }
+        if field == nil {
+            return fmt.Errorf("unknown custom field: %q (--on expense|session)", positional[0])
+        }
+        if err := crud.DeleteCustomFieldByID(c.database, field.ID); err != nil {
+            return err
+        }
+        return c.print(
+            newCustomFieldView(*field),
+            []string{fmt.Sprintf("custom field #%d deleted with its values: %s", field.ID, field.Name)},
+        )
+    default:
+        return fmt.Errorf("%w: unknown field command %q", errUsage, args[0])
+    }
+}
+
+// "expense tag ID NAME... [--remove]" and "session tag ..."
+func (c cli) tagEntity(kind string, args []string) error {
+    fs := flag.NewFlagSet(kind+" tag", flag.ContinueOnError)
+    remove := fs.Bool("remove", false, "remove the tags instead of adding them")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if len(positional) < 2 {
+        return fmt.Errorf("%w: expected %s_ID NAME...", errUsage, strings.ToUpper(kind))
+    }
+    id, err := c.resolveEntity(kind, positional[0])
+    if err != nil {
+        return err
+    }
+
+    if *remove {
+        err = services.RemoveTags(c.database, kind, id, positional[1:])
+    } else {
+        err = services.ApplyAttributes(
+            c.database, kind, id, services.Attributes{Tags: positional[1:]},
+        )
+    }
+    if err != nil {
+        return err
+    }
+    return c.printAttributes(kind, id)
+}
+
+// "expense set ID NAME=VALUE..." and "session set ...", NAME= unsets
+func (c cli) setCustomFields(kind string, args []string) error {
+    if len(args) < 2 {
+        return fmt.Errorf("%w: expected %s_ID NAME=VALUE...", errUsage, strings.ToUpper(kind))
+    }
+    id, err := c.resolveEntity(kind, args[0])
+    if err != nil {
+        return err
+    }
+    fields, err := parseFieldAssignments(args[1:])
+    if err != nil {
+        return err
+    }
+    if err := services.ApplyAttributes(
+        c.database, kind, id, services.Attributes{Fields: fields},
+    ); err != nil {
+        return err
+    }
+    return c.printAttributes(kind, id)
+}
+
+func (c cli) printAttributes(kind string, id int64) error {
+    attributes, err := services.GetAttributes(c.database, kind, id)
+    if err != nil {
+        return err
+    }
+    rows := [][]string{{fmt.Sprintf("%s #%d", kind, id)}}
+    rows = append(rows, formatAttributes(attributes)...)
+    return c.print(attributes, rows...)
+}
+
+func formatAttributes(attributes services.Attributes) [][]string {
+    var rows [][]string
+    if len(attributes.Tags) > 0 {
+        rows = append(rows, []string{"tags", strings.Join(attributes.Tags, ", ")})
+    }
+    for _, name := range attributes.FieldNames() {
+        rows = append(rows, []string{name, attributes.Fields[name]})
+    }
+    return rows
+}
+
+func (c cli) resolveTag(name string) (*db.Tag, error) {
+    tag, err := crud.GetTagByName(c.database, name)
+    if err != nil {
+        return nil, err
+    }
+    if tag == nil {
+        return nil, fmt.Errorf("unknown tag: %q", name)
+    }
+    return tag, nil
+}
+
+// The ID of an existing expense or session
+func (c cli) resolveEntity(kind string, value string) (int64, error) {
+    id, err := parseID(value)
+    if err != nil {
+        return 0, err
+    }
+    if kind == db.CustomFieldOnExpense {
+        _, err = crud.GetExpenseByID(c.database, id)
+    } else {
+        _, err = crud.GetSessionByID(c.database, id)
+    }
+    return id, err
+}
+
+func newCustomFieldView(field db.CustomField) customFieldView {
+    return customFieldView{
+        ID:        field.ID,
+        PublicID:  field.PublicID,
+        Name:      field.Name,
+        AppliesTo: field.AppliesTo,
+        Type:      field.Type,
+        Options:   field.Options,
+    }
+}
@@ -0,0 +1,1298 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/ocr"
+	"github.com/craftidev/expenseflow/internal/services"
+)
+
+
+// JSON views of the models, sql.Null* types are flattened to pointers
+type clientView struct {
+    ID       int64  `json:"id"`
+    PublicID string `json:"public_id,omitempty"`
+    Name     string `json:"name"`
+}
+
+type expenseTypeView struct {
+    ID               int64     `json:"id"`
+    PublicID         string    `json:"public_id,omitempty"`
+    Name             string    `json:"name"`
+    // Translated name of a standard type, in "type list" only
+    DisplayName      string    `json:"display_name,omitempty"`
+    DefaultTaxeRates []float64 `json:"default_taxe_rates,omitempty"`
+    AccountingCode   *string   `json:"accounting_code,omitempty"`
+    Reimbursable     bool      `json:"reimbursable"`
+    VATRecoverable   bool      `json:"vat_recoverable"`
+    Description      *string   `json:"description,omitempty"`
+    ModelRef         *string   `json:"model_ref,omitempty"`
+}
+
+type sessionView struct {
+    ID                int64      `json:"id"`
+    PublicID          string     `json:"public_id,omitempty"`
+    ClientID          int64      `json:"client_id"`
+    Location          string     `json:"location"`
+    TripStartLocation *string    `json:"trip_start_location,omitempty"`
+    TripEndLocation   *string    `json:"trip_end_location,omitempty"`
+    StartAtDateTime   *time.Time `json:"start_at_date_time,omitempty"`
+    EndAtDateTime     *time.Time `json:"end_at_date_time,omitempty"`
+    TimeZone          *string    `json:"time_zone,omitempty"`
+
+    services.Attributes
+}
+
+type expenseView struct {
+    ID          int64                     `json:"id"`
+    PublicID    string                    `json:"public_id,omitempty"`
+    SessionID   *int64                    `json:"session_id,omitempty"`
+    Type        string                    `json:"type"`
+    Currency    string                    `json:"currency"`
+    Receipts    []receiptView             `json:"receipts"`
+    Notes       *string                   `json:"notes,omitempty"`
+    DateTime    time.Time                 `json:"date_time"`
+    Country     *string                   `json:"country,omitempty"`
+    TimeZone    *string                   `json:"time_zone,omitempty"`
+    CoveredDays *int64                    `json:"covered_days,omitempty"`
+    Merchant    *string                   `json:"merchant,omitempty"`
+    LineItems   []services.ReportLineItem `json:"line_items"`
+    // Sessions sharing the expense, instead of SessionID
+    AllocatedTo []int64 `json:"allocated_session_ids,omitempty"`
+
+    services.Attributes
+    Duplicates []services.DuplicateCandidate `json:"possible_duplicates,omitempty"`
+}
+
+type receiptView struct {
+    ID        int64   `json:"id,omitempty"`
+    PublicID  string  `json:"public_id,omitempty"`
+    RelPath   string  `json:"rel_path"`
+    Preview   *string `json:"preview_rel_path,omitempty"`
+    Thumbnail *string `json:"thumbnail_rel_path,omitempty"`
+}
+
+type taxRateView struct {
+    ID        int64   `json:"id"`
+    PublicID  string  `json:"public_id,omitempty"`
+    Country   string  `json:"country"`
+    Label     string  `json:"label"`
+    Rate      float64 `json:"rate"`
+    ValidFrom *string `json:"valid_from,omitempty"`
+    ValidTo   *string `json:"valid_to,omitempty"`
+}
+
+type carTripView struct {
+    ID         int64   `json:"id"`
+    PublicID   string  `json:"public_id,omitempty"`
+    SessionID  *int64  `json:"session_id,omitempty"`
+    DistanceKM float64 `json:"distance_km"`
+    DateOnly   string  `json:"date_only"`
+}
+
+func (c cli) client(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("%w: expected client add|list", errUsage)
+    }
+    fs := flag.NewFlagSet("client "+args[0], flag.ContinueOnError)
+    positional, err := parseArgs(fs, args[1:])
+    if err != nil {
+        return err
+    }
+
+    switch args[0] {
+    case "add":
+        if err := expectArgs(positional, 1, "NAME"); err != nil {
+            return err
+        }
+        client := db.Client{Name: positional[0]}
+        client.ID, err = crud.CreateClient(c.database, client)
+        if err != nil {
+            return err
+        }
+        return c.print(
+            clientView{client.ID, client.PublicID, client.Name},
+            []string{fmt.Sprintf("client #%d created: %s", client.ID, client.Name)},
+        )
+    case "list":
+        clients, err := crud.ListClients(c.database)
+        if err != nil {
+            return err
+        }
+        views := make([]clientView, 0, len(clients))
+        rows := [][]string{{"ID", "NAME"}}
+        for _, client := range clients {
+            views = append(views, clientView{client.ID, client.PublicID, client.Name})
+            rows = append(rows, []string{strconv.FormatInt(client.ID, 10), client.Name})
+        }
+        return c.print(views, rows...)
+    default:
+        return fmt.Errorf("%w: unknown client command %q", errUsage, args[0])
+    }
+}
+
+func (c cli) expenseType(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("%w: expected type add|list", errUsage)
+    }
+    fs := flag.NewFlagSet("type "+args[0], flag.ContinueOnError)
+    taxes := fs.String("taxes", "", "default taxe rates in percent, comma separated")
+    code := fs.String("code", "", "accounting code")
+    reimbursable := fs.Bool("reimbursable", true, "reimbursed to the employee")
+    vatRecoverable := fs.Bool("vat-recoverable", true, "VAT can be claimed back")
+    description := fs.String("description", "", "description")
+    positional, err := parseArgs(fs, args[1:])
+    if err != nil {
+        return err
+    }
+
+    switch args[0] {
+    case "add":
+        if err := expectArgs(positional, 1, "NAME"); err != nil {
+            return err
+        }
+        expenseType := db.ExpenseType{
+            Name:           positional[0],
+            AccountingCode: sql.NullString{String: *code, Valid: *code != ""},
+            Reimbursable:   *reimbursable,
+            VATRecoverable: *vatRecoverable,
+            Description:    sql.NullString{String: *description, Valid: *description != ""},
+        }
+        if *taxes != "" {
+            if err := expenseType.DefaultTaxeRates.Scan(*taxes); err != nil {
+                return fmt.Errorf("%w: invalid --taxes %q", errUsage, *taxes)
+            }
+        }
+        expenseType.ID, err = crud.CreateExpenseType(c.database, expenseType)
+        if err != nil {
+            return err
+        }
+        return c.print(
+            newExpenseTypeView(expenseType),
+            []string{fmt.Sprintf(
+                "expense type #%d created: %s", expenseType.ID, expenseType.Name,
+            )},
+        )
+    case "list":
+        if err := onlyFlags(fs); err != nil {
+            return err
+        }
+        expenseTypes, err := crud.ListExpenseTypes(c.database)
+        if err != nil {
+            return err
+        }
+        views := make([]expenseTypeView, 0, len(expenseTypes))
+        rows := [][]string{{"ID", "NAME", "DISPLAY NAME", "TAXES", "CODE", "REIMBURSABLE", "MODEL"}}
+        for _, et := range expenseTypes {
+            view := newExpenseTypeView(et)
+            view.DisplayName = c.printer.TypeName(et.StandardKey(), et.Name)
+            views = append(views, view)
+            rows = append(rows, []string{
+                strconv.FormatInt(et.ID, 10),
+                et.Name,
+                view.DisplayName,
+                formatTaxeRates(et.DefaultTaxeRates),
+                et.AccountingCode.String,
+                strconv.FormatBool(et.Reimbursable),
+                et.ModelRef.String,
+            })
+        }
+        return c.print(views, rows...)
+    default:
+        return fmt.Errorf("%w: unknown type command %q", errUsage, args[0])
+    }
+}
+
+func (c cli) session(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("%w: expected session start|close|list|tag|set", errUsage)
+    }
+    switch args[0] {
+    case "tag":
+        return c.tagEntity(db.CustomFieldOnSession, args[1:])
+    case "set":
+        return c.setCustomFields(db.CustomFieldOnSession, args[1:])
+    }
+    fs := flag.NewFlagSet("session "+args[0], flag.ContinueOnError)
+    clientFlag := fs.String("client", "", "client name or ID")
+    location := fs.String("location", "", "mission location")
+    from := fs.String("from", "", "trip start location")
+    to := fs.String("to", "", "trip end location")
+    at := fs.String("at", "", "start or close date, local to --tz (default: now)")
+    timeZone := fs.String("tz", config.TimeZone, "IANA time zone of the session (Europe/Paris...)")
+    attributeFlags := newAttributeFlags(fs)
+    positional, err := parseArgs(fs, args[1:])
+    if err != nil {
+        return err
+    }
+
+    switch args[0] {
+    case "start":
+        if err := onlyFlags(
+            fs, "client", "location", "from", "to", "at", "tz", "tag", "field",
+        ); err != nil {
+            return err
+        }
+        if err := expectArgs(positional, 0, "no argument"); err != nil {
+            return err
+        }
+        sessionTimeZone, err := parseTimeZone(*timeZone)
+        if err != nil {
+            return err
+        }
+        atTime, err := parseAt(*at, sessionTimeZone)
+        if err != nil {
+            return err
+        }
+        clientID, err := c.resolveClient(*clientFlag)
+        if err != nil {
+            return err
+        }
+        attributes, err := attributeFlags.attributes()
+        if err != nil {
+            return err
+        }
+        if _, err := services.ResolveAttributes(
+            c.database, db.CustomFieldOnSession, attributes, false,
+        ); err != nil {
+            return err
+        }
+        session := db.Session{
+            ClientID:          clientID,
+            Location:          *location,
+            TripStartLocation: sql.NullString{String: *from, Valid: *from != ""},
+            TripEndLocation:   sql.NullString{String: *to, Valid: *to != ""},
+            StartAtDateTime:   db.NullableTime{Time: atTime, Valid: true},
+            TimeZone:          sessionTimeZone,
+        }
+        session.ID, err = crud.CreateSession(c.database, session)
+        if err != nil {
+            return err
+        }
+        if err := services.ApplyAttributes(
+            c.database, db.CustomFieldOnSession, session.ID, attributes,
+        ); err != nil {
+            return err
+        }
+        view := newSessionView(session)
+        if view.Attributes, err = services.GetAttributes(
+            c.database, db.CustomFieldOnSession, session.ID,
+        ); err != nil {
+            return err
+        }
+        return c.print(
+            view,
+            []string{fmt.Sprintf("session #%d started: %s", session.ID, session.Location)},
+        )
+    case "close":
+        if err := onlyFlags(fs, "at"); err != nil {
+            return err
+        }
+        if err := expectArgs(positional, 1, "SESSION_ID"); err != nil {
+            return err
+        }
+        id, err := parseID(positional[0])
+        if err != nil {
+            return err
+        }
+        session, err := crud.GetSessionByID(c.database, id)
+        if err != nil {
+            return err
+        }
+        atTime, err := parseAt(*at, session.TimeZone)
+        if err != nil {
+            return err
+        }
+        session.EndAtDateTime = db.NullableTime{Time: atTime, Valid: true}
+        if err := crud.UpdateSession(c.database, *session); err != nil {
+            return err
+        }
+        return c.print(
+            newSessionView(*session),
+            []string{fmt.Sprintf("session #%d closed", session.ID)},
+        )
+    case "list":
+        if err := onlyFlags(fs, "tag", "field"); err != nil {
+            return err
+        }
+        filter, err := attributeFlags.filter(c, db.CustomFieldOnSession)
+        if err != nil {
+            return err
+        }
+        sessions, err := crud.ListSessionsByFilter(c.database, filter)
+        if err != nil {
+            return err
+        }
+        attributes, err := services.MapAttributes(c.database, db.CustomFieldOnSession)
+        if err != nil {
+            return err
+        }
+        views := make([]sessionView, 0, len(sessions))
+        rows := [][]string{{"ID", "CLIENT", "LOCATION", "START", "END", "TAGS"}}
+        for _, session := range sessions {
+            view := newSessionView(session)
+            view.Attributes = attributes[session.ID]
+            views = append(views, view)
+            rows = append(rows, []string{
+                strconv.FormatInt(session.ID, 10),
+                strconv.FormatInt(session.ClientID, 10),
+                session.Location,
+                formatOptionalDate(view.StartAtDateTime),
+                formatOptionalDate(view.EndAtDateTime),
+                strings.Join(view.Tags, ", "),
+            })
+        }
+        return c.print(views, rows...)
+    default:
+        return fmt.Errorf("%w: unknown session command %q", errUsage, args[0])
+    }
+}
+
+func (c cli) expense(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf(
+            "%w: expected expense add|attach|list|scan|duplicates|merge|allocate|tag|set",
+            errUsage,
+        )
+    }
+    switch args[0] {
+    case "scan":
+        return c.scanReceipt(args[1:])
+    case "attach":
+        return c.attachReceipts(args[1:])
+    case "duplicates":
+        return c.expenseDuplicates(args[1:])
+    case "merge":
+        return c.mergeExpenses(args[1:])
+    case "allocate":
+        return c.allocateExpense(args[1:])
+    case "tag":
+        return c.tagEntity(db.CustomFieldOnExpense, args[1:])
+    case "set":
+        return c.setCustomFields(db.CustomFieldOnExpense, args[1:])
+    }
+    fs := flag.NewFlagSet("expense "+args[0], flag.ContinueOnError)
+    typeName := fs.String("type", "", "expense type name")
+    total := fs.Float64("total", 0, "total amount, taxes included")
+    tax := fs.Float64("tax", 0, "taxe rate in percent")
+    currency := fs.String("currency", "EUR", "currency code")
+    sessionID := fs.Int64("session", 0, "session ID")
+    var receiptFiles repeatedFlag
+    fs.Var(&receiptFiles, "receipt", "receipt file to attach, can be repeated")
+    notes := fs.String("notes", "", "notes")
+    merchant := fs.String("merchant", "", "shop, hotel or company paid")
+    date := fs.String("date", "", "expense date, local to --tz (default: now)")
+    country := fs.String("country", "", "country code (FR, DE...), checks the taxe rate")
+    timeZone := fs.String("tz", config.TimeZone, "IANA time zone where it happened (Europe/Paris...)")
+    days := fs.Int("days", 0, "days covered from its date (hotel nights...), spread in period reports")
+    attributeFlags := newAttributeFlags(fs)
+    positional, err := parseArgs(fs, args[1:])
+    if err != nil {
+        return err
+    }
+    if err := expectArgs(positional, 0, "no argument"); err != nil {
+        return err
+    }
+
+    switch args[0] {
+    case "add":
+        expenseType, err := crud.GetExpenseTypeByName(c.database, *typeName)
+        if err != nil {
+            return err
+        }
+        if expenseType == nil {
+            return fmt.Errorf("unknown expense type: %q", *typeName)
+        }
+
+        expenseTimeZone, err := parseTimeZone(*timeZone)
+        if err != nil {
+            return err
+        }
+        dateTime, err := parseAt(*date, expenseTimeZone)
+        if err != nil {
+            return err
+        }
+        expense := db.Expense{
+            SessionID:   sql.NullInt64{Int64: *sessionID, Valid: *sessionID != 0},
+            TypeID:      expenseType.ID,
+            Currency:    *currency,
+            Notes:       sql.NullString{String: *notes, Valid: *notes != ""},
+            DateTime:    dateTime,
+            Country:     sql.NullString{String: strings.ToUpper(*country), Valid: *country != ""},
+            TimeZone:    expenseTimeZone,
+            CoveredDays: sql.NullInt64{Int64: int64(*days), Valid: *days != 0},
+            Merchant:    sql.NullString{String: *merchant, Valid: *merchant != ""},
+        }
+        lineItem := db.LineItem{ExpenseID: 1, TaxeRate: *tax, Total: *total}
+        if err := lineItem.PreInsertValid(); err != nil {
+            return err
+        }
+        if err := expense.PreInsertValid(); err != nil {
+            return err
+        }
+        attributes, err := attributeFlags.attributes()
+        if err != nil {
+            return err
+        }
+        if _, err := services.ResolveAttributes(
+            c.database, db.CustomFieldOnExpense, attributes, false,
+        ); err != nil {
+            return err
+        }
+        // One transaction, receipt files stored last: a failure leaves no
+        // expense behind, nor a file no expense uses
+        var receipts db.ReceiptList
+        var stored []string
+        err = db.InTx(c.database, func(tx db.Querier) error {
+            id, err := crud.CreateExpense(tx, expense)
+            if err != nil {
+                return err
+            }
+            expense.ID, lineItem.ExpenseID = id, id
+            if _, err := crud.CreateLineItem(tx, lineItem); err != nil {
+                return err
+            }
+            if err := services.ApplyAttributes(
+                tx, db.CustomFieldOnExpense, expense.ID, attributes,
+            ); err != nil {
+                return err
+            }
+            for _, file := range receiptFiles {
+                relPath, err := db.StoreReceipt(file)
+                if err != nil {
+                    return err
+                }
+                stored = append(stored, relPath)
+                if slices.Contains(receipts.RelPaths(), relPath) {
+                    continue
+                }
+                receipt := db.Receipt{ExpenseID: expense.ID, RelPath: relPath}
+                if receipt.ID, err = crud.CreateReceipt(tx, receipt); err != nil {
+                    return err
+                }
+                receipts = append(receipts, receipt)
+            }
+            return nil
+        })
+        if err != nil {
+            c.removeUnusedReceipts(stored)
+            return err
+        }
+
+        view := newExpenseView(expense, expenseType.Name, db.LineItemList{lineItem}, receipts)
+        if view.Attributes, err = services.GetAttributes(
+            c.database, db.CustomFieldOnExpense, expense.ID,
+        ); err != nil {
+            return err
+        }
+        view.Duplicates, err = services.FindDuplicatesOf(
+            c.database, expense.ID, services.DefaultDuplicateThreshold,
+        )
+        if err != nil {
+            return err
+        }
+        rows := [][]string{{fmt.Sprintf(
+            "expense #%d created: %s %s %s",
+            expense.ID, expenseType.Name, formatAmount(*total), expense.Currency,
+        )}}
+        for _, duplicate := range view.Duplicates {
+            rows = append(rows, []string{formatDuplicate(duplicate)})
+        }
+        return c.print(view, rows...)
+    case "list":
+        if err := onlyFlags(fs, "session", "tag", "field"); err != nil {
+            return err
+        }
+        filter, err := attributeFlags.filter(c, db.CustomFieldOnExpense)
+        if err != nil {
+            return err
+        }
+        expenses, err := crud.ListExpensesByFilter(
+            c.database, crud.ExpenseFilter{SessionID: *sessionID, AttributeFilter: filter},
+        )
+        if err != nil {
+            return err
+        }
+        attributes, err := services.MapAttributes(c.database, db.CustomFieldOnExpense)
+        if err != nil {
+            return err
+        }
+        allocations, err := crud.ListAllocations(c.database)
+        if err != nil {
+            return err
+        }
+        allocatedTo := make(map[int64][]int64)
+        for _, allocation := range allocations {
+            allocatedTo[allocation.ExpenseID] = append(
+                allocatedTo[allocation.ExpenseID], allocation.SessionID,
+            )
+        }
+
+        // Line items and receipts of all the expenses in one query each
+        ids := make([]int64, len(expenses))
+        for i, expense := range expenses {
+            ids[i] = expense.ID
+        }
+        lineItems := make(map[int64]db.LineItemList, len(expenses))
+        allLineItems, err := crud.ListLineItemsByExpenseIDs(c.database, ids)
+        if err != nil {
+            return err
+        }
+        for _, lineItem := range allLineItems {
+            lineItems[lineItem.ExpenseID] = append(lineItems[lineItem.ExpenseID], lineItem)
+        }
+        receipts := make(map[int64]db.ReceiptList, len(expenses))
+        allReceipts, err := crud.ListReceiptsByExpenseIDs(c.database, ids)
+        if err != nil {
+            return err
+        }
+        for _, receipt := range allReceipts {
+            receipts[receipt.ExpenseID] = append(receipts[receipt.ExpenseID], receipt)
+        }
+
+        typeNames, err := c.expenseTypeNames()
+        if err != nil {
+            return err
+        }
+        views := make([]expenseView, 0, len(expenses))
+        rows := [][]string{
+            {"ID", "DATE", "TYPE", "TOTAL", "CURRENCY", "SESSION", "RECEIPTS", "TAGS"},
+        }
+        for _, expense := range expenses {
+            view := newExpenseView(
+                expense, typeNames[expense.TypeID], lineItems[expense.ID], receipts[expense.ID],
+            )
+            view.Attributes = attributes[expense.ID]
+            view.AllocatedTo = allocatedTo[expense.ID]
+            views = append(views, view)
+
+            var sum float64
+            for _, lineItem := range lineItems[expense.ID] {
+                sum += lineItem.Total
+            }
+            session := ""
+            if expense.SessionID.Valid {
+                session = strconv.FormatInt(expense.SessionID.Int64, 10)
+            }
+            for i, sessionID := range view.AllocatedTo {
+                if i > 0 || session != "" {
+                    session += "+"
+                }
+                session += strconv.FormatInt(sessionID, 10)
+            }
+            rows = append(rows, []string{
+                strconv.FormatInt(expense.ID, 10),
+                expense.LocalDate(),
+                view.Type,
+                formatAmount(sum),
+                expense.Currency,
+                session,
+                strconv.Itoa(len(receipts[expense.ID])),
+                strings.Join(view.Tags, ", "),
+            })
+        }
+        return c.print(views, rows...)
+    default:
+        return fmt.Errorf("%w: unknown expense command %q", errUsage, args[0])
+    }
+}
+
+// Add receipt files to an existing expense, after the ones it already has
+func (c cli) attachReceipts(args []string) error {
+    if len(args) < 2 {
+        return fmt.Errorf("%w: expected EXPENSE_ID FILE...", errUsage)
+    }
+    expenseID, err := parseID(args[0])
+    if err != nil {
+        return err
+    }
+    if _, err := crud.GetExpenseByID(c.database, expenseID); err != nil {
+        return err
+    }
+    attached, err := crud.ListReceiptsByExpenseID(c.database, expenseID)
+    if err != nil {
+        return err
+    }
+
+    // Same as expense add: all the files or none, a file given twice or
+    // already attached is skipped
+    var receipts db.ReceiptList
+    var stored []string
+    err = db.InTx(c.database, func(tx db.Querier) error {
+        for _, file := range args[1:] {
+            relPath, err := db.StoreReceipt(file)
+            if err != nil {
+                return err
+            }
+            stored = append(stored, relPath)
+            if slices.Contains(attached.RelPaths(), relPath) ||
+                slices.Contains(receipts.RelPaths(), relPath) {
+                continue
+            }
+            receipt := db.Receipt{ExpenseID: expenseID, RelPath: relPath}
+            if receipt.ID, err = crud.CreateReceipt(tx, receipt); err != nil {
+                return err
+            }
+            receipts = append(receipts, receipt)
+        }
+        return nil
+    })
+    if err != nil {
+        c.removeUnusedReceipts(stored)
+        return err
+    }
+    views := make([]receiptView, 0, len(receipts))
+    rows := [][]string{{"ID", "RECEIPT"}}
+    for _, receipt := range receipts {
+        views = append(views, newReceiptView(receipt))
+        rows = append(rows, []string{strconv.FormatInt(receipt.ID, 10), receipt.RelPath})
+    }
+    return c.print(views, rows...)
+}
+
+// Receipt files stored for writes that were rolled back, unless another
+// expense uses the same file (StoreReceipt keeps one file per content)
+func (c cli) removeUnusedReceipts(relPaths []string) {
+    for _, relPath := range relPaths {
+        used, err := crud.ListReceiptsByRelPath(c.database, relPath)
+        if err != nil || len(used) > 0 {
+            continue
+        }
+        db.RemoveReceiptFiles(relPath) // logged when it fails
+    }
+}
+
+// List pairs of expenses looking like the same purchase logged twice
+func (c cli) expenseDuplicates(args []string) error {
+    fs := flag.NewFlagSet("expense duplicates", flag.ContinueOnError)
+    threshold := fs.Float64(
+        "threshold", services.DefaultDuplicateThreshold, "minimum score, from 0 to 1",
+    )
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if err := expectArgs(positional, 0, "no argument"); err != nil {
+        return err
+    }
+    if *threshold < 0 || *threshold > 1 {
+        return fmt.Errorf("%w: --threshold must be between 0 and 1", errUsage)
+    }
+
+    duplicates, err := services.FindDuplicates(c.database, *threshold)
+    if err != nil {
+        return err
+    }
+    rows := [][]string{{"EXPENSE", "DUPLICATE OF", "SCORE", "REASONS"}}
+    for _, duplicate := range duplicates {
+        rows = append(rows, []string{
+            strconv.FormatInt(duplicate.ExpenseID, 10),
+            strconv.FormatInt(duplicate.DuplicateOfID, 10),
+            formatAmount(duplicate.Score),
+            strings.Join(duplicate.Reasons, ", "),
+        })
+    }
+    return c.print(duplicates, rows...)
+}
+
+func (c cli) mergeExpenses(args []string) error {
+    if err := expectArgs(args, 2, "KEEP_ID DROP_ID"); err != nil {
+        return err
+    }
+    keepID, err := parseID(args[0])
+    if err != nil {
+        return err
+    }
+    dropID, err := parseID(args[1])
+    if err != nil {
+        return err
+    }
+
+    report, err := services.MergeExpenses(c.database, keepID, dropID)
+    if err != nil {
+        return err
+    }
+    rows := [][]string{{fmt.Sprintf(
+        "expense #%d merged into #%d: %d line items moved, %d identical skipped, " +
+        "%d receipts moved, total %s",
+        report.DroppedID, report.KeptID, report.LineItemsMoved, report.LineItemsSkipped,
+        report.ReceiptsMoved, formatAmount(report.Total),
+    )}}
+    for _, warning := range report.Warnings {
+        rows = append(rows, []string{"warning: " + warning})
+    }
+    return c.print(report, rows...)
+}
+
+// Split an expense across sessions: SESSION_ID=PERCENT% or SESSION_ID=AMOUNT
+func (c cli) allocateExpense(args []string) error {
+    fs := flag.NewFlagSet("expense allocate", flag.ContinueOnError)
+    clearFlag := fs.Bool("clear", false, "remove the allocations")
+    sessionID := fs.Int64("session", 0, "session of the expense after --clear")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if len(positional) == 0 || (*clearFlag && len(positional) != 1) || (!*clearFlag && len(positional) < 2) {
+        return fmt.Errorf(
+            "%w: expected EXPENSE_ID SESSION_ID=PERCENT%%|AMOUNT... or EXPENSE_ID --clear",
+            errUsage,
+        )
+    }
+    expenseID, err := parseID(positional[0])
+    if err != nil {
+        return err
+    }
+
+    if *clearFlag {
+        if err := services.ClearAllocations(c.database, expenseID, *sessionID); err != nil {
+            return err
+        }
+        return c.print(
+            map[string]any{"expense_id": expenseID, "session_id": *sessionID},
+            []string{fmt.Sprintf("allocations of expense #%d removed", expenseID)},
+        )
+    }
+
+    allocations := make(db.AllocationList, 0, len(positional)-1)
+    for _, arg := range positional[1:] {
+        allocation, err := parseAllocation(arg)
+        if err != nil {
+            return err
+        }
+        allocations = append(allocations, allocation)
+    }
+    shares, err := services.AllocateExpense(c.database, expenseID, allocations)
+    if err != nil {
+        return err
+    }
+    rows := [][]string{{"SESSION", "ALLOCATION", "SHARE"}}
+    for _, share := range shares {
+        allocation := ""
+        if share.Percentage != nil {
+            allocation = formatAmount(*share.Percentage) + "%"
+        } else {
+            allocation = formatAmount(*share.Amount)
+        }
+        rows = append(rows, []string{
+            strconv.FormatInt(share.SessionID, 10), allocation, formatAmount(share.Share),
+        })
+    }
+    return c.print(shares, rows...)
+}
+
+// "12=40%" or "12=120.50"
+func parseAllocation(arg string) (db.Allocation, error) {
+    sessionPart, value, ok := strings.Cut(arg, "=")
+    if !ok {
+        return db.Allocation{}, fmt.Errorf(
+            "%w: expected SESSION_ID=PERCENT%% or SESSION_ID=AMOUNT, got %q", errUsage, arg,
+        )
+    }
+    sessionID, err := parseID(sessionPart)
+    if err != nil {
+        return db.Allocation{}, err
+    }
+    allocation := db.Allocation{SessionID: sessionID}
+    number, isPercentage := strings.CutSuffix(value, "%")
+    parsed, err := strconv.ParseFloat(number, 64)
+    if err != nil {
+        return db.Allocation{}, fmt.Errorf("%w: invalid allocation %q", errUsage, arg)
+    }
+    if isPercentage {
+        allocation.Percentage = sql.NullFloat64{Float64: parsed, Valid: true}
+    } else {
+        allocation.Amount = sql.NullFloat64{Float64: parsed, Valid: true}
+    }
+    return allocation, nil
+}
+
+func formatDuplicate(duplicate services.DuplicateCandidate) string {
+    return fmt.Sprintf(
+        "expense #%d may duplicate #%d (score %s: %s), see expense merge",
+        duplicate.ExpenseID, duplicate.DuplicateOfID, formatAmount(duplicate.Score),
+        strings.Join(duplicate.Reasons, ", "),
+    )
+}
+
+type expenseDraftView struct {
+    Expense    expenseView     `json:"expense"`
+    Saved      bool            `json:"saved"`
+    Warnings   []string        `json:"warnings"`
+    Extraction *ocr.Extraction `json:"extraction"`
+}
+
+// Read a receipt with OCR and show the pre-filled expense, only saved with --save
+func (c cli) scanReceipt(args []string) error {
+    fs := flag.NewFlagSet("expense scan", flag.ContinueOnError)
+    typeName := fs.String("type", "", "expense type name, required with --save")
+    currency := fs.String("currency", "EUR", "currency when none is found on the receipt")
+    sessionID := fs.Int64("session", 0, "session ID")
+    country := fs.String("country", "", "country code (FR, DE...), checks the taxe rates")
+    languages := fs.String("lang", ocr.DefaultLanguages, "tesseract languages")
+    save := fs.Bool("save", false, "save the expense as read")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if err := expectArgs(positional, 1, "FILE"); err != nil {
+        return err
+    }
+
+    typeID, typeLabel := int64(1), "(type)" // placeholder until saved
+    if *save || *typeName != "" {
+        expenseType, err := crud.GetExpenseTypeByName(c.database, *typeName)
+        if err != nil {
+            return err
+        }
+        if expenseType == nil {
+            return fmt.Errorf("%w: --save needs a known --type, got %q", errUsage, *typeName)
+        }
+        typeID, typeLabel = expenseType.ID, expenseType.Name
+    }
+
+    engine, err := ocr.NewTesseract(*languages)
+    if err != nil {
+        return err
+    }
+    relPath, err := db.StoreReceipt(positional[0])
+    if err != nil {
+        return err
+    }
+    draft, err := services.DraftExpenseFromReceipt(
+        context.Background(), engine, relPath, *currency,
+    )
+    if err != nil {
+        return err
+    }
+    draft.Expense.TypeID = typeID
+    draft.Expense.SessionID = sql.NullInt64{Int64: *sessionID, Valid: *sessionID != 0}
+    draft.Expense.Country = sql.NullString{
+        String: strings.ToUpper(*country), Valid: *country != "",
+    }
+
+    view := expenseDraftView{
+        Saved:      *save,
+        Warnings:   draft.Warnings,
+        Extraction: draft.Extraction,
+    }
+    var duplicates []services.DuplicateCandidate
+    if *save {
+        expenseID, err := services.SaveExpenseDraft(c.database, draft)
+        if err != nil {
+            return err
+        }
+        duplicates, err = services.FindDuplicatesOf(
+            c.database, expenseID, services.DefaultDuplicateThreshold,
+        )
+        if err != nil {
+            return err
+        }
+    }
+    view.Expense = newExpenseView(draft.Expense, typeLabel, draft.LineItems, draft.Receipts)
+    view.Expense.Duplicates = duplicates
+    rows := [][]string{
+        {"date", draft.Expense.DateTime.Format(time.DateOnly)},
+        {"merchant", draft.Extraction.Merchant},
+        {"currency", draft.Expense.Currency},
+    }
+    for _, lineItem := range draft.LineItems {
+        rows = append(rows, []string{
+            "line item",
+            formatAmount(lineItem.Total) + " (taxe " +
+                strconv.FormatFloat(lineItem.TaxeRate, 'f', -1, 64) + "%)",
+        })
+    }
+    for _, warning := range draft.Warnings {
+        rows = append(rows, []string{"warning", warning})
+    }
+    if *save {
+        rows = append(rows, []string{"saved", fmt.Sprintf("expense #%d", draft.Expense.ID)})
+        for _, duplicate := range duplicates {
+            rows = append(rows, []string{"warning", formatDuplicate(duplicate)})
+        }
+    } else {
+        rows = append(rows, []string{"", "check the values, then run again with --save --type NAME"})
+    }
+    return c.print(view, rows...)
+}
+
+func (c cli) trip(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("%w: expected trip add|list", errUsage)
+    }
+    fs := flag.NewFlagSet("trip "+args[0], flag.ContinueOnError)
+    sessionID := fs.Int64("session", 0, "session ID")
+    positional, err := parseArgs(fs, args[1:])
+    if err != nil {
+        return err
+    }
+
+    switch args[0] {
+    case "add":
+        if err := expectArgs(positional, 2, "DATE DISTANCE"); err != nil {
+            return err
+        }
+        distance, err := strconv.ParseFloat(
+            strings.TrimSuffix(strings.ToLower(positional[1]), "km"), 64,
+        )
+        if err != nil {
+            return fmt.Errorf("%w: invalid distance %q", errUsage, positional[1])
+        }
+        carTrip := db.CarTrip{
+            SessionID:  sql.NullInt64{Int64: *sessionID, Valid: *sessionID != 0},
+            DistanceKM: distance,
+            DateOnly:   positional[0],
+        }
+        carTrip.ID, err = crud.CreateCarTrip(c.database, carTrip)
+        if err != nil {
+            return err
+        }
+        return c.print(newCarTripView(carTrip), []string{fmt.Sprintf(
+            "car trip #%d created: %v km @ %s",
+            carTrip.ID, carTrip.DistanceKM, carTrip.DateOnly,
+        )})
+    case "list":
+        if err := onlyFlags(fs); err != nil {
+            return err
+        }
+        carTrips, err := crud.ListCarTrips(c.database)
+        if err != nil {
+            return err
+        }
+        views := make([]carTripView, 0, len(carTrips))
+        rows := [][]string{{"ID", "DATE", "KM", "SESSION"}}
+        for _, carTrip := range carTrips {
+            view := newCarTripView(carTrip)
+            views = append(views, view)
+            session := ""
+            if carTrip.SessionID.Valid {
+                session = strconv.FormatInt(carTrip.SessionID.Int64, 10)
+            }
+            rows = append(rows, []string{
+                strconv.FormatInt(carTrip.ID, 10),
+                carTrip.DateOnly,
+                strconv.FormatFloat(carTrip.DistanceKM, 'f', -1, 64),
+                session,
+            })
+        }
+        return c.print(views, rows...)
+    default:
+        return fmt.Errorf("%w: unknown trip command %q", errUsage, args[0])
+    }
+}
+
+// A client can be given by name or by ID
+func (c cli) taxRates(args []string) error {
+    if len(args) == 0 || args[0] != "list" {
+        return fmt.Errorf("%w: expected rates list", errUsage)
+    }
+    fs := flag.NewFlagSet("rates list", flag.ContinueOnError)
+    country := fs.String("country", "", "country code (default: all)")
+    on := fs.String("on", "", "only the rates valid on this date")
+    positional, err := parseArgs(fs, args[1:])
+    if err != nil {
+        return err
+    }
+    if err := expectArgs(positional, 0, "no argument"); err != nil {
+        return err
+    }
+
+    var taxRates []db.TaxRate
+    if *on != "" {
+        date, err := parseDateTime(*on)
+        if err != nil {
+            return err
+        }
+        taxRates, err = crud.ListTaxRatesValidOn(c.database, strings.ToUpper(*country), date)
+        if err != nil {
+            return err
+        }
+    } else {
+        taxRates, err = crud.ListTaxRates(c.database, strings.ToUpper(*country))
+        if err != nil {
+            return err
+        }
+    }
+
+    views := make([]taxRateView, 0, len(taxRates))
+    rows := [][]string{{"COUNTRY", "LABEL", "RATE", "FROM", "TO"}}
+    for _, tr := range taxRates {
+        views = append(views, taxRateView{
+            tr.ID, tr.PublicID, tr.Country, tr.Label, tr.Rate,
+            nullStringPtr(tr.ValidFrom), nullStringPtr(tr.ValidTo),
+        })
+        rows = append(rows, []string{
+            tr.Country,
+            tr.Label,
+            strconv.FormatFloat(tr.Rate, 'f', -1, 64) + "%",
+            tr.ValidFrom.String,
+            tr.ValidTo.String,
+        })
+    }
+    return c.print(views, rows...)
+}
+
+func (c cli) resolveClient(value string) (int64, error) {
+    if value == "" {
+        return 0, fmt.Errorf("%w: --client is required", errUsage)
+    }
+    if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+        client, err := crud.GetClientByID(c.database, id)
+        if err != nil {
+            return 0, err
+        }
+        return client.ID, nil
+    }
+    client, err := crud.GetClientByName(c.database, value)
+    if err != nil {
+        return 0, err
+    }
+    if client == nil {
+        return 0, fmt.Errorf("unknown client: %q", value)
+    }
+    return client.ID, nil
+}
+
+func (c cli) expenseTypeNames() (map[int64]string, error) {
+    expenseTypes, err := crud.ListExpenseTypes(c.database)
+    if err != nil {
+        return nil, err
+    }
+    names := make(map[int64]string, len(expenseTypes))
+    for _, et := range expenseTypes {
+        names[et.ID] = et.Name
+    }
+    return names, nil
+}
+
+func newExpenseTypeView(et db.ExpenseType) expenseTypeView {
+    return expenseTypeView{
+        ID:               et.ID,
+        PublicID:         et.PublicID,
+        Name:             et.Name,
+        DefaultTaxeRates: et.DefaultTaxeRates,
+        AccountingCode:   nullStringPtr(et.AccountingCode),
+        Reimbursable:     et.Reimbursable,
+        VATRecoverable:   et.VATRecoverable,
+        Description:      nullStringPtr(et.Description),
+        ModelRef:         nullStringPtr(et.ModelRef),
+    }
+}
+
+func formatTaxeRates(rates db.TaxeRateList) string {
+    formatted := make([]string, 0, len(rates))
+    for _, rate := range rates {
+        formatted = append(formatted, strconv.FormatFloat(rate, 'f', -1, 64)+"%")
+    }
+    return strings.Join(formatted, " ")
+}
+
+func newSessionView(s db.Session) sessionView {
+    view := sessionView{
+        ID: s.ID, PublicID: s.PublicID, ClientID: s.ClientID, Location: s.Location,
+    }
+    if s.TripStartLocation.Valid {
+        view.TripStartLocation = &s.TripStartLocation.String
+    }
+    if s.TripEndLocation.Valid {
+        view.TripEndLocation = &s.TripEndLocation.String
+    }
+    // Local times, with the offset of the session time zone
+    start, end := s.LocalTimes()
+    if start.Valid {
+        view.StartAtDateTime = &start.Time
+    }
+    if end.Valid {
+        view.EndAtDateTime = &end.Time
+    }
+    view.TimeZone = nullStringPtr(s.TimeZone)
+    return view
+}
+
+func newExpenseView(
+    e db.Expense, typeName string, lineItems db.LineItemList, receipts db.ReceiptList,
+) expenseView {
+    view := expenseView{
+        ID:        e.ID,
+        PublicID:  e.PublicID,
+        Type:      typeName,
+        Currency:  e.Currency,
+        DateTime:  e.LocalTime(),
+        Receipts:  make([]receiptView, 0, len(receipts)),
+        LineItems: make([]services.ReportLineItem, 0, len(lineItems)),
+    }
+    if e.SessionID.Valid {
+        view.SessionID = &e.SessionID.Int64
+    }
+    for _, receipt := range receipts {
+        view.Receipts = append(view.Receipts, newReceiptView(receipt))
+    }
+    if e.Notes.Valid {
+        view.Notes = &e.Notes.String
+    }
+    view.Country = nullStringPtr(e.Country)
+    view.TimeZone = nullStringPtr(e.TimeZone)
+    view.Merchant = nullStringPtr(e.Merchant)
+    if e.CoveredDays.Valid {
+        view.CoveredDays = &e.CoveredDays.Int64
+    }
+    for _, lineItem := range lineItems {
+        view.LineItems = append(
+            view.LineItems,
+            services.ReportLineItem{TaxeRate: lineItem.TaxeRate, Total: lineItem.Total},
+        )
+    }
+    return view
+}
+
+func newCarTripView(ct db.CarTrip) carTripView {
+    view := carTripView{
+        ID: ct.ID, PublicID: ct.PublicID, DistanceKM: ct.DistanceKM, DateOnly: ct.DateOnly,
+    }
+    if ct.SessionID.Valid {
+        view.SessionID = &ct.SessionID.Int64
+    }
+    return view
+}
+
+func formatOptionalDate(t *time.Time) string {
+    if t == nil {
+        return ""
+    }
+    return t.Format(time.DateOnly)
+}
+
+type standardModelView struct {
+    Name             string `json:"name"`
+    Title            string `json:"title"`
+    Country          string `json:"country,omitempty"`
+    Version          int    `json:"version"`
+    InstalledVersion int    `json:"installed_version,omitempty"`
+}
+
+func (c cli) standardModels(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("%w: expected models list|install|diff|upgrade", errUsage)
+    }
+    fs := flag.NewFlagSet("models "+args[0], flag.ContinueOnError)
+    overwrite := fs.Bool("overwrite", false, "reset customized expense types to the pack values")
+    positional, err := parseArgs(fs, args[1:])
+    if err != nil {
+        return err
+    }
+
+    switch args[0] {
+    case "list":
+        if err := onlyFlags(fs); err != nil {
+            return err
+        }
+        names, err := db.StandardModels()
+        if err != nil {
+            return err
+        }
+        installed, err := db.InstalledStandardModels(c.database)
+        if err != nil {
+            return err
+        }
+        views := make([]standardModelView, 0, len(names))
+        rows := [][]string{{"NAME", "TITLE", "VERSION", "INSTALLED"}}
+        for _, name := range names {
+            model, err := db.LoadStandardModel(name)
+            if err != nil {
+                return err
+            }
+            view := standardModelView{
+                name, model.Title, model.Country, model.Version, installed[name],
+            }
+            views = append(views, view)
+            installedVersion := ""
+            if view.InstalledVersion > 0 {
+                installedVersion = "v" + strconv.Itoa(view.InstalledVersion)
+            }
+            rows = append(rows, []string{
+                name, model.Title, "v" + strconv.Itoa(model.Version), installedVersion,
+            })
+        }
+        return c.print(views, rows...)
+    case "install":
+        if err := onlyFlags(fs); err != nil {
+            return err
+        }
+        if len(positional) == 0 {
+            return fmt.Errorf("%w: expected NAME...", errUsage)
+        }
+        if err := db.InstallStandardModels(c.database, positional...); err != nil {
+            return err
+        }
+        return c.print(positional, []string{
+            "standard models installed: " + strings.Join(positional, ", "),
+        })
+    case "diff", "upgrade":
+        if err := expectArgs(positional, 1, "NAME"); err != nil {
+            return err
+        }
+        if args[0] == "diff" {
+            if err := onlyFlags(fs); err != nil {
+                return err
+            }
+        }
+        var diffs []db.StandardModelDiff
+        if args[0] == "diff" {
+            diffs, err = db.DiffStandardModel(c.database, positional[0])
+        } else {
+            diffs, err = db.UpgradeStandardModel(c.database, positional[0], *overwrite)
+        }
+        if err != nil {
+            return err
+        }
+        rows := [][]string{{"KEY", "STATUS", "NAME", "FIELDS"}}
+        for _, diff := range diffs {
+            name := ""
+            if diff.Current != nil {
+                name = diff.Current.Name
+            } else if diff.Pack != nil {
+                name = diff.Pack.Name
+            }
+            rows = append(rows, []string{
+                diff.Key, diff.Status, name, strings.Join(diff.Fields, ", "),
+            })
+        }
+        return c.print(diffs, rows...)
+    default:
+        return fmt.Errorf("%w: unknown models command %q", errUsage, args[0])
+    }
+}
+
+// Preview and thumbnail are only given when they exist
+func newReceiptView(r db.Receipt) receiptView {
+    view := receiptView{ID: r.ID, PublicID: r.PublicID, RelPath: r.RelPath}
+    preview := db.ReceiptPreviewRelPath(r.RelPath)
+    thumbnail := db.ReceiptThumbnailRelPath(r.RelPath)
+    if _, err := os.Stat(filepath.Join(config.ReceiptsDir, preview)); err == nil {
+        view.Preview = &preview
+    }
+    if _, err := os.Stat(filepath.Join(config.ReceiptsDir, thumbnail)); err == nil {
+        view.Thumbnail = &thumbnail
+    }
+    return view
+}
+
+func nullStringPtr(ns sql.NullString) *string {
+    if !ns.Valid {
+        return nil
+    }
+    return &ns.String
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+)
+
+
+type recurringExpenseView struct {
+    ID          int64                     `json:"id"`
+    PublicID    string                    `json:"public_id,omitempty"`
+    Name        string                    `json:"name"`
+    Type        string                    `json:"type"`
+    Currency    string                    `json:"currency"`
+    LineItems   []services.ReportLineItem `json:"line_items"`
+    Notes       *string                   `json:"notes,omitempty"`
+    Country     *string                   `json:"country,omitempty"`
+    SessionRule string                    `json:"session_rule"`
+    SessionID   *int64                    `json:"session_id,omitempty"`
+    ClientID    *int64                    `json:"client_id,omitempty"`
+    Schedule    string                    `json:"schedule"`
+    StartDate   string                    `json:"start_date"`
+    LastDate    *string                   `json:"last_generated_date,omitempty"`
+}
+
+func (c cli) recurring(args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("%w: expected recurring add|list|delete|run", errUsage)
+    }
+    fs := flag.NewFlagSet("recurring "+args[0], flag.ContinueOnError)
+    typeName := fs.String("type", "", "expense type name")
+    total := fs.Float64("total", 0, "total amount, taxes included")
+    tax := fs.Float64("tax", 0, "taxe rate in percent")
+    var lines repeatedFlag
+    fs.Var(&lines, "line", "line item RATE:TOTAL, can be repeated instead of --total")
+    currency := fs.String("currency", "EUR", "currency code")
+    notes := fs.String("notes", "", "notes of the generated expenses")
+    country := fs.String("country", "", "country code (FR, DE...)")
+    schedule := fs.String("schedule", "", `RRULE subset, like "FREQ=MONTHLY;BYMONTHDAY=5"`)
+    start := fs.String("start", "", "date of the first occurrence (default: today)")
+    sessionID := fs.Int64("session", 0, "session of every generated expense")
+    clientFlag := fs.String("client", "", "client name or ID, its running session is used")
+    catchUp := fs.Bool("catch-up", false, "generate every missed occurrence")
+    dryRun := fs.Bool("dry-run", false, "show what would be generated")
+    on := fs.String("on", "", "generate what is due on this date (default: today)")
+    positional, err := parseArgs(fs, args[1:])
+    if err != nil {
+        return err
+    }
+
+    today := time.Now().UTC()
+    if *on != "" {
+        if today, err = parseDateTime(*on); err != nil {
+            return err
+        }
+    }
+
+    switch args[0] {
+    case "add":
+        if err := onlyFlags(
+            fs, "type", "total", "tax", "line", "currency", "notes", "country",
+            "schedule", "start", "session", "client",
+        ); err != nil {
+            return err
+        }
+        if err := expectArgs(positional, 1, "NAME"); err != nil {
+            return err
+        }
+        expenseType, err := crud.GetExpenseTypeByName(c.database, *typeName)
+        if err != nil {
+            return err
+        }
+        if expenseType == nil {
+            return fmt.Errorf("unknown expense type: %q", *typeName)
+        }
+        lineItems, err := parseLineItemTemplates(lines, *total, *tax)
+        if err != nil {
+            return err
+        }
+        parsedSchedule, err := db.ParseSchedule(*schedule)
+        if err != nil {
+            return err
+        }
+
+        recurring := db.RecurringExpense{
+            Name:        positional[0],
+            TypeID:      expenseType.ID,
+            Currency:    *currency,
+            LineItems:   lineItems,
+            Notes:       sql.NullString{String: *notes, Valid: *notes != ""},
+            Country:     sql.NullString{String: strings.ToUpper(*country), Valid: *country != ""},
+            SessionRule: db.RecurringNoSession,
+            Schedule:    parsedSchedule,
+            StartDate:   today.Format(time.DateOnly),
+        }
+        if *start != "" {
+            startTime, err := parseDateTime(*start)
+            if err != nil {
+                return err
+            }
+            recurring.StartDate = startTime.Format(time.DateOnly)
+        }
+        switch {
+        case *sessionID != 0 && *clientFlag != "":
+            return fmt.Errorf("%w: --session and --client can't be used together", errUsage)
+        case *sessionID != 0:
+            if _, err := crud.GetSessionByID(c.database, *sessionID); err != nil {
+                return err
+            }
+            recurring.SessionRule = db.RecurringFixedSession
+            recurring.SessionID = sql.NullInt64{Int64: *sessionID, Valid: true}
+        case *clientFlag != "":
+            clientID, err := c.resolveClient(*clientFlag)
+            if err != nil {
+                return err
+            }
+            recurring.SessionRule = db.RecurringClientSession
+            recurring.ClientID = sql.NullInt64{Int64: clientID, Valid: true}
+        }
+
+        if recurring.ID, err = crud.CreateRecurringExpense(c.database, recurring); err != nil {
+            return err
+        }
+        return c.print(
+            newRecurringExpenseView(recurring, expenseType.Name, nil),
+            []string{fmt.Sprintf(
+                "recurring expense #%d created: %s, %s from %s",
+                recurring.ID, recurring.Name, recurring.Schedule, recurring.StartDate,
+            )},
+        )
+    case "list":
+        if err := onlyFlags(fs); err != nil {
+            return err
+        }
+        if err := expectArgs(positional, 0, "no argument"); err != nil {
+            return err
+        }
+        recurrings, err := crud.ListRecurringExpenses(c.database)
+        if err != nil {
+            return err
+        }
+        typeNames, err := c.expenseTypeNames()
+        if err != nil {
+            return err
+        }
+        views := make([]recurringExpenseView, 0, len(recurrings))
+        rows := [][]string{{"ID", "NAME", "TYPE", "TOTAL", "CURRENCY", "SCHEDULE", "START", "LAST"}}
+        for _, recurring := range recurrings {
+            occurrences, err := crud.ListRecurringOccurrences(c.database, recurring.ID)
+            if err != nil {
+                return err
+            }
+            var last *string
+            if len(occurrences) > 0 {
+                last = &occurrences[len(occurrences)-1].DateOnly
+            }
+            view := newRecurringExpenseView(recurring, typeNames[recurring.TypeID], last)
+            views = append(views, view)
+
+            var sum float64
+            for _, item := range recurring.LineItems {
+                sum += item.Total
+            }
+            rows = append(rows, []string{
+                strconv.FormatInt(recurring.ID, 10),
+                recurring.Name,
+                view.Type,
+                formatAmount(sum),
+                recurring.Currency,
+                recurring.Schedule.String(),
+                recurring.StartDate,
+                formatOptionalString(last),
+            })
+        }
+        return c.print(views, rows...)
+    case "delete":
+        if err := onlyFlags(fs); err != nil {
+            return err
+        }
+        if err := expectArgs(positional, 1, "NAME|ID"); err != nil {
+            return err
+        }
+        recurring, err := c.resolveRecurringExpense(positional[0])
+        if err != nil {
+            return err
+        }
+        if err := crud.DeleteRecurringExpenseByID(c.database, recurring.ID); err != nil {
+            return err
+        }
+        return c.print(
+            newRecurringExpenseView(*recurring, "", nil),
+            []string{fmt.Sprintf(
+                "recurring expense #%d deleted, its generated expenses are kept: %s",
+                recurring.ID, recurring.Name,
+            )},
+        )
+    case "run":
+        if err := onlyFlags(fs, "catch-up", "dry-run", "on"); err != nil {
+            return err
+        }
+        if err := expectArgs(positional, 0, "no argument"); err != nil {
+            return err
+        }
+        report, err := services.GenerateRecurringExpenses(c.database, services.RecurringOptions{
+            Today:   today,
+            CatchUp: *catchUp,
+            DryRun:  *dryRun,
+        })
+        if err != nil {
+            return err
+        }
+
+        verb := "generated"
+        if *dryRun {
+            verb = "to generate"
+        }
+        rows := [][]string{{fmt.Sprintf("%d recurring expenses %s", len(report.Generated), verb)}}
+        for _, generated := range report.Generated {
+            row := fmt.Sprintf(
+                "  %s  %s  %s %s",
+                generated.DateOnly, generated.Name,
+                formatAmount(generated.Total), generated.Currency,
+            )
+            if generated.ExpenseID != 0 {
+                row += fmt.Sprintf("  expense #%d", generated.ExpenseID)
+            }
+            if generated.SessionID != nil {
+                row += fmt.Sprintf("  session #%d", *generated.SessionID)
+            }
+            rows = append(rows, []string{row})
+        }
+        names := make([]string, 0, len(report.Missed))
+        for name := range report.Missed {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        for _, name := range names {
+            rows = append(rows, []string{fmt.Sprintf(
+                "missed: %d earlier occurrences of %s (--catch-up generates them)",
+                report.Missed[name], name,
+            )})
+        }
+        for _, warning := range report.Warnings {
+            rows = append(rows, []string{"warning: " + warning})
+        }
+        return c.print(report, rows...)
+    default:
+        return fmt.Errorf("%w: unknown recurring command %q", errUsage, args[0])
+    }
+}
+
+// --line RATE:TOTAL given several times, or --total and --tax for one line
+func parseLineItemTemplates(lines []string, total float64, tax float64) (
+    db.LineItemTemplateList, error,
+) {
+    if len(lines) == 0 {
+        return db.LineItemTemplateList{{TaxeRate: tax, Total: total}}, nil
+    }
+    if total != 0 || tax != 0 {
+        return nil, fmt.Errorf("%w: --line can't be used with --total or --tax", errUsage)
+    }
+    var lineItems db.LineItemTemplateList
+    if err := lineItems.Scan(strings.Join(lines, ",")); err != nil {
+        return nil, fmt.Errorf("%w: expected --line RATE:TOTAL, like 20:49.99", errUsage)
+    }
+    return lineItems, nil
+}
+
+func (c cli) resolveRecurringExpense(value string) (*db.RecurringExpense, error) {
+    if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+        return crud.GetRecurringExpenseByID(c.database, id)
+    }
+    recurring, err := crud.GetRecurringExpenseByName(c.database, value)
+    if err != nil {
+        return nil, err
+    }
+    if recurring == nil {
+        return nil, fmt.Errorf("unknown recurring expense: %q", value)
+    }
+    return recurring, nil
+}
+
+func newRecurringExpenseView(
+    re db.RecurringExpense, typeName string, lastDate *string,
+) recurringExpenseView {
+    view := recurringExpenseView{
+        ID:          re.ID,
+        PublicID:    re.PublicID,
+        Name:        re.Name,
+        Type:        typeName,
+        Currency:    re.Currency,
+        LineItems:   make([]services.ReportLineItem, 0, len(re.LineItems)),
+        Notes:       nullStringPtr(re.Notes),
+        Country:     nullStringPtr(re.Country),
+        SessionRule: re.SessionRule,
+        Schedule:    re.Schedule.String(),
+        StartDate:   re.StartDate,
+        LastDate:    lastDate,
+    }
+    for _, item := range re.LineItems {
+        view.LineItems = append(
+            view.LineItems, services.ReportLineItem{TaxeRate: item.TaxeRate, Total: item.Total},
+        )
+    }
+    if re.SessionID.Valid {
+        view.SessionID = &re.SessionID.Int64
+    }
+    if re.ClientID.Valid {
+        view.ClientID = &re.ClientID.Int64
+    }
+    return view
+}
+
+func formatOptionalString(s *string) string {
+    if s == nil {
+        return ""
+    }
+    return *s
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/services"
+)
+
+
+func (c cli) report(args []string) error {
+    if len(args) > 0 {
+        switch args[0] {
+        case "vat":
+            return c.vatReport(args[1:])
+        case services.PeriodWeek, services.PeriodMonth, services.PeriodQuarter, "period":
+            return c.periodReport(args[0], args[1:])
+        }
+    }
+    fs := flag.NewFlagSet("report", flag.ContinueOnError)
+    format := fs.String("format", services.ReportFormatText, "text, json, csv or pdf")
+    outPath := fs.String("out", "", "output file (default: stdout, session_ID.pdf for pdf)")
+    locale := fs.String("locale", "", "language of the report (default: the configured one)")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if err := expectArgs(positional, 1, "SESSION_ID"); err != nil {
+        return err
+    }
+    id, err := parseID(positional[0])
+    if err != nil {
+        return err
+    }
+    printer, err := c.reportPrinter(*locale)
+    if err != nil {
+        return err
+    }
+    if c.jsonOutput && *format == services.ReportFormatText {
+        *format = services.ReportFormatJSON
+    }
+    if *format == services.ReportFormatPDF && *outPath == "" {
+        *outPath = fmt.Sprintf("session_%d.pdf", id)
+    }
+
+    report, err := services.BuildSessionReport(c.database, id)
+    if err != nil {
+        return err
+    }
+
+    return c.writeReport(*outPath, func(w io.Writer) error {
+        return services.WriteSessionReport(w, report, *format, printer)
+    })
+}
+
+// Both dates are included, the report covers whole days
+func (c cli) vatReport(args []string) error {
+    fs := flag.NewFlagSet("report vat", flag.ContinueOnError)
+    fromValue := fs.String("from", "", "first day of the period")
+    toValue := fs.String("to", "", "last day of the period")
+    format := fs.String("format", services.ReportFormatText, "text, json, csv or pdf")
+    outPath := fs.String("out", "", "output file (default: stdout, vat_FROM_TO.pdf for pdf)")
+    locale := fs.String("locale", "", "language of the report (default: the configured one)")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if err := expectArgs(positional, 0, "no argument"); err != nil {
+        return err
+    }
+    if *fromValue == "" || *toValue == "" {
+        return fmt.Errorf("%w: --from and --to are required", errUsage)
+    }
+    from, err := parseDateTime(*fromValue)
+    if err != nil {
+        return err
+    }
+    to, err := parseDateTime(*toValue)
+    if err != nil {
+        return err
+    }
+    printer, err := c.reportPrinter(*locale)
+    if err != nil {
+        return err
+    }
+    if c.jsonOutput && *format == services.ReportFormatText {
+        *format = services.ReportFormatJSON
+    }
+    if *format == services.ReportFormatPDF && *outPath == "" {
+        *outPath = fmt.Sprintf("vat_%s_%s.pdf", *fromValue, *toValue)
+    }
+
+    report, err := services.BuildVATReport(c.database, from, to.AddDate(0, 0, 1))
+    if err != nil {
+        return err
+    }
+    return c.writeReport(*outPath, func(w io.Writer) error {
+        return services.WriteVATReport(w, report, *format, printer)
+    })
+}
+
+// The week, month or quarter holding --on (today by default), or any
+// period with --from and --to, both included
+func (c cli) periodReport(period string, args []string) error {
+    fs := flag.NewFlagSet("report "+period, flag.ContinueOnError)
+    onValue, fromValue, toValue := new(string), new(string), new(string)
+    if period == "period" {
+        period = services.PeriodCustom
+        fromValue = fs.String("from", "", "first day of the period")
+        toValue = fs.String("to", "", "last day of the period")
+    } else {
+        onValue = fs.String("on", "", "a day of the "+period+" (default: today)")
+    }
+    format := fs.String("format", services.ReportFormatText, "text, json, csv or pdf")
+    outPath := fs.String("out", "", "output file (default: stdout, PERIOD_FROM_TO.pdf for pdf)")
+    locale := fs.String("locale", "", "language of the report (default: the configured one)")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if err := expectArgs(positional, 0, "no argument"); err != nil {
+        return err
+    }
+
+    var from, to time.Time
+    if period == services.PeriodCustom {
+        if *fromValue == "" || *toValue == "" {
+            return fmt.Errorf("%w: --from and --to are required", errUsage)
+        }
+        if from, err = parseDateTime(*fromValue); err != nil {
+            return err
+        }
+        if to, err = parseDateTime(*toValue); err != nil {
+            return err
+        }
+        to = to.AddDate(0, 0, 1)
+    } else {
+        on := time.Now().In(db.TimeZoneLocation(sql.NullString{
+            String: config.TimeZone, Valid: config.TimeZone != "",
+        }))
+        if *onValue != "" {
+            if on, err = parseDateTime(*onValue); err != nil {
+                return err
+            }
+        }
+        if from, to, err = services.PeriodRange(period, on, config.WeekStart); err != nil {
+            return err
+        }
+    }
+    printer, err := c.reportPrinter(*locale)
+    if err != nil {
+        return err
+    }
+    if c.jsonOutput && *format == services.ReportFormatText {
+        *format = services.ReportFormatJSON
+    }
+    if *format == services.ReportFormatPDF && *outPath == "" {
+        *outPath = fmt.Sprintf(
+            "%s_%s_%s.pdf",
+            period, from.Format(time.DateOnly), to.AddDate(0, 0, -1).Format(time.DateOnly),
+        )
+    }
+
+    report, err := services.BuildPeriodReport(c.database, period, from, to)
+    if err != nil {
+        return err
+    }
+    return c.writeReport(*outPath, func(w io.Writer) error {
+        return services.WritePeriodReport(w, report, *format, printer)
+    })
+}
+
+// The configured locale unless the report asks for another one
+func (c cli) reportPrinter(locale string) (*i18n.Printer, error) {
+    if locale == "" {
+        return c.printer, nil
+    }
+    matched := i18n.Match(locale)
+    if matched == "" {
+        return nil, fmt.Errorf(
+            "%w: --locale must be one of %s", errUsage, strings.Join(i18n.Supported, ", "),
+        )
+    }
+    return i18n.NewPrinter(matched), nil
+}
+
+func (c cli) writeReport(outPath string, write func(w io.Writer) error) error {
+    var w io.Writer = c.out
+    if outPath != "" {
+        file, err := os.Create(outPath)
+        if err != nil {
+            return err
+        }
+        defer file.Close()
+        w = file
+    }
+    if err := write(w); err != nil {
+        return err
+    }
+    if outPath != "" && !c.jsonOutput {
+        fmt.Fprintf(c.out, "report written to %s\n", outPath)
+    }
+    return nil
+}
+
+func (c cli) exportArchive(args []string) error {
+    fs := flag.NewFlagSet("export", flag.ContinueOnError)
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if err := expectArgs(positional, 1, "FILE"); err != nil {
+        return err
+    }
+
+    file, err := os.Create(positional[0])
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    if err := services.ExportArchive(c.database, file); err != nil {
+        return err
+    }
+    return c.print(
+        map[string]string{"file": positional[0]},
+        []string{"archive written to " + positional[0]},
+    )
+}
+
+func (c cli) importArchive(args []string) error {
+    fs := flag.NewFlagSet("import", flag.ContinueOnError)
+    rename := fs.Bool("rename", false, "rename clients and expense types already existing instead of merging them")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if err := expectArgs(positional, 1, "FILE"); err != nil {
+        return err
+    }
+
+    file, err := os.Open(positional[0])
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    policy := services.ConflictMerge
+    if *rename {
+        policy = services.ConflictRename
+    }
+    report, err := services.ImportArchive(c.database, file, policy)
+    if err != nil {
+        return err
+    }
+    rows := [][]string{{fmt.Sprintf(
+        "imported %d clients, %d sessions, %d car trips, %d expense types, " +
+        "%d expenses, %d line items, %d receipts, %d allocations",
+        report.Clients, report.Sessions, report.CarTrips, report.ExpenseTypes,
+        report.Expenses, report.LineItems, report.Receipts, report.Allocations,
+    )}}
+    for _, duplicate := range report.PossibleDuplicates {
+        rows = append(rows, []string{formatDuplicate(duplicate)})
+    }
+    return c.print(report, rows...)
+}
+
+func (c cli) search(args []string) error {
+    fs := flag.NewFlagSet("search", flag.ContinueOnError)
+    limit := fs.Int("limit", services.DefaultSearchLimit, "maximum number of hits")
+    positional, err := parseArgs(fs, args)
+    if err != nil {
+        return err
+    }
+    if len(positional) == 0 {
+        return fmt.Errorf("%w: expected QUERY", errUsage)
+    }
+
+    hits, err := services.Search(c.database, strings.Join(positional, " "), *limit)
+    if err != nil {
+        return err
+    }
+    rows := [][]string{{"KIND", "ID", "FIELD", "MATCH"}}
+    for _, hit := range hits {
+        rows = append(rows, []string{
+            hit.Kind, strconv.FormatInt(hit.EntityID, 10), hit.Field, hit.Snippet,
+        })
+    }
+    return c.print(hits, rows...)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/api"
+	"github.com/craftidev/expenseflow/internal/services"
+)
+
+
+// Runs until interrupted
+func (c cli) serve(args []string) error {
+    if len(args) > 0 {
+        return fmt.Errorf("%w: serve takes no argument, see --listen", errUsage)
+    }
+    server, err := api.NewServer(c.database, config.SyncToken, config.ReceiptsDir)
+    if err != nil {
+        return fmt.Errorf("%w (--sync-token or EXPENSEFLOW_SYNC_TOKEN)", err)
+    }
+    httpServer := &http.Server{
+        Addr:              config.ListenAddr,
+        Handler:           server.Handler(),
+        ReadHeaderTimeout: 10 * time.Second,
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    go func() {
+        <-ctx.Done()
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        httpServer.Shutdown(shutdownCtx)
+    }()
+
+    slog.Info("API listening", "address", config.ListenAddr)
+    fmt.Fprintf(c.out, "listening on %s, Ctrl+C to stop\n", config.ListenAddr)
+    if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+        return err
+    }
+    return nil
+}
+
+func (c cli) sync(args []string) error {
+    if len(args) == 1 && args[0] == "status" {
+        status, err := services.GetSyncStatus(c.database)
+        if err != nil {
+            return err
+        }
+        return c.print(status,
+            []string{"DEVICE", status.DeviceID},
+            []string{"SEQ", strconv.FormatInt(status.Seq, 10)},
+            []string{"PUSHED", strconv.FormatInt(status.PushedSeq, 10)},
+            []string{"PULLED", strconv.FormatInt(status.PulledCursor, 10)},
+        )
+    }
+    if len(args) > 0 {
+        return fmt.Errorf("%w: expected sync or sync status", errUsage)
+    }
+    if config.SyncServer == "" {
+        return fmt.Errorf("%w: no sync server, see --sync-server", errUsage)
+    }
+
+    report, err := api.Sync(c.database, config.SyncServer, config.SyncToken)
+    if err != nil {
+        return err
+    }
+    rows := [][]string{
+        {"PUSHED", strconv.Itoa(report.Pushed)},
+        {"PULLED", strconv.Itoa(report.Pulled)},
+    }
+    var conflicts []services.SyncConflict
+    warnings := report.Pull.Warnings
+    if report.Push != nil {
+        conflicts = report.Push.Conflicts
+        warnings = append(report.Push.Warnings, warnings...)
+    }
+    for _, conflict := range conflicts {
+        rows = append(rows, []string{
+            "CONFLICT", fmt.Sprintf("%s %s: %s, kept the server one", conflict.Table, conflict.PublicID, conflict.Reason),
+        })
+    }
+    for _, warning := range warnings {
+        rows = append(rows, []string{"WARNING", warning})
+    }
+    return c.print(report, rows...)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+// run is not exported, its tests live next to it
+func runCLI(database *sql.DB, args ...string) (string, error) {
+    var out bytes.Buffer
+    err := run(database, args, &out, false)
+    return out.String(), err
+}
+
+func TestParseArgs(t *testing.T) {
+    testCases := []struct {
+        args       []string
+        positional []string
+        session    int64
+    }{
+        {[]string{"2024-10-03", "42km", "--session", "3"}, []string{"2024-10-03", "42km"}, 3},
+        {[]string{"--session=3", "2024-10-03"}, []string{"2024-10-03"}, 3},
+        {[]string{"2024-10-03", "--", "--session"}, []string{"2024-10-03", "--session"}, 0},
+        {nil, nil, 0},
+    }
+    for _, tc := range testCases {
+        fs := flag.NewFlagSet("trip add", flag.ContinueOnError)
+        session := fs.Int64("session", 0, "session ID")
+        positional, err := parseArgs(fs, tc.args)
+        if err != nil {
+            t.Errorf("expected no error parsing %v, got: %v", tc.args, err)
+            continue
+        }
+        if !slices.Equal(positional, tc.positional) || *session != tc.session {
+            t.Errorf(
+                "expected %v and session %d from %v, got %v and %d",
+                tc.positional, tc.session, tc.args, positional, *session,
+            )
+        }
+    }
+
+    fs := flag.NewFlagSet("trip add", flag.ContinueOnError)
+    if _, err := parseArgs(fs, []string{"--unknown"}); !errors.Is(err, errUsage) {
+        t.Errorf("expected usage error on an unknown flag, got: %v", err)
+    }
+}
+
+func TestParseValues(t *testing.T) {
+    paris, _ := time.LoadLocation("Europe/Paris")
+    testCases := []struct {
+        value    string
+        location *time.Location
+        expected time.Time
+    }{
+        {"2024-04-15", time.UTC, time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)},
+        {"2024-04-15T10:30", paris, time.Date(2024, 4, 15, 8, 30, 0, 0, time.UTC)},
+        {"2024-04-15 10:30", paris, time.Date(2024, 4, 15, 8, 30, 0, 0, time.UTC)},
+        {"2024-04-15T10:30:00+02:00", time.UTC, time.Date(2024, 4, 15, 8, 30, 0, 0, time.UTC)},
+    }
+    for _, tc := range testCases {
+        parsed, err := parseDateTimeIn(tc.value, tc.location)
+        if err != nil || !parsed.Equal(tc.expected) {
+            t.Errorf("expected %q to be %v, got %v (%v)", tc.value, tc.expected, parsed, err)
+        }
+    }
+    for _, value := range []string{"15/04/2024", "2024-13-01", ""} {
+        if _, err := parseDateTime(value); !errors.Is(err, errUsage) {
+            t.Errorf("expected usage error on date %q, got: %v", value, err)
+        }
+    }
+    for _, value := range []string{"0", "-3", "abc"} {
+        if _, err := parseID(value); !errors.Is(err, errUsage) {
+            t.Errorf("expected usage error on ID %q, got: %v", value, err)
+        }
+    }
+    if _, err := parseTimeZone("Mars/Olympus"); err == nil {
+        t.Error("expected error on an unknown time zone")
+    }
+}
+
+func TestRunDispatch(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    database := tests.NewTestDatabase(t)
+
+    for _, args := range [][]string{
+        nil,
+        {"unknown"},
+        {"client"},
+        {"client", "rename"},
+        {"client", "add"},
+        {"expense", "add", "unexpected"},
+        {"trip", "add", "2024-04-15", "far"},
+        {"report", "abc"},
+        // Flags of another subcommand
+        {"expense", "list", "--total", "3"},
+        {"session", "close", "1", "--location", "Paris"},
+        {"type", "list", "--code", "HOT"},
+        {"trip", "list", "--session", "1"},
+        {"recurring", "run", "--schedule", "FREQ=DAILY"},
+        {"field", "list", "--options", "a,b"},
+        {"models", "diff", "orisha_g8", "--overwrite"},
+    } {
+        if _, err := runCLI(database, args...); !errors.Is(err, errUsage) {
+            t.Errorf("expected usage error on %v, got: %v", args, err)
+        }
+    }
+
+    out, err := runCLI(database, "help")
+    if err != nil || !strings.HasPrefix(out, "Usage: expenseflow") {
+        t.Errorf("expected the usage on help, got: %q (%v)", out, err)
+    }
+
+    steps := []struct {
+        args     []string
+        expected string
+    }{
+        {[]string{"client", "add", "Acme"}, "client #1 created: Acme"},
+        {[]string{"type", "add", "Hotel", "--taxes", "10"}, "expense type #1 created: Hotel"},
+        {
+            []string{"session", "start", "--client", "Acme", "--location", "Paris", "--at", "2024-04-15"},
+            "session #1 started: Paris",
+        },
+        {[]string{"trip", "add", "2024-04-15", "42km", "--session", "1"}, "car trip #1 created: 42 km @ 2024-04-15"},
+        {
+            []string{
+                "expense", "add", "--type", "Hotel", "--total", "120", "--tax", "10",
+                "--session", "1", "--date", "2024-04-15",
+            },
+            "expense #1 created: Hotel 120.00 EUR",
+        },
+        {[]string{"session", "close", "1", "--at", "2024-04-17"}, "session #1 closed"},
+    }
+    for _, step := range steps {
+        out, err := runCLI(database, step.args...)
+        if err != nil || !strings.Contains(out, step.expected) {
+            t.Errorf("expected %q from %v, got: %q (%v)", step.expected, step.args, out, err)
+        }
+    }
+
+    var listed bytes.Buffer
+    if err := run(database, []string{"expense", "list", "--session", "1"}, &listed, true); err != nil {
+        t.Fatalf("expected no error listing expenses, got: %v", err)
+    }
+    var expenses []expenseView
+    if err := json.Unmarshal(listed.Bytes(), &expenses); err != nil || len(expenses) != 1 {
+        t.Errorf("expected one expense as JSON, got: %s (%v)", listed.String(), err)
+    }
+
+    if _, err := runCLI(database, "expense", "add", "--type", "Unknown", "--total", "10"); err == nil {
+        t.Error("expected error on an unknown expense type")
+    }
+}
+
+// A receipt that can't be stored leaves no expense, and no file, behind
+func TestExpenseAddAtomic(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    database := tests.NewTestDatabase(t)
+    if _, err := runCLI(database, "type", "add", "Hotel"); err != nil {
+        t.Fatalf("failed to add expense type: %v", err)
+    }
+
+    valid := filepath.Join(tests.ReceiptsDirTest, "valid_receipt_test.png")
+    missing := filepath.Join(t.TempDir(), "missing.png")
+    _, err := runCLI(
+        database, "expense", "add", "--type", "Hotel", "--total", "80",
+        "--receipt", valid, "--receipt", missing,
+    )
+    if err == nil {
+        t.Fatal("expected error on a missing receipt file")
+    }
+    expenses, err := crud.ListExpenses(database)
+    if err != nil || len(expenses) != 0 {
+        t.Errorf("expected no expense left behind, got: %v (%v)", expenses, err)
+    }
+    lineItems, err := crud.ListLineItems(database)
+    if err != nil || len(lineItems) != 0 {
+        t.Errorf("expected no line item left behind, got: %v (%v)", lineItems, err)
+    }
+    stored, err := os.ReadDir(config.ReceiptsDir)
+    if err != nil && !os.IsNotExist(err) {
+        t.Fatalf("failed to read receipts directory: %v", err)
+    }
+    for _, entry := range stored {
+        if !entry.IsDir() {
+            t.Errorf("expected the stored receipt to be removed, found: %s", entry.Name())
+        }
+    }
+
+    out, err := runCLI(database, "expense", "add", "--type", "Hotel", "--total", "80", "--receipt", valid)
+    if err != nil || !strings.Contains(out, "expense #") {
+        t.Errorf("expected the expense to be created with its receipt, got: %q (%v)", out, err)
+    }
+}
+
+// A file given twice, or already attached, becomes one receipt
+func TestExpenseAttachTwice(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    database := tests.NewTestDatabase(t)
+    if _, err := runCLI(database, "type", "add", "Hotel"); err != nil {
+        t.Fatalf("failed to add expense type: %v", err)
+    }
+    if _, err := runCLI(database, "expense", "add", "--type", "Hotel", "--total", "80"); err != nil {
+        t.Fatalf("failed to add expense: %v", err)
+    }
+
+    valid := filepath.Join(tests.ReceiptsDirTest, "valid_receipt_test.png")
+    if _, err := runCLI(database, "expense", "attach", "1", valid, valid); err != nil {
+        t.Fatalf("expected no error attaching a file twice, got: %v", err)
+    }
+    if _, err := runCLI(database, "expense", "attach", "1", valid); err != nil {
+        t.Fatalf("expected no error attaching a file again, got: %v", err)
+    }
+    receipts, err := crud.ListReceiptsByExpenseID(database, 1)
+    if err != nil || len(receipts) != 1 {
+        t.Errorf("expected one receipt, got: %v (%v)", receipts, err)
+    }
+}
@@ -1,44 +1,97 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/craftidev/expenseflow/config"
 	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/logging"
 )
 
 
-func setupLogging() {
-    logFile, err := os.OpenFile("app.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-    if err != nil {
-        log.Fatalf("[fatal] Failed to open log file: %v", err)
-    }
-
-    log.SetOutput(logFile)
+func setupLogging() (io.Closer, error) {
+    return logging.Setup(logging.Options{
+        Path:     config.LogPath,
+        Level:    config.LogLevel,
+        Format:   config.LogFormat,
+        MaxSize:  int64(config.LogMaxSize) << 20,
+        MaxFiles: config.LogMaxFiles,
+    })
+}
 
-    log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+// Logged and printed, the log file is not where a user looks first
+func fatal(message string, err error) int {
+    slog.Error(message, "error", err)
+    fmt.Fprintf(os.Stderr, "error: %s: %v\n", strings.ToLower(message), err)
+    return 1
 }
 
 func main() {
-    setupLogging()
+    os.Exit(runMain())
+}
 
+// Separated from main so deferred calls run before os.Exit
+func runMain() int {
+    global := flag.NewFlagSet("expenseflow", flag.ContinueOnError)
+    global.SetOutput(io.Discard)
+    jsonOutput := global.Bool("json", false, "print results as JSON")
+    configFlags := config.RegisterFlags(global)
+    if err := global.Parse(os.Args[1:]); err != nil {
+        fmt.Fprintf(os.Stderr, "error: %v\n%s", err, usage)
+        return 2
+    }
+
+    settings, err := config.Load(configFlags)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "error: %v\n", err)
+        return 2
+    }
+    config.Apply(settings)
+
+    logFile, err := setupLogging()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "error: %v\n", err)
+        return 1
+    }
+    defer logFile.Close()
+
+    if err := os.MkdirAll(filepath.Dir(config.DBPath), 0755); err != nil {
+        return fatal("Failed to create database directory", err)
+    }
     database, err := db.ConnectDB(config.DBPath)
     if err != nil {
-        log.Fatalf("[fatal] Failed to connect to database: %v", err)
+        return fatal("Failed to connect to database", err)
     }
 
     defer func() {
         if err := db.CloseDB(database); err != nil {
-            log.Fatalf("[fatal] Failed to close database: %v", err)
+            fatal("Failed to close database", err)
         }
     }()
 
 
-    if err := db.InitDB(config.DBPath, database); err != nil {
-        log.Fatalf("[fatal] Failed to initialize database: %v", err)
+    if err := db.InitDB(config.DBPath, database, config.StandardModels...); err != nil {
+        return fatal("Failed to initialize database", err)
     }
 
-    // TODO: Implement CRUD
-    log.Println("[info] ExpenseFlow DB connection established")
+    slog.Info("ExpenseFlow DB connection established")
+
+    if err := run(database, global.Args(), os.Stdout, *jsonOutput); err != nil {
+        // Validation errors are translated, the others are logged as they are
+        fmt.Fprintf(os.Stderr, "error: %v\n", i18n.NewPrinter(config.Locale).Error(err))
+        if errors.Is(err, errUsage) {
+            fmt.Fprint(os.Stderr, usage)
+            return 2
+        }
+        return 1
+    }
+    return 0
 }
@@ -1,26 +1,59 @@
 package config
 
 import (
-	"path/filepath"
-	"runtime"
-)
+	"log/slog"
+	"time"
 
+	"github.com/craftidev/expenseflow/internal/i18n"
+)
 
-func getAppPath() string {
-    // Get Dir of this particular file and go up the tree
-    _, b, _, _ := runtime.Caller(0)
-    basePath := filepath.Dir(filepath.Join(filepath.Dir(b)))
-    return basePath
-}
 
+// Current values used by the rest of the app, set from Settings with Apply.
+// Defaults are the platform ones, so packages can be used without Load.
 var (
-    Path = getAppPath()
-    DBPath = filepath.Join(Path, "internal", "db", "expenseflow.db")
-    ReceiptsDir = filepath.Join(Path, "assets", "receipts")
-    ReceiptsDirTest = filepath.Join(Path, "tests", "assets", "receipts")
-    MigrationsDirPath = filepath.Join(Path, "internal", "db", "migrations")
+    DBPath      string
+    ReceiptsDir string
+    LogPath     string
+    LogLevel    slog.Level
+    LogFormat   string
+    LogMaxSize  int // MB
+    LogMaxFiles int
+    ListenAddr  string
+    Locale      string // supported one, resolved from the setting and LANG
+    TimeZone    string // IANA name, empty for UTC
+    WeekStart   time.Weekday
+    SyncServer  string
+    SyncToken   string
+    MaxFloat    float64
+    // Seed packs installed when the database is created
+    StandardModels []string
+    // Receipt images processing, see imaging.Options
+    ReceiptMaxSide int
+    ReceiptQuality int
+    ThumbnailSide  int
 )
 
-const (
-    MaxFloat = 1_000_000_000.0
-)
+func init() {
+    Apply(Default())
+}
+
+func Apply(s Settings) {
+    DBPath = s.DBPath
+    ReceiptsDir = s.ReceiptsDir
+    LogPath = s.LogPath
+    LogLevel = s.SlogLevel()
+    LogFormat = s.LogFormat
+    LogMaxSize = s.LogMaxSize
+    LogMaxFiles = s.LogMaxFiles
+    ListenAddr = s.ListenAddr
+    Locale = i18n.Resolve(s.Locale)
+    TimeZone = s.TimeZone
+    WeekStart, _ = Weekday(s.WeekStart) // Monday when empty
+    SyncServer = s.SyncServer
+    SyncToken = s.SyncToken
+    MaxFloat = s.MaxFloat
+    StandardModels = s.StandardModels
+    ReceiptMaxSide = s.ReceiptMaxSide
+    ReceiptQuality = s.ReceiptQuality
+    ThumbnailSide = s.ThumbnailSide
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+
+// Platform directories, following the XDG base directory spec on Linux/BSD,
+// "Application Support" and "Logs" on macOS, and %LocalAppData% on Windows.
+// Last resort is a dot directory in the working directory.
+
+func DefaultConfigPath() string {
+    dir, err := os.UserConfigDir() // handles XDG_CONFIG_HOME, macOS and Windows
+    if err != nil {
+        return filepath.Join("."+appName, "config.json")
+    }
+    return filepath.Join(dir, appName, "config.json")
+}
+
+func DataDir() string {
+    switch runtime.GOOS {
+    case "windows":
+        if dir := os.Getenv("LocalAppData"); dir != "" {
+            return filepath.Join(dir, appName)
+        }
+    case "darwin", "ios":
+        if home, err := os.UserHomeDir(); err == nil {
+            return filepath.Join(home, "Library", "Application Support", appName)
+        }
+    default:
+        if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+            return filepath.Join(dir, appName)
+        }
+        if home, err := os.UserHomeDir(); err == nil {
+            return filepath.Join(home, ".local", "share", appName)
+        }
+    }
+    return "." + appName
+}
+
+func LogDir() string {
+    switch runtime.GOOS {
+    case "windows":
+        if dir := os.Getenv("LocalAppData"); dir != "" {
+            return filepath.Join(dir, appName, "logs")
+        }
+    case "darwin", "ios":
+        if home, err := os.UserHomeDir(); err == nil {
+            return filepath.Join(home, "Library", "Logs", appName)
+        }
+    default:
+        if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+            return filepath.Join(dir, appName)
+        }
+        if home, err := os.UserHomeDir(); err == nil {
+            return filepath.Join(home, ".local", "state", appName)
+        }
+    }
+    return "." + appName
+}
@@ -0,0 +1,338 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // IANA zones on systems without a zoneinfo database
+
+	"github.com/craftidev/expenseflow/internal/i18n"
+)
+
+
+const appName = "expenseflow"
+
+// Settings are resolved in this order, each step overriding the previous one:
+// platform defaults < config file (JSON) < EXPENSEFLOW_* env vars < flags
+type Settings struct {
+    DBPath      string  `json:"db_path"`
+    ReceiptsDir string  `json:"receipts_dir"`
+    LogPath     string  `json:"log_path"`
+    LogLevel    string  `json:"log_level"`  // debug, info, warn or error
+    LogFormat   string  `json:"log_format"` // text or json
+    LogMaxSize  int     `json:"log_max_size"`  // MB before the log file is rotated, 0 to never rotate
+    LogMaxFiles int     `json:"log_max_files"` // rotated log files kept
+    ListenAddr  string  `json:"listen_addr"`
+    // Language of messages and reports, "en" or "fr" ("fr-FR" is fine), the
+    // environment's one (LANG) when empty
+    Locale      string  `json:"locale"`
+    // IANA zone of new expenses and sessions without --tz ("Europe/Paris"),
+    // UTC when empty
+    TimeZone    string  `json:"time_zone"`
+    WeekStart   string  `json:"week_start"` // first day of weekly reports: monday, sunday...
+    // Sync: URL of the server for a device, and the token shared by both
+    SyncServer  string  `json:"sync_server"`
+    SyncToken   string  `json:"sync_token"`
+    MaxFloat    float64 `json:"max_float"`
+    // Names from migrations/standard_models, only used on a new database
+    StandardModels []string `json:"standard_models"`
+    // Stored receipts are downscaled to this longest side in pixels, 0 to keep them
+    ReceiptMaxSide int `json:"receipt_max_side"`
+    ReceiptQuality int `json:"receipt_quality"` // JPEG quality, 1-100
+    ThumbnailSide  int `json:"thumbnail_side"`  // 0 to not generate thumbnails
+}
+
+// Hard limit on amounts and distances, see README "Hard limiting Float"
+const DefaultMaxFloat = 1_000_000_000.0
+
+func Default() Settings {
+    dataDir := DataDir()
+    return Settings{
+        DBPath:      filepath.Join(dataDir, "expenseflow.db"),
+        ReceiptsDir: filepath.Join(dataDir, "receipts"),
+        LogPath:     filepath.Join(LogDir(), "expenseflow.log"),
+        LogLevel:    "info",
+        LogFormat:   "text",
+        LogMaxSize:  10,
+        LogMaxFiles: 5,
+        ListenAddr:  "127.0.0.1:8080",
+        WeekStart:   "monday",
+        MaxFloat:    DefaultMaxFloat,
+        ReceiptMaxSide: 2000, // still readable for OCR, around 500 KB
+        ReceiptQuality: 85,
+        ThumbnailSide:  256,
+    }
+}
+
+func (s Settings) Valid() error {
+    switch {
+    case s.DBPath == "" || s.ReceiptsDir == "" || s.LogPath == "":
+        return errors.New("db path, receipts dir and log path cannot be empty")
+    case s.SlogLevel().String() != strings.ToUpper(s.LogLevel):
+        return fmt.Errorf("log level must be debug, info, warn or error, got: %q", s.LogLevel)
+    case s.LogFormat != "text" && s.LogFormat != "json":
+        return fmt.Errorf("log format must be text or json, got: %q", s.LogFormat)
+    case s.LogMaxSize < 0 || s.LogMaxFiles < 0:
+        return errors.New("log max size and max files can't be negative")
+    case s.ListenAddr == "":
+        return errors.New("listen address cannot be empty")
+    case s.Locale != "" && i18n.Match(s.Locale) == "":
+        return fmt.Errorf(
+            "locale must be one of %s, got: %q", strings.Join(i18n.Supported, ", "), s.Locale,
+        )
+    case s.TimeZone != "" && !validTimeZone(s.TimeZone):
+        return fmt.Errorf("time zone must be an IANA name (Europe/Paris), got: %q", s.TimeZone)
+    case s.WeekStart != "" && !validWeekday(s.WeekStart):
+        return fmt.Errorf("week start must be a day name (monday, sunday...), got: %q", s.WeekStart)
+    case s.MaxFloat <= 0 || s.MaxFloat > math.MaxFloat64/2 || math.IsNaN(s.MaxFloat):
+        return fmt.Errorf("max float must be positive and realistic, got: %v", s.MaxFloat)
+    case s.ReceiptMaxSide < 0 || s.ThumbnailSide < 0:
+        return errors.New("receipt max side and thumbnail side can't be negative")
+    case s.ReceiptQuality < 1 || s.ReceiptQuality > 100:
+        return fmt.Errorf("receipt quality must be between 1 and 100, got: %d", s.ReceiptQuality)
+    default:
+        return nil
+    }
+}
+
+// Lowest level of the records logged, info when LogLevel is invalid
+func (s Settings) SlogLevel() slog.Level {
+    var level slog.Level
+    if err := level.UnmarshalText([]byte(s.LogLevel)); err != nil {
+        return slog.LevelInfo
+    }
+    return level
+}
+
+// Command line overrides, registered on the caller's FlagSet so they can live
+// next to its own flags
+type Flags struct {
+    fs             *flag.FlagSet
+    configPath     *string
+    dbPath         *string
+    receiptsDir    *string
+    logPath        *string
+    logLevel       *string
+    logFormat      *string
+    logMaxSize     *int
+    logMaxFiles    *int
+    listenAddr     *string
+    locale         *string
+    timeZone       *string
+    weekStart      *string
+    syncServer     *string
+    syncToken      *string
+    maxFloat       *float64
+    standardModels *string
+    receiptMaxSide *int
+    receiptQuality *int
+    thumbnailSide  *int
+}
+
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+    return &Flags{
+        fs:             fs,
+        configPath:     fs.String("config", "", "config file (default: "+DefaultConfigPath()+")"),
+        dbPath:         fs.String("db", "", "database file"),
+        receiptsDir:    fs.String("receipts-dir", "", "receipts directory"),
+        logPath:        fs.String("log", "", "log file"),
+        logLevel:       fs.String("log-level", "", "lowest level logged: debug, info, warn or error"),
+        logFormat:      fs.String("log-format", "", "log records as text or json"),
+        logMaxSize:     fs.Int("log-max-size", 0, "MB before the log file is rotated"),
+        logMaxFiles:    fs.Int("log-max-files", 0, "rotated log files kept"),
+        listenAddr:     fs.String("listen", "", "API listen address"),
+        locale:         fs.String("locale", "", "language of messages and reports: "+strings.Join(i18n.Supported, ", ")),
+        timeZone:       fs.String("time-zone", "", "IANA time zone of new expenses and sessions"),
+        weekStart:      fs.String("week-start", "", "first day of weekly reports: monday, sunday..."),
+        syncServer:     fs.String("sync-server", "", "URL of the sync server"),
+        syncToken:      fs.String("sync-token", "", "token of the sync API"),
+        maxFloat:       fs.Float64("max-float", 0, "hard limit on amounts and distances"),
+        standardModels: fs.String("models", "", "comma separated standard models to seed a new database with"),
+        receiptMaxSide: fs.Int("receipt-max-side", 0, "longest side in pixels of stored receipts"),
+        receiptQuality: fs.Int("receipt-quality", 0, "JPEG quality of stored receipts"),
+        thumbnailSide:  fs.Int("thumbnail-side", 0, "longest side in pixels of receipt thumbnails"),
+    }
+}
+
+// flags can be nil when there is no command line to read
+func Load(flags *Flags) (Settings, error) {
+    settings := Default()
+
+    configPath, explicit := DefaultConfigPath(), false
+    if path, ok := os.LookupEnv("EXPENSEFLOW_CONFIG"); ok {
+        configPath, explicit = path, true
+    }
+    if flags != nil && flags.isSet("config") {
+        configPath, explicit = *flags.configPath, true
+    }
+    if err := loadFile(&settings, configPath, explicit); err != nil {
+        return settings, err
+    }
+
+    if err := loadEnv(&settings); err != nil {
+        return settings, err
+    }
+
+    if flags != nil {
+        flags.fs.Visit(func(f *flag.Flag) {
+            switch f.Name {
+            case "db":
+                settings.DBPath = *flags.dbPath
+            case "receipts-dir":
+                settings.ReceiptsDir = *flags.receiptsDir
+            case "log":
+                settings.LogPath = *flags.logPath
+            case "log-level":
+                settings.LogLevel = *flags.logLevel
+            case "log-format":
+                settings.LogFormat = *flags.logFormat
+            case "log-max-size":
+                settings.LogMaxSize = *flags.logMaxSize
+            case "log-max-files":
+                settings.LogMaxFiles = *flags.logMaxFiles
+            case "listen":
+                settings.ListenAddr = *flags.listenAddr
+            case "locale":
+                settings.Locale = *flags.locale
+            case "time-zone":
+                settings.TimeZone = *flags.timeZone
+            case "week-start":
+                settings.WeekStart = *flags.weekStart
+            case "sync-server":
+                settings.SyncServer = *flags.syncServer
+            case "sync-token":
+                settings.SyncToken = *flags.syncToken
+            case "max-float":
+                settings.MaxFloat = *flags.maxFloat
+            case "models":
+                settings.StandardModels = splitList(*flags.standardModels)
+            case "receipt-max-side":
+                settings.ReceiptMaxSide = *flags.receiptMaxSide
+            case "receipt-quality":
+                settings.ReceiptQuality = *flags.receiptQuality
+            case "thumbnail-side":
+                settings.ThumbnailSide = *flags.thumbnailSide
+            }
+        })
+    }
+
+    return settings, settings.Valid()
+}
+
+func (f *Flags) isSet(name string) bool {
+    set := false
+    f.fs.Visit(func(fl *flag.Flag) {
+        if fl.Name == name {
+            set = true
+        }
+    })
+    return set
+}
+
+// A missing file is fine unless it was explicitly asked for
+func loadFile(settings *Settings, path string, explicit bool) error {
+    content, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) && !explicit {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to read config file: %w", err)
+    }
+    if err := json.Unmarshal(content, settings); err != nil {
+        return fmt.Errorf("invalid config file %s: %w", path, err)
+    }
+    return nil
+}
+
+func loadEnv(settings *Settings) error {
+    stringSettings := map[string]*string{
+        "EXPENSEFLOW_DB_PATH":        &settings.DBPath,
+        "EXPENSEFLOW_RECEIPTS_DIR":   &settings.ReceiptsDir,
+        "EXPENSEFLOW_LOG_PATH":       &settings.LogPath,
+        "EXPENSEFLOW_LOG_LEVEL":      &settings.LogLevel,
+        "EXPENSEFLOW_LOG_FORMAT":     &settings.LogFormat,
+        "EXPENSEFLOW_LISTEN_ADDR":    &settings.ListenAddr,
+        "EXPENSEFLOW_LOCALE":         &settings.Locale,
+        "EXPENSEFLOW_TIME_ZONE":      &settings.TimeZone,
+        "EXPENSEFLOW_WEEK_START":     &settings.WeekStart,
+        "EXPENSEFLOW_SYNC_SERVER":    &settings.SyncServer,
+        "EXPENSEFLOW_SYNC_TOKEN":     &settings.SyncToken,
+    }
+    for name, target := range stringSettings {
+        if value, ok := os.LookupEnv(name); ok {
+            *target = value
+        }
+    }
+
+    if value, ok := os.LookupEnv("EXPENSEFLOW_STANDARD_MODELS"); ok {
+        settings.StandardModels = splitList(value)
+    }
+
+    if value, ok := os.LookupEnv("EXPENSEFLOW_MAX_FLOAT"); ok {
+        maxFloat, err := strconv.ParseFloat(value, 64)
+        if err != nil {
+            return fmt.Errorf("invalid EXPENSEFLOW_MAX_FLOAT: %w", err)
+        }
+        settings.MaxFloat = maxFloat
+    }
+
+    intSettings := map[string]*int{
+        "EXPENSEFLOW_RECEIPT_MAX_SIDE": &settings.ReceiptMaxSide,
+        "EXPENSEFLOW_RECEIPT_QUALITY":  &settings.ReceiptQuality,
+        "EXPENSEFLOW_THUMBNAIL_SIDE":   &settings.ThumbnailSide,
+        "EXPENSEFLOW_LOG_MAX_SIZE":     &settings.LogMaxSize,
+        "EXPENSEFLOW_LOG_MAX_FILES":    &settings.LogMaxFiles,
+    }
+    for name, target := range intSettings {
+        if value, ok := os.LookupEnv(name); ok {
+            number, err := strconv.Atoi(value)
+            if err != nil {
+                return fmt.Errorf("invalid %s: %w", name, err)
+            }
+            *target = number
+        }
+    }
+    return nil
+}
+
+func splitList(value string) []string {
+    var list []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            list = append(list, item)
+        }
+    }
+    return list
+}
+
+// "Local" is the zone of the machine, not a place
+func validTimeZone(name string) bool {
+    if name == "Local" {
+        return false
+    }
+    _, err := time.LoadLocation(name)
+    return err == nil
+}
+
+func validWeekday(name string) bool {
+    _, ok := Weekday(name)
+    return ok
+}
+
+// Weekday of an English day name, any case ("Monday", "sunday")
+func Weekday(name string) (time.Weekday, bool) {
+    for day := time.Sunday; day <= time.Saturday; day++ {
+        if strings.EqualFold(day.String(), name) {
+            return day, true
+        }
+    }
+    return time.Monday, false
+}
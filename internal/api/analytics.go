@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Dashboard of the expenses (see services.SpendBy...), from and to are local
+// dates (yyyy-mm-dd), both included and optional:
+//   GET /analytics/spend?by=type|client|month|currency&from=&to=
+//   GET /analytics/distance?from=&to=              km driven per month
+//   GET /analytics/hotels?from=&to=&type=NAME...   average night per city
+//   GET /analytics/merchants?from=&to=&limit=10    top merchants
+//   GET /analytics/year-over-year?year=2024        this year by default
+
+func analyticsRange(r *http.Request) services.AnalyticsRange {
+    query := r.URL.Query()
+    return services.AnalyticsRange{From: query.Get("from"), To: query.Get("to")}
+}
+
+func (s *Server) spend(w http.ResponseWriter, r *http.Request) {
+    by := r.URL.Query().Get("by")
+    if by == "" {
+        by = services.SpendByType
+    }
+    analytics, err := services.SpendBy(s.database, by, analyticsRange(r))
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, analytics)
+}
+
+func (s *Server) distance(w http.ResponseWriter, r *http.Request) {
+    analytics, err := services.DistanceByMonth(s.database, analyticsRange(r))
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, analytics)
+}
+
+func (s *Server) hotels(w http.ResponseWriter, r *http.Request) {
+    analytics, err := services.HotelPrices(s.database, analyticsRange(r), r.URL.Query()["type"]...)
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, analytics)
+}
+
+func (s *Server) merchants(w http.ResponseWriter, r *http.Request) {
+    v := utils.Validator{}
+    limit, err := queryInt(r, "limit", services.DefaultTopMerchants)
+    v.Format("limit", err == nil, "an integer")
+    if err == nil {
+        v.Range("limit", float64(limit), 1, maxPageSize)
+    }
+    if err := v.Err(); err != nil {
+        writeError(w, r, err)
+        return
+    }
+    analytics, err := services.TopMerchants(s.database, analyticsRange(r), limit)
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, analytics)
+}
+
+func (s *Server) yearOverYear(w http.ResponseWriter, r *http.Request) {
+    v := utils.Validator{}
+    year, err := queryInt(r, "year", time.Now().Year())
+    v.Format("year", err == nil, "an integer")
+    if err := v.Err(); err != nil {
+        writeError(w, r, err)
+        return
+    }
+    comparison, err := services.YearOverYear(s.database, year)
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, comparison)
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Device side of the sync API, a services.SyncTransport. Receipt files of the
+// pushed changes are uploaded first when the server lacks them, the ones of
+// pulled changes are downloaded to config.ReceiptsDir.
+type Client struct {
+    BaseURL  string
+    Token    string
+    DeviceID string
+    HTTP     *http.Client
+}
+
+func NewClient(baseURL string, token string, deviceID string) (*Client, error) {
+    parsed, err := url.Parse(baseURL)
+    if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+        return nil, utils.LogError("invalid sync server URL: %q", baseURL)
+    }
+    if token == "" {
+        return nil, utils.LogError("a sync token is required")
+    }
+    return &Client{
+        BaseURL:  strings.TrimSuffix(baseURL, "/"),
+        Token:    token,
+        DeviceID: deviceID,
+        HTTP:     &http.Client{Timeout: 2 * time.Minute},
+    }, nil
+}
+
+func (c *Client) Push(changes []services.SyncChange) (*services.SyncResult, error) {
+    for _, relPath := range receiptNames(changes) {
+        if err := c.uploadReceipt(relPath); err != nil {
+            return nil, err
+        }
+    }
+
+    body, err := json.Marshal(PushRequest{DeviceID: c.DeviceID, Changes: changes})
+    if err != nil {
+        return nil, utils.LogError("failed to encode changes: %v", err)
+    }
+    var result services.SyncResult
+    if err := c.doJSON(http.MethodPost, "/sync", bytes.NewReader(body), &result); err != nil {
+        return nil, err
+    }
+    return &result, nil
+}
+
+func (c *Client) Pull(since int64, limit int) (*services.SyncChangeSet, error) {
+    query := url.Values{}
+    query.Set("since", strconv.FormatInt(since, 10))
+    query.Set("limit", strconv.Itoa(limit))
+    var set services.SyncChangeSet
+    if err := c.doJSON(http.MethodGet, "/sync?"+query.Encode(), nil, &set); err != nil {
+        return nil, err
+    }
+    for _, relPath := range receiptNames(set.Changes) {
+        if err := c.downloadReceipt(relPath); err != nil {
+            return nil, err
+        }
+    }
+    return &set, nil
+}
+
+func (c *Client) uploadReceipt(relPath string) error {
+    response, err := c.do(http.MethodHead, "/sync/receipts/"+relPath, nil)
+    if err != nil {
+        return err
+    }
+    response.Body.Close()
+    if response.StatusCode == http.StatusOK {
+        return nil
+    }
+
+    file, err := os.Open(filepath.Join(config.ReceiptsDir, relPath))
+    if errors.Is(err, os.ErrNotExist) {
+        return nil // lost here, the row still syncs
+    }
+    if err != nil {
+        return utils.LogError("failed to open receipt %s: %v", relPath, err)
+    }
+    defer file.Close()
+    response, err = c.do(http.MethodPut, "/sync/receipts/"+relPath, file)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    return checkResponse(response)
+}
+
+func (c *Client) downloadReceipt(relPath string) error {
+    path := filepath.Join(config.ReceiptsDir, relPath)
+    if _, err := os.Stat(path); err == nil {
+        return nil
+    }
+    response, err := c.do(http.MethodGet, "/sync/receipts/"+relPath, nil)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    if response.StatusCode == http.StatusNotFound {
+        return nil // never uploaded, the row still syncs
+    }
+    if err := checkResponse(response); err != nil {
+        return err
+    }
+
+    if err := os.MkdirAll(config.ReceiptsDir, 0755); err != nil {
+        return utils.LogError("failed to create receipts directory: %v", err)
+    }
+    temp, err := os.CreateTemp(config.ReceiptsDir, ".download-*")
+    if err != nil {
+        return utils.LogError("failed to download receipt %s: %v", relPath, err)
+    }
+    defer os.Remove(temp.Name())
+    _, err = io.Copy(temp, response.Body)
+    if errClose := temp.Close(); err == nil {
+        err = errClose
+    }
+    if err == nil {
+        err = os.Rename(temp.Name(), path)
+    }
+    if err != nil {
+        return utils.LogError("failed to download receipt %s: %v", relPath, err)
+    }
+    return db.GenerateReceiptPreviews(relPath)
+}
+
+func (c *Client) doJSON(method string, path string, body io.Reader, result any) error {
+    response, err := c.do(method, path, body)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    if err := checkResponse(response); err != nil {
+        return err
+    }
+    if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+        return utils.LogError("invalid response of %s %s: %v", method, path, err)
+    }
+    return nil
+}
+
+func (c *Client) do(method string, path string, body io.Reader) (*http.Response, error) {
+    request, err := http.NewRequest(method, c.BaseURL+path, body)
+    if err != nil {
+        return nil, utils.LogError("invalid request %s %s: %v", method, path, err)
+    }
+    request.Header.Set("Authorization", "Bearer "+c.Token)
+    request.Header.Set("Accept-Language", config.Locale)
+    if method == http.MethodPost {
+        request.Header.Set("Content-Type", "application/json")
+    }
+    response, err := c.HTTP.Do(request)
+    if err != nil {
+        return nil, utils.LogError("sync server unreachable: %v", err)
+    }
+    return response, nil
+}
+
+func checkResponse(response *http.Response) error {
+    if response.StatusCode < 300 {
+        return nil
+    }
+    var failure errorResponse
+    if err := json.NewDecoder(response.Body).Decode(&failure); err != nil || failure.Error == "" {
+        failure.Error = response.Status
+    }
+    err := utils.WrapError(
+        utils.CodeKind(failure.Code), nil,
+        "sync server refused %s %s: %s",
+        response.Request.Method, response.Request.URL.Path, failure.Error,
+    )
+    var typed *utils.Error
+    if errors.As(err, &typed) {
+        typed.Violations = failure.Violations
+    }
+    return err
+}
+
+func receiptNames(changes []services.SyncChange) []string {
+    var names []string
+    for _, change := range changes {
+        if change.Table != "receipts" || change.Deleted {
+            continue
+        }
+        relPath, _ := change.Values["rel_path"].(string)
+        if !db.IsReceiptName(relPath) {
+            // Renamed by migration 016 when its file was there
+            slog.Warn("receipt file not synced, not named after its content", "rel_path", relPath)
+            continue
+        }
+        names = append(names, relPath)
+    }
+    return names
+}
+
+// Sync the database with the server at baseURL
+func Sync(database *sql.DB, baseURL string, token string) (*services.SyncReport, error) {
+    status, err := services.GetSyncStatus(database)
+    if err != nil {
+        return nil, err
+    }
+    client, err := NewClient(baseURL, token, status.DeviceID)
+    if err != nil {
+        return nil, err
+    }
+    return services.Sync(database, client)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Errors are answered with the status of their kind and a stable code (see
+// utils.ErrorCode), the message of an internal error is not sent. A validation
+// error lists its violations (see utils.Violation):
+//   {"error": "...", "code": "validation_failed", "fields": ["limit"],
+//    "violations": [{"field": "limit", "code": "out_of_range", "params": {...}, "message": "..."}]}
+// Messages are in the language of the Accept-Language header (config.Locale
+// by default), codes and fields are the same in every language.
+
+const codeUnauthorized = "unauthorized"
+
+// In order of precedence, for an error wrapping several kinds
+var kindStatuses = []struct {
+    kind   error
+    status int
+}{
+    {utils.ErrIntegrity, http.StatusInternalServerError},
+    {utils.ErrNotFound, http.StatusNotFound},
+    {utils.ErrValidation, http.StatusBadRequest},
+    {utils.ErrConflict, http.StatusConflict},
+    {utils.ErrReferenced, http.StatusConflict},
+}
+
+type errorResponse struct {
+    Error      string            `json:"error"`
+    Code       string            `json:"code"`
+    Fields     []string          `json:"fields,omitempty"`
+    Violations []utils.Violation `json:"violations,omitempty"`
+}
+
+// HTTP status of err's kind, 500 for an internal error
+func HTTPStatus(err error) int {
+    for _, ks := range kindStatuses {
+        if errors.Is(err, ks.kind) {
+            return ks.status
+        }
+    }
+    return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+    printer := requestPrinter(r)
+    response := errorResponse{
+        Error:  printer.Error(err),
+        Code:   utils.ErrorCode(err),
+        Fields: utils.ErrorFields(err),
+    }
+    for _, violation := range utils.ErrorViolations(err) {
+        violation.Message = printer.Violation(violation)
+        response.Violations = append(response.Violations, violation)
+    }
+    if response.Code == utils.CodeInternal {
+        response.Error = "internal error"
+    }
+    w.Header().Set("Content-Language", printer.Locale())
+    writeJSON(w, HTTPStatus(err), response)
+}
+
+func requestPrinter(r *http.Request) *i18n.Printer {
+    return i18n.NewPrinter(i18n.Negotiate(r.Header.Get("Accept-Language"), config.Locale))
+}
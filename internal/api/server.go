@@ -0,0 +1,230 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Sync server of the devices (see services.Sync):
+//   GET  /sync?since=CURSOR&limit=N     changes after the cursor (services.SyncChangeSet)
+//   POST /sync                          push changes ({"device_id", "changes"}), returns services.SyncResult
+//   HEAD|GET|PUT /sync/receipts/NAME    receipt files, by their stored name
+//   GET  /analytics/...                 dashboard of the expenses, see analytics.go
+// Every request needs the "Authorization: Bearer TOKEN" header.
+
+const (
+    maxPushSize    = 32 << 20
+    maxReceiptSize = 32 << 20
+    maxPageSize    = 5000
+)
+
+type PushRequest struct {
+    DeviceID string                `json:"device_id"`
+    Changes  []services.SyncChange `json:"changes"`
+}
+
+type Server struct {
+    database    *sql.DB
+    token       string
+    receiptsDir string
+    mu          sync.Mutex // one push at a time, conflicts are resolved in order
+}
+
+// Receipt files go to receiptsDir, usually config.ReceiptsDir
+func NewServer(database *sql.DB, token string, receiptsDir string) (*Server, error) {
+    if token == "" {
+        return nil, errors.New("a sync token is required to serve the API")
+    }
+    return &Server{database: database, token: token, receiptsDir: receiptsDir}, nil
+}
+
+func (s *Server) Handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /sync", s.pull)
+    mux.HandleFunc("POST /sync", s.push)
+    mux.HandleFunc("GET /sync/receipts/{name}", s.getReceipt) // HEAD too
+    mux.HandleFunc("PUT /sync/receipts/{name}", s.putReceipt)
+    mux.HandleFunc("GET /analytics/spend", s.spend)
+    mux.HandleFunc("GET /analytics/distance", s.distance)
+    mux.HandleFunc("GET /analytics/hotels", s.hotels)
+    mux.HandleFunc("GET /analytics/merchants", s.merchants)
+    mux.HandleFunc("GET /analytics/year-over-year", s.yearOverYear)
+    return s.authenticate(mux)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+        if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+            slog.Warn(
+                "unauthorized API request",
+                "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr,
+            )
+            writeJSON(w, http.StatusUnauthorized, errorResponse{
+                Error: "invalid or missing token", Code: codeUnauthorized,
+            })
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+func (s *Server) pull(w http.ResponseWriter, r *http.Request) {
+    v := utils.Validator{}
+    since, err := queryInt(r, "since", 0)
+    v.Format("since", err == nil, "an integer")
+    v.Check(
+        since >= 0, "since", utils.ViolationRange, map[string]any{"min": 0},
+        "since can't be negative",
+    )
+    limit, err := queryInt(r, "limit", services.DefaultSyncPageSize)
+    v.Format("limit", err == nil, "an integer")
+    if err == nil {
+        v.Range("limit", float64(limit), 1, maxPageSize)
+    }
+    if err := v.Err(); err != nil {
+        writeError(w, r, err)
+        return
+    }
+
+    s.mu.Lock()
+    set, err := services.ListSyncChanges(s.database, int64(since), limit)
+    s.mu.Unlock()
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, set)
+}
+
+func (s *Server) push(w http.ResponseWriter, r *http.Request) {
+    var request PushRequest
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushSize)).Decode(&request); err != nil {
+        writeError(w, r, utils.ValidationError(nil, "invalid push: %v", err))
+        return
+    }
+    if err := services.ValidateSyncChanges(request.Changes); err != nil {
+        writeError(w, r, err)
+        return
+    }
+
+    s.mu.Lock()
+    result, err := services.ApplySyncChanges(s.database, request.Changes, services.SyncOptions{})
+    s.mu.Unlock()
+    if err != nil {
+        writeError(w, r, err)
+        return
+    }
+    slog.Info(
+        "push received",
+        "device_id", request.DeviceID, "changes", len(request.Changes), "applied", result.Applied,
+    )
+    writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) getReceipt(w http.ResponseWriter, r *http.Request) {
+    path, ok := s.receiptPath(w, r)
+    if !ok {
+        return
+    }
+    if _, err := os.Stat(path); err != nil {
+        writeError(w, r, utils.NotFoundError("receipt not found: %s", filepath.Base(path)))
+        return
+    }
+    http.ServeFile(w, r, path)
+}
+
+// Receipts are named after their content (see db.ReceiptName), one already
+// there is kept and one not matching its name refused
+func (s *Server) putReceipt(w http.ResponseWriter, r *http.Request) {
+    path, ok := s.receiptPath(w, r)
+    if !ok {
+        return
+    }
+    if _, err := os.Stat(path); err == nil {
+        w.WriteHeader(http.StatusNoContent)
+        return
+    }
+    data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxReceiptSize))
+    if err != nil {
+        writeError(w, r, utils.ValidationError(nil, "failed to read receipt: %v", err))
+        return
+    }
+    name := filepath.Base(path)
+    if db.ReceiptName(data, filepath.Ext(name)) != name {
+        writeError(w, r, utils.ValidationError(
+            []string{"name"}, "receipt content doesn't match its name: %s", name,
+        ))
+        return
+    }
+    if err := os.MkdirAll(s.receiptsDir, 0755); err != nil {
+        writeError(w, r, utils.LogError("failed to store receipt: %v", err))
+        return
+    }
+
+    temp, err := os.CreateTemp(s.receiptsDir, ".upload-*")
+    if err != nil {
+        writeError(w, r, utils.LogError("failed to store receipt: %v", err))
+        return
+    }
+    defer os.Remove(temp.Name())
+    _, err = temp.Write(data)
+    if errClose := temp.Close(); err == nil {
+        err = errClose
+    }
+    if err != nil {
+        writeError(w, r, utils.LogError("failed to store receipt: %v", err))
+        return
+    }
+    if _, err := db.ReceiptContentType(temp.Name()); err != nil {
+        writeError(w, r, err)
+        return
+    }
+    if err := os.Rename(temp.Name(), path); err != nil {
+        writeError(w, r, utils.LogError("failed to store receipt: %v", err))
+        return
+    }
+    slog.Info("receipt received", "receipt", name)
+    w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) receiptPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+    name := r.PathValue("name")
+    if !db.IsReceiptName(name) {
+        writeError(w, r, utils.ValidationError([]string{"name"}, "invalid receipt name: %q", name))
+        return "", false
+    }
+    return filepath.Join(s.receiptsDir, name), true
+}
+
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+    value := r.URL.Query().Get(name)
+    if value == "" {
+        return fallback, nil
+    }
+    return strconv.Atoi(value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if err := json.NewEncoder(w).Encode(value); err != nil {
+        slog.Warn("failed to write API response", "error", err)
+    }
+}
+
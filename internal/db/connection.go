@@ -0,0 +1,44 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+
+// sqlite3 set up by setupConnection on every connection of the pool
+const driverName = "sqlite3_expenseflow"
+
+// Foreign keys are enforced, a deleted row still referenced fails with
+// utils.ErrReferenced (see ConstraintKind). WAL lets the API read while the
+// CLI writes, busy_timeout waits for a lock instead of failing at once, and
+// synchronous NORMAL is safe with WAL. An in-memory database stays in memory.
+const connectionPragmas = `PRAGMA foreign_keys = ON;
+PRAGMA busy_timeout = 5000;
+PRAGMA journal_mode = WAL;
+PRAGMA synchronous = NORMAL;`
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{ConnectHook: setupConnection})
+}
+
+func setupConnection(conn *sqlite3.SQLiteConn) error {
+	if _, err := conn.Exec(connectionPragmas, nil); err != nil {
+		return err
+	}
+	return conn.RegisterFunc("local_date", localDate, true)
+}
+
+// local_date(date_time, time_zone): yyyy-mm-dd where it happened, the one of
+// Expense.LocalDate, so queries can group by local day or month. NULL for a
+// timestamp that doesn't parse.
+func localDate(value string, timeZone any) any {
+	t, err := ParseTimestamp(value)
+	if err != nil {
+		return nil
+	}
+	name, _ := timeZone.(string)
+	return InTimeZone(t, sql.NullString{String: name, Valid: name != ""}).Format(time.DateOnly)
+}
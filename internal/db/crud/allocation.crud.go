@@ -0,0 +1,163 @@
+package crud
+
+import (
+	"log/slog"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+const allocationColumns = "id, public_id, expense_id, session_id, percentage, amount"
+
+// Replace the allocations of an expense, which loses its session when some
+// are given. An empty list removes them. Shares are not checked against the
+// expense total here, see services.AllocateExpense.
+func SetExpenseAllocations(
+    database db.Querier, expenseID int64, allocations db.AllocationList,
+) error {
+	if expenseID <= 0 {
+		return utils.InvalidIDError("expense_id", "expense ID must be positive and non-zero")
+	}
+	for i := range allocations {
+		allocations[i].ExpenseID = expenseID
+		if err := allocations[i].PreInsertValid(); err != nil {
+			return err
+		}
+	}
+
+	err := db.InTx(database, func(tx db.Querier) error {
+		if _, err := tx.Exec("DELETE FROM expense_allocations WHERE expense_id = ?", expenseID); err != nil {
+			return utils.WrapError(
+				db.ConstraintKind(err), err,
+				"unable to delete allocations of expense (ID: %v), error: %v", expenseID, err,
+			)
+		}
+		if len(allocations) > 0 {
+			if _, err := tx.Exec("UPDATE expenses SET session_id = NULL WHERE id = ?", expenseID); err != nil {
+				return utils.WrapError(
+					db.WriteConstraintKind(err), err,
+					"unable to unset session of expense (ID: %v), error: %v", expenseID, err,
+				)
+			}
+		}
+
+		sqlQuery := `INSERT INTO expense_allocations(
+                        expense_id,
+                        session_id,
+                        percentage,
+                        amount
+                    ) VALUES (?, ?, ?, ?)`
+		stmt, err := tx.Prepare(sqlQuery)
+		if err != nil {
+			return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+		}
+		defer stmt.Close()
+
+		for _, allocation := range allocations {
+			_, err := stmt.Exec(
+				allocation.ExpenseID, allocation.SessionID, allocation.Percentage, allocation.Amount,
+			)
+			if err != nil {
+				return utils.WrapError(
+					db.WriteConstraintKind(err), err,
+					"unable to create allocation: %v, error: %v", allocation, err,
+				)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("expense allocated", "expense_id", expenseID, "sessions", len(allocations))
+	return nil
+}
+
+func ListAllocations(database db.Querier) (db.AllocationList, error) {
+	return queryAllocations(
+		database, "SELECT " + allocationColumns + " FROM expense_allocations ORDER BY id",
+	)
+}
+
+func ListAllocationsByExpenseID(database db.Querier, expenseID int64) (db.AllocationList, error) {
+	return queryAllocations(
+		database,
+		"SELECT " + allocationColumns + " FROM expense_allocations WHERE expense_id = ? ORDER BY id",
+		expenseID,
+	)
+}
+
+// Allocations of several expenses at once, by expense then ID
+func ListAllocationsByExpenseIDs(database db.Querier, expenseIDs []int64) (
+    db.AllocationList, error,
+) {
+	if len(expenseIDs) == 0 {
+		return make(db.AllocationList, 0), nil
+	}
+	return queryAllocations(
+		database,
+		"SELECT " + allocationColumns + " FROM expense_allocations WHERE expense_id IN (" +
+			idPlaceholders(expenseIDs) + ") ORDER BY expense_id, id",
+		idArgs(expenseIDs)...,
+	)
+}
+
+func ListAllocationsBySessionID(database db.Querier, sessionID int64) (db.AllocationList, error) {
+	return queryAllocations(
+		database,
+		"SELECT " + allocationColumns + " FROM expense_allocations WHERE session_id = ? ORDER BY id",
+		sessionID,
+	)
+}
+
+func GetAllocationByPublicID(database db.Querier, publicID string) (*db.Allocation, error) {
+	if err := db.ValidPublicID(publicID); err != nil {
+		return nil, err
+	}
+	allocations, err := queryAllocations(
+		database,
+		"SELECT " + allocationColumns + " FROM expense_allocations WHERE public_id = ?",
+		publicID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(allocations) == 0 {
+		return nil, utils.NotFoundError("allocation not found (public ID: %v)", publicID)
+	}
+	return &allocations[0], nil
+}
+
+func queryAllocations(database db.Querier, sqlQuery string, args ...any) (db.AllocationList, error) {
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	allocations := make(db.AllocationList, 0)
+	for rows.Next() {
+		var allocation db.Allocation
+		err := rows.Scan(
+            &allocation.ID,
+            &allocation.PublicID,
+            &allocation.ExpenseID,
+            &allocation.SessionID,
+            &allocation.Percentage,
+            &allocation.Amount,
+        )
+		if err != nil {
+			return nil, utils.LogError("failed to scan allocation: %v", err)
+		}
+		if err := allocation.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		allocations = append(allocations, allocation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list allocations: %v", err)
+	}
+	return allocations, nil
+}
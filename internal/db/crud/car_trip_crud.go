@@ -2,13 +2,14 @@ package crud
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/craftidev/expenseflow/internal/db"
 	"github.com/craftidev/expenseflow/internal/utils"
 )
 
-func CreateCarTrip(database *sql.DB, carTrip db.CarTrip) (int64, error) {
+func CreateCarTrip(database db.Querier, carTrip db.CarTrip) (int64, error) {
 	if err := carTrip.PreInsertValid(); err != nil {
 		return 0, err
 	}
@@ -17,7 +18,7 @@ func CreateCarTrip(database *sql.DB, carTrip db.CarTrip) (int64, error) {
 		return 0, err
 	}
 	if !ok {
-		return 0, utils.LogError(
+		return 0, utils.ConflictError(
 			"car trip at this date already exists: %s", carTrip.DateOnly,
 		)
 	}
@@ -41,7 +42,8 @@ func CreateCarTrip(database *sql.DB, carTrip db.CarTrip) (int64, error) {
         carTrip.DateOnly,
     )
 	if err != nil {
-		return 0, utils.LogError(
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
 			"unable to create car trip: %v, error: %v",
 			carTrip, err,
 		)
@@ -55,13 +57,14 @@ func CreateCarTrip(database *sql.DB, carTrip db.CarTrip) (int64, error) {
 		)
 	}
 
-	log.Printf("[info] new car trip (ID: %v) created", id)
+	slog.Info("new car trip created", "id", id)
 	return id, nil
 }
 
-func GetCarTripByID(database *sql.DB, id int64) (*db.CarTrip, error) {
+func GetCarTripByID(database db.Querier, id int64) (*db.CarTrip, error) {
 	sqlQuery := `SELECT
                     id,
+                    public_id,
                     session_id,
                     distance_km,
                     date_only
@@ -77,13 +80,14 @@ func GetCarTripByID(database *sql.DB, id int64) (*db.CarTrip, error) {
 	var carTrip db.CarTrip
 	err = stmt.QueryRow(id).Scan(
         &carTrip.ID,
+        &carTrip.PublicID,
         &carTrip.SessionID,
         &carTrip.DistanceKM,
         &carTrip.DateOnly,
     )
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, utils.LogError("car trip not found (ID: %d)", id)
+			return nil, utils.NotFoundError("car trip not found (ID: %d)", id)
 		}
 		return nil, utils.LogError("failed to fetch car trip by ID: %v", err)
 	}
@@ -94,7 +98,15 @@ func GetCarTripByID(database *sql.DB, id int64) (*db.CarTrip, error) {
 	return &carTrip, nil
 }
 
-func UpdateCarTrip(database *sql.DB, carTrip db.CarTrip) error {
+func GetCarTripByPublicID(database db.Querier, publicID string) (*db.CarTrip, error) {
+	id, err := idByPublicID(database, "car_trips", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetCarTripByID(database, id)
+}
+
+func UpdateCarTrip(database db.Querier, carTrip db.CarTrip) error {
 	if err := carTrip.Valid(); err != nil {
 		return err
 	}
@@ -103,7 +115,7 @@ func UpdateCarTrip(database *sql.DB, carTrip db.CarTrip) error {
 		return err
 	}
 	if !ok {
-		return utils.LogError(
+		return utils.ConflictError(
             "car trip at this date already exists: %s", carTrip.DateOnly,
         )
 	}
@@ -123,7 +135,10 @@ func UpdateCarTrip(database *sql.DB, carTrip db.CarTrip) error {
         carTrip.SessionID, carTrip.DistanceKM, carTrip.DateOnly, carTrip.ID,
     )
 	if err != nil {
-		return utils.LogError("unable to update car trip: %v, error: %v", carTrip, err)
+		return utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to update car trip: %v, error: %v", carTrip, err,
+		)
 	}
 
 	rowsAffected, err := res.RowsAffected()
@@ -132,16 +147,16 @@ func UpdateCarTrip(database *sql.DB, carTrip db.CarTrip) error {
 	}
 
 	if rowsAffected == 0 {
-		return utils.LogError("no car trip found with ID: %d", carTrip.ID)
+		return utils.NotFoundError("no car trip found with ID: %d", carTrip.ID)
 	}
 
-	log.Printf("[info] car trip (ID: %v) updated", carTrip.ID)
+	slog.Info("car trip updated", "id", carTrip.ID)
 	return nil
 }
 
-func DeleteCarTripByID(database *sql.DB, id int64) error {
+func DeleteCarTripByID(database db.Querier, id int64) error {
 	if id <= 0 {
-		return utils.LogError("car trip ID must be positive and non-zero")
+		return utils.InvalidIDError("id", "car trip ID must be positive and non-zero")
 	}
 
 	sqlQuery := "DELETE FROM car_trips WHERE id = ?"
@@ -153,7 +168,8 @@ func DeleteCarTripByID(database *sql.DB, id int64) error {
 
 	res, err := stmt.Exec(id)
 	if err != nil {
-		return utils.LogError(
+		return utils.WrapError(
+            db.ConstraintKind(err), err,
             "unable to delete car trip with ID: %v, error: %v", id, err,
         )
 	}
@@ -163,14 +179,14 @@ func DeleteCarTripByID(database *sql.DB, id int64) error {
 		return utils.LogError("failed to check affected rows: %v", err)
 	}
 	if rowsAffected == 0 {
-		return utils.LogError("no car trip found with ID: %d", id)
+		return utils.NotFoundError("no car trip found with ID: %d", id)
 	}
 
-	log.Printf("[info] car trip (ID: %v) deleted", id)
+	slog.Info("car trip deleted", "id", id)
 	return nil
 }
 
-func carTripDateOnlyIsUnique(database *sql.DB, carTrip db.CarTrip) (bool, error) {
+func carTripDateOnlyIsUnique(database db.Querier, carTrip db.CarTrip) (bool, error) {
 	sqlQuery := "SELECT COUNT(*) FROM car_trips WHERE date_only = ? AND id != ?"
 
 	stmt, err := database.Prepare(sqlQuery)
@@ -190,3 +206,106 @@ func carTripDateOnlyIsUnique(database *sql.DB, carTrip db.CarTrip) (bool, error)
 
 	return count == 0, nil
 }
+
+func GetCarTripByDate(database db.Querier, dateOnly string) (*db.CarTrip, error) {
+	sqlQuery := `SELECT
+                    id,
+                    public_id,
+                    session_id,
+                    distance_km,
+                    date_only
+                FROM car_trips WHERE date_only = ?`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	var carTrip db.CarTrip
+	err = stmt.QueryRow(dateOnly).Scan(
+        &carTrip.ID,
+        &carTrip.PublicID,
+        &carTrip.SessionID,
+        &carTrip.DistanceKM,
+        &carTrip.DateOnly,
+    )
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, utils.LogError("failed to fetch car trip by date: %v", err)
+	}
+
+	if err := carTrip.Valid(); err != nil {
+		return nil, err // Integrity of data is breached
+	}
+	return &carTrip, nil
+}
+
+func ListCarTrips(database db.Querier) ([]db.CarTrip, error) {
+	return queryCarTrips(
+        database,
+        `SELECT id, public_id, session_id, distance_km, date_only
+        FROM car_trips ORDER BY date_only`,
+    )
+}
+
+func ListCarTripsBySessionID(database db.Querier, sessionID int64) (
+    []db.CarTrip, error,
+) {
+	return queryCarTrips(
+        database,
+        `SELECT id, public_id, session_id, distance_km, date_only
+        FROM car_trips WHERE session_id = ? ORDER BY date_only`,
+        sessionID,
+    )
+}
+
+// Car trips dated in [from, to), dates as midnight UTC
+func ListCarTripsBetween(database db.Querier, from time.Time, to time.Time) (
+    []db.CarTrip, error,
+) {
+	return queryCarTrips(
+        database,
+        `SELECT id, public_id, session_id, distance_km, date_only
+        FROM car_trips WHERE date_only >= ? AND date_only < ? ORDER BY date_only`,
+        from.Format(time.DateOnly), to.Format(time.DateOnly),
+    )
+}
+
+func queryCarTrips(database db.Querier, sqlQuery string, args ...any) (
+    []db.CarTrip, error,
+) {
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	carTrips := make([]db.CarTrip, 0)
+	for rows.Next() {
+		var carTrip db.CarTrip
+		err := rows.Scan(
+            &carTrip.ID,
+            &carTrip.PublicID,
+            &carTrip.SessionID,
+            &carTrip.DistanceKM,
+            &carTrip.DateOnly,
+        )
+		if err != nil {
+			return nil, utils.LogError("failed to scan car trip: %v", err)
+		}
+		if err := carTrip.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		carTrips = append(carTrips, carTrip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list car trips: %v", err)
+	}
+	return carTrips, nil
+}
@@ -2,13 +2,14 @@ package crud
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 
 	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/logging"
 	"github.com/craftidev/expenseflow/internal/utils"
 )
 
-func CreateClient(database *sql.DB, client db.Client) (int64, error) {
+func CreateClient(database db.Querier, client db.Client) (int64, error) {
 	if err := client.PreInsertValid(); err != nil {
 		return 0, err
 	}
@@ -17,8 +18,8 @@ func CreateClient(database *sql.DB, client db.Client) (int64, error) {
 		return 0, err
 	}
 	if !ok {
-		return 0, utils.LogError(
-			"client name already exists: %s", client.Name,
+		return 0, utils.ConflictError(
+			"client name already exists: %s", logging.UserValue(client.Name),
 		)
 	}
 
@@ -33,7 +34,8 @@ func CreateClient(database *sql.DB, client db.Client) (int64, error) {
 
 	res, err := stmt.Exec(client.Name)
 	if err != nil {
-		return 0, utils.LogError(
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
 			"unable to create client: %v, error: %v",
 			client, err,
 		)
@@ -47,12 +49,12 @@ func CreateClient(database *sql.DB, client db.Client) (int64, error) {
 		)
 	}
 
-	log.Printf("[info] new client (ID: %v) created", id)
+	slog.Info("new client created", "id", id)
 	return id, nil
 }
 
-func GetClientByID(database *sql.DB, id int64) (*db.Client, error) {
-	sqlQuery := "SELECT id, name FROM clients WHERE id = ?"
+func GetClientByID(database db.Querier, id int64) (*db.Client, error) {
+	sqlQuery := "SELECT id, public_id, name FROM clients WHERE id = ?"
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
 		return nil, utils.LogError(
@@ -62,10 +64,10 @@ func GetClientByID(database *sql.DB, id int64) (*db.Client, error) {
 	defer stmt.Close()
 
 	var client db.Client
-	err = stmt.QueryRow(id).Scan(&client.ID, &client.Name)
+	err = stmt.QueryRow(id).Scan(&client.ID, &client.PublicID, &client.Name)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, utils.LogError("client not found (ID: %d)", id)
+			return nil, utils.NotFoundError("client not found (ID: %d)", id)
 		}
 		return nil, utils.LogError("failed to fetch client by ID: %v", err)
 	}
@@ -76,7 +78,15 @@ func GetClientByID(database *sql.DB, id int64) (*db.Client, error) {
 	return &client, nil
 }
 
-func UpdateClient(database *sql.DB, client db.Client) error {
+func GetClientByPublicID(database db.Querier, publicID string) (*db.Client, error) {
+	id, err := idByPublicID(database, "clients", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetClientByID(database, id)
+}
+
+func UpdateClient(database db.Querier, client db.Client) error {
 	if err := client.Valid(); err != nil {
 		return err
 	}
@@ -85,7 +95,7 @@ func UpdateClient(database *sql.DB, client db.Client) error {
 		return err
 	}
 	if !ok {
-		return utils.LogError("client name already exists: %s", client.Name)
+		return utils.ConflictError("client name already exists: %s", logging.UserValue(client.Name))
 	}
 
 	sqlQuery := "UPDATE clients SET name = ? WHERE id = ?"
@@ -97,7 +107,10 @@ func UpdateClient(database *sql.DB, client db.Client) error {
 
 	res, err := stmt.Exec(client.Name, client.ID)
 	if err != nil {
-		return utils.LogError("unable to update client: %v, error: %v", client, err)
+		return utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to update client: %v, error: %v", client, err,
+		)
 	}
 
 	rowsAffected, err := res.RowsAffected()
@@ -106,26 +119,16 @@ func UpdateClient(database *sql.DB, client db.Client) error {
 	}
 
 	if rowsAffected == 0 {
-		return utils.LogError("no client found with ID: %d", client.ID)
+		return utils.NotFoundError("no client found with ID: %d", client.ID)
 	}
 
-	log.Printf("[info] client (ID: %v) updated", client.ID)
+	slog.Info("client updated", "id", client.ID)
 	return nil
 }
 
-func DeleteClientByID(database *sql.DB, id int64) error {
+func DeleteClientByID(database db.Querier, id int64) error {
 	if id <= 0 {
-		return utils.LogError("client ID must be positive and non-zero")
-	}
-
-	ok, err := clientIsNotRefAsAnFK(database, id)
-	if err != nil {
-		return err
-	}
-	if !ok {
-		return utils.LogError(
-			"client (ID: %v) is still referenced by sessions", id,
-		)
+		return utils.InvalidIDError("id", "client ID must be positive and non-zero")
 	}
 
 	sqlQuery := "DELETE FROM clients WHERE id = ?"
@@ -136,8 +139,17 @@ func DeleteClientByID(database *sql.DB, id int64) error {
 	defer stmt.Close()
 
 	res, err := stmt.Exec(id)
+	if kind := db.ConstraintKind(err); kind == utils.ErrReferenced {
+		return utils.WrapError(
+			kind, err,
+			"client (ID: %v) is still referenced by sessions or recurring expenses", id,
+		)
+	}
 	if err != nil {
-		return utils.LogError("unable to delete client with ID: %v, error: %v", id, err)
+		return utils.WrapError(
+			db.ConstraintKind(err), err,
+			"unable to delete client with ID: %v, error: %v", id, err,
+		)
 	}
 
 	rowsAffected, err := res.RowsAffected()
@@ -145,14 +157,14 @@ func DeleteClientByID(database *sql.DB, id int64) error {
 		return utils.LogError("failed to check affected rows: %v", err)
 	}
 	if rowsAffected == 0 {
-		return utils.LogError("no client found with ID: %d", id)
+		return utils.NotFoundError("no client found with ID: %d", id)
 	}
 
-	log.Printf("[info] client (ID: %v) deleted", id)
+	slog.Info("client deleted", "id", id)
 	return nil
 }
 
-func clientNameIsUnique(database *sql.DB, client db.Client) (bool, error) {
+func clientNameIsUnique(database db.Querier, client db.Client) (bool, error) {
 	sqlQuery := "SELECT COUNT(*) FROM clients WHERE name = ? AND id != ?"
 
 	stmt, err := database.Prepare(sqlQuery)
@@ -164,31 +176,60 @@ func clientNameIsUnique(database *sql.DB, client db.Client) (bool, error) {
 	var count int
 	err = stmt.QueryRow(client.Name, client.ID).Scan(&count)
 	if err != nil {
-		return false, utils.LogError("failed to count clients with name: %v, error: %v", client.Name, err)
+		return false, utils.LogError("failed to count clients with name: %v, error: %v", logging.UserValue(client.Name), err)
 	}
 
 	return count == 0, nil
 }
 
-func clientIsNotRefAsAnFK(database *sql.DB, id int64) (bool, error) {
-	sqlQuery := "SELECT COUNT(*) FROM sessions WHERE client_id = ?"
-
+func GetClientByName(database db.Querier, name string) (*db.Client, error) {
+	sqlQuery := "SELECT id, public_id, name FROM clients WHERE name = ?"
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
-		return false, utils.LogError(
+		return nil, utils.LogError(
 			"rejected querry: %v, error: %v", sqlQuery, err,
 		)
 	}
 	defer stmt.Close()
 
-	var count int
-	err = stmt.QueryRow(id).Scan(&count)
+	var client db.Client
+	err = stmt.QueryRow(name).Scan(&client.ID, &client.PublicID, &client.Name)
 	if err != nil {
-		return false, utils.LogError(
-			"failed to count sessions with client ID: %v, error: %v",
-			id, err,
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, utils.LogError("failed to fetch client by name: %v", err)
+	}
+
+	if err := client.Valid(); err != nil {
+		return nil, err // Integrity of data is breached
+	}
+	return &client, nil
+}
+
+func ListClients(database db.Querier) ([]db.Client, error) {
+	sqlQuery := "SELECT id, public_id, name FROM clients ORDER BY id"
+	rows, err := database.Query(sqlQuery)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
 		)
 	}
+	defer rows.Close()
 
-	return count == 0, nil
+	clients := make([]db.Client, 0)
+	for rows.Next() {
+		var client db.Client
+		if err := rows.Scan(&client.ID, &client.PublicID, &client.Name); err != nil {
+			return nil, utils.LogError("failed to scan client: %v", err)
+		}
+		if err := client.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list clients: %v", err)
+	}
+	return clients, nil
 }
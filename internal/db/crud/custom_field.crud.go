@@ -0,0 +1,399 @@
+package crud
+
+import (
+	"log/slog"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/logging"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+const customFieldColumns = "id, public_id, name, applies_to, type, options"
+
+func CreateCustomField(database db.Querier, field db.CustomField) (int64, error) {
+	if err := field.PreInsertValid(); err != nil {
+		return 0, err
+	}
+	existing, err := GetCustomFieldByName(database, field.AppliesTo, field.Name)
+	if err != nil {
+		return 0, err
+	}
+	if existing != nil {
+		return 0, utils.ConflictError(
+			"%v custom field already exists: %s", field.AppliesTo, logging.UserValue(existing.Name),
+		)
+	}
+
+	sqlQuery := `INSERT INTO custom_fields(
+                    name,
+                    applies_to,
+                    type,
+                    options
+                ) VALUES (?, ?, ?, ?)`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return 0, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(field.Name, field.AppliesTo, field.Type, field.Options)
+	if err != nil {
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to create custom field: %v, error: %v", field, err,
+		)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, utils.LogError(
+			"new custom field created, but failed to get last inserted ID: %v, error: %v",
+			field, err,
+		)
+	}
+
+	slog.Info("new custom field created", "id", id)
+	return id, nil
+}
+
+func GetCustomFieldByID(database db.Querier, id int64) (*db.CustomField, error) {
+	sqlQuery := "SELECT " + customFieldColumns + " FROM custom_fields WHERE id = ?"
+	fields, err := queryCustomFields(database, sqlQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, utils.NotFoundError("custom field not found (ID: %d)", id)
+	}
+	return &fields[0], nil
+}
+
+func GetCustomFieldByPublicID(database db.Querier, publicID string) (*db.CustomField, error) {
+	id, err := idByPublicID(database, "custom_fields", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetCustomFieldByID(database, id)
+}
+
+// Case insensitive, nil when not found
+func GetCustomFieldByName(database db.Querier, appliesTo string, name string) (
+    *db.CustomField, error,
+) {
+	sqlQuery := "SELECT " + customFieldColumns +
+		" FROM custom_fields WHERE applies_to = ? AND name = ?"
+	fields, err := queryCustomFields(database, sqlQuery, appliesTo, name)
+	if err != nil || len(fields) == 0 {
+		return nil, err
+	}
+	return &fields[0], nil
+}
+
+// Values already set must fit the new type and options
+func UpdateCustomField(database db.Querier, field db.CustomField) error {
+	if err := field.Valid(); err != nil {
+		return err
+	}
+	existing, err := GetCustomFieldByName(database, field.AppliesTo, field.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != field.ID {
+		return utils.ConflictError(
+			"%v custom field already exists: %s", field.AppliesTo, logging.UserValue(existing.Name),
+		)
+	}
+	values, err := queryCustomFieldValues(
+        database,
+        "SELECT field_id, entity_id, value FROM custom_field_values WHERE field_id = ?",
+        field.ID,
+    )
+	if err != nil {
+		return err
+	}
+	current, err := GetCustomFieldByID(database, field.ID)
+	if err != nil {
+		return err
+	}
+	if current.AppliesTo != field.AppliesTo && len(values) > 0 {
+		return utils.ReferencedError(
+			"custom field (ID: %d) is set on some %vs, it can't apply to %vs",
+			field.ID, current.AppliesTo, field.AppliesTo,
+		)
+	}
+	for _, value := range values {
+		if normalized, err := field.NormalizeValue(value.Value); err != nil || normalized != value.Value {
+			return utils.ValidationError(
+				[]string{"type", "options"},
+				"custom field (ID: %d) change doesn't fit the value of entity (ID: %d): %q",
+				field.ID, value.EntityID, logging.UserValue(value.Value),
+			)
+		}
+	}
+
+	sqlQuery := `UPDATE custom_fields SET
+                    name = ?,
+                    applies_to = ?,
+                    type = ?,
+                    options = ?
+                WHERE id = ?`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(field.Name, field.AppliesTo, field.Type, field.Options, field.ID)
+	if err != nil {
+		return utils.WrapError(
+            db.WriteConstraintKind(err), err,
+            "unable to update custom field: %v, error: %v", field, err,
+        )
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return utils.NotFoundError("no custom field found with ID: %d", field.ID)
+	}
+
+	slog.Info("custom field updated", "id", field.ID)
+	return nil
+}
+
+// Its values go with it (trigger custom_fields_delete_values)
+func DeleteCustomFieldByID(database db.Querier, id int64) error {
+	if id <= 0 {
+		return utils.InvalidIDError("id", "custom field ID must be positive and non-zero")
+	}
+
+	sqlQuery := "DELETE FROM custom_fields WHERE id = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(id)
+	if err != nil {
+		return utils.WrapError(
+            db.ConstraintKind(err), err,
+            "unable to delete custom field with ID: %v, error: %v", id, err,
+        )
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return utils.NotFoundError("no custom field found with ID: %d", id)
+	}
+
+	slog.Info("custom field deleted", "id", id)
+	return nil
+}
+
+// appliesTo "" lists the fields of expenses and sessions
+func ListCustomFields(database db.Querier, appliesTo string) ([]db.CustomField, error) {
+	if appliesTo == "" {
+		return queryCustomFields(
+            database,
+            "SELECT " + customFieldColumns + " FROM custom_fields ORDER BY applies_to, name",
+        )
+	}
+	return queryCustomFields(
+        database,
+        "SELECT " + customFieldColumns + " FROM custom_fields WHERE applies_to = ? ORDER BY name",
+        appliesTo,
+    )
+}
+
+func queryCustomFields(database db.Querier, sqlQuery string, args ...any) (
+    []db.CustomField, error,
+) {
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	fields := make([]db.CustomField, 0)
+	for rows.Next() {
+		var field db.CustomField
+		err := rows.Scan(
+            &field.ID,
+            &field.PublicID,
+            &field.Name,
+            &field.AppliesTo,
+            &field.Type,
+            &field.Options,
+        )
+		if err != nil {
+			return nil, utils.LogError("failed to scan custom field: %v", err)
+		}
+		if err := field.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		fields = append(fields, field)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list custom fields: %v", err)
+	}
+	return fields, nil
+}
+
+// Set or replace the value of field for the expense or session entityID,
+// returns the value as stored (see CustomField.NormalizeValue)
+func SetCustomFieldValue(
+    database db.Querier, field db.CustomField, entityID int64, value string,
+) (string, error) {
+	if err := field.Valid(); err != nil {
+		return "", err
+	}
+	normalized, err := field.NormalizeValue(value)
+	if err != nil {
+		return "", err
+	}
+	fieldValue := db.CustomFieldValue{FieldID: field.ID, EntityID: entityID, Value: normalized}
+	if err := fieldValue.PreInsertValid(); err != nil {
+		return "", err
+	}
+
+	sqlQuery := `INSERT INTO custom_field_values(field_id, entity_id, value)
+                VALUES (?, ?, ?)
+                ON CONFLICT (field_id, entity_id) DO UPDATE SET value = excluded.value`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return "", utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(field.ID, entityID, normalized); err != nil {
+		return "", utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to set custom field value: %v, error: %v", fieldValue, err,
+		)
+	}
+
+	slog.Info("custom field set", "id", field.ID, "kind", field.AppliesTo, "entity_id", entityID)
+	return normalized, nil
+}
+
+func DeleteCustomFieldValue(database db.Querier, fieldID int64, entityID int64) error {
+	sqlQuery := "DELETE FROM custom_field_values WHERE field_id = ? AND entity_id = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(fieldID, entityID)
+	if err != nil {
+		return utils.WrapError(
+			db.ConstraintKind(err), err,
+			"unable to delete custom field (ID: %v) value of entity (ID: %v), error: %v",
+			fieldID, entityID, err,
+		)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return utils.NotFoundError(
+			"no value of custom field (ID: %d) for entity (ID: %d)", fieldID, entityID,
+		)
+	}
+
+	slog.Info("custom field unset", "id", fieldID, "entity_id", entityID)
+	return nil
+}
+
+// Values of one expense or session, by field name
+func GetCustomFieldValues(database db.Querier, appliesTo string, entityID int64) (
+    map[string]string, error,
+) {
+	values, err := MapCustomFieldValues(database, appliesTo, entityID)
+	if err != nil {
+		return nil, err
+	}
+	if values[entityID] == nil {
+		return make(map[string]string), nil
+	}
+	return values[entityID], nil
+}
+
+// Values of every expense or session, by entity ID then field name.
+// Only entityIDs when some are given.
+func MapCustomFieldValues(database db.Querier, appliesTo string, entityIDs ...int64) (
+    map[int64]map[string]string, error,
+) {
+	sqlQuery := `SELECT custom_field_values.entity_id, custom_fields.name, custom_field_values.value
+                FROM custom_field_values
+                JOIN custom_fields ON custom_fields.id = custom_field_values.field_id
+                WHERE custom_fields.applies_to = ?`
+	args := []any{appliesTo}
+	if len(entityIDs) > 0 {
+		sqlQuery += " AND custom_field_values.entity_id IN (" + idPlaceholders(entityIDs) + ")"
+		args = append(args, idArgs(entityIDs)...)
+	}
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	values := make(map[int64]map[string]string)
+	for rows.Next() {
+		var entityID int64
+		var name, value string
+		if err := rows.Scan(&entityID, &name, &value); err != nil {
+			return nil, utils.LogError("failed to scan custom field value: %v", err)
+		}
+		if values[entityID] == nil {
+			values[entityID] = make(map[string]string)
+		}
+		values[entityID][name] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list custom field values: %v", err)
+	}
+	return values, nil
+}
+
+func queryCustomFieldValues(database db.Querier, sqlQuery string, args ...any) (
+    []db.CustomFieldValue, error,
+) {
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	values := make([]db.CustomFieldValue, 0)
+	for rows.Next() {
+		var value db.CustomFieldValue
+		if err := rows.Scan(&value.FieldID, &value.EntityID, &value.Value); err != nil {
+			return nil, utils.LogError("failed to scan custom field value: %v", err)
+		}
+		if err := value.PreInsertValid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list custom field values: %v", err)
+	}
+	return values, nil
+}
@@ -2,13 +2,14 @@ package crud
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/craftidev/expenseflow/internal/db"
 	"github.com/craftidev/expenseflow/internal/utils"
 )
 
-func CreateExpense(database *sql.DB, expense db.Expense) (int64, error) {
+func CreateExpense(database db.Querier, expense db.Expense) (int64, error) {
 	if err := expense.PreInsertValid(); err != nil {
 		return 0, err
 	}
@@ -17,10 +18,13 @@ func CreateExpense(database *sql.DB, expense db.Expense) (int64, error) {
                     session_id,
                     type_id,
                     currency,
-                    receipt_rel_path,
                     notes,
-                    date_time
-                ) VALUES (?, ?, ?, ?, ?, ?)`
+                    date_time,
+                    country,
+                    time_zone,
+                    covered_days,
+                    merchant
+                ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
 		return 0, utils.LogError(
@@ -33,12 +37,16 @@ func CreateExpense(database *sql.DB, expense db.Expense) (int64, error) {
         expense.SessionID,
         expense.TypeID,
         expense.Currency,
-        expense.ReceiptRelPath,
         expense.Notes,
-        expense.DateTime,
+        db.FormatTimestamp(expense.DateTime),
+        expense.Country,
+        expense.TimeZone,
+        expense.CoveredDays,
+        expense.Merchant,
     )
 	if err != nil {
-		return 0, utils.LogError(
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
 			"unable to create expense: %v, error: %v",
 			expense, err,
 		)
@@ -52,19 +60,23 @@ func CreateExpense(database *sql.DB, expense db.Expense) (int64, error) {
 		)
 	}
 
-	log.Printf("[info] new expense (ID: %v) created", id)
+	slog.Info("new expense created", "id", id)
 	return id, nil
 }
 
-func GetExpenseByID(database *sql.DB, id int64) (*db.Expense, error) {
+func GetExpenseByID(database db.Querier, id int64) (*db.Expense, error) {
 	sqlQuery := `SELECT
                     id,
+                    public_id,
                     session_id,
                     type_id,
                     currency,
-                    receipt_rel_path,
                     notes,
-                    date_time
+                    date_time,
+                    country,
+                    time_zone,
+                    covered_days,
+                    merchant
                 FROM expenses WHERE id = ?`
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
@@ -78,16 +90,20 @@ func GetExpenseByID(database *sql.DB, id int64) (*db.Expense, error) {
     var dateTime string
 	err = stmt.QueryRow(id).Scan(
         &expense.ID,
+        &expense.PublicID,
         &expense.SessionID,
         &expense.TypeID,
         &expense.Currency,
-        &expense.ReceiptRelPath,
         &expense.Notes,
         &dateTime,
+        &expense.Country,
+        &expense.TimeZone,
+        &expense.CoveredDays,
+        &expense.Merchant,
     )
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, utils.LogError("expense not found (ID: %d)", id)
+			return nil, utils.NotFoundError("expense not found (ID: %d)", id)
 		}
 		return nil, utils.LogError("failed to fetch expense by ID: %v", err)
 	}
@@ -103,7 +119,15 @@ func GetExpenseByID(database *sql.DB, id int64) (*db.Expense, error) {
 	return &expense, nil
 }
 
-func UpdateExpense(database *sql.DB, expense db.Expense) error {
+func GetExpenseByPublicID(database db.Querier, publicID string) (*db.Expense, error) {
+	id, err := idByPublicID(database, "expenses", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetExpenseByID(database, id)
+}
+
+func UpdateExpense(database db.Querier, expense db.Expense) error {
 	if err := expense.Valid(); err != nil {
 		return err
 	}
@@ -112,9 +136,12 @@ func UpdateExpense(database *sql.DB, expense db.Expense) error {
                     session_id = ?,
                     type_id = ?,
                     currency = ?,
-                    receipt_rel_path = ?,
                     notes = ?,
-                    date_time = ?
+                    date_time = ?,
+                    country = ?,
+                    time_zone = ?,
+                    covered_days = ?,
+                    merchant = ?
                 WHERE id = ?`
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
@@ -126,13 +153,17 @@ func UpdateExpense(database *sql.DB, expense db.Expense) error {
         expense.SessionID,
         expense.TypeID,
         expense.Currency,
-        expense.ReceiptRelPath,
         expense.Notes,
-        expense.DateTime,
+        db.FormatTimestamp(expense.DateTime),
+        expense.Country,
+        expense.TimeZone,
+        expense.CoveredDays,
+        expense.Merchant,
         expense.ID,
     )
 	if err != nil {
-		return utils.LogError(
+		return utils.WrapError(
+            db.WriteConstraintKind(err), err,
             "unable to update expense: %v, error: %v", expense, err,
         )
 	}
@@ -143,26 +174,16 @@ func UpdateExpense(database *sql.DB, expense db.Expense) error {
 	}
 
 	if rowsAffected == 0 {
-		return utils.LogError("no expense found with ID: %d", expense.ID)
+		return utils.NotFoundError("no expense found with ID: %d", expense.ID)
 	}
 
-	log.Printf("[info] expense (ID: %v) updated", expense.ID)
+	slog.Info("expense updated", "id", expense.ID)
 	return nil
 }
 
-func DeleteExpenseByID(database *sql.DB, id int64) error {
+func DeleteExpenseByID(database db.Querier, id int64) error {
 	if id <= 0 {
-		return utils.LogError("expense ID must be positive and non-zero")
-	}
-
-	ok, err := expenseIsNotRefAsAnFK(database, id)
-	if err != nil {
-		return err
-	}
-	if !ok {
-		return utils.LogError(
-			"expense (ID: %v) is still referenced by line items", id,
-		)
+		return utils.InvalidIDError("id", "expense ID must be positive and non-zero")
 	}
 
 	sqlQuery := "DELETE FROM expenses WHERE id = ?"
@@ -173,8 +194,15 @@ func DeleteExpenseByID(database *sql.DB, id int64) error {
 	defer stmt.Close()
 
 	res, err := stmt.Exec(id)
+	if kind := db.ConstraintKind(err); kind == utils.ErrReferenced {
+		return utils.WrapError(
+			kind, err,
+			"expense (ID: %v) is still referenced by line items or receipts", id,
+		)
+	}
 	if err != nil {
-		return utils.LogError(
+		return utils.WrapError(
+            db.ConstraintKind(err), err,
             "unable to delete expense with ID: %v, error: %v", id, err,
         )
 	}
@@ -184,32 +212,164 @@ func DeleteExpenseByID(database *sql.DB, id int64) error {
 		return utils.LogError("failed to check affected rows: %v", err)
 	}
 	if rowsAffected == 0 {
-		return utils.LogError("no expense found with ID: %d", id)
+		return utils.NotFoundError("no expense found with ID: %d", id)
 	}
 
-	log.Printf("[info] expense (ID: %v) deleted", id)
+	slog.Info("expense deleted", "id", id)
 	return nil
 }
 
-func expenseIsNotRefAsAnFK(database *sql.DB, id int64) (bool, error) {
-	sqlQuery := "SELECT COUNT(*) FROM line_items WHERE expense_id = ?"
+func ListExpenses(database db.Querier) (db.ExpenseList, error) {
+	return queryExpenses(
+        database,
+        `SELECT
+            id,
+            public_id,
+            session_id,
+            type_id,
+            currency,
+            notes,
+            date_time,
+            country,
+            time_zone,
+            covered_days,
+            merchant
+        FROM expenses ORDER BY id`,
+    )
+}
 
-	stmt, err := database.Prepare(sqlQuery)
-	if err != nil {
-		return false, utils.LogError(
-			"rejected querry: %v, error: %v", sqlQuery, err,
-		)
+func ListExpensesBySessionID(database db.Querier, sessionID int64) (
+    db.ExpenseList, error,
+) {
+	return queryExpenses(
+        database,
+        `SELECT
+            id,
+            public_id,
+            session_id,
+            type_id,
+            currency,
+            notes,
+            date_time,
+            country,
+            time_zone,
+            covered_days,
+            merchant
+        FROM expenses WHERE session_id = ? ORDER BY id`,
+        sessionID,
+    )
+}
+
+func ListExpensesByFilter(database db.Querier, filter ExpenseFilter) (
+    db.ExpenseList, error,
+) {
+	conditions, args := filter.conditions(db.CustomFieldOnExpense)
+	if filter.SessionID != 0 {
+		// Expenses split across sessions belong to each of them
+		conditions = append(
+            conditions,
+            "(session_id = ? OR id IN (SELECT expense_id FROM expense_allocations WHERE session_id = ?))",
+        )
+		args = append(args, filter.SessionID, filter.SessionID)
 	}
-	defer stmt.Close()
+	return queryExpenses(
+        database,
+        `SELECT
+            id,
+            public_id,
+            session_id,
+            type_id,
+            currency,
+            notes,
+            date_time,
+            country,
+            time_zone,
+            covered_days,
+            merchant
+        FROM expenses` + whereClause(conditions) + " ORDER BY id",
+        args...,
+    )
+}
 
-	var count int
-	err = stmt.QueryRow(id).Scan(&count)
+// Expenses with a local day in [from, to), dates as midnight UTC, the days
+// they cover included (see db.Expense.Days). Stored timestamps are UTC, the
+// local date at most a day away: date_time narrows the rows with its index,
+// local_date() keeps the exact ones.
+func ListExpensesBetween(database db.Querier, from time.Time, to time.Time) (
+    db.ExpenseList, error,
+) {
+	return queryExpenses(
+        database,
+        `SELECT
+            id,
+            public_id,
+            session_id,
+            type_id,
+            currency,
+            notes,
+            date_time,
+            country,
+            time_zone,
+            covered_days,
+            merchant
+        FROM expenses
+        WHERE date_time >= ? AND date_time < ?
+            AND local_date(date_time, time_zone) < ?
+            AND date(
+                local_date(date_time, time_zone), '+' || (IFNULL(covered_days, 1) - 1) || ' days'
+            ) >= ?
+        ORDER BY id`,
+        db.FormatTimestamp(from.AddDate(0, 0, -db.MaxCoveredDays)),
+        db.FormatTimestamp(to.AddDate(0, 0, 1)),
+        to.Format(time.DateOnly),
+        from.Format(time.DateOnly),
+    )
+}
+
+func queryExpenses(database db.Querier, sqlQuery string, args ...any) (
+    db.ExpenseList, error,
+) {
+	rows, err := database.Query(sqlQuery, args...)
 	if err != nil {
-		return false, utils.LogError(
-			"failed to count line items with expense ID: %v, error: %v",
-			id, err,
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
 		)
 	}
+	defer rows.Close()
 
-	return count == 0, nil
+	expenses := make(db.ExpenseList, 0)
+	for rows.Next() {
+		var expense db.Expense
+		var dateTime string
+		err := rows.Scan(
+            &expense.ID,
+            &expense.PublicID,
+            &expense.SessionID,
+            &expense.TypeID,
+            &expense.Currency,
+            &expense.Notes,
+            &dateTime,
+            &expense.Country,
+            &expense.TimeZone,
+            &expense.CoveredDays,
+            &expense.Merchant,
+        )
+		if err != nil {
+			return nil, utils.LogError("failed to scan expense: %v", err)
+		}
+
+		expense.DateTime, err = ParsingStrToTime(dateTime)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := expense.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		expenses = append(expenses, expense)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list expenses: %v", err)
+	}
+	return expenses, nil
 }
@@ -2,13 +2,14 @@ package crud
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 
 	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/logging"
 	"github.com/craftidev/expenseflow/internal/utils"
 )
 
-func CreateExpenseType(database *sql.DB, expenseType db.ExpenseType) (int64, error) {
+func CreateExpenseType(database db.Querier, expenseType db.ExpenseType) (int64, error) {
 	if err := expenseType.PreInsertValid(); err != nil {
 		return 0, err
 	}
@@ -17,12 +18,20 @@ func CreateExpenseType(database *sql.DB, expenseType db.ExpenseType) (int64, err
 		return 0, err
 	}
 	if !ok {
-		return 0, utils.LogError(
-			"expense type name already exists: %s", expenseType.Name,
+		return 0, utils.ConflictError(
+			"expense type name already exists: %s", logging.UserValue(expenseType.Name),
 		)
 	}
 
-	sqlQuery := "INSERT INTO expense_types(name) VALUES (?)"
+	sqlQuery := `INSERT INTO expense_types(
+                    name,
+                    default_taxe_rates,
+                    accounting_code,
+                    reimbursable,
+                    vat_recoverable,
+                    description,
+                    model_ref
+                ) VALUES (?, ?, ?, ?, ?, ?, ?)`
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
 		return 0, utils.LogError(
@@ -31,9 +40,18 @@ func CreateExpenseType(database *sql.DB, expenseType db.ExpenseType) (int64, err
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(expenseType.Name)
+	res, err := stmt.Exec(
+        expenseType.Name,
+        expenseType.DefaultTaxeRates,
+        expenseType.AccountingCode,
+        expenseType.Reimbursable,
+        expenseType.VATRecoverable,
+        expenseType.Description,
+        expenseType.ModelRef,
+    )
 	if err != nil {
-		return 0, utils.LogError(
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
 			"unable to create expense type: %v, error: %v",
 			expenseType, err,
 		)
@@ -47,12 +65,12 @@ func CreateExpenseType(database *sql.DB, expenseType db.ExpenseType) (int64, err
 		)
 	}
 
-	log.Printf("[info] new expense type (ID: %v) created", id)
+	slog.Info("new expense type created", "id", id)
 	return id, nil
 }
 
-func GetExpenseTypeByID(database *sql.DB, id int64) (*db.ExpenseType, error) {
-	sqlQuery := "SELECT id, name FROM expense_types WHERE id = ?"
+func GetExpenseTypeByID(database db.Querier, id int64) (*db.ExpenseType, error) {
+	sqlQuery := "SELECT " + expenseTypeColumns + " FROM expense_types WHERE id = ?"
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
 		return nil, utils.LogError(
@@ -61,11 +79,10 @@ func GetExpenseTypeByID(database *sql.DB, id int64) (*db.ExpenseType, error) {
 	}
 	defer stmt.Close()
 
-	var expenseType db.ExpenseType
-	err = stmt.QueryRow(id).Scan(&expenseType.ID, &expenseType.Name)
+	expenseType, err := scanExpenseType(stmt.QueryRow(id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, utils.LogError("expense type not found (ID: %d)", id)
+			return nil, utils.NotFoundError("expense type not found (ID: %d)", id)
 		}
 		return nil, utils.LogError("failed to fetch expense type by ID: %v", err)
 	}
@@ -76,7 +93,15 @@ func GetExpenseTypeByID(database *sql.DB, id int64) (*db.ExpenseType, error) {
 	return &expenseType, nil
 }
 
-func UpdateExpenseType(database *sql.DB, expenseType db.ExpenseType) error {
+func GetExpenseTypeByPublicID(database db.Querier, publicID string) (*db.ExpenseType, error) {
+	id, err := idByPublicID(database, "expense_types", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetExpenseTypeByID(database, id)
+}
+
+func UpdateExpenseType(database db.Querier, expenseType db.ExpenseType) error {
 	if err := expenseType.Valid(); err != nil {
 		return err
 	}
@@ -85,21 +110,39 @@ func UpdateExpenseType(database *sql.DB, expenseType db.ExpenseType) error {
 		return err
 	}
 	if !ok {
-		return utils.LogError("expense type name already exists: %s",
-        expenseType.Name,
+		return utils.ConflictError("expense type name already exists: %s",
+        logging.UserValue(expenseType.Name),
     )
 	}
 
-	sqlQuery := "UPDATE expense_types SET name = ? WHERE id = ?"
+	sqlQuery := `UPDATE expense_types SET
+                    name = ?,
+                    default_taxe_rates = ?,
+                    accounting_code = ?,
+                    reimbursable = ?,
+                    vat_recoverable = ?,
+                    description = ?,
+                    model_ref = ?
+                WHERE id = ?`
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
 		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(expenseType.Name, expenseType.ID)
+	res, err := stmt.Exec(
+        expenseType.Name,
+        expenseType.DefaultTaxeRates,
+        expenseType.AccountingCode,
+        expenseType.Reimbursable,
+        expenseType.VATRecoverable,
+        expenseType.Description,
+        expenseType.ModelRef,
+        expenseType.ID,
+    )
 	if err != nil {
-		return utils.LogError(
+		return utils.WrapError(
+            db.WriteConstraintKind(err), err,
             "unable to update expense type: %v, error: %v", expenseType, err,
         )
 	}
@@ -110,28 +153,18 @@ func UpdateExpenseType(database *sql.DB, expenseType db.ExpenseType) error {
 	}
 
 	if rowsAffected == 0 {
-		return utils.LogError(
+		return utils.NotFoundError(
             "no expense type found with ID: %d", expenseType.ID,
         )
 	}
 
-	log.Printf("[info] expense type (ID: %v) updated", expenseType.ID)
+	slog.Info("expense type updated", "id", expenseType.ID)
 	return nil
 }
 
-func DeleteExpenseTypeByID(database *sql.DB, id int64) error {
+func DeleteExpenseTypeByID(database db.Querier, id int64) error {
 	if id <= 0 {
-		return utils.LogError("expense type ID must be positive and non-zero")
-	}
-
-	ok, err := expenseTypeIsNotRefAsAnFK(database, id)
-	if err != nil {
-		return err
-	}
-	if !ok {
-		return utils.LogError(
-			"expense type (ID: %v) is still referenced by expenses", id,
-		)
+		return utils.InvalidIDError("id", "expense type ID must be positive and non-zero")
 	}
 
 	sqlQuery := "DELETE FROM expense_types WHERE id = ?"
@@ -142,8 +175,15 @@ func DeleteExpenseTypeByID(database *sql.DB, id int64) error {
 	defer stmt.Close()
 
 	res, err := stmt.Exec(id)
+	if kind := db.ConstraintKind(err); kind == utils.ErrReferenced {
+		return utils.WrapError(
+			kind, err,
+			"expense type (ID: %v) is still referenced by expenses or recurring expenses", id,
+		)
+	}
 	if err != nil {
-		return utils.LogError(
+		return utils.WrapError(
+            db.ConstraintKind(err), err,
             "unable to delete expense type with ID: %v, error: %v", id, err,
         )
 	}
@@ -153,14 +193,14 @@ func DeleteExpenseTypeByID(database *sql.DB, id int64) error {
 		return utils.LogError("failed to check affected rows: %v", err)
 	}
 	if rowsAffected == 0 {
-		return utils.LogError("no expense type found with ID: %d", id)
+		return utils.NotFoundError("no expense type found with ID: %d", id)
 	}
 
-	log.Printf("[info] expense type (ID: %v) deleted", id)
+	slog.Info("expense type deleted", "id", id)
 	return nil
 }
 
-func expenseTypeNameIsUnique(database *sql.DB, expenseType db.ExpenseType) (bool, error) {
+func expenseTypeNameIsUnique(database db.Querier, expenseType db.ExpenseType) (bool, error) {
 	sqlQuery := "SELECT COUNT(*) FROM expense_types WHERE name = ? AND id != ?"
 
 	stmt, err := database.Prepare(sqlQuery)
@@ -176,32 +216,116 @@ func expenseTypeNameIsUnique(database *sql.DB, expenseType db.ExpenseType) (bool
 	if err != nil {
 		return false, utils.LogError(
             "failed to count expense types with name: %v, error: %v",
-            expenseType.Name, err,
+            logging.UserValue(expenseType.Name), err,
         )
 	}
 
 	return count == 0, nil
 }
 
-func expenseTypeIsNotRefAsAnFK(database *sql.DB, id int64) (bool, error) {
-	sqlQuery := "SELECT COUNT(*) FROM expenses WHERE type_id = ?"
+func GetExpenseTypeByName(database db.Querier, name string) (*db.ExpenseType, error) {
+	sqlQuery := "SELECT " + expenseTypeColumns + " FROM expense_types WHERE name = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	expenseType, err := scanExpenseType(stmt.QueryRow(name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, utils.LogError("failed to fetch expense type by name: %v", err)
+	}
+
+	if err := expenseType.Valid(); err != nil {
+		return nil, err // Integrity of data is breached
+	}
+	return &expenseType, nil
+}
 
+// Expense type installed from a standard model, nil if there is none
+func GetExpenseTypeByModelRef(database db.Querier, modelRef string) (*db.ExpenseType, error) {
+	sqlQuery := "SELECT " + expenseTypeColumns + " FROM expense_types WHERE model_ref = ?"
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
-		return false, utils.LogError(
+		return nil, utils.LogError(
 			"rejected querry: %v, error: %v", sqlQuery, err,
 		)
 	}
 	defer stmt.Close()
 
-	var count int
-	err = stmt.QueryRow(id).Scan(&count)
+	expenseType, err := scanExpenseType(stmt.QueryRow(modelRef))
 	if err != nil {
-		return false, utils.LogError(
-			"failed to count expenses with expense type ID: %v, error: %v",
-			id, err,
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, utils.LogError("failed to fetch expense type by model ref: %v", err)
+	}
+
+	if err := expenseType.Valid(); err != nil {
+		return nil, err // Integrity of data is breached
+	}
+	return &expenseType, nil
+}
+
+func ListExpenseTypes(database db.Querier) ([]db.ExpenseType, error) {
+	sqlQuery := "SELECT " + expenseTypeColumns + " FROM expense_types ORDER BY id"
+	rows, err := database.Query(sqlQuery)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
 		)
 	}
+	defer rows.Close()
 
-	return count == 0, nil
+	expenseTypes := make([]db.ExpenseType, 0)
+	for rows.Next() {
+		expenseType, err := scanExpenseType(rows)
+		if err != nil {
+			return nil, utils.LogError("failed to scan expense type: %v", err)
+		}
+		if err := expenseType.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		expenseTypes = append(expenseTypes, expenseType)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list expense types: %v", err)
+	}
+	return expenseTypes, nil
+}
+
+const expenseTypeColumns = `id,
+                    public_id,
+                    name,
+                    default_taxe_rates,
+                    accounting_code,
+                    reimbursable,
+                    vat_recoverable,
+                    description,
+                    model_ref`
+
+// Common interface of *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanExpenseType(row rowScanner) (db.ExpenseType, error) {
+	var expenseType db.ExpenseType
+	err := row.Scan(
+        &expenseType.ID,
+        &expenseType.PublicID,
+        &expenseType.Name,
+        &expenseType.DefaultTaxeRates,
+        &expenseType.AccountingCode,
+        &expenseType.Reimbursable,
+        &expenseType.VATRecoverable,
+        &expenseType.Description,
+        &expenseType.ModelRef,
+    )
+	return expenseType, err
 }
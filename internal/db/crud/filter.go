@@ -0,0 +1,63 @@
+package crud
+
+import (
+	"sort"
+	"strings"
+)
+
+// Rows having every tag and every custom field value, an empty filter
+// matches everything
+type AttributeFilter struct {
+	Tags   []string         // tag names, case insensitive
+	Fields map[int64]string // custom field ID -> value as stored (see db.CustomField.NormalizeValue)
+}
+
+type ExpenseFilter struct {
+	SessionID int64 // 0 for any session
+	AttributeFilter
+}
+
+// SQL conditions on the expense or session table kind (see linkTag), and
+// their arguments
+func (f AttributeFilter) conditions(kind string) ([]string, []any) {
+	var conditions []string
+	var args []any
+	for _, tag := range f.Tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM " + kind + "_tags AS links " +
+			"JOIN tags ON tags.id = links.tag_id " +
+			"WHERE links." + kind + "_id = " + kind + "s.id AND tags.name = ?)")
+		args = append(args, tag)
+	}
+
+	fieldIDs := make([]int64, 0, len(f.Fields))
+	for fieldID := range f.Fields {
+		fieldIDs = append(fieldIDs, fieldID)
+	}
+	sort.Slice(fieldIDs, func(i, j int) bool { return fieldIDs[i] < fieldIDs[j] })
+	for _, fieldID := range fieldIDs {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM custom_field_values AS v " +
+			"WHERE v.entity_id = " + kind + "s.id AND v.field_id = ? AND v.value = ?)")
+		args = append(args, fieldID, f.Fields[fieldID])
+	}
+	return conditions, args
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// "?, ?, ?" for an IN list of ids, with idArgs as its arguments
+func idPlaceholders(ids []int64) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+}
+
+func idArgs(ids []int64) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
@@ -2,16 +2,19 @@ package crud
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 
 	"github.com/craftidev/expenseflow/internal/db"
 	"github.com/craftidev/expenseflow/internal/utils"
 )
 
-func CreateLineItem(database *sql.DB, lineItem db.LineItem) (int64, error) {
+func CreateLineItem(database db.Querier, lineItem db.LineItem) (int64, error) {
 	if err := lineItem.PreInsertValid(); err != nil {
 		return 0, err
 	}
+	if _, err := CheckLineItemTaxeRate(database, lineItem); err != nil {
+		return 0, err
+	}
 
 	sqlQuery := `INSERT INTO line_items(
                     expense_id,
@@ -32,7 +35,8 @@ func CreateLineItem(database *sql.DB, lineItem db.LineItem) (int64, error) {
         lineItem.Total,
     )
 	if err != nil {
-		return 0, utils.LogError(
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
 			"unable to create line item: %v, error: %v",
 			lineItem, err,
 		)
@@ -46,13 +50,14 @@ func CreateLineItem(database *sql.DB, lineItem db.LineItem) (int64, error) {
 		)
 	}
 
-	log.Printf("[info] new line item (ID: %v) created", id)
+	slog.Info("new line item created", "id", id)
 	return id, nil
 }
 
-func GetLineItemByID(database *sql.DB, id int64) (*db.LineItem, error) {
+func GetLineItemByID(database db.Querier, id int64) (*db.LineItem, error) {
 	sqlQuery := `SELECT
                     id,
+                    public_id,
                     expense_id,
                     taxe_rate,
                     total
@@ -68,13 +73,14 @@ func GetLineItemByID(database *sql.DB, id int64) (*db.LineItem, error) {
 	var lineItem db.LineItem
 	err = stmt.QueryRow(id).Scan(
         &lineItem.ID,
+        &lineItem.PublicID,
         &lineItem.ExpenseID,
         &lineItem.TaxeRate,
         &lineItem.Total,
     )
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, utils.LogError("line item not found (ID: %d)", id)
+			return nil, utils.NotFoundError("line item not found (ID: %d)", id)
 		}
 		return nil, utils.LogError("failed to fetch line item by ID: %v", err)
 	}
@@ -85,10 +91,21 @@ func GetLineItemByID(database *sql.DB, id int64) (*db.LineItem, error) {
 	return &lineItem, nil
 }
 
-func UpdateLineItem(database *sql.DB, lineItem db.LineItem) error {
+func GetLineItemByPublicID(database db.Querier, publicID string) (*db.LineItem, error) {
+	id, err := idByPublicID(database, "line_items", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetLineItemByID(database, id)
+}
+
+func UpdateLineItem(database db.Querier, lineItem db.LineItem) error {
 	if err := lineItem.Valid(); err != nil {
 		return err
 	}
+	if _, err := CheckLineItemTaxeRate(database, lineItem); err != nil {
+		return err
+	}
 
 	sqlQuery := `UPDATE line_items SET
                     expense_id = ?,
@@ -108,7 +125,8 @@ func UpdateLineItem(database *sql.DB, lineItem db.LineItem) error {
         lineItem.ID,
     )
 	if err != nil {
-		return utils.LogError(
+		return utils.WrapError(
+            db.WriteConstraintKind(err), err,
             "unable to update line item: %v, error: %v", lineItem, err,
         )
 	}
@@ -119,16 +137,16 @@ func UpdateLineItem(database *sql.DB, lineItem db.LineItem) error {
 	}
 
 	if rowsAffected == 0 {
-		return utils.LogError("no line item found with ID: %d", lineItem.ID)
+		return utils.NotFoundError("no line item found with ID: %d", lineItem.ID)
 	}
 
-	log.Printf("[info] line item (ID: %v) updated", lineItem.ID)
+	slog.Info("line item updated", "id", lineItem.ID)
 	return nil
 }
 
-func DeleteLineItemByID(database *sql.DB, id int64) error {
+func DeleteLineItemByID(database db.Querier, id int64) error {
 	if id <= 0 {
-		return utils.LogError("line item ID must be positive and non-zero")
+		return utils.InvalidIDError("id", "line item ID must be positive and non-zero")
 	}
 
 	sqlQuery := "DELETE FROM line_items WHERE id = ?"
@@ -140,7 +158,8 @@ func DeleteLineItemByID(database *sql.DB, id int64) error {
 
 	res, err := stmt.Exec(id)
 	if err != nil {
-		return utils.LogError(
+		return utils.WrapError(
+            db.ConstraintKind(err), err,
             "unable to delete line item with ID: %v, error: %v", id, err,
         )
 	}
@@ -150,9 +169,78 @@ func DeleteLineItemByID(database *sql.DB, id int64) error {
 		return utils.LogError("failed to check affected rows: %v", err)
 	}
 	if rowsAffected == 0 {
-		return utils.LogError("no line item found with ID: %d", id)
+		return utils.NotFoundError("no line item found with ID: %d", id)
 	}
 
-	log.Printf("[info] line item (ID: %v) deleted", id)
+	slog.Info("line item deleted", "id", id)
 	return nil
 }
+
+func ListLineItems(database db.Querier) (db.LineItemList, error) {
+	return queryLineItems(
+        database,
+        "SELECT id, public_id, expense_id, taxe_rate, total FROM line_items ORDER BY id",
+    )
+}
+
+func ListLineItemsByExpenseID(database db.Querier, expenseID int64) (
+    db.LineItemList, error,
+) {
+	return queryLineItems(
+        database,
+        `SELECT id, public_id, expense_id, taxe_rate, total
+        FROM line_items WHERE expense_id = ? ORDER BY id`,
+        expenseID,
+    )
+}
+
+// Line items of several expenses at once, by expense then ID
+func ListLineItemsByExpenseIDs(database db.Querier, expenseIDs []int64) (
+    db.LineItemList, error,
+) {
+	if len(expenseIDs) == 0 {
+		return make(db.LineItemList, 0), nil
+	}
+	return queryLineItems(
+        database,
+        `SELECT id, public_id, expense_id, taxe_rate, total
+        FROM line_items WHERE expense_id IN (` + idPlaceholders(expenseIDs) + `)
+        ORDER BY expense_id, id`,
+        idArgs(expenseIDs)...,
+    )
+}
+
+func queryLineItems(database db.Querier, sqlQuery string, args ...any) (
+    db.LineItemList, error,
+) {
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	lineItems := make(db.LineItemList, 0)
+	for rows.Next() {
+		var lineItem db.LineItem
+		err := rows.Scan(
+            &lineItem.ID,
+            &lineItem.PublicID,
+            &lineItem.ExpenseID,
+            &lineItem.TaxeRate,
+            &lineItem.Total,
+        )
+		if err != nil {
+			return nil, utils.LogError("failed to scan line item: %v", err)
+		}
+		if err := lineItem.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		lineItems = append(lineItems, lineItem)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list line items: %v", err)
+	}
+	return lineItems, nil
+}
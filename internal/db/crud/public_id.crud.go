@@ -0,0 +1,33 @@
+package crud
+
+import (
+	"database/sql"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// ID of the row of table having publicID, see db.ValidPublicID
+func idByPublicID(database db.Querier, table string, publicID string) (int64, error) {
+	if err := db.ValidPublicID(publicID); err != nil {
+		return 0, err
+	}
+
+	sqlQuery := "SELECT id FROM " + table + " WHERE public_id = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return 0, utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	var id int64
+	err = stmt.QueryRow(publicID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, utils.NotFoundError("no row of %s with public ID: %v", table, publicID)
+		}
+		return 0, utils.LogError("failed to fetch %s by public ID: %v", table, err)
+	}
+	return id, nil
+}
@@ -0,0 +1,253 @@
+package crud
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+// The receipt goes after the ones already attached to its expense,
+// receipt.Position is ignored (see UpdateReceipt to reorder)
+func CreateReceipt(database db.Querier, receipt db.Receipt) (int64, error) {
+	if err := receipt.PreInsertValid(); err != nil {
+		return 0, err
+	}
+
+	sqlQuery := `INSERT INTO receipts(
+                    expense_id,
+                    rel_path,
+                    position
+                ) VALUES (?, ?, (
+                    SELECT COALESCE(MAX(position) + 1, 0)
+                    FROM receipts WHERE expense_id = ?
+                ))`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return 0, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(receipt.ExpenseID, receipt.RelPath, receipt.ExpenseID)
+	if err != nil {
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to create receipt: %v, error: %v",
+			receipt, err,
+		)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, utils.LogError(
+			"new receipt created, but failed to get last inserted ID: %v, error: %v",
+			receipt, err,
+		)
+	}
+
+	slog.Info("new receipt created", "id", id)
+	return id, nil
+}
+
+func GetReceiptByID(database db.Querier, id int64) (*db.Receipt, error) {
+	sqlQuery := `SELECT
+                    id,
+                    public_id,
+                    expense_id,
+                    rel_path,
+                    position
+                FROM receipts WHERE id = ?`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	var receipt db.Receipt
+	err = stmt.QueryRow(id).Scan(
+        &receipt.ID,
+        &receipt.PublicID,
+        &receipt.ExpenseID,
+        &receipt.RelPath,
+        &receipt.Position,
+    )
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, utils.NotFoundError("receipt not found (ID: %d)", id)
+		}
+		return nil, utils.LogError("failed to fetch receipt by ID: %v", err)
+	}
+
+	if err := receipt.Valid(); err != nil {
+		return nil, err // Integrity of data is breached
+	}
+	return &receipt, nil
+}
+
+func GetReceiptByPublicID(database db.Querier, publicID string) (*db.Receipt, error) {
+	id, err := idByPublicID(database, "receipts", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetReceiptByID(database, id)
+}
+
+func UpdateReceipt(database db.Querier, receipt db.Receipt) error {
+	if err := receipt.Valid(); err != nil {
+		return err
+	}
+
+	sqlQuery := `UPDATE receipts SET
+                    expense_id = ?,
+                    rel_path = ?,
+                    position = ?
+                WHERE id = ?`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(
+        receipt.ExpenseID,
+        receipt.RelPath,
+        receipt.Position,
+        receipt.ID,
+    )
+	if err != nil {
+		return utils.WrapError(
+            db.WriteConstraintKind(err), err,
+            "unable to update receipt: %v, error: %v", receipt, err,
+        )
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return utils.NotFoundError("no receipt found with ID: %d", receipt.ID)
+	}
+
+	slog.Info("receipt updated", "id", receipt.ID)
+	return nil
+}
+
+// The file stays in config.ReceiptsDir, other expenses may use it
+func DeleteReceiptByID(database db.Querier, id int64) error {
+	if id <= 0 {
+		return utils.InvalidIDError("id", "receipt ID must be positive and non-zero")
+	}
+
+	sqlQuery := "DELETE FROM receipts WHERE id = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(id)
+	if err != nil {
+		return utils.WrapError(
+            db.ConstraintKind(err), err,
+            "unable to delete receipt with ID: %v, error: %v", id, err,
+        )
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return utils.NotFoundError("no receipt found with ID: %d", id)
+	}
+
+	slog.Info("receipt deleted", "id", id)
+	return nil
+}
+
+func ListReceipts(database db.Querier) (db.ReceiptList, error) {
+	return queryReceipts(
+        database,
+        `SELECT id, public_id, expense_id, rel_path, position
+        FROM receipts ORDER BY expense_id, position, id`,
+    )
+}
+
+func ListReceiptsByExpenseID(database db.Querier, expenseID int64) (
+    db.ReceiptList, error,
+) {
+	return queryReceipts(
+        database,
+        `SELECT id, public_id, expense_id, rel_path, position
+        FROM receipts WHERE expense_id = ? ORDER BY position, id`,
+        expenseID,
+    )
+}
+
+// Receipts of several expenses at once, by expense then position
+func ListReceiptsByExpenseIDs(database db.Querier, expenseIDs []int64) (
+    db.ReceiptList, error,
+) {
+	if len(expenseIDs) == 0 {
+		return make(db.ReceiptList, 0), nil
+	}
+	return queryReceipts(
+        database,
+        `SELECT id, public_id, expense_id, rel_path, position
+        FROM receipts WHERE expense_id IN (` + idPlaceholders(expenseIDs) + `)
+        ORDER BY expense_id, position, id`,
+        idArgs(expenseIDs)...,
+    )
+}
+
+// Expenses sharing a stored file, see db.StoreReceipt
+func ListReceiptsByRelPath(database db.Querier, relPath string) (db.ReceiptList, error) {
+	return queryReceipts(
+        database,
+        `SELECT id, public_id, expense_id, rel_path, position
+        FROM receipts WHERE rel_path = ? ORDER BY expense_id, position, id`,
+        relPath,
+    )
+}
+
+func queryReceipts(database db.Querier, sqlQuery string, args ...any) (
+    db.ReceiptList, error,
+) {
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	receipts := make(db.ReceiptList, 0)
+	for rows.Next() {
+		var receipt db.Receipt
+		err := rows.Scan(
+            &receipt.ID,
+            &receipt.PublicID,
+            &receipt.ExpenseID,
+            &receipt.RelPath,
+            &receipt.Position,
+        )
+		if err != nil {
+			return nil, utils.LogError("failed to scan receipt: %v", err)
+		}
+		if err := receipt.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		receipts = append(receipts, receipt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list receipts: %v", err)
+	}
+	return receipts, nil
+}
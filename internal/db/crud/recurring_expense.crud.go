@@ -0,0 +1,338 @@
+package crud
+
+import (
+	"log/slog"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/logging"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+const recurringExpenseColumns = `id,
+                    public_id,
+                    name,
+                    type_id,
+                    currency,
+                    line_items,
+                    notes,
+                    country,
+                    session_rule,
+                    session_id,
+                    client_id,
+                    schedule,
+                    start_date`
+
+func CreateRecurringExpense(database db.Querier, recurring db.RecurringExpense) (int64, error) {
+	if err := recurring.PreInsertValid(); err != nil {
+		return 0, err
+	}
+	existing, err := GetRecurringExpenseByName(database, recurring.Name)
+	if err != nil {
+		return 0, err
+	}
+	if existing != nil {
+		return 0, utils.ConflictError(
+			"recurring expense name already exists: %s", logging.UserValue(existing.Name),
+		)
+	}
+
+	sqlQuery := `INSERT INTO recurring_expenses(
+                    name,
+                    type_id,
+                    currency,
+                    line_items,
+                    notes,
+                    country,
+                    session_rule,
+                    session_id,
+                    client_id,
+                    schedule,
+                    start_date
+                ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return 0, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(
+		recurring.Name,
+		recurring.TypeID,
+		recurring.Currency,
+		recurring.LineItems,
+		recurring.Notes,
+		recurring.Country,
+		recurring.SessionRule,
+		recurring.SessionID,
+		recurring.ClientID,
+		recurring.Schedule,
+		recurring.StartDate,
+	)
+	if err != nil {
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to create recurring expense: %v, error: %v", recurring, err,
+		)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, utils.LogError(
+			"new recurring expense created, but failed to get last inserted ID: %v, error: %v",
+			recurring, err,
+		)
+	}
+
+	slog.Info("new recurring expense created", "id", id)
+	return id, nil
+}
+
+func GetRecurringExpenseByID(database db.Querier, id int64) (*db.RecurringExpense, error) {
+	recurrings, err := queryRecurringExpenses(
+		database, "SELECT " + recurringExpenseColumns + " FROM recurring_expenses WHERE id = ?", id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(recurrings) == 0 {
+		return nil, utils.NotFoundError("recurring expense not found (ID: %d)", id)
+	}
+	return &recurrings[0], nil
+}
+
+func GetRecurringExpenseByPublicID(database db.Querier, publicID string) (*db.RecurringExpense, error) {
+	id, err := idByPublicID(database, "recurring_expenses", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetRecurringExpenseByID(database, id)
+}
+
+// Case insensitive, nil when not found
+func GetRecurringExpenseByName(database db.Querier, name string) (*db.RecurringExpense, error) {
+	recurrings, err := queryRecurringExpenses(
+		database, "SELECT " + recurringExpenseColumns + " FROM recurring_expenses WHERE name = ?", name,
+	)
+	if err != nil || len(recurrings) == 0 {
+		return nil, err
+	}
+	return &recurrings[0], nil
+}
+
+// Occurrences already generated are kept, a new schedule only applies to the
+// dates not generated yet
+func UpdateRecurringExpense(database db.Querier, recurring db.RecurringExpense) error {
+	if err := recurring.Valid(); err != nil {
+		return err
+	}
+	existing, err := GetRecurringExpenseByName(database, recurring.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != recurring.ID {
+		return utils.ConflictError(
+			"recurring expense name already exists: %s", logging.UserValue(existing.Name),
+		)
+	}
+
+	sqlQuery := `UPDATE recurring_expenses SET
+                    name = ?,
+                    type_id = ?,
+                    currency = ?,
+                    line_items = ?,
+                    notes = ?,
+                    country = ?,
+                    session_rule = ?,
+                    session_id = ?,
+                    client_id = ?,
+                    schedule = ?,
+                    start_date = ?
+                WHERE id = ?`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(
+		recurring.Name,
+		recurring.TypeID,
+		recurring.Currency,
+		recurring.LineItems,
+		recurring.Notes,
+		recurring.Country,
+		recurring.SessionRule,
+		recurring.SessionID,
+		recurring.ClientID,
+		recurring.Schedule,
+		recurring.StartDate,
+		recurring.ID,
+	)
+	if err != nil {
+		return utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to update recurring expense: %v, error: %v", recurring, err,
+		)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return utils.NotFoundError("no recurring expense found with ID: %d", recurring.ID)
+	}
+
+	slog.Info("recurring expense updated", "id", recurring.ID)
+	return nil
+}
+
+// Generated expenses are kept, their occurrences go with it (trigger
+// recurring_expenses_delete_occurrences)
+func DeleteRecurringExpenseByID(database db.Querier, id int64) error {
+	if id <= 0 {
+		return utils.InvalidIDError("id", "recurring expense ID must be positive and non-zero")
+	}
+
+	sqlQuery := "DELETE FROM recurring_expenses WHERE id = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(id)
+	if err != nil {
+		return utils.WrapError(
+            db.ConstraintKind(err), err,
+            "unable to delete recurring expense with ID: %v, error: %v", id, err,
+        )
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return utils.NotFoundError("no recurring expense found with ID: %d", id)
+	}
+
+	slog.Info("recurring expense deleted", "id", id)
+	return nil
+}
+
+func ListRecurringExpenses(database db.Querier) ([]db.RecurringExpense, error) {
+	return queryRecurringExpenses(
+		database, "SELECT " + recurringExpenseColumns + " FROM recurring_expenses ORDER BY name",
+	)
+}
+
+func queryRecurringExpenses(database db.Querier, sqlQuery string, args ...any) (
+    []db.RecurringExpense, error,
+) {
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	recurrings := make([]db.RecurringExpense, 0)
+	for rows.Next() {
+		var recurring db.RecurringExpense
+		err := rows.Scan(
+            &recurring.ID,
+            &recurring.PublicID,
+            &recurring.Name,
+            &recurring.TypeID,
+            &recurring.Currency,
+            &recurring.LineItems,
+            &recurring.Notes,
+            &recurring.Country,
+            &recurring.SessionRule,
+            &recurring.SessionID,
+            &recurring.ClientID,
+            &recurring.Schedule,
+            &recurring.StartDate,
+        )
+		if err != nil {
+			return nil, utils.LogError("failed to scan recurring expense: %v", err)
+		}
+		if err := recurring.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		recurrings = append(recurrings, recurring)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list recurring expenses: %v", err)
+	}
+	return recurrings, nil
+}
+
+// Fails when the date was already generated
+func CreateRecurringOccurrence(database db.Querier, occurrence db.RecurringOccurrence) error {
+	if err := occurrence.PreInsertValid(); err != nil {
+		return err
+	}
+
+	sqlQuery := `INSERT INTO recurring_occurrences(
+                    recurring_expense_id,
+                    date_only,
+                    expense_id
+                ) VALUES (?, ?, ?)`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(occurrence.RecurringExpenseID, occurrence.DateOnly, occurrence.ExpenseID)
+	if err != nil {
+		return utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to create recurring occurrence: %v, error: %v", occurrence, err,
+		)
+	}
+
+	slog.Info(
+		"recurring expense occurrence recorded",
+		"id", occurrence.RecurringExpenseID, "date", occurrence.DateOnly,
+	)
+	return nil
+}
+
+// Sorted by date
+func ListRecurringOccurrences(database db.Querier, recurringExpenseID int64) (
+    []db.RecurringOccurrence, error,
+) {
+	sqlQuery := `SELECT recurring_expense_id, date_only, expense_id
+                FROM recurring_occurrences
+                WHERE recurring_expense_id = ? ORDER BY date_only`
+	rows, err := database.Query(sqlQuery, recurringExpenseID)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	occurrences := make([]db.RecurringOccurrence, 0)
+	for rows.Next() {
+		var occurrence db.RecurringOccurrence
+		err := rows.Scan(&occurrence.RecurringExpenseID, &occurrence.DateOnly, &occurrence.ExpenseID)
+		if err != nil {
+			return nil, utils.LogError("failed to scan recurring occurrence: %v", err)
+		}
+		if err := occurrence.PreInsertValid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list recurring occurrences: %v", err)
+	}
+	return occurrences, nil
+}
@@ -2,14 +2,15 @@ package crud
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/craftidev/expenseflow/internal/db"
 	"github.com/craftidev/expenseflow/internal/utils"
 )
 
 
-func CreateSession(database *sql.DB, session db.Session) (int64, error) {
+func CreateSession(database db.Querier, session db.Session) (int64, error) {
     if err := session.PreInsertValid(); err != nil {
         return 0, err
     }
@@ -21,8 +22,9 @@ func CreateSession(database *sql.DB, session db.Session) (int64, error) {
             trip_start_location,
             trip_end_location,
             start_at_date_time,
-            end_at_date_time
-        ) VALUES (?, ?, ?, ?, ?, ?)`
+            end_at_date_time,
+            time_zone
+        ) VALUES (?, ?, ?, ?, ?, ?, ?)`
     stmt, err := database.Prepare(sqlQuery)
     if err != nil {
         return 0, utils.LogError(
@@ -38,9 +40,11 @@ func CreateSession(database *sql.DB, session db.Session) (int64, error) {
         session.TripEndLocation,
         session.StartAtDateTime,
         session.EndAtDateTime,
+        session.TimeZone,
     )
     if err != nil {
-        return 0, utils.LogError(
+        return 0, utils.WrapError(
+            db.WriteConstraintKind(err), err,
             "unable to create session: %v, error: %v",
             session, err,
         )
@@ -54,19 +58,21 @@ func CreateSession(database *sql.DB, session db.Session) (int64, error) {
         )
     }
 
-    log.Printf("[info] new session (ID: %v) created", id)
+    slog.Info("new session created", "id", id)
     return id, nil
 }
 
-func GetSessionByID(database *sql.DB, id int64) (*db.Session, error) {
+func GetSessionByID(database db.Querier, id int64) (*db.Session, error) {
     sqlQuery := `SELECT
                     id,
+                    public_id,
                     client_id,
                     location,
                     trip_start_location,
                     trip_end_location,
                     start_at_date_time,
-                    end_at_date_time
+                    end_at_date_time,
+                    time_zone
                 FROM sessions WHERE id = ?`
     stmt, err := database.Prepare(sqlQuery)
     if err != nil {
@@ -81,16 +87,18 @@ func GetSessionByID(database *sql.DB, id int64) (*db.Session, error) {
     var endAtDateTime sql.NullString
     err = stmt.QueryRow(id).Scan(
         &session.ID,
+        &session.PublicID,
         &session.ClientID,
         &session.Location,
         &session.TripStartLocation,
         &session.TripEndLocation,
         &startAtDateTime,
         &endAtDateTime,
+        &session.TimeZone,
     )
     if err != nil {
         if err == sql.ErrNoRows {
-            return nil, utils.LogError("session not found (ID: %d)", id)
+            return nil, utils.NotFoundError("session not found (ID: %d)", id)
         }
         return nil, utils.LogError("failed to fetch session by ID: %v", err)
     }
@@ -110,7 +118,15 @@ func GetSessionByID(database *sql.DB, id int64) (*db.Session, error) {
 	return &session, nil
 }
 
-func UpdateSession(database *sql.DB, session db.Session) error {
+func GetSessionByPublicID(database db.Querier, publicID string) (*db.Session, error) {
+	id, err := idByPublicID(database, "sessions", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetSessionByID(database, id)
+}
+
+func UpdateSession(database db.Querier, session db.Session) error {
 	if err := session.Valid(); err != nil {
 		return err
 	}
@@ -121,7 +137,8 @@ func UpdateSession(database *sql.DB, session db.Session) error {
                     trip_start_location = ?,
                     trip_end_location = ?,
                     start_at_date_time = ?,
-                    end_at_date_time = ?
+                    end_at_date_time = ?,
+                    time_zone = ?
                 WHERE id = ?`
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
@@ -136,10 +153,14 @@ func UpdateSession(database *sql.DB, session db.Session) error {
         session.TripEndLocation,
         session.StartAtDateTime,
         session.EndAtDateTime,
+        session.TimeZone,
         session.ID,
     )
 	if err != nil {
-		return utils.LogError("unable to update session: %v, error: %v", session, err)
+		return utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to update session: %v, error: %v", session, err,
+		)
 	}
 
 	rowsAffected, err := res.RowsAffected()
@@ -148,29 +169,18 @@ func UpdateSession(database *sql.DB, session db.Session) error {
 	}
 
 	if rowsAffected == 0 {
-		return utils.LogError("no session found with ID: %d", session.ID)
+		return utils.NotFoundError("no session found with ID: %d", session.ID)
 	}
 
-	log.Printf("[info] session (ID: %v) updated", session.ID)
+	slog.Info("session updated", "id", session.ID)
 	return nil
 }
 
-func DeleteSessionByID(database *sql.DB, id int64) error {
+func DeleteSessionByID(database db.Querier, id int64) error {
 	if id <= 0 {
-		return utils.LogError("session ID must be positive and non-zero")
+		return utils.InvalidIDError("id", "session ID must be positive and non-zero")
 	}
 
-    ok, err := sessionIsNotRefAsAnFK(database, id)
-    if err != nil {
-        return err
-    }
-    if !ok {
-        return utils.LogError(
-            "session (ID: %d) is still referenced by car trips or expenses",
-            id,
-        )
-    }
-
 	sqlQuery := "DELETE FROM sessions WHERE id = ?"
 	stmt, err := database.Prepare(sqlQuery)
 	if err != nil {
@@ -179,8 +189,19 @@ func DeleteSessionByID(database *sql.DB, id int64) error {
 	defer stmt.Close()
 
 	res, err := stmt.Exec(id)
+	if kind := db.ConstraintKind(err); kind == utils.ErrReferenced {
+		return utils.WrapError(
+			kind, err,
+			"session (ID: %d) is still referenced by car trips, expenses, " +
+			"recurring expenses or expense allocations",
+			id,
+		)
+	}
 	if err != nil {
-		return utils.LogError("unable to delete session with ID: %v, error: %v", id, err)
+		return utils.WrapError(
+			db.ConstraintKind(err), err,
+			"unable to delete session with ID: %v, error: %v", id, err,
+		)
 	}
 
 	rowsAffected, err := res.RowsAffected()
@@ -188,37 +209,95 @@ func DeleteSessionByID(database *sql.DB, id int64) error {
 		return utils.LogError("failed to check affected rows: %v", err)
 	}
 	if rowsAffected == 0 {
-		return utils.LogError("no session found with ID: %d", id)
+		return utils.NotFoundError("no session found with ID: %d", id)
 	}
 
-	log.Printf("[info] session (ID: %v) deleted", id)
+	slog.Info("session deleted", "id", id)
 	return nil
 }
 
-func sessionIsNotRefAsAnFK(database *sql.DB, id int64) (bool, error) {
-	sqlQuery := `
-    SELECT COUNT(*) FROM (
-        SELECT session_id FROM car_trips WHERE session_id = ?
-        UNION ALL
-        SELECT session_id FROM expenses WHERE session_id = ?
-    )`
+const sessionColumns = `id,
+                    public_id,
+                    client_id,
+                    location,
+                    trip_start_location,
+                    trip_end_location,
+                    start_at_date_time,
+                    end_at_date_time,
+                    time_zone`
+
+func ListSessions(database db.Querier) ([]db.Session, error) {
+    return querySessions(database, "SELECT " + sessionColumns + " FROM sessions ORDER BY id")
+}
 
-	stmt, err := database.Prepare(sqlQuery)
-	if err != nil {
-		return false, utils.LogError(
+func ListSessionsByFilter(database db.Querier, filter AttributeFilter) ([]db.Session, error) {
+    conditions, args := filter.conditions(db.CustomFieldOnSession)
+    return querySessions(
+        database,
+        "SELECT " + sessionColumns + " FROM sessions" + whereClause(conditions) + " ORDER BY id",
+        args...,
+    )
+}
+
+// Started sessions that may have local days in [from, to), dates as midnight
+// UTC, oldest first: a local date is at most a day away from the UTC one,
+// callers keep the exact days (see db.Session.LocalTimes)
+func ListSessionsBetween(database db.Querier, from time.Time, to time.Time) ([]db.Session, error) {
+    return querySessions(
+        database,
+        "SELECT " + sessionColumns + ` FROM sessions
+        WHERE start_at_date_time < ?
+            AND (end_at_date_time IS NULL OR end_at_date_time >= ?)
+        ORDER BY start_at_date_time, id`,
+        db.FormatTimestamp(to.AddDate(0, 0, 1)), db.FormatTimestamp(from.AddDate(0, 0, -1)),
+    )
+}
+
+func querySessions(database db.Querier, sqlQuery string, args ...any) ([]db.Session, error) {
+    rows, err := database.Query(sqlQuery, args...)
+    if err != nil {
+        return nil, utils.LogError(
             "rejected querry: %v, error: %v", sqlQuery, err,
         )
-	}
-	defer stmt.Close()
+    }
+    defer rows.Close()
 
-	var count int
-	err = stmt.QueryRow(id, id).Scan(&count)
-	if err != nil {
-		return false, utils.LogError(
-            "failed to count sessions with session ID: %v, error: %v",
-            id, err,
+    sessions := make([]db.Session, 0)
+    for rows.Next() {
+        var session db.Session
+        var startAtDateTime sql.NullString
+        var endAtDateTime sql.NullString
+        err := rows.Scan(
+            &session.ID,
+            &session.PublicID,
+            &session.ClientID,
+            &session.Location,
+            &session.TripStartLocation,
+            &session.TripEndLocation,
+            &startAtDateTime,
+            &endAtDateTime,
+            &session.TimeZone,
         )
-	}
+        if err != nil {
+            return nil, utils.LogError("failed to scan session: %v", err)
+        }
 
-	return count == 0, nil
+        session.StartAtDateTime, err = ParsingNullableStrToTime(startAtDateTime)
+        if err != nil {
+            return nil, err
+        }
+        session.EndAtDateTime, err = ParsingNullableStrToTime(endAtDateTime)
+        if err != nil {
+            return nil, err
+        }
+
+        if err := session.Valid(); err != nil {
+            return nil, err // Integrity of data is breached
+        }
+        sessions = append(sessions, session)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, utils.LogError("failed to list sessions: %v", err)
+    }
+    return sessions, nil
 }
@@ -0,0 +1,354 @@
+package crud
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/logging"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+func CreateTag(database db.Querier, tag db.Tag) (int64, error) {
+	if err := tag.PreInsertValid(); err != nil {
+		return 0, err
+	}
+	existing, err := GetTagByName(database, tag.Name)
+	if err != nil {
+		return 0, err
+	}
+	if existing != nil {
+		return 0, utils.ConflictError("tag name already exists: %s", logging.UserValue(existing.Name))
+	}
+
+	sqlQuery := "INSERT INTO tags(name) VALUES (?)"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return 0, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(tag.Name)
+	if err != nil {
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to create tag: %v, error: %v", tag, err,
+		)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, utils.LogError(
+			"new tag created, but failed to get last inserted ID: %v, error: %v",
+			tag, err,
+		)
+	}
+
+	slog.Info("new tag created", "id", id)
+	return id, nil
+}
+
+// The existing tag, or a new one
+func GetOrCreateTag(database db.Querier, name string) (*db.Tag, error) {
+	tag, err := GetTagByName(database, name)
+	if err != nil || tag != nil {
+		return tag, err
+	}
+	id, err := CreateTag(database, db.Tag{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	return &db.Tag{ID: id, Name: name}, nil
+}
+
+func GetTagByID(database db.Querier, id int64) (*db.Tag, error) {
+	sqlQuery := "SELECT id, public_id, name FROM tags WHERE id = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	var tag db.Tag
+	err = stmt.QueryRow(id).Scan(&tag.ID, &tag.PublicID, &tag.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, utils.NotFoundError("tag not found (ID: %d)", id)
+		}
+		return nil, utils.LogError("failed to fetch tag by ID: %v", err)
+	}
+
+	if err := tag.Valid(); err != nil {
+		return nil, err // Integrity of data is breached
+	}
+	return &tag, nil
+}
+
+func GetTagByPublicID(database db.Querier, publicID string) (*db.Tag, error) {
+	id, err := idByPublicID(database, "tags", publicID)
+	if err != nil {
+		return nil, err
+	}
+	return GetTagByID(database, id)
+}
+
+// Case insensitive, nil when not found
+func GetTagByName(database db.Querier, name string) (*db.Tag, error) {
+	sqlQuery := "SELECT id, public_id, name FROM tags WHERE name = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	var tag db.Tag
+	err = stmt.QueryRow(name).Scan(&tag.ID, &tag.PublicID, &tag.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, utils.LogError("failed to fetch tag by name: %v", err)
+	}
+
+	if err := tag.Valid(); err != nil {
+		return nil, err // Integrity of data is breached
+	}
+	return &tag, nil
+}
+
+func UpdateTag(database db.Querier, tag db.Tag) error {
+	if err := tag.Valid(); err != nil {
+		return err
+	}
+	existing, err := GetTagByName(database, tag.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != tag.ID {
+		return utils.ConflictError("tag name already exists: %s", logging.UserValue(existing.Name))
+	}
+
+	sqlQuery := "UPDATE tags SET name = ? WHERE id = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(tag.Name, tag.ID)
+	if err != nil {
+		return utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to update tag: %v, error: %v", tag, err,
+		)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return utils.NotFoundError("no tag found with ID: %d", tag.ID)
+	}
+
+	slog.Info("tag updated", "id", tag.ID)
+	return nil
+}
+
+// Expenses and sessions lose the tag (trigger tags_delete_links)
+func DeleteTagByID(database db.Querier, id int64) error {
+	if id <= 0 {
+		return utils.InvalidIDError("id", "tag ID must be positive and non-zero")
+	}
+
+	sqlQuery := "DELETE FROM tags WHERE id = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(id)
+	if err != nil {
+		return utils.WrapError(
+            db.ConstraintKind(err), err,
+            "unable to delete tag with ID: %v, error: %v", id, err,
+        )
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return utils.NotFoundError("no tag found with ID: %d", id)
+	}
+
+	slog.Info("tag deleted", "id", id)
+	return nil
+}
+
+func ListTags(database db.Querier) ([]db.Tag, error) {
+	return queryTags(database, "SELECT id, public_id, name FROM tags ORDER BY name")
+}
+
+func ListTagsByExpenseID(database db.Querier, expenseID int64) ([]db.Tag, error) {
+	return queryTags(
+        database,
+        `SELECT tags.id, tags.public_id, tags.name FROM tags
+        JOIN expense_tags ON expense_tags.tag_id = tags.id
+        WHERE expense_tags.expense_id = ? ORDER BY tags.name`,
+        expenseID,
+    )
+}
+
+func ListTagsBySessionID(database db.Querier, sessionID int64) ([]db.Tag, error) {
+	return queryTags(
+        database,
+        `SELECT tags.id, tags.public_id, tags.name FROM tags
+        JOIN session_tags ON session_tags.tag_id = tags.id
+        WHERE session_tags.session_id = ? ORDER BY tags.name`,
+        sessionID,
+    )
+}
+
+func queryTags(database db.Querier, sqlQuery string, args ...any) ([]db.Tag, error) {
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	tags := make([]db.Tag, 0)
+	for rows.Next() {
+		var tag db.Tag
+		if err := rows.Scan(&tag.ID, &tag.PublicID, &tag.Name); err != nil {
+			return nil, utils.LogError("failed to scan tag: %v", err)
+		}
+		if err := tag.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list tags: %v", err)
+	}
+	return tags, nil
+}
+
+// Tagging twice is a no-op
+func AddExpenseTag(database db.Querier, expenseID int64, tagID int64) error {
+	return linkTag(database, db.CustomFieldOnExpense, expenseID, tagID)
+}
+
+func RemoveExpenseTag(database db.Querier, expenseID int64, tagID int64) error {
+	return unlinkTag(database, db.CustomFieldOnExpense, expenseID, tagID)
+}
+
+func AddSessionTag(database db.Querier, sessionID int64, tagID int64) error {
+	return linkTag(database, db.CustomFieldOnSession, sessionID, tagID)
+}
+
+func RemoveSessionTag(database db.Querier, sessionID int64, tagID int64) error {
+	return unlinkTag(database, db.CustomFieldOnSession, sessionID, tagID)
+}
+
+// Tag names of every tagged expense, by expense ID
+func MapExpenseTagNames(database db.Querier) (map[int64][]string, error) {
+	return mapTagNames(database, db.CustomFieldOnExpense)
+}
+
+// Tag names of every tagged session, by session ID
+func MapSessionTagNames(database db.Querier) (map[int64][]string, error) {
+	return mapTagNames(database, db.CustomFieldOnSession)
+}
+
+// kind is expense or session (same constants as custom fields), the links
+// are in <kind>_tags
+func linkTag(database db.Querier, kind string, entityID int64, tagID int64) error {
+	v := utils.Validator{}
+	v.Positive("entity_id", float64(entityID))
+	v.Positive("tag_id", float64(tagID))
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	sqlQuery := "INSERT OR IGNORE INTO " + kind + "_tags(" + kind + "_id, tag_id) VALUES (?, ?)"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(entityID, tagID); err != nil {
+		return utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to tag %v (ID: %v) with tag (ID: %v), error: %v",
+			kind, entityID, tagID, err,
+		)
+	}
+	slog.Info("tag added", "id", tagID, "kind", kind, "entity_id", entityID)
+	return nil
+}
+
+func unlinkTag(database db.Querier, kind string, entityID int64, tagID int64) error {
+	sqlQuery := "DELETE FROM " + kind + "_tags WHERE " + kind + "_id = ? AND tag_id = ?"
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(entityID, tagID)
+	if err != nil {
+		return utils.WrapError(
+			db.ConstraintKind(err), err,
+			"unable to remove tag (ID: %v) from %v (ID: %v), error: %v",
+			tagID, kind, entityID, err,
+		)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return utils.LogError("failed to check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return utils.NotFoundError("%v (ID: %v) has no tag (ID: %d)", kind, entityID, tagID)
+	}
+
+	slog.Info("tag removed", "id", tagID, "kind", kind, "entity_id", entityID)
+	return nil
+}
+
+func mapTagNames(database db.Querier, kind string) (map[int64][]string, error) {
+	sqlQuery := "SELECT links." + kind + "_id, tags.name FROM " + kind + "_tags AS links " +
+		"JOIN tags ON tags.id = links.tag_id ORDER BY tags.name"
+	rows, err := database.Query(sqlQuery)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	names := make(map[int64][]string)
+	for rows.Next() {
+		var entityID int64
+		var name string
+		if err := rows.Scan(&entityID, &name); err != nil {
+			return nil, utils.LogError("failed to scan tag: %v", err)
+		}
+		names[entityID] = append(names[entityID], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list tags: %v", err)
+	}
+	return names, nil
+}
@@ -0,0 +1,181 @@
+package crud
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+func CreateTaxRate(database db.Querier, taxRate db.TaxRate) (int64, error) {
+	if err := taxRate.PreInsertValid(); err != nil {
+		return 0, err
+	}
+
+	sqlQuery := `INSERT INTO tax_rates(
+                    country,
+                    label,
+                    rate,
+                    valid_from,
+                    valid_to
+                ) VALUES (?, ?, ?, ?, ?)`
+	stmt, err := database.Prepare(sqlQuery)
+	if err != nil {
+		return 0, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(
+        taxRate.Country,
+        taxRate.Label,
+        taxRate.Rate,
+        taxRate.ValidFrom,
+        taxRate.ValidTo,
+    )
+	if err != nil {
+		return 0, utils.WrapError(
+			db.WriteConstraintKind(err), err,
+			"unable to create tax rate: %v, error: %v",
+			taxRate, err,
+		)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, utils.LogError(
+			"new tax rate created, but failed to get last inserted ID: %v, error: %v",
+			taxRate, err,
+		)
+	}
+
+	slog.Info("new tax rate created", "id", id)
+	return id, nil
+}
+
+// Every known rate of a country, all countries when country is empty
+func ListTaxRates(database db.Querier, country string) ([]db.TaxRate, error) {
+	return queryTaxRates(
+        database,
+        `SELECT ` + taxRateColumns + ` FROM tax_rates
+        WHERE ? = '' OR country = ?
+        ORDER BY country, rate DESC, valid_from`,
+        country, country,
+    )
+}
+
+func GetTaxRateByPublicID(database db.Querier, publicID string) (*db.TaxRate, error) {
+	if err := db.ValidPublicID(publicID); err != nil {
+		return nil, err
+	}
+	taxRates, err := queryTaxRates(
+        database, "SELECT " + taxRateColumns + " FROM tax_rates WHERE public_id = ?", publicID,
+    )
+	if err != nil {
+		return nil, err
+	}
+	if len(taxRates) == 0 {
+		return nil, utils.NotFoundError("tax rate not found (public ID: %v)", publicID)
+	}
+	return &taxRates[0], nil
+}
+
+const taxRateColumns = "id, public_id, country, label, rate, valid_from, valid_to"
+
+func queryTaxRates(database db.Querier, sqlQuery string, args ...any) ([]db.TaxRate, error) {
+	rows, err := database.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, utils.LogError(
+			"rejected querry: %v, error: %v", sqlQuery, err,
+		)
+	}
+	defer rows.Close()
+
+	taxRates := make([]db.TaxRate, 0)
+	for rows.Next() {
+		var taxRate db.TaxRate
+		err := rows.Scan(
+            &taxRate.ID,
+            &taxRate.PublicID,
+            &taxRate.Country,
+            &taxRate.Label,
+            &taxRate.Rate,
+            &taxRate.ValidFrom,
+            &taxRate.ValidTo,
+        )
+		if err != nil {
+			return nil, utils.LogError("failed to scan tax rate: %v", err)
+		}
+		if err := taxRate.Valid(); err != nil {
+			return nil, err // Integrity of data is breached
+		}
+		taxRates = append(taxRates, taxRate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list tax rates: %v", err)
+	}
+	return taxRates, nil
+}
+
+// Rates valid on the day of date, in its location
+func ListTaxRatesValidOn(database db.Querier, country string, date time.Time) (
+    []db.TaxRate, error,
+) {
+	taxRates, err := ListTaxRates(database, country)
+	if err != nil {
+		return nil, err
+	}
+	dateOnly := date.Format(time.DateOnly)
+	valid := make([]db.TaxRate, 0, len(taxRates))
+	for _, taxRate := range taxRates {
+		if taxRate.ValidOn(dateOnly) {
+			valid = append(valid, taxRate)
+		}
+	}
+	return valid, nil
+}
+
+// Compare the line item rate with the ones of its expense country on the
+// expense date. Unknown rates are only a warning: the catalog can lag behind
+// a new rate, and expenses without country are not checked at all.
+func CheckLineItemTaxeRate(database db.Querier, lineItem db.LineItem) (bool, error) {
+	expense, err := GetExpenseByID(database, lineItem.ExpenseID)
+	if err != nil {
+		return false, err
+	}
+	if !expense.Country.Valid || lineItem.TaxeRate == 0 {
+		return true, nil
+	}
+
+	// The rates of the day where the expense happened, not of the UTC one
+	taxRates, err := ListTaxRatesValidOn(database, expense.Country.String, expense.LocalTime())
+	if err != nil {
+		return false, err
+	}
+	known := make([]string, 0, len(taxRates))
+	for _, taxRate := range taxRates {
+		if math.Abs(taxRate.Rate-lineItem.TaxeRate) < 0.001 {
+			return true, nil
+		}
+		known = append(known, strconv.FormatFloat(taxRate.Rate, 'f', -1, 64)+"%")
+	}
+
+	if len(known) == 0 {
+		slog.Warn(
+			"no tax rates known",
+			"country", expense.Country.String, "date", expense.LocalDate(),
+		)
+		return false, nil
+	}
+	slog.Warn(
+		"unknown taxe rate",
+		"rate", lineItem.TaxeRate, "expense_id", expense.ID, "country", expense.Country.String,
+		"date", expense.LocalDate(), "known", strings.Join(known, ", "),
+	)
+	return false, nil
+}
@@ -5,20 +5,13 @@ import (
 	"time"
 
 	"github.com/craftidev/expenseflow/internal/db"
-	"github.com/craftidev/expenseflow/internal/utils"
 )
 
 
+// Stored timestamps, see db.TimestampLayout. Times are returned in UTC, the
+// local ones come from the time zone of the row (Expense.LocalTime).
 func ParsingStrToTime(timestamp string) (time.Time, error) {
-	// The full timestamp string looks like this with time.Time
-    // "2024-10-03 16:57:00.013887899+02:00"
-    layout := "2006-01-02 15:04:05.999999999-07:00"
-	parsedTime, err := time.Parse(layout, timestamp)
-	if err != nil {
-		return time.Time{}, utils.LogError("error parsing time: %v", err)
-	}
-
-	return parsedTime, nil
+	return db.ParseTimestamp(timestamp)
 }
 
 func ParsingNullableStrToTime(timestamp sql.NullString) (
@@ -1,76 +1,216 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"io/fs"
-	"log"
-	"os"
-	"path/filepath"
+	"log/slog"
 	"sort"
+	"strconv"
+	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
-
-	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db/migrations"
 	"github.com/craftidev/expenseflow/internal/utils"
 )
 
 
 func ConnectDB(DBPath string, ) (*sql.DB, error) {
-    db, err := sql.Open("sqlite3", DBPath)
+    db, err := sql.Open(driverName, DBPath)
     if err != nil {
         return nil, utils.LogError("failed to open database: %v", err)
     }
     return db, nil
 }
 
-func InitDB(DBPath string, db *sql.DB) error {
-    if _, err := os.Stat(DBPath); !os.IsNotExist(err) {
-        log.Println("[info] Database already exists. Skipping initialization.")
+// Apply the embedded migrations not applied yet. PRAGMA user_version holds the
+// number of the last migration applied, so existing databases are upgraded.
+// On a new database the chosen standard models are seeded after the schema.
+func InitDB(DBPath string, db *sql.DB, standardModels ...string) error {
+    var version int
+    if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+        return utils.LogError("failed to read schema version: %v", err)
+    }
+    // Databases created before versioning have tables but no version
+    var tablesCount int
+    err := db.QueryRow(
+        "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'expense_types'",
+    ).Scan(&tablesCount)
+    if err != nil {
+        return utils.LogError("failed to inspect database: %v", err)
+    }
+    isNew := version == 0 && tablesCount == 0
+
+    schemaFiles, err := ListMigrations(migrations.FS)
+    if err != nil {
+        return err
+    }
+
+    migrated, err := applyMigrations(db, schemaFiles, version)
+    if err != nil {
+        return err
+    }
+
+    if err := setupSearchIndex(db, migrated); err != nil {
+        return err
+    }
+
+    if !isNew {
+        slog.Info("database already exists, schema up to date")
         return nil
     }
+    slog.Info("database created")
 
-    filesPath := config.MigrationsDirPath
-    schemaDirectory := os.DirFS(filesPath)
-    schemaFiles, err := fs.Glob(schemaDirectory, "*.sql")
+    return InstallStandardModels(db, standardModels...)
+}
+
+type Migration struct {
+    Version int
+    File    string
+}
+
+// Schema files are named NNN_description.sql, NNN being the schema version
+// they bring a database to. Versions must follow each other from 1: a file
+// renamed or inserted fails here instead of shifting the version of existing
+// databases.
+func ListMigrations(fsys fs.FS) ([]Migration, error) {
+    files, err := fs.Glob(fsys, "*.sql")
     if err != nil {
-        return utils.LogError("failed to fetch schema files: %v", err)
+        return nil, utils.LogError("failed to fetch schema files: %v", err)
     }
-    sort.Strings(schemaFiles)
+    schemaFiles := make([]Migration, 0, len(files))
+    for _, file := range files {
+        prefix, _, found := strings.Cut(file, "_")
+        version, err := strconv.Atoi(prefix)
+        if !found || err != nil || version <= 0 {
+            return nil, utils.LogError("schema file not named NNN_description.sql: %s", file)
+        }
+        schemaFiles = append(schemaFiles, Migration{version, file})
+    }
+    sort.Slice(schemaFiles, func(i, j int) bool {
+        return schemaFiles[i].Version < schemaFiles[j].Version
+    })
+    for i, m := range schemaFiles {
+        switch {
+        case i > 0 && m.Version == schemaFiles[i-1].Version:
+            return nil, utils.LogError(
+                "schema version %03d used twice: %s and %s", m.Version, schemaFiles[i-1].File, m.File,
+            )
+        case m.Version != i+1:
+            return nil, utils.LogError("schema version %03d missing before %s", i+1, m.File)
+        }
+    }
+    return schemaFiles, nil
+}
 
-    for i, schemaFile := range schemaFiles {
-        schema, err := os.ReadFile(filepath.Join(filesPath, schemaFile))
+// Migrations rebuild tables (create, copy, drop, rename), which foreign keys
+// forbid: they are off on the connection applying them, and checked after.
+// Rows already pointing to missing ones are logged, not fixed.
+func applyMigrations(db *sql.DB, schemaFiles []Migration, version int) (bool, error) {
+    if len(schemaFiles) == 0 || version >= schemaFiles[len(schemaFiles)-1].Version {
+        return false, nil
+    }
+    ctx := context.Background()
+    conn, err := db.Conn(ctx)
+    if err != nil {
+        return false, utils.LogError("failed to get a connection for migrations: %v", err)
+    }
+    defer conn.Close()
+    if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+        return false, utils.LogError("failed to disable foreign keys: %v", err)
+    }
+    defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+    for _, schemaFile := range schemaFiles {
+        if schemaFile.Version <= version {
+            continue
+        }
+        schema, err := migrations.FS.ReadFile(schemaFile.File)
         if err != nil {
-            return utils.LogError("failed to read schema file: %v", err)
+            return false, utils.LogError("failed to read schema file: %v", err)
         }
 
-        _, err = db.Exec(string(schema))
-        if err!= nil {
-            return utils.LogError("failed to apply migration %03d: %v", i + 1, err)
+        if err := applyMigration(conn, schemaFile.Version, string(schema)); err != nil {
+            return false, utils.LogError("failed to apply migration %03d: %v", schemaFile.Version, err)
         }
+        slog.Info("migration applied", "version", schemaFile.Version)
     }
 
-    log.Println("[info] Database created.")
-
-    // HACK TODO give user choice to add standard migration files
-    // hack := filepath.Join(config.MigrationsDirPath, "standard_models", "orisha_g8.sql")
-    // schema, err := os.ReadFile(hack)
-    // if err != nil {
-    //     log.Fatalf("[fatal][hack] failed to read schema file: %v", err)
-    // }
+    rows, err := conn.QueryContext(ctx, "PRAGMA foreign_key_check")
+    if err != nil {
+        return false, utils.LogError("failed to check foreign keys: %v", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var table, parent string
+        var rowID sql.NullInt64
+        var fkID int
+        if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+            return false, utils.LogError("failed to scan foreign key violation: %v", err)
+        }
+        slog.Warn("row referencing a missing one", "table", table, "row_id", rowID.Int64, "parent", parent)
+    }
+    if err := rows.Err(); err != nil {
+        return false, utils.LogError("failed to check foreign keys: %v", err)
+    }
+    return true, nil
+}
 
-    // _, err = db.Exec(string(schema))
-    // if err!= nil {
-    //     log.Fatalf("[fatal][hack] failed to apply migration %v: %v", hack, err)
-    // }
-    // log.Println("[hack] Standard migration ORISHA G8 files added.")
+// Go side of a migration, for what SQL can't do (files...). It runs in the
+// transaction of the migration after its schema file, the returned func once
+// the migration is committed.
+var migrationSteps = map[int]func(tx *sql.Tx) (func(), error){
+    16: renameReceiptFiles,
+}
 
+func applyMigration(conn *sql.Conn, version int, schema string) error {
+    tx, err := conn.BeginTx(context.Background(), nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    if _, err := tx.Exec(schema); err != nil {
+        return err
+    }
+    committed := func() {}
+    if step, ok := migrationSteps[version]; ok {
+        if committed, err = step(tx); err != nil {
+            return err
+        }
+    }
+    if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+        return err
+    }
+    if err := tx.Commit(); err != nil {
+        return err
+    }
+    committed()
     return nil
 }
 
+// *sql.DB or a *sql.Conn with its own pragmas
+type txBeginner interface {
+    BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+func execInTx(db txBeginner, statements ...string) error {
+    tx, err := db.BeginTx(context.Background(), nil)
+    if err != nil {
+        return err
+    }
+    for _, statement := range statements {
+        if _, err := tx.Exec(statement); err != nil {
+            tx.Rollback()
+            return err
+        }
+    }
+    return tx.Commit()
+}
+
 func CloseDB(db *sql.DB) error {
     if err := db.Close(); err != nil {
         return utils.LogError("failed to close database: %v", err)
     }
-    log.Println("[info] Database closed.")
+    slog.Info("database closed")
     return nil
 }
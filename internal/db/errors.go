@@ -0,0 +1,36 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/craftidev/expenseflow/internal/utils"
+	"github.com/mattn/go-sqlite3"
+)
+
+
+// Kind of error of a statement refused by a SQLite constraint, nil for any
+// other error (see utils.WrapError)
+func ConstraintKind(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		return nil
+	}
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		return utils.ErrConflict
+	case sqlite3.ErrConstraintForeignKey:
+		return utils.ErrReferenced
+	default:
+		return utils.ErrValidation
+	}
+}
+
+// Same for an insert or update: a foreign key to a missing row is invalid
+// input, ErrReferenced is left to deletes of a row still referenced
+func WriteConstraintKind(err error) error {
+	kind := ConstraintKind(err)
+	if kind == utils.ErrReferenced {
+		return utils.ErrValidation
+	}
+	return kind
+}
@@ -0,0 +1,27 @@
+ALTER TABLE expense_types ADD COLUMN default_taxe_rates TEXT NULL
+    CONSTRAINT ck_normal_size_default_taxe_rates_60 CHECK (LENGTH(default_taxe_rates) <= 60);
+ALTER TABLE expense_types ADD COLUMN accounting_code TEXT NULL
+    CONSTRAINT ck_normal_size_accounting_code_20 CHECK (
+        accounting_code IS NULL OR LENGTH(accounting_code) BETWEEN 1 AND 20
+    );
+ALTER TABLE expense_types ADD COLUMN reimbursable INTEGER NOT NULL DEFAULT 1
+    CONSTRAINT ck_boolean_reimbursable CHECK (reimbursable IN (0, 1));
+ALTER TABLE expense_types ADD COLUMN description TEXT NULL
+    CONSTRAINT ck_normal_size_description_200 CHECK (
+        description IS NULL OR LENGTH(description) BETWEEN 1 AND 200
+    );
+ALTER TABLE expense_types ADD COLUMN model_ref TEXT NULL
+    CONSTRAINT ck_normal_size_model_ref_60 CHECK (
+        model_ref IS NULL OR LENGTH(model_ref) BETWEEN 1 AND 60
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_expense_types_model_ref
+    ON expense_types(model_ref) WHERE model_ref IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS installed_standard_models (
+    name    TEXT    PRIMARY KEY,
+    version INTEGER NOT NULL,
+
+    CONSTRAINT ck_normal_size_name_50 CHECK (LENGTH(name) BETWEEN 1 AND 50),
+    CONSTRAINT ck_positive_version    CHECK (version > 0)
+);
@@ -0,0 +1,3 @@
+-- Categories like hotels for employees or gifts don't give back their VAT
+ALTER TABLE expense_types ADD COLUMN vat_recoverable INTEGER NOT NULL DEFAULT 1
+    CONSTRAINT ck_boolean_vat_recoverable CHECK (vat_recoverable IN (0, 1));
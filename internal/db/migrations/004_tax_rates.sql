@@ -0,0 +1,128 @@
+-- VAT rates per country (ISO 3166-1 alpha-2), valid_from/valid_to are
+-- inclusive yyyy-mm-dd dates, NULL meaning open ended.
+-- A 0% rate (exempt) is always accepted and so is not listed.
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    country    TEXT    NOT NULL,
+    label      TEXT    NOT NULL,
+    rate       REAL    NOT NULL,
+    valid_from TEXT        NULL,
+    valid_to   TEXT        NULL,
+
+    CONSTRAINT ux_tax_rates_country_label_from UNIQUE (country, label, valid_from),
+    CONSTRAINT ck_normal_size_country_2  CHECK (LENGTH(country) == 2),
+    CONSTRAINT ck_normal_size_label_20   CHECK (LENGTH(label) BETWEEN 1 AND 20),
+    CONSTRAINT ck_limit_size_rate_60     CHECK (rate > 0 AND rate <= 60),
+    CONSTRAINT ck_normal_size_valid_10   CHECK (
+        (valid_from IS NULL OR LENGTH(valid_from) == 10) AND
+        (valid_to   IS NULL OR LENGTH(valid_to)   == 10)
+    ),
+    CONSTRAINT ck_valid_period           CHECK (
+        valid_from IS NULL OR valid_to IS NULL OR valid_from <= valid_to
+    )
+);
+
+CREATE INDEX IF NOT EXISTS ix_tax_rates_country ON tax_rates(country);
+
+ALTER TABLE expenses ADD COLUMN country TEXT NULL
+    CONSTRAINT ck_normal_size_country_2 CHECK (country IS NULL OR LENGTH(country) == 2);
+
+-- EU member states
+INSERT OR IGNORE INTO tax_rates(country, label, rate, valid_from, valid_to) VALUES
+    ('AT', 'standard',      20,   NULL,         NULL),
+    ('AT', 'reduced',       10,   NULL,         NULL),
+    ('AT', 'reduced_2',     13,   NULL,         NULL),
+    ('BE', 'standard',      21,   NULL,         NULL),
+    ('BE', 'reduced',       12,   NULL,         NULL),
+    ('BE', 'reduced_2',      6,   NULL,         NULL),
+    ('BG', 'standard',      20,   NULL,         NULL),
+    ('BG', 'reduced',        9,   NULL,         NULL),
+    ('CY', 'standard',      19,   NULL,         NULL),
+    ('CY', 'reduced',        9,   NULL,         NULL),
+    ('CY', 'reduced_2',      5,   NULL,         NULL),
+    ('CZ', 'standard',      21,   NULL,         NULL),
+    ('CZ', 'reduced',       15,   NULL,         '2023-12-31'),
+    ('CZ', 'reduced_2',     10,   NULL,         '2023-12-31'),
+    ('CZ', 'reduced',       12,   '2024-01-01', NULL),
+    ('DE', 'standard',      19,   NULL,         '2020-06-30'),
+    ('DE', 'reduced',        7,   NULL,         '2020-06-30'),
+    ('DE', 'standard',      16,   '2020-07-01', '2020-12-31'),
+    ('DE', 'reduced',        5,   '2020-07-01', '2020-12-31'),
+    ('DE', 'standard',      19,   '2021-01-01', NULL),
+    ('DE', 'reduced',        7,   '2021-01-01', NULL),
+    ('DK', 'standard',      25,   NULL,         NULL),
+    ('EE', 'standard',      20,   NULL,         '2023-12-31'),
+    ('EE', 'standard',      22,   '2024-01-01', '2025-06-30'),
+    ('EE', 'standard',      24,   '2025-07-01', NULL),
+    ('EE', 'reduced',        9,   NULL,         NULL),
+    ('EE', 'reduced_2',      5,   NULL,         NULL),
+    ('ES', 'standard',      21,   NULL,         NULL),
+    ('ES', 'reduced',       10,   NULL,         NULL),
+    ('ES', 'super_reduced',  4,   NULL,         NULL),
+    ('FI', 'standard',      24,   NULL,         '2024-08-31'),
+    ('FI', 'standard',      25.5, '2024-09-01', NULL),
+    ('FI', 'reduced',       14,   NULL,         NULL),
+    ('FI', 'reduced_2',     10,   NULL,         NULL),
+    ('FR', 'standard',      19.6, NULL,         '2013-12-31'),
+    ('FR', 'reduced',        7,   NULL,         '2013-12-31'),
+    ('FR', 'standard',      20,   '2014-01-01', NULL),
+    ('FR', 'reduced',       10,   '2014-01-01', NULL),
+    ('FR', 'reduced_2',      5.5, NULL,         NULL),
+    ('FR', 'super_reduced',  2.1, NULL,         NULL),
+    ('GR', 'standard',      24,   NULL,         NULL),
+    ('GR', 'reduced',       13,   NULL,         NULL),
+    ('GR', 'reduced_2',      6,   NULL,         NULL),
+    ('HR', 'standard',      25,   NULL,         NULL),
+    ('HR', 'reduced',       13,   NULL,         NULL),
+    ('HR', 'reduced_2',      5,   NULL,         NULL),
+    ('HU', 'standard',      27,   NULL,         NULL),
+    ('HU', 'reduced',       18,   NULL,         NULL),
+    ('HU', 'reduced_2',      5,   NULL,         NULL),
+    ('IE', 'standard',      23,   NULL,         NULL),
+    ('IE', 'reduced',       13.5, NULL,         NULL),
+    ('IE', 'reduced_2',      9,   NULL,         NULL),
+    ('IE', 'super_reduced',  4.8, NULL,         NULL),
+    ('IT', 'standard',      22,   NULL,         NULL),
+    ('IT', 'reduced',       10,   NULL,         NULL),
+    ('IT', 'reduced_2',      5,   NULL,         NULL),
+    ('IT', 'super_reduced',  4,   NULL,         NULL),
+    ('LT', 'standard',      21,   NULL,         NULL),
+    ('LT', 'reduced',        9,   NULL,         NULL),
+    ('LT', 'reduced_2',      5,   NULL,         NULL),
+    ('LU', 'standard',      17,   NULL,         '2022-12-31'),
+    ('LU', 'reduced',        8,   NULL,         '2022-12-31'),
+    ('LU', 'standard',      16,   '2023-01-01', '2023-12-31'),
+    ('LU', 'reduced',        7,   '2023-01-01', '2023-12-31'),
+    ('LU', 'standard',      17,   '2024-01-01', NULL),
+    ('LU', 'reduced',        8,   '2024-01-01', NULL),
+    ('LU', 'super_reduced',  3,   NULL,         NULL),
+    ('LV', 'standard',      21,   NULL,         NULL),
+    ('LV', 'reduced',       12,   NULL,         NULL),
+    ('LV', 'reduced_2',      5,   NULL,         NULL),
+    ('MT', 'standard',      18,   NULL,         NULL),
+    ('MT', 'reduced',        7,   NULL,         NULL),
+    ('MT', 'reduced_2',      5,   NULL,         NULL),
+    ('NL', 'standard',      21,   NULL,         NULL),
+    ('NL', 'reduced',        9,   NULL,         NULL),
+    ('PL', 'standard',      23,   NULL,         NULL),
+    ('PL', 'reduced',        8,   NULL,         NULL),
+    ('PL', 'reduced_2',      5,   NULL,         NULL),
+    ('PT', 'standard',      23,   NULL,         NULL),
+    ('PT', 'reduced',       13,   NULL,         NULL),
+    ('PT', 'reduced_2',      6,   NULL,         NULL),
+    ('RO', 'standard',      19,   NULL,         '2025-07-31'),
+    ('RO', 'reduced',        9,   NULL,         '2025-07-31'),
+    ('RO', 'reduced_2',      5,   NULL,         '2025-07-31'),
+    ('RO', 'standard',      21,   '2025-08-01', NULL),
+    ('RO', 'reduced',       11,   '2025-08-01', NULL),
+    ('SE', 'standard',      25,   NULL,         NULL),
+    ('SE', 'reduced',       12,   NULL,         NULL),
+    ('SE', 'reduced_2',      6,   NULL,         NULL),
+    ('SI', 'standard',      22,   NULL,         NULL),
+    ('SI', 'reduced',        9.5, NULL,         NULL),
+    ('SI', 'reduced_2',      5,   NULL,         NULL),
+    ('SK', 'standard',      20,   NULL,         '2024-12-31'),
+    ('SK', 'reduced',       10,   NULL,         '2024-12-31'),
+    ('SK', 'standard',      23,   '2025-01-01', NULL),
+    ('SK', 'reduced',       19,   '2025-01-01', NULL),
+    ('SK', 'reduced_2',      5,   NULL,         NULL);
@@ -0,0 +1,20 @@
+-- ck_positive_total checked taxe_rate instead of total, rejecting 0% (exempt)
+-- line items. SQLite can't alter a constraint, so the table is rebuilt.
+CREATE TABLE line_items_new (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    expense_id INTEGER NOT NULL,
+    taxe_rate  REAL    NOT NULL,
+    total      REAL    NOT NULL,
+
+    FOREIGN KEY (expense_id) REFERENCES expenses(id),
+
+    CONSTRAINT ck_positive_total           CHECK (total > 0),
+    CONSTRAINT ck_positive_taxe_rate       CHECK (taxe_rate >= 0),
+    CONSTRAINT ck_limit_size_taxe_rate_60  CHECK (taxe_rate <= 60)
+);
+
+INSERT INTO line_items_new(id, expense_id, taxe_rate, total)
+    SELECT id, expense_id, taxe_rate, total FROM line_items;
+
+DROP TABLE line_items;
+ALTER TABLE line_items_new RENAME TO line_items;
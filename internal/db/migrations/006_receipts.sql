@@ -0,0 +1,48 @@
+-- Several receipt files per expense (hotel invoice and card slip, multi-page
+-- scans...). Existing receipt_rel_path values become the first receipt of
+-- their expense, then expenses is rebuilt without the column (SQLite can't
+-- drop a column used by a CHECK constraint).
+CREATE TABLE receipts (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    expense_id INTEGER NOT NULL,
+    rel_path   TEXT    NOT NULL,
+    position   INTEGER NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (expense_id) REFERENCES expenses(id),
+
+    CONSTRAINT ux_receipts_expense_rel_path  UNIQUE (expense_id, rel_path),
+    CONSTRAINT ck_non_empty_rel_path         CHECK (LENGTH(rel_path) > 0),
+    CONSTRAINT ck_normal_size_rel_path_50    CHECK (LENGTH(rel_path) <= 50),
+    CONSTRAINT ck_positive_position          CHECK (position >= 0)
+);
+
+CREATE INDEX ix_receipts_expense_id ON receipts(expense_id);
+
+INSERT INTO receipts(expense_id, rel_path)
+    SELECT id, receipt_rel_path FROM expenses
+    WHERE receipt_rel_path IS NOT NULL AND LENGTH(receipt_rel_path) > 0;
+
+CREATE TABLE expenses_new (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER     NULL,
+    type_id    INTEGER NOT NULL,
+    currency   TEXT    NOT NULL,
+    notes      TEXT        NULL,
+    date_time  TEXT    NOT NULL,
+    country    TEXT        NULL,
+
+    FOREIGN KEY (session_id) REFERENCES sessions(id),
+    FOREIGN KEY (type_id)    REFERENCES expense_types(id),
+
+    CONSTRAINT ck_non_empty_currency      CHECK (LENGTH(currency)  >  0),
+    CONSTRAINT ck_normal_size_currency_10 CHECK (LENGTH(currency)  <= 10),
+    CONSTRAINT ck_normal_notes_150        CHECK (LENGTH(notes)     <= 150),
+    CONSTRAINT ck_normal_date_time_60     CHECK (LENGTH(date_time) <= 60),
+    CONSTRAINT ck_non_empty_notes         CHECK (notes IS NULL OR LENGTH(notes) > 0)
+);
+
+INSERT INTO expenses_new(id, session_id, type_id, currency, notes, date_time, country)
+    SELECT id, session_id, type_id, currency, notes, date_time, country FROM expenses;
+
+DROP TABLE expenses;
+ALTER TABLE expenses_new RENAME TO expenses;
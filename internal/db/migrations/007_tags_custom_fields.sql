@@ -0,0 +1,80 @@
+-- Free labels shared by expenses and sessions, case insensitive
+CREATE TABLE tags (
+    id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT    NOT NULL UNIQUE COLLATE NOCASE,
+
+    CONSTRAINT ck_normal_size_name_50 CHECK (LENGTH(name) BETWEEN 1 AND 50)
+);
+
+CREATE TABLE expense_tags (
+    expense_id INTEGER NOT NULL,
+    tag_id     INTEGER NOT NULL,
+
+    PRIMARY KEY (expense_id, tag_id),
+    FOREIGN KEY (expense_id) REFERENCES expenses(id),
+    FOREIGN KEY (tag_id)     REFERENCES tags(id)
+);
+CREATE INDEX ix_expense_tags_tag_id ON expense_tags(tag_id);
+
+CREATE TABLE session_tags (
+    session_id INTEGER NOT NULL,
+    tag_id     INTEGER NOT NULL,
+
+    PRIMARY KEY (session_id, tag_id),
+    FOREIGN KEY (session_id) REFERENCES sessions(id),
+    FOREIGN KEY (tag_id)     REFERENCES tags(id)
+);
+CREATE INDEX ix_session_tags_tag_id ON session_tags(tag_id);
+
+-- Typed fields defined by the user (cost center, PO number...), options is
+-- the comma separated list of choices of an enum
+CREATE TABLE custom_fields (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT    NOT NULL COLLATE NOCASE,
+    applies_to TEXT    NOT NULL,
+    type       TEXT    NOT NULL,
+    options    TEXT        NULL,
+
+    CONSTRAINT ux_custom_fields_applies_to_name UNIQUE (applies_to, name),
+    CONSTRAINT ck_normal_size_name_50   CHECK (LENGTH(name) BETWEEN 1 AND 50),
+    CONSTRAINT ck_known_applies_to      CHECK (applies_to IN ('expense', 'session')),
+    CONSTRAINT ck_known_type            CHECK (type IN ('text', 'number', 'date', 'enum')),
+    CONSTRAINT ck_options_only_for_enum CHECK ((type = 'enum') == (options IS NOT NULL))
+);
+
+-- entity_id is an expense or a session, depending on the field applies_to
+CREATE TABLE custom_field_values (
+    field_id  INTEGER NOT NULL,
+    entity_id INTEGER NOT NULL,
+    value     TEXT    NOT NULL,
+
+    PRIMARY KEY (field_id, entity_id),
+    FOREIGN KEY (field_id) REFERENCES custom_fields(id),
+
+    CONSTRAINT ck_normal_size_value_200 CHECK (LENGTH(value) BETWEEN 1 AND 200)
+);
+CREATE INDEX ix_custom_field_values_entity_id ON custom_field_values(entity_id);
+
+-- Tags and custom values go with their expense, session, tag or field
+CREATE TRIGGER expenses_delete_attributes AFTER DELETE ON expenses BEGIN
+    DELETE FROM expense_tags WHERE expense_id = OLD.id;
+    DELETE FROM custom_field_values WHERE entity_id = OLD.id AND field_id IN (
+        SELECT id FROM custom_fields WHERE applies_to = 'expense'
+    );
+END;
+
+CREATE TRIGGER sessions_delete_attributes AFTER DELETE ON sessions BEGIN
+    DELETE FROM session_tags WHERE session_id = OLD.id;
+    DELETE FROM custom_field_values WHERE entity_id = OLD.id AND field_id IN (
+        SELECT id FROM custom_fields WHERE applies_to = 'session'
+    );
+END;
+
+CREATE TRIGGER tags_delete_links AFTER DELETE ON tags BEGIN
+    DELETE FROM expense_tags WHERE tag_id = OLD.id;
+    DELETE FROM session_tags WHERE tag_id = OLD.id;
+END;
+
+CREATE TRIGGER custom_fields_delete_values AFTER DELETE ON custom_fields BEGIN
+    DELETE FROM custom_field_values WHERE field_id = OLD.id;
+END;
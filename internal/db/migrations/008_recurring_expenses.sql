@@ -0,0 +1,49 @@
+-- Templates of expenses coming back on a schedule (an RRULE subset, see
+-- db.Schedule). line_items is the comma separated "rate:total" list.
+CREATE TABLE recurring_expenses (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    name         TEXT    NOT NULL UNIQUE COLLATE NOCASE,
+    type_id      INTEGER NOT NULL,
+    currency     TEXT    NOT NULL,
+    line_items   TEXT    NOT NULL,
+    notes        TEXT        NULL,
+    country      TEXT        NULL,
+    session_rule TEXT    NOT NULL DEFAULT 'none',
+    session_id   INTEGER     NULL,
+    client_id    INTEGER     NULL,
+    schedule     TEXT    NOT NULL,
+    start_date   TEXT    NOT NULL,
+
+    FOREIGN KEY (type_id)    REFERENCES expense_types(id),
+    FOREIGN KEY (session_id) REFERENCES sessions(id),
+    FOREIGN KEY (client_id)  REFERENCES clients(id),
+
+    CONSTRAINT ck_normal_size_name_50      CHECK (LENGTH(name) BETWEEN 1 AND 50),
+    CONSTRAINT ck_normal_size_currency_10  CHECK (LENGTH(currency) BETWEEN 1 AND 10),
+    CONSTRAINT ck_non_empty_line_items     CHECK (LENGTH(line_items) > 0),
+    CONSTRAINT ck_normal_size_notes_150    CHECK (notes IS NULL OR LENGTH(notes) BETWEEN 1 AND 150),
+    CONSTRAINT ck_known_session_rule       CHECK (session_rule IN ('none', 'fixed', 'client')),
+    CONSTRAINT ck_session_id_only_if_fixed CHECK ((session_rule = 'fixed') == (session_id IS NOT NULL)),
+    CONSTRAINT ck_client_id_only_if_client CHECK ((session_rule = 'client') == (client_id IS NOT NULL)),
+    CONSTRAINT ck_non_empty_schedule       CHECK (LENGTH(schedule) > 0),
+    CONSTRAINT ck_date_only_start_date     CHECK (LENGTH(start_date) = 10)
+);
+
+-- One row per generated date, kept when the expense is deleted so that it is
+-- not generated again
+CREATE TABLE recurring_occurrences (
+    recurring_expense_id INTEGER NOT NULL,
+    date_only            TEXT    NOT NULL,
+    expense_id           INTEGER NOT NULL,
+
+    PRIMARY KEY (recurring_expense_id, date_only),
+    FOREIGN KEY (recurring_expense_id) REFERENCES recurring_expenses(id),
+    FOREIGN KEY (expense_id)           REFERENCES expenses(id),
+
+    CONSTRAINT ck_date_only_date_only CHECK (LENGTH(date_only) = 10)
+);
+CREATE INDEX ix_recurring_occurrences_expense_id ON recurring_occurrences(expense_id);
+
+CREATE TRIGGER recurring_expenses_delete_occurrences AFTER DELETE ON recurring_expenses BEGIN
+    DELETE FROM recurring_occurrences WHERE recurring_expense_id = OLD.id;
+END;
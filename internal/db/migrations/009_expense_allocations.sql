@@ -0,0 +1,22 @@
+-- An expense split across sessions (a hotel night serving two missions), by
+-- percentage or fixed amount of its total. The expense itself has no session.
+CREATE TABLE expense_allocations (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    expense_id INTEGER NOT NULL,
+    session_id INTEGER NOT NULL,
+    percentage REAL        NULL,
+    amount     REAL        NULL,
+
+    FOREIGN KEY (expense_id) REFERENCES expenses(id),
+    FOREIGN KEY (session_id) REFERENCES sessions(id),
+
+    CONSTRAINT ux_expense_allocations_expense_session UNIQUE (expense_id, session_id),
+    CONSTRAINT ck_percentage_or_amount CHECK ((percentage IS NULL) != (amount IS NULL)),
+    CONSTRAINT ck_percentage_range     CHECK (percentage IS NULL OR (percentage > 0 AND percentage <= 100)),
+    CONSTRAINT ck_positive_amount      CHECK (amount IS NULL OR amount > 0)
+);
+CREATE INDEX ix_expense_allocations_session_id ON expense_allocations(session_id);
+
+CREATE TRIGGER expenses_delete_allocations AFTER DELETE ON expenses BEGIN
+    DELETE FROM expense_allocations WHERE expense_id = OLD.id;
+END;
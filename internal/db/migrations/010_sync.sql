@@ -0,0 +1,549 @@
+-- Offline sync between devices and a server (see services/sync.go).
+-- Every synced row gets a global sync_id, a version bumped on each local
+-- change with its updated_at time, and sync_seq: its position in the change
+-- log of this database, from the counter sync_state.seq. Deleted rows leave a
+-- tombstone keeping their values. Changes to tags, custom field values and
+-- recurring occurrences count as a change of the expense, session or
+-- recurring expense owning them.
+-- A migration rebuilding one of these tables must create its triggers again.
+
+CREATE TABLE sync_state (
+    key   TEXT PRIMARY KEY,
+    value ANY  NOT NULL
+);
+INSERT INTO sync_state(key, value) VALUES
+    ('seq', 0),
+    ('device_id', lower(hex(randomblob(8)))),
+    ('pushed_seq', 0),     -- local changes up to this seq are on the server
+    ('pulled_cursor', 0);  -- server changes up to this seq are here
+
+CREATE TABLE sync_tombstones (
+    sync_id    TEXT    PRIMARY KEY,
+    table_name TEXT    NOT NULL,
+    row_id     INTEGER NOT NULL,
+    version    INTEGER NOT NULL,
+    deleted_at TEXT    NOT NULL,
+    sync_seq   INTEGER NOT NULL,
+    row_values TEXT    NOT NULL  -- JSON object of the columns, to bring the row back
+);
+CREATE INDEX ix_sync_tombstones_sync_seq ON sync_tombstones(sync_seq);
+CREATE INDEX ix_sync_tombstones_table_row ON sync_tombstones(table_name, row_id);
+
+-- Sync IDs of rows created on a device and merged on the server into a row
+-- with the same name (or other unique key)
+CREATE TABLE sync_aliases (
+    alias      TEXT PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    sync_id    TEXT NOT NULL
+);
+
+ALTER TABLE clients ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE clients ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE clients ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE clients ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE clients SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_clients_sync_id ON clients(sync_id);
+CREATE INDEX ix_clients_sync_seq ON clients(sync_seq);
+
+ALTER TABLE expense_types ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE expense_types ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE expense_types ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE expense_types ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE expense_types SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_expense_types_sync_id ON expense_types(sync_id);
+CREATE INDEX ix_expense_types_sync_seq ON expense_types(sync_seq);
+
+ALTER TABLE tags ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE tags ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE tags ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE tags ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE tags SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_tags_sync_id ON tags(sync_id);
+CREATE INDEX ix_tags_sync_seq ON tags(sync_seq);
+
+ALTER TABLE custom_fields ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE custom_fields ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE custom_fields ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE custom_fields ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE custom_fields SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_custom_fields_sync_id ON custom_fields(sync_id);
+CREATE INDEX ix_custom_fields_sync_seq ON custom_fields(sync_seq);
+
+ALTER TABLE sessions ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE sessions ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE sessions ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE sessions ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE sessions SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_sessions_sync_id ON sessions(sync_id);
+CREATE INDEX ix_sessions_sync_seq ON sessions(sync_seq);
+
+ALTER TABLE car_trips ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE car_trips ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE car_trips ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE car_trips ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE car_trips SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_car_trips_sync_id ON car_trips(sync_id);
+CREATE INDEX ix_car_trips_sync_seq ON car_trips(sync_seq);
+
+ALTER TABLE expenses ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE expenses ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE expenses ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE expenses ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE expenses SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_expenses_sync_id ON expenses(sync_id);
+CREATE INDEX ix_expenses_sync_seq ON expenses(sync_seq);
+
+ALTER TABLE line_items ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE line_items ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE line_items ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE line_items ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE line_items SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_line_items_sync_id ON line_items(sync_id);
+CREATE INDEX ix_line_items_sync_seq ON line_items(sync_seq);
+
+ALTER TABLE receipts ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE receipts ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE receipts ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE receipts ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE receipts SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_receipts_sync_id ON receipts(sync_id);
+CREATE INDEX ix_receipts_sync_seq ON receipts(sync_seq);
+
+ALTER TABLE expense_allocations ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE expense_allocations ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE expense_allocations ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE expense_allocations ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE expense_allocations SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_expense_allocations_sync_id ON expense_allocations(sync_id);
+CREATE INDEX ix_expense_allocations_sync_seq ON expense_allocations(sync_seq);
+
+ALTER TABLE recurring_expenses ADD COLUMN sync_id    TEXT        NULL;
+ALTER TABLE recurring_expenses ADD COLUMN version    INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE recurring_expenses ADD COLUMN updated_at TEXT        NULL;
+ALTER TABLE recurring_expenses ADD COLUMN sync_seq   INTEGER NOT NULL DEFAULT 0;
+UPDATE recurring_expenses SET sync_id = lower(hex(randomblob(16))), updated_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+CREATE UNIQUE INDEX ux_recurring_expenses_sync_id ON recurring_expenses(sync_id);
+CREATE INDEX ix_recurring_expenses_sync_seq ON recurring_expenses(sync_seq);
+
+CREATE TRIGGER clients_sync_insert AFTER INSERT ON clients BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE clients SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER clients_sync_update AFTER UPDATE ON clients WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE clients SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER clients_sync_delete AFTER DELETE ON clients BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'clients', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'name', OLD.name
+        )
+    );
+END;
+
+CREATE TRIGGER expense_types_sync_insert AFTER INSERT ON expense_types BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expense_types SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER expense_types_sync_update AFTER UPDATE ON expense_types WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expense_types SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER expense_types_sync_delete AFTER DELETE ON expense_types BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'expense_types', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'name', OLD.name,
+            'default_taxe_rates', OLD.default_taxe_rates,
+            'accounting_code', OLD.accounting_code,
+            'reimbursable', OLD.reimbursable,
+            'description', OLD.description,
+            'model_ref', OLD.model_ref,
+            'vat_recoverable', OLD.vat_recoverable
+        )
+    );
+END;
+
+CREATE TRIGGER tags_sync_insert AFTER INSERT ON tags BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE tags SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER tags_sync_update AFTER UPDATE ON tags WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE tags SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER tags_sync_delete AFTER DELETE ON tags BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'tags', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'name', OLD.name
+        )
+    );
+END;
+
+CREATE TRIGGER custom_fields_sync_insert AFTER INSERT ON custom_fields BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE custom_fields SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER custom_fields_sync_update AFTER UPDATE ON custom_fields WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE custom_fields SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER custom_fields_sync_delete AFTER DELETE ON custom_fields BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'custom_fields', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'name', OLD.name,
+            'applies_to', OLD.applies_to,
+            'type', OLD.type,
+            'options', OLD.options
+        )
+    );
+END;
+
+CREATE TRIGGER sessions_sync_insert AFTER INSERT ON sessions BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE sessions SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER sessions_sync_update AFTER UPDATE ON sessions WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE sessions SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER sessions_sync_delete AFTER DELETE ON sessions BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'sessions', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'client_id', OLD.client_id,
+            'location', OLD.location,
+            'trip_start_location', OLD.trip_start_location,
+            'trip_end_location', OLD.trip_end_location,
+            'start_at_date_time', OLD.start_at_date_time,
+            'end_at_date_time', OLD.end_at_date_time
+        )
+    );
+END;
+
+CREATE TRIGGER car_trips_sync_insert AFTER INSERT ON car_trips BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE car_trips SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER car_trips_sync_update AFTER UPDATE ON car_trips WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE car_trips SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER car_trips_sync_delete AFTER DELETE ON car_trips BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'car_trips', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'session_id', OLD.session_id,
+            'distance_km', OLD.distance_km,
+            'date_only', OLD.date_only
+        )
+    );
+END;
+
+CREATE TRIGGER expenses_sync_insert AFTER INSERT ON expenses BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expenses SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER expenses_sync_update AFTER UPDATE ON expenses WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expenses SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER expenses_sync_delete AFTER DELETE ON expenses BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'expenses', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'session_id', OLD.session_id,
+            'type_id', OLD.type_id,
+            'currency', OLD.currency,
+            'notes', OLD.notes,
+            'date_time', OLD.date_time,
+            'country', OLD.country
+        )
+    );
+END;
+
+CREATE TRIGGER line_items_sync_insert AFTER INSERT ON line_items BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE line_items SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER line_items_sync_update AFTER UPDATE ON line_items WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE line_items SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER line_items_sync_delete AFTER DELETE ON line_items BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'line_items', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'expense_id', OLD.expense_id,
+            'taxe_rate', OLD.taxe_rate,
+            'total', OLD.total
+        )
+    );
+END;
+
+CREATE TRIGGER receipts_sync_insert AFTER INSERT ON receipts BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE receipts SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER receipts_sync_update AFTER UPDATE ON receipts WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE receipts SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER receipts_sync_delete AFTER DELETE ON receipts BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'receipts', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'expense_id', OLD.expense_id,
+            'rel_path', OLD.rel_path,
+            'position', OLD.position
+        )
+    );
+END;
+
+CREATE TRIGGER expense_allocations_sync_insert AFTER INSERT ON expense_allocations BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expense_allocations SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER expense_allocations_sync_update AFTER UPDATE ON expense_allocations WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expense_allocations SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER expense_allocations_sync_delete AFTER DELETE ON expense_allocations BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'expense_allocations', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'expense_id', OLD.expense_id,
+            'session_id', OLD.session_id,
+            'percentage', OLD.percentage,
+            'amount', OLD.amount
+        )
+    );
+END;
+
+CREATE TRIGGER recurring_expenses_sync_insert AFTER INSERT ON recurring_expenses BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE recurring_expenses SET
+        sync_id    = COALESCE(NEW.sync_id, lower(hex(randomblob(16)))),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER recurring_expenses_sync_update AFTER UPDATE ON recurring_expenses WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE recurring_expenses SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER recurring_expenses_sync_delete AFTER DELETE ON recurring_expenses BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        sync_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.sync_id, 'recurring_expenses', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'name', OLD.name,
+            'type_id', OLD.type_id,
+            'currency', OLD.currency,
+            'line_items', OLD.line_items,
+            'notes', OLD.notes,
+            'country', OLD.country,
+            'session_rule', OLD.session_rule,
+            'session_id', OLD.session_id,
+            'client_id', OLD.client_id,
+            'schedule', OLD.schedule,
+            'start_date', OLD.start_date
+        )
+    );
+END;
+
+-- Owned rows: a no-op update of the owner bumps its version
+CREATE TRIGGER expense_tags_sync_insert AFTER INSERT ON expense_tags BEGIN
+    UPDATE expenses SET version = version WHERE id = NEW.expense_id;
+END;
+CREATE TRIGGER expense_tags_sync_delete AFTER DELETE ON expense_tags BEGIN
+    UPDATE expenses SET version = version WHERE id = OLD.expense_id;
+END;
+CREATE TRIGGER session_tags_sync_insert AFTER INSERT ON session_tags BEGIN
+    UPDATE sessions SET version = version WHERE id = NEW.session_id;
+END;
+CREATE TRIGGER session_tags_sync_delete AFTER DELETE ON session_tags BEGIN
+    UPDATE sessions SET version = version WHERE id = OLD.session_id;
+END;
+CREATE TRIGGER custom_field_values_sync_insert AFTER INSERT ON custom_field_values BEGIN
+    UPDATE expenses SET version = version WHERE id = NEW.entity_id AND (
+        SELECT applies_to FROM custom_fields WHERE id = NEW.field_id
+    ) = 'expense';
+    UPDATE sessions SET version = version WHERE id = NEW.entity_id AND (
+        SELECT applies_to FROM custom_fields WHERE id = NEW.field_id
+    ) = 'session';
+END;
+CREATE TRIGGER custom_field_values_sync_update AFTER UPDATE ON custom_field_values BEGIN
+    UPDATE expenses SET version = version WHERE id = NEW.entity_id AND (
+        SELECT applies_to FROM custom_fields WHERE id = NEW.field_id
+    ) = 'expense';
+    UPDATE sessions SET version = version WHERE id = NEW.entity_id AND (
+        SELECT applies_to FROM custom_fields WHERE id = NEW.field_id
+    ) = 'session';
+END;
+CREATE TRIGGER custom_field_values_sync_delete AFTER DELETE ON custom_field_values BEGIN
+    UPDATE expenses SET version = version WHERE id = OLD.entity_id AND (
+        SELECT applies_to FROM custom_fields WHERE id = OLD.field_id
+    ) = 'expense';
+    UPDATE sessions SET version = version WHERE id = OLD.entity_id AND (
+        SELECT applies_to FROM custom_fields WHERE id = OLD.field_id
+    ) = 'session';
+END;
+CREATE TRIGGER recurring_occurrences_sync_insert AFTER INSERT ON recurring_occurrences BEGIN
+    UPDATE recurring_expenses SET version = version WHERE id = NEW.recurring_expense_id;
+END;
+CREATE TRIGGER recurring_occurrences_sync_delete AFTER DELETE ON recurring_occurrences BEGIN
+    UPDATE recurring_expenses SET version = version WHERE id = OLD.recurring_expense_id;
+END;
@@ -0,0 +1,398 @@
+-- Sync IDs become the public IDs of the rows: UUIDs, unique across devices,
+-- to refer to a row outside of this database (API, other devices) where the
+-- AUTOINCREMENT id of each database can't be trusted. New rows get a UUIDv7
+-- (time ordered), existing ones keep their random sync ID written as a UUIDv4:
+-- the same on every device already synced. Tax rates get one too, they are
+-- not synced.
+
+-- Update triggers would take the new IDs for local changes
+DROP TRIGGER clients_sync_insert;
+DROP TRIGGER clients_sync_update;
+DROP TRIGGER expense_types_sync_insert;
+DROP TRIGGER expense_types_sync_update;
+DROP TRIGGER tags_sync_insert;
+DROP TRIGGER tags_sync_update;
+DROP TRIGGER custom_fields_sync_insert;
+DROP TRIGGER custom_fields_sync_update;
+DROP TRIGGER sessions_sync_insert;
+DROP TRIGGER sessions_sync_update;
+DROP TRIGGER car_trips_sync_insert;
+DROP TRIGGER car_trips_sync_update;
+DROP TRIGGER expenses_sync_insert;
+DROP TRIGGER expenses_sync_update;
+DROP TRIGGER line_items_sync_insert;
+DROP TRIGGER line_items_sync_update;
+DROP TRIGGER receipts_sync_insert;
+DROP TRIGGER receipts_sync_update;
+DROP TRIGGER expense_allocations_sync_insert;
+DROP TRIGGER expense_allocations_sync_update;
+DROP TRIGGER recurring_expenses_sync_insert;
+DROP TRIGGER recurring_expenses_sync_update;
+
+ALTER TABLE clients RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_clients_sync_id;
+UPDATE clients SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_clients_public_id ON clients(public_id);
+
+ALTER TABLE expense_types RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_expense_types_sync_id;
+UPDATE expense_types SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_expense_types_public_id ON expense_types(public_id);
+
+ALTER TABLE tags RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_tags_sync_id;
+UPDATE tags SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_tags_public_id ON tags(public_id);
+
+ALTER TABLE custom_fields RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_custom_fields_sync_id;
+UPDATE custom_fields SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_custom_fields_public_id ON custom_fields(public_id);
+
+ALTER TABLE sessions RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_sessions_sync_id;
+UPDATE sessions SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_sessions_public_id ON sessions(public_id);
+
+ALTER TABLE car_trips RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_car_trips_sync_id;
+UPDATE car_trips SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_car_trips_public_id ON car_trips(public_id);
+
+ALTER TABLE expenses RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_expenses_sync_id;
+UPDATE expenses SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_expenses_public_id ON expenses(public_id);
+
+ALTER TABLE line_items RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_line_items_sync_id;
+UPDATE line_items SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_line_items_public_id ON line_items(public_id);
+
+ALTER TABLE receipts RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_receipts_sync_id;
+UPDATE receipts SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_receipts_public_id ON receipts(public_id);
+
+ALTER TABLE expense_allocations RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_expense_allocations_sync_id;
+UPDATE expense_allocations SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_expense_allocations_public_id ON expense_allocations(public_id);
+
+ALTER TABLE recurring_expenses RENAME COLUMN sync_id TO public_id;
+DROP INDEX ux_recurring_expenses_sync_id;
+UPDATE recurring_expenses SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+CREATE UNIQUE INDEX ux_recurring_expenses_public_id ON recurring_expenses(public_id);
+
+ALTER TABLE sync_tombstones RENAME COLUMN sync_id TO public_id;
+UPDATE sync_tombstones SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+ALTER TABLE sync_aliases RENAME COLUMN sync_id TO public_id;
+UPDATE sync_aliases SET public_id = substr(public_id, 1, 8) || '-' || substr(public_id, 9, 4) || '-4' || substr(public_id, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(public_id, 17, 1)), 1) || substr(public_id, 18, 3) || '-' || substr(public_id, 21, 12)
+WHERE length(public_id) = 32;
+UPDATE sync_aliases SET alias = substr(alias, 1, 8) || '-' || substr(alias, 9, 4) || '-4' || substr(alias, 14, 3) || '-' ||
+    substr('89ab89ab89ab89ab', instr('0123456789abcdef', substr(alias, 17, 1)), 1) || substr(alias, 18, 3) || '-' || substr(alias, 21, 12)
+WHERE length(alias) = 32;
+
+ALTER TABLE tax_rates ADD COLUMN public_id TEXT NULL;
+UPDATE tax_rates SET public_id = substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)));
+CREATE UNIQUE INDEX ux_tax_rates_public_id ON tax_rates(public_id);
+
+CREATE TRIGGER tax_rates_public_id AFTER INSERT ON tax_rates WHEN NEW.public_id IS NULL BEGIN
+    UPDATE tax_rates SET public_id = substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER clients_sync_insert AFTER INSERT ON clients BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE clients SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER clients_sync_update AFTER UPDATE ON clients WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE clients SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER expense_types_sync_insert AFTER INSERT ON expense_types BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expense_types SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER expense_types_sync_update AFTER UPDATE ON expense_types WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expense_types SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER tags_sync_insert AFTER INSERT ON tags BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE tags SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER tags_sync_update AFTER UPDATE ON tags WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE tags SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER custom_fields_sync_insert AFTER INSERT ON custom_fields BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE custom_fields SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER custom_fields_sync_update AFTER UPDATE ON custom_fields WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE custom_fields SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER sessions_sync_insert AFTER INSERT ON sessions BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE sessions SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER sessions_sync_update AFTER UPDATE ON sessions WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE sessions SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER car_trips_sync_insert AFTER INSERT ON car_trips BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE car_trips SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER car_trips_sync_update AFTER UPDATE ON car_trips WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE car_trips SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER expenses_sync_insert AFTER INSERT ON expenses BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expenses SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER expenses_sync_update AFTER UPDATE ON expenses WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expenses SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER line_items_sync_insert AFTER INSERT ON line_items BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE line_items SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER line_items_sync_update AFTER UPDATE ON line_items WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE line_items SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER receipts_sync_insert AFTER INSERT ON receipts BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE receipts SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER receipts_sync_update AFTER UPDATE ON receipts WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE receipts SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER expense_allocations_sync_insert AFTER INSERT ON expense_allocations BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expense_allocations SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER expense_allocations_sync_update AFTER UPDATE ON expense_allocations WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expense_allocations SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER recurring_expenses_sync_insert AFTER INSERT ON recurring_expenses BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE recurring_expenses SET
+        public_id  = COALESCE(NEW.public_id,
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+        ),
+        updated_at = COALESCE(NEW.updated_at, strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER recurring_expenses_sync_update AFTER UPDATE ON recurring_expenses WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE recurring_expenses SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
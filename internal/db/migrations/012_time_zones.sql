@@ -0,0 +1,79 @@
+-- Where expenses and sessions happen: the IANA time zone of the place
+-- ("Europe/Paris"), NULL for UTC. Reports take the local date from it, a
+-- lunch at 00:30 in Paris is on that day, not on the day before in UTC.
+--
+-- Timestamps were written by the sqlite driver ("2024-10-03 16:57:00.0138+02:00"),
+-- they become RFC3339 in UTC with a fixed width fraction (db.TimestampLayout),
+-- sorting as text in time order. strftime keeps milliseconds.
+
+-- The rewrite isn't a change of the rows to sync, each device migrates its own
+DROP TRIGGER sessions_sync_update;
+DROP TRIGGER expenses_sync_update;
+DROP TRIGGER sessions_sync_delete;
+DROP TRIGGER expenses_sync_delete;
+
+ALTER TABLE sessions ADD COLUMN time_zone TEXT NULL
+    CONSTRAINT ck_normal_size_time_zone_64 CHECK (time_zone IS NULL OR LENGTH(time_zone) BETWEEN 1 AND 64);
+ALTER TABLE expenses ADD COLUMN time_zone TEXT NULL
+    CONSTRAINT ck_normal_size_time_zone_64 CHECK (time_zone IS NULL OR LENGTH(time_zone) BETWEEN 1 AND 64);
+
+UPDATE sessions SET
+    start_at_date_time = COALESCE(strftime('%Y-%m-%dT%H:%M:%f', start_at_date_time) || '000000Z', start_at_date_time),
+    end_at_date_time   = COALESCE(strftime('%Y-%m-%dT%H:%M:%f', end_at_date_time)   || '000000Z', end_at_date_time);
+UPDATE expenses SET
+    date_time = COALESCE(strftime('%Y-%m-%dT%H:%M:%f', date_time) || '000000Z', date_time);
+
+-- A version set by the update is a change applied by sync, kept as is
+CREATE TRIGGER sessions_sync_update AFTER UPDATE ON sessions WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE sessions SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER expenses_sync_update AFTER UPDATE ON expenses WHEN NEW.sync_seq IS OLD.sync_seq BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    UPDATE expenses SET
+        version    = CASE WHEN NEW.version = OLD.version THEN OLD.version + 1 ELSE NEW.version END,
+        updated_at = CASE WHEN NEW.version = OLD.version THEN strftime('%Y-%m-%dT%H:%M:%fZ', 'now') ELSE NEW.updated_at END,
+        sync_seq   = (SELECT value FROM sync_state WHERE key = 'seq')
+    WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER sessions_sync_delete AFTER DELETE ON sessions BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        public_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.public_id, 'sessions', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'client_id', OLD.client_id,
+            'location', OLD.location,
+            'trip_start_location', OLD.trip_start_location,
+            'trip_end_location', OLD.trip_end_location,
+            'start_at_date_time', OLD.start_at_date_time,
+            'end_at_date_time', OLD.end_at_date_time,
+            'time_zone', OLD.time_zone
+        )
+    );
+END;
+
+CREATE TRIGGER expenses_sync_delete AFTER DELETE ON expenses BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        public_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.public_id, 'expenses', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'session_id', OLD.session_id,
+            'type_id', OLD.type_id,
+            'currency', OLD.currency,
+            'notes', OLD.notes,
+            'date_time', OLD.date_time,
+            'country', OLD.country,
+            'time_zone', OLD.time_zone
+        )
+    );
+END;
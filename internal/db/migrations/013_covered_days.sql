@@ -0,0 +1,26 @@
+-- Expenses covering several days from their date (hotel nights, weekly pass),
+-- spread evenly over these days by period reports. NULL is one day.
+
+DROP TRIGGER expenses_sync_delete;
+
+ALTER TABLE expenses ADD COLUMN covered_days INTEGER NULL
+    CONSTRAINT ck_covered_days_1_366 CHECK (covered_days IS NULL OR covered_days BETWEEN 1 AND 366);
+
+CREATE TRIGGER expenses_sync_delete AFTER DELETE ON expenses BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        public_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.public_id, 'expenses', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'session_id', OLD.session_id,
+            'type_id', OLD.type_id,
+            'currency', OLD.currency,
+            'notes', OLD.notes,
+            'date_time', OLD.date_time,
+            'country', OLD.country,
+            'time_zone', OLD.time_zone,
+            'covered_days', OLD.covered_days
+        )
+    );
+END;
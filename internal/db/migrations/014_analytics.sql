@@ -0,0 +1,36 @@
+-- Where the money went: the merchant of an expense (read from its receipt by
+-- OCR, or entered), and the indexes of the dashboard queries (services
+-- analytics). Dates are filtered on date_time first, then on their local date.
+
+DROP TRIGGER expenses_sync_delete;
+
+ALTER TABLE expenses ADD COLUMN merchant TEXT NULL
+    CONSTRAINT ck_normal_size_merchant_100 CHECK (merchant IS NULL OR LENGTH(merchant) BETWEEN 1 AND 100);
+
+CREATE TRIGGER expenses_sync_delete AFTER DELETE ON expenses BEGIN
+    UPDATE sync_state SET value = value + 1 WHERE key = 'seq';
+    INSERT OR REPLACE INTO sync_tombstones(
+        public_id, table_name, row_id, version, deleted_at, sync_seq, row_values
+    ) VALUES (
+        OLD.public_id, 'expenses', OLD.id, OLD.version + 1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'), (SELECT value FROM sync_state WHERE key = 'seq'),
+        json_object(
+            'session_id', OLD.session_id,
+            'type_id', OLD.type_id,
+            'currency', OLD.currency,
+            'notes', OLD.notes,
+            'date_time', OLD.date_time,
+            'country', OLD.country,
+            'time_zone', OLD.time_zone,
+            'covered_days', OLD.covered_days,
+            'merchant', OLD.merchant
+        )
+    );
+END;
+
+CREATE INDEX ix_expenses_date_time  ON expenses(date_time);
+CREATE INDEX ix_expenses_type_id    ON expenses(type_id, date_time);
+CREATE INDEX ix_expenses_session_id ON expenses(session_id, date_time);
+CREATE INDEX ix_expenses_merchant   ON expenses(merchant COLLATE NOCASE) WHERE merchant IS NOT NULL;
+CREATE INDEX ix_line_items_expense_id ON line_items(expense_id);
+CREATE INDEX ix_sessions_client_id  ON sessions(client_id);
+CREATE INDEX ix_car_trips_date_only ON car_trips(date_only);
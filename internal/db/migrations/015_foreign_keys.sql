@@ -0,0 +1,43 @@
+-- Foreign keys are enforced on every connection from now on (see db
+-- connection): every reference gets an index, as deleting a row looks them up.
+
+-- An occurrence keeps the ID of its expense once the expense is deleted, so
+-- that the date is not generated again and sync finds the expense tombstone:
+-- a history, not a reference. Rebuilt without its foreign key on expenses.
+DROP TRIGGER recurring_expenses_delete_occurrences;
+
+CREATE TABLE recurring_occurrences_new (
+    recurring_expense_id INTEGER NOT NULL,
+    date_only            TEXT    NOT NULL,
+    expense_id           INTEGER NOT NULL,
+
+    PRIMARY KEY (recurring_expense_id, date_only),
+    FOREIGN KEY (recurring_expense_id) REFERENCES recurring_expenses(id),
+
+    CONSTRAINT ck_date_only_date_only CHECK (LENGTH(date_only) = 10)
+);
+INSERT INTO recurring_occurrences_new (recurring_expense_id, date_only, expense_id)
+    SELECT recurring_expense_id, date_only, expense_id FROM recurring_occurrences;
+DROP TABLE recurring_occurrences;
+ALTER TABLE recurring_occurrences_new RENAME TO recurring_occurrences;
+CREATE INDEX ix_recurring_occurrences_expense_id ON recurring_occurrences(expense_id);
+
+CREATE TRIGGER recurring_expenses_delete_occurrences AFTER DELETE ON recurring_expenses BEGIN
+    DELETE FROM recurring_occurrences WHERE recurring_expense_id = OLD.id;
+END;
+CREATE TRIGGER recurring_occurrences_sync_insert AFTER INSERT ON recurring_occurrences BEGIN
+    UPDATE recurring_expenses SET version = version WHERE id = NEW.recurring_expense_id;
+END;
+CREATE TRIGGER recurring_occurrences_sync_delete AFTER DELETE ON recurring_occurrences BEGIN
+    UPDATE recurring_expenses SET version = version WHERE id = OLD.recurring_expense_id;
+END;
+
+CREATE INDEX ix_car_trips_session_id            ON car_trips(session_id);
+CREATE INDEX ix_recurring_expenses_type_id      ON recurring_expenses(type_id);
+CREATE INDEX ix_recurring_expenses_session_id   ON recurring_expenses(session_id);
+CREATE INDEX ix_recurring_expenses_client_id    ON recurring_expenses(client_id);
+CREATE INDEX ix_recurring_expenses_start_date   ON recurring_expenses(start_date);
+CREATE INDEX ix_sessions_start_at_date_time     ON sessions(start_at_date_time);
+CREATE INDEX ix_sessions_end_at_date_time       ON sessions(end_at_date_time);
+CREATE INDEX ix_tax_rates_country_valid_from    ON tax_rates(country, valid_from);
+DROP INDEX ix_tax_rates_country;
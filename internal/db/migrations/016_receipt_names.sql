@@ -0,0 +1,4 @@
+-- Receipt files are named after their stored content (see db.ReceiptName),
+-- the sync server checks uploads against their name. Receipts named
+-- otherwise are renamed by the Go side of this migration (see
+-- db.renameReceiptFiles), nothing changes in the schema.
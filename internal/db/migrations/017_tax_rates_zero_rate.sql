@@ -0,0 +1,40 @@
+-- ck_limit_size_rate_60 rejected 0% rates, so zero-rated categories couldn't
+-- be listed. SQLite can't alter a constraint, so the table is rebuilt.
+CREATE TABLE tax_rates_new (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    country    TEXT    NOT NULL,
+    label      TEXT    NOT NULL,
+    rate       REAL    NOT NULL,
+    valid_from TEXT        NULL,
+    valid_to   TEXT        NULL,
+    public_id  TEXT        NULL,
+
+    CONSTRAINT ux_tax_rates_country_label_from UNIQUE (country, label, valid_from),
+    CONSTRAINT ck_normal_size_country_2  CHECK (LENGTH(country) == 2),
+    CONSTRAINT ck_normal_size_label_20   CHECK (LENGTH(label) BETWEEN 1 AND 20),
+    CONSTRAINT ck_limit_size_rate_60     CHECK (rate >= 0 AND rate <= 60),
+    CONSTRAINT ck_normal_size_valid_10   CHECK (
+        (valid_from IS NULL OR LENGTH(valid_from) == 10) AND
+        (valid_to   IS NULL OR LENGTH(valid_to)   == 10)
+    ),
+    CONSTRAINT ck_valid_period           CHECK (
+        valid_from IS NULL OR valid_to IS NULL OR valid_from <= valid_to
+    )
+);
+
+INSERT INTO tax_rates_new(id, country, label, rate, valid_from, valid_to, public_id)
+    SELECT id, country, label, rate, valid_from, valid_to, public_id FROM tax_rates;
+
+DROP TABLE tax_rates;
+ALTER TABLE tax_rates_new RENAME TO tax_rates;
+
+CREATE UNIQUE INDEX ux_tax_rates_public_id ON tax_rates(public_id);
+CREATE INDEX ix_tax_rates_country_valid_from ON tax_rates(country, valid_from);
+
+CREATE TRIGGER tax_rates_public_id AFTER INSERT ON tax_rates WHEN NEW.public_id IS NULL BEGIN
+    UPDATE tax_rates SET public_id = substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 1, 8) || '-' ||
+            substr(printf('%012x', CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER)), 9, 4) || '-7' ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+            substr(lower(hex(randomblob(2))), 2, 3) || '-' || lower(hex(randomblob(6)))
+    WHERE id = NEW.id;
+END;
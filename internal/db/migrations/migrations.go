@@ -0,0 +1,17 @@
+package migrations
+
+import "embed"
+
+
+// Numbered schema files (001_*.sql...) applied in order by db.InitDB, packs
+// of standard expense types in standard_models/ (see db.StandardModel) and
+// the optional full-text index in search/
+//
+//go:embed *.sql standard_models/*.json search/*.sql
+var FS embed.FS
+
+const (
+    StandardModelsDir = "standard_models"
+    SearchIndexFile   = "search/search_index.sql"
+    SearchRebuildFile = "search/rebuild.sql"
+)
@@ -0,0 +1,21 @@
+-- Fill the search index from scratch, after it was created or when tables
+-- were rebuilt by a migration (dropping their triggers)
+DELETE FROM search_index;
+
+INSERT INTO search_index (kind, entity_id, field, body)
+SELECT 'client', id, 'name', name FROM clients;
+
+INSERT INTO search_index (kind, entity_id, field, body)
+SELECT 'session', id, 'location', location FROM sessions
+UNION ALL
+SELECT 'session', id, 'trip_start_location', trip_start_location FROM sessions
+WHERE trip_start_location IS NOT NULL
+UNION ALL
+SELECT 'session', id, 'trip_end_location', trip_end_location FROM sessions
+WHERE trip_end_location IS NOT NULL;
+
+INSERT INTO search_index (kind, entity_id, field, body)
+SELECT 'expense_type', id, 'name', name FROM expense_types;
+
+INSERT INTO search_index (kind, entity_id, field, body)
+SELECT 'expense', id, 'notes', notes FROM expenses WHERE notes IS NOT NULL;
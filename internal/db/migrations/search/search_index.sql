@@ -0,0 +1,75 @@
+-- Full-text index over the free text of the other tables, kept in sync by
+-- triggers. Only set up when SQLite is built with FTS5 (see db.InitDB), so it
+-- is not a numbered migration.
+CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+    kind      UNINDEXED,
+    entity_id UNINDEXED,
+    field     UNINDEXED,
+    body,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS search_index_clients_insert AFTER INSERT ON clients BEGIN
+    INSERT INTO search_index (kind, entity_id, field, body)
+    VALUES ('client', NEW.id, 'name', NEW.name);
+END;
+CREATE TRIGGER IF NOT EXISTS search_index_clients_update AFTER UPDATE ON clients BEGIN
+    DELETE FROM search_index WHERE kind = 'client' AND entity_id = OLD.id;
+    INSERT INTO search_index (kind, entity_id, field, body)
+    VALUES ('client', NEW.id, 'name', NEW.name);
+END;
+CREATE TRIGGER IF NOT EXISTS search_index_clients_delete AFTER DELETE ON clients BEGIN
+    DELETE FROM search_index WHERE kind = 'client' AND entity_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS search_index_sessions_insert AFTER INSERT ON sessions BEGIN
+    INSERT INTO search_index (kind, entity_id, field, body)
+    SELECT 'session', NEW.id, 'location', NEW.location
+    UNION ALL
+    SELECT 'session', NEW.id, 'trip_start_location', NEW.trip_start_location
+    WHERE NEW.trip_start_location IS NOT NULL
+    UNION ALL
+    SELECT 'session', NEW.id, 'trip_end_location', NEW.trip_end_location
+    WHERE NEW.trip_end_location IS NOT NULL;
+END;
+CREATE TRIGGER IF NOT EXISTS search_index_sessions_update AFTER UPDATE ON sessions BEGIN
+    DELETE FROM search_index WHERE kind = 'session' AND entity_id = OLD.id;
+    INSERT INTO search_index (kind, entity_id, field, body)
+    SELECT 'session', NEW.id, 'location', NEW.location
+    UNION ALL
+    SELECT 'session', NEW.id, 'trip_start_location', NEW.trip_start_location
+    WHERE NEW.trip_start_location IS NOT NULL
+    UNION ALL
+    SELECT 'session', NEW.id, 'trip_end_location', NEW.trip_end_location
+    WHERE NEW.trip_end_location IS NOT NULL;
+END;
+CREATE TRIGGER IF NOT EXISTS search_index_sessions_delete AFTER DELETE ON sessions BEGIN
+    DELETE FROM search_index WHERE kind = 'session' AND entity_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS search_index_expense_types_insert AFTER INSERT ON expense_types BEGIN
+    INSERT INTO search_index (kind, entity_id, field, body)
+    VALUES ('expense_type', NEW.id, 'name', NEW.name);
+END;
+CREATE TRIGGER IF NOT EXISTS search_index_expense_types_update AFTER UPDATE ON expense_types BEGIN
+    DELETE FROM search_index WHERE kind = 'expense_type' AND entity_id = OLD.id;
+    INSERT INTO search_index (kind, entity_id, field, body)
+    VALUES ('expense_type', NEW.id, 'name', NEW.name);
+END;
+CREATE TRIGGER IF NOT EXISTS search_index_expense_types_delete AFTER DELETE ON expense_types BEGIN
+    DELETE FROM search_index WHERE kind = 'expense_type' AND entity_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS search_index_expenses_insert AFTER INSERT ON expenses
+WHEN NEW.notes IS NOT NULL BEGIN
+    INSERT INTO search_index (kind, entity_id, field, body)
+    VALUES ('expense', NEW.id, 'notes', NEW.notes);
+END;
+CREATE TRIGGER IF NOT EXISTS search_index_expenses_update AFTER UPDATE ON expenses BEGIN
+    DELETE FROM search_index WHERE kind = 'expense' AND entity_id = OLD.id;
+    INSERT INTO search_index (kind, entity_id, field, body)
+    SELECT 'expense', NEW.id, 'notes', NEW.notes WHERE NEW.notes IS NOT NULL;
+END;
+CREATE TRIGGER IF NOT EXISTS search_index_expenses_delete AFTER DELETE ON expenses BEGIN
+    DELETE FROM search_index WHERE kind = 'expense' AND entity_id = OLD.id;
+END;
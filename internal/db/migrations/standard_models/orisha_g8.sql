@@ -1,11 +0,0 @@
--- TODO correct taxes
-INSERT INTO expense_types(name) VALUES ("PEAGE");
-INSERT INTO expense_types(name) VALUES ("PARKING");
-INSERT INTO expense_types(name) VALUES ("AF/SNCF");
-INSERT INTO expense_types(name) VALUES ("LOC VOITURE");
-INSERT INTO expense_types(name) VALUES ("HOTEL");
-INSERT INTO expense_types(name) VALUES ("REPAS MIDI");
-INSERT INTO expense_types(name) VALUES ("REPAS SOIR");
-INSERT INTO expense_types(name) VALUES ("GASOIL");
-INSERT INTO expense_types(name) VALUES ("ACHAT Div");
-INSERT INTO expense_types(name) VALUES ("Boissons alcoolisées");
@@ -6,9 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/craftidev/expenseflow/config"
@@ -16,8 +19,13 @@ import (
 )
 
 
-// List of models: Client, Session, CarTrip, ExpenseType, Expense, LineItem
-// Iterables: ExpenseList, LineItemList
+// List of models: Client, Session, CarTrip, ExpenseType, Expense, Receipt, LineItem,
+// TaxRate, Tag, CustomField, CustomFieldValue, RecurringExpense, RecurringOccurrence,
+// Allocation (Schedule of recurring expenses is in schedule.go)
+// Iterables: ExpenseList, ReceiptList, LineItemList, TaxeRateList, CustomFieldOptions,
+// LineItemTemplateList, AllocationList
+
+// Models with an ID also have a PublicID, set by the database (see ValidPublicID)
 
 // By order of less strict to more strict for validation:
 // - PreInsertValid (no ID is ok for insert) <
@@ -28,8 +36,9 @@ import (
 // Client
 // Methods: String, PreInsertValid, Valid
 type Client struct {
-	ID   int64
-	Name string
+	ID       int64
+	PublicID string
+	Name     string
 }
 
 func (c Client) String() string {
@@ -37,32 +46,35 @@ func (c Client) String() string {
 }
 
 func (c Client) PreInsertValid() error {
-	if c.Name == "" {
-		return utils.LogError("name must be non-zero")
-	}
-	if len([]rune(c.Name)) > 100 {
-		return utils.LogError("client name exceeds maximum length of 100 characters")
-	}
-	return nil
+	v := utils.Validator{}
+	c.validate(&v)
+	return v.Err()
+}
+
+func (c Client) validate(v *utils.Validator) {
+	validateText(v, "name", c.Name, 100)
 }
 
 func (c Client) Valid() error {
-	if c.ID <= 0 {
-		return utils.LogError("client ID must be positive and non-zero")
-	}
-	return c.PreInsertValid()
+	v := utils.Validator{}
+	validateID(&v, c.ID, c.PublicID)
+	c.validate(&v)
+	return v.Err()
 }
 
 // Session
-// Methods: String, PreInsertValid, Valid, PreReportValid
+// Methods: String, PreInsertValid, Valid, LocalTimes, PreReportValid
 type Session struct {
 	ID                int64
+	PublicID          string
 	ClientID          int64
 	Location          string
 	TripStartLocation sql.NullString
 	TripEndLocation   sql.NullString
 	StartAtDateTime   NullableTime
 	EndAtDateTime     NullableTime
+	// IANA name, where the session takes place (see TimeZoneLocation)
+	TimeZone          sql.NullString
 }
 
 func (s Session) String() string {
@@ -75,12 +87,13 @@ func (s Session) String() string {
 		format += " > " + s.TripEndLocation.String
 	}
 	format += "\n[ "
-	if s.StartAtDateTime.Valid {
-		format += s.StartAtDateTime.Time.Format(time.DateOnly)
+	start, end := s.LocalTimes()
+	if start.Valid {
+		format += start.Time.Format(time.DateOnly)
 	}
 	format += " - "
-	if s.EndAtDateTime.Valid {
-		format += s.EndAtDateTime.Time.Format(time.DateOnly)
+	if end.Valid {
+		format += end.Time.Format(time.DateOnly)
 	}
 	format += " ]"
 
@@ -88,51 +101,57 @@ func (s Session) String() string {
 }
 
 func (s Session) PreInsertValid() error {
-    switch {
-    case    s.ClientID <= 0 ||
-            s.Location == "" ||
-            s.TripStartLocation.Valid && s.TripStartLocation.String == "" ||
-            s.TripEndLocation.Valid && s.TripEndLocation.String == "" ||
-            s.StartAtDateTime.Valid && s.StartAtDateTime.Time.IsZero() ||
-            s.EndAtDateTime.Valid && s.EndAtDateTime.Time.IsZero():
-		return utils.LogError(`
-            client ID, location, trip start/end location and
-            start/end at date time, cannot be empty or negative
-        `)
-    case    s.EndAtDateTime.Valid &&
-            s.StartAtDateTime.Valid &&
-            s.StartAtDateTime.Time.After(s.EndAtDateTime.Time):
-		return utils.LogError("start date must be before end date")
-    case    len([]rune(s.Location)) > 100 ||
-            (s.TripStartLocation.Valid && len([]rune(s.TripStartLocation.String)) > 100) ||
-            (s.TripEndLocation.Valid &&len([]rune(s.TripEndLocation.String)) > 100):
-		return utils.LogError(
-			"location, trip start location, and trip end location " +
-			"cannot exceed maximum length of 100 characters",
-        )
-    default:
-        return nil
-    }
+	v := utils.Validator{}
+	s.validate(&v)
+	return v.Err()
 }
 
-func (s Session) Valid() error {
-	if s.ID <= 0 {
-		return utils.LogError("session ID must be positive and non-zero")
+func (s Session) validate(v *utils.Validator) {
+	v.Positive("client_id", float64(s.ClientID))
+	validateText(v, "location", s.Location, 100)
+	validateNullText(v, "trip_start_location", s.TripStartLocation, 100)
+	validateNullText(v, "trip_end_location", s.TripEndLocation, 100)
+	v.Required("start_at_date_time", !s.StartAtDateTime.Valid || !s.StartAtDateTime.Time.IsZero())
+	v.Required("end_at_date_time", !s.EndAtDateTime.Valid || !s.EndAtDateTime.Time.IsZero())
+	if s.StartAtDateTime.Valid && s.EndAtDateTime.Valid {
+		v.Check(
+			!s.StartAtDateTime.Time.After(s.EndAtDateTime.Time), "end_at_date_time",
+			utils.ViolationOrder, map[string]any{"after": "start_at_date_time"},
+			"start date must be before end date",
+		)
 	}
-	return s.PreInsertValid()
+	validateNullTimeZone(v, "time_zone", s.TimeZone)
+}
+
+// Start and end in the time zone of the session, their dates are local ones
+func (s Session) LocalTimes() (NullableTime, NullableTime) {
+	start, end := s.StartAtDateTime, s.EndAtDateTime
+	start.Time = InTimeZone(start.Time, s.TimeZone)
+	end.Time = InTimeZone(end.Time, s.TimeZone)
+	return start, end
+}
+
+func (s Session) Valid() error {
+	v := utils.Validator{}
+	validateID(&v, s.ID, s.PublicID)
+	s.validate(&v)
+	return v.Err()
 }
 
 func (s Session) PreReportValid() error {
-	if !s.StartAtDateTime.Valid || !s.EndAtDateTime.Valid {
-		return utils.LogError("start date and end date cannot be empty")
-	}
-	return s.Valid()
+	v := utils.Validator{}
+	validateID(&v, s.ID, s.PublicID)
+	s.validate(&v)
+	v.Required("start_at_date_time", s.StartAtDateTime.Valid)
+	v.Required("end_at_date_time", s.EndAtDateTime.Valid)
+	return v.Err()
 }
 
 // CarTrip
 // Methods: String, PreInsertValid, Valid
 type CarTrip struct {
 	ID         int64
+	PublicID   string
 	SessionID  sql.NullInt64
 	DistanceKM float64
 	DateOnly   string
@@ -149,43 +168,40 @@ func (ct CarTrip) String() string {
 }
 
 func (ct CarTrip) PreInsertValid() error {
-	dateTimeFormat, err := time.Parse(time.DateOnly, ct.DateOnly)
-	if err != nil || len([]rune(ct.DateOnly)) != 10 {
-		return utils.LogError(
-            "invalid date format, expected yyyy-mm-dd, got: %v. Error: %v",
-            err, ct.DateOnly,
-        )
-	}
+	v := utils.Validator{}
+	ct.validate(&v)
+	return v.Err()
+}
 
-	switch {
-    case ct.SessionID.Valid && ct.SessionID.Int64 <= 0:
-        return utils.LogError("session ID must be positive and non-zero")
-	case ct.DistanceKM == 0 || dateTimeFormat.IsZero():
-		return utils.LogError("distance km and datetime must be non zero")
-	case ct.DistanceKM < 0:
-		return utils.LogError("distance km must be positive")
-	case ct.DistanceKM > config.MaxFloat:
-		return utils.LogError(
-			"distance km must be less than custom float limit: %v",
-			config.MaxFloat,
-		)
-	default:
-		return nil
-	}
+func (ct CarTrip) validate(v *utils.Validator) {
+	validateNullID(v, "session_id", ct.SessionID)
+	validateDate(v, "date_only", ct.DateOnly)
+	v.Required("date_only", ct.DateOnly != time.Time{}.Format(time.DateOnly))
+	v.Positive("distance_km", ct.DistanceKM)
+	v.Max("distance_km", ct.DistanceKM, config.MaxFloat)
 }
 
 func (ct CarTrip) Valid() error {
-	if ct.ID <= 0 {
-		return utils.LogError("car trip ID must be positive and non-zero")
-	}
-	return ct.PreInsertValid()
+	v := utils.Validator{}
+	validateID(&v, ct.ID, ct.PublicID)
+	ct.validate(&v)
+	return v.Err()
 }
 
 // ExpenseType
 // Methods: String, PreInsertValid, Valid
 type ExpenseType struct {
-	ID   int64
-	Name string // TODO: check UNIQUE in crud
+	ID               int64
+	PublicID         string
+	Name             string // TODO: check UNIQUE in crud
+	DefaultTaxeRates TaxeRateList
+	AccountingCode   sql.NullString
+	Reimbursable     bool
+	// VAT paid on it can be claimed back, see services.BuildVATReport
+	VATRecoverable   bool
+	Description      sql.NullString
+	// "pack:key" of the standard model it comes from, if any
+	ModelRef         sql.NullString
 }
 
 func (et ExpenseType) String() string {
@@ -193,42 +209,54 @@ func (et ExpenseType) String() string {
 }
 
 func (et ExpenseType) PreInsertValid() error {
-	if et.Name == "" {
-		return utils.LogError("name must be non-zero")
-	}
-	if len([]rune(et.Name)) > 50 {
-		return utils.LogError("name cannot exceed maximum length of 50 characters")
-	}
-	return nil
+	v := utils.Validator{}
+	et.validate(&v)
+	return v.Err()
+}
+
+func (et ExpenseType) validate(v *utils.Validator) {
+	validateText(v, "name", et.Name, 50)
+	validateNullText(v, "accounting_code", et.AccountingCode, 20)
+	validateNullText(v, "description", et.Description, 200)
+	validateNullText(v, "model_ref", et.ModelRef, 60)
+	et.DefaultTaxeRates.validate(v, "default_taxe_rates")
 }
 
 func (et ExpenseType) Valid() error {
-	if et.ID <= 0 {
-		return utils.LogError("expense type ID must be positive and non-zero")
-	}
-	return et.PreInsertValid()
+	v := utils.Validator{}
+	validateID(&v, et.ID, et.PublicID)
+	et.validate(&v)
+	return v.Err()
 }
 
 // Expense
-// Methods: String, PreInsertValid, Valid, PreReportValid
+// Methods: String, PreInsertValid, Valid, LocalTime, LocalDate, Days, PreReportValid
 type Expense struct {
 	ID             int64
+	PublicID       string
 	SessionID      sql.NullInt64
 	TypeID         int64
 	Currency       string
-	ReceiptRelPath sql.NullString
 	Notes          sql.NullString
 	DateTime       time.Time
+	// ISO 3166-1 alpha-2, line items are checked against its TaxRates
+	Country        sql.NullString
+	// IANA name, where the expense happened (see TimeZoneLocation)
+	TimeZone       sql.NullString
+	// Days covered from its date (hotel nights, weekly pass), one when null,
+	// at most MaxCoveredDays
+	CoveredDays    sql.NullInt64
+	// Shop, hotel or company paid, as on the receipt
+	Merchant       sql.NullString
 }
 
+const MaxCoveredDays = 366
+
 func (e Expense) String() string {
 	format := fmt.Sprintf(
 		"Type: %v (%v) @ %v",
-		e.TypeID, e.Currency, e.DateTime.Format(time.DateOnly),
+		e.TypeID, e.Currency, e.LocalDate(),
 	)
-	if e.ReceiptRelPath.Valid {
-		format += fmt.Sprintf("\n%v", e.ReceiptRelPath)
-	}
 	if e.Notes.Valid {
 		format += fmt.Sprintf("\nNotes: %v", e.Notes)
 	}
@@ -236,98 +264,185 @@ func (e Expense) String() string {
 }
 
 func (e Expense) PreInsertValid() error {
-	switch {
-	case    e.TypeID == 0 ||
-            e.Currency == "" ||
-            e.DateTime.IsZero() ||
-            (e.ReceiptRelPath.Valid && e.ReceiptRelPath.String == "") ||
-            (e.Notes.Valid && e.Notes.String == ""):
-		return utils.LogError(
-			"type id, currency, receipt url, notes and date time must be non-zero",
-		)
-	case e.SessionID.Valid && e.SessionID.Int64 <= 0:
-		return utils.LogError("session ID must be positive and non-zero")
-	case e.TypeID <= 0:
-		return utils.LogError("type ID must be positive and non-zero.")
-	case len([]rune(e.Currency)) > 10:
-		return utils.LogError("currency can't exceeds 10 characters")
-	case e.ReceiptRelPath.Valid && len([]rune(e.ReceiptRelPath.String)) > 50:
-		return utils.LogError("receipt URL can't exceeds 50 characters")
-	case e.Notes.Valid && len([]rune(e.Notes.String)) > 150:
-		return utils.LogError("notes can't exceeds 150 characters")
-	default:
-		return nil
+	v := utils.Validator{}
+	e.validate(&v)
+	return v.Err()
+}
+
+func (e Expense) validate(v *utils.Validator) {
+	validateNullID(v, "session_id", e.SessionID)
+	v.Positive("type_id", float64(e.TypeID))
+	validateText(v, "currency", e.Currency, 10)
+	validateNullText(v, "notes", e.Notes, 150)
+	v.Required("date_time", !e.DateTime.IsZero())
+	validateNullCountry(v, "country", e.Country)
+	validateNullTimeZone(v, "time_zone", e.TimeZone)
+	if e.CoveredDays.Valid {
+		v.Range("covered_days", float64(e.CoveredDays.Int64), 1, MaxCoveredDays)
+	}
+	validateNullText(v, "merchant", e.Merchant, 100)
+}
+
+// Date and time where the expense happened
+func (e Expense) LocalTime() time.Time {
+	return InTimeZone(e.DateTime, e.TimeZone)
+}
+
+// Day of the expense for reports and per day rules, yyyy-mm-dd
+func (e Expense) LocalDate() string {
+	return e.LocalTime().Format(time.DateOnly)
+}
+
+// Local days covered by the expense, from its date
+func (e Expense) Days() int {
+	if e.CoveredDays.Valid {
+		return int(e.CoveredDays.Int64)
 	}
+	return 1
 }
 
 func (e Expense) Valid() error {
-	if e.ID <= 0 {
-		return utils.LogError("expense ID must be positive and non-zero")
+	v := utils.Validator{}
+	validateID(&v, e.ID, e.PublicID)
+	e.validate(&v)
+	return v.Err()
+}
+
+// Receipts are stored apart (see Receipt), a reported expense needs at least
+// one and all of them readable
+func (e Expense) PreReportValid(receipts ReceiptList) error {
+	v := utils.Validator{}
+	validateID(&v, e.ID, e.PublicID)
+	e.validate(&v)
+	v.Check(
+		len(receipts) > 0, "receipts", utils.ViolationRequired, nil,
+		"expense (ID: %d) has no receipt", e.ID,
+	)
+	for i, receipt := range receipts {
+		field := fmt.Sprintf("receipts[%d]", i)
+		v.Check(
+			receipt.ExpenseID == e.ID, field, utils.ViolationInvalid, nil,
+			"receipt (ID: %d) doesn't belong to expense (ID: %d)", receipt.ID, e.ID,
+		)
+		v.Merge(field, receipt.CheckFile())
 	}
-	return e.PreInsertValid()
+	return v.Err()
 }
 
-func (e Expense) PreReportValid() error {
-	if err := e.checkReceipt(); err != nil {
-		return err
+// Receipt
+// Methods: String, PreInsertValid, Valid, CheckFile
+// A file in config.ReceiptsDir attached to an expense, Position orders the
+// files of one expense (pages, invoice then card slip...)
+type Receipt struct {
+	ID        int64
+	PublicID  string
+	ExpenseID int64
+	RelPath   string
+	Position  int
+}
+
+func (r Receipt) String() string {
+	return fmt.Sprintf("Expense ID: %d - %v (#%d)", r.ExpenseID, r.RelPath, r.Position)
+}
+
+func (r Receipt) PreInsertValid() error {
+	v := utils.Validator{}
+	r.validate(&v)
+	return v.Err()
+}
+
+func (r Receipt) validate(v *utils.Validator) {
+	v.Positive("expense_id", float64(r.ExpenseID))
+	validateText(v, "rel_path", r.RelPath, 50)
+	if r.RelPath != "" {
+		v.Format("rel_path", filepath.Base(r.RelPath) == r.RelPath, "a file name")
 	}
-	return e.Valid()
+	v.Check(
+		r.Position >= 0, "position", utils.ViolationRange, map[string]any{"min": 0},
+		"receipt position can't be negative",
+	)
 }
 
-func (e Expense) checkReceipt() error {
-    if !e.ReceiptRelPath.Valid {
-		return utils.LogError("receipt URL is empty")
-    }
-	receiptFullPath := filepath.Join(config.ReceiptsDir, e.ReceiptRelPath.String)
+func (r Receipt) Valid() error {
+	v := utils.Validator{}
+	validateID(&v, r.ID, r.PublicID)
+	r.validate(&v)
+	return v.Err()
+}
+
+// Receipt file exists in config.ReceiptsDir and is a supported format
+func (r Receipt) CheckFile() error {
+	if r.RelPath == "" {
+		return utils.ValidationError([]string{"rel_path"}, "receipt URL is empty")
+	}
+	receiptFullPath := filepath.Join(config.ReceiptsDir, r.RelPath)
 	_, errOs := os.Stat(receiptFullPath)
-	errIsImageFile := isImageFile(receiptFullPath)
 
 	switch {
-    case e.ReceiptRelPath.String == "":
-		return utils.LogError("receipt URL is empty")
 	case errors.Is(errOs, os.ErrNotExist):
-		return utils.LogError("invalid receipt URL: %v", errOs)
+		return utils.IntegrityError("invalid receipt URL: %v", errOs)
 	case errOs != nil:
 		return utils.LogError("undefined file error: %v", errOs)
-	case errIsImageFile != nil:
-		return errIsImageFile
 	default:
-		return nil
+		_, err := ReceiptContentType(receiptFullPath)
+		return err
 	}
 }
 
-func isImageFile(filePath string) error {
-	receiptImage, err := os.Open(filePath)
+// Content type of a receipt file from its header: one of the images the
+// standard library detects, PDF or HEIC/HEIF
+func ReceiptContentType(filePath string) (string, error) {
+	receiptFile, err := os.Open(filePath)
 	if err != nil {
-		return utils.LogError("error opening receipt image: %v", err)
+		return "", utils.LogError("error opening receipt file: %v", err)
 	}
-	defer receiptImage.Close()
+	defer receiptFile.Close()
 
 	// Read file header to determine content type
 	buffer := make([]byte, 512)
-	n, err := receiptImage.Read(buffer)
+	n, err := receiptFile.Read(buffer)
 	if err != nil && err != io.EOF {
-		return utils.LogError(
-			"error reading headers of receipt image: %v", err,
+		return "", utils.LogError(
+			"error reading headers of receipt file: %v", err,
 		)
 	}
 
 	buffer = buffer[:n] // Adjust buffer size to the actual number of bytes read
+	if isHEIF(buffer) {
+		return "image/heic", nil
+	}
 	contentType := http.DetectContentType(buffer)
 	switch contentType {
-	case "image/jpeg", "image/png", "image/gif", "image/bmp", "image/webp":
-		return nil
+	case "image/jpeg", "image/png", "image/gif", "image/bmp", "image/webp",
+		"application/pdf":
+		return contentType, nil
 	default:
-		return utils.LogError(
-			"invalid receipt image type %s: %s", filePath, contentType,
+		return "", utils.ValidationError(
+			[]string{"file"},
+			"invalid receipt file type %s: %s", filePath, contentType,
 		)
 	}
 }
 
+// ISO base media file starting with a ftyp box of a HEIF brand, as
+// http.DetectContentType doesn't know them
+func isHEIF(header []byte) bool {
+	if len(header) < 12 || string(header[4:8]) != "ftyp" {
+		return false
+	}
+	switch string(header[8:12]) {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+		return true
+	default:
+		return false
+	}
+}
+
 // LineItem
 // Method: String, PreInsertValid, Valid
 type LineItem struct {
 	ID        int64
+	PublicID  string
 	ExpenseID int64
 	TaxeRate  float64
 	Total     float64
@@ -341,30 +456,526 @@ func (li LineItem) String() string {
 }
 
 func (li LineItem) PreInsertValid() error {
-	switch {
-	case li.ExpenseID <= 0 || li.Total <= 0:
-		return utils.LogError(
-			"expense ID and total must be non-zero and  positive",
+	v := utils.Validator{}
+	li.validate(&v)
+	return v.Err()
+}
+
+func (li LineItem) validate(v *utils.Validator) {
+	v.Positive("expense_id", float64(li.ExpenseID))
+	validateLineAmounts(v, "", li.TaxeRate, li.Total)
+}
+
+func (li LineItem) Valid() error {
+	v := utils.Validator{}
+	validateID(&v, li.ID, li.PublicID)
+	li.validate(&v)
+	return v.Err()
+}
+
+
+// TaxRate
+// Methods: String, PreInsertValid, Valid, ValidOn
+type TaxRate struct {
+	ID        int64
+	PublicID  string
+	Country   string
+	Label     string // standard, reduced, reduced_2, super_reduced...
+	Rate      float64
+	// yyyy-mm-dd, both inclusive and open ended when NULL
+	ValidFrom sql.NullString
+	ValidTo   sql.NullString
+}
+
+func (tr TaxRate) String() string {
+	format := fmt.Sprintf("%v %v %v%%", tr.Country, tr.Label, tr.Rate)
+	if tr.ValidFrom.Valid {
+		format += fmt.Sprintf(" from %v", tr.ValidFrom.String)
+	}
+	if tr.ValidTo.Valid {
+		format += fmt.Sprintf(" to %v", tr.ValidTo.String)
+	}
+	return format
+}
+
+func (tr TaxRate) PreInsertValid() error {
+	v := utils.Validator{}
+	tr.validate(&v)
+	return v.Err()
+}
+
+func (tr TaxRate) validate(v *utils.Validator) {
+	validateCountry(v, "country", tr.Country)
+	validateText(v, "label", tr.Label, 20)
+	v.Range("rate", tr.Rate, 0, 60) // 0 for zero-rated categories
+	if tr.ValidFrom.Valid {
+		validateDate(v, "valid_from", tr.ValidFrom.String)
+	}
+	if tr.ValidTo.Valid {
+		validateDate(v, "valid_to", tr.ValidTo.String)
+	}
+	if tr.ValidFrom.Valid && tr.ValidTo.Valid {
+		v.Check(
+			tr.ValidFrom.String <= tr.ValidTo.String, "valid_to",
+			utils.ViolationOrder, map[string]any{"after": "valid_from"},
+			"valid from must be before valid to",
 		)
-	case li.TaxeRate < 0 || li.TaxeRate > 60:
-		return utils.LogError(
-			"taxe rate must be positive and not exceed 60",
+	}
+}
+
+func (tr TaxRate) Valid() error {
+	v := utils.Validator{}
+	validateID(&v, tr.ID, tr.PublicID)
+	tr.validate(&v)
+	return v.Err()
+}
+
+// dateOnly is yyyy-mm-dd, which compares as a string
+func (tr TaxRate) ValidOn(dateOnly string) bool {
+	return (!tr.ValidFrom.Valid || tr.ValidFrom.String <= dateOnly) &&
+		(!tr.ValidTo.Valid || dateOnly <= tr.ValidTo.String)
+}
+
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Helpers of the validate methods, field is the name of the column
+
+// Non-zero and up to max characters
+func validateText(v *utils.Validator, field string, value string, max int) {
+	v.Required(field, value != "")
+	v.MaxLength(field, value, max)
+}
+
+// NULL or a text like validateText
+func validateNullText(v *utils.Validator, field string, value sql.NullString, max int) {
+	if value.Valid {
+		validateText(v, field, value.String, max)
+	}
+}
+
+func validateNullID(v *utils.Validator, field string, id sql.NullInt64) {
+	if id.Valid {
+		v.Positive(field, float64(id.Int64))
+	}
+}
+
+// yyyy-mm-dd
+func validateDate(v *utils.Validator, field string, dateOnly string) {
+	_, err := time.Parse(time.DateOnly, dateOnly)
+	v.Format(field, err == nil && len(dateOnly) == 10, "yyyy-mm-dd")
+}
+
+func validateCountry(v *utils.Validator, field string, code string) {
+	v.Format(field, isCountryCode(code), "an uppercase ISO 3166-1 alpha-2 code")
+}
+
+func validateNullCountry(v *utils.Validator, field string, code sql.NullString) {
+	if code.Valid {
+		validateCountry(v, field, code.String)
+	}
+}
+
+// Taxe rate and total of a line item or a template of one, prefix is the path
+// of the item ("line_items[0].")
+func validateLineAmounts(v *utils.Validator, prefix string, taxeRate float64, total float64) {
+	v.Range(prefix+"taxe_rate", taxeRate, 0, 60)
+	v.Positive(prefix+"total", total)
+	v.Max(prefix+"total", total, config.MaxFloat)
+}
+
+
+// Tag
+// Methods: String, PreInsertValid, Valid
+// Free label of expenses and sessions, names are case insensitive
+type Tag struct {
+	ID       int64
+	PublicID string
+	Name     string
+}
+
+func (t Tag) String() string {
+	return t.Name
+}
+
+func (t Tag) PreInsertValid() error {
+	v := utils.Validator{}
+	t.validate(&v)
+	return v.Err()
+}
+
+func (t Tag) validate(v *utils.Validator) {
+	validateText(v, "name", t.Name, 50)
+	v.Check(
+		strings.TrimSpace(t.Name) == t.Name, "name", utils.ViolationInvalid, nil,
+		"tag name can't start or end with spaces: %q", t.Name,
+	)
+	v.Check(
+		!strings.Contains(t.Name, ","), "name", utils.ViolationInvalid, nil,
+		"tag name can't contain commas: %q", t.Name,
+	)
+}
+
+func (t Tag) Valid() error {
+	v := utils.Validator{}
+	validateID(&v, t.ID, t.PublicID)
+	t.validate(&v)
+	return v.Err()
+}
+
+// CustomField
+// Methods: String, PreInsertValid, Valid, NormalizeValue
+// Typed field defined by the user for expenses or sessions (cost center, PO
+// number...), names are case insensitive
+type CustomField struct {
+	ID        int64
+	PublicID  string
+	Name      string
+	AppliesTo string // CustomFieldOnExpense or CustomFieldOnSession
+	Type      string // CustomFieldText, CustomFieldNumber...
+	Options   CustomFieldOptions // choices of an enum, nil otherwise
+}
+
+const (
+	CustomFieldOnExpense = "expense"
+	CustomFieldOnSession = "session"
+
+	CustomFieldText   = "text"
+	CustomFieldNumber = "number"
+	CustomFieldDate   = "date"   // yyyy-mm-dd
+	CustomFieldEnum   = "enum"
+)
+
+func (cf CustomField) String() string {
+	format := fmt.Sprintf("%v %v (%v)", cf.AppliesTo, cf.Name, cf.Type)
+	if cf.Type == CustomFieldEnum {
+		format += fmt.Sprintf(": %v", strings.Join(cf.Options, ", "))
+	}
+	return format
+}
+
+func (cf CustomField) PreInsertValid() error {
+	v := utils.Validator{}
+	cf.validate(&v)
+	return v.Err()
+}
+
+func (cf CustomField) validate(v *utils.Validator) {
+	validateText(v, "name", cf.Name, 50)
+	v.Check(
+		!strings.ContainsAny(cf.Name, "=,"), "name", utils.ViolationInvalid, nil,
+		"custom field name can't contain '=' or ',': %q", cf.Name,
+	)
+	v.Choice(
+		"applies_to", cf.AppliesTo, []string{CustomFieldOnExpense, CustomFieldOnSession},
+	)
+
+	switch cf.Type {
+	case CustomFieldText, CustomFieldNumber, CustomFieldDate:
+		v.Check(
+			cf.Options == nil, "options", utils.ViolationInvalid, nil,
+			"only enum custom fields have options",
 		)
-	case li.Total > config.MaxFloat:
-		return utils.LogError(
-			"total must not exceed maximum float64 value: %f",
-			config.MaxFloat,
+	case CustomFieldEnum:
+		cf.Options.validate(v)
+	default:
+		v.Choice("type", cf.Type, []string{
+			CustomFieldText, CustomFieldNumber, CustomFieldDate, CustomFieldEnum,
+		})
+	}
+}
+
+func (cf CustomField) Valid() error {
+	v := utils.Validator{}
+	validateID(&v, cf.ID, cf.PublicID)
+	cf.validate(&v)
+	return v.Err()
+}
+
+// The value as stored, so that equal values compare equal in filters:
+// numbers without trailing zeros, dates as yyyy-mm-dd, enum options as defined
+func (cf CustomField) NormalizeValue(value string) (string, error) {
+	v := utils.Validator{}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		v.Add(
+			"value", utils.ViolationRequired, nil,
+			"value of custom field %v must be non-zero", cf.Name,
+		)
+		return "", v.Err()
+	}
+
+	switch cf.Type {
+	case CustomFieldNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			v.Add(
+				"value", utils.ViolationFormat, map[string]any{"format": "number"},
+				"value of custom field %v must be a number, got: %q", cf.Name, value,
+			)
+			return "", v.Err()
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	case CustomFieldDate:
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			v.Add(
+				"value", utils.ViolationFormat, map[string]any{"format": "yyyy-mm-dd"},
+				"value of custom field %v must be a yyyy-mm-dd date, got: %q", cf.Name, value,
+			)
+			return "", v.Err()
+		}
+		return date.Format(time.DateOnly), nil
+	case CustomFieldEnum:
+		for _, option := range cf.Options {
+			if strings.EqualFold(option, value) {
+				return option, nil
+			}
+		}
+		v.Add(
+			"value", utils.ViolationChoice, map[string]any{"allowed": []string(cf.Options)},
+			"value of custom field %v must be one of %v, got: %q",
+			cf.Name, strings.Join(cf.Options, ", "), value,
 		)
+		return "", v.Err()
 	default:
-		return nil
+		v.Check(
+			len([]rune(value)) <= 200, "value", utils.ViolationTooLong, map[string]any{"max": 200},
+			"value of custom field %v can't exceeds 200 characters", cf.Name,
+		)
+		return value, v.Err()
 	}
 }
 
-func (li LineItem) Valid() error {
-	if li.ID <= 0 {
-		return utils.LogError("line item ID must be positive and non-zero")
+// CustomFieldValue
+// Methods: String, PreInsertValid
+// EntityID is an expense or a session, depending on the field AppliesTo
+type CustomFieldValue struct {
+	FieldID  int64
+	EntityID int64
+	Value    string
+}
+
+func (cfv CustomFieldValue) String() string {
+	return fmt.Sprintf("Field ID: %d - Entity ID: %d: %v", cfv.FieldID, cfv.EntityID, cfv.Value)
+}
+
+// Checks the value fits any field, see CustomField.NormalizeValue for its type
+func (cfv CustomFieldValue) PreInsertValid() error {
+	v := utils.Validator{}
+	v.Positive("field_id", float64(cfv.FieldID))
+	v.Positive("entity_id", float64(cfv.EntityID))
+	validateText(&v, "value", cfv.Value, 200)
+	return v.Err()
+}
+
+// RecurringExpense
+// Methods: String, PreInsertValid, Valid, StartTime
+// Template of an expense coming back on a Schedule (phone plan, parking
+// subscription...), see services.GenerateRecurringExpenses. SessionRule
+// decides the session of the generated expenses.
+type RecurringExpense struct {
+	ID          int64
+	PublicID    string
+	Name        string
+	TypeID      int64
+	Currency    string
+	LineItems   LineItemTemplateList
+	Notes       sql.NullString
+	Country     sql.NullString
+	SessionRule string        // RecurringNoSession, RecurringFixedSession or RecurringClientSession
+	SessionID   sql.NullInt64 // RecurringFixedSession only
+	ClientID    sql.NullInt64 // RecurringClientSession only
+	Schedule    Schedule
+	StartDate   string // yyyy-mm-dd, first possible occurrence
+}
+
+const (
+	RecurringNoSession     = "none"
+	RecurringFixedSession  = "fixed"  // always SessionID
+	RecurringClientSession = "client" // the session of ClientID running on the date, if any
+)
+
+func (re RecurringExpense) String() string {
+	format := fmt.Sprintf(
+		"%v: type %v (%v), %v from %v", re.Name, re.TypeID, re.Currency, re.Schedule, re.StartDate,
+	)
+	switch re.SessionRule {
+	case RecurringFixedSession:
+		format += fmt.Sprintf(" - Session ID: %d", re.SessionID.Int64)
+	case RecurringClientSession:
+		format += fmt.Sprintf(" - Client ID: %d", re.ClientID.Int64)
+	}
+	return format
+}
+
+func (re RecurringExpense) PreInsertValid() error {
+	v := utils.Validator{}
+	re.validate(&v)
+	return v.Err()
+}
+
+func (re RecurringExpense) validate(v *utils.Validator) {
+	validateText(v, "name", re.Name, 50)
+	v.Positive("type_id", float64(re.TypeID))
+	validateText(v, "currency", re.Currency, 10)
+	validateNullText(v, "notes", re.Notes, 150)
+	validateNullCountry(v, "country", re.Country)
+
+	switch re.SessionRule {
+	case RecurringNoSession:
+		v.Check(
+			!re.SessionID.Valid, "session_id", utils.ViolationInvalid, nil,
+			"recurring expense without session has no session ID",
+		)
+		v.Check(
+			!re.ClientID.Valid, "client_id", utils.ViolationInvalid, nil,
+			"recurring expense without session has no client ID",
+		)
+	case RecurringFixedSession:
+		v.Check(
+			re.SessionID.Valid, "session_id", utils.ViolationRequired, nil,
+			"recurring expense of a fixed session needs its session ID",
+		)
+		validateNullID(v, "session_id", re.SessionID)
+		v.Check(
+			!re.ClientID.Valid, "client_id", utils.ViolationInvalid, nil,
+			"recurring expense of a fixed session has no client ID",
+		)
+	case RecurringClientSession:
+		v.Check(
+			re.ClientID.Valid, "client_id", utils.ViolationRequired, nil,
+			"recurring expense of a client sessions needs its client ID",
+		)
+		validateNullID(v, "client_id", re.ClientID)
+		v.Check(
+			!re.SessionID.Valid, "session_id", utils.ViolationInvalid, nil,
+			"recurring expense of a client sessions has no session ID",
+		)
+	default:
+		v.Choice("session_rule", re.SessionRule, []string{
+			RecurringNoSession, RecurringFixedSession, RecurringClientSession,
+		})
 	}
-	return li.PreInsertValid()
+
+	start, err := time.Parse(time.DateOnly, re.StartDate)
+	v.Check(
+		err == nil && start.Year() >= 2000, "start_date",
+		utils.ViolationFormat, map[string]any{"format": "yyyy-mm-dd"},
+		"start date must be a yyyy-mm-dd date from year 2000, got: %q", re.StartDate,
+	)
+	re.Schedule.validate(v)
+	re.LineItems.validate(v)
+}
+
+func (re RecurringExpense) Valid() error {
+	v := utils.Validator{}
+	validateID(&v, re.ID, re.PublicID)
+	re.validate(&v)
+	return v.Err()
+}
+
+// StartDate at midnight UTC, like the dates of Schedule.Occurrences
+func (re RecurringExpense) StartTime() time.Time {
+	start, _ := time.Parse(time.DateOnly, re.StartDate)
+	return start
+}
+
+// RecurringOccurrence
+// Methods: String, PreInsertValid
+// An occurrence of a RecurringExpense materialized as ExpenseID, a date is
+// never generated twice, even after the expense is deleted
+type RecurringOccurrence struct {
+	RecurringExpenseID int64
+	DateOnly           string
+	ExpenseID          int64
+}
+
+func (ro RecurringOccurrence) String() string {
+	return fmt.Sprintf(
+		"Recurring expense ID: %d @ %v - Expense ID: %d",
+		ro.RecurringExpenseID, ro.DateOnly, ro.ExpenseID,
+	)
+}
+
+func (ro RecurringOccurrence) PreInsertValid() error {
+	v := utils.Validator{}
+	v.Positive("recurring_expense_id", float64(ro.RecurringExpenseID))
+	v.Positive("expense_id", float64(ro.ExpenseID))
+	validateDate(&v, "date_only", ro.DateOnly)
+	return v.Err()
+}
+
+// Allocation
+// Methods: String, PreInsertValid, Valid, Share
+// Part of an expense charged to a session, either a percentage or a fixed
+// amount of its line items total. An allocated expense has no SessionID, its
+// allocations must add up to its total (see AllocationList.Shares).
+type Allocation struct {
+	ID         int64
+	PublicID   string
+	ExpenseID  int64
+	SessionID  int64
+	Percentage sql.NullFloat64
+	Amount     sql.NullFloat64
+}
+
+func (a Allocation) String() string {
+	format := fmt.Sprintf("Expense ID: %d > Session ID: %d: ", a.ExpenseID, a.SessionID)
+	if a.Percentage.Valid {
+		return format + strconv.FormatFloat(a.Percentage.Float64, 'f', -1, 64) + "%"
+	}
+	return format + strconv.FormatFloat(a.Amount.Float64, 'f', 2, 64)
+}
+
+func (a Allocation) PreInsertValid() error {
+	v := utils.Validator{}
+	a.validate(&v)
+	return v.Err()
+}
+
+func (a Allocation) validate(v *utils.Validator) {
+	v.Positive("expense_id", float64(a.ExpenseID))
+	v.Positive("session_id", float64(a.SessionID))
+	switch {
+	case !a.Percentage.Valid && !a.Amount.Valid:
+		v.Add("amount", utils.ViolationRequired, nil, "allocation needs a percentage or an amount")
+	case a.Percentage.Valid && a.Amount.Valid:
+		v.Add("amount", utils.ViolationInvalid, nil, "allocation is either a percentage or an amount")
+	case a.Percentage.Valid:
+		v.Check(
+			a.Percentage.Float64 > 0 && a.Percentage.Float64 <= 100, "percentage",
+			utils.ViolationRange, map[string]any{"min": 0, "exclusive_min": true, "max": 100},
+			"allocation percentage must be above 0 and up to 100, got: %v", a.Percentage.Float64,
+		)
+	default:
+		v.Positive("amount", a.Amount.Float64)
+		v.Max("amount", a.Amount.Float64, config.MaxFloat)
+	}
+}
+
+func (a Allocation) Valid() error {
+	v := utils.Validator{}
+	validateID(&v, a.ID, a.PublicID)
+	a.validate(&v)
+	return v.Err()
+}
+
+// Part of total charged to the session, not rounded
+func (a Allocation) Share(total float64) float64 {
+	if a.Percentage.Valid {
+		return total * a.Percentage.Float64 / 100
+	}
+	return a.Amount.Float64
 }
 
 
@@ -376,6 +987,9 @@ type ExpenseList []Expense
 // Method: SumByTaxeRates
 type LineItemList []LineItem
 
+// Method: RelPaths
+type ReceiptList []Receipt
+
 func (eList ExpenseList) MapExpensesByCurrency() (map[string]ExpenseList, error) {
 	result := make(map[string]ExpenseList)
 	for _, expense := range eList {
@@ -402,6 +1016,249 @@ func (liList LineItemList) SumByTaxeRates() (map[float64]float64, error) {
 	return result, nil
 }
 
+func (rList ReceiptList) RelPaths() []string {
+	relPaths := make([]string, 0, len(rList))
+	for _, receipt := range rList {
+		relPaths = append(relPaths, receipt.RelPath)
+	}
+	return relPaths
+}
+
+// Stored as comma separated text, NULL when empty
+type TaxeRateList []float64
+
+func (trl TaxeRateList) Valid() error {
+	v := utils.Validator{}
+	trl.validate(&v, "default_taxe_rates")
+	return v.Err()
+}
+
+func (trl TaxeRateList) validate(v *utils.Validator, field string) {
+	v.Check(
+		len(trl) <= 5, field, utils.ViolationTooLong, map[string]any{"max": 5},
+		"no more than 5 default taxe rates",
+	)
+	for i, rate := range trl {
+		v.Range(fmt.Sprintf("%s[%d]", field, i), rate, 0, 60)
+	}
+}
+
+func (trl *TaxeRateList) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		*trl = nil
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return utils.IntegrityError("unable to scan TaxeRateList")
+	}
+
+	list := make(TaxeRateList, 0)
+	for _, item := range strings.Split(text, ",") {
+		rate, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+		if err != nil {
+			return utils.IntegrityError("invalid taxe rate in list: %v", err)
+		}
+		list = append(list, rate)
+	}
+	*trl = list
+	return nil
+}
+
+func (trl TaxeRateList) Value() (driver.Value, error) {
+	if len(trl) == 0 {
+		return nil, nil
+	}
+	items := make([]string, len(trl))
+	for i, rate := range trl {
+		items[i] = strconv.FormatFloat(rate, 'f', -1, 64)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// Choices of an enum custom field, stored as comma separated text
+type CustomFieldOptions []string
+
+func (cfo CustomFieldOptions) Valid() error {
+	v := utils.Validator{}
+	cfo.validate(&v)
+	return v.Err()
+}
+
+func (cfo CustomFieldOptions) validate(v *utils.Validator) {
+	v.Check(
+		len(cfo) > 0, "options", utils.ViolationRequired, nil,
+		"enum custom field needs at least one option",
+	)
+	v.Check(
+		len(cfo) <= 50, "options", utils.ViolationTooLong, map[string]any{"max": 50},
+		"no more than 50 options for an enum custom field",
+	)
+	for i, option := range cfo {
+		field := fmt.Sprintf("options[%d]", i)
+		validateText(v, field, option, 200)
+		v.Check(
+			strings.TrimSpace(option) == option, field, utils.ViolationInvalid, nil,
+			"enum option can't start or end with spaces: %q", option,
+		)
+		v.Check(
+			!strings.Contains(option, ","), field, utils.ViolationInvalid, nil,
+			"enum option can't contain commas: %q", option,
+		)
+		for _, previous := range cfo[:i] {
+			if strings.EqualFold(previous, option) {
+				v.Add(field, utils.ViolationInvalid, nil, "duplicated enum option: %q", option)
+				break
+			}
+		}
+	}
+}
+
+func (cfo *CustomFieldOptions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*cfo = nil
+	case string:
+		*cfo = strings.Split(v, ",")
+	case []byte:
+		*cfo = strings.Split(string(v), ",")
+	default:
+		return utils.IntegrityError("unable to scan CustomFieldOptions")
+	}
+	return nil
+}
+
+func (cfo CustomFieldOptions) Value() (driver.Value, error) {
+	if cfo == nil {
+		return nil, nil
+	}
+	return strings.Join(cfo, ","), nil
+}
+
+// Allocations of one expense
+// Method: Shares
+type AllocationList []Allocation
+
+// Share of each session of an expense of total, rounded to cents with the
+// rounding difference on the largest share so that they add up to total.
+// Fails when a session is given twice or the shares don't add up to total
+// (a cent of difference is accepted).
+func (aList AllocationList) Shares(total float64) (map[int64]float64, error) {
+	shares := make(map[int64]float64, len(aList))
+	var sum float64
+	var largest int64
+	for _, allocation := range aList {
+		if _, ok := shares[allocation.SessionID]; ok {
+			return nil, utils.ValidationError(
+				[]string{"session_id"},
+				"session (ID: %d) allocated twice the same expense", allocation.SessionID,
+			)
+		}
+		share := math.Round(allocation.Share(total)*100) / 100
+		shares[allocation.SessionID] = share
+		sum += allocation.Share(total)
+		if largest == 0 || share > shares[largest] {
+			largest = allocation.SessionID
+		}
+	}
+	if len(shares) == 0 {
+		return shares, nil
+	}
+	if math.Abs(sum-total) > 0.01 {
+		return nil, utils.ValidationError(
+			[]string{"amount", "percentage"},
+			"allocations add up to %.2f, the expense total is %.2f", sum, total,
+		)
+	}
+
+	var rounded float64
+	for _, share := range shares {
+		rounded += share
+	}
+	shares[largest] = math.Round((shares[largest]+total-rounded)*100) / 100
+	return shares, nil
+}
+
+// Line items of a RecurringExpense, stored as comma separated "rate:total"
+// text ("10:120,20:12")
+type LineItemTemplateList []LineItemTemplate
+
+type LineItemTemplate struct {
+	TaxeRate float64
+	Total    float64
+}
+
+func (litl LineItemTemplateList) Valid() error {
+	v := utils.Validator{}
+	litl.validate(&v)
+	return v.Err()
+}
+
+func (litl LineItemTemplateList) validate(v *utils.Validator) {
+	v.Check(
+		len(litl) > 0, "line_items", utils.ViolationRequired, nil,
+		"recurring expense needs at least one line item",
+	)
+	v.Check(
+		len(litl) <= 10, "line_items", utils.ViolationTooLong, map[string]any{"max": 10},
+		"recurring expense can't have more than 10 line items",
+	)
+	for i, item := range litl {
+		validateLineAmounts(v, fmt.Sprintf("line_items[%d].", i), item.TaxeRate, item.Total)
+	}
+}
+
+// For an expense, still to be validated
+func (litl LineItemTemplateList) LineItems(expenseID int64) LineItemList {
+	lineItems := make(LineItemList, 0, len(litl))
+	for _, item := range litl {
+		lineItems = append(
+			lineItems, LineItem{ExpenseID: expenseID, TaxeRate: item.TaxeRate, Total: item.Total},
+		)
+	}
+	return lineItems
+}
+
+func (litl *LineItemTemplateList) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return utils.IntegrityError("unable to scan LineItemTemplateList")
+	}
+
+	list := make(LineItemTemplateList, 0)
+	for _, item := range strings.Split(text, ",") {
+		rate, total, ok := strings.Cut(item, ":")
+		var template LineItemTemplate
+		var rateErr, totalErr error
+		template.TaxeRate, rateErr = strconv.ParseFloat(rate, 64)
+		template.Total, totalErr = strconv.ParseFloat(total, 64)
+		if !ok || rateErr != nil || totalErr != nil {
+			return utils.IntegrityError("invalid line item template in list: %q", item)
+		}
+		list = append(list, template)
+	}
+	*litl = list
+	return nil
+}
+
+func (litl LineItemTemplateList) Value() (driver.Value, error) {
+	items := make([]string, len(litl))
+	for i, item := range litl {
+		items[i] = strconv.FormatFloat(item.TaxeRate, 'f', -1, 64) + ":" +
+			strconv.FormatFloat(item.Total, 'f', -1, 64)
+	}
+	return strings.Join(items, ","), nil
+}
+
 // Custom Nullable time.Time as the library sql doesn't have one
 type NullableTime struct {
     Time time.Time
@@ -419,19 +1276,30 @@ func (nt *NullableTime) Scan(value interface{}) error {
         nt.Time = v
         return nil
     case []byte:
-        var err error
-        nt.Time, err = time.Parse(time.RFC3339, string(v))
-        return utils.LogError("Invalid time, error: %v", err)
+        return nt.parse(string(v))
+    case string:
+        return nt.parse(v)
     default:
-        return utils.LogError("unable to scan NullableTime")
+        return utils.IntegrityError("unable to scan NullableTime")
+    }
+}
+
+func (nt *NullableTime) parse(value string) error {
+    t, err := ParseTimestamp(value)
+    if err != nil {
+        nt.Time, nt.Valid = time.Time{}, false
+        return err
     }
+    nt.Time = t
+    return nil
 }
 
+// Stored as text, see TimestampLayout
 func (nt NullableTime) Value() (driver.Value, error) {
     if !nt.Valid {
         return nil, nil
     }
-    return nt.Time, nil
+    return FormatTimestamp(nt.Time), nil
 }
 
 func (nt NullableTime) Equal(other NullableTime) bool {
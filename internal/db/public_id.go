@@ -0,0 +1,34 @@
+package db
+
+import (
+	"regexp"
+
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Public IDs are UUIDs in their lowercase text form, set by the database on
+// insert (see migrations/011_public_ids.sql): UUIDv7 for new rows, UUIDv4 for
+// the ones created before. They identify a row across devices and in the API,
+// where the int64 ID of one database means nothing.
+var publicIDPattern = regexp.MustCompile(
+	`^[0-9a-f]{8}-[0-9a-f]{4}-[1-8][0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+)
+
+func ValidPublicID(publicID string) error {
+	if !publicIDPattern.MatchString(publicID) {
+		return utils.ValidationError(
+			[]string{"public_id"}, "invalid public ID, expected a lowercase UUID, got: %q", publicID,
+		)
+	}
+	return nil
+}
+
+// ID and public ID of a row read from the database, the public ID is empty
+// for a row not inserted yet
+func validateID(v *utils.Validator, id int64, publicID string) {
+	v.Positive("id", float64(id))
+	if publicID != "" {
+		v.Format("public_id", publicIDPattern.MatchString(publicID), "a lowercase UUID")
+	}
+}
@@ -0,0 +1,348 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/imaging"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+const (
+	thumbnailsDir = "thumbnails"
+	previewsDir   = "previews"
+	pdfPreviewDPI = 150
+)
+
+// Stored receipt names, see ReceiptName
+var receiptNamePattern = regexp.MustCompile(`^[0-9a-f]{32}\.[a-z0-9]{1,5}$`)
+
+// Name of a receipt file in config.ReceiptsDir: the start of the SHA-256 of
+// its stored content and its extension. The same file stored twice is one
+// file, and the sync server checks uploads against their name.
+func ReceiptName(data []byte, ext string) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])[:32] + strings.ToLower(ext)
+}
+
+// Name made by ReceiptName, a plain file name
+func IsReceiptName(name string) bool {
+	return receiptNamePattern.MatchString(name)
+}
+
+// Copy a receipt file into config.ReceiptsDir and return the path to store
+// in Receipt.RelPath, named after its stored content (see ReceiptName).
+// Images are turned upright, downscaled to config.ReceiptMaxSide and stripped
+// of their EXIF metadata (GPS position...), HEIC pictures are converted to
+// JPEG first. PDF files are kept as is with a preview of their first page
+// (see ReceiptPreviewRelPath). A thumbnail is generated for both (see
+// ReceiptThumbnailRelPath).
+func StoreReceipt(srcPath string) (string, error) {
+	contentType, err := ReceiptContentType(srcPath)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return "", utils.LogError("error reading receipt file: %v", err)
+	}
+
+	var ext string
+	var stored, thumbnail []byte
+	switch contentType {
+	case "application/pdf":
+		ext, stored = ".pdf", data
+	case "image/heic":
+		if data, err = imaging.ConvertHEIC(data); err != nil {
+			// Keeps imaging.MissingToolError, naming the tool to install
+			return "", utils.WrapError(nil, err, "failed to convert HEIC receipt: %v", err)
+		}
+		fallthrough
+	default:
+		result, err := imaging.Process(data, receiptProcessingOptions())
+		if err != nil {
+			return "", utils.LogError("failed to process receipt image: %v", err)
+		}
+		ext = result.Ext
+		if ext == "" {
+			ext = "." + strings.TrimPrefix(contentType, "image/") // kept as is
+		}
+		stored, thumbnail = result.Data, result.Thumbnail
+	}
+	relPath := ReceiptName(stored, ext)
+
+	if err := os.MkdirAll(config.ReceiptsDir, 0755); err != nil {
+		return "", utils.LogError("failed to create receipts directory: %v", err)
+	}
+	dstPath := filepath.Join(config.ReceiptsDir, relPath)
+	if _, err := os.Stat(dstPath); err == nil {
+		return relPath, nil // already stored
+	}
+
+	// Nothing is left behind when a step fails: no thumbnail without receipt
+	if err := writeReceiptDerivative(ReceiptThumbnailRelPath(relPath), thumbnail); err != nil {
+		RemoveReceiptFiles(relPath)
+		return "", err
+	}
+	if err := os.WriteFile(dstPath, stored, 0644); err != nil {
+		RemoveReceiptFiles(relPath)
+		return "", utils.LogError("failed to write receipt file: %v", err)
+	}
+	if contentType == "application/pdf" {
+		if err := GenerateReceiptPreviews(relPath); err != nil {
+			RemoveReceiptFiles(relPath)
+			return "", err
+		}
+	}
+
+	slog.Info(
+		"receipt stored",
+		"rel_path", relPath, "original_kb", len(data)/1024, "stored_kb", len(stored)/1024,
+	)
+	return relPath, nil
+}
+
+func isPDFReceipt(receiptRelPath string) bool {
+	return strings.EqualFold(filepath.Ext(receiptRelPath), ".pdf")
+}
+
+// Thumbnail of a stored receipt, relative to config.ReceiptsDir. Thumbnails
+// are always JPEG and may not exist (format without decoder, disabled...).
+func ReceiptThumbnailRelPath(receiptRelPath string) string {
+	base := strings.TrimSuffix(receiptRelPath, filepath.Ext(receiptRelPath))
+	return filepath.Join(thumbnailsDir, base+".jpg")
+}
+
+// Image to display or read with OCR for a stored receipt, relative to
+// config.ReceiptsDir: the receipt itself, or the first page of a PDF. The
+// PDF preview doesn't exist when poppler isn't installed.
+func ReceiptPreviewRelPath(receiptRelPath string) string {
+	if !isPDFReceipt(receiptRelPath) {
+		return receiptRelPath
+	}
+	base := strings.TrimSuffix(receiptRelPath, filepath.Ext(receiptRelPath))
+	return filepath.Join(previewsDir, base+".png")
+}
+
+// Preview and thumbnail of a receipt written by something else than
+// StoreReceipt, like an archive import. The receipt itself is left untouched
+// and existing files are kept. A PDF without renderer only gets a warning.
+func GenerateReceiptPreviews(receiptRelPath string) error {
+	previewRelPath := ReceiptPreviewRelPath(receiptRelPath)
+	previewPath := filepath.Join(config.ReceiptsDir, previewRelPath)
+	thumbnailPath := filepath.Join(config.ReceiptsDir, ReceiptThumbnailRelPath(receiptRelPath))
+	_, errPreview := os.Stat(previewPath)
+	_, errThumbnail := os.Stat(thumbnailPath)
+	if errPreview == nil && (errThumbnail == nil || config.ThumbnailSide <= 0) {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(config.ReceiptsDir, receiptRelPath))
+	if err != nil {
+		return utils.LogError("error reading receipt file: %v", err)
+	}
+	opts := imaging.Options{ThumbnailSide: config.ThumbnailSide}
+	if isPDFReceipt(receiptRelPath) {
+		if errPreview == nil {
+			data, err = os.ReadFile(previewPath)
+		} else {
+			data, err = imaging.RenderPDFFirstPage(data, pdfPreviewDPI)
+			opts = receiptProcessingOptions()
+		}
+		if err != nil {
+			slog.Warn("no preview for PDF receipt", "rel_path", receiptRelPath, "error", err)
+			return nil
+		}
+	}
+
+	result, err := imaging.Process(data, opts)
+	if err != nil {
+		return utils.LogError("failed to process receipt image: %v", err)
+	}
+	if errPreview != nil {
+		if err := writeReceiptDerivative(previewRelPath, result.Data); err != nil {
+			return err
+		}
+	}
+	return writeReceiptDerivative(ReceiptThumbnailRelPath(receiptRelPath), result.Thumbnail)
+}
+
+// Remove a stored receipt with its preview and thumbnail, for a write that
+// failed after StoreReceipt. Files already gone are not an error.
+func RemoveReceiptFiles(receiptRelPath string) error {
+	relPaths := []string{receiptRelPath, ReceiptThumbnailRelPath(receiptRelPath)}
+	if isPDFReceipt(receiptRelPath) {
+		relPaths = append(relPaths, ReceiptPreviewRelPath(receiptRelPath))
+	}
+	for _, relPath := range relPaths {
+		err := os.Remove(filepath.Join(config.ReceiptsDir, relPath))
+		if err != nil && !os.IsNotExist(err) {
+			return utils.LogError("failed to remove %s: %v", relPath, err)
+		}
+	}
+	return nil
+}
+
+// Receipts stored under another name than ReceiptName (kept by archive
+// imports, from before the receipts table, named after the content before
+// processing) are renamed in tx, so that sync can send them. Files are copied
+// to their new name first, the returned func removes the old ones once tx is
+// committed. Receipts without file here keep their name.
+func renameReceiptFiles(tx *sql.Tx) (func(), error) {
+	rows, err := tx.Query("SELECT DISTINCT rel_path FROM receipts")
+	if err != nil {
+		return nil, utils.LogError("failed to list receipts: %v", err)
+	}
+	var relPaths []string
+	for rows.Next() {
+		var relPath string
+		if err := rows.Scan(&relPath); err != nil {
+			rows.Close()
+			return nil, utils.LogError("failed to scan receipt: %v", err)
+		}
+		relPaths = append(relPaths, relPath)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, utils.LogError("failed to list receipts: %v", err)
+	}
+
+	newNames := make(map[string]string)
+	var order []string
+	for _, relPath := range relPaths {
+		if !filepath.IsLocal(relPath) {
+			slog.Warn("receipt outside of the receipts directory, name kept", "rel_path", relPath)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(config.ReceiptsDir, relPath))
+		if errors.Is(err, os.ErrNotExist) {
+			slog.Warn("receipt file missing, name kept", "rel_path", relPath)
+			continue
+		}
+		if err != nil {
+			return nil, utils.LogError("error reading receipt file: %v", err)
+		}
+		name := ReceiptName(data, filepath.Ext(relPath))
+		switch {
+		case name == relPath:
+		case !IsReceiptName(name):
+			slog.Warn("receipt with an unknown extension, name kept", "rel_path", relPath)
+		default:
+			newNames[relPath] = name
+			order = append(order, relPath)
+		}
+	}
+
+	// A receipt named after the original content of another one is renamed
+	// before its name is taken
+	var renamed []string
+	taken := make(map[string]bool)
+	for len(order) > 0 {
+		var waiting []string
+		for _, relPath := range order {
+			name := newNames[relPath]
+			if _, ok := newNames[name]; ok {
+				waiting = append(waiting, relPath)
+				continue
+			}
+			if err := renameReceipt(tx, relPath, name); err != nil {
+				return nil, err
+			}
+			delete(newNames, relPath)
+			renamed = append(renamed, relPath)
+			taken[name] = true
+		}
+		if len(waiting) == len(order) {
+			slog.Warn("receipts named after each other, names kept", "rel_paths", waiting)
+			break
+		}
+		order = waiting
+	}
+
+	return func() {
+		for _, relPath := range renamed {
+			if !taken[relPath] {
+				RemoveReceiptFiles(relPath)
+			}
+		}
+	}, nil
+}
+
+func renameReceipt(tx *sql.Tx, relPath string, name string) error {
+	data, err := os.ReadFile(filepath.Join(config.ReceiptsDir, relPath))
+	if err != nil {
+		return utils.LogError("error reading receipt file: %v", err)
+	}
+	if err := copyReceiptFiles(relPath, name, data); err != nil {
+		return err
+	}
+	// The same content twice on an expense becomes one receipt
+	_, err = tx.Exec("UPDATE OR IGNORE receipts SET rel_path = ? WHERE rel_path = ?", name, relPath)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM receipts WHERE rel_path = ?", relPath)
+	}
+	if err != nil {
+		return utils.LogError("failed to rename receipt %s: %v", relPath, err)
+	}
+	slog.Info("receipt renamed", "rel_path", relPath, "name", name)
+	return nil
+}
+
+// Receipt and its existing preview and thumbnail under a new name
+func copyReceiptFiles(relPath string, newRelPath string, data []byte) error {
+	if err := writeReceiptDerivative(newRelPath, data); err != nil {
+		return err
+	}
+	derivatives := [][2]string{{ReceiptThumbnailRelPath(relPath), ReceiptThumbnailRelPath(newRelPath)}}
+	if isPDFReceipt(relPath) {
+		derivatives = append(
+			derivatives, [2]string{ReceiptPreviewRelPath(relPath), ReceiptPreviewRelPath(newRelPath)},
+		)
+	}
+	for _, derivative := range derivatives {
+		data, err := os.ReadFile(filepath.Join(config.ReceiptsDir, derivative[0]))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return utils.LogError("error reading %s: %v", derivative[0], err)
+		}
+		if err := writeReceiptDerivative(derivative[1], data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Previews and thumbnails live in sub-directories of config.ReceiptsDir
+func writeReceiptDerivative(relPath string, data []byte) error {
+	if data == nil {
+		return nil
+	}
+	fullPath := filepath.Join(config.ReceiptsDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return utils.LogError("failed to create %s directory: %v", filepath.Dir(relPath), err)
+	}
+	if err := os.WriteFile(fullPath, data, 0644); err != nil {
+		return utils.LogError("failed to write %s: %v", relPath, err)
+	}
+	return nil
+}
+
+func receiptProcessingOptions() imaging.Options {
+	return imaging.Options{
+		MaxSide:       config.ReceiptMaxSide,
+		Quality:       config.ReceiptQuality,
+		ThumbnailSide: config.ThumbnailSide,
+	}
+}
@@ -0,0 +1,312 @@
+package db
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Schedule
+// Methods: String, Valid, Occurrences, Scan, Value
+// Subset of the iCalendar RRULE (RFC 5545) of recurring expenses, like
+// "FREQ=MONTHLY;BYMONTHDAY=5" or "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=10".
+// The first occurrence is the start date of the RecurringExpense (DTSTART).
+// Unlike RFC 5545, a month day missing from a month falls on its last day
+// (BYMONTHDAY=31 is on February 28th or 29th), like the 29th of February of
+// a yearly schedule.
+type Schedule struct {
+	Frequency  string         // ScheduleDaily, ScheduleWeekly...
+	Interval   int            // every Interval periods, 1 by default
+	ByMonthDay int            // MONTHLY only, 1 to 31 or -1 for the last day, 0 for the start day
+	ByDay      []time.Weekday // WEEKLY only, the start weekday when empty
+	Count      int            // number of occurrences, 0 for no limit
+	Until      string         // yyyy-mm-dd of the last possible occurrence, "" for no limit
+}
+
+const (
+	ScheduleDaily   = "DAILY"
+	ScheduleWeekly  = "WEEKLY"
+	ScheduleMonthly = "MONTHLY"
+	ScheduleYearly  = "YEARLY"
+
+	// Occurrences computed at most, a daily schedule covers 27 years
+	maxScheduleOccurrences = 10000
+)
+
+var scheduleWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+var scheduleFrequencies = []string{ScheduleDaily, ScheduleWeekly, ScheduleMonthly, ScheduleYearly}
+
+// Field of the validation errors, a schedule is set as a whole
+var scheduleFields = []string{"schedule"}
+
+// Parse "FREQ=...;INTERVAL=...", the "RRULE:" prefix is optional and keys
+// are case insensitive. UNTIL is yyyy-mm-dd or yyyymmdd.
+func ParseSchedule(rule string) (Schedule, error) {
+	var schedule Schedule
+	rule = strings.TrimSpace(rule)
+	if len(rule) >= 6 && strings.EqualFold(rule[:6], "RRULE:") {
+		rule = rule[6:]
+	}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return Schedule{}, utils.ValidationError(
+				scheduleFields, "invalid schedule part, expected KEY=VALUE: %q", part,
+			)
+		}
+		if seen[key] {
+			return Schedule{}, utils.ValidationError(scheduleFields, "schedule %v given twice", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			schedule.Frequency = value
+		case "INTERVAL":
+			schedule.Interval, err = strconv.Atoi(value)
+		case "BYMONTHDAY":
+			schedule.ByMonthDay, err = strconv.Atoi(value)
+		case "COUNT":
+			schedule.Count, err = strconv.Atoi(value)
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday := slices.Index(scheduleWeekdays, strings.TrimSpace(day))
+				if weekday < 0 {
+					return Schedule{}, utils.ValidationError(
+						scheduleFields,
+						"schedule BYDAY expects MO,TU,WE,TH,FR,SA,SU, got: %q", day,
+					)
+				}
+				schedule.ByDay = append(schedule.ByDay, time.Weekday(weekday))
+			}
+		case "UNTIL":
+			schedule.Until = value
+			if len(value) == 8 {
+				schedule.Until = value[:4] + "-" + value[4:6] + "-" + value[6:]
+			}
+		default:
+			return Schedule{}, utils.ValidationError(
+				scheduleFields, "unsupported schedule part: %v", key,
+			)
+		}
+		if err != nil {
+			return Schedule{}, utils.ValidationError(
+				scheduleFields, "schedule %v must be a number, got: %q", key, value,
+			)
+		}
+	}
+	if schedule.Interval == 0 && !seen["INTERVAL"] {
+		schedule.Interval = 1
+	}
+	if err := schedule.Valid(); err != nil {
+		return Schedule{}, err
+	}
+	return schedule, nil
+}
+
+// Canonical rule, as stored
+func (s Schedule) String() string {
+	parts := []string{"FREQ=" + s.Frequency}
+	if s.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(s.Interval))
+	}
+	if s.ByMonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(s.ByMonthDay))
+	}
+	if len(s.ByDay) > 0 {
+		days := make([]string, 0, len(s.ByDay))
+		for _, day := range s.sortedByDay() {
+			days = append(days, scheduleWeekdays[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if s.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(s.Count))
+	}
+	if s.Until != "" {
+		parts = append(parts, "UNTIL="+s.Until)
+	}
+	return strings.Join(parts, ";")
+}
+
+func (s Schedule) Valid() error {
+	v := utils.Validator{}
+	s.validate(&v)
+	return v.Err()
+}
+
+// Violations are all on the "schedule" field, it is set as a whole
+func (s Schedule) validate(v *utils.Validator) {
+	field := scheduleFields[0]
+	v.Check(
+		slices.Contains(scheduleFrequencies, s.Frequency), field,
+		utils.ViolationChoice, map[string]any{"allowed": scheduleFrequencies},
+		"schedule FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY, got: %q", s.Frequency,
+	)
+	v.Check(
+		s.Interval >= 1 && s.Interval <= 1000, field,
+		utils.ViolationRange, map[string]any{"min": 1, "max": 1000},
+		"schedule INTERVAL must be between 1 and 1000, got: %d", s.Interval,
+	)
+	v.Check(
+		s.ByMonthDay == 0 || s.Frequency == ScheduleMonthly, field, utils.ViolationInvalid, nil,
+		"schedule BYMONTHDAY is only for a MONTHLY frequency",
+	)
+	v.Check(
+		s.ByMonthDay >= -1 && s.ByMonthDay <= 31, field,
+		utils.ViolationRange, map[string]any{"min": -1, "max": 31},
+		"schedule BYMONTHDAY must be 1 to 31 or -1, got: %d", s.ByMonthDay,
+	)
+	v.Check(
+		len(s.ByDay) == 0 || s.Frequency == ScheduleWeekly, field, utils.ViolationInvalid, nil,
+		"schedule BYDAY is only for a WEEKLY frequency",
+	)
+	v.Check(
+		s.Count >= 0 && s.Count <= maxScheduleOccurrences, field,
+		utils.ViolationRange, map[string]any{"min": 0, "max": maxScheduleOccurrences},
+		"schedule COUNT must be between 1 and %d, got: %d", maxScheduleOccurrences, s.Count,
+	)
+	for i, day := range s.ByDay {
+		if day < time.Sunday || day > time.Saturday || slices.Contains(s.ByDay[:i], day) {
+			v.Add(
+				field, utils.ViolationInvalid, nil,
+				"schedule BYDAY has an invalid or repeated day: %v", day,
+			)
+		}
+	}
+	if s.Until != "" {
+		_, err := time.Parse(time.DateOnly, s.Until)
+		v.Check(
+			err == nil, field, utils.ViolationFormat, map[string]any{"format": "yyyy-mm-dd"},
+			"schedule UNTIL must be a yyyy-mm-dd date, got: %q", s.Until,
+		)
+	}
+}
+
+// Dates of the occurrences starting at start (the date of a RecurringExpense,
+// included when it fits the schedule), up to to included
+func (s Schedule) Occurrences(start time.Time, to time.Time) ([]time.Time, error) {
+	if err := s.Valid(); err != nil {
+		return nil, err
+	}
+	start = dateOf(start)
+	to = dateOf(to)
+	if s.Until != "" {
+		until, _ := time.Parse(time.DateOnly, s.Until)
+		if until.Before(to) {
+			to = until
+		}
+	}
+
+	var occurrences []time.Time
+	for period := 0; len(occurrences) < maxScheduleOccurrences; period++ {
+		dates := s.periodDates(start, period)
+		if len(dates) == 0 || dates[0].After(to) {
+			break
+		}
+		for _, date := range dates {
+			if date.Before(start) {
+				continue
+			}
+			if date.After(to) || (s.Count > 0 && len(occurrences) == s.Count) {
+				return occurrences, nil
+			}
+			occurrences = append(occurrences, date)
+		}
+	}
+	return occurrences, nil
+}
+
+// Candidate dates of the nth period after the start one, sorted
+func (s Schedule) periodDates(start time.Time, n int) []time.Time {
+	step := n * s.Interval
+	switch s.Frequency {
+	case ScheduleDaily:
+		return []time.Time{start.AddDate(0, 0, step)}
+	case ScheduleWeekly:
+		// Weeks start on Monday, as in most of Europe
+		monday := start.AddDate(0, 0, -(int(start.Weekday())+6)%7+7*step)
+		days := s.sortedByDay()
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		dates := make([]time.Time, 0, len(days))
+		for _, day := range days {
+			dates = append(dates, monday.AddDate(0, 0, (int(day)+6)%7))
+		}
+		return dates
+	case ScheduleMonthly:
+		day := start.Day()
+		if s.ByMonthDay != 0 {
+			day = s.ByMonthDay
+		}
+		return []time.Time{dayOfMonth(start.Year(), start.Month()+time.Month(step), day)}
+	case ScheduleYearly:
+		return []time.Time{dayOfMonth(start.Year()+step, start.Month(), start.Day())}
+	default:
+		return nil
+	}
+}
+
+// Monday first
+func (s Schedule) sortedByDay() []time.Weekday {
+	days := slices.Clone(s.ByDay)
+	slices.SortFunc(days, func(a, b time.Weekday) int {
+		return (int(a)+6)%7 - (int(b)+6)%7
+	})
+	return days
+}
+
+func (s *Schedule) Scan(value interface{}) error {
+	var rule string
+	switch v := value.(type) {
+	case string:
+		rule = v
+	case []byte:
+		rule = string(v)
+	default:
+		return utils.IntegrityError("unable to scan Schedule")
+	}
+	schedule, err := ParseSchedule(rule)
+	if err != nil {
+		return err
+	}
+	*s = schedule
+	return nil
+}
+
+func (s Schedule) Value() (driver.Value, error) {
+	if err := s.Valid(); err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	return s.String(), nil
+}
+
+// The day of a month, or its last day when the month is shorter. -1 is the
+// last day. The month may overflow the year (month 13 is January).
+func dayOfMonth(year int, month time.Month, day int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	if day == -1 || day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
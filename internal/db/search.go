@@ -0,0 +1,96 @@
+package db
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"github.com/craftidev/expenseflow/internal/db/migrations"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Triggers of migrations/search/search_index.sql, 3 per indexed table
+const searchIndexTriggersCount = 12
+
+// FTS5 is compiled in go-sqlite3 with the sqlite_fts5 build tag only:
+// go build -tags sqlite_fts5 ./cmd/expenseflow
+func HasSearchIndex(db *sql.DB) (bool, error) {
+    var enabled bool
+    err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+    if err != nil {
+        return false, utils.LogError("failed to check FTS5 support: %v", err)
+    }
+    return enabled, nil
+}
+
+// Create the full-text index and its triggers when FTS5 is available, and
+// fill it when it is new or may be stale: migrations rebuilding a table drop
+// its triggers, so do binaries built without FTS5 (see below).
+func setupSearchIndex(db *sql.DB, migrated bool) error {
+    enabled, err := HasSearchIndex(db)
+    if err != nil {
+        return err
+    }
+    var triggersCount int
+    err = db.QueryRow(
+        "SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'search_index_%'",
+    ).Scan(&triggersCount)
+    if err != nil {
+        return utils.LogError("failed to inspect search index: %v", err)
+    }
+
+    if !enabled {
+        // Triggers writing to an FTS5 table fail every insert without FTS5,
+        // the index is rebuilt once a binary with FTS5 opens the database
+        if triggersCount > 0 {
+            if err := dropSearchIndexTriggers(db); err != nil {
+                return err
+            }
+            slog.Warn("SQLite built without FTS5, search index disabled")
+        }
+        return nil
+    }
+
+    schema, err := migrations.FS.ReadFile(migrations.SearchIndexFile)
+    if err != nil {
+        return utils.LogError("failed to read search index schema: %v", err)
+    }
+    statements := []string{string(schema)}
+    if migrated || triggersCount != searchIndexTriggersCount {
+        rebuild, err := migrations.FS.ReadFile(migrations.SearchRebuildFile)
+        if err != nil {
+            return utils.LogError("failed to read search index schema: %v", err)
+        }
+        statements = append(statements, string(rebuild))
+    }
+    if err := execInTx(db, statements...); err != nil {
+        return utils.LogError("failed to set up search index: %v", err)
+    }
+    if len(statements) > 1 {
+        slog.Info("search index rebuilt")
+    }
+    return nil
+}
+
+func dropSearchIndexTriggers(db *sql.DB) error {
+    rows, err := db.Query(
+        "SELECT name FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'search_index_%'",
+    )
+    if err != nil {
+        return utils.LogError("failed to inspect search index: %v", err)
+    }
+    var statements []string
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            rows.Close()
+            return utils.LogError("failed to inspect search index: %v", err)
+        }
+        statements = append(statements, "DROP TRIGGER IF EXISTS "+name)
+    }
+    rows.Close()
+    if err := execInTx(db, statements...); err != nil {
+        return utils.LogError("failed to drop search index triggers: %v", err)
+    }
+    return nil
+}
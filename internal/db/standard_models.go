@@ -0,0 +1,415 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/craftidev/expenseflow/internal/db/migrations"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Standard models are packs of expense types (migrations/standard_models/*.json)
+// a user can install, then upgrade when a newer version of the pack ships.
+// Installed types keep a ModelRef "pack:key", so they are still recognized
+// after the user renamed or customized them.
+type StandardModel struct {
+	Name         string                `json:"-"`
+	Title        string                `json:"title"`
+	Country      string                `json:"country,omitempty"`
+	Version      int                   `json:"version"`
+	ExpenseTypes []StandardExpenseType `json:"expense_types"`
+}
+
+type StandardExpenseType struct {
+	Key              string    `json:"key"`
+	Name             string    `json:"name"`
+	DefaultTaxeRates []float64 `json:"default_taxe_rates,omitempty"`
+	AccountingCode   string    `json:"accounting_code,omitempty"`
+	Reimbursable     *bool     `json:"reimbursable,omitempty"`    // default true
+	VATRecoverable   *bool     `json:"vat_recoverable,omitempty"` // default true
+	Description      string    `json:"description,omitempty"`
+}
+
+// Status of a pack expense type compared to the user's expense types
+const (
+	ModelDiffSame       = "same"
+	ModelDiffMissing    = "missing"
+	ModelDiffCustomized = "customized"
+	ModelDiffRetired    = "retired" // installed but no longer in the pack
+)
+
+type StandardModelDiff struct {
+	Key     string       `json:"key"`
+	Status  string       `json:"status"`
+	Fields  []string     `json:"fields,omitempty"` // customized fields
+	Pack    *ExpenseType `json:"pack,omitempty"`
+	Current *ExpenseType `json:"current,omitempty"`
+}
+
+// Names of the packs available in migrations/standard_models
+func StandardModels() ([]string, error) {
+	files, err := fs.Glob(migrations.FS, path.Join(migrations.StandardModelsDir, "*.json"))
+	if err != nil {
+		return nil, utils.LogError("failed to fetch standard models: %v", err)
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(path.Base(file), ".json"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func LoadStandardModel(name string) (*StandardModel, error) {
+	available, err := StandardModels()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(available, name) {
+		return nil, utils.LogError(
+			"unknown standard model: %s (available: %s)",
+			name, strings.Join(available, ", "),
+		)
+	}
+
+	content, err := migrations.FS.ReadFile(
+		path.Join(migrations.StandardModelsDir, name+".json"),
+	)
+	if err != nil {
+		return nil, utils.LogError("failed to read standard model %s: %v", name, err)
+	}
+	model := StandardModel{Name: name}
+	if err := json.Unmarshal(content, &model); err != nil {
+		return nil, utils.LogError("invalid standard model %s: %v", name, err)
+	}
+	if model.Version <= 0 {
+		return nil, utils.LogError("standard model %s has no version", name)
+	}
+	for _, st := range model.ExpenseTypes {
+		if err := model.expenseType(st).PreInsertValid(); err != nil {
+			return nil, err
+		}
+	}
+	return &model, nil
+}
+
+func (m StandardModel) expenseType(st StandardExpenseType) ExpenseType {
+	et := ExpenseType{
+		Name:             st.Name,
+		DefaultTaxeRates: TaxeRateList(st.DefaultTaxeRates),
+		AccountingCode:   sql.NullString{String: st.AccountingCode, Valid: st.AccountingCode != ""},
+		Reimbursable:     st.Reimbursable == nil || *st.Reimbursable,
+		VATRecoverable:   st.VATRecoverable == nil || *st.VATRecoverable,
+		Description:      sql.NullString{String: st.Description, Valid: st.Description != ""},
+		ModelRef:         sql.NullString{String: m.Name + ":" + st.Key, Valid: true},
+	}
+	if len(et.DefaultTaxeRates) == 0 {
+		et.DefaultTaxeRates = nil
+	}
+	return et
+}
+
+// Key of the standard expense type et was installed from, empty when it is
+// not one or was renamed since: a display name can then be translated (see
+// i18n.Printer.TypeName), the name chosen by the user is kept as it is
+func (et ExpenseType) StandardKey() string {
+	_, key, ok := strings.Cut(et.ModelRef.String, ":")
+	if !et.ModelRef.Valid || !ok {
+		return ""
+	}
+	if name, ok := standardTypeNames()[et.ModelRef.String]; !ok || name != et.Name {
+		return ""
+	}
+	return key
+}
+
+// Name of every pack expense type by its ModelRef ("pack:key"), read once:
+// the packs are embedded, and StandardKey runs for each listed type
+var standardTypeNames = sync.OnceValue(func() map[string]string {
+	names := make(map[string]string)
+	available, err := StandardModels()
+	if err != nil {
+		return names
+	}
+	for _, name := range available {
+		model, err := LoadStandardModel(name)
+		if err != nil {
+			continue
+		}
+		for _, st := range model.ExpenseTypes {
+			names[name+":"+st.Key] = st.Name
+		}
+	}
+	return names
+})
+
+// Version of every installed pack
+func InstalledStandardModels(db *sql.DB) (map[string]int, error) {
+	rows, err := db.Query("SELECT name, version FROM installed_standard_models")
+	if err != nil {
+		return nil, utils.LogError("failed to list installed standard models: %v", err)
+	}
+	defer rows.Close()
+
+	installed := make(map[string]int)
+	for rows.Next() {
+		var name string
+		var version int
+		if err := rows.Scan(&name, &version); err != nil {
+			return nil, utils.LogError("failed to scan installed standard model: %v", err)
+		}
+		installed[name] = version
+	}
+	return installed, rows.Err()
+}
+
+// Types whose name is already used are linked to the pack but kept as they are
+func InstallStandardModels(db *sql.DB, names ...string) error {
+	models := make([]*StandardModel, 0, len(names))
+	for _, name := range names {
+		model, err := LoadStandardModel(name)
+		if err != nil {
+			return err
+		}
+		models = append(models, model)
+	}
+
+	for _, model := range models {
+		err := InTx(db, func(tx Querier) error {
+			for _, st := range model.ExpenseTypes {
+				if err := installStandardExpenseType(tx, model.expenseType(st)); err != nil {
+					return err
+				}
+			}
+			return setInstalledVersion(tx, model)
+		})
+		if err != nil {
+			return utils.LogError("failed to install standard model %s: %v", model.Name, err)
+		}
+		slog.Info("standard model installed", "model", model.Name, "version", model.Version)
+	}
+	return nil
+}
+
+func DiffStandardModel(db *sql.DB, name string) ([]StandardModelDiff, error) {
+	model, err := LoadStandardModel(name)
+	if err != nil {
+		return nil, err
+	}
+	current, err := expenseTypesByModelRef(db, model.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]StandardModelDiff, 0, len(model.ExpenseTypes))
+	for _, st := range model.ExpenseTypes {
+		pack := model.expenseType(st)
+		diff := StandardModelDiff{Key: st.Key, Pack: &pack}
+
+		existing, ok := current[pack.ModelRef.String]
+		delete(current, pack.ModelRef.String)
+		switch {
+		case !ok:
+			diff.Status = ModelDiffMissing
+		default:
+			diff.Current = &existing
+			diff.Fields = customizedFields(pack, existing)
+			diff.Status = ModelDiffSame
+			if len(diff.Fields) > 0 {
+				diff.Status = ModelDiffCustomized
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+
+	for ref, existing := range current {
+		existing := existing
+		diffs = append(diffs, StandardModelDiff{
+			Key:     strings.TrimPrefix(ref, model.Name+":"),
+			Status:  ModelDiffRetired,
+			Current: &existing,
+		})
+	}
+	return diffs, nil
+}
+
+// Add the types missing from a newer pack. Customized types are only reset to
+// the pack values with overwrite, retired ones are never deleted.
+func UpgradeStandardModel(db *sql.DB, name string, overwrite bool) (
+	[]StandardModelDiff, error,
+) {
+	model, err := LoadStandardModel(name)
+	if err != nil {
+		return nil, err
+	}
+	diffs, err := DiffStandardModel(db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = InTx(db, func(tx Querier) error {
+		for _, diff := range diffs {
+			switch {
+			case diff.Status == ModelDiffMissing:
+				if err := installStandardExpenseType(tx, *diff.Pack); err != nil {
+					return err
+				}
+			case diff.Status == ModelDiffCustomized && overwrite:
+				pack := *diff.Pack
+				pack.ID = diff.Current.ID
+				if err := updateStandardExpenseType(tx, pack); err != nil {
+					return err
+				}
+			}
+		}
+		return setInstalledVersion(tx, model)
+	})
+	if err != nil {
+		return nil, utils.LogError("failed to upgrade standard model %s: %v", name, err)
+	}
+
+	slog.Info("standard model upgraded", "model", model.Name, "version", model.Version)
+	return diffs, nil
+}
+
+func installStandardExpenseType(tx Querier, et ExpenseType) error {
+	var count int
+	err := tx.QueryRow(
+		"SELECT COUNT(*) FROM expense_types WHERE model_ref = ?", et.ModelRef,
+	).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	res, err := tx.Exec(
+		"UPDATE expense_types SET model_ref = ? WHERE name = ? AND model_ref IS NULL",
+		et.ModelRef, et.Name,
+	)
+	if err != nil {
+		return err
+	}
+	if linked, err := res.RowsAffected(); err != nil || linked > 0 {
+		return err
+	}
+
+	res, err = tx.Exec(
+		`INSERT OR IGNORE INTO expense_types(
+			name,
+			default_taxe_rates,
+			accounting_code,
+			reimbursable,
+			vat_recoverable,
+			description,
+			model_ref
+		) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		et.Name, et.DefaultTaxeRates, et.AccountingCode,
+		et.Reimbursable, et.VATRecoverable, et.Description, et.ModelRef,
+	)
+	if err != nil {
+		return err
+	}
+	if inserted, err := res.RowsAffected(); err != nil || inserted > 0 {
+		return err
+	}
+	slog.Info(
+		"standard expense type not installed, name already used by another standard model",
+		"model_ref", et.ModelRef.String,
+	)
+	return nil
+}
+
+func updateStandardExpenseType(tx Querier, et ExpenseType) error {
+	_, err := tx.Exec(
+		`UPDATE expense_types SET
+			name = ?,
+			default_taxe_rates = ?,
+			accounting_code = ?,
+			reimbursable = ?,
+			vat_recoverable = ?,
+			description = ?
+		WHERE id = ?`,
+		et.Name, et.DefaultTaxeRates, et.AccountingCode,
+		et.Reimbursable, et.VATRecoverable, et.Description, et.ID,
+	)
+	return err
+}
+
+func setInstalledVersion(tx Querier, model *StandardModel) error {
+	_, err := tx.Exec(
+		`INSERT INTO installed_standard_models(name, version) VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET version = excluded.version`,
+		model.Name, model.Version,
+	)
+	return err
+}
+
+func expenseTypesByModelRef(db *sql.DB, modelName string) (map[string]ExpenseType, error) {
+	rows, err := db.Query(
+		`SELECT
+			id,
+			name,
+			default_taxe_rates,
+			accounting_code,
+			reimbursable,
+			vat_recoverable,
+			description,
+			model_ref
+		FROM expense_types WHERE model_ref LIKE ? ESCAPE '\'`,
+		strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(modelName)+":%",
+	)
+	if err != nil {
+		return nil, utils.LogError("failed to fetch expense types of %s: %v", modelName, err)
+	}
+	defer rows.Close()
+
+	expenseTypes := make(map[string]ExpenseType)
+	for rows.Next() {
+		var et ExpenseType
+		err := rows.Scan(
+			&et.ID,
+			&et.Name,
+			&et.DefaultTaxeRates,
+			&et.AccountingCode,
+			&et.Reimbursable,
+			&et.VATRecoverable,
+			&et.Description,
+			&et.ModelRef,
+		)
+		if err != nil {
+			return nil, utils.LogError("failed to scan expense type: %v", err)
+		}
+		expenseTypes[et.ModelRef.String] = et
+	}
+	return expenseTypes, rows.Err()
+}
+
+func customizedFields(pack ExpenseType, current ExpenseType) []string {
+	var fields []string
+	if pack.Name != current.Name {
+		fields = append(fields, "name")
+	}
+	if !slices.Equal(pack.DefaultTaxeRates, current.DefaultTaxeRates) {
+		fields = append(fields, "default_taxe_rates")
+	}
+	if pack.AccountingCode != current.AccountingCode {
+		fields = append(fields, "accounting_code")
+	}
+	if pack.Reimbursable != current.Reimbursable {
+		fields = append(fields, "reimbursable")
+	}
+	if pack.VATRecoverable != current.VATRecoverable {
+		fields = append(fields, "vat_recoverable")
+	}
+	if pack.Description != current.Description {
+		fields = append(fields, "description")
+	}
+	return fields
+}
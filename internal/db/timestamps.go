@@ -0,0 +1,73 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Timestamps are stored in UTC as RFC3339 with a fixed width fraction, so the
+// text order of a column is the time order (see migrations/012_time_zones.sql).
+// Where it happened is kept apart, as the IANA time zone of the expense or
+// session: the local date is the one of the receipt, not the one in UTC.
+const TimestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Layout the sqlite driver wrote time.Time values with, before migration 012
+const driverTimestampLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(TimestampLayout)
+}
+
+func ParseTimestamp(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		// Rows pulled from a device that didn't migrate yet
+		var errDriver error
+		if t, errDriver = time.Parse(driverTimestampLayout, value); errDriver != nil {
+			return time.Time{}, utils.IntegrityError("error parsing time: %v", err)
+		}
+	}
+	return t.UTC(), nil
+}
+
+// Location of an IANA time zone name ("Europe/Paris"), UTC without one. Names
+// are checked on insert, one the system doesn't know anymore falls back to UTC.
+func TimeZoneLocation(timeZone sql.NullString) *time.Location {
+	if !timeZone.Valid {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(timeZone.String)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// Same time in the zone, so its date is the local one
+func InTimeZone(t time.Time, timeZone sql.NullString) time.Time {
+	return t.In(TimeZoneLocation(timeZone))
+}
+
+func validTimeZone(name string) bool {
+	// "Local" is the zone of the machine, not a place
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+func validateNullTimeZone(v *utils.Validator, field string, timeZone sql.NullString) {
+	if timeZone.Valid {
+		v.Format(field, validTimeZone(timeZone.String), "an IANA time zone")
+	}
+}
+
+func ValidTimeZone(name string) error {
+	v := utils.Validator{}
+	validateNullTimeZone(&v, "time_zone", sql.NullString{String: name, Valid: true})
+	return v.Err()
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// What crud runs its statements on: the database, or the transaction of a
+// service writing several rows that must all be there or none (*sql.Tx)
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Run fn in a transaction, committed when it returns nil and rolled back
+// otherwise. Inside a transaction already, fn joins it and the outer one
+// decides.
+func InTx(database Querier, fn func(tx Querier) error) error {
+	switch database := database.(type) {
+	case *sql.DB:
+		tx, err := database.Begin()
+		if err != nil {
+			return utils.LogError("failed to begin transaction: %v", err)
+		}
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return utils.LogError("failed to commit transaction: %v", err)
+		}
+		return nil
+	default:
+		return fn(database)
+	}
+}
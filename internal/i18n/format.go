@@ -0,0 +1,70 @@
+package i18n
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// Separators and layouts of a locale, French ones use a no-break space to
+// group digits (U+00A0, in the Latin-1 range of the PDF reports)
+type numberFormat struct {
+    decimal  string
+    group    string
+    percent  string // between the number and "%"
+    date     string
+    dateTime string
+    csvComma rune // Excel opens ";" separated files in locales with a decimal comma
+}
+
+var numberFormats = map[string]numberFormat{
+    "en": {".", ",", "", time.DateOnly, time.RFC3339, ','},
+    "fr": {",", "\u00a0", "\u00a0", "02/01/2006", "02/01/2006 15:04 MST", ';'},
+}
+
+// Grouped by thousands, decimals digits after the separator (-1 for as many
+// as needed), for people to read
+func (p *Printer) Number(value float64, decimals int) string {
+    text := p.Decimal(value, decimals)
+    integer, fraction, _ := strings.Cut(text, p.format.decimal)
+    sign := ""
+    if strings.HasPrefix(integer, "-") {
+        sign, integer = "-", integer[1:]
+    }
+    var grouped strings.Builder
+    for i, digit := range integer {
+        if i > 0 && (len(integer)-i)%3 == 0 {
+            grouped.WriteString(p.format.group)
+        }
+        grouped.WriteRune(digit)
+    }
+    if fraction != "" {
+        return sign + grouped.String() + p.format.decimal + fraction
+    }
+    return sign + grouped.String()
+}
+
+// Not grouped, for spreadsheets to parse
+func (p *Printer) Decimal(value float64, decimals int) string {
+    text := strconv.FormatFloat(value, 'f', decimals, 64)
+    return strings.Replace(text, ".", p.format.decimal, 1)
+}
+
+// value is a percentage, 20 gives "20.00%"
+func (p *Printer) Percent(value float64) string {
+    return p.Number(value, 2) + p.format.percent + "%"
+}
+
+func (p *Printer) Date(t time.Time) string {
+    return t.Format(p.format.date)
+}
+
+func (p *Printer) DateTime(t time.Time) string {
+    return t.Format(p.format.dateTime)
+}
+
+// Field separator of the CSV exports
+func (p *Printer) CSVComma() rune {
+    return p.format.csvComma
+}
@@ -0,0 +1,121 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+
+// Message catalogs are flat JSON objects in locales/<locale>.json, a key
+// missing from a locale falls back to English, then to the key itself.
+// Keys are grouped by prefix:
+// - report.*, vat.*: lines of the reports (fmt verbs, see Printer.T)
+// - field.*: labels of the fields of the validation errors
+// - violation.*: messages of the violation codes, with {param} placeholders
+// - format.*: formats of invalid_format violations
+// - expense_type.*: display names of the standard expense types, by key
+
+const DefaultLocale = "en"
+
+// Locales with a catalog
+var Supported = []string{"en", "fr"}
+
+//go:embed locales/*.json
+var localesFS embed.FS
+
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]map[string]string {
+    catalogs := make(map[string]map[string]string, len(Supported))
+    for _, locale := range Supported {
+        content, err := localesFS.ReadFile(path.Join("locales", locale+".json"))
+        if err != nil {
+            panic("i18n: missing catalog " + locale + ": " + err.Error())
+        }
+        messages := make(map[string]string)
+        if err := json.Unmarshal(content, &messages); err != nil {
+            panic("i18n: invalid catalog " + locale + ": " + err.Error())
+        }
+        catalogs[locale] = messages
+    }
+    return catalogs
+}
+
+// Supported locale of a language tag ("fr-CH", "fr_FR.UTF-8"...), empty when
+// there is no catalog for its language
+func Match(tag string) string {
+    tag = strings.ToLower(strings.TrimSpace(tag))
+    if i := strings.IndexAny(tag, ".@"); i >= 0 {
+        tag = tag[:i]
+    }
+    language, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+    if slices.Contains(Supported, language) {
+        return language
+    }
+    return ""
+}
+
+// Best supported locale of an Accept-Language header ("fr-CH, fr;q=0.9,
+// en;q=0.8"), fallback when none is supported
+func Negotiate(acceptLanguage string, fallback string) string {
+    type candidate struct {
+        locale  string
+        quality float64
+    }
+    var candidates []candidate
+    for _, part := range strings.Split(acceptLanguage, ",") {
+        tag, params, _ := strings.Cut(part, ";")
+        quality := 1.0
+        if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+            parsed, err := strconv.ParseFloat(value, 64)
+            if err != nil {
+                continue
+            }
+            quality = parsed
+        }
+        locale := Match(tag)
+        if strings.TrimSpace(tag) == "*" {
+            locale = fallback
+        }
+        if locale != "" && quality > 0 {
+            candidates = append(candidates, candidate{locale, quality})
+        }
+    }
+    sort.SliceStable(candidates, func(i, j int) bool {
+        return candidates[i].quality > candidates[j].quality
+    })
+    if len(candidates) == 0 {
+        return fallback
+    }
+    return candidates[0].locale
+}
+
+// Locale of the environment, from LC_ALL, LC_MESSAGES then LANG. Empty when
+// unset or unsupported.
+func FromEnv() string {
+    for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+        if value := os.Getenv(name); value != "" {
+            return Match(value)
+        }
+    }
+    return ""
+}
+
+// Locale to use for a setting, the environment's one when setting is empty
+// and DefaultLocale when nothing matches
+func Resolve(setting string) string {
+    locale := FromEnv()
+    if setting != "" {
+        locale = Match(setting)
+    }
+    if locale == "" {
+        return DefaultLocale
+    }
+    return locale
+}
@@ -0,0 +1,161 @@
+package i18n
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Messages and formats of a locale:
+//   p := i18n.NewPrinter(config.Locale)
+//   p.T("report.client", name)
+type Printer struct {
+    locale   string
+    messages map[string]string
+    format   numberFormat
+}
+
+// English for a locale without catalog
+func NewPrinter(locale string) *Printer {
+    if _, ok := catalogs[locale]; !ok {
+        locale = DefaultLocale
+    }
+    return &Printer{locale: locale, messages: catalogs[locale], format: numberFormats[locale]}
+}
+
+func (p *Printer) Locale() string {
+    return p.locale
+}
+
+// The message of key formatted with args like fmt.Sprintf
+func (p *Printer) T(key string, args ...interface{}) string {
+    message, _ := p.lookup(key)
+    return fmt.Sprintf(message, args...)
+}
+
+func (p *Printer) lookup(key string) (string, bool) {
+    if message, ok := p.messages[key]; ok {
+        return message, true
+    }
+    if message, ok := catalogs[DefaultLocale][key]; ok {
+        return message, true
+    }
+    return key, false
+}
+
+// Label of a field or of the last part of its path ("line_items[0].total"
+// gives the label of "total"), its name with spaces without a translation
+func (p *Printer) Field(field string) string {
+    if label, ok := p.lookup("field." + field); ok {
+        return label
+    }
+    last := field[strings.LastIndex(field, ".")+1:]
+    if i := strings.Index(last, "["); i >= 0 {
+        last = last[:i]
+    }
+    if label, ok := p.lookup("field." + last); ok {
+        return label
+    }
+    return strings.ReplaceAll(last, "_", " ")
+}
+
+// Display name of an expense type, translated when it is a standard one not
+// renamed (key is its standard key, see db.ExpenseType.StandardKey)
+func (p *Printer) TypeName(key string, name string) string {
+    if key == "" {
+        return name
+    }
+    if display, ok := p.lookup("expense_type." + key); ok {
+        return display
+    }
+    return name
+}
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// Message of a violation from its code and params, its own message when the
+// locale has no message for the code (the English messages are the ones of
+// the code, more precise than a generic one)
+func (p *Printer) Violation(violation utils.Violation) string {
+    template, ok := p.messages[violationKey(violation)]
+    if !ok {
+        return violation.Message
+    }
+    return placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+        name := placeholder[1 : len(placeholder)-1]
+        switch name {
+        case "field":
+            return p.Field(violation.Field)
+        case "after":
+            return p.Field(fmt.Sprint(violation.Params[name]))
+        case "format":
+            format := fmt.Sprint(violation.Params[name])
+            if label, ok := p.lookup("format." + format); ok {
+                return label
+            }
+            return format
+        default:
+            return p.param(violation.Params[name])
+        }
+    })
+}
+
+// out_of_range has a message for each bound given
+func violationKey(violation utils.Violation) string {
+    key := "violation." + violation.Code
+    if violation.Code != utils.ViolationRange {
+        return key
+    }
+    _, hasMin := violation.Params["min"]
+    _, hasMax := violation.Params["max"]
+    switch {
+    case hasMin && hasMax:
+        return key
+    case violation.Params["exclusive_min"] == true:
+        return key + ".positive"
+    case hasMin:
+        return key + ".min"
+    default:
+        return key + ".max"
+    }
+}
+
+func (p *Printer) param(value interface{}) string {
+    switch v := value.(type) {
+    case float64:
+        return p.Decimal(v, -1)
+    case int:
+        return p.Decimal(float64(v), -1)
+    case []string:
+        return strings.Join(v, ", ")
+    case []interface{}:
+        items := make([]string, len(v))
+        for i, item := range v {
+            items[i] = p.param(item)
+        }
+        return strings.Join(items, ", ")
+    default:
+        return fmt.Sprint(v)
+    }
+}
+
+// Message of err for a user: the translated violations of a validation
+// error, err.Error() for the others
+func (p *Printer) Error(err error) string {
+    violations := utils.ErrorViolations(err)
+    if len(violations) == 0 {
+        return err.Error()
+    }
+    return strings.Join(p.Violations(violations), "; ")
+}
+
+func (p *Printer) Violations(violations []utils.Violation) []string {
+    messages := make([]string, len(violations))
+    for i, violation := range violations {
+        messages[i] = p.Violation(violation)
+    }
+    return messages
+}
@@ -0,0 +1,120 @@
+package imaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// Formats the standard library can't decode are converted by external tools
+// when they are installed: libheif (or sips on macOS) for HEIC pictures from
+// iPhones, poppler for PDF invoices.
+
+var ErrMissingTool = errors.New("conversion tool not installed")
+
+// None of the tools converting a format is installed, errors.Is ErrMissingTool
+type MissingToolError struct {
+    Format string   // HEIC, PDF
+    Tools  []string // any of them is enough
+}
+
+func (e *MissingToolError) Error() string {
+    return fmt.Sprintf(
+        "%s receipts need %s installed (see README)", e.Format, strings.Join(e.Tools, " or "),
+    )
+}
+
+func (e *MissingToolError) Is(target error) bool {
+    return target == ErrMissingTool
+}
+
+const conversionTimeout = time.Minute
+
+type converter struct {
+    command string
+    args    func(in, out string) []string
+    output  func(out string) string // file actually written by the tool
+}
+
+var heicConverters = []converter{
+    {
+        command: "heif-convert",
+        args:    func(in, out string) []string { return []string{"-q", "95", in, out} },
+        output:  func(out string) string { return out },
+    },
+    {
+        command: "sips",
+        args: func(in, out string) []string {
+            return []string{"-s", "format", "jpeg", in, "--out", out}
+        },
+        output: func(out string) string { return out },
+    },
+}
+
+// HEIC/HEIF to JPEG. EXIF metadata may survive the conversion, run the
+// result through Process.
+func ConvertHEIC(data []byte) ([]byte, error) {
+    return convert("HEIC", heicConverters, data, ".heic", ".jpg")
+}
+
+// First page of a PDF as a PNG image, rendered at dpi
+func RenderPDFFirstPage(data []byte, dpi int) ([]byte, error) {
+    pdfToPPM := converter{
+        command: "pdftoppm",
+        args: func(in, out string) []string {
+            return []string{
+                "-png", "-singlefile", "-f", "1", "-l", "1", "-r", strconv.Itoa(dpi), in, out,
+            }
+        },
+        // pdftoppm adds the extension itself
+        output: func(out string) string { return out + ".png" },
+    }
+    return convert("PDF", []converter{pdfToPPM}, data, ".pdf", "")
+}
+
+// First installed converter wins
+func convert(
+    format string, converters []converter, data []byte, inExt, outExt string,
+) ([]byte, error) {
+    for _, c := range converters {
+        path, err := exec.LookPath(c.command)
+        if err != nil {
+            continue
+        }
+
+        dir, err := os.MkdirTemp("", "expenseflow-convert-")
+        if err != nil {
+            return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+        }
+        defer os.RemoveAll(dir)
+        in, out := filepath.Join(dir, "in"+inExt), filepath.Join(dir, "out"+outExt)
+        if err := os.WriteFile(in, data, 0600); err != nil {
+            return nil, fmt.Errorf("failed to write temporary file: %w", err)
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), conversionTimeout)
+        defer cancel()
+        output, err := exec.CommandContext(ctx, path, c.args(in, out)...).CombinedOutput()
+        if err != nil {
+            return nil, fmt.Errorf("%s failed: %w: %s", c.command, err, output)
+        }
+        converted, err := os.ReadFile(c.output(out))
+        if err != nil {
+            return nil, fmt.Errorf("%s wrote no output: %w", c.command, err)
+        }
+        return converted, nil
+    }
+
+    names := make([]string, 0, len(converters))
+    for _, c := range converters {
+        names = append(names, c.command)
+    }
+    return nil, &MissingToolError{Format: format, Tools: names}
+}
@@ -0,0 +1,139 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+
+// Just enough of JPEG and EXIF to read the orientation and drop metadata,
+// see https://www.cipa.jp/std/documents/e/DC-X008-Translation-2019-E.pdf
+
+const (
+    markerSOI  = 0xD8
+    markerSOS  = 0xDA
+    markerAPP1 = 0xE1
+
+    tagOrientation = 0x0112
+)
+
+var (
+    exifHeader = []byte("Exif\x00\x00")
+    xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/")
+)
+
+type jpegSegment struct {
+    marker  byte
+    start   int // first byte of the marker
+    end     int // first byte after the segment
+    payload []byte
+}
+
+// Segments before the image data (SOS), which holds no metadata
+func jpegSegments(data []byte) ([]jpegSegment, int, error) {
+    if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+        return nil, 0, errors.New("not a JPEG file")
+    }
+    var segments []jpegSegment
+    pos := 2
+    for pos+4 <= len(data) {
+        if data[pos] != 0xFF {
+            return nil, 0, errors.New("invalid JPEG marker")
+        }
+        marker := data[pos+1]
+        if marker == 0xFF { // fill byte
+            pos++
+            continue
+        }
+        if marker == markerSOS {
+            return segments, pos, nil
+        }
+        length := int(binary.BigEndian.Uint16(data[pos+2:]))
+        if length < 2 || pos+2+length > len(data) {
+            return nil, 0, errors.New("truncated JPEG segment")
+        }
+        segments = append(segments, jpegSegment{
+            marker:  marker,
+            start:   pos,
+            end:     pos + 2 + length,
+            payload: data[pos+4 : pos+2+length],
+        })
+        pos += 2 + length
+    }
+    return nil, 0, errors.New("JPEG without image data")
+}
+
+// EXIF orientation of a JPEG, 1 (as stored) when missing or unreadable
+func Orientation(data []byte) int {
+    segments, _, err := jpegSegments(data)
+    if err != nil {
+        return 1
+    }
+    for _, segment := range segments {
+        if segment.marker == markerAPP1 && bytes.HasPrefix(segment.payload, exifHeader) {
+            if orientation := tiffOrientation(segment.payload[len(exifHeader):]); orientation != 0 {
+                return orientation
+            }
+        }
+    }
+    return 1
+}
+
+// Orientation entry of IFD0, 0 when not found
+func tiffOrientation(tiff []byte) int {
+    if len(tiff) < 8 {
+        return 0
+    }
+    var order binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        order = binary.LittleEndian
+    case "MM":
+        order = binary.BigEndian
+    default:
+        return 0
+    }
+    if order.Uint16(tiff[2:]) != 42 {
+        return 0
+    }
+
+    ifd := int(order.Uint32(tiff[4:]))
+    if ifd < 8 || ifd+2 > len(tiff) {
+        return 0
+    }
+    count := int(order.Uint16(tiff[ifd:]))
+    for i := 0; i < count; i++ {
+        entry := ifd + 2 + i*12
+        if entry+12 > len(tiff) {
+            return 0
+        }
+        if order.Uint16(tiff[entry:]) == tagOrientation {
+            orientation := int(order.Uint16(tiff[entry+8:]))
+            if orientation < 1 || orientation > 8 {
+                return 0
+            }
+            return orientation
+        }
+    }
+    return 0
+}
+
+// Drop the EXIF (GPS position, camera serial...) and XMP segments of a JPEG
+// without re-encoding it
+func StripJPEGMetadata(data []byte) ([]byte, error) {
+    segments, imageStart, err := jpegSegments(data)
+    if err != nil {
+        return nil, err
+    }
+    stripped := make([]byte, 0, len(data))
+    stripped = append(stripped, data[:2]...)
+    for _, segment := range segments {
+        if segment.marker == markerAPP1 &&
+            (bytes.HasPrefix(segment.payload, exifHeader) || bytes.HasPrefix(segment.payload, xmpHeader)) {
+            continue
+        }
+        stripped = append(stripped, data[segment.start:segment.end]...)
+    }
+    return append(stripped, data[imageStart:]...), nil
+}
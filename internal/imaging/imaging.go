@@ -0,0 +1,148 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+
+// Receipt pictures straight from a phone are big, sideways and carry the GPS
+// position where they were taken. Process fixes all three with the standard
+// library only: JPEG, PNG and GIF are handled, other formats are kept as is.
+
+type Options struct {
+    MaxSide       int // longest side in pixels of the stored image, 0 to keep it
+    Quality       int // JPEG quality when re-encoding, 1-100
+    ThumbnailSide int // longest side of thumbnails, 0 for none
+}
+
+type Result struct {
+    Data      []byte
+    Ext       string // extension matching Data, like ".jpg"
+    Thumbnail []byte // JPEG, nil when the format can't be decoded
+    Width     int
+    Height    int
+}
+
+func Process(data []byte, opts Options) (*Result, error) {
+    switch http.DetectContentType(data) {
+    case "image/jpeg":
+        return processJPEG(data, opts)
+    case "image/png":
+        return processPNG(data, opts)
+    case "image/gif":
+        return processGIF(data, opts)
+    default:
+        // bmp and webp have no decoder in the standard library
+        return &Result{Data: data}, nil
+    }
+}
+
+// Re-encoded only when turned or downscaled, otherwise the metadata is
+// dropped losslessly
+func processJPEG(data []byte, opts Options) (*Result, error) {
+    orientation := Orientation(data)
+    config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("invalid JPEG: %w", err)
+    }
+
+    if orientation == 1 && !tooLarge(config, opts.MaxSide) {
+        stripped, err := StripJPEGMetadata(data)
+        if err != nil {
+            return nil, fmt.Errorf("invalid JPEG: %w", err)
+        }
+        result := &Result{Data: stripped, Ext: ".jpg", Width: config.Width, Height: config.Height}
+        if opts.ThumbnailSide > 0 {
+            img, err := jpeg.Decode(bytes.NewReader(data))
+            if err != nil {
+                return nil, fmt.Errorf("invalid JPEG: %w", err)
+            }
+            return result, result.setThumbnail(img, opts)
+        }
+        return result, nil
+    }
+
+    img, err := jpeg.Decode(bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("invalid JPEG: %w", err)
+    }
+    img = Resize(Orient(img, orientation), opts.MaxSide)
+    var buffer bytes.Buffer
+    // A freshly encoded JPEG has no EXIF at all
+    if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: quality(opts)}); err != nil {
+        return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+    }
+    result := &Result{
+        Data: buffer.Bytes(), Ext: ".jpg", Width: img.Bounds().Dx(), Height: img.Bounds().Dy(),
+    }
+    return result, result.setThumbnail(img, opts)
+}
+
+func processPNG(data []byte, opts Options) (*Result, error) {
+    img, err := png.Decode(bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("invalid PNG: %w", err)
+    }
+    result := &Result{Data: data, Ext: ".png"}
+    bounds := img.Bounds()
+    if tooLarge(image.Config{Width: bounds.Dx(), Height: bounds.Dy()}, opts.MaxSide) {
+        img = Resize(img, opts.MaxSide)
+        var buffer bytes.Buffer
+        encoder := png.Encoder{CompressionLevel: png.BestCompression}
+        if err := encoder.Encode(&buffer, img); err != nil {
+            return nil, fmt.Errorf("failed to encode PNG: %w", err)
+        }
+        result.Data = buffer.Bytes()
+    }
+    result.Width, result.Height = img.Bounds().Dx(), img.Bounds().Dy()
+    return result, result.setThumbnail(img, opts)
+}
+
+// Kept as is, animations would be lost otherwise
+func processGIF(data []byte, opts Options) (*Result, error) {
+    img, err := gif.Decode(bytes.NewReader(data))
+    if err != nil {
+        return nil, fmt.Errorf("invalid GIF: %w", err)
+    }
+    result := &Result{
+        Data: data, Ext: ".gif", Width: img.Bounds().Dx(), Height: img.Bounds().Dy(),
+    }
+    return result, result.setThumbnail(img, opts)
+}
+
+func (r *Result) setThumbnail(img image.Image, opts Options) error {
+    if opts.ThumbnailSide <= 0 {
+        return nil
+    }
+    // JPEG has no transparency, transparent receipts (screenshots...) go on white
+    thumbnail := toRGBA(Resize(img, opts.ThumbnailSide))
+    background := image.NewRGBA(thumbnail.Rect)
+    draw.Draw(background, background.Rect, image.White, image.Point{}, draw.Src)
+    draw.Draw(background, background.Rect, thumbnail, image.Point{}, draw.Over)
+    thumbnail = background
+
+    var buffer bytes.Buffer
+    if err := jpeg.Encode(&buffer, thumbnail, &jpeg.Options{Quality: 80}); err != nil {
+        return fmt.Errorf("failed to encode thumbnail: %w", err)
+    }
+    r.Thumbnail = buffer.Bytes()
+    return nil
+}
+
+func tooLarge(config image.Config, maxSide int) bool {
+    return maxSide > 0 && (config.Width > maxSide || config.Height > maxSide)
+}
+
+func quality(opts Options) int {
+    if opts.Quality < 1 || opts.Quality > 100 {
+        return jpeg.DefaultQuality
+    }
+    return opts.Quality
+}
@@ -0,0 +1,95 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+
+func toRGBA(img image.Image) *image.RGBA {
+    if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+        return rgba
+    }
+    bounds := img.Bounds()
+    rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+    draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+    return rgba
+}
+
+// Apply an EXIF orientation so the image displays upright
+func Orient(img image.Image, orientation int) image.Image {
+    if orientation < 2 || orientation > 8 {
+        return img
+    }
+    src := toRGBA(img)
+    w, h := src.Rect.Dx(), src.Rect.Dy()
+
+    dw, dh := w, h
+    if orientation >= 5 { // 90° turns swap width and height
+        dw, dh = h, w
+    }
+    dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+    for y := 0; y < dh; y++ {
+        for x := 0; x < dw; x++ {
+            var sx, sy int
+            switch orientation {
+            case 2: // mirrored
+                sx, sy = w-1-x, y
+            case 3: // upside down
+                sx, sy = w-1-x, h-1-y
+            case 4: // mirrored upside down
+                sx, sy = x, h-1-y
+            case 5: // transposed
+                sx, sy = y, x
+            case 6: // needs a clockwise turn
+                sx, sy = y, h-1-x
+            case 7: // transversed
+                sx, sy = w-1-y, h-1-x
+            case 8: // needs a counterclockwise turn
+                sx, sy = w-1-y, x
+            }
+            copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):])
+        }
+    }
+    return dst
+}
+
+// Downscale so the longest side is at most maxSide, averaging the source
+// pixels covered by each destination pixel. Smaller images are left as is.
+func Resize(img image.Image, maxSide int) image.Image {
+    bounds := img.Bounds()
+    w, h := bounds.Dx(), bounds.Dy()
+    if maxSide <= 0 || (w <= maxSide && h <= maxSide) {
+        return img
+    }
+    dw, dh := maxSide, max(1, h*maxSide/w)
+    if h > w {
+        dw, dh = max(1, w*maxSide/h), maxSide
+    }
+
+    src := toRGBA(img)
+    dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+    for y := 0; y < dh; y++ {
+        y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+        for x := 0; x < dw; x++ {
+            x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+            var sum [4]int
+            for sy := y0; sy < y1; sy++ {
+                offset := src.PixOffset(x0, sy)
+                for sx := x0; sx < x1; sx++ {
+                    for c := 0; c < 4; c++ {
+                        sum[c] += int(src.Pix[offset+c])
+                    }
+                    offset += 4
+                }
+            }
+            count := (y1 - y0) * (x1 - x0)
+            offset := dst.PixOffset(x, y)
+            for c := 0; c < 4; c++ {
+                dst.Pix[offset+c] = uint8(sum[c] / count)
+            }
+        }
+    }
+    return dst
+}
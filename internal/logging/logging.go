@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+)
+
+
+// Logging of the app, through log/slog: leveled records, as text or JSON, to a
+// rotated file, with sensitive attributes masked (see Redact). The standard
+// log package ends up in the same handler, at info level.
+
+const (
+    FormatText = "text"
+    FormatJSON = "json"
+)
+
+type Options struct {
+    Path     string
+    Level    slog.Level
+    Format   string // FormatText or FormatJSON
+    MaxSize  int64  // bytes before rotation, 0 to never rotate
+    MaxFiles int    // rotated files kept
+}
+
+// The returned closer flushes and closes the log file
+func Setup(options Options) (io.Closer, error) {
+    file, err := OpenRotatingFile(options.Path, options.MaxSize, options.MaxFiles)
+    if err != nil {
+        return nil, err
+    }
+    handler, err := NewHandler(file, options.Level, options.Format)
+    if err != nil {
+        file.Close()
+        return nil, err
+    }
+    slog.SetDefault(slog.New(handler))
+    return file, nil
+}
+
+func NewHandler(w io.Writer, level slog.Level, format string) (slog.Handler, error) {
+    handlerOptions := &slog.HandlerOptions{
+        AddSource:   true,
+        Level:       level,
+        ReplaceAttr: redactAttr,
+    }
+    switch format {
+    case FormatText, "":
+        return slog.NewTextHandler(w, handlerOptions), nil
+    case FormatJSON:
+        return slog.NewJSONHandler(w, handlerOptions), nil
+    default:
+        return nil, fmt.Errorf("unknown log format: %q", format)
+    }
+}
+
+// Record attributed to the caller skip frames above the caller of Log, for
+// helpers like utils.LogError
+func Log(skip int, level slog.Level, message string, args ...any) {
+    logger := slog.Default()
+    if !logger.Enabled(context.Background(), level) {
+        return
+    }
+    var pcs [1]uintptr
+    runtime.Callers(skip+2, pcs[:])
+    record := slog.NewRecord(time.Now(), level, message, pcs[0])
+    record.Add(args...)
+    if err := logger.Handler().Handle(context.Background(), record); err != nil {
+        fmt.Fprintf(os.Stderr, "failed to log: %v\n", err)
+    }
+}
@@ -0,0 +1,193 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+
+// Logs are for debugging, not a copy of the expenses: what a user typed (notes,
+// names, places) and the secrets are masked, IDs and amounts are kept.
+const redacted = "[redacted]"
+
+var sensitiveKeys = map[string]bool{
+    "name":                true,
+    "notes":               true,
+    "note":                true,
+    "location":            true,
+    "trip_start_location": true,
+    "trip_end_location":   true,
+    "description":         true,
+    "value":               true,
+    "values":              true,
+    "query":               true,
+    "text":                true,
+    "address":             true,
+    "token":               true,
+    "password":            true,
+    "secret":              true,
+    "authorization":       true,
+}
+
+// Keys are compared in snake_case, TripStartLocation matches trip_start_location
+func IsSensitive(key string) bool {
+    return sensitiveKeys[snakeCase(key)]
+}
+
+// What a user typed, interpolated in an error message: the returned error
+// shows it, the logged record masks it (see Redact)
+//   utils.ConflictError("client name already exists: %s", logging.UserValue(name))
+func UserValue(value any) any {
+    return userValue{value}
+}
+
+type userValue struct {
+    value any
+}
+
+// Formatted like the value itself, whatever the verb (%s, %q, %v...)
+func (u userValue) Format(f fmt.State, verb rune) {
+    fmt.Fprintf(f, fmt.FormatString(f, verb), u.value)
+}
+
+// Copy of value safe to log: structs (or pointers to them, slices of them)
+// with their sensitive fields masked, user values (UserValue) replaced.
+// Other values are returned as they are.
+func Redact(value any) any {
+    if _, ok := value.(userValue); ok {
+        return redacted
+    }
+    v := reflect.ValueOf(value)
+    if !needsRedaction(v) {
+        return value
+    }
+    return redactValue(v)
+}
+
+// Struct printed like %+v, with its sensitive fields masked
+type redactedStruct struct {
+    name   string
+    fields []redactedField
+}
+
+type redactedField struct {
+    name  string
+    value any
+}
+
+func (rs redactedStruct) String() string {
+    var b strings.Builder
+    b.WriteString(rs.name + "{")
+    for i, field := range rs.fields {
+        if i > 0 {
+            b.WriteString(" ")
+        }
+        fmt.Fprintf(&b, "%s:%v", field.name, field.value)
+    }
+    b.WriteString("}")
+    return b.String()
+}
+
+func (rs redactedStruct) LogValue() slog.Value {
+    attrs := make([]slog.Attr, 0, len(rs.fields))
+    for _, field := range rs.fields {
+        attrs = append(attrs, slog.Any(snakeCase(field.name), field.value))
+    }
+    return slog.GroupValue(attrs...)
+}
+
+func redactValue(v reflect.Value) any {
+    switch v.Kind() {
+    case reflect.Pointer, reflect.Interface:
+        if v.IsNil() {
+            return nil
+        }
+        return redactValue(v.Elem())
+    case reflect.Slice, reflect.Array:
+        items := make([]any, v.Len())
+        for i := range items {
+            items[i] = redactValue(v.Index(i))
+        }
+        return items
+    case reflect.Struct:
+        if !needsRedaction(v) {
+            return v.Interface()
+        }
+        rs := redactedStruct{name: v.Type().Name()}
+        for i := 0; i < v.NumField(); i++ {
+            field := v.Type().Field(i)
+            if !field.IsExported() {
+                continue
+            }
+            var value any = redacted
+            if !IsSensitive(field.Name) {
+                value = redactValue(v.Field(i))
+            }
+            rs.fields = append(rs.fields, redactedField{field.Name, value})
+        }
+        return rs
+    default:
+        if v.CanInterface() {
+            return v.Interface()
+        }
+        return fmt.Sprint(v)
+    }
+}
+
+// Errors, LogValuers and structs without exported fields (time.Time...) are
+// left alone. Stringers are not: models print their notes in String.
+func needsRedaction(v reflect.Value) bool {
+    if !v.IsValid() || !v.CanInterface() {
+        return false
+    }
+    switch v.Interface().(type) {
+    case nil, error, slog.LogValuer:
+        return false
+    }
+    switch v.Kind() {
+    case reflect.Pointer, reflect.Interface:
+        return !v.IsNil() && needsRedaction(v.Elem())
+    case reflect.Slice, reflect.Array:
+        return v.Len() > 0 && needsRedaction(v.Index(0))
+    case reflect.Struct:
+        for i := 0; i < v.NumField(); i++ {
+            if v.Type().Field(i).IsExported() {
+                return true
+            }
+        }
+        return false
+    default:
+        return false
+    }
+}
+
+// ReplaceAttr of the handlers
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+    if IsSensitive(attr.Key) {
+        return slog.String(attr.Key, redacted)
+    }
+    if attr.Value.Kind() == slog.KindAny {
+        attr.Value = slog.AnyValue(Redact(attr.Value.Any()))
+    }
+    return attr
+}
+
+func snakeCase(name string) string {
+    var b strings.Builder
+    for i, r := range name {
+        if 'A' <= r && r <= 'Z' {
+            if i > 0 && !isUpper(name[i-1]) {
+                b.WriteByte('_')
+            }
+            r += 'a' - 'A'
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+func isUpper(c byte) bool {
+    return 'A' <= c && c <= 'Z'
+}
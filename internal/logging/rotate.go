@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+
+// Log file rotated by size: when a write would go over maxSize, app.log is
+// renamed app.log.1, the previous app.log.1 becomes app.log.2 and so on, the
+// oldest beyond maxFiles being removed.
+type RotatingFile struct {
+    path     string
+    maxSize  int64
+    maxFiles int
+    mu       sync.Mutex
+    file     *os.File
+    size     int64
+}
+
+// maxSize <= 0 never rotates, maxFiles is the number of rotated files kept
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return nil, fmt.Errorf("failed to create log directory: %w", err)
+    }
+    rf := &RotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+    if err := rf.open(); err != nil {
+        return nil, err
+    }
+    return rf, nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+    rf.mu.Lock()
+    defer rf.mu.Unlock()
+    if rf.file == nil {
+        return 0, os.ErrClosed
+    }
+    if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+        if err := rf.rotate(); err != nil {
+            return 0, err
+        }
+    }
+    n, err := rf.file.Write(p)
+    rf.size += int64(n)
+    return n, err
+}
+
+func (rf *RotatingFile) Close() error {
+    rf.mu.Lock()
+    defer rf.mu.Unlock()
+    if rf.file == nil {
+        return nil
+    }
+    err := rf.file.Close()
+    rf.file = nil
+    return err
+}
+
+func (rf *RotatingFile) open() error {
+    file, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+    if err != nil {
+        return fmt.Errorf("failed to open log file: %w", err)
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return fmt.Errorf("failed to read log file: %w", err)
+    }
+    rf.file, rf.size = file, info.Size()
+    return nil
+}
+
+func (rf *RotatingFile) rotate() error {
+    if err := rf.file.Close(); err != nil {
+        return fmt.Errorf("failed to close log file: %w", err)
+    }
+    rf.file = nil
+
+    os.Remove(rotatedPath(rf.path, rf.maxFiles))
+    for i := rf.maxFiles - 1; i >= 1; i-- {
+        os.Rename(rotatedPath(rf.path, i), rotatedPath(rf.path, i+1))
+    }
+    if rf.maxFiles > 0 {
+        if err := os.Rename(rf.path, rotatedPath(rf.path, 1)); err != nil {
+            return fmt.Errorf("failed to rotate log file: %w", err)
+        }
+    } else if err := os.Remove(rf.path); err != nil {
+        return fmt.Errorf("failed to rotate log file: %w", err)
+    }
+    return rf.open()
+}
+
+func rotatedPath(path string, i int) string {
+    return fmt.Sprintf("%s.%d", path, i)
+}
@@ -0,0 +1,53 @@
+package ocr
+
+import (
+	"context"
+	"time"
+)
+
+
+// An Engine reads a receipt image and returns what it could find on it.
+// Every field is a candidate for the user to confirm, never trusted as is.
+type Engine interface {
+    Name() string
+    Extract(ctx context.Context, imagePath string) (*Extraction, error)
+}
+
+type Extraction struct {
+    Merchant string     `json:"merchant,omitempty"`
+    Date     *time.Time `json:"date,omitempty"`
+    Total    *float64   `json:"total,omitempty"` // taxes included
+    Currency string     `json:"currency,omitempty"`
+    TaxLines []TaxLine  `json:"tax_lines,omitempty"`
+    RawText  string     `json:"raw_text,omitempty"`
+}
+
+// Same meaning as db.LineItem: Total is taxes included
+type TaxLine struct {
+    TaxeRate float64 `json:"taxe_rate"`
+    Total    float64 `json:"total"`
+    Tax      float64 `json:"tax,omitempty"`
+}
+
+// Engine returning a fixed result, for tests and demos
+type Fake struct {
+    Extraction Extraction
+    Err        error
+    Calls      []string // image paths it was asked to read
+}
+
+func (f *Fake) Name() string {
+    return "fake"
+}
+
+func (f *Fake) Extract(ctx context.Context, imagePath string) (*Extraction, error) {
+    f.Calls = append(f.Calls, imagePath)
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if f.Err != nil {
+        return nil, f.Err
+    }
+    extraction := f.Extraction
+    return &extraction, nil
+}
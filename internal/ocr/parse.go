@@ -0,0 +1,210 @@
+package ocr
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+
+// Heuristics for the text of a European receipt. They only need to be right
+// often enough to save typing, the user confirms every value.
+
+var (
+    amountPattern   = regexp.MustCompile(`(\d{1,3}(?:[ .,']\d{3})+|\d+)[.,](\d{2})\b`)
+    percentPattern  = regexp.MustCompile(`(\d{1,2}(?:[.,]\d{1,2})?)\s?%`)
+    dayFirstPattern = regexp.MustCompile(`\b(\d{1,2})[/.\-](\d{1,2})[/.\-](\d{4}|\d{2})\b`)
+    isoDatePattern  = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+    timePattern     = regexp.MustCompile(`\b\d{1,2}:\d{2}(?::\d{2})?\b`)
+    totalPattern    = regexp.MustCompile(
+        `(?i)\b(total|ttc|montant|amount|summe|gesamt|betrag|a payer|à payer|to pay|balance due)\b`,
+    )
+    // Net amounts and partial sums, not what was paid
+    notTotalPattern = regexp.MustCompile(`(?i)(\bht\b|sub|sous|zwischen|netto|\bnet\b)`)
+)
+
+var currencySymbols = []struct {
+    pattern  *regexp.Regexp
+    currency string
+}{
+    {regexp.MustCompile(`€|\bEUR\b|\bEuros?\b`), "EUR"},
+    {regexp.MustCompile(`£|\bGBP\b`), "GBP"},
+    {regexp.MustCompile(`\bCHF\b`), "CHF"},
+    {regexp.MustCompile(`\$|\bUSD\b`), "USD"},
+}
+
+func ParseText(text string) *Extraction {
+    extraction := &Extraction{RawText: text}
+    lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+    extraction.Merchant = parseMerchant(lines)
+    extraction.Date = parseDate(text)
+    extraction.Currency = parseCurrency(text)
+    extraction.Total = parseTotal(lines)
+    extraction.TaxLines = parseTaxLines(lines)
+    return extraction
+}
+
+// First line that looks like a name rather than an amount or a date
+func parseMerchant(lines []string) string {
+    for _, line := range lines {
+        line = strings.TrimSpace(line)
+        letters := 0
+        for _, r := range line {
+            if unicode.IsLetter(r) {
+                letters++
+            }
+        }
+        if letters >= 3 && letters*2 >= len([]rune(line)) {
+            if runes := []rune(line); len(runes) > 100 {
+                line = string(runes[:100])
+            }
+            return line
+        }
+    }
+    return ""
+}
+
+func parseDate(text string) *time.Time {
+    for _, match := range isoDatePattern.FindAllStringSubmatch(text, -1) {
+        if date, ok := makeDate(match[1], match[2], match[3]); ok {
+            return &date
+        }
+    }
+    for _, match := range dayFirstPattern.FindAllStringSubmatch(text, -1) {
+        year := match[3]
+        if len(year) == 2 {
+            year = "20" + year
+        }
+        if date, ok := makeDate(year, match[2], match[1]); ok {
+            return &date
+        }
+    }
+    return nil
+}
+
+func makeDate(year, month, day string) (time.Time, bool) {
+    y, errY := strconv.Atoi(year)
+    m, errM := strconv.Atoi(month)
+    d, errD := strconv.Atoi(day)
+    if errY != nil || errM != nil || errD != nil || y < 2000 || y > 2100 {
+        return time.Time{}, false
+    }
+    date := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+    // time.Date normalizes 31/02 to March, reject it instead
+    if date.Day() != d || int(date.Month()) != m {
+        return time.Time{}, false
+    }
+    return date, true
+}
+
+// Most mentioned currency
+func parseCurrency(text string) string {
+    currency, best := "", 0
+    for _, symbol := range currencySymbols {
+        if count := len(symbol.pattern.FindAllString(text, -1)); count > best {
+            currency, best = symbol.currency, count
+        }
+    }
+    return currency
+}
+
+// Largest amount on a "total" line, or the largest amount of the receipt
+func parseTotal(lines []string) *float64 {
+    var total, largest float64
+    for _, line := range lines {
+        amounts := parseAmounts(amountsOnly(line))
+        for _, amount := range amounts {
+            largest = math.Max(largest, amount)
+            if totalPattern.MatchString(line) && !notTotalPattern.MatchString(line) {
+                total = math.Max(total, amount)
+            }
+        }
+    }
+    if total == 0 {
+        total = largest
+    }
+    if total == 0 {
+        return nil
+    }
+    return &total
+}
+
+// Rates, dates and times also look like amounts ("12.03.2024", "10,00%")
+func amountsOnly(line string) string {
+    for _, pattern := range []*regexp.Regexp{
+        percentPattern, isoDatePattern, dayFirstPattern, timePattern,
+    } {
+        line = pattern.ReplaceAllString(line, " ")
+    }
+    return line
+}
+
+func parseAmounts(line string) []float64 {
+    var amounts []float64
+    for _, match := range amountPattern.FindAllStringSubmatch(line, -1) {
+        units := strings.NewReplacer(" ", "", ".", "", ",", "", "'", "").Replace(match[1])
+        amount, err := strconv.ParseFloat(units+"."+match[2], 64)
+        if err == nil && amount > 0 {
+            amounts = append(amounts, amount)
+        }
+    }
+    return amounts
+}
+
+// A tax line has a rate and at least one amount: "TVA 10% 25,00 2,50 27,50",
+// "B 20,0% 3,33"... Amounts are matched with the rate to tell the net, tax
+// and total apart.
+func parseTaxLines(lines []string) []TaxLine {
+    var taxLines []TaxLine
+    seen := make(map[float64]bool)
+    for _, line := range lines {
+        match := percentPattern.FindStringSubmatch(line)
+        if match == nil {
+            continue
+        }
+        rate, err := strconv.ParseFloat(strings.Replace(match[1], ",", ".", 1), 64)
+        if err != nil || rate <= 0 || rate > 60 || seen[rate] {
+            continue
+        }
+        amounts := parseAmounts(amountsOnly(line))
+        if taxLine, ok := matchTaxAmounts(rate, amounts); ok {
+            seen[rate] = true
+            taxLines = append(taxLines, taxLine)
+        }
+    }
+    return taxLines
+}
+
+func matchTaxAmounts(rate float64, amounts []float64) (TaxLine, bool) {
+    for _, net := range amounts {
+        for _, tax := range amounts {
+            if closeAmounts(net*rate/100, tax) && net != tax {
+                return TaxLine{rate, round(net + tax), tax}, true
+            }
+        }
+    }
+    for _, tax := range amounts {
+        for _, total := range amounts {
+            if closeAmounts(total*rate/(100+rate), tax) && total != tax {
+                return TaxLine{rate, total, tax}, true
+            }
+        }
+    }
+    if len(amounts) == 1 {
+        tax := amounts[0]
+        return TaxLine{rate, round(tax * (100 + rate) / rate), tax}, true
+    }
+    return TaxLine{}, false
+}
+
+func closeAmounts(a, b float64) bool {
+    return math.Abs(a-b) <= 0.02
+}
+
+func round(value float64) float64 {
+    return math.Round(value*100) / 100
+}
@@ -0,0 +1,50 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Local engine running an installed tesseract binary (https://tesseract-ocr.github.io),
+// nothing leaves the machine.
+type Tesseract struct {
+    Path      string // binary, found in PATH by NewTesseract
+    Languages string // tesseract -l value, like "fra+eng"
+}
+
+const DefaultLanguages = "eng+fra+deu"
+
+func NewTesseract(languages string) (*Tesseract, error) {
+    path, err := exec.LookPath("tesseract")
+    if err != nil {
+        return nil, utils.LogError("tesseract not found, install it to read receipts: %v", err)
+    }
+    if languages == "" {
+        languages = DefaultLanguages
+    }
+    return &Tesseract{Path: path, Languages: languages}, nil
+}
+
+func (t *Tesseract) Name() string {
+    return "tesseract"
+}
+
+func (t *Tesseract) Extract(ctx context.Context, imagePath string) (*Extraction, error) {
+    var stdout, stderr bytes.Buffer
+    // "stdout" as output base makes tesseract print the text instead of writing a file
+    cmd := exec.CommandContext(ctx, t.Path, imagePath, "stdout", "-l", t.Languages)
+    cmd.Stdout = &stdout
+    cmd.Stderr = &stderr
+    if err := cmd.Run(); err != nil {
+        return nil, utils.LogError(
+            "tesseract failed on %v: %v (%v)",
+            imagePath, err, strings.TrimSpace(stderr.String()),
+        )
+    }
+    return ParseText(stdout.String()), nil
+}
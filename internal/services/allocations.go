@@ -0,0 +1,139 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Part of an expense charged to a session, as allocated (percentage or
+// amount) and as computed from the expense total (Share)
+type AllocationShare struct {
+    SessionID  int64    `json:"session_id"`
+    Percentage *float64 `json:"percentage,omitempty"`
+    Amount     *float64 `json:"amount,omitempty"`
+    Share      float64  `json:"share"`
+}
+
+// Split an expense across sessions, replacing its previous allocations and
+// its session. The allocations must add up to the total of its line items.
+func AllocateExpense(database *sql.DB, expenseID int64, allocations db.AllocationList) (
+    []AllocationShare, error,
+) {
+    if len(allocations) == 0 {
+        return nil, utils.ValidationError(
+            []string{"allocations"}, "at least one allocation is expected, see ClearAllocations",
+        )
+    }
+    if _, err := crud.GetExpenseByID(database, expenseID); err != nil {
+        return nil, err
+    }
+    for i := range allocations {
+        allocations[i].ExpenseID = expenseID
+        if _, err := crud.GetSessionByID(database, allocations[i].SessionID); err != nil {
+            return nil, err
+        }
+    }
+    total, err := expenseTotal(database, expenseID)
+    if err != nil {
+        return nil, err
+    }
+    shares, err := allocationShares(allocations, total)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := crud.SetExpenseAllocations(database, expenseID, allocations); err != nil {
+        return nil, err
+    }
+    return shares, nil
+}
+
+// Remove the allocations of an expense and put it back in sessionID, 0 to
+// leave it without session
+func ClearAllocations(database *sql.DB, expenseID int64, sessionID int64) error {
+    expense, err := crud.GetExpenseByID(database, expenseID)
+    if err != nil {
+        return err
+    }
+    if sessionID != 0 {
+        if _, err := crud.GetSessionByID(database, sessionID); err != nil {
+            return err
+        }
+    }
+    if err := crud.SetExpenseAllocations(database, expenseID, nil); err != nil {
+        return err
+    }
+    expense.SessionID = sql.NullInt64{Int64: sessionID, Valid: sessionID != 0}
+    return crud.UpdateExpense(database, *expense)
+}
+
+// Allocations of an expense with each session share, none when the expense
+// is not split. Fails when they no longer add up to its total, after a line
+// item was changed.
+func ExpenseAllocations(database *sql.DB, expenseID int64) ([]AllocationShare, error) {
+    allocations, err := crud.ListAllocationsByExpenseID(database, expenseID)
+    if err != nil || len(allocations) == 0 {
+        return nil, err
+    }
+    lineItems, err := crud.ListLineItemsByExpenseID(database, expenseID)
+    if err != nil {
+        return nil, err
+    }
+    return expenseAllocationShares(expenseID, allocations, lineItems)
+}
+
+// Shares of the allocations of an expense, from its line items already loaded
+func expenseAllocationShares(
+    expenseID int64, allocations db.AllocationList, lineItems db.LineItemList,
+) ([]AllocationShare, error) {
+    shares, err := allocationShares(allocations, lineItemsTotal(lineItems))
+    if err != nil {
+        return nil, fmt.Errorf(
+            "allocations of expense #%d must be fixed (expense allocate): %w", expenseID, err,
+        )
+    }
+    return shares, nil
+}
+
+func allocationShares(allocations db.AllocationList, total float64) ([]AllocationShare, error) {
+    shares, err := allocations.Shares(total)
+    if err != nil {
+        return nil, err
+    }
+    result := make([]AllocationShare, 0, len(allocations))
+    for _, allocation := range allocations {
+        share := AllocationShare{
+            SessionID: allocation.SessionID,
+            Share:     shares[allocation.SessionID],
+        }
+        if allocation.Percentage.Valid {
+            share.Percentage = &allocation.Percentage.Float64
+        }
+        if allocation.Amount.Valid {
+            share.Amount = &allocation.Amount.Float64
+        }
+        result = append(result, share)
+    }
+    return result, nil
+}
+
+func expenseTotal(database *sql.DB, expenseID int64) (float64, error) {
+    lineItems, err := crud.ListLineItemsByExpenseID(database, expenseID)
+    if err != nil {
+        return 0, err
+    }
+    return lineItemsTotal(lineItems), nil
+}
+
+func lineItemsTotal(lineItems db.LineItemList) float64 {
+    var total float64
+    for _, lineItem := range lineItems {
+        total += lineItem.Total
+    }
+    return roundCents(total)
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Dashboard aggregations, computed by SQLite. Amounts are line item totals,
+// taxes included, never converted: every group is per currency. Expenses
+// split across sessions (see ExpenseAllocations) count for the share of each
+// session. Dates are the local ones (db.Expense.LocalDate), through the
+// local_date() SQL function of db.ConnectDB.
+
+// Groupings of SpendBy
+const (
+    SpendByType     = "type"
+    SpendByClient   = "client"
+    SpendByMonth    = "month"
+    SpendByCurrency = "currency"
+)
+
+var spendGroupings = []string{SpendByType, SpendByClient, SpendByMonth, SpendByCurrency}
+
+const DefaultTopMerchants = 10
+
+// Standard keys of the expense types HotelPrices looks at by default
+var hotelTypeKeys = []string{"HOTEL", "LODGING"}
+
+// Local dates (yyyy-mm-dd), both included, no bound when empty
+type AnalyticsRange struct {
+    From string `json:"from,omitempty"`
+    To   string `json:"to,omitempty"`
+}
+
+type SpendAnalytics struct {
+    By     string         `json:"by"`
+    Range  AnalyticsRange `json:"range"`
+    Groups []SpendGroup   `json:"groups"`
+}
+
+// Key is the expense type name, client name ("" without session), month
+// (yyyy-mm) or currency
+type SpendGroup struct {
+    Key      string  `json:"key"`
+    Currency string  `json:"currency"`
+    Total    float64 `json:"total"`
+    Expenses int     `json:"expenses"`
+}
+
+type DistanceAnalytics struct {
+    Range      AnalyticsRange  `json:"range"`
+    DistanceKM float64         `json:"distance_km"`
+    Months     []DistanceMonth `json:"months"`
+}
+
+type DistanceMonth struct {
+    Month      string  `json:"month"` // yyyy-mm
+    DistanceKM float64 `json:"distance_km"`
+    Trips      int     `json:"trips"`
+}
+
+type HotelAnalytics struct {
+    Range  AnalyticsRange `json:"range"`
+    Types  []string       `json:"types,omitempty"`
+    Cities []HotelCity    `json:"cities"`
+}
+
+// City is the location of the sessions, a night is a day covered by the
+// expense (db.Expense.CoveredDays)
+type HotelCity struct {
+    City         string  `json:"city"`
+    Currency     string  `json:"currency"`
+    Stays        int     `json:"stays"`
+    Nights       float64 `json:"nights"`
+    Total        float64 `json:"total"`
+    AverageNight float64 `json:"average_night"`
+}
+
+type MerchantAnalytics struct {
+    Range     AnalyticsRange  `json:"range"`
+    Merchants []MerchantSpend `json:"merchants"`
+}
+
+// Merchants are grouped ignoring case, Merchant is one of the spellings
+type MerchantSpend struct {
+    Merchant string  `json:"merchant"`
+    Currency string  `json:"currency"`
+    Total    float64 `json:"total"`
+    Expenses int     `json:"expenses"`
+}
+
+// Spend of a year against the one before, by month (1 to 12) and in total
+type YearComparison struct {
+    Year   int                `json:"year"`
+    Months []PeriodComparison `json:"months"`
+    Totals []PeriodComparison `json:"totals"`
+}
+
+// ChangePercent is nil when nothing was spent the year before
+type PeriodComparison struct {
+    Month         int      `json:"month,omitempty"`
+    Currency      string   `json:"currency"`
+    Total         float64  `json:"total"`
+    PreviousTotal float64  `json:"previous_total"`
+    ChangePercent *float64 `json:"change_percent,omitempty"`
+}
+
+// Amount charged to each session by an expense of the range: its total, or
+// the allocated share. ratio is the part of the expense it is.
+const chargesQuery = `WITH totals AS (
+        SELECT l.expense_id, SUM(l.total) AS total
+        FROM line_items l JOIN expenses e ON e.id = l.expense_id
+        WHERE %s
+        GROUP BY l.expense_id
+    ), charges AS (
+        SELECT e.id AS expense_id, e.session_id, totals.total AS amount, 1.0 AS ratio
+        FROM expenses e JOIN totals ON totals.expense_id = e.id
+        WHERE NOT EXISTS (SELECT 1 FROM expense_allocations a WHERE a.expense_id = e.id)
+        UNION ALL
+        SELECT
+            a.expense_id, a.session_id,
+            COALESCE(a.amount, a.percentage * totals.total / 100),
+            CASE WHEN totals.total = 0 THEN 0
+                ELSE COALESCE(a.amount, a.percentage * totals.total / 100) / totals.total END
+        FROM expense_allocations a JOIN totals ON totals.expense_id = a.expense_id
+    )`
+
+func (r AnalyticsRange) validate(v *utils.Validator) {
+    for _, bound := range []struct{ field, value string }{{"from", r.From}, {"to", r.To}} {
+        if bound.value != "" {
+            _, err := time.Parse(time.DateOnly, bound.value)
+            v.Format(bound.field, err == nil, "yyyy-mm-dd")
+        }
+    }
+    if r.From != "" && r.To != "" {
+        v.Check(
+            r.From <= r.To, "to", utils.ViolationOrder, map[string]any{"after": "from"},
+            "invalid range: %s to %s", r.From, r.To,
+        )
+    }
+}
+
+// Conditions on the expenses e of the range. Stored timestamps are UTC,
+// the local date is at most a day away: date_time narrows the rows with
+// its index, local_date() keeps the exact ones.
+func (r AnalyticsRange) expenseConditions() (string, []any) {
+    conditions, args := []string{"1 = 1"}, []any{}
+    if r.From != "" {
+        from, _ := time.Parse(time.DateOnly, r.From)
+        conditions = append(
+            conditions, "e.date_time >= ?", "local_date(e.date_time, e.time_zone) >= ?",
+        )
+        args = append(args, db.FormatTimestamp(from.AddDate(0, 0, -1)), r.From)
+    }
+    if r.To != "" {
+        to, _ := time.Parse(time.DateOnly, r.To)
+        conditions = append(
+            conditions, "e.date_time < ?", "local_date(e.date_time, e.time_zone) <= ?",
+        )
+        args = append(args, db.FormatTimestamp(to.AddDate(0, 0, 2)), r.To)
+    }
+    return strings.Join(conditions, " AND "), args
+}
+
+func SpendBy(database *sql.DB, by string, r AnalyticsRange) (*SpendAnalytics, error) {
+    v := utils.Validator{}
+    v.Choice("by", by, spendGroupings)
+    r.validate(&v)
+    if err := v.Err(); err != nil {
+        return nil, err
+    }
+
+    key, order := "", "e.currency, 3 DESC, 1"
+    switch by {
+    case SpendByType:
+        key = "et.name"
+    case SpendByClient:
+        key = "COALESCE(cl.name, '')"
+    case SpendByMonth:
+        key, order = "substr(local_date(e.date_time, e.time_zone), 1, 7)", "1, e.currency"
+    case SpendByCurrency:
+        key = "e.currency"
+    }
+    conditions, args := r.expenseConditions()
+    querry := fmt.Sprintf(chargesQuery, conditions) + `
+        SELECT ` + key + `, e.currency, SUM(c.amount), COUNT(DISTINCT e.id)
+        FROM charges c
+        JOIN expenses e ON e.id = c.expense_id
+        JOIN expense_types et ON et.id = e.type_id
+        LEFT JOIN sessions s ON s.id = c.session_id
+        LEFT JOIN clients cl ON cl.id = s.client_id
+        GROUP BY 1, e.currency
+        ORDER BY ` + order
+    rows, err := database.Query(querry, args...)
+    if err != nil {
+        return nil, utils.LogError("rejected querry: %v, error: %v", querry, err)
+    }
+    defer rows.Close()
+
+    analytics := SpendAnalytics{By: by, Range: r, Groups: make([]SpendGroup, 0)}
+    for rows.Next() {
+        var group SpendGroup
+        if err := rows.Scan(&group.Key, &group.Currency, &group.Total, &group.Expenses); err != nil {
+            return nil, utils.LogError("failed to scan spend group: %v", err)
+        }
+        group.Total = roundCents(group.Total)
+        analytics.Groups = append(analytics.Groups, group)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, utils.LogError("failed to read spend groups: %v", err)
+    }
+    return &analytics, nil
+}
+
+// Car trips are recorded on their local date already
+func DistanceByMonth(database *sql.DB, r AnalyticsRange) (*DistanceAnalytics, error) {
+    v := utils.Validator{}
+    r.validate(&v)
+    if err := v.Err(); err != nil {
+        return nil, err
+    }
+
+    conditions, args := []string{"1 = 1"}, []any{}
+    if r.From != "" {
+        conditions, args = append(conditions, "date_only >= ?"), append(args, r.From)
+    }
+    if r.To != "" {
+        conditions, args = append(conditions, "date_only <= ?"), append(args, r.To)
+    }
+    querry := `SELECT substr(date_only, 1, 7), SUM(distance_km), COUNT(*)
+        FROM car_trips WHERE ` + strings.Join(conditions, " AND ") + `
+        GROUP BY 1 ORDER BY 1`
+    rows, err := database.Query(querry, args...)
+    if err != nil {
+        return nil, utils.LogError("rejected querry: %v, error: %v", querry, err)
+    }
+    defer rows.Close()
+
+    analytics := DistanceAnalytics{Range: r, Months: make([]DistanceMonth, 0)}
+    for rows.Next() {
+        var month DistanceMonth
+        if err := rows.Scan(&month.Month, &month.DistanceKM, &month.Trips); err != nil {
+            return nil, utils.LogError("failed to scan distance month: %v", err)
+        }
+        month.DistanceKM = roundCents(month.DistanceKM)
+        analytics.DistanceKM += month.DistanceKM
+        analytics.Months = append(analytics.Months, month)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, utils.LogError("failed to read distance months: %v", err)
+    }
+    analytics.DistanceKM = roundCents(analytics.DistanceKM)
+    return &analytics, nil
+}
+
+// Average price of a night per session location, most expensive first.
+// Hotel expenses are the ones of the given type names, by default the types
+// of the standard HOTEL and LODGING keys, and the types named "hotel".
+func HotelPrices(database *sql.DB, r AnalyticsRange, typeNames ...string) (*HotelAnalytics, error) {
+    v := utils.Validator{}
+    r.validate(&v)
+    if err := v.Err(); err != nil {
+        return nil, err
+    }
+
+    conditions, args := r.expenseConditions()
+    var typeCondition string
+    var typeArgs []any
+    if len(typeNames) > 0 {
+        typeCondition = "et.name IN (" + placeholders(len(typeNames)) + ")"
+        for _, name := range typeNames {
+            typeArgs = append(typeArgs, name)
+        }
+    } else {
+        typeCondition = "(substr(et.model_ref, instr(et.model_ref, ':') + 1) IN (" +
+            placeholders(len(hotelTypeKeys)) + ") OR et.name = 'hotel' COLLATE NOCASE)"
+        for _, key := range hotelTypeKeys {
+            typeArgs = append(typeArgs, key)
+        }
+    }
+    querry := fmt.Sprintf(chargesQuery, conditions) + `
+        SELECT
+            MIN(s.location), e.currency, COUNT(DISTINCT e.id),
+            SUM(COALESCE(e.covered_days, 1) * c.ratio), SUM(c.amount)
+        FROM charges c
+        JOIN expenses e ON e.id = c.expense_id
+        JOIN expense_types et ON et.id = e.type_id
+        JOIN sessions s ON s.id = c.session_id
+        WHERE ` + typeCondition + `
+        GROUP BY s.location COLLATE NOCASE, e.currency`
+    rows, err := database.Query(querry, append(args, typeArgs...)...)
+    if err != nil {
+        return nil, utils.LogError("rejected querry: %v, error: %v", querry, err)
+    }
+    defer rows.Close()
+
+    analytics := HotelAnalytics{Range: r, Types: typeNames, Cities: make([]HotelCity, 0)}
+    for rows.Next() {
+        var city HotelCity
+        err := rows.Scan(&city.City, &city.Currency, &city.Stays, &city.Nights, &city.Total)
+        if err != nil {
+            return nil, utils.LogError("failed to scan hotel city: %v", err)
+        }
+        if city.Nights > 0 {
+            city.AverageNight = roundCents(city.Total / city.Nights)
+        }
+        city.Nights, city.Total = roundCents(city.Nights), roundCents(city.Total)
+        analytics.Cities = append(analytics.Cities, city)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, utils.LogError("failed to read hotel cities: %v", err)
+    }
+    sort.SliceStable(analytics.Cities, func(i, j int) bool {
+        a, b := analytics.Cities[i], analytics.Cities[j]
+        if a.Currency != b.Currency {
+            return a.Currency < b.Currency
+        }
+        return a.AverageNight > b.AverageNight
+    })
+    return &analytics, nil
+}
+
+// Merchants with the highest totals, per currency
+func TopMerchants(database *sql.DB, r AnalyticsRange, limit int) (*MerchantAnalytics, error) {
+    v := utils.Validator{}
+    r.validate(&v)
+    if err := v.Err(); err != nil {
+        return nil, err
+    }
+    if limit <= 0 {
+        limit = DefaultTopMerchants
+    }
+
+    conditions, args := r.expenseConditions()
+    querry := `SELECT MIN(e.merchant), e.currency, SUM(l.total), COUNT(DISTINCT e.id)
+        FROM expenses e JOIN line_items l ON l.expense_id = e.id
+        WHERE e.merchant IS NOT NULL AND ` + conditions + `
+        GROUP BY e.merchant COLLATE NOCASE, e.currency
+        ORDER BY 3 DESC, 1
+        LIMIT ?`
+    rows, err := database.Query(querry, append(args, limit)...)
+    if err != nil {
+        return nil, utils.LogError("rejected querry: %v, error: %v", querry, err)
+    }
+    defer rows.Close()
+
+    analytics := MerchantAnalytics{Range: r, Merchants: make([]MerchantSpend, 0)}
+    for rows.Next() {
+        var merchant MerchantSpend
+        err := rows.Scan(&merchant.Merchant, &merchant.Currency, &merchant.Total, &merchant.Expenses)
+        if err != nil {
+            return nil, utils.LogError("failed to scan merchant: %v", err)
+        }
+        merchant.Total = roundCents(merchant.Total)
+        analytics.Merchants = append(analytics.Merchants, merchant)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, utils.LogError("failed to read merchants: %v", err)
+    }
+    return &analytics, nil
+}
+
+// Monthly spend of year and of the year before, from SpendBy month
+func YearOverYear(database *sql.DB, year int) (*YearComparison, error) {
+    v := utils.Validator{}
+    v.Range("year", float64(year), 1901, 9999)
+    if err := v.Err(); err != nil {
+        return nil, err
+    }
+    spend, err := SpendBy(database, SpendByMonth, AnalyticsRange{
+        From: fmt.Sprintf("%04d-01-01", year-1),
+        To:   fmt.Sprintf("%04d-12-31", year),
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    type key struct {
+        month    int
+        currency string
+    }
+    months := make(map[key]*PeriodComparison)
+    totals := make(map[string]*PeriodComparison)
+    for _, group := range spend.Groups {
+        var groupYear, month int
+        if _, err := fmt.Sscanf(group.Key, "%d-%d", &groupYear, &month); err != nil {
+            return nil, utils.IntegrityError("invalid month in spend: %q", group.Key)
+        }
+        comparison, ok := months[key{month, group.Currency}]
+        if !ok {
+            comparison = &PeriodComparison{Month: month, Currency: group.Currency}
+            months[key{month, group.Currency}] = comparison
+        }
+        total, ok := totals[group.Currency]
+        if !ok {
+            total = &PeriodComparison{Currency: group.Currency}
+            totals[group.Currency] = total
+        }
+        if groupYear == year {
+            comparison.Total += group.Total
+            total.Total += group.Total
+        } else {
+            comparison.PreviousTotal += group.Total
+            total.PreviousTotal += group.Total
+        }
+    }
+
+    comparison := YearComparison{
+        Year:   year,
+        Months: make([]PeriodComparison, 0, len(months)),
+        Totals: make([]PeriodComparison, 0, len(totals)),
+    }
+    for _, month := range months {
+        comparison.Months = append(comparison.Months, month.withChange())
+    }
+    for _, total := range totals {
+        comparison.Totals = append(comparison.Totals, total.withChange())
+    }
+    sort.Slice(comparison.Months, func(i, j int) bool {
+        a, b := comparison.Months[i], comparison.Months[j]
+        if a.Currency != b.Currency {
+            return a.Currency < b.Currency
+        }
+        return a.Month < b.Month
+    })
+    sort.Slice(comparison.Totals, func(i, j int) bool {
+        return comparison.Totals[i].Currency < comparison.Totals[j].Currency
+    })
+    return &comparison, nil
+}
+
+func (c PeriodComparison) withChange() PeriodComparison {
+    c.Total, c.PreviousTotal = roundCents(c.Total), roundCents(c.PreviousTotal)
+    if c.PreviousTotal != 0 {
+        change := roundCents((c.Total - c.PreviousTotal) / c.PreviousTotal * 100)
+        c.ChangePercent = &change
+    }
+    return c
+}
+
+func placeholders(count int) string {
+    return strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+}
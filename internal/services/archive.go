@@ -0,0 +1,1054 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/logging"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Portable archive used to move every entity (and receipt files) between
+// installs. IDs inside an archive are only references between its own
+// entities, the importer remaps all of them.
+// v2: expense type details (default taxe rates, accounting code...)
+// v3: expense type vat_recoverable
+// v4: expense country
+// v5: several receipts per expense
+// v6: tags and custom fields of expenses and sessions
+// v7: expense allocations across sessions
+// v8: time zones of expenses and sessions
+// v9: days covered by expenses
+// v10: merchants of expenses
+const ArchiveFormatVersion = 10
+
+type Archive struct {
+    FormatVersion int                  `json:"format_version"`
+    ExportedAt    time.Time            `json:"exported_at"`
+    Clients       []ArchiveClient      `json:"clients"`
+    Sessions      []ArchiveSession     `json:"sessions"`
+    CarTrips      []ArchiveCarTrip     `json:"car_trips"`
+    ExpenseTypes  []ArchiveExpenseType `json:"expense_types"`
+    Expenses      []ArchiveExpense     `json:"expenses"`
+    LineItems     []ArchiveLineItem    `json:"line_items"`
+    Receipts      []ArchiveReceipt     `json:"receipts"`
+    Tags          []string             `json:"tags,omitempty"`
+    CustomFields  []ArchiveCustomField `json:"custom_fields,omitempty"`
+    Allocations   []ArchiveAllocation  `json:"allocations,omitempty"`
+}
+
+type ArchiveClient struct {
+    ID   int64  `json:"id"`
+    Name string `json:"name"`
+}
+
+type ArchiveSession struct {
+    ID                int64      `json:"id"`
+    ClientID          int64      `json:"client_id"`
+    Location          string     `json:"location"`
+    TripStartLocation *string    `json:"trip_start_location,omitempty"`
+    TripEndLocation   *string    `json:"trip_end_location,omitempty"`
+    StartAtDateTime   *time.Time `json:"start_at_date_time,omitempty"`
+    EndAtDateTime     *time.Time `json:"end_at_date_time,omitempty"`
+    TimeZone          *string    `json:"time_zone,omitempty"`
+    Attributes
+}
+
+type ArchiveCarTrip struct {
+    ID         int64   `json:"id"`
+    SessionID  *int64  `json:"session_id,omitempty"`
+    DistanceKM float64 `json:"distance_km"`
+    DateOnly   string  `json:"date_only"`
+}
+
+type ArchiveExpenseType struct {
+    ID               int64     `json:"id"`
+    Name             string    `json:"name"`
+    DefaultTaxeRates []float64 `json:"default_taxe_rates,omitempty"`
+    AccountingCode   *string   `json:"accounting_code,omitempty"`
+    Reimbursable     *bool     `json:"reimbursable,omitempty"`    // v1 archives: true
+    VATRecoverable   *bool     `json:"vat_recoverable,omitempty"` // v1, v2 archives: true
+    Description      *string   `json:"description,omitempty"`
+    ModelRef         *string   `json:"model_ref,omitempty"`
+}
+
+type ArchiveExpense struct {
+    ID              int64     `json:"id"`
+    SessionID       *int64    `json:"session_id,omitempty"`
+    TypeID          int64     `json:"type_id"`
+    Currency        string    `json:"currency"`
+    ReceiptRelPath  *string   `json:"receipt_rel_path,omitempty"` // v1 to v4 archives
+    ReceiptRelPaths []string  `json:"receipt_rel_paths,omitempty"`
+    Notes           *string   `json:"notes,omitempty"`
+    DateTime        time.Time `json:"date_time"`
+    Country         *string   `json:"country,omitempty"`
+    TimeZone        *string   `json:"time_zone,omitempty"`
+    CoveredDays     *int64    `json:"covered_days,omitempty"`
+    Merchant        *string   `json:"merchant,omitempty"`
+    Attributes
+}
+
+// Referenced by name in the attributes of sessions and expenses
+type ArchiveCustomField struct {
+    Name      string   `json:"name"`
+    AppliesTo string   `json:"applies_to"`
+    Type      string   `json:"type"`
+    Options   []string `json:"options,omitempty"`
+}
+
+type ArchiveLineItem struct {
+    ID        int64   `json:"id"`
+    ExpenseID int64   `json:"expense_id"`
+    TaxeRate  float64 `json:"taxe_rate"`
+    Total     float64 `json:"total"`
+}
+
+// Either Percentage or Amount
+type ArchiveAllocation struct {
+    ExpenseID  int64    `json:"expense_id"`
+    SessionID  int64    `json:"session_id"`
+    Percentage *float64 `json:"percentage,omitempty"`
+    Amount     *float64 `json:"amount,omitempty"`
+}
+
+// Data is base64 encoded by encoding/json
+type ArchiveReceipt struct {
+    RelPath string `json:"rel_path"`
+    Data    []byte `json:"data"`
+}
+
+// How to handle an imported client or expense type whose name already exists
+type ConflictPolicy int
+
+const (
+    ConflictMerge  ConflictPolicy = iota // reuse the existing row
+    ConflictRename                       // create a new row with a suffixed name
+)
+
+type ImportReport struct {
+    Clients         int
+    Sessions        int
+    CarTrips        int
+    ExpenseTypes    int
+    Expenses        int
+    LineItems       int
+    Receipts        int
+    Tags            int
+    CustomFields    int
+    Allocations     int
+    MergedNames     []string
+    RenamedNames    map[string]string // original name -> imported name
+    SkippedCarTrips []string          // dates already holding a car trip
+    // Imported expenses looking like ones already there, nothing is merged
+    PossibleDuplicates []DuplicateCandidate
+}
+
+func ExportArchive(database *sql.DB, w io.Writer) error {
+    archive, err := BuildArchive(database)
+    if err != nil {
+        return err
+    }
+
+    encoder := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+    if err := encoder.Encode(archive); err != nil {
+        return utils.LogError("failed to encode archive: %v", err)
+    }
+
+    slog.Info("archive exported", "expenses", len(archive.Expenses), "receipts", len(archive.Receipts))
+    return nil
+}
+
+func BuildArchive(database *sql.DB) (*Archive, error) {
+    archive := Archive{
+        FormatVersion: ArchiveFormatVersion,
+        ExportedAt:    time.Now().UTC(),
+    }
+
+    clients, err := crud.ListClients(database)
+    if err != nil {
+        return nil, err
+    }
+    for _, c := range clients {
+        archive.Clients = append(archive.Clients, ArchiveClient{c.ID, c.Name})
+    }
+
+    sessions, err := crud.ListSessions(database)
+    if err != nil {
+        return nil, err
+    }
+    sessionAttributes, err := MapAttributes(database, db.CustomFieldOnSession)
+    if err != nil {
+        return nil, err
+    }
+    for _, s := range sessions {
+        archive.Sessions = append(archive.Sessions, ArchiveSession{
+            ID:                s.ID,
+            ClientID:          s.ClientID,
+            Location:          s.Location,
+            TripStartLocation: fromNullString(s.TripStartLocation),
+            TripEndLocation:   fromNullString(s.TripEndLocation),
+            StartAtDateTime:   fromNullableTime(s.StartAtDateTime),
+            EndAtDateTime:     fromNullableTime(s.EndAtDateTime),
+            TimeZone:          fromNullString(s.TimeZone),
+            Attributes:        sessionAttributes[s.ID],
+        })
+    }
+
+    carTrips, err := crud.ListCarTrips(database)
+    if err != nil {
+        return nil, err
+    }
+    for _, ct := range carTrips {
+        archive.CarTrips = append(archive.CarTrips, ArchiveCarTrip{
+            ID:         ct.ID,
+            SessionID:  fromNullInt64(ct.SessionID),
+            DistanceKM: ct.DistanceKM,
+            DateOnly:   ct.DateOnly,
+        })
+    }
+
+    expenseTypes, err := crud.ListExpenseTypes(database)
+    if err != nil {
+        return nil, err
+    }
+    for _, et := range expenseTypes {
+        reimbursable, vatRecoverable := et.Reimbursable, et.VATRecoverable
+        archive.ExpenseTypes = append(archive.ExpenseTypes, ArchiveExpenseType{
+            ID:               et.ID,
+            Name:             et.Name,
+            DefaultTaxeRates: et.DefaultTaxeRates,
+            AccountingCode:   fromNullString(et.AccountingCode),
+            Reimbursable:     &reimbursable,
+            VATRecoverable:   &vatRecoverable,
+            Description:      fromNullString(et.Description),
+            ModelRef:         fromNullString(et.ModelRef),
+        })
+    }
+
+    receipts, err := crud.ListReceipts(database)
+    if err != nil {
+        return nil, err
+    }
+    receiptsByExpense := make(map[int64]db.ReceiptList)
+    for _, r := range receipts {
+        receiptsByExpense[r.ExpenseID] = append(receiptsByExpense[r.ExpenseID], r)
+    }
+
+    expenses, err := crud.ListExpenses(database)
+    if err != nil {
+        return nil, err
+    }
+    expenseAttributes, err := MapAttributes(database, db.CustomFieldOnExpense)
+    if err != nil {
+        return nil, err
+    }
+    exportedFiles := make(map[string]bool)
+    for _, e := range expenses {
+        archive.Expenses = append(archive.Expenses, ArchiveExpense{
+            ID:              e.ID,
+            SessionID:       fromNullInt64(e.SessionID),
+            TypeID:          e.TypeID,
+            Currency:        e.Currency,
+            ReceiptRelPaths: receiptsByExpense[e.ID].RelPaths(),
+            Notes:           fromNullString(e.Notes),
+            DateTime:        e.DateTime,
+            Country:         fromNullString(e.Country),
+            TimeZone:        fromNullString(e.TimeZone),
+            CoveredDays:     fromNullInt64(e.CoveredDays),
+            Merchant:        fromNullString(e.Merchant),
+            Attributes:      expenseAttributes[e.ID],
+        })
+
+        for _, r := range receiptsByExpense[e.ID] {
+            if exportedFiles[r.RelPath] {
+                continue
+            }
+            data, err := os.ReadFile(filepath.Join(config.ReceiptsDir, r.RelPath))
+            if err != nil {
+                // The expense still references it, but there is nothing to carry
+                slog.Warn("receipt not exported", "expense_id", e.ID, "error", err)
+                continue
+            }
+            exportedFiles[r.RelPath] = true
+            archive.Receipts = append(archive.Receipts, ArchiveReceipt{
+                RelPath: r.RelPath,
+                Data:    data,
+            })
+        }
+    }
+
+    lineItems, err := crud.ListLineItems(database)
+    if err != nil {
+        return nil, err
+    }
+    for _, li := range lineItems {
+        archive.LineItems = append(archive.LineItems, ArchiveLineItem{
+            ID:        li.ID,
+            ExpenseID: li.ExpenseID,
+            TaxeRate:  li.TaxeRate,
+            Total:     li.Total,
+        })
+    }
+
+    tags, err := crud.ListTags(database)
+    if err != nil {
+        return nil, err
+    }
+    for _, t := range tags {
+        archive.Tags = append(archive.Tags, t.Name)
+    }
+    fields, err := crud.ListCustomFields(database, "")
+    if err != nil {
+        return nil, err
+    }
+    for _, f := range fields {
+        archive.CustomFields = append(archive.CustomFields, ArchiveCustomField{
+            Name:      f.Name,
+            AppliesTo: f.AppliesTo,
+            Type:      f.Type,
+            Options:   f.Options,
+        })
+    }
+
+    allocations, err := crud.ListAllocations(database)
+    if err != nil {
+        return nil, err
+    }
+    for _, a := range allocations {
+        archive.Allocations = append(archive.Allocations, ArchiveAllocation{
+            ExpenseID:  a.ExpenseID,
+            SessionID:  a.SessionID,
+            Percentage: fromNullFloat64(a.Percentage),
+            Amount:     fromNullFloat64(a.Amount),
+        })
+    }
+
+    return &archive, nil
+}
+
+func ImportArchive(database *sql.DB, r io.Reader, policy ConflictPolicy) (
+    *ImportReport, error,
+) {
+    var archive Archive
+    decoder := json.NewDecoder(r)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&archive); err != nil {
+        return nil, utils.LogError("failed to decode archive: %v", err)
+    }
+    return ApplyArchive(database, archive, policy)
+}
+
+// Every entity is validated (PreInsertValid and references inside the archive)
+// before anything is written, then written in one transaction: a broken
+// archive leaves the DB untouched, and the receipt files it brought are removed.
+func ApplyArchive(database *sql.DB, archive Archive, policy ConflictPolicy) (
+    *ImportReport, error,
+) {
+    if err := validateArchive(archive); err != nil {
+        return nil, err
+    }
+
+    report := ImportReport{RenamedNames: make(map[string]string)}
+    clientIDs := make(map[int64]int64)
+    sessionIDs := make(map[int64]int64)
+    expenseTypeIDs := make(map[int64]int64)
+    expenseIDs := make(map[int64]int64)
+    receiptPaths := make(map[string]string)
+    var written []string // receipt files new to this install
+
+    err := db.InTx(database, func(tx db.Querier) error {
+        for _, ac := range archive.Clients {
+            existing, err := crud.GetClientByName(tx, ac.Name)
+            if err != nil {
+                return err
+            }
+            if existing != nil && policy == ConflictMerge {
+                clientIDs[ac.ID] = existing.ID
+                report.MergedNames = append(report.MergedNames, ac.Name)
+                continue
+            }
+
+            client := db.Client{Name: ac.Name}
+            if existing != nil {
+                client.Name, err = freeName(ac.Name, 100, func(name string) (bool, error) {
+                    found, err := crud.GetClientByName(tx, name)
+                    return found == nil, err
+                })
+                if err != nil {
+                    return err
+                }
+                report.RenamedNames[ac.Name] = client.Name
+            }
+            id, err := crud.CreateClient(tx, client)
+            if err != nil {
+                return err
+            }
+            clientIDs[ac.ID] = id
+            report.Clients++
+        }
+
+        // Custom fields and tags before the sessions and expenses using them
+        fieldNames := map[string]map[string]string{
+            db.CustomFieldOnExpense: make(map[string]string),
+            db.CustomFieldOnSession: make(map[string]string),
+        }
+        for _, acf := range archive.CustomFields {
+            name, created, err := importCustomField(tx, acf, &report)
+            if err != nil {
+                return err
+            }
+            fieldNames[acf.AppliesTo][strings.ToLower(acf.Name)] = name
+            if created {
+                report.CustomFields++
+            }
+        }
+        for _, name := range archive.Tags {
+            existing, err := crud.GetTagByName(tx, name)
+            if err != nil {
+                return err
+            }
+            if existing != nil {
+                continue
+            }
+            if _, err := crud.CreateTag(tx, db.Tag{Name: name}); err != nil {
+                return err
+            }
+            report.Tags++
+        }
+
+        for _, as := range archive.Sessions {
+            session := as.toSession()
+            session.ID = 0
+            session.ClientID = clientIDs[as.ClientID]
+            id, err := crud.CreateSession(tx, session)
+            if err != nil {
+                return err
+            }
+            sessionIDs[as.ID] = id
+            report.Sessions++
+
+            attributes := renameFields(as.Attributes, fieldNames[db.CustomFieldOnSession])
+            if err := ApplyAttributes(tx, db.CustomFieldOnSession, id, attributes); err != nil {
+                return err
+            }
+        }
+
+        for _, act := range archive.CarTrips {
+            existing, err := crud.GetCarTripByDate(tx, act.DateOnly)
+            if err != nil {
+                return err
+            }
+            if existing != nil {
+                report.SkippedCarTrips = append(report.SkippedCarTrips, act.DateOnly)
+                continue
+            }
+
+            carTrip := act.toCarTrip()
+            carTrip.ID = 0
+            if carTrip.SessionID.Valid {
+                carTrip.SessionID.Int64 = sessionIDs[carTrip.SessionID.Int64]
+            }
+            if _, err := crud.CreateCarTrip(tx, carTrip); err != nil {
+                return err
+            }
+            report.CarTrips++
+        }
+
+        for _, aet := range archive.ExpenseTypes {
+            existing, err := crud.GetExpenseTypeByName(tx, aet.Name)
+            if err != nil {
+                return err
+            }
+            if existing != nil && policy == ConflictMerge {
+                expenseTypeIDs[aet.ID] = existing.ID
+                report.MergedNames = append(report.MergedNames, aet.Name)
+                continue
+            }
+
+            expenseType := aet.expenseType()
+            if existing != nil {
+                expenseType.ModelRef = sql.NullString{} // the existing one keeps it
+                expenseType.Name, err = freeName(aet.Name, 50, func(name string) (bool, error) {
+                    found, err := crud.GetExpenseTypeByName(tx, name)
+                    return found == nil, err
+                })
+                if err != nil {
+                    return err
+                }
+                report.RenamedNames[aet.Name] = expenseType.Name
+            }
+            if expenseType.ModelRef.Valid {
+                linked, err := crud.GetExpenseTypeByModelRef(tx, expenseType.ModelRef.String)
+                if err != nil {
+                    return err
+                }
+                if linked != nil {
+                    expenseType.ModelRef = sql.NullString{} // renamed by the user here
+                }
+            }
+            id, err := crud.CreateExpenseType(tx, expenseType)
+            if err != nil {
+                return err
+            }
+            expenseTypeIDs[aet.ID] = id
+            report.ExpenseTypes++
+        }
+
+        for _, ar := range archive.Receipts {
+            relPath, created, err := storeArchivedReceipt(ar)
+            if err != nil {
+                return err
+            }
+            if created {
+                written = append(written, relPath)
+            }
+            receiptPaths[ar.RelPath] = relPath
+            report.Receipts++
+        }
+
+        for _, ae := range archive.Expenses {
+            expense := ae.toExpense()
+            expense.ID = 0
+            expense.TypeID = expenseTypeIDs[ae.TypeID]
+            if expense.SessionID.Valid {
+                expense.SessionID.Int64 = sessionIDs[expense.SessionID.Int64]
+            }
+            id, err := crud.CreateExpense(tx, expense)
+            if err != nil {
+                return err
+            }
+            expenseIDs[ae.ID] = id
+            report.Expenses++
+
+            attributes := renameFields(ae.Attributes, fieldNames[db.CustomFieldOnExpense])
+            if err := ApplyAttributes(tx, db.CustomFieldOnExpense, id, attributes); err != nil {
+                return err
+            }
+
+            stored := make(map[string]bool)
+            for _, relPath := range ae.receiptRelPaths() {
+                if name, ok := receiptPaths[relPath]; ok {
+                    relPath = name
+                }
+                if stored[relPath] {
+                    continue // same content under two names
+                }
+                stored[relPath] = true
+                receipt := db.Receipt{ExpenseID: id, RelPath: relPath}
+                if _, err := crud.CreateReceipt(tx, receipt); err != nil {
+                    return err
+                }
+            }
+        }
+
+        for _, ali := range archive.LineItems {
+            lineItem := ali.toLineItem()
+            lineItem.ID = 0
+            lineItem.ExpenseID = expenseIDs[ali.ExpenseID]
+            if _, err := crud.CreateLineItem(tx, lineItem); err != nil {
+                return err
+            }
+            report.LineItems++
+        }
+
+        allocations := make(map[int64]db.AllocationList)
+        var allocated []int64 // archive order
+        for _, aa := range archive.Allocations {
+            allocation := aa.toAllocation()
+            allocation.SessionID = sessionIDs[aa.SessionID]
+            id := expenseIDs[aa.ExpenseID]
+            if allocations[id] == nil {
+                allocated = append(allocated, id)
+            }
+            allocations[id] = append(allocations[id], allocation)
+        }
+        for _, id := range allocated {
+            if err := crud.SetExpenseAllocations(tx, id, allocations[id]); err != nil {
+                return err
+            }
+            report.Allocations += len(allocations[id])
+        }
+        return nil
+    })
+    if err != nil {
+        for _, relPath := range written {
+            if err := os.Remove(filepath.Join(config.ReceiptsDir, relPath)); err != nil {
+                slog.Warn("receipt of a failed import left behind", "rel_path", relPath, "error", err)
+            }
+        }
+        return nil, err
+    }
+    for _, relPath := range receiptPaths {
+        // A missing preview only degrades list views
+        if err := db.GenerateReceiptPreviews(relPath); err != nil {
+            slog.Warn("no preview for imported receipt", "rel_path", relPath, "error", err)
+        }
+    }
+
+    importedIDs := make(map[int64]bool)
+    for _, id := range expenseIDs {
+        importedIDs[id] = true
+    }
+    duplicates, err := FindDuplicates(database, DefaultDuplicateThreshold)
+    if err != nil {
+        return nil, err
+    }
+    for _, duplicate := range duplicates {
+        if importedIDs[duplicate.ExpenseID] || importedIDs[duplicate.DuplicateOfID] {
+            report.PossibleDuplicates = append(report.PossibleDuplicates, duplicate)
+        }
+    }
+
+    slog.Info(
+        "archive imported",
+        "expenses", report.Expenses, "receipts", report.Receipts,
+        "possible_duplicates", len(report.PossibleDuplicates),
+    )
+    return &report, nil
+}
+
+func (aet ArchiveExpenseType) expenseType() db.ExpenseType {
+    et := db.ExpenseType{
+        Name:           aet.Name,
+        AccountingCode: toNullString(aet.AccountingCode),
+        Reimbursable:   aet.Reimbursable == nil || *aet.Reimbursable,
+        VATRecoverable: aet.VATRecoverable == nil || *aet.VATRecoverable,
+        Description:    toNullString(aet.Description),
+        ModelRef:       toNullString(aet.ModelRef),
+    }
+    if len(aet.DefaultTaxeRates) > 0 {
+        et.DefaultTaxeRates = db.TaxeRateList(aet.DefaultTaxeRates)
+    }
+    return et
+}
+
+// Field of the validation errors of an archive, checked as a whole
+var archiveFields = []string{"archive"}
+
+func validateArchive(archive Archive) error {
+    if archive.FormatVersion <= 0 || archive.FormatVersion > ArchiveFormatVersion {
+        return utils.ValidationError(
+            archiveFields,
+            "unsupported archive format version: %d (supported: %d)",
+            archive.FormatVersion, ArchiveFormatVersion,
+        )
+    }
+
+    fields := make(map[string]map[string]db.CustomField)
+    for _, acf := range archive.CustomFields {
+        field := acf.customField()
+        if err := field.PreInsertValid(); err != nil {
+            return err
+        }
+        if fields[acf.AppliesTo] == nil {
+            fields[acf.AppliesTo] = make(map[string]db.CustomField)
+        }
+        if _, ok := fields[acf.AppliesTo][strings.ToLower(acf.Name)]; ok {
+            return utils.ValidationError(
+                archiveFields, "archived %s custom field defined twice: %q",
+                acf.AppliesTo, logging.UserValue(acf.Name),
+            )
+        }
+        fields[acf.AppliesTo][strings.ToLower(acf.Name)] = field
+    }
+    for _, name := range archive.Tags {
+        if err := (db.Tag{Name: name}).PreInsertValid(); err != nil {
+            return err
+        }
+    }
+
+    clientIDs := make(map[int64]bool)
+    for _, ac := range archive.Clients {
+        if err := (db.Client{Name: ac.Name}).PreInsertValid(); err != nil {
+            return err
+        }
+        clientIDs[ac.ID] = true
+    }
+
+    sessionIDs := make(map[int64]bool)
+    for _, as := range archive.Sessions {
+        if err := as.toSession().PreInsertValid(); err != nil {
+            return err
+        }
+        if !clientIDs[as.ClientID] {
+            return utils.ValidationError(
+                archiveFields,
+                "archived session (ID: %d) references an unknown client", as.ID,
+            )
+        }
+        if err := validateArchivedAttributes(as.Attributes, fields[db.CustomFieldOnSession]); err != nil {
+            return err
+        }
+        sessionIDs[as.ID] = true
+    }
+
+    for _, act := range archive.CarTrips {
+        carTrip := act.toCarTrip()
+        if err := carTrip.PreInsertValid(); err != nil {
+            return err
+        }
+        if carTrip.SessionID.Valid && !sessionIDs[carTrip.SessionID.Int64] {
+            return utils.ValidationError(
+                archiveFields,
+                "archived car trip (ID: %d) references an unknown session", act.ID,
+            )
+        }
+    }
+
+    expenseTypeIDs := make(map[int64]bool)
+    for _, aet := range archive.ExpenseTypes {
+        if err := aet.expenseType().PreInsertValid(); err != nil {
+            return err
+        }
+        expenseTypeIDs[aet.ID] = true
+    }
+
+    receiptPaths := make(map[string]bool)
+    for _, ar := range archive.Receipts {
+        // Stored under a name made from its extension, see storeArchivedReceipt
+        if ar.RelPath == "" || filepath.Base(ar.RelPath) != ar.RelPath ||
+            !db.IsReceiptName(db.ReceiptName(ar.Data, filepath.Ext(ar.RelPath))) {
+            return utils.ValidationError(
+                archiveFields, "invalid archived receipt path: %q", logging.UserValue(ar.RelPath),
+            )
+        }
+        receiptPaths[ar.RelPath] = true
+    }
+
+    expenseIDs := make(map[int64]bool)
+    allocated := make(map[int64]bool)
+    for _, aa := range archive.Allocations {
+        allocated[aa.ExpenseID] = true
+    }
+    for _, ae := range archive.Expenses {
+        expense := ae.toExpense()
+        if err := expense.PreInsertValid(); err != nil {
+            return err
+        }
+        for _, relPath := range ae.receiptRelPaths() {
+            if err := (db.Receipt{ExpenseID: 1, RelPath: relPath}).PreInsertValid(); err != nil {
+                return err
+            }
+        }
+        if err := validateArchivedAttributes(ae.Attributes, fields[db.CustomFieldOnExpense]); err != nil {
+            return err
+        }
+        switch {
+        case !expenseTypeIDs[ae.TypeID]:
+            return utils.ValidationError(
+                archiveFields,
+                "archived expense (ID: %d) references an unknown expense type",
+                ae.ID,
+            )
+        case expense.SessionID.Valid && !sessionIDs[expense.SessionID.Int64]:
+            return utils.ValidationError(
+                archiveFields,
+                "archived expense (ID: %d) references an unknown session", ae.ID,
+            )
+        case expense.SessionID.Valid && allocated[ae.ID]:
+            return utils.ValidationError(
+                archiveFields,
+                "archived expense (ID: %d) has both a session and allocations", ae.ID,
+            )
+        }
+        expenseIDs[ae.ID] = true
+    }
+
+    totals := make(map[int64]float64)
+    for _, ali := range archive.LineItems {
+        if err := ali.toLineItem().PreInsertValid(); err != nil {
+            return err
+        }
+        if !expenseIDs[ali.ExpenseID] {
+            return utils.ValidationError(
+                archiveFields,
+                "archived line item (ID: %d) references an unknown expense",
+                ali.ID,
+            )
+        }
+        totals[ali.ExpenseID] += ali.Total
+    }
+
+    allocations := make(map[int64]db.AllocationList)
+    for _, aa := range archive.Allocations {
+        allocation := aa.toAllocation()
+        if err := allocation.PreInsertValid(); err != nil {
+            return err
+        }
+        if !expenseIDs[aa.ExpenseID] || !sessionIDs[aa.SessionID] {
+            return utils.ValidationError(
+                archiveFields,
+                "archived allocation (%v) references an unknown expense or session",
+                allocation,
+            )
+        }
+        allocations[aa.ExpenseID] = append(allocations[aa.ExpenseID], allocation)
+    }
+    for expenseID, expenseAllocations := range allocations {
+        if _, err := expenseAllocations.Shares(roundCents(totals[expenseID])); err != nil {
+            return utils.ValidationError(
+                archiveFields,
+                "archived allocations of expense (ID: %d) are invalid: %v", expenseID, err,
+            )
+        }
+    }
+
+    return nil
+}
+
+// Tags must be valid names, custom fields defined in the archive and their
+// values fit the definition
+func validateArchivedAttributes(attributes Attributes, fields map[string]db.CustomField) error {
+    for _, name := range attributes.Tags {
+        if err := (db.Tag{Name: name}).PreInsertValid(); err != nil {
+            return err
+        }
+    }
+    for name, value := range attributes.Fields {
+        field, ok := fields[strings.ToLower(name)]
+        if !ok {
+            return utils.ValidationError(
+                archiveFields, "archived custom field is not defined: %q", logging.UserValue(name),
+            )
+        }
+        if _, err := field.NormalizeValue(value); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Reuse the custom field of the same name when it has the same type, enum
+// options are added to it. A field of another type is imported renamed.
+// Returns the name of the field to use.
+func importCustomField(database db.Querier, acf ArchiveCustomField, report *ImportReport) (
+    string, bool, error,
+) {
+    existing, err := crud.GetCustomFieldByName(database, acf.AppliesTo, acf.Name)
+    if err != nil {
+        return "", false, err
+    }
+    field := acf.customField()
+    if existing != nil && existing.Type == field.Type {
+        missing := false
+        for _, option := range field.Options {
+            if _, err := existing.NormalizeValue(option); err != nil {
+                existing.Options = append(existing.Options, option)
+                missing = true
+            }
+        }
+        if missing {
+            if err := crud.UpdateCustomField(database, *existing); err != nil {
+                return "", false, err
+            }
+        }
+        report.MergedNames = append(report.MergedNames, existing.Name)
+        return existing.Name, false, nil
+    }
+
+    if existing != nil {
+        field.Name, err = freeName(acf.Name, 50, func(name string) (bool, error) {
+            found, err := crud.GetCustomFieldByName(database, acf.AppliesTo, name)
+            return found == nil, err
+        })
+        if err != nil {
+            return "", false, err
+        }
+        report.RenamedNames[acf.Name] = field.Name
+    }
+    if _, err := crud.CreateCustomField(database, field); err != nil {
+        return "", false, err
+    }
+    return field.Name, true, nil
+}
+
+// Field names as imported, see importCustomField
+func renameFields(attributes Attributes, names map[string]string) Attributes {
+    renamed := Attributes{Tags: attributes.Tags, Fields: make(map[string]string)}
+    for name, value := range attributes.Fields {
+        renamed.Fields[names[strings.ToLower(name)]] = value
+    }
+    return renamed
+}
+
+func (acf ArchiveCustomField) customField() db.CustomField {
+    field := db.CustomField{Name: acf.Name, AppliesTo: acf.AppliesTo, Type: acf.Type}
+    if acf.Options != nil {
+        field.Options = db.CustomFieldOptions(acf.Options)
+    }
+    return field
+}
+
+// Find "name (2)", "name (3)"... that is not taken yet, within maxLen runes
+func freeName(name string, maxLen int, isFree func(string) (bool, error)) (
+    string, error,
+) {
+    for i := 2; i < 1000; i++ {
+        suffix := fmt.Sprintf(" (%d)", i)
+        base := []rune(name)
+        if len(base)+len([]rune(suffix)) > maxLen {
+            base = base[:maxLen-len([]rune(suffix))]
+        }
+        candidate := string(base) + suffix
+
+        ok, err := isFree(candidate)
+        if err != nil {
+            return "", err
+        }
+        if ok {
+            return candidate, nil
+        }
+    }
+    return "", utils.LogError("no free name left for: %s", logging.UserValue(name))
+}
+
+// Receipts are stored under their content hash like db.StoreReceipt does, so
+// that sync can send them. created is false when the same file is already
+// there.
+func storeArchivedReceipt(ar ArchiveReceipt) (relPath string, created bool, err error) {
+    if err := os.MkdirAll(config.ReceiptsDir, 0755); err != nil {
+        return "", false, utils.LogError("failed to create receipts directory: %v", err)
+    }
+
+    relPath = db.ReceiptName(ar.Data, filepath.Ext(ar.RelPath))
+    fullPath := filepath.Join(config.ReceiptsDir, relPath)
+    if _, err := os.Stat(fullPath); err == nil {
+        return relPath, false, nil
+    }
+    if err := os.WriteFile(fullPath, ar.Data, 0644); err != nil {
+        return "", false, utils.LogError("failed to write receipt: %v", err)
+    }
+    return relPath, true, nil
+}
+
+func (as ArchiveSession) toSession() db.Session {
+    return db.Session{
+        ID:                as.ID,
+        ClientID:          as.ClientID,
+        Location:          as.Location,
+        TripStartLocation: toNullString(as.TripStartLocation),
+        TripEndLocation:   toNullString(as.TripEndLocation),
+        StartAtDateTime:   toNullableTime(as.StartAtDateTime),
+        EndAtDateTime:     toNullableTime(as.EndAtDateTime),
+        TimeZone:          toNullString(as.TimeZone),
+    }
+}
+
+func (act ArchiveCarTrip) toCarTrip() db.CarTrip {
+    return db.CarTrip{
+        ID:         act.ID,
+        SessionID:  toNullInt64(act.SessionID),
+        DistanceKM: act.DistanceKM,
+        DateOnly:   act.DateOnly,
+    }
+}
+
+func (ae ArchiveExpense) toExpense() db.Expense {
+    return db.Expense{
+        ID:          ae.ID,
+        SessionID:   toNullInt64(ae.SessionID),
+        TypeID:      ae.TypeID,
+        Currency:    ae.Currency,
+        Notes:       toNullString(ae.Notes),
+        DateTime:    ae.DateTime,
+        Country:     toNullString(ae.Country),
+        TimeZone:    toNullString(ae.TimeZone),
+        CoveredDays: toNullInt64(ae.CoveredDays),
+        Merchant:    toNullString(ae.Merchant),
+    }
+}
+
+// Older archives have at most one receipt per expense
+func (ae ArchiveExpense) receiptRelPaths() []string {
+    if ae.ReceiptRelPath != nil && !slices.Contains(ae.ReceiptRelPaths, *ae.ReceiptRelPath) {
+        return append([]string{*ae.ReceiptRelPath}, ae.ReceiptRelPaths...)
+    }
+    return ae.ReceiptRelPaths
+}
+
+func (ali ArchiveLineItem) toLineItem() db.LineItem {
+    return db.LineItem{
+        ID:        ali.ID,
+        ExpenseID: ali.ExpenseID,
+        TaxeRate:  ali.TaxeRate,
+        Total:     ali.Total,
+    }
+}
+
+func (aa ArchiveAllocation) toAllocation() db.Allocation {
+    return db.Allocation{
+        ExpenseID:  aa.ExpenseID,
+        SessionID:  aa.SessionID,
+        Percentage: toNullFloat64(aa.Percentage),
+        Amount:     toNullFloat64(aa.Amount),
+    }
+}
+
+func fromNullString(ns sql.NullString) *string {
+    if !ns.Valid {
+        return nil
+    }
+    return &ns.String
+}
+
+func toNullString(s *string) sql.NullString {
+    if s == nil {
+        return sql.NullString{}
+    }
+    return sql.NullString{String: *s, Valid: true}
+}
+
+func fromNullInt64(ni sql.NullInt64) *int64 {
+    if !ni.Valid {
+        return nil
+    }
+    return &ni.Int64
+}
+
+func toNullInt64(i *int64) sql.NullInt64 {
+    if i == nil {
+        return sql.NullInt64{}
+    }
+    return sql.NullInt64{Int64: *i, Valid: true}
+}
+
+func fromNullFloat64(nf sql.NullFloat64) *float64 {
+    if !nf.Valid {
+        return nil
+    }
+    return &nf.Float64
+}
+
+func toNullFloat64(f *float64) sql.NullFloat64 {
+    if f == nil {
+        return sql.NullFloat64{}
+    }
+    return sql.NullFloat64{Float64: *f, Valid: true}
+}
+
+func fromNullableTime(nt db.NullableTime) *time.Time {
+    if !nt.Valid {
+        return nil
+    }
+    return &nt.Time
+}
+
+func toNullableTime(t *time.Time) db.NullableTime {
+    if t == nil {
+        return db.NullableTime{}
+    }
+    return db.NullableTime{Time: *t, Valid: true}
+}
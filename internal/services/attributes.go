@@ -0,0 +1,212 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/logging"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Tags and custom field values of an expense or a session, by name
+type Attributes struct {
+    Tags   []string          `json:"tags,omitempty"`
+    Fields map[string]string `json:"custom_fields,omitempty"`
+}
+
+func (a Attributes) IsEmpty() bool {
+    return len(a.Tags) == 0 && len(a.Fields) == 0
+}
+
+// Field names sorted, for stable outputs
+func (a Attributes) FieldNames() []string {
+    names := make([]string, 0, len(a.Fields))
+    for name := range a.Fields {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// kind is db.CustomFieldOnExpense or db.CustomFieldOnSession
+func GetAttributes(database db.Querier, kind string, entityID int64) (Attributes, error) {
+    if err := checkKind(kind); err != nil {
+        return Attributes{}, err
+    }
+    var tags []db.Tag
+    var err error
+    if kind == db.CustomFieldOnExpense {
+        tags, err = crud.ListTagsByExpenseID(database, entityID)
+    } else {
+        tags, err = crud.ListTagsBySessionID(database, entityID)
+    }
+    if err != nil {
+        return Attributes{}, err
+    }
+    fields, err := crud.GetCustomFieldValues(database, kind, entityID)
+    if err != nil {
+        return Attributes{}, err
+    }
+
+    attributes := Attributes{Tags: make([]string, 0, len(tags)), Fields: fields}
+    for _, tag := range tags {
+        attributes.Tags = append(attributes.Tags, tag.Name)
+    }
+    return attributes, nil
+}
+
+// Attributes of every expense or session, by ID
+func MapAttributes(database db.Querier, kind string) (map[int64]Attributes, error) {
+    if err := checkKind(kind); err != nil {
+        return nil, err
+    }
+    var tags map[int64][]string
+    var err error
+    if kind == db.CustomFieldOnExpense {
+        tags, err = crud.MapExpenseTagNames(database)
+    } else {
+        tags, err = crud.MapSessionTagNames(database)
+    }
+    if err != nil {
+        return nil, err
+    }
+    fields, err := crud.MapCustomFieldValues(database, kind)
+    if err != nil {
+        return nil, err
+    }
+
+    attributes := make(map[int64]Attributes)
+    for id, names := range tags {
+        attributes[id] = Attributes{Tags: names, Fields: fields[id]}
+    }
+    for id, values := range fields {
+        if _, ok := attributes[id]; !ok {
+            attributes[id] = Attributes{Fields: values}
+        }
+    }
+    return attributes, nil
+}
+
+// Check tag names, and field names and values against the custom fields of
+// kind, values normalized. An empty value is only accepted when allowUnset.
+func ResolveAttributes(
+    database db.Querier, kind string, attributes Attributes, allowUnset bool,
+) (crud.AttributeFilter, error) {
+    if err := checkKind(kind); err != nil {
+        return crud.AttributeFilter{}, err
+    }
+    filter := crud.AttributeFilter{Fields: make(map[int64]string)}
+    for _, name := range attributes.Tags {
+        if err := (db.Tag{Name: name}).PreInsertValid(); err != nil {
+            return crud.AttributeFilter{}, err
+        }
+        filter.Tags = append(filter.Tags, name)
+    }
+
+    for _, name := range attributes.FieldNames() {
+        field, err := crud.GetCustomFieldByName(database, kind, name)
+        if err != nil {
+            return crud.AttributeFilter{}, err
+        }
+        if field == nil {
+            return crud.AttributeFilter{}, utils.NotFoundError(
+                "unknown %s custom field: %q", kind, logging.UserValue(name),
+            )
+        }
+        value := attributes.Fields[name]
+        if value == "" && allowUnset {
+            filter.Fields[field.ID] = ""
+            continue
+        }
+        if filter.Fields[field.ID], err = field.NormalizeValue(value); err != nil {
+            return crud.AttributeFilter{}, err
+        }
+    }
+    return filter, nil
+}
+
+// Add the tags (created when new) and set the field values of an expense or
+// session, an empty value unsets the field. Everything is checked first.
+func ApplyAttributes(
+    database db.Querier, kind string, entityID int64, attributes Attributes,
+) error {
+    resolved, err := ResolveAttributes(database, kind, attributes, true)
+    if err != nil {
+        return err
+    }
+
+    for _, name := range resolved.Tags {
+        tag, err := crud.GetOrCreateTag(database, name)
+        if err != nil {
+            return err
+        }
+        if kind == db.CustomFieldOnExpense {
+            err = crud.AddExpenseTag(database, entityID, tag.ID)
+        } else {
+            err = crud.AddSessionTag(database, entityID, tag.ID)
+        }
+        if err != nil {
+            return err
+        }
+    }
+
+    current, err := crud.GetCustomFieldValues(database, kind, entityID)
+    if err != nil {
+        return err
+    }
+    for _, name := range attributes.FieldNames() {
+        field, err := crud.GetCustomFieldByName(database, kind, name)
+        if err != nil {
+            return err
+        }
+        value := resolved.Fields[field.ID]
+        if value == "" {
+            if _, ok := current[field.Name]; ok {
+                if err := crud.DeleteCustomFieldValue(database, field.ID, entityID); err != nil {
+                    return err
+                }
+            }
+            continue
+        }
+        if _, err := crud.SetCustomFieldValue(database, *field, entityID, value); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Remove tags from an expense or session, the tags themselves are kept
+func RemoveTags(database db.Querier, kind string, entityID int64, names []string) error {
+    if err := checkKind(kind); err != nil {
+        return err
+    }
+    for _, name := range names {
+        tag, err := crud.GetTagByName(database, name)
+        if err != nil {
+            return err
+        }
+        if tag == nil {
+            return utils.NotFoundError("unknown tag: %q", logging.UserValue(name))
+        }
+        if kind == db.CustomFieldOnExpense {
+            err = crud.RemoveExpenseTag(database, entityID, tag.ID)
+        } else {
+            err = crud.RemoveSessionTag(database, entityID, tag.ID)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func checkKind(kind string) error {
+    if kind != db.CustomFieldOnExpense && kind != db.CustomFieldOnSession {
+        return utils.ValidationError(
+            []string{"kind"}, "attributes are only for expenses and sessions, got: %q", kind,
+        )
+    }
+    return nil
+}
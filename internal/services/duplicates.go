@@ -0,0 +1,449 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// The same lunch logged twice (card statement import and receipt typed by
+// hand) shows up as two expenses in the same currency, a few days apart at
+// most. Each matching signal adds to the score, capped to 1.
+const DefaultDuplicateThreshold = 0.6
+
+const (
+    duplicateMaxDays = 3 // card payments are booked up to a few days later
+
+    scoreSameDay      = 0.25
+    scoreOneDayApart  = 0.15
+    scoreFewDaysApart = 0.05
+    scoreSameTotal    = 0.35
+    scoreCloseTotal   = 0.2 // within 1%, rounding or a tip
+    scoreSameCurrency = 0.1
+    scoreSameType     = 0.15
+    scoreSameReceipt  = 0.5
+)
+
+// ExpenseID is the most recent expense, likely the one to merge into
+// DuplicateOfID
+type DuplicateCandidate struct {
+    ExpenseID     int64    `json:"expense_id"`
+    DuplicateOfID int64    `json:"duplicate_of_id"`
+    Score         float64  `json:"score"`
+    Reasons       []string `json:"reasons"`
+}
+
+type MergeReport struct {
+    KeptID           int64    `json:"kept_id"`
+    DroppedID        int64    `json:"dropped_id"`
+    LineItemsMoved   int      `json:"line_items_moved"`
+    LineItemsSkipped int      `json:"line_items_skipped"` // same rate and total on both
+    ReceiptsMoved    int      `json:"receipts_moved"`
+    Total            float64  `json:"total"`
+    Warnings         []string `json:"warnings"`
+}
+
+type duplicateFacts struct {
+    expense       db.Expense
+    total         float64
+    receiptHashes map[string]bool
+}
+
+// Candidates for one expense, best score first
+func FindDuplicatesOf(database *sql.DB, expenseID int64, threshold float64) (
+    []DuplicateCandidate, error,
+) {
+    facts, err := loadDuplicateFacts(database)
+    if err != nil {
+        return nil, err
+    }
+    var target *duplicateFacts
+    for i := range facts {
+        if facts[i].expense.ID == expenseID {
+            target = &facts[i]
+        }
+    }
+    if target == nil {
+        return nil, utils.NotFoundError("expense not found (ID: %d)", expenseID)
+    }
+
+    candidates := make([]DuplicateCandidate, 0)
+    for _, other := range facts {
+        if other.expense.ID == expenseID {
+            continue
+        }
+        if candidate, ok := scoreDuplicate(*target, other, threshold); ok {
+            candidates = append(candidates, candidate)
+        }
+    }
+    sortDuplicates(candidates)
+    return candidates, nil
+}
+
+// Every pair of candidates, best score first
+func FindDuplicates(database *sql.DB, threshold float64) ([]DuplicateCandidate, error) {
+    facts, err := loadDuplicateFacts(database)
+    if err != nil {
+        return nil, err
+    }
+    sort.Slice(facts, func(i, j int) bool {
+        dateI, dateJ := facts[i].expense.LocalDate(), facts[j].expense.LocalDate()
+        if dateI != dateJ {
+            return dateI < dateJ
+        }
+        return facts[i].expense.DateTime.Before(facts[j].expense.DateTime)
+    })
+
+    candidates := make([]DuplicateCandidate, 0)
+    for i := range facts {
+        for j := i + 1; j < len(facts); j++ {
+            if dayDistance(facts[i].expense, facts[j].expense) > duplicateMaxDays {
+                break // sorted by date, the next ones are even further
+            }
+            if candidate, ok := scoreDuplicate(facts[i], facts[j], threshold); ok {
+                candidates = append(candidates, candidate)
+            }
+        }
+    }
+    sortDuplicates(candidates)
+    return candidates, nil
+}
+
+func scoreDuplicate(a, b duplicateFacts, threshold float64) (DuplicateCandidate, bool) {
+    if a.expense.Currency != b.expense.Currency {
+        return DuplicateCandidate{}, false // totals can't be compared
+    }
+    days := dayDistance(a.expense, b.expense)
+    if days > duplicateMaxDays {
+        return DuplicateCandidate{}, false
+    }
+
+    score, reasons := scoreSameCurrency, []string{"same currency"}
+    switch {
+    case days == 0:
+        score += scoreSameDay
+        reasons = append(reasons, "same day")
+    case days == 1:
+        score += scoreOneDayApart
+        reasons = append(reasons, "1 day apart")
+    default:
+        score += scoreFewDaysApart
+        reasons = append(reasons, fmt.Sprintf("%d days apart", days))
+    }
+
+    difference := math.Abs(a.total - b.total)
+    switch {
+    case difference < 0.005:
+        score += scoreSameTotal
+        reasons = append(reasons, "same total")
+    case difference <= 0.01*math.Max(a.total, b.total):
+        score += scoreCloseTotal
+        reasons = append(reasons, "close total")
+    }
+    if a.expense.TypeID == b.expense.TypeID {
+        score += scoreSameType
+        reasons = append(reasons, "same type")
+    }
+    for hash := range a.receiptHashes {
+        if b.receiptHashes[hash] {
+            score += scoreSameReceipt
+            reasons = append(reasons, "same receipt")
+            break
+        }
+    }
+
+    score = math.Min(1, math.Round(score*100)/100)
+    if score < threshold {
+        return DuplicateCandidate{}, false
+    }
+    newer, older := a.expense, b.expense
+    if newer.DateTime.Before(older.DateTime) ||
+        (newer.DateTime.Equal(older.DateTime) && newer.ID < older.ID) {
+        newer, older = older, newer
+    }
+    return DuplicateCandidate{
+        ExpenseID:     newer.ID,
+        DuplicateOfID: older.ID,
+        Score:         score,
+        Reasons:       reasons,
+    }, true
+}
+
+// Calendar days between two expenses, each on its local date: receipts of
+// the same dinner have the same date wherever it was
+func dayDistance(a, b db.Expense) int {
+    dayA, _ := time.Parse(time.DateOnly, a.LocalDate())
+    dayB, _ := time.Parse(time.DateOnly, b.LocalDate())
+    return int(math.Abs(dayA.Sub(dayB).Hours()) / 24)
+}
+
+func sortDuplicates(candidates []DuplicateCandidate) {
+    sort.SliceStable(candidates, func(i, j int) bool {
+        if candidates[i].Score != candidates[j].Score {
+            return candidates[i].Score > candidates[j].Score
+        }
+        return candidates[i].ExpenseID < candidates[j].ExpenseID
+    })
+}
+
+func loadDuplicateFacts(database *sql.DB) ([]duplicateFacts, error) {
+    expenses, err := crud.ListExpenses(database)
+    if err != nil {
+        return nil, err
+    }
+    lineItems, err := crud.ListLineItems(database)
+    if err != nil {
+        return nil, err
+    }
+    receipts, err := crud.ListReceipts(database)
+    if err != nil {
+        return nil, err
+    }
+
+    totals := make(map[int64]float64)
+    for _, lineItem := range lineItems {
+        totals[lineItem.ExpenseID] += lineItem.Total
+    }
+    // Stored receipts are named after their content, but archives and older
+    // installs may use other names: the content is what counts
+    hashes := make(map[string]string)
+    receiptHashes := make(map[int64]map[string]bool)
+    for _, receipt := range receipts {
+        hash, ok := hashes[receipt.RelPath]
+        if !ok {
+            hash = receiptFileHash(receipt.RelPath)
+            hashes[receipt.RelPath] = hash
+        }
+        if hash == "" {
+            continue
+        }
+        if receiptHashes[receipt.ExpenseID] == nil {
+            receiptHashes[receipt.ExpenseID] = make(map[string]bool)
+        }
+        receiptHashes[receipt.ExpenseID][hash] = true
+    }
+
+    facts := make([]duplicateFacts, 0, len(expenses))
+    for _, expense := range expenses {
+        facts = append(facts, duplicateFacts{
+            expense:       expense,
+            total:         totals[expense.ID],
+            receiptHashes: receiptHashes[expense.ID],
+        })
+    }
+    return facts, nil
+}
+
+// Empty when the file can't be read, a missing receipt matches nothing
+func receiptFileHash(relPath string) string {
+    data, err := os.ReadFile(filepath.Join(config.ReceiptsDir, relPath))
+    if err != nil {
+        return ""
+    }
+    hash := sha256.Sum256(data)
+    return hex.EncodeToString(hash[:])
+}
+
+// Move the line items, receipts and tags of dropID to keepID, then delete dropID.
+// A line item with the same rate and total on both sides is the same
+// purchase and kept once, so is a receipt file. Notes, session, country and
+// custom field values of dropID fill the ones keepID doesn't have.
+func MergeExpenses(database db.Querier, keepID int64, dropID int64) (*MergeReport, error) {
+    var report *MergeReport
+    err := db.InTx(database, func(tx db.Querier) error {
+        var err error
+        report, err = mergeExpenses(tx, keepID, dropID)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    slog.Info("expense merged", "id", dropID, "into_id", keepID)
+    return report, nil
+}
+
+// Whole merge on tx: a failing step leaves both expenses as they were
+func mergeExpenses(tx db.Querier, keepID int64, dropID int64) (*MergeReport, error) {
+    if keepID == dropID {
+        return nil, utils.ValidationError([]string{"id"}, "can't merge expense (ID: %d) with itself", keepID)
+    }
+    keep, err := crud.GetExpenseByID(tx, keepID)
+    if err != nil {
+        return nil, err
+    }
+    drop, err := crud.GetExpenseByID(tx, dropID)
+    if err != nil {
+        return nil, err
+    }
+    if keep.Currency != drop.Currency {
+        return nil, utils.ValidationError(
+            []string{"currency"},
+            "can't merge expenses in different currencies: %s and %s",
+            keep.Currency, drop.Currency,
+        )
+    }
+
+    keepLineItems, err := crud.ListLineItemsByExpenseID(tx, keepID)
+    if err != nil {
+        return nil, err
+    }
+    dropLineItems, err := crud.ListLineItemsByExpenseID(tx, dropID)
+    if err != nil {
+        return nil, err
+    }
+    keepReceipts, err := crud.ListReceiptsByExpenseID(tx, keepID)
+    if err != nil {
+        return nil, err
+    }
+    dropReceipts, err := crud.ListReceiptsByExpenseID(tx, dropID)
+    if err != nil {
+        return nil, err
+    }
+
+    report := MergeReport{KeptID: keepID, DroppedID: dropID, Warnings: make([]string, 0)}
+    var keepTotal, dropTotal float64
+    matched := make([]bool, len(keepLineItems))
+    for _, lineItem := range keepLineItems {
+        keepTotal += lineItem.Total
+    }
+    for _, lineItem := range dropLineItems {
+        dropTotal += lineItem.Total
+        if i := sameLineItem(keepLineItems, matched, lineItem); i >= 0 {
+            matched[i] = true
+            if err := crud.DeleteLineItemByID(tx, lineItem.ID); err != nil {
+                return nil, err
+            }
+            report.LineItemsSkipped++
+            continue
+        }
+        lineItem.ExpenseID = keepID
+        if err := crud.UpdateLineItem(tx, lineItem); err != nil {
+            return nil, err
+        }
+        report.LineItemsMoved++
+    }
+
+    position := 0
+    for _, receipt := range keepReceipts {
+        position = max(position, receipt.Position+1)
+    }
+    keepRelPaths := keepReceipts.RelPaths()
+    for _, receipt := range dropReceipts {
+        if slices.Contains(keepRelPaths, receipt.RelPath) {
+            if err := crud.DeleteReceiptByID(tx, receipt.ID); err != nil {
+                return nil, err
+            }
+            continue
+        }
+        receipt.ExpenseID, receipt.Position = keepID, position
+        if err := crud.UpdateReceipt(tx, receipt); err != nil {
+            return nil, err
+        }
+        position++
+        report.ReceiptsMoved++
+    }
+
+    keepAllocations, err := crud.ListAllocationsByExpenseID(tx, keepID)
+    if err != nil {
+        return nil, err
+    }
+
+    merged := *keep
+    if !merged.Notes.Valid {
+        merged.Notes = drop.Notes
+    }
+    if !merged.SessionID.Valid && len(keepAllocations) == 0 {
+        merged.SessionID = drop.SessionID
+    }
+    if !merged.Country.Valid {
+        merged.Country = drop.Country
+    }
+    if !merged.Merchant.Valid {
+        merged.Merchant = drop.Merchant
+    }
+    if merged != *keep {
+        if err := crud.UpdateExpense(tx, merged); err != nil {
+            return nil, err
+        }
+    }
+    // Tags of both, the values of keepID win over the ones of dropID
+    keepAttributes, err := GetAttributes(tx, db.CustomFieldOnExpense, keepID)
+    if err != nil {
+        return nil, err
+    }
+    dropAttributes, err := GetAttributes(tx, db.CustomFieldOnExpense, dropID)
+    if err != nil {
+        return nil, err
+    }
+    moved := Attributes{Tags: dropAttributes.Tags, Fields: make(map[string]string)}
+    for _, name := range dropAttributes.FieldNames() {
+        kept, ok := keepAttributes.Fields[name]
+        switch {
+        case !ok:
+            moved.Fields[name] = dropAttributes.Fields[name]
+        case kept != dropAttributes.Fields[name]:
+            report.warn(
+                "custom field %s: kept %q, dropped %q", name, kept, dropAttributes.Fields[name],
+            )
+        }
+    }
+    if err := ApplyAttributes(tx, db.CustomFieldOnExpense, keepID, moved); err != nil {
+        return nil, err
+    }
+
+    if err := crud.DeleteExpenseByID(tx, dropID); err != nil {
+        return nil, err
+    }
+
+    report.Total = roundCents(keepTotal + dropTotal - sumSkipped(keepLineItems, matched))
+    if math.Abs(report.Total-keepTotal) >= 0.005 && math.Abs(report.Total-dropTotal) >= 0.005 {
+        report.warn(
+            "merged total %.2f differs from both expenses (%.2f and %.2f), check the line items",
+            report.Total, keepTotal, dropTotal,
+        )
+    }
+    if _, err := keepAllocations.Shares(report.Total); err != nil {
+        report.warn("allocations of expense #%d no longer add up to its total: %v", keepID, err)
+    }
+    return &report, nil
+}
+
+func (r *MergeReport) warn(format string, args ...any) {
+    r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Index of an unmatched line item with the same rate and total, -1 if none
+func sameLineItem(lineItems db.LineItemList, matched []bool, lineItem db.LineItem) int {
+    for i, candidate := range lineItems {
+        if !matched[i] && candidate.TaxeRate == lineItem.TaxeRate &&
+            math.Abs(candidate.Total-lineItem.Total) < 0.005 {
+            return i
+        }
+    }
+    return -1
+}
+
+func sumSkipped(lineItems db.LineItemList, matched []bool) float64 {
+    var total float64
+    for i, lineItem := range lineItems {
+        if matched[i] {
+            total += lineItem.Total
+        }
+    }
+    return total
+}
+
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Minimal PDF writer: A4 pages of plain text lines with the standard
+// Courier font, enough for reports without pulling a PDF dependency.
+const (
+    pdfLinesPerPage = 64
+    pdfFontSize     = 10
+    pdfLeading      = 12
+    pdfMarginLeft   = 40
+    pdfMarginTop    = 800
+)
+
+func writeSimplePDF(w io.Writer, lines []string) error {
+    var pages [][]string
+    for len(lines) > pdfLinesPerPage {
+        pages = append(pages, lines[:pdfLinesPerPage])
+        lines = lines[pdfLinesPerPage:]
+    }
+    pages = append(pages, lines)
+
+    // Objects: 1 catalog, 2 pages tree, 3 font, then a page and its content
+    // stream for each page
+    var objects [][]byte
+    objects = append(objects, []byte("<< /Type /Catalog /Pages 2 0 R >>"))
+
+    kids := ""
+    for i := range pages {
+        kids += fmt.Sprintf("%d 0 R ", 4+2*i)
+    }
+    objects = append(objects, []byte(fmt.Sprintf(
+        "<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(pages),
+    )))
+    objects = append(objects, []byte(
+        "<< /Type /Font /Subtype /Type1 /BaseFont /Courier " +
+        "/Encoding /WinAnsiEncoding >>",
+    ))
+
+    for i, pageLines := range pages {
+        objects = append(objects, []byte(fmt.Sprintf(
+            "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] " +
+            "/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+            5+2*i,
+        )))
+
+        var content bytes.Buffer
+        fmt.Fprintf(
+            &content, "BT /F1 %d Tf %d TL %d %d Td\n",
+            pdfFontSize, pdfLeading, pdfMarginLeft, pdfMarginTop,
+        )
+        for _, line := range pageLines {
+            content.WriteString("(")
+            content.Write(pdfEscape(line))
+            content.WriteString(") Tj T*\n")
+        }
+        content.WriteString("ET")
+        objects = append(objects, []byte(fmt.Sprintf(
+            "<< /Length %d >>\nstream\n%s\nendstream",
+            content.Len(), content.Bytes(),
+        )))
+    }
+
+    var out bytes.Buffer
+    out.WriteString("%PDF-1.4\n")
+    offsets := make([]int, len(objects))
+    for i, object := range objects {
+        offsets[i] = out.Len()
+        fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+    }
+    xref := out.Len()
+    fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+    for _, offset := range offsets {
+        fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+    }
+    fmt.Fprintf(
+        &out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+        len(objects)+1, xref,
+    )
+
+    if _, err := w.Write(out.Bytes()); err != nil {
+        return utils.LogError("failed to write pdf report: %v", err)
+    }
+    return nil
+}
+
+// Latin-1 subset of WinAnsiEncoding, anything else is replaced by "?"
+func pdfEscape(line string) []byte {
+    var escaped []byte
+    for _, r := range line {
+        switch {
+        case r == '(' || r == ')' || r == '\\':
+            escaped = append(escaped, '\\', byte(r))
+        case r == '\t':
+            escaped = append(escaped, ' ')
+        case r >= 0x20 && r < 0x7f || r >= 0xa0 && r <= 0xff:
+            escaped = append(escaped, byte(r))
+        default:
+            escaped = append(escaped, '?')
+        }
+    }
+    return escaped
+}
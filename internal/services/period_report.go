@@ -0,0 +1,548 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Periods of BuildPeriodReport, see PeriodRange
+const (
+    PeriodWeek    = "week"
+    PeriodMonth   = "month"
+    PeriodQuarter = "quarter"
+    PeriodCustom  = "custom"
+)
+
+var periods = []string{PeriodWeek, PeriodMonth, PeriodQuarter, PeriodCustom}
+
+// Expenses and car trips of a period, by session. Sessions crossing its
+// bounds are sliced: only their days, expenses and car trips inside the
+// period are in it, the rest goes to the previous or next one. An expense
+// covering several days (db.Expense.CoveredDays) counts for its days inside
+// the period, an expense split across sessions for the share of each one.
+type PeriodReport struct {
+    Period      string          `json:"period"`
+    From        time.Time       `json:"from"`
+    To          time.Time       `json:"to"` // exclusive
+    DistanceKM  float64         `json:"distance_km"`
+    Sessions    []PeriodSession `json:"sessions"`
+    Totals      []ReportTotal   `json:"totals"`
+    GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// Part of a session inside the period, SessionID 0 gathers the expenses and
+// car trips without session
+type PeriodSession struct {
+    SessionID  int64      `json:"session_id"`
+    Client     string     `json:"client,omitempty"`
+    Session    string     `json:"session,omitempty"`
+    StartAt    *time.Time `json:"start_at,omitempty"`
+    EndAt      *time.Time `json:"end_at,omitempty"`
+    // Days of the session inside the period, out of all its days (0 while
+    // it's running). Sliced when some of them are outside.
+    Days       int             `json:"days"`
+    TotalDays  int             `json:"total_days,omitempty"`
+    Sliced     bool            `json:"sliced"`
+    DistanceKM float64         `json:"distance_km"`
+    Expenses   []ReportExpense `json:"expenses"`
+    Totals     []ReportTotal   `json:"totals"`
+}
+
+// First day of the period holding day, and the first day after it. Weeks
+// start on weekStart (config.WeekStart), quarters in January, April, July
+// and October.
+func PeriodRange(period string, day time.Time, weekStart time.Weekday) (time.Time, time.Time, error) {
+    day = localDay(day)
+    switch period {
+    case PeriodWeek:
+        from := day.AddDate(0, 0, -((int(day.Weekday())-int(weekStart)+7)%7))
+        return from, from.AddDate(0, 0, 7), nil
+    case PeriodMonth:
+        from := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+        return from, from.AddDate(0, 1, 0), nil
+    case PeriodQuarter:
+        from := time.Date(day.Year(), day.Month()-(day.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+        return from, from.AddDate(0, 3, 0), nil
+    default:
+        v := utils.Validator{}
+        v.Choice("period", period, periods[:3])
+        return time.Time{}, time.Time{}, v.Err()
+    }
+}
+
+// Days in [from, to), on local dates (see db.Expense.LocalDate)
+func BuildPeriodReport(database *sql.DB, period string, from time.Time, to time.Time) (
+    *PeriodReport, error,
+) {
+    v := utils.Validator{}
+    v.Choice("period", period, periods)
+    from, to = localDay(from), localDay(to)
+    v.Check(
+        from.Before(to), "to", utils.ViolationOrder, map[string]any{"after": "from"},
+        "invalid period: %s to %s", from.Format(time.DateOnly), to.Format(time.DateOnly),
+    )
+    if err := v.Err(); err != nil {
+        return nil, err
+    }
+
+    builder := periodBuilder{
+        database: database,
+        from:     from,
+        to:       to,
+        groups:   make(map[int64]*PeriodSession),
+        types:    make(map[int64]reportType),
+    }
+    if err := builder.addSessions(); err != nil {
+        return nil, err
+    }
+    if err := builder.addCarTrips(); err != nil {
+        return nil, err
+    }
+    if err := builder.addExpenses(); err != nil {
+        return nil, err
+    }
+
+    report := PeriodReport{
+        Period:      period,
+        From:        from,
+        To:          to,
+        Sessions:    make([]PeriodSession, 0, len(builder.groups)),
+        GeneratedAt: time.Now().UTC(),
+    }
+    var totals []ReportTotal
+    for _, group := range builder.groups {
+        sort.Slice(group.Expenses, func(i, j int) bool {
+            return group.Expenses[i].DateTime.Before(group.Expenses[j].DateTime)
+        })
+        group.Totals = sumTotals(group.Totals)
+        group.DistanceKM = roundCents(group.DistanceKM)
+        totals = append(totals, group.Totals...)
+        report.DistanceKM += group.DistanceKM
+        report.Sessions = append(report.Sessions, *group)
+    }
+    report.Totals = sumTotals(totals)
+    report.DistanceKM = roundCents(report.DistanceKM)
+    // Oldest session first, expenses without session last
+    sort.Slice(report.Sessions, func(i, j int) bool {
+        a, b := report.Sessions[i], report.Sessions[j]
+        if (a.SessionID == 0) != (b.SessionID == 0) {
+            return b.SessionID == 0
+        }
+        if a.StartAt != nil && b.StartAt != nil && !a.StartAt.Equal(*b.StartAt) {
+            return a.StartAt.Before(*b.StartAt)
+        }
+        return a.SessionID < b.SessionID
+    })
+    return &report, nil
+}
+
+type periodBuilder struct {
+    database *sql.DB
+    from     time.Time
+    to       time.Time
+    sessions map[int64]db.Session
+    clients  map[int64]string
+    groups   map[int64]*PeriodSession
+    types    map[int64]reportType
+}
+
+// Sessions with days in the period, even without expenses
+func (b *periodBuilder) addSessions() error {
+    clients, err := crud.ListClients(b.database)
+    if err != nil {
+        return err
+    }
+    b.clients = make(map[int64]string, len(clients))
+    for _, client := range clients {
+        b.clients[client.ID] = client.Name
+    }
+    sessions, err := crud.ListSessionsBetween(b.database, b.from, b.to)
+    if err != nil {
+        return err
+    }
+    b.sessions = make(map[int64]db.Session, len(sessions))
+    for _, session := range sessions {
+        b.sessions[session.ID] = session
+        if start, end := session.LocalTimes(); start.Valid {
+            last := b.to.AddDate(0, 0, -1)
+            if end.Valid {
+                last = localDay(end.Time)
+            }
+            if overlapDays(localDay(start.Time), last.AddDate(0, 0, 1), b.from, b.to) > 0 {
+                if _, err := b.group(session.ID); err != nil {
+                    return err
+                }
+            }
+        }
+    }
+    return nil
+}
+
+// Car trips are recorded per day, each one is in the period of its date
+func (b *periodBuilder) addCarTrips() error {
+    carTrips, err := crud.ListCarTripsBetween(b.database, b.from, b.to)
+    if err != nil {
+        return err
+    }
+    for _, carTrip := range carTrips {
+        group, err := b.group(carTrip.SessionID.Int64)
+        if err != nil {
+            return err
+        }
+        group.DistanceKM += carTrip.DistanceKM
+    }
+    return nil
+}
+
+// Line items, receipts and allocations are loaded once for all of them
+func (b *periodBuilder) addExpenses() error {
+    expenses, err := crud.ListExpensesBetween(b.database, b.from, b.to)
+    if err != nil {
+        return err
+    }
+    ids := make([]int64, len(expenses))
+    for i, expense := range expenses {
+        ids[i] = expense.ID
+    }
+    lineItems := make(map[int64]db.LineItemList, len(expenses))
+    allLineItems, err := crud.ListLineItemsByExpenseIDs(b.database, ids)
+    if err != nil {
+        return err
+    }
+    for _, lineItem := range allLineItems {
+        lineItems[lineItem.ExpenseID] = append(lineItems[lineItem.ExpenseID], lineItem)
+    }
+    receipts := make(map[int64]db.ReceiptList, len(expenses))
+    allReceipts, err := crud.ListReceiptsByExpenseIDs(b.database, ids)
+    if err != nil {
+        return err
+    }
+    for _, receipt := range allReceipts {
+        receipts[receipt.ExpenseID] = append(receipts[receipt.ExpenseID], receipt)
+    }
+    allocations := make(map[int64]db.AllocationList)
+    allAllocations, err := crud.ListAllocationsByExpenseIDs(b.database, ids)
+    if err != nil {
+        return err
+    }
+    for _, allocation := range allAllocations {
+        allocations[allocation.ExpenseID] = append(allocations[allocation.ExpenseID], allocation)
+    }
+    attributes, err := MapAttributes(b.database, db.CustomFieldOnExpense)
+    if err != nil {
+        return err
+    }
+
+    for _, expense := range expenses {
+        start := localDay(expense.LocalTime())
+        days := overlapDays(start, start.AddDate(0, 0, expense.Days()), b.from, b.to)
+        if days == 0 {
+            continue
+        }
+        lineItems, receipts := lineItems[expense.ID], receipts[expense.ID]
+        shares, err := sessionShares(expense, allocations[expense.ID], lineItems)
+        if err != nil {
+            return err
+        }
+        if _, ok := b.types[expense.TypeID]; !ok {
+            expenseType, err := crud.GetExpenseTypeByID(b.database, expense.TypeID)
+            if err != nil {
+                return err
+            }
+            b.types[expense.TypeID] = reportType{expenseType.Name, expenseType.StandardKey()}
+        }
+
+        dayRatio := float64(days) / float64(expense.Days())
+        for sessionID, sessionRatio := range shares {
+            group, err := b.group(sessionID)
+            if err != nil {
+                return err
+            }
+            ratio := dayRatio * sessionRatio
+            reportExpense := ReportExpense{
+                ID:         expense.ID,
+                DateTime:   expense.LocalTime(),
+                Type:       b.types[expense.TypeID].name,
+                TypeKey:    b.types[expense.TypeID].key,
+                Currency:   expense.Currency,
+                Notes:      expense.Notes.String,
+                Receipts:   receipts.RelPaths(),
+                LineItems:  make([]ReportLineItem, 0, len(lineItems)),
+                Attributes: attributes[expense.ID],
+            }
+            if expense.Days() > 1 {
+                reportExpense.PeriodDays, reportExpense.CoveredDays = days, expense.Days()
+            }
+            for _, lineItem := range lineItems {
+                reportExpense.Total += lineItem.Total
+                share := roundCents(lineItem.Total * ratio)
+                reportExpense.LineItems = append(
+                    reportExpense.LineItems, ReportLineItem{lineItem.TaxeRate, share},
+                )
+                group.Totals = append(
+                    group.Totals, ReportTotal{expense.Currency, lineItem.TaxeRate, share},
+                )
+            }
+            if ratio != 1 {
+                reportExpense.FullTotal = roundCents(reportExpense.Total)
+                reportExpense.SharePercent = roundCents(ratio * 100)
+                reportExpense.Total = roundCents(reportExpense.Total * ratio)
+            }
+            group.Expenses = append(group.Expenses, reportExpense)
+        }
+    }
+    return nil
+}
+
+// Group of a session, created on first use. Its days are the ones of the
+// session inside the period, the running days until today.
+func (b *periodBuilder) group(sessionID int64) (*PeriodSession, error) {
+    if group, ok := b.groups[sessionID]; ok {
+        return group, nil
+    }
+    group := &PeriodSession{
+        SessionID: sessionID,
+        Expenses:  make([]ReportExpense, 0),
+        Totals:    make([]ReportTotal, 0),
+    }
+    if sessionID != 0 {
+        session, ok := b.sessions[sessionID]
+        if !ok {
+            // Expense or car trip of the period outside the days of its session
+            found, err := crud.GetSessionByID(b.database, sessionID)
+            if errors.Is(err, utils.ErrNotFound) {
+                return nil, utils.IntegrityError("unknown session (ID: %d) in period report", sessionID)
+            }
+            if err != nil {
+                return nil, err
+            }
+            session, b.sessions[sessionID] = *found, *found
+        }
+        start, end := session.LocalTimes()
+        group.Client = b.clients[session.ClientID]
+        group.Session = strings.ReplaceAll(session.String(), "\n", " ")
+        group.StartAt, group.EndAt = fromNullableTime(start), fromNullableTime(end)
+        if start.Valid {
+            first := localDay(start.Time)
+            last := localDay(time.Now().In(db.TimeZoneLocation(session.TimeZone)))
+            if end.Valid {
+                last = localDay(end.Time)
+                group.TotalDays = overlapDays(first, last.AddDate(0, 0, 1), first, last.AddDate(0, 0, 1))
+            }
+            group.Days = overlapDays(first, last.AddDate(0, 0, 1), b.from, b.to)
+            group.Sliced = first.Before(b.from) || !end.Valid || !last.Before(b.to)
+        }
+    }
+    b.groups[sessionID] = group
+    return group, nil
+}
+
+// Sessions charged with an expense and the part of each: its session, or
+// the shares of its allocations
+func sessionShares(
+    expense db.Expense, allocations db.AllocationList, lineItems db.LineItemList,
+) (map[int64]float64, error) {
+    if len(allocations) == 0 {
+        return map[int64]float64{expense.SessionID.Int64: 1}, nil
+    }
+    shares, err := expenseAllocationShares(expense.ID, allocations, lineItems)
+    if err != nil {
+        return nil, err
+    }
+    var total float64
+    for _, allocation := range shares {
+        total += allocation.Share
+    }
+    ratios := make(map[int64]float64, len(shares))
+    for _, allocation := range shares {
+        if total != 0 {
+            ratios[allocation.SessionID] = allocation.Share / total
+        }
+    }
+    return ratios, nil
+}
+
+// Midnight UTC of the date of t in its own location, for day arithmetic
+func localDay(t time.Time) time.Time {
+    return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Days of [start, end) inside [from, to)
+func overlapDays(start time.Time, end time.Time, from time.Time, to time.Time) int {
+    if start.Before(from) {
+        start = from
+    }
+    if end.After(to) {
+        end = to
+    }
+    if !start.Before(end) {
+        return 0
+    }
+    return int(end.Sub(start).Hours()/24 + 0.5)
+}
+
+// One total per currency and taxe rate, sorted
+func sumTotals(totals []ReportTotal) []ReportTotal {
+    type key struct {
+        currency string
+        rate     float64
+    }
+    sums := make(map[key]float64)
+    for _, total := range totals {
+        sums[key{total.Currency, total.TaxeRate}] += total.Total
+    }
+    result := make([]ReportTotal, 0, len(sums))
+    for k, total := range sums {
+        result = append(result, ReportTotal{k.currency, k.rate, roundCents(total)})
+    }
+    sort.Slice(result, func(i, j int) bool {
+        if result[i].Currency != result[j].Currency {
+            return result[i].Currency < result[j].Currency
+        }
+        return result[i].TaxeRate < result[j].TaxeRate
+    })
+    return result
+}
+
+// See WriteSessionReport for the formats
+func WritePeriodReport(w io.Writer, report *PeriodReport, format string, p *i18n.Printer) error {
+    switch format {
+    case ReportFormatText:
+        _, err := io.WriteString(w, strings.Join(report.Lines(p), "\n")+"\n")
+        if err != nil {
+            return utils.LogError("failed to write text period report: %v", err)
+        }
+        return nil
+    case ReportFormatJSON:
+        encoder := json.NewEncoder(w)
+        encoder.SetIndent("", "  ")
+        if err := encoder.Encode(report); err != nil {
+            return utils.LogError("failed to write json period report: %v", err)
+        }
+        return nil
+    case ReportFormatCSV:
+        return report.writeCSV(w, p)
+    case ReportFormatPDF:
+        return writeSimplePDF(w, report.Lines(p))
+    default:
+        return utils.ValidationError([]string{"format"}, "unknown report format: %s", format)
+    }
+}
+
+func (r PeriodReport) Lines(p *i18n.Printer) []string {
+    lines := []string{p.T(
+        "period.title", p.T("period."+r.Period), p.Date(r.From), p.Date(r.To.AddDate(0, 0, -1)),
+    )}
+    if r.DistanceKM > 0 {
+        lines = append(lines, p.T("report.distance", p.Number(r.DistanceKM, 1)))
+    }
+    if len(r.Sessions) == 0 {
+        lines = append(lines, "", p.T("report.none"))
+    }
+    for _, s := range r.Sessions {
+        lines = append(lines, "")
+        if s.SessionID == 0 {
+            lines = append(lines, p.T("period.no_session"))
+        } else {
+            lines = append(lines, p.T("period.session", s.SessionID, s.Client, s.Session))
+            switch {
+            case s.TotalDays == 0:
+                lines = append(lines, "  "+p.T("period.days_running", s.Days))
+            case s.Sliced:
+                lines = append(lines, "  "+p.T("period.days_sliced", s.Days, s.TotalDays))
+            default:
+                lines = append(lines, "  "+p.T("period.days", s.Days))
+            }
+        }
+        if s.DistanceKM > 0 {
+            lines = append(lines, "  "+p.T("report.distance", p.Number(s.DistanceKM, 1)))
+        }
+        for _, e := range s.Expenses {
+            line := fmt.Sprintf(
+                "  %s  %-20s %10s %s",
+                p.Date(e.DateTime), p.TypeName(e.TypeKey, e.Type), p.Number(e.Total, 2), e.Currency,
+            )
+            if e.CoveredDays != 0 {
+                line += "  " + p.T("period.covered", e.PeriodDays, e.CoveredDays)
+            }
+            if e.FullTotal != 0 {
+                line += "  " + p.T("report.share", p.Percent(e.SharePercent), p.Number(e.FullTotal, 2))
+            }
+            if len(e.Receipts) == 0 {
+                line += "  " + p.T("report.no_receipt")
+            }
+            lines = append(lines, line)
+        }
+        for _, t := range s.Totals {
+            lines = append(lines, "    "+p.T(
+                "report.total", t.Currency, p.Percent(t.TaxeRate), p.Number(t.Total, 2),
+            ))
+        }
+    }
+
+    lines = append(lines, "", p.T("report.totals"))
+    if len(r.Totals) == 0 {
+        lines = append(lines, "  "+p.T("report.none"))
+    }
+    for _, t := range r.Totals {
+        lines = append(lines, "  "+p.T(
+            "report.total", t.Currency, p.Percent(t.TaxeRate), p.Number(t.Total, 2),
+        ))
+    }
+    lines = append(lines, "", p.T("report.generated", p.DateTime(r.GeneratedAt)))
+    return lines
+}
+
+// One row per line item share, session_id is empty without session
+func (r PeriodReport) writeCSV(w io.Writer, p *i18n.Printer) error {
+    writer := csv.NewWriter(w)
+    writer.Comma = p.CSVComma()
+    records := [][]string{{
+        "session_id", "client", "expense_id", "date", "type", "currency", "taxe_rate", "total",
+        "share_percent", "notes",
+    }}
+    for _, s := range r.Sessions {
+        sessionID := ""
+        if s.SessionID != 0 {
+            sessionID = strconv.FormatInt(s.SessionID, 10)
+        }
+        for _, e := range s.Expenses {
+            share := "100"
+            if e.FullTotal != 0 {
+                share = p.Decimal(e.SharePercent, -1)
+            }
+            for _, li := range e.LineItems {
+                records = append(records, []string{
+                    sessionID,
+                    s.Client,
+                    strconv.FormatInt(e.ID, 10),
+                    p.Date(e.DateTime),
+                    p.TypeName(e.TypeKey, e.Type),
+                    e.Currency,
+                    p.Decimal(li.TaxeRate, -1),
+                    p.Decimal(li.Total, 2),
+                    share,
+                    e.Notes,
+                })
+            }
+        }
+    }
+    if err := writer.WriteAll(records); err != nil {
+        return utils.LogError("failed to write csv period report: %v", err)
+    }
+    return nil
+}
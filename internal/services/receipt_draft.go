@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/ocr"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Expense pre-filled from a receipt, nothing is saved until the user confirmed
+// it (see SaveExpenseDraft). Warnings tell what could not be read reliably.
+type ExpenseDraft struct {
+    Expense    db.Expense      `json:"-"`
+    LineItems  db.LineItemList `json:"-"`
+    Receipts   db.ReceiptList  `json:"-"`
+    Extraction *ocr.Extraction `json:"extraction"`
+    Warnings   []string        `json:"warnings"`
+}
+
+// receiptRelPath is a receipt already stored with db.StoreReceipt, PDF
+// receipts are read from their preview.
+// defaultCurrency is used when none was found on the receipt.
+func DraftExpenseFromReceipt(
+    ctx context.Context, engine ocr.Engine, receiptRelPath string, defaultCurrency string,
+) (*ExpenseDraft, error) {
+    previewRelPath := db.ReceiptPreviewRelPath(receiptRelPath)
+    previewPath := filepath.Join(config.ReceiptsDir, previewRelPath)
+    if _, err := os.Stat(previewPath); err != nil && previewRelPath != receiptRelPath {
+        return nil, utils.LogError(
+            "no preview to read for receipt %s (is pdftoppm installed?): %v", receiptRelPath, err,
+        )
+    }
+    extraction, err := engine.Extract(ctx, previewPath)
+    if err != nil {
+        return nil, err
+    }
+
+    draft := ExpenseDraft{
+        Expense: db.Expense{
+            Currency: defaultCurrency,
+            DateTime: time.Now().UTC(),
+        },
+        Receipts:   db.ReceiptList{{RelPath: receiptRelPath}},
+        Extraction: extraction,
+        Warnings:   make([]string, 0),
+    }
+
+    if extraction.Merchant != "" {
+        merchant := []rune(extraction.Merchant)
+        if len(merchant) > 100 {
+            merchant = merchant[:100]
+        }
+        draft.Expense.Merchant = sql.NullString{String: string(merchant), Valid: true}
+    }
+    if extraction.Date != nil {
+        draft.Expense.DateTime = *extraction.Date
+    } else {
+        draft.warn("no date found, using today")
+    }
+    if extraction.Currency != "" {
+        draft.Expense.Currency = extraction.Currency
+    } else {
+        draft.warn("no currency found, using %s", defaultCurrency)
+    }
+
+    // Tax lines are only kept when they add up to the total, otherwise one
+    // line item for the whole total is safer than a wrong split
+    var taxLinesTotal float64
+    for _, taxLine := range extraction.TaxLines {
+        taxLinesTotal += taxLine.Total
+    }
+    switch {
+    case extraction.Total == nil && len(extraction.TaxLines) == 0:
+        draft.warn("no total found")
+    case len(extraction.TaxLines) > 0 &&
+        (extraction.Total == nil || math.Abs(taxLinesTotal-*extraction.Total) <= 0.05):
+        for _, taxLine := range extraction.TaxLines {
+            draft.LineItems = append(
+                draft.LineItems, db.LineItem{TaxeRate: taxLine.TaxeRate, Total: taxLine.Total},
+            )
+        }
+    default:
+        if len(extraction.TaxLines) > 0 {
+            draft.warn(
+                "tax lines (%.2f) don't add up to the total (%.2f), taxe rate left to 0",
+                taxLinesTotal, *extraction.Total,
+            )
+        } else {
+            draft.warn("no tax line found, taxe rate left to 0")
+        }
+        draft.LineItems = db.LineItemList{{TaxeRate: 0, Total: *extraction.Total}}
+    }
+    return &draft, nil
+}
+
+func (d *ExpenseDraft) warn(format string, args ...any) {
+    d.Warnings = append(d.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Save the draft once the user confirmed or corrected it
+func SaveExpenseDraft(database *sql.DB, draft *ExpenseDraft) (int64, error) {
+    if len(draft.LineItems) == 0 {
+        return 0, utils.ValidationError([]string{"line_items"}, "expense draft has no line item")
+    }
+    expense := draft.Expense
+    if err := expense.PreInsertValid(); err != nil {
+        return 0, err
+    }
+    for _, lineItem := range draft.LineItems {
+        lineItem.ExpenseID = 1 // checked for real once the expense exists
+        if err := lineItem.PreInsertValid(); err != nil {
+            return 0, err
+        }
+    }
+    for _, receipt := range draft.Receipts {
+        receipt.ExpenseID = 1
+        if err := receipt.PreInsertValid(); err != nil {
+            return 0, err
+        }
+    }
+
+    var expenseID int64
+    err := db.InTx(database, func(tx db.Querier) error {
+        var err error
+        if expenseID, err = crud.CreateExpense(tx, expense); err != nil {
+            return err
+        }
+        for _, lineItem := range draft.LineItems {
+            lineItem.ExpenseID = expenseID
+            if _, err := crud.CreateLineItem(tx, lineItem); err != nil {
+                return err
+            }
+        }
+        for _, receipt := range draft.Receipts {
+            receipt.ExpenseID = expenseID
+            if _, err := crud.CreateReceipt(tx, receipt); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return 0, err
+    }
+    draft.Expense.ID = expenseID
+    return expenseID, nil
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+)
+
+
+type RecurringOptions struct {
+    Today   time.Time // occurrences up to this day included are due
+    // Generate every due occurrence not generated yet, instead of only the
+    // latest one of each recurring expense
+    CatchUp bool
+    DryRun  bool // report what would be generated, without writing
+}
+
+type GeneratedExpense struct {
+    RecurringExpenseID int64   `json:"recurring_expense_id"`
+    Name               string  `json:"name"`
+    DateOnly           string  `json:"date_only"`
+    ExpenseID          int64   `json:"expense_id,omitempty"` // 0 on a dry run
+    SessionID          *int64  `json:"session_id,omitempty"`
+    Currency           string  `json:"currency"`
+    Total              float64 `json:"total"`
+}
+
+type RecurringReport struct {
+    Generated []GeneratedExpense `json:"generated"`
+    // Due occurrences left behind without catch up, by recurring expense
+    // name. Only the ones after its last generated occurrence are counted.
+    Missed    map[string]int     `json:"missed,omitempty"`
+    Warnings  []string           `json:"warnings,omitempty"`
+}
+
+// Materialize the due occurrences of every recurring expense as expenses,
+// with their line items. Running it twice is harmless: each generated date is
+// recorded (see db.RecurringOccurrence) and never generated again.
+func GenerateRecurringExpenses(database *sql.DB, options RecurringOptions) (
+    *RecurringReport, error,
+) {
+    recurrings, err := crud.ListRecurringExpenses(database)
+    if err != nil {
+        return nil, err
+    }
+    var sessions []db.Session
+    for _, recurring := range recurrings {
+        if recurring.SessionRule == db.RecurringClientSession {
+            if sessions, err = crud.ListSessions(database); err != nil {
+                return nil, err
+            }
+            break
+        }
+    }
+
+    report := RecurringReport{Generated: make([]GeneratedExpense, 0), Missed: make(map[string]int)}
+    for _, recurring := range recurrings {
+        dates, missed, err := dueDates(database, recurring, options)
+        if err != nil {
+            return nil, err
+        }
+        if missed > 0 {
+            report.Missed[recurring.Name] = missed
+        }
+
+        for _, date := range dates {
+            generated := GeneratedExpense{
+                RecurringExpenseID: recurring.ID,
+                Name:               recurring.Name,
+                DateOnly:           date.Format(time.DateOnly),
+                Currency:           recurring.Currency,
+            }
+            for _, item := range recurring.LineItems {
+                generated.Total += item.Total
+            }
+            sessionID, warning := recurringSession(recurring, sessions, date)
+            if warning != "" {
+                report.Warnings = append(report.Warnings, warning)
+            }
+            if sessionID.Valid {
+                generated.SessionID = &sessionID.Int64
+            }
+
+            if !options.DryRun {
+                if generated.ExpenseID, err = materialize(
+                    database, recurring, date, sessionID,
+                ); err != nil {
+                    return nil, err
+                }
+            }
+            report.Generated = append(report.Generated, generated)
+        }
+    }
+
+    slog.Info(
+        "recurring expenses generated",
+        "generated", len(report.Generated), "dry_run", options.DryRun, "catch_up", options.CatchUp,
+    )
+    return &report, nil
+}
+
+// Dates to generate, and how many are left behind without catch up
+func dueDates(database *sql.DB, recurring db.RecurringExpense, options RecurringOptions) (
+    []time.Time, int, error,
+) {
+    occurrences, err := recurring.Schedule.Occurrences(recurring.StartTime(), options.Today)
+    if err != nil {
+        return nil, 0, err
+    }
+    generated, err := crud.ListRecurringOccurrences(database, recurring.ID)
+    if err != nil {
+        return nil, 0, err
+    }
+    done := make(map[string]bool, len(generated))
+    last := ""
+    for _, occurrence := range generated {
+        done[occurrence.DateOnly] = true
+        last = max(last, occurrence.DateOnly)
+    }
+
+    if len(occurrences) == 0 {
+        return nil, 0, nil
+    }
+    latest := occurrences[len(occurrences)-1]
+    pending := slices.DeleteFunc(occurrences, func(date time.Time) bool {
+        return done[date.Format(time.DateOnly)]
+    })
+    if options.CatchUp {
+        return pending, 0, nil
+    }
+
+    // Only the latest period, the older ones are missed when they come after
+    // the last generated occurrence (before it, they were skipped on purpose)
+    var dates []time.Time
+    missed := 0
+    for _, date := range pending {
+        switch {
+        case date.Equal(latest):
+            dates = append(dates, date)
+        case date.Format(time.DateOnly) > last:
+            missed++
+        }
+    }
+    return dates, missed, nil
+}
+
+// The session of a generated expense, and a warning when the rule finds none
+func recurringSession(recurring db.RecurringExpense, sessions []db.Session, date time.Time) (
+    sql.NullInt64, string,
+) {
+    switch recurring.SessionRule {
+    case db.RecurringFixedSession:
+        return recurring.SessionID, ""
+    case db.RecurringClientSession:
+        day := date.Format(time.DateOnly)
+        var found *db.Session
+        for i, session := range sessions {
+            start, end := session.LocalTimes()
+            if  session.ClientID != recurring.ClientID.Int64 ||
+                !start.Valid ||
+                start.Time.Format(time.DateOnly) > day ||
+                (end.Valid && end.Time.Format(time.DateOnly) < day) {
+                continue
+            }
+            if  found == nil ||
+                session.StartAtDateTime.Time.After(found.StartAtDateTime.Time) {
+                found = &sessions[i]
+            }
+        }
+        if found == nil {
+            return sql.NullInt64{}, fmt.Sprintf(
+                "%s on %s: no session of client (ID: %d) running, generated without session",
+                recurring.Name, day, recurring.ClientID.Int64,
+            )
+        }
+        return sql.NullInt64{Int64: found.ID, Valid: true}, ""
+    default:
+        return sql.NullInt64{}, ""
+    }
+}
+
+func materialize(
+    database *sql.DB, recurring db.RecurringExpense, date time.Time, sessionID sql.NullInt64,
+) (int64, error) {
+    expense := db.Expense{
+        SessionID: sessionID,
+        TypeID:    recurring.TypeID,
+        Currency:  recurring.Currency,
+        Notes:     recurring.Notes,
+        DateTime:  date,
+        Country:   recurring.Country,
+    }
+    lineItems := recurring.LineItems.LineItems(1)
+    for _, lineItem := range lineItems {
+        if err := lineItem.PreInsertValid(); err != nil {
+            return 0, err
+        }
+    }
+
+    // An expense is only there with its occurrence, or it would be generated again
+    var expenseID int64
+    err := db.InTx(database, func(tx db.Querier) error {
+        id, err := crud.CreateExpense(tx, expense)
+        if err != nil {
+            return err
+        }
+        for _, lineItem := range lineItems {
+            lineItem.ExpenseID = id
+            if _, err := crud.CreateLineItem(tx, lineItem); err != nil {
+                return err
+            }
+        }
+        err = crud.CreateRecurringOccurrence(tx, db.RecurringOccurrence{
+            RecurringExpenseID: recurring.ID,
+            DateOnly:           date.Format(time.DateOnly),
+            ExpenseID:          id,
+        })
+        if err != nil {
+            return err
+        }
+        expenseID = id
+        return nil
+    })
+    if err != nil {
+        return 0, err
+    }
+    return expenseID, nil
+}
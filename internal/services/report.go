@@ -0,0 +1,361 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Formats accepted by WriteSessionReport
+const (
+    ReportFormatText = "text"
+    ReportFormatJSON = "json"
+    ReportFormatCSV  = "csv"
+    ReportFormatPDF  = "pdf"
+)
+
+type SessionReport struct {
+    SessionID   int64           `json:"session_id"`
+    Client      string          `json:"client"`
+    Session     string          `json:"session"`
+    StartAt     *time.Time      `json:"start_at,omitempty"`
+    EndAt       *time.Time      `json:"end_at,omitempty"`
+    DistanceKM  float64         `json:"distance_km"`
+    Expenses    []ReportExpense `json:"expenses"`
+    Totals      []ReportTotal   `json:"totals"`
+    GeneratedAt time.Time       `json:"generated_at"`
+    Attributes
+}
+
+type ReportExpense struct {
+    ID        int64            `json:"id"`
+    DateTime  time.Time        `json:"date_time"`
+    Type      string           `json:"type"`
+    // Standard key of the type for its display name, see db.ExpenseType.StandardKey
+    TypeKey   string           `json:"type_key,omitempty"`
+    Currency  string           `json:"currency"`
+    Notes     string           `json:"notes,omitempty"`
+    Receipts  []string         `json:"receipts,omitempty"`
+    Total     float64          `json:"total"`
+    LineItems []ReportLineItem `json:"line_items"`
+    // Expense split across sessions: Total and LineItems are the share of
+    // this session, out of FullTotal
+    FullTotal    float64 `json:"full_total,omitempty"`
+    SharePercent float64 `json:"share_percent,omitempty"`
+    // Expense covering several days, in a period report: PeriodDays of its
+    // CoveredDays are in the period, and its total is prorated
+    CoveredDays int `json:"covered_days,omitempty"`
+    PeriodDays  int `json:"period_days,omitempty"`
+    Attributes
+}
+
+type ReportLineItem struct {
+    TaxeRate float64 `json:"taxe_rate"`
+    Total    float64 `json:"total"`
+}
+
+// One row per currency and taxe rate, as currencies can't be summed together
+type ReportTotal struct {
+    Currency string  `json:"currency"`
+    TaxeRate float64 `json:"taxe_rate"`
+    Total    float64 `json:"total"`
+}
+
+func BuildSessionReport(database *sql.DB, sessionID int64) (*SessionReport, error) {
+    session, err := crud.GetSessionByID(database, sessionID)
+    if err != nil {
+        return nil, err
+    }
+    client, err := crud.GetClientByID(database, session.ClientID)
+    if err != nil {
+        return nil, err
+    }
+
+    startAt, endAt := session.LocalTimes()
+    report := SessionReport{
+        SessionID:   session.ID,
+        Client:      client.Name,
+        Session:     strings.ReplaceAll(session.String(), "\n", " "),
+        StartAt:     fromNullableTime(startAt),
+        EndAt:       fromNullableTime(endAt),
+        Expenses:    make([]ReportExpense, 0),
+        Totals:      make([]ReportTotal, 0),
+        GeneratedAt: time.Now().UTC(),
+    }
+
+    if report.Attributes, err = GetAttributes(database, db.CustomFieldOnSession, session.ID); err != nil {
+        return nil, err
+    }
+
+    carTrips, err := crud.ListCarTripsBySessionID(database, session.ID)
+    if err != nil {
+        return nil, err
+    }
+    for _, carTrip := range carTrips {
+        report.DistanceKM += carTrip.DistanceKM
+    }
+
+    expenses, err := crud.ListExpensesByFilter(database, crud.ExpenseFilter{SessionID: session.ID})
+    if err != nil {
+        return nil, err
+    }
+    expensesByCurrency, err := expenses.MapExpensesByCurrency()
+    if err != nil {
+        return nil, err
+    }
+    types := make(map[int64]reportType)
+    attributes, err := MapAttributes(database, db.CustomFieldOnExpense)
+    if err != nil {
+        return nil, err
+    }
+
+    for currency, currencyExpenses := range expensesByCurrency {
+        var currencyLineItems []ReportTotal
+        for _, expense := range currencyExpenses {
+            lineItems, err := crud.ListLineItemsByExpenseID(database, expense.ID)
+            if err != nil {
+                return nil, err
+            }
+            receipts, err := crud.ListReceiptsByExpenseID(database, expense.ID)
+            if err != nil {
+                return nil, err
+            }
+
+            if _, ok := types[expense.TypeID]; !ok {
+                expenseType, err := crud.GetExpenseTypeByID(database, expense.TypeID)
+                if err != nil {
+                    return nil, err
+                }
+                types[expense.TypeID] = reportType{expenseType.Name, expenseType.StandardKey()}
+            }
+
+            reportExpense := ReportExpense{
+                ID:        expense.ID,
+                DateTime:  expense.LocalTime(),
+                Type:      types[expense.TypeID].name,
+                TypeKey:   types[expense.TypeID].key,
+                Currency:  expense.Currency,
+                Notes:     expense.Notes.String,
+                Receipts:  receipts.RelPaths(),
+                LineItems: make([]ReportLineItem, 0, len(lineItems)),
+                Attributes: attributes[expense.ID],
+            }
+            ratio, err := sessionRatio(database, expense.ID, session.ID)
+            if err != nil {
+                return nil, err
+            }
+            for _, lineItem := range lineItems {
+                reportExpense.Total += lineItem.Total
+                reportExpense.LineItems = append(
+                    reportExpense.LineItems,
+                    ReportLineItem{lineItem.TaxeRate, roundCents(lineItem.Total * ratio)},
+                )
+            }
+            if ratio != 1 {
+                reportExpense.FullTotal = roundCents(reportExpense.Total)
+                reportExpense.SharePercent = roundCents(ratio * 100)
+                reportExpense.Total = roundCents(reportExpense.Total * ratio)
+            }
+            report.Expenses = append(report.Expenses, reportExpense)
+
+            sums, err := lineItems.SumByTaxeRates()
+            if err != nil {
+                return nil, err
+            }
+            for rate, total := range sums {
+                currencyLineItems = append(
+                    currencyLineItems, ReportTotal{currency, rate, roundCents(total * ratio)},
+                )
+            }
+        }
+        report.Totals = append(report.Totals, mergeTotals(currencyLineItems)...)
+    }
+
+    sort.Slice(report.Expenses, func(i, j int) bool {
+        return report.Expenses[i].DateTime.Before(report.Expenses[j].DateTime)
+    })
+    sort.Slice(report.Totals, func(i, j int) bool {
+        if report.Totals[i].Currency != report.Totals[j].Currency {
+            return report.Totals[i].Currency < report.Totals[j].Currency
+        }
+        return report.Totals[i].TaxeRate < report.Totals[j].TaxeRate
+    })
+    return &report, nil
+}
+
+type reportType struct {
+    name string
+    key  string
+}
+
+// Part of an expense charged to the session: 1 unless the expense is split
+// across sessions
+func sessionRatio(database *sql.DB, expenseID int64, sessionID int64) (float64, error) {
+    shares, err := ExpenseAllocations(database, expenseID)
+    if err != nil || len(shares) == 0 {
+        return 1, err
+    }
+    var share, total float64
+    for _, allocation := range shares {
+        total += allocation.Share
+        if allocation.SessionID == sessionID {
+            share = allocation.Share
+        }
+    }
+    if total == 0 {
+        return 0, nil
+    }
+    return share / total, nil
+}
+
+func mergeTotals(totals []ReportTotal) []ReportTotal {
+    if len(totals) == 0 {
+        return nil
+    }
+    merged := make(map[float64]float64)
+    for _, total := range totals {
+        merged[total.TaxeRate] += total.Total
+    }
+    result := make([]ReportTotal, 0, len(merged))
+    for rate, total := range merged {
+        result = append(result, ReportTotal{totals[0].Currency, rate, total})
+    }
+    return result
+}
+
+// Text, PDF and CSV are written in the language and formats of p, JSON is
+// left to its readers
+func WriteSessionReport(w io.Writer, report *SessionReport, format string, p *i18n.Printer) error {
+    switch format {
+    case ReportFormatText:
+        _, err := io.WriteString(w, strings.Join(report.Lines(p), "\n")+"\n")
+        if err != nil {
+            return utils.LogError("failed to write text report: %v", err)
+        }
+        return nil
+    case ReportFormatJSON:
+        encoder := json.NewEncoder(w)
+        encoder.SetIndent("", "  ")
+        if err := encoder.Encode(report); err != nil {
+            return utils.LogError("failed to write json report: %v", err)
+        }
+        return nil
+    case ReportFormatCSV:
+        return report.writeCSV(w, p)
+    case ReportFormatPDF:
+        return writeSimplePDF(w, report.Lines(p))
+    default:
+        return utils.ValidationError([]string{"format"}, "unknown report format: %s", format)
+    }
+}
+
+// Human readable layout, shared by the text and PDF formats
+func (r SessionReport) Lines(p *i18n.Printer) []string {
+    lines := []string{
+        p.T("report.session.title", r.SessionID),
+        p.T("report.client", r.Client),
+        p.T("report.session", r.Session),
+    }
+    lines = append(lines, r.Attributes.lines(p, "")...)
+    if r.DistanceKM > 0 {
+        lines = append(lines, p.T("report.distance", p.Number(r.DistanceKM, 1)))
+    }
+    lines = append(lines, "", p.T("report.expenses"))
+    if len(r.Expenses) == 0 {
+        lines = append(lines, "  "+p.T("report.none"))
+    }
+    for _, e := range r.Expenses {
+        line := fmt.Sprintf(
+            "  %s  %-20s %10s %s",
+            p.Date(e.DateTime), p.TypeName(e.TypeKey, e.Type), p.Number(e.Total, 2), e.Currency,
+        )
+        if e.FullTotal != 0 {
+            line += "  " + p.T("report.share", p.Percent(e.SharePercent), p.Number(e.FullTotal, 2))
+        }
+        if len(e.Receipts) == 0 {
+            line += "  " + p.T("report.no_receipt")
+        }
+        lines = append(lines, line)
+        if e.Notes != "" {
+            lines = append(lines, "      "+e.Notes)
+        }
+        lines = append(lines, e.Attributes.lines(p, "      ")...)
+    }
+
+    lines = append(lines, "", p.T("report.totals"))
+    for _, t := range r.Totals {
+        lines = append(lines, "  "+p.T(
+            "report.total", t.Currency, p.Percent(t.TaxeRate), p.Number(t.Total, 2),
+        ))
+    }
+    lines = append(lines, "", p.T("report.generated", p.DateTime(r.GeneratedAt)))
+    return lines
+}
+
+// One column per expense custom field used in the report, after the tags.
+// Column names are identifiers, values are in the formats of p.
+func (r SessionReport) writeCSV(w io.Writer, p *i18n.Printer) error {
+    writer := csv.NewWriter(w)
+    writer.Comma = p.CSVComma()
+    header := []string{
+        "expense_id", "date", "type", "currency", "taxe_rate", "total", "notes", "receipts", "tags",
+    }
+    var fieldNames []string
+    for _, e := range r.Expenses {
+        for _, name := range e.FieldNames() {
+            if !slices.Contains(fieldNames, name) {
+                fieldNames = append(fieldNames, name)
+            }
+        }
+    }
+    sort.Strings(fieldNames)
+    records := [][]string{append(header, fieldNames...)}
+    for _, e := range r.Expenses {
+        for _, li := range e.LineItems {
+            record := []string{
+                strconv.FormatInt(e.ID, 10),
+                p.Date(e.DateTime),
+                p.TypeName(e.TypeKey, e.Type),
+                e.Currency,
+                p.Decimal(li.TaxeRate, -1),
+                p.Decimal(li.Total, 2),
+                e.Notes,
+                strings.Join(e.Receipts, ";"),
+                strings.Join(e.Tags, ";"),
+            }
+            for _, name := range fieldNames {
+                record = append(record, e.Fields[name])
+            }
+            records = append(records, record)
+        }
+    }
+    if err := writer.WriteAll(records); err != nil {
+        return utils.LogError("failed to write csv report: %v", err)
+    }
+    return nil
+}
+
+// "Tags: a, b" and "name: value" lines, indented
+func (a Attributes) lines(p *i18n.Printer, indent string) []string {
+    var lines []string
+    if len(a.Tags) > 0 {
+        lines = append(lines, indent+p.T("report.tags", strings.Join(a.Tags, ", ")))
+    }
+    for _, name := range a.FieldNames() {
+        lines = append(lines, fmt.Sprintf("%s%s: %s", indent, name, a.Fields[name]))
+    }
+    return lines
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+const (
+    DefaultSearchLimit = 20
+
+    // Around the matched terms in SearchHit.Snippet
+    SnippetStart = "["
+    SnippetEnd   = "]"
+
+    snippetEllipsis = "…"
+    snippetTokens   = 10 // words kept around the first match by FTS5
+    snippetRunes    = 60 // same for the fallback search, in characters
+)
+
+// Kind is client, session, expense_type or expense, EntityID its ID. Field is
+// the column matched (name, location, trip_start_location, notes...).
+type SearchHit struct {
+    Kind     string  `json:"kind"`
+    EntityID int64   `json:"entity_id"`
+    Field    string  `json:"field"`
+    Snippet  string  `json:"snippet"`
+    Score    float64 `json:"score"` // higher is better, 0 without FTS5
+}
+
+// Hits matching every term of query in the same field, best first. Terms are
+// matched as prefixes, case and accents ignored ("lyo" finds "Lyon").
+// Without FTS5 (see db.HasSearchIndex) the tables are scanned with LIKE:
+// terms match anywhere, only ASCII case is ignored and the hits are not
+// ranked, shorter fields first.
+func Search(database *sql.DB, query string, limit int) ([]SearchHit, error) {
+    terms := strings.Fields(query)
+    if len(terms) == 0 {
+        return nil, utils.ValidationError([]string{"query"}, "empty search query")
+    }
+    if limit <= 0 {
+        limit = DefaultSearchLimit
+    }
+
+    indexed, err := db.HasSearchIndex(database)
+    if err != nil {
+        return nil, err
+    }
+    if indexed {
+        return searchIndex(database, terms, limit)
+    }
+    return searchTables(database, terms, limit)
+}
+
+func searchIndex(database *sql.DB, terms []string, limit int) ([]SearchHit, error) {
+    // Each term quoted: user input is never read as FTS5 syntax
+    quoted := make([]string, 0, len(terms))
+    for _, term := range terms {
+        quoted = append(quoted, `"`+strings.ReplaceAll(term, `"`, `""`)+`"*`)
+    }
+
+    querry := fmt.Sprintf(
+        "SELECT kind, entity_id, field, snippet(search_index, 3, ?, ?, ?, %d), " +
+        "bm25(search_index) FROM search_index WHERE search_index MATCH ? " +
+        "ORDER BY rank LIMIT ?",
+        snippetTokens,
+    )
+    rows, err := database.Query(
+        querry, SnippetStart, SnippetEnd, snippetEllipsis, strings.Join(quoted, " "), limit,
+    )
+    if err != nil {
+        return nil, utils.LogError("rejected querry: %v, error: %v", querry, err)
+    }
+    defer rows.Close()
+
+    hits := make([]SearchHit, 0)
+    for rows.Next() {
+        var hit SearchHit
+        var bm25 float64
+        if err := rows.Scan(&hit.Kind, &hit.EntityID, &hit.Field, &hit.Snippet, &bm25); err != nil {
+            return nil, utils.LogError("failed to scan search hit: %v", err)
+        }
+        hit.Score = -bm25 // bm25() is lower for better matches
+        hits = append(hits, hit)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, utils.LogError("failed to read search hits: %v", err)
+    }
+    return hits, nil
+}
+
+// Same columns as migrations/search/rebuild.sql
+const searchTablesQuerry = `
+SELECT 'client' AS kind, id AS entity_id, 'name' AS field, name AS body FROM clients
+UNION ALL
+SELECT 'session', id, 'location', location FROM sessions
+UNION ALL
+SELECT 'session', id, 'trip_start_location', trip_start_location FROM sessions
+WHERE trip_start_location IS NOT NULL
+UNION ALL
+SELECT 'session', id, 'trip_end_location', trip_end_location FROM sessions
+WHERE trip_end_location IS NOT NULL
+UNION ALL
+SELECT 'expense_type', id, 'name', name FROM expense_types
+UNION ALL
+SELECT 'expense', id, 'notes', notes FROM expenses WHERE notes IS NOT NULL`
+
+func searchTables(database *sql.DB, terms []string, limit int) ([]SearchHit, error) {
+    conditions := make([]string, 0, len(terms))
+    args := make([]any, 0, len(terms))
+    for _, term := range terms {
+        conditions = append(conditions, "body LIKE ? ESCAPE '\\'")
+        args = append(args, "%"+escapeLike(term)+"%")
+    }
+    querry := "SELECT kind, entity_id, field, body FROM (" + searchTablesQuerry +
+        ") WHERE " + strings.Join(conditions, " AND ")
+    rows, err := database.Query(querry, args...)
+    if err != nil {
+        return nil, utils.LogError("rejected querry: %v, error: %v", querry, err)
+    }
+    defer rows.Close()
+
+    hits := make([]SearchHit, 0)
+    for rows.Next() {
+        var hit SearchHit
+        var body string
+        if err := rows.Scan(&hit.Kind, &hit.EntityID, &hit.Field, &body); err != nil {
+            return nil, utils.LogError("failed to scan search hit: %v", err)
+        }
+        hit.Snippet = highlight(body, terms)
+        hits = append(hits, hit)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, utils.LogError("failed to read search hits: %v", err)
+    }
+
+    sort.SliceStable(hits, func(i, j int) bool {
+        return len(hits[i].Snippet) < len(hits[j].Snippet)
+    })
+    if len(hits) > limit {
+        hits = hits[:limit]
+    }
+    return hits, nil
+}
+
+// LIKE only ignores the case of ASCII letters, byte offsets are kept
+func asciiLower(s string) string {
+    return strings.Map(func(r rune) rune {
+        if 'A' <= r && r <= 'Z' {
+            return r + 'a' - 'A'
+        }
+        return r
+    }, s)
+}
+
+func escapeLike(term string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(term)
+}
+
+// Mark the terms in body like snippet() does, cut around the first match
+func highlight(body string, terms []string) string {
+    lower := asciiLower(body)
+    first := -1
+    var marked strings.Builder
+    for i := 0; i < len(body); {
+        matched := 0
+        for _, term := range terms {
+            term = asciiLower(term)
+            if strings.HasPrefix(lower[i:], term) && len(term) > matched {
+                matched = len(term)
+            }
+        }
+        if matched == 0 {
+            _, size := utf8.DecodeRuneInString(body[i:])
+            marked.WriteString(body[i : i+size])
+            i += size
+            continue
+        }
+        if first < 0 {
+            first = marked.Len()
+        }
+        marked.WriteString(SnippetStart + body[i:i+matched] + SnippetEnd)
+        i += matched
+    }
+
+    snippet := marked.String()
+    if utf8.RuneCountInString(snippet) <= snippetRunes {
+        return snippet
+    }
+    runes := []rune(snippet)
+    start := max(0, utf8.RuneCountInString(snippet[:first])-snippetRunes/4)
+    end := min(len(runes), start+snippetRunes)
+    snippet = string(runes[start:end])
+    if start > 0 {
+        snippet = snippetEllipsis + snippet
+    }
+    if end < len(runes) {
+        snippet += snippetEllipsis
+    }
+    return snippet
+}
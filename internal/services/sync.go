@@ -0,0 +1,1130 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// Offline-first sync: each device keeps its own database and exchanges change
+// sets with a server (see internal/api). Rows are identified by their
+// public_id, every local change bumps the row version and its position in the
+// change log (sync_seq), deletes leave tombstones (migration 010_sync.sql).
+//
+// A device pushes its changes since the last push, the server resolves the
+// conflicts, then the device pulls everything since its cursor and applies it
+// as is: after a sync both sides hold the same rows.
+//
+// Conflict rules, applied by the server:
+//   - same row changed on both sides: the latest updated_at wins, a tie keeps
+//     the server row
+//   - rows with another unique key (client, expense type, tag, custom field and
+//     recurring expense names, car trip dates, receipt files and allocations of
+//     an expense) created on both sides are the same row: the pushed one is
+//     merged into the server one, the device takes its public ID (SyncRemap)
+//   - delete against change: the latest wins, a change after the delete
+//     brings the row back
+//   - references win over deletes: a deleted client, session, expense type...
+//     still referenced is kept, and a pushed row referencing one deleted on the
+//     server brings it back from its tombstone
+//   - owned rows (line items, receipts and allocations of an expense) follow
+//     their expense: deleted with it and dropped when pushed for a deleted one
+//   - tags and custom field values of expenses and sessions, and occurrences
+//     of recurring expenses, travel with them. Occurrences are only added, so
+//     a date generated on any device is never generated again.
+// Rejected changes are reported as SyncConflict, the winning row is sent back
+// to the device on its next pull. Tax rates and installed standard models are
+// not synced, migrations and models install them on each side.
+
+// Reasons of a SyncConflict
+const (
+    SyncConflictNewer      = "newer"            // the row was changed later on the server
+    SyncConflictDeleted    = "deleted"          // the row was deleted later on the server
+    SyncConflictReferenced = "referenced"       // delete of a row still referenced on the server
+    SyncConflictOrphan     = "parent_deleted"   // owned row of a deleted expense
+    SyncConflictUnknown    = "unknown_reference"
+    SyncConflictRejected   = "rejected"         // breaks a constraint (name already used...)
+)
+
+const DefaultSyncPageSize = 500
+
+// Values are the columns of the row, references to other rows as their sync
+// ID. Deleted changes only carry the public ID, version and time of the delete.
+type SyncChange struct {
+    Table       string           `json:"table"`
+    PublicID    string           `json:"public_id"`
+    Version     int64            `json:"version"`
+    UpdatedAt   string           `json:"updated_at"`
+    Deleted     bool             `json:"deleted,omitempty"`
+    Values      map[string]any   `json:"values,omitempty"`
+    Attributes  *Attributes      `json:"attributes,omitempty"`  // expenses and sessions
+    Occurrences []SyncOccurrence `json:"occurrences,omitempty"` // recurring expenses
+    Seq         int64            `json:"seq"`
+}
+
+type SyncOccurrence struct {
+    DateOnly        string `json:"date_only"`
+    ExpensePublicID string `json:"expense_public_id"`
+}
+
+// Cursor is the seq of the last change, to give back as since for the next
+// page when More
+type SyncChangeSet struct {
+    Changes []SyncChange `json:"changes"`
+    Cursor  int64        `json:"cursor"`
+    More    bool         `json:"more"`
+}
+
+type SyncConflict struct {
+    Table    string `json:"table"`
+    PublicID string `json:"public_id"`
+    Reason   string `json:"reason"`
+}
+
+// A pushed row merged into the server row having the same unique key
+type SyncRemap struct {
+    Table          string `json:"table"`
+    PublicID       string `json:"public_id"`
+    ServerPublicID string `json:"server_public_id"`
+}
+
+type SyncResult struct {
+    Applied   int            `json:"applied"`
+    Conflicts []SyncConflict `json:"conflicts,omitempty"`
+    Remapped  []SyncRemap    `json:"remapped,omitempty"`
+    Warnings  []string       `json:"warnings,omitempty"`
+}
+
+type SyncOptions struct {
+    // Changes pulled from the server: applied as they are, the server already
+    // resolved the conflicts
+    Authoritative bool
+}
+
+// Sync bookkeeping of a database, see table sync_state
+type SyncStatus struct {
+    DeviceID     string `json:"device_id"`
+    Seq          int64  `json:"seq"`
+    PushedSeq    int64  `json:"pushed_seq"`
+    PulledCursor int64  `json:"pulled_cursor"`
+}
+
+type syncTable struct {
+    name    string
+    columns []string          // synced columns, besides id and the sync ones
+    refs    map[string]string // column -> referenced table
+    owner   string            // column referencing the row owning this one
+    unique  []string          // other unique key: same key on both sides, same row
+    kind    string            // attributes kind of the rows
+}
+
+// Referenced tables first
+var syncTables = []syncTable{
+    {name: "clients", columns: []string{"name"}, unique: []string{"name"}},
+    {
+        name: "expense_types",
+        columns: []string{
+            "name", "default_taxe_rates", "accounting_code", "reimbursable",
+            "description", "model_ref", "vat_recoverable",
+        },
+        unique: []string{"name"},
+    },
+    {name: "tags", columns: []string{"name"}, unique: []string{"name"}},
+    {
+        name:    "custom_fields",
+        columns: []string{"name", "applies_to", "type", "options"},
+        unique:  []string{"applies_to", "name"},
+    },
+    {
+        name: "sessions",
+        columns: []string{
+            "client_id", "location", "trip_start_location", "trip_end_location",
+            "start_at_date_time", "end_at_date_time", "time_zone",
+        },
+        refs: map[string]string{"client_id": "clients"},
+        kind: db.CustomFieldOnSession,
+    },
+    {
+        name:    "car_trips",
+        columns: []string{"session_id", "distance_km", "date_only"},
+        refs:    map[string]string{"session_id": "sessions"},
+        unique:  []string{"date_only"},
+    },
+    {
+        name:    "expenses",
+        columns: []string{
+            "session_id", "type_id", "currency", "notes", "date_time", "country", "time_zone", "covered_days",
+            "merchant",
+        },
+        refs:    map[string]string{"session_id": "sessions", "type_id": "expense_types"},
+        kind:    db.CustomFieldOnExpense,
+    },
+    {
+        name:    "line_items",
+        columns: []string{"expense_id", "taxe_rate", "total"},
+        refs:    map[string]string{"expense_id": "expenses"},
+        owner:   "expense_id",
+    },
+    {
+        name:    "receipts",
+        columns: []string{"expense_id", "rel_path", "position"},
+        refs:    map[string]string{"expense_id": "expenses"},
+        owner:   "expense_id",
+        unique:  []string{"expense_id", "rel_path"},
+    },
+    {
+        name:    "expense_allocations",
+        columns: []string{"expense_id", "session_id", "percentage", "amount"},
+        refs:    map[string]string{"expense_id": "expenses", "session_id": "sessions"},
+        owner:   "expense_id",
+        unique:  []string{"expense_id", "session_id"},
+    },
+    {
+        name: "recurring_expenses",
+        columns: []string{
+            "name", "type_id", "currency", "line_items", "notes", "country",
+            "session_rule", "session_id", "client_id", "schedule", "start_date",
+        },
+        refs: map[string]string{
+            "type_id": "expense_types", "session_id": "sessions", "client_id": "clients",
+        },
+        unique: []string{"name"},
+    },
+}
+
+func findSyncTable(name string) (syncTable, int, bool) {
+    for i, st := range syncTables {
+        if st.name == name {
+            return st, i, true
+        }
+    }
+    return syncTable{}, 0, false
+}
+
+func GetSyncStatus(database *sql.DB) (*SyncStatus, error) {
+    rows, err := database.Query("SELECT key, value FROM sync_state")
+    if err != nil {
+        return nil, utils.LogError("failed to read sync state: %v", err)
+    }
+    defer rows.Close()
+
+    var status SyncStatus
+    for rows.Next() {
+        var key string
+        var value any
+        if err := rows.Scan(&key, &value); err != nil {
+            return nil, utils.LogError("failed to scan sync state: %v", err)
+        }
+        number, _ := value.(int64)
+        switch key {
+        case "device_id":
+            status.DeviceID = fmt.Sprint(value)
+        case "seq":
+            status.Seq = number
+        case "pushed_seq":
+            status.PushedSeq = number
+        case "pulled_cursor":
+            status.PulledCursor = number
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, utils.LogError("failed to read sync state: %v", err)
+    }
+    return &status, nil
+}
+
+// After a push then a pull: local changes up to pushedSeq are on the server,
+// server changes up to pulledCursor are here
+func SetSyncCursors(database *sql.DB, pushedSeq int64, pulledCursor int64) error {
+    _, err := database.Exec(
+        `UPDATE sync_state SET value = CASE key
+            WHEN 'pushed_seq' THEN ? ELSE ? END
+        WHERE key IN ('pushed_seq', 'pulled_cursor')`,
+        pushedSeq, pulledCursor,
+    )
+    if err != nil {
+        return utils.LogError("failed to save sync cursors: %v", err)
+    }
+    return nil
+}
+
+// Other end of a sync, see internal/api for the HTTP one
+type SyncTransport interface {
+    Push(changes []SyncChange) (*SyncResult, error)
+    Pull(since int64, limit int) (*SyncChangeSet, error)
+}
+
+type SyncReport struct {
+    Pushed int         `json:"pushed"`
+    Pulled int         `json:"pulled"`
+    Push   *SyncResult `json:"push,omitempty"`
+    Pull   SyncResult  `json:"pull"`
+}
+
+// Push the local changes, then pull and apply everything changed on the
+// other end since the last sync
+func Sync(database *sql.DB, transport SyncTransport) (*SyncReport, error) {
+    status, err := GetSyncStatus(database)
+    if err != nil {
+        return nil, err
+    }
+    report := SyncReport{}
+
+    local, err := ListSyncChanges(database, status.PushedSeq, 0)
+    if err != nil {
+        return nil, err
+    }
+    if len(local.Changes) > 0 {
+        if report.Push, err = transport.Push(local.Changes); err != nil {
+            return nil, err
+        }
+        report.Pushed = len(local.Changes)
+        if err := ApplySyncRemaps(database, report.Push.Remapped); err != nil {
+            return nil, err
+        }
+    }
+
+    cursor := status.PulledCursor
+    for {
+        set, err := transport.Pull(cursor, DefaultSyncPageSize)
+        if err != nil {
+            return nil, err
+        }
+        result, err := ApplySyncChanges(database, set.Changes, SyncOptions{Authoritative: true})
+        if err != nil {
+            return nil, err
+        }
+        report.Pulled += len(set.Changes)
+        report.Pull.Applied += result.Applied
+        report.Pull.Conflicts = append(report.Pull.Conflicts, result.Conflicts...)
+        report.Pull.Warnings = append(report.Pull.Warnings, result.Warnings...)
+        cursor = set.Cursor
+        if !set.More {
+            break
+        }
+    }
+
+    // What was just pulled or remapped changed the seq, it's not to push back
+    if status, err = GetSyncStatus(database); err != nil {
+        return nil, err
+    }
+    if err := SetSyncCursors(database, status.Seq, cursor); err != nil {
+        return nil, err
+    }
+    slog.Info("synced", "pushed", report.Pushed, "pulled", report.Pulled)
+    return &report, nil
+}
+
+// Changes after since, oldest first, at most limit (0 for all of them)
+func ListSyncChanges(database *sql.DB, since int64, limit int) (*SyncChangeSet, error) {
+    type pending struct {
+        st     syncTable
+        id     int64
+        change SyncChange
+        values []any
+    }
+    sqlLimit := -1
+    if limit > 0 {
+        sqlLimit = limit + 1
+    }
+
+    var all []pending
+    for _, st := range syncTables {
+        sqlQuery := fmt.Sprintf(
+            `SELECT id, public_id, version, updated_at, sync_seq, %s FROM %s
+            WHERE sync_seq > ? ORDER BY sync_seq LIMIT ?`,
+            strings.Join(st.columns, ", "), st.name,
+        )
+        rows, err := database.Query(sqlQuery, since, sqlLimit)
+        if err != nil {
+            return nil, utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+        }
+        for rows.Next() {
+            p := pending{st: st, change: SyncChange{Table: st.name}, values: make([]any, len(st.columns))}
+            dest := []any{&p.id, &p.change.PublicID, &p.change.Version, &p.change.UpdatedAt, &p.change.Seq}
+            for i := range p.values {
+                dest = append(dest, &p.values[i])
+            }
+            if err := rows.Scan(dest...); err != nil {
+                rows.Close()
+                return nil, utils.LogError("failed to scan %s change: %v", st.name, err)
+            }
+            all = append(all, p)
+        }
+        err = rows.Err()
+        rows.Close()
+        if err != nil {
+            return nil, utils.LogError("failed to list %s changes: %v", st.name, err)
+        }
+    }
+
+    sqlQuery := `SELECT table_name, public_id, version, deleted_at, sync_seq
+                FROM sync_tombstones WHERE sync_seq > ? ORDER BY sync_seq LIMIT ?`
+    rows, err := database.Query(sqlQuery, since, sqlLimit)
+    if err != nil {
+        return nil, utils.LogError("rejected querry: %v, error: %v", sqlQuery, err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        p := pending{change: SyncChange{Deleted: true}}
+        err := rows.Scan(
+            &p.change.Table, &p.change.PublicID, &p.change.Version, &p.change.UpdatedAt, &p.change.Seq,
+        )
+        if err != nil {
+            return nil, utils.LogError("failed to scan tombstone: %v", err)
+        }
+        all = append(all, p)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, utils.LogError("failed to list tombstones: %v", err)
+    }
+
+    sort.Slice(all, func(i, j int) bool { return all[i].change.Seq < all[j].change.Seq })
+    set := SyncChangeSet{Changes: make([]SyncChange, 0, len(all)), Cursor: since}
+    if limit > 0 && len(all) > limit {
+        all, set.More = all[:limit], true
+    }
+    for _, p := range all {
+        if !p.change.Deleted {
+            if err := fillSyncChange(database, p.st, p.id, &p.change, p.values); err != nil {
+                return nil, err
+            }
+        }
+        set.Changes = append(set.Changes, p.change)
+        set.Cursor = p.change.Seq
+    }
+    return &set, nil
+}
+
+// Column values with references as public IDs, and the rows travelling with it
+func fillSyncChange(
+    database *sql.DB, st syncTable, id int64, change *SyncChange, values []any,
+) error {
+    change.Values = make(map[string]any, len(st.columns))
+    for i, column := range st.columns {
+        value := values[i]
+        if parent, ok := st.refs[column]; ok && value != nil {
+            publicID, err := publicIDOf(database, parent, value.(int64))
+            if err != nil {
+                return err
+            }
+            value = nil // dangling reference
+            if publicID != nil {
+                value = *publicID
+            }
+        } else if text, ok := value.([]byte); ok {
+            value = string(text)
+        }
+        change.Values[column] = value
+    }
+
+    if st.kind != "" {
+        attributes, err := GetAttributes(database, st.kind, id)
+        if err != nil {
+            return err
+        }
+        change.Attributes = &attributes
+    }
+    if st.name == "recurring_expenses" {
+        occurrences, err := crud.ListRecurringOccurrences(database, id)
+        if err != nil {
+            return err
+        }
+        for _, occurrence := range occurrences {
+            publicID, err := publicIDOf(database, "expenses", occurrence.ExpenseID)
+            if err != nil {
+                return err
+            }
+            if publicID != nil {
+                change.Occurrences = append(change.Occurrences, SyncOccurrence{
+                    DateOnly: occurrence.DateOnly, ExpensePublicID: *publicID,
+                })
+            }
+        }
+    }
+    return nil
+}
+
+// Sync ID of a row, or of its tombstone, nil when none
+func publicIDOf(database *sql.DB, table string, id int64) (*string, error) {
+    var publicID string
+    err := database.QueryRow("SELECT public_id FROM "+table+" WHERE id = ?", id).Scan(&publicID)
+    if errors.Is(err, sql.ErrNoRows) {
+        err = database.QueryRow(
+            "SELECT public_id FROM sync_tombstones WHERE table_name = ? AND row_id = ?", table, id,
+        ).Scan(&publicID)
+    }
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, utils.LogError("failed to get public ID of %s (ID: %d): %v", table, id, err)
+    }
+    return &publicID, nil
+}
+
+// Give the rows merged on the server their server public ID
+func ApplySyncRemaps(database db.Querier, remaps []SyncRemap) error {
+    for _, remap := range remaps {
+        if _, _, ok := findSyncTable(remap.Table); !ok {
+            return utils.ValidationError([]string{"remapped"}, "unknown sync table: %q", remap.Table)
+        }
+        if err := db.ValidPublicID(remap.ServerPublicID); err != nil {
+            return err
+        }
+        _, err := database.Exec(
+            "UPDATE "+remap.Table+" SET public_id = ? WHERE public_id = ?",
+            remap.ServerPublicID, remap.PublicID,
+        )
+        if err != nil {
+            return utils.LogError(
+                "failed to remap %s %s to %s: %v", remap.Table, remap.PublicID, remap.ServerPublicID, err,
+            )
+        }
+    }
+    return nil
+}
+
+// Apply changes from another database. The whole set is checked first, a
+// malformed one changes nothing, then written in one transaction: a change
+// failing to apply rolls back the others. Rows referenced by other changes
+// are written first, and deleted last.
+func ApplySyncChanges(database db.Querier, changes []SyncChange, options SyncOptions) (
+    *SyncResult, error,
+) {
+    if err := ValidateSyncChanges(changes); err != nil {
+        return nil, err
+    }
+    order := func(change SyncChange) int {
+        _, i, _ := findSyncTable(change.Table)
+        if change.Deleted {
+            return 2*len(syncTables) - i
+        }
+        return i
+    }
+    sorted := slices.Clone(changes)
+    sort.SliceStable(sorted, func(i, j int) bool { return order(sorted[i]) < order(sorted[j]) })
+
+    applier := syncApplier{options: options, result: &SyncResult{}}
+    err := db.InTx(database, func(tx db.Querier) error {
+        applier.database = tx
+        for _, change := range sorted {
+            st, _, _ := findSyncTable(change.Table)
+            var err error
+            if change.Deleted {
+                err = applier.delete(st, change)
+            } else {
+                err = applier.upsert(st, change)
+            }
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    slog.Info(
+        "sync changes applied",
+        "applied", applier.result.Applied, "changes", len(changes),
+        "conflicts", len(applier.result.Conflicts),
+    )
+    return applier.result, nil
+}
+
+// Field of the validation errors of pushed changes
+var syncChangesFields = []string{"changes"}
+
+// Tables, public IDs, times and columns of the changes, before touching anything
+func ValidateSyncChanges(changes []SyncChange) error {
+    for _, change := range changes {
+        st, _, ok := findSyncTable(change.Table)
+        switch {
+        case !ok:
+            return utils.ValidationError(syncChangesFields, "unknown sync table: %q", change.Table)
+        case db.ValidPublicID(change.PublicID) != nil:
+            return utils.ValidationError(
+                syncChangesFields, "invalid public ID in %s: %q", change.Table, change.PublicID,
+            )
+        case change.Version <= 0:
+            return utils.ValidationError(
+                syncChangesFields, "invalid version of %s %s", change.Table, change.PublicID,
+            )
+        }
+        if _, err := time.Parse(time.RFC3339, change.UpdatedAt); err != nil {
+            return utils.ValidationError(
+                syncChangesFields,
+                "invalid time of %s %s: %q", change.Table, change.PublicID, change.UpdatedAt,
+            )
+        }
+        for column, value := range change.Values {
+            if !slices.Contains(st.columns, column) {
+                return utils.ValidationError(
+                    syncChangesFields, "unknown column %s.%s", change.Table, column,
+                )
+            }
+            switch value.(type) {
+            case nil, string, float64, int64, bool:
+            default:
+                return utils.ValidationError(
+                    syncChangesFields, "invalid value of %s.%s: %v", change.Table, column, value,
+                )
+            }
+            if _, isRef := st.refs[column]; isRef && value != nil {
+                if publicID, ok := value.(string); !ok || db.ValidPublicID(publicID) != nil {
+                    return utils.ValidationError(
+                        syncChangesFields, "%s.%s must be a public ID", change.Table, column,
+                    )
+                }
+            }
+        }
+    }
+    return nil
+}
+
+type syncApplier struct {
+    database db.Querier // transaction of the change set
+    options  SyncOptions
+    result   *SyncResult
+}
+
+type syncRow struct {
+    id        int64
+    publicID  string
+    version   int64
+    updatedAt string
+}
+
+type syncTombstone struct {
+    table     string
+    rowID     int64
+    publicID  string
+    version   int64
+    deletedAt string
+    values    map[string]any
+}
+
+func (a *syncApplier) conflict(st syncTable, publicID string, reason string) {
+    a.result.Conflicts = append(a.result.Conflicts, SyncConflict{st.name, publicID, reason})
+}
+
+func (a *syncApplier) warn(format string, args ...any) {
+    a.result.Warnings = append(a.result.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (a *syncApplier) upsert(st syncTable, change SyncChange) error {
+    values, ok, err := a.localValues(st, change)
+    if err != nil || !ok {
+        return err
+    }
+
+    row, err := a.findRow(st, change.PublicID)
+    if err != nil {
+        return err
+    }
+    var tombstone *syncTombstone
+    if row == nil {
+        if tombstone, err = a.findTombstone(change.PublicID); err != nil {
+            return err
+        }
+        if tombstone != nil && !a.options.Authoritative && !isLater(change.UpdatedAt, tombstone.deletedAt) {
+            a.conflict(st, change.PublicID, SyncConflictDeleted)
+            return a.touchTombstone(change.PublicID)
+        }
+    }
+    if row == nil && tombstone == nil {
+        if row, err = a.findByUniqueKey(st, values); err != nil {
+            return err
+        }
+        if row != nil && a.options.Authoritative {
+            // Merged on the server, the server public ID wins
+            if err := ApplySyncRemaps(a.database, []SyncRemap{{st.name, row.publicID, change.PublicID}}); err != nil {
+                return err
+            }
+            row.publicID = change.PublicID
+        } else if row != nil {
+            if err := a.addAlias(st, change.PublicID, row.publicID); err != nil {
+                return err
+            }
+            a.result.Remapped = append(a.result.Remapped, SyncRemap{st.name, change.PublicID, row.publicID})
+        }
+    }
+
+    version := change.Version
+    if row != nil {
+        if !a.options.Authoritative {
+            if !isLater(change.UpdatedAt, row.updatedAt) {
+                a.conflict(st, change.PublicID, SyncConflictNewer)
+                return a.touchRow(st, row.id)
+            }
+            version = max(row.version+1, change.Version)
+        } else if row.version == change.Version && row.updatedAt == change.UpdatedAt {
+            return nil // already there, likely pushed from here
+        }
+    }
+
+    var id int64
+    if row == nil {
+        var rowID any // a row deleted earlier comes back with its ID
+        if tombstone != nil {
+            rowID = tombstone.rowID
+        }
+        id, err = a.insertRow(st, rowID, change.PublicID, version, change.UpdatedAt, values)
+    } else {
+        id = row.id
+        err = a.updateRow(st, id, version, change.UpdatedAt, values)
+    }
+    if isConstraintError(err) {
+        a.conflict(st, change.PublicID, SyncConflictRejected)
+        a.warn("%s %s rejected: %v", st.name, change.PublicID, err)
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if tombstone != nil {
+        if err := a.deleteTombstone(change.PublicID); err != nil {
+            return err
+        }
+    }
+
+    if err := a.applyOwnedRows(st, id, change); err != nil {
+        return err
+    }
+    // Owned rows bumped the version, back to the one applied
+    _, err = a.database.Exec(
+        "UPDATE "+st.name+" SET version = ?, updated_at = ? WHERE id = ? AND version != ?",
+        version, change.UpdatedAt, id, version,
+    )
+    if err != nil {
+        return utils.LogError("failed to set version of %s (ID: %d): %v", st.name, id, err)
+    }
+    a.result.Applied++
+    return nil
+}
+
+// Values ready to write, references translated to local IDs. ok is false
+// when the change can't be applied, with a conflict reported.
+func (a *syncApplier) localValues(st syncTable, change SyncChange) (map[string]any, bool, error) {
+    values := make(map[string]any, len(change.Values))
+    for column, value := range change.Values {
+        parent, isRef := st.refs[column]
+        if !isRef || value == nil {
+            values[column] = value
+            continue
+        }
+        parentTable, _, _ := findSyncTable(parent)
+        row, err := a.findRow(parentTable, value.(string))
+        if err != nil {
+            return nil, false, err
+        }
+        if row != nil {
+            values[column] = row.id
+            continue
+        }
+
+        tombstone, err := a.findTombstone(value.(string))
+        if err != nil {
+            return nil, false, err
+        }
+        switch {
+        case tombstone == nil:
+            a.conflict(st, change.PublicID, SyncConflictUnknown)
+            return nil, false, nil
+        case column == st.owner:
+            a.conflict(st, change.PublicID, SyncConflictOrphan)
+            return nil, false, nil
+        }
+        if err := a.resurrect(tombstone); err != nil {
+            return nil, false, err
+        }
+        values[column] = tombstone.rowID
+    }
+    return values, true, nil
+}
+
+// Row by public ID, or by the alias left when it was merged
+func (a *syncApplier) findRow(st syncTable, publicID string) (*syncRow, error) {
+    row, err := a.queryRow(st, "public_id = ?", publicID)
+    if row != nil || err != nil {
+        return row, err
+    }
+    var target string
+    err = a.database.QueryRow(
+        "SELECT public_id FROM sync_aliases WHERE alias = ? AND table_name = ?", publicID, st.name,
+    ).Scan(&target)
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, utils.LogError("failed to look for sync alias %s: %v", publicID, err)
+    }
+    return a.queryRow(st, "public_id = ?", target)
+}
+
+func (a *syncApplier) findByUniqueKey(st syncTable, values map[string]any) (*syncRow, error) {
+    if len(st.unique) == 0 {
+        return nil, nil
+    }
+    conditions := make([]string, 0, len(st.unique))
+    args := make([]any, 0, len(st.unique))
+    for _, column := range st.unique {
+        if values[column] == nil {
+            return nil, nil
+        }
+        conditions = append(conditions, column+" = ?")
+        args = append(args, values[column])
+    }
+    return a.queryRow(st, strings.Join(conditions, " AND "), args...)
+}
+
+func (a *syncApplier) queryRow(st syncTable, where string, args ...any) (*syncRow, error) {
+    var row syncRow
+    err := a.database.QueryRow(
+        "SELECT id, public_id, version, updated_at FROM "+st.name+" WHERE "+where, args...,
+    ).Scan(&row.id, &row.publicID, &row.version, &row.updatedAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, utils.LogError("failed to look for %s row: %v", st.name, err)
+    }
+    return &row, nil
+}
+
+func (a *syncApplier) insertRow(
+    st syncTable, id any, publicID string, version int64, updatedAt string, values map[string]any,
+) (int64, error) {
+    columns := []string{"id", "public_id", "version", "updated_at"}
+    args := []any{id, publicID, version, updatedAt}
+    for _, column := range st.columns {
+        if value, ok := values[column]; ok {
+            columns = append(columns, column)
+            args = append(args, value)
+        }
+    }
+    res, err := a.database.Exec(
+        fmt.Sprintf(
+            "INSERT INTO %s(%s) VALUES (?%s)",
+            st.name, strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)-1),
+        ),
+        args...,
+    )
+    if err != nil {
+        return 0, fmt.Errorf("unable to insert %s %s: %w", st.name, publicID, err)
+    }
+    return res.LastInsertId()
+}
+
+func (a *syncApplier) updateRow(
+    st syncTable, id int64, version int64, updatedAt string, values map[string]any,
+) error {
+    assignments := []string{"version = ?", "updated_at = ?"}
+    args := []any{version, updatedAt}
+    for _, column := range st.columns {
+        if value, ok := values[column]; ok {
+            assignments = append(assignments, column+" = ?")
+            args = append(args, value)
+        }
+    }
+    _, err := a.database.Exec(
+        "UPDATE "+st.name+" SET "+strings.Join(assignments, ", ")+" WHERE id = ?",
+        append(args, id)...,
+    )
+    if err != nil {
+        return fmt.Errorf("unable to update %s (ID: %d): %w", st.name, id, err)
+    }
+    return nil
+}
+
+// Attributes are replaced, occurrences only added. A value that no longer
+// fits (custom field deleted or changed meanwhile) is only a warning.
+func (a *syncApplier) applyOwnedRows(st syncTable, id int64, change SyncChange) error {
+    if st.kind != "" && change.Attributes != nil {
+        if err := a.replaceAttributes(st.kind, id, *change.Attributes); err != nil {
+            a.warn("attributes of %s %s not applied: %v", st.name, change.PublicID, err)
+        }
+    }
+
+    if len(change.Occurrences) == 0 {
+        return nil
+    }
+    existing, err := crud.ListRecurringOccurrences(a.database, id)
+    if err != nil {
+        return err
+    }
+    expenses, _, _ := findSyncTable("expenses")
+    for _, occurrence := range change.Occurrences {
+        if slices.ContainsFunc(existing, func(o db.RecurringOccurrence) bool {
+            return o.DateOnly == occurrence.DateOnly
+        }) {
+            continue
+        }
+        expense, err := a.findRow(expenses, occurrence.ExpensePublicID)
+        if err != nil {
+            return err
+        }
+        if expense == nil {
+            a.warn(
+                "occurrence %s of %s skipped, its expense is unknown",
+                occurrence.DateOnly, change.PublicID,
+            )
+            continue
+        }
+        if err := crud.CreateRecurringOccurrence(a.database, db.RecurringOccurrence{
+            RecurringExpenseID: id, DateOnly: occurrence.DateOnly, ExpenseID: expense.id,
+        }); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (a *syncApplier) replaceAttributes(kind string, id int64, attributes Attributes) error {
+    current, err := GetAttributes(a.database, kind, id)
+    if err != nil {
+        return err
+    }
+    var removed []string
+    for _, tag := range current.Tags {
+        if !slices.ContainsFunc(attributes.Tags, func(name string) bool {
+            return strings.EqualFold(name, tag)
+        }) {
+            removed = append(removed, tag)
+        }
+    }
+    if err := RemoveTags(a.database, kind, id, removed); err != nil {
+        return err
+    }
+
+    wanted := Attributes{Tags: attributes.Tags, Fields: make(map[string]string)}
+    for name := range current.Fields {
+        wanted.Fields[name] = "" // unset unless given
+    }
+    for name, value := range attributes.Fields {
+        field, err := crud.GetCustomFieldByName(a.database, kind, name)
+        if err != nil {
+            return err
+        }
+        if field == nil {
+            a.warn("unknown %s custom field %q skipped", kind, name)
+            continue
+        }
+        wanted.Fields[field.Name] = value
+    }
+    return ApplyAttributes(a.database, kind, id, wanted)
+}
+
+func (a *syncApplier) delete(st syncTable, change SyncChange) error {
+    row, err := a.findRow(st, change.PublicID)
+    if err != nil || row == nil {
+        return err // already gone
+    }
+    if !a.options.Authoritative && isLater(row.updatedAt, change.UpdatedAt) {
+        a.conflict(st, change.PublicID, SyncConflictNewer)
+        return a.touchRow(st, row.id)
+    }
+
+    referenced, err := a.isReferenced(st, row.id)
+    if err != nil {
+        return err
+    }
+    if referenced {
+        if a.options.Authoritative {
+            a.warn("%s %s kept, still referenced here", st.name, change.PublicID)
+            return nil
+        }
+        a.conflict(st, change.PublicID, SyncConflictReferenced)
+        return a.touchRow(st, row.id)
+    }
+
+    for _, child := range syncTables {
+        if child.owner != "" && child.refs[child.owner] == st.name {
+            _, err := a.database.Exec("DELETE FROM "+child.name+" WHERE "+child.owner+" = ?", row.id)
+            if err != nil {
+                return utils.LogError("failed to delete %s of %s (ID: %d): %v", child.name, st.name, row.id, err)
+            }
+        }
+    }
+    if _, err := a.database.Exec("DELETE FROM "+st.name+" WHERE id = ?", row.id); err != nil {
+        return utils.LogError("failed to delete %s (ID: %d): %v", st.name, row.id, err)
+    }
+    // The tombstone keeps the time of the delete on the other side
+    _, err = a.database.Exec(
+        "UPDATE sync_tombstones SET version = ?, deleted_at = ? WHERE public_id = ?",
+        change.Version, change.UpdatedAt, row.publicID,
+    )
+    if err != nil {
+        return utils.LogError("failed to update tombstone %s: %v", row.publicID, err)
+    }
+    a.result.Applied++
+    return nil
+}
+
+// Referenced by a row other than the ones it owns
+func (a *syncApplier) isReferenced(st syncTable, id int64) (bool, error) {
+    for _, other := range syncTables {
+        for column, parent := range other.refs {
+            if parent != st.name || column == other.owner {
+                continue
+            }
+            var count int
+            err := a.database.QueryRow(
+                "SELECT COUNT(*) FROM "+other.name+" WHERE "+column+" = ?", id,
+            ).Scan(&count)
+            if err != nil {
+                return false, utils.LogError("failed to count references to %s: %v", st.name, err)
+            }
+            if count > 0 {
+                return true, nil
+            }
+        }
+    }
+    return false, nil
+}
+
+func (a *syncApplier) findTombstone(publicID string) (*syncTombstone, error) {
+    return a.queryTombstone("public_id = ?", publicID)
+}
+
+func (a *syncApplier) queryTombstone(where string, args ...any) (*syncTombstone, error) {
+    var tombstone syncTombstone
+    var values string
+    err := a.database.QueryRow(
+        `SELECT table_name, row_id, public_id, version, deleted_at, row_values
+        FROM sync_tombstones WHERE `+where, args...,
+    ).Scan(
+        &tombstone.table, &tombstone.rowID, &tombstone.publicID,
+        &tombstone.version, &tombstone.deletedAt, &values,
+    )
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, utils.LogError("failed to look for tombstone: %v", err)
+    }
+    if err := json.Unmarshal([]byte(values), &tombstone.values); err != nil {
+        return nil, utils.IntegrityError("invalid tombstone %s: %v", tombstone.publicID, err)
+    }
+    return &tombstone, nil
+}
+
+// Bring back a deleted row from its tombstone, with the rows it references
+func (a *syncApplier) resurrect(tombstone *syncTombstone) error {
+    st, _, ok := findSyncTable(tombstone.table)
+    if !ok {
+        return utils.IntegrityError("unknown sync table in tombstone: %q", tombstone.table)
+    }
+    values := make(map[string]any, len(st.columns))
+    for _, column := range st.columns {
+        value := tombstone.values[column]
+        if parent, isRef := st.refs[column]; isRef && value != nil {
+            id := int64(value.(float64))
+            var count int
+            err := a.database.QueryRow("SELECT COUNT(*) FROM "+parent+" WHERE id = ?", id).Scan(&count)
+            if err != nil {
+                return utils.LogError("failed to look for %s (ID: %d): %v", parent, id, err)
+            }
+            if count == 0 {
+                parentTombstone, err := a.queryTombstone("table_name = ? AND row_id = ?", parent, id)
+                if err != nil {
+                    return err
+                }
+                if parentTombstone == nil {
+                    return utils.IntegrityError(
+                        "can't bring back %s %s, %s (ID: %d) is gone", st.name, tombstone.publicID, parent, id,
+                    )
+                }
+                if err := a.resurrect(parentTombstone); err != nil {
+                    return err
+                }
+            }
+            value = id
+        }
+        values[column] = value
+    }
+
+    now := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+    _, err := a.insertRow(st, tombstone.rowID, tombstone.publicID, tombstone.version+1, now, values)
+    if err != nil {
+        return utils.LogError("failed to bring back %s %s: %v", st.name, tombstone.publicID, err)
+    }
+    if err := a.deleteTombstone(tombstone.publicID); err != nil {
+        return err
+    }
+    a.warn("%s %s deleted elsewhere, brought back as it is still referenced", st.name, tombstone.publicID)
+    return nil
+}
+
+func (a *syncApplier) addAlias(st syncTable, alias string, publicID string) error {
+    _, err := a.database.Exec(
+        "INSERT OR REPLACE INTO sync_aliases(alias, table_name, public_id) VALUES (?, ?, ?)",
+        alias, st.name, publicID,
+    )
+    if err != nil {
+        return utils.LogError("failed to record sync alias %s: %v", alias, err)
+    }
+    return nil
+}
+
+// A no-op update bumps the version and the seq: the row is sent again
+func (a *syncApplier) touchRow(st syncTable, id int64) error {
+    if _, err := a.database.Exec("UPDATE "+st.name+" SET version = version WHERE id = ?", id); err != nil {
+        return utils.LogError("failed to touch %s (ID: %d): %v", st.name, id, err)
+    }
+    return nil
+}
+
+func (a *syncApplier) touchTombstone(publicID string) error {
+    _, err := a.database.Exec(
+        `UPDATE sync_state SET value = value + 1 WHERE key = 'seq';`,
+    )
+    if err == nil {
+        _, err = a.database.Exec(
+            `UPDATE sync_tombstones
+            SET sync_seq = (SELECT value FROM sync_state WHERE key = 'seq')
+            WHERE public_id = ?`,
+            publicID,
+        )
+    }
+    if err != nil {
+        return utils.LogError("failed to touch tombstone %s: %v", publicID, err)
+    }
+    return nil
+}
+
+func (a *syncApplier) deleteTombstone(publicID string) error {
+    if _, err := a.database.Exec("DELETE FROM sync_tombstones WHERE public_id = ?", publicID); err != nil {
+        return utils.LogError("failed to delete tombstone %s: %v", publicID, err)
+    }
+    return nil
+}
+
+// RFC 3339 times, false on a tie
+func isLater(a string, b string) bool {
+    timeA, errA := time.Parse(time.RFC3339, a)
+    timeB, errB := time.Parse(time.RFC3339, b)
+    if errA != nil || errB != nil {
+        return a > b
+    }
+    return timeA.After(timeB)
+}
+
+func isConstraintError(err error) bool {
+    var sqliteErr sqlite3.Error
+    return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint
+}
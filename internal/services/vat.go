@@ -0,0 +1,292 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+// VAT to reclaim over a period. LineItem.Total is tax inclusive, so for each
+// rate: net = total / (1 + rate/100) and tax = total - net.
+type VATReport struct {
+    From        time.Time  `json:"from"`
+    To          time.Time  `json:"to"` // exclusive
+    Groups      []VATGroup `json:"groups"`
+    Totals      []VATGroup `json:"totals"` // per currency and rate, Type is empty
+    // Expense types flagged as not VAT recoverable, only reported for reference
+    Excluded    []VATGroup `json:"excluded"`
+    // Included in the groups, but finance needs a valid receipt to claim them
+    Flagged     []VATFlag  `json:"flagged"`
+    GeneratedAt time.Time  `json:"generated_at"`
+}
+
+type VATGroup struct {
+    Currency string  `json:"currency"`
+    Type     string  `json:"type,omitempty"`
+    TypeKey  string  `json:"type_key,omitempty"` // see ReportExpense.TypeKey
+    TaxeRate float64 `json:"taxe_rate"`
+    Total    float64 `json:"total"`
+    Net      float64 `json:"net"`
+    Tax      float64 `json:"tax"`
+}
+
+type VATFlag struct {
+    ExpenseID int64     `json:"expense_id"`
+    DateTime  time.Time `json:"date_time"`
+    Type      string    `json:"type"`
+    TypeKey   string    `json:"type_key,omitempty"`
+    Currency  string    `json:"currency"`
+    Tax       float64   `json:"tax"`
+    Reason    string    `json:"reason"`
+    // Of a Reason that is a validation error, to translate it
+    Violations []utils.Violation `json:"violations,omitempty"`
+}
+
+type vatKey struct {
+    currency string
+    typeName string
+    rate     float64
+}
+
+// Expenses dated in [from, to), on their local date (see db.Expense.LocalDate)
+func BuildVATReport(database *sql.DB, from time.Time, to time.Time) (*VATReport, error) {
+    if !from.Before(to) {
+        return nil, utils.ValidationError([]string{"from", "to"}, "invalid VAT period: %v to %v", from, to)
+    }
+
+    expenseTypes, err := crud.ListExpenseTypes(database)
+    if err != nil {
+        return nil, err
+    }
+    typesByID := make(map[int64]db.ExpenseType, len(expenseTypes))
+    typeKeys := make(map[int64]string, len(expenseTypes))
+    for _, et := range expenseTypes {
+        typesByID[et.ID] = et
+        typeKeys[et.ID] = et.StandardKey()
+    }
+
+    expenses, err := crud.ListExpenses(database)
+    if err != nil {
+        return nil, err
+    }
+
+    groups := make(map[vatKey]*VATGroup)
+    excluded := make(map[vatKey]*VATGroup)
+    report := VATReport{
+        From:        from,
+        To:          to,
+        Flagged:     make([]VATFlag, 0),
+        GeneratedAt: time.Now().UTC(),
+    }
+    fromDate, toDate := from.Format(time.DateOnly), to.Format(time.DateOnly)
+    for _, expense := range expenses {
+        if date := expense.LocalDate(); date < fromDate || date >= toDate {
+            continue
+        }
+        expenseType, ok := typesByID[expense.TypeID]
+        if !ok {
+            return nil, utils.IntegrityError(
+                "expense (ID: %d) has an unknown expense type (ID: %d)",
+                expense.ID, expense.TypeID,
+            )
+        }
+        lineItems, err := crud.ListLineItemsByExpenseID(database, expense.ID)
+        if err != nil {
+            return nil, err
+        }
+        sums, err := lineItems.SumByTaxeRates()
+        if err != nil {
+            return nil, err
+        }
+
+        target := groups
+        if !expenseType.VATRecoverable {
+            target = excluded
+        }
+        var expenseTax float64
+        for rate, total := range sums {
+            key := vatKey{expense.Currency, expenseType.Name, rate}
+            group, ok := target[key]
+            if !ok {
+                group = &VATGroup{
+                    Currency: key.currency, Type: key.typeName, TypeKey: typeKeys[expenseType.ID],
+                    TaxeRate: rate,
+                }
+                target[key] = group
+            }
+            net := total / (1 + rate/100)
+            group.Total += total
+            group.Net += net
+            group.Tax += total - net
+            expenseTax += total - net
+        }
+
+        if !expenseType.VATRecoverable || expenseTax == 0 {
+            continue
+        }
+        receipts, err := crud.ListReceiptsByExpenseID(database, expense.ID)
+        if err != nil {
+            return nil, err
+        }
+        if err := expense.PreReportValid(receipts); err != nil {
+            report.Flagged = append(report.Flagged, VATFlag{
+                ExpenseID:  expense.ID,
+                DateTime:   expense.LocalTime(),
+                Type:       expenseType.Name,
+                TypeKey:    typeKeys[expenseType.ID],
+                Currency:   expense.Currency,
+                Tax:        roundCents(expenseTax),
+                Reason:     err.Error(),
+                Violations: utils.ErrorViolations(err),
+            })
+        }
+    }
+
+    report.Groups = sortedVATGroups(groups)
+    report.Excluded = sortedVATGroups(excluded)
+
+    totals := make(map[vatKey]*VATGroup)
+    for _, group := range report.Groups {
+        key := vatKey{currency: group.Currency, rate: group.TaxeRate}
+        if _, ok := totals[key]; !ok {
+            totals[key] = &VATGroup{Currency: group.Currency, TaxeRate: group.TaxeRate}
+        }
+        totals[key].Total += group.Total
+        totals[key].Net += group.Net
+        totals[key].Tax += group.Tax
+    }
+    report.Totals = sortedVATGroups(totals)
+
+    sort.Slice(report.Flagged, func(i, j int) bool {
+        return report.Flagged[i].DateTime.Before(report.Flagged[j].DateTime)
+    })
+    return &report, nil
+}
+
+// Amounts are only rounded to cents once summed
+func sortedVATGroups(groups map[vatKey]*VATGroup) []VATGroup {
+    result := make([]VATGroup, 0, len(groups))
+    for _, group := range groups {
+        group.Total = roundCents(group.Total)
+        group.Net = roundCents(group.Net)
+        group.Tax = roundCents(group.Tax)
+        result = append(result, *group)
+    }
+    sort.Slice(result, func(i, j int) bool {
+        a, b := result[i], result[j]
+        if a.Currency != b.Currency {
+            return a.Currency < b.Currency
+        }
+        if a.Type != b.Type {
+            return a.Type < b.Type
+        }
+        return a.TaxeRate < b.TaxeRate
+    })
+    return result
+}
+
+func roundCents(value float64) float64 {
+    return math.Round(value*100) / 100
+}
+
+// See WriteSessionReport for the formats
+func WriteVATReport(w io.Writer, report *VATReport, format string, p *i18n.Printer) error {
+    switch format {
+    case ReportFormatText:
+        _, err := io.WriteString(w, strings.Join(report.Lines(p), "\n")+"\n")
+        if err != nil {
+            return utils.LogError("failed to write text VAT report: %v", err)
+        }
+        return nil
+    case ReportFormatJSON:
+        encoder := json.NewEncoder(w)
+        encoder.SetIndent("", "  ")
+        if err := encoder.Encode(report); err != nil {
+            return utils.LogError("failed to write json VAT report: %v", err)
+        }
+        return nil
+    case ReportFormatCSV:
+        return report.writeCSV(w, p)
+    case ReportFormatPDF:
+        return writeSimplePDF(w, report.Lines(p))
+    default:
+        return utils.ValidationError([]string{"format"}, "unknown report format: %s", format)
+    }
+}
+
+func (r VATReport) Lines(p *i18n.Printer) []string {
+    lines := []string{
+        p.T("vat.title", p.Date(r.From), p.Date(r.To.AddDate(0, 0, -1))),
+        "",
+        p.T("vat.by_type"),
+    }
+    lines = append(lines, vatGroupLines(p, r.Groups)...)
+    lines = append(lines, "", p.T("report.totals"))
+    lines = append(lines, vatGroupLines(p, r.Totals)...)
+
+    if len(r.Flagged) > 0 {
+        lines = append(lines, "", p.T("vat.flagged"))
+        for _, f := range r.Flagged {
+            reason := f.Reason
+            if len(f.Violations) > 0 {
+                reason = strings.Join(p.Violations(f.Violations), "; ")
+            }
+            lines = append(lines, "  "+p.T(
+                "vat.flag", f.ExpenseID, p.Date(f.DateTime), p.TypeName(f.TypeKey, f.Type),
+                p.Number(f.Tax, 2), f.Currency, reason,
+            ))
+        }
+    }
+    if len(r.Excluded) > 0 {
+        lines = append(lines, "", p.T("vat.excluded"))
+        lines = append(lines, vatGroupLines(p, r.Excluded)...)
+    }
+    lines = append(lines, "", p.T("report.generated", p.DateTime(r.GeneratedAt)))
+    return lines
+}
+
+func vatGroupLines(p *i18n.Printer, groups []VATGroup) []string {
+    if len(groups) == 0 {
+        return []string{"  " + p.T("report.none")}
+    }
+    lines := make([]string, 0, len(groups))
+    for _, g := range groups {
+        lines = append(lines, "  "+p.T(
+            "vat.group", g.Currency, p.TypeName(g.TypeKey, g.Type), p.Percent(g.TaxeRate),
+            p.Number(g.Total, 2), p.Number(g.Net, 2), p.Number(g.Tax, 2),
+        ))
+    }
+    return lines
+}
+
+// Recoverable groups only, flagged expenses are left to the text report
+func (r VATReport) writeCSV(w io.Writer, p *i18n.Printer) error {
+    writer := csv.NewWriter(w)
+    writer.Comma = p.CSVComma()
+    records := [][]string{{"currency", "type", "taxe_rate", "total", "net", "tax"}}
+    for _, g := range r.Groups {
+        records = append(records, []string{
+            g.Currency,
+            p.TypeName(g.TypeKey, g.Type),
+            p.Decimal(g.TaxeRate, -1),
+            p.Decimal(g.Total, 2),
+            p.Decimal(g.Net, 2),
+            p.Decimal(g.Tax, 2),
+        })
+    }
+    if err := writer.WriteAll(records); err != nil {
+        return utils.LogError("failed to write csv VAT report: %v", err)
+    }
+    return nil
+}
@@ -3,17 +3,14 @@ package utils
 import (
 	"errors"
 	"fmt"
-    "log"
-	"runtime"
+	"log/slog"
 )
 
 
+// Internal error, see errors.go for the ones of a kind. The returned error
+// carries the whole message, the logged one has the sensitive fields of its
+// arguments and the user values masked (see logging.Redact)
 func LogError(format string, args ...interface{}) error {
-    errMessage := fmt.Sprintf(format, args...)
-
-    // Log the error
-    pc, fn, line, _ := runtime.Caller(1)
-    log.Printf("[error] %s:%d\n\t[call] %s:\n\t[msg] %s\n", fn, line, runtime.FuncForPC(pc).Name(), errMessage)
-
-    return errors.New(errMessage)
+    logRedacted(1, slog.LevelError, format, args)
+    return errors.New(fmt.Sprintf(format, args...))
 }
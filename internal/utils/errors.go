@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+    "log/slog"
+    "slices"
+
+	"github.com/craftidev/expenseflow/internal/logging"
+)
+
+
+// Kinds of errors a caller can act on, compared with errors.Is:
+//   errors.Is(err, utils.ErrNotFound)
+// Errors of no kind (LogError) are internal ones: a bug, a broken disk...
+var (
+    ErrNotFound   = errors.New("not found")
+    ErrValidation = errors.New("validation failed")
+    ErrConflict   = errors.New("conflict")          // UNIQUE value already used
+    ErrReferenced = errors.New("still referenced")  // delete of a row others point to
+    ErrIntegrity  = errors.New("integrity breach")  // stored data not matching the rules
+)
+
+// Stable codes of the kinds, for the API clients to branch on and localize
+const (
+    CodeNotFound   = "not_found"
+    CodeValidation = "validation_failed"
+    CodeConflict   = "conflict"
+    CodeReferenced = "referenced"
+    CodeIntegrity  = "integrity_breach"
+    CodeInternal   = "internal"
+)
+
+var kindCodes = map[error]string{
+    ErrNotFound:   CodeNotFound,
+    ErrValidation: CodeValidation,
+    ErrConflict:   CodeConflict,
+    ErrReferenced: CodeReferenced,
+    ErrIntegrity:  CodeIntegrity,
+}
+
+// Error of a kind, errors.As gives the violations of a validation error
+type Error struct {
+    Kind       error // one of the Err* kinds
+    Message    string
+    Violations []Violation // of a validation error, see Validator
+    Err        error       // cause, if any
+}
+
+func (e *Error) Error() string {
+    return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+    return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+    return e.Err
+}
+
+func (e *Error) Code() string {
+    if code, ok := kindCodes[e.Kind]; ok {
+        return code
+    }
+    return CodeInternal
+}
+
+// Code of the first Error in err's chain, CodeInternal without one
+func ErrorCode(err error) string {
+    var typed *Error
+    if errors.As(err, &typed) {
+        return typed.Code()
+    }
+    return CodeInternal
+}
+
+// Kind of a code, for an error received from the API. Nil for CodeInternal or
+// an unknown code.
+func CodeKind(code string) error {
+    for kind, kindCode := range kindCodes {
+        if kindCode == code {
+            return kind
+        }
+    }
+    return nil
+}
+
+// Invalid fields of a validation error, nil for any other error
+func ErrorFields(err error) []string {
+    var fields []string
+    for _, violation := range ErrorViolations(err) {
+        if !slices.Contains(fields, violation.Field) {
+            fields = append(fields, violation.Field)
+        }
+    }
+    return fields
+}
+
+// Constructors of the kinds, logged like LogError
+
+func NotFoundError(format string, args ...interface{}) error {
+    return newError(ErrNotFound, nil, nil, format, args)
+}
+
+// A violation of code ViolationInvalid for each field, see Validator to
+// report several rules
+func ValidationError(fields []string, format string, args ...interface{}) error {
+    return newError(ErrValidation, fields, nil, format, args)
+}
+
+func ConflictError(format string, args ...interface{}) error {
+    return newError(ErrConflict, nil, nil, format, args)
+}
+
+func ReferencedError(format string, args ...interface{}) error {
+    return newError(ErrReferenced, nil, nil, format, args)
+}
+
+func IntegrityError(format string, args ...interface{}) error {
+    return newError(ErrIntegrity, nil, nil, format, args)
+}
+
+// Error of kind caused by cause (a driver error...). A nil kind gives an
+// internal error, still wrapping cause.
+func WrapError(kind error, cause error, format string, args ...interface{}) error {
+    return newError(kind, nil, cause, format, args)
+}
+
+func newError(kind error, fields []string, cause error, format string, args []interface{}) *Error {
+    logRedacted(2, levelOf(kind), format, args)
+    typed := &Error{Kind: kind, Message: fmt.Sprintf(format, args...), Err: cause}
+    for _, field := range fields {
+        typed.Violations = append(
+            typed.Violations, Violation{Field: field, Code: ViolationInvalid, Message: typed.Message},
+        )
+    }
+    return typed
+}
+
+// A rejected input is the caller's business, not a failure of the app
+func levelOf(kind error) slog.Level {
+    if kind == ErrValidation {
+        return slog.LevelWarn
+    }
+    return slog.LevelError
+}
+
+// skip frames above the caller of logRedacted are skipped, so that the
+// record points at the code returning the error
+func logRedacted(skip int, level slog.Level, format string, args []interface{}) {
+    redactedArgs := make([]interface{}, len(args))
+    for i, arg := range args {
+        redactedArgs[i] = logging.Redact(arg)
+    }
+    logging.Log(skip+1, level, fmt.Sprintf(format, redactedArgs...))
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/craftidev/expenseflow/internal/logging"
+)
+
+
+// Validation reporting every broken rule of a value, not only the first one,
+// so that a form can point at each field:
+//   v := utils.Validator{}
+//   v.Required("name", c.Name != "")
+//   v.MaxLength("name", c.Name, 100)
+//   return v.Err()
+// The error is of kind ErrValidation, see ErrorViolations.
+
+// Codes of the violations, stable like the error codes
+const (
+    ViolationRequired = "required"      // empty, zero or missing
+    ViolationTooLong  = "too_long"      // params: max (characters or items)
+    ViolationRange    = "out_of_range"  // params: min and/or max, exclusive_min
+    ViolationFormat   = "invalid_format" // params: format
+    ViolationChoice   = "not_allowed"   // params: allowed
+    ViolationOrder    = "wrong_order"   // params: after, the field it must come after
+    ViolationInvalid  = "invalid"
+)
+
+type Violation struct {
+    Field   string         `json:"field"` // snake_case path: "name", "line_items[1].total"
+    Code    string         `json:"code"`
+    Params  map[string]any `json:"params,omitempty"`
+    Message string         `json:"message"`
+}
+
+type Validator struct {
+    violations []Violation
+    err        error // first error of Merge that is not a validation one
+}
+
+func (v *Validator) Add(field string, code string, params map[string]any, format string, args ...interface{}) {
+    v.violations = append(v.violations, Violation{
+        Field: field, Code: code, Params: params, Message: fmt.Sprintf(format, args...),
+    })
+}
+
+// Adds the violation when ok is false
+func (v *Validator) Check(ok bool, field string, code string, params map[string]any, format string, args ...interface{}) {
+    if !ok {
+        v.Add(field, code, params, format, args...)
+    }
+}
+
+func (v *Validator) Required(field string, present bool) {
+    v.Check(present, field, ViolationRequired, nil, "%s must be non-zero", fieldLabel(field))
+}
+
+// In characters, an empty value is left to Required
+func (v *Validator) MaxLength(field string, value string, max int) {
+    v.Check(
+        len([]rune(value)) <= max, field, ViolationTooLong, map[string]any{"max": max},
+        "%s can't exceed %d characters", fieldLabel(field), max,
+    )
+}
+
+// Above 0, like IDs and amounts
+func (v *Validator) Positive(field string, value float64) {
+    v.Check(
+        value > 0, field, ViolationRange, map[string]any{"min": 0, "exclusive_min": true},
+        "%s must be positive and non-zero", fieldLabel(field),
+    )
+}
+
+// min and max included
+func (v *Validator) Range(field string, value float64, min float64, max float64) {
+    v.Check(
+        min <= value && value <= max, field, ViolationRange, map[string]any{"min": min, "max": max},
+        "%s must be between %v and %v, got: %v", fieldLabel(field), min, max, value,
+    )
+}
+
+func (v *Validator) Max(field string, value float64, max float64) {
+    v.Check(
+        value <= max, field, ViolationRange, map[string]any{"max": max},
+        "%s must not exceed %v, got: %v", fieldLabel(field), max, value,
+    )
+}
+
+func (v *Validator) Choice(field string, value string, allowed []string) {
+    v.Check(
+        slices.Contains(allowed, value), field, ViolationChoice, map[string]any{"allowed": allowed},
+        "%s must be one of %s, got: %q", fieldLabel(field), strings.Join(allowed, ", "), value,
+    )
+}
+
+func (v *Validator) Format(field string, ok bool, format string) {
+    v.Check(
+        ok, field, ViolationFormat, map[string]any{"format": format},
+        "%s must be formatted as %s", fieldLabel(field), format,
+    )
+}
+
+// Takes the violations of a nested validation, their fields under prefix
+// ("line_items[0]" and "total" give "line_items[0].total"). Any other error
+// is returned as it is by Err.
+func (v *Validator) Merge(prefix string, err error) {
+    var typed *Error
+    switch {
+    case err == nil:
+    case errors.As(err, &typed) && typed.Kind == ErrValidation:
+        for _, violation := range typed.Violations {
+            violation.Field = joinField(prefix, violation.Field)
+            v.violations = append(v.violations, violation)
+        }
+    case v.err == nil:
+        v.err = err
+    }
+}
+
+func (v *Validator) Violations() []Violation {
+    return v.violations
+}
+
+// Nil without violations. Logged as a warning with the field and code of each
+// violation only, the messages quote the rejected values.
+func (v *Validator) Err() error {
+    if v.err != nil {
+        return v.err
+    }
+    if len(v.violations) == 0 {
+        return nil
+    }
+    messages := make([]string, len(v.violations))
+    rules := make([]string, len(v.violations))
+    for i, violation := range v.violations {
+        messages[i] = violation.Message
+        rules[i] = violation.Field + ": " + violation.Code
+    }
+    logging.Log(1, slog.LevelWarn, "validation failed", "violations", rules)
+    message := strings.Join(messages, "; ")
+    return &Error{Kind: ErrValidation, Message: message, Violations: v.violations}
+}
+
+// Validation error of an ID not positive, as checked before a query, with
+// the code of Validator.Positive
+func InvalidIDError(field string, format string, args ...interface{}) error {
+    logRedacted(1, slog.LevelWarn, format, args)
+    message := fmt.Sprintf(format, args...)
+    return &Error{Kind: ErrValidation, Message: message, Violations: []Violation{{
+        Field: field, Code: ViolationRange, Params: map[string]any{"min": 0, "exclusive_min": true},
+        Message: message,
+    }}}
+}
+
+// Violations of a validation error, nil for any other error
+func ErrorViolations(err error) []Violation {
+    var typed *Error
+    if errors.As(err, &typed) && typed.Kind == ErrValidation {
+        return typed.Violations
+    }
+    return nil
+}
+
+func joinField(prefix string, field string) string {
+    switch {
+    case prefix == "":
+        return field
+    case field == "" || strings.HasPrefix(field, "["):
+        return prefix + field
+    default:
+        return prefix + "." + field
+    }
+}
+
+// "trip_start_location" reads "trip start location" in messages
+func fieldLabel(field string) string {
+    return strings.ReplaceAll(field, "_", " ")
+}
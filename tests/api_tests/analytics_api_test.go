@@ -0,0 +1,84 @@
+package api_tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/api"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/internal/utils"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestAnalyticsAPI(t *testing.T) {
+    database := tests.NewTestDatabase(t)
+    server, err := api.NewServer(database, token, t.TempDir())
+    if err != nil {
+        t.Fatalf("failed to create server: %v", err)
+    }
+    httpServer := httptest.NewServer(server.Handler())
+    defer httpServer.Close()
+
+    typeID, err := crud.CreateExpenseType(database, db.ExpenseType{Name: "Taxi", Reimbursable: true})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    for _, merchant := range []string{"G7", "Uber", "G7"} {
+        expenseID, err := crud.CreateExpense(database, db.Expense{
+            TypeID:   typeID,
+            Currency: "EUR",
+            DateTime: time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC),
+            Merchant: sql.NullString{String: merchant, Valid: true},
+        })
+        if err != nil {
+            t.Fatalf("failed to create expense: %v", err)
+        }
+        if _, err := crud.CreateLineItem(database, db.LineItem{ExpenseID: expenseID, TaxeRate: 10, Total: 25}); err != nil {
+            t.Fatalf("failed to create line item: %v", err)
+        }
+    }
+
+    var spend services.SpendAnalytics
+    status := getJSON(t, httpServer.URL+"/analytics/spend?by=month&from=2024-01-01&to=2024-12-31", &spend)
+    if status != http.StatusOK || len(spend.Groups) != 1 || spend.Groups[0].Key != "2024-05" || spend.Groups[0].Total != 75 {
+        t.Errorf("expected 75 EUR in May, got %d: %+v", status, spend)
+    }
+    var merchants services.MerchantAnalytics
+    status = getJSON(t, httpServer.URL+"/analytics/merchants?limit=1", &merchants)
+    if status != http.StatusOK || len(merchants.Merchants) != 1 || merchants.Merchants[0].Merchant != "G7" {
+        t.Errorf("expected G7 on top, got %d: %+v", status, merchants)
+    }
+
+    var failure struct {
+        Code   string
+        Fields []string
+    }
+    status = getJSON(t, httpServer.URL+"/analytics/spend?by=week&from=2024-13-01", &failure)
+    if status != http.StatusBadRequest || failure.Code != utils.CodeValidation || len(failure.Fields) != 2 {
+        t.Errorf("expected the grouping and the date to be refused, got %d: %+v", status, failure)
+    }
+}
+
+func getJSON(t *testing.T, url string, value any) int {
+    request, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        t.Fatalf("failed to build request: %v", err)
+    }
+    request.Header.Set("Authorization", "Bearer "+token)
+    response, err := http.DefaultClient.Do(request)
+    if err != nil {
+        t.Fatalf("failed to send request: %v", err)
+    }
+    defer response.Body.Close()
+    if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+        t.Fatalf("failed to decode response: %v", err)
+    }
+    return response.StatusCode
+}
@@ -0,0 +1,34 @@
+package api_tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/craftidev/expenseflow/internal/api"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+func TestHTTPStatus(t *testing.T) {
+    validation := utils.ValidationError([]string{"name"}, "name can't be empty")
+    testCases := []struct {
+        err      error
+        expected int
+    }{
+        {utils.NotFoundError("expense not found"), http.StatusNotFound},
+        {validation, http.StatusBadRequest},
+        {utils.ReferencedError("session still referenced"), http.StatusConflict},
+        {utils.LogError("disk full"), http.StatusInternalServerError},
+        // Several kinds in the chain: the same status every time
+        {utils.WrapError(utils.ErrNotFound, validation, "wrapped"), http.StatusNotFound},
+        {utils.WrapError(utils.ErrConflict, validation, "wrapped"), http.StatusBadRequest},
+        {utils.WrapError(utils.ErrIntegrity, validation, "wrapped"), http.StatusInternalServerError},
+    }
+    for _, tc := range testCases {
+        for range 20 {
+            if status := api.HTTPStatus(tc.err); status != tc.expected {
+                t.Fatalf("expected %d for %v, got %d", tc.expected, tc.err, status)
+            }
+        }
+    }
+}
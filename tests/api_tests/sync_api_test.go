@@ -0,0 +1,213 @@
+package api_tests
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/api"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/utils"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+const token = "secret-token"
+
+func TestSyncAPI(t *testing.T) {
+    serverDB, laptop, phone := tests.NewTestDatabase(t), tests.NewTestDatabase(t), tests.NewTestDatabase(t)
+    serverDir, laptopDir, phoneDir := t.TempDir(), t.TempDir(), t.TempDir()
+
+    if _, err := api.NewServer(serverDB, "", serverDir); err == nil {
+        t.Errorf("expected a server without token to be refused")
+    }
+    server, err := api.NewServer(serverDB, token, serverDir)
+    if err != nil {
+        t.Fatalf("failed to create server: %v", err)
+    }
+    httpServer := httptest.NewServer(server.Handler())
+    defer httpServer.Close()
+
+    // An expense with its receipt, on the laptop
+    tests.SetReceiptsDir(t, laptopDir)
+    relPath, err := db.StoreReceipt(filepath.Join(tests.ReceiptsDirTest, "valid_receipt_test.png"))
+    if err != nil {
+        t.Fatalf("failed to store receipt: %v", err)
+    }
+    typeID, err := crud.CreateExpenseType(laptop, db.ExpenseType{Name: "Hotel", Reimbursable: true})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    expenseID, err := crud.CreateExpense(laptop, db.Expense{
+        TypeID: typeID, Currency: "EUR", DateTime: time.Date(2024, 4, 15, 20, 0, 0, 0, time.UTC),
+    })
+    if err != nil {
+        t.Fatalf("failed to create expense: %v", err)
+    }
+    if _, err := crud.CreateReceipt(laptop, db.Receipt{ExpenseID: expenseID, RelPath: relPath}); err != nil {
+        t.Fatalf("failed to create receipt: %v", err)
+    }
+
+    if _, err := api.Sync(laptop, httpServer.URL, "wrong-token"); err == nil {
+        t.Errorf("expected a wrong token to be refused")
+    }
+    if _, err := api.Sync(laptop, httpServer.URL, token); err != nil {
+        t.Fatalf("failed to sync the laptop: %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(serverDir, relPath)); err != nil {
+        t.Errorf("expected the receipt uploaded: %v", err)
+    }
+
+    config.ReceiptsDir = phoneDir
+    report, err := api.Sync(phone, httpServer.URL+"/", token)
+    if err != nil {
+        t.Fatalf("failed to sync the phone: %v", err)
+    }
+    if report.Pulled == 0 {
+        t.Errorf("expected changes pulled, got: %+v", report)
+    }
+    receipts, err := crud.ListReceipts(phone)
+    if err != nil || len(receipts) != 1 || receipts[0].RelPath != relPath {
+        t.Fatalf("expected the receipt on the phone, got: %v (%v)", receipts, err)
+    }
+    if err := receipts[0].CheckFile(); err != nil {
+        t.Errorf("expected the receipt file downloaded: %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(phoneDir, db.ReceiptThumbnailRelPath(relPath))); err != nil {
+        t.Errorf("expected a thumbnail of the downloaded receipt: %v", err)
+    }
+}
+
+func TestSyncAPIRejections(t *testing.T) {
+    serverDB := tests.NewTestDatabase(t)
+    server, err := api.NewServer(serverDB, token, t.TempDir())
+    if err != nil {
+        t.Fatalf("failed to create server: %v", err)
+    }
+    httpServer := httptest.NewServer(server.Handler())
+    defer httpServer.Close()
+
+    cases := []struct {
+        method     string
+        path       string
+        auth       string
+        status     int
+        code       string
+        violations []string // field:code
+    }{
+        {http.MethodGet, "/sync", "", http.StatusUnauthorized, "unauthorized", nil},
+        {http.MethodGet, "/sync", "Bearer " + token, http.StatusOK, "", nil},
+        {http.MethodGet, "/sync?limit=0", "Bearer " + token, http.StatusBadRequest, utils.CodeValidation, []string{"limit:out_of_range"}},
+        {http.MethodGet, "/sync?since=abc&limit=x", "Bearer " + token, http.StatusBadRequest, utils.CodeValidation, []string{"since:invalid_format", "limit:invalid_format"}},
+        {http.MethodGet, "/sync/receipts/..%2Fexpenseflow.db", "Bearer " + token, http.StatusBadRequest, utils.CodeValidation, nil},
+        {http.MethodGet, "/sync/receipts/0123456789abcdef0123456789abcdef.png", "Bearer " + token, http.StatusNotFound, utils.CodeNotFound, nil},
+        {http.MethodHead, "/sync/receipts/0123456789abcdef0123456789abcdef.png", "Bearer " + token, http.StatusNotFound, "", nil},
+    }
+    for _, tc := range cases {
+        request, err := http.NewRequest(tc.method, httpServer.URL+tc.path, nil)
+        if err != nil {
+            t.Fatalf("failed to build request: %v", err)
+        }
+        if tc.auth != "" {
+            request.Header.Set("Authorization", tc.auth)
+        }
+        response, err := http.DefaultClient.Do(request)
+        if err != nil {
+            t.Fatalf("failed to send %s %s: %v", tc.method, tc.path, err)
+        }
+        var failure struct {
+            Code       string
+            Fields     []string
+            Violations []utils.Violation
+        }
+        json.NewDecoder(response.Body).Decode(&failure)
+        response.Body.Close()
+        if response.StatusCode != tc.status {
+            t.Errorf("expected %d for %s %s, got: %d", tc.status, tc.method, tc.path, response.StatusCode)
+        }
+        if tc.code != "" && failure.Code != tc.code {
+            t.Errorf("expected code %s for %s %s, got: %+v", tc.code, tc.method, tc.path, failure)
+        }
+        var violations []string
+        for _, violation := range failure.Violations {
+            violations = append(violations, violation.Field+":"+violation.Code)
+        }
+        if tc.violations != nil && !slices.Equal(violations, tc.violations) {
+            t.Errorf("expected violations %v for %s %s, got: %v", tc.violations, tc.method, tc.path, violations)
+        }
+    }
+
+    // Receipts are only stored under the hash of their content
+    data, err := os.ReadFile(filepath.Join(tests.ReceiptsDirTest, "valid_receipt_test.png"))
+    if err != nil {
+        t.Fatalf("failed to read receipt: %v", err)
+    }
+    for name, status := range map[string]int{
+        "0123456789abcdef0123456789abcdef.png": http.StatusBadRequest,
+        db.ReceiptName(data, ".png"):           http.StatusCreated,
+    } {
+        request, err := http.NewRequest(
+            http.MethodPut, httpServer.URL+"/sync/receipts/"+name, bytes.NewReader(data),
+        )
+        if err != nil {
+            t.Fatalf("failed to build request: %v", err)
+        }
+        request.Header.Set("Authorization", "Bearer "+token)
+        response, err := http.DefaultClient.Do(request)
+        if err != nil {
+            t.Fatalf("failed to upload %s: %v", name, err)
+        }
+        response.Body.Close()
+        if response.StatusCode != status {
+            t.Errorf("expected %d uploading %s, got: %d", status, name, response.StatusCode)
+        }
+    }
+
+    // Messages in the language asked for, codes unchanged
+    request, err := http.NewRequest(http.MethodGet, httpServer.URL+"/sync?limit=0", nil)
+    if err != nil {
+        t.Fatalf("failed to build request: %v", err)
+    }
+    request.Header.Set("Authorization", "Bearer "+token)
+    request.Header.Set("Accept-Language", "fr-FR, en;q=0.5")
+    response, err := http.DefaultClient.Do(request)
+    if err != nil {
+        t.Fatalf("failed to send request: %v", err)
+    }
+    defer response.Body.Close()
+    var failure struct {
+        Error      string
+        Code       string
+        Violations []utils.Violation
+    }
+    json.NewDecoder(response.Body).Decode(&failure)
+    switch {
+    case response.Header.Get("Content-Language") != "fr":
+        t.Errorf("expected a french answer, got: %q", response.Header.Get("Content-Language"))
+    case failure.Code != utils.CodeValidation || len(failure.Violations) != 1:
+        t.Errorf("expected a validation error on the limit, got: %+v", failure)
+    case failure.Error != "limite doit être compris entre 1 et 5000" ||
+        failure.Violations[0].Message != failure.Error:
+        t.Errorf("expected a french message, got: %+v", failure)
+    }
+}
+
+func newDatabase(t *testing.T) *sql.DB {
+    database, err := db.ConnectDB(":memory:")
+    if err != nil {
+        t.Fatalf("failed to connect database: %v", err)
+    }
+    if err := db.InitDB(":memory:", database); err != nil {
+        t.Fatalf("failed to init database: %v", err)
+    }
+    return database
+}
@@ -0,0 +1,95 @@
+package config_tests
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/craftidev/expenseflow/config"
+)
+
+
+func TestLoadPrecedence(t *testing.T) {
+    configPath := filepath.Join(t.TempDir(), "config.json")
+    err := os.WriteFile(configPath, []byte(`{
+        "db_path": "/from/file.db",
+        "receipts_dir": "/from/file/receipts",
+        "listen_addr": "0.0.0.0:9000",
+        "max_float": 5000
+    }`), 0644)
+    if err != nil {
+        t.Fatalf("failed to write config file: %v", err)
+    }
+
+    t.Setenv("EXPENSEFLOW_CONFIG", configPath)
+    t.Setenv("EXPENSEFLOW_RECEIPTS_DIR", "/from/env/receipts")
+    t.Setenv("EXPENSEFLOW_MAX_FLOAT", "7000")
+
+    fs := flag.NewFlagSet("test", flag.ContinueOnError)
+    flags := config.RegisterFlags(fs)
+    if err := fs.Parse([]string{"--max-float", "9000"}); err != nil {
+        t.Fatalf("failed to parse flags: %v", err)
+    }
+
+    settings, err := config.Load(flags)
+    if err != nil {
+        t.Fatalf("expected no error on load, got: %v", err)
+    }
+    switch {
+    case settings.DBPath != "/from/file.db":
+        t.Errorf("expected db path from file, got: %v", settings.DBPath)
+    case settings.ReceiptsDir != "/from/env/receipts":
+        t.Errorf("expected receipts dir from env, got: %v", settings.ReceiptsDir)
+    case settings.ListenAddr != "0.0.0.0:9000":
+        t.Errorf("expected listen address from file, got: %v", settings.ListenAddr)
+    case settings.MaxFloat != 9000:
+        t.Errorf("expected max float from flags, got: %v", settings.MaxFloat)
+    case settings.LogPath != config.Default().LogPath:
+        t.Errorf("expected default log path, got: %v", settings.LogPath)
+    }
+}
+
+func TestLoadInvalid(t *testing.T) {
+    t.Setenv("EXPENSEFLOW_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+    if _, err := config.Load(nil); err == nil {
+        t.Error("expected error on explicit missing config file")
+    }
+
+    t.Setenv("EXPENSEFLOW_CONFIG", "")
+    os.Unsetenv("EXPENSEFLOW_CONFIG")
+    t.Setenv("EXPENSEFLOW_MAX_FLOAT", "-1")
+    if _, err := config.Load(nil); err == nil {
+        t.Error("expected error on negative max float")
+    }
+
+    t.Setenv("EXPENSEFLOW_MAX_FLOAT", "")
+    os.Unsetenv("EXPENSEFLOW_MAX_FLOAT")
+    t.Setenv("EXPENSEFLOW_LOG_LEVEL", "verbose")
+    if _, err := config.Load(nil); err == nil {
+        t.Error("expected error on unknown log level")
+    }
+
+    t.Setenv("EXPENSEFLOW_LOG_LEVEL", "")
+    os.Unsetenv("EXPENSEFLOW_LOG_LEVEL")
+    t.Setenv("EXPENSEFLOW_LOCALE", "de")
+    if _, err := config.Load(nil); err == nil {
+        t.Error("expected error on a locale without catalog")
+    }
+}
+
+func TestDefaultPathsFollowXDG(t *testing.T) {
+    if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+        t.Skip("XDG directories are only used on Linux/BSD")
+    }
+    t.Setenv("XDG_DATA_HOME", "/xdg/data")
+    t.Setenv("XDG_STATE_HOME", "/xdg/state")
+    settings := config.Default()
+    if settings.DBPath != "/xdg/data/expenseflow/expenseflow.db" {
+        t.Errorf("expected db in XDG_DATA_HOME, got: %v", settings.DBPath)
+    }
+    if settings.LogPath != "/xdg/state/expenseflow/expenseflow.log" {
+        t.Errorf("expected log in XDG_STATE_HOME, got: %v", settings.LogPath)
+    }
+}
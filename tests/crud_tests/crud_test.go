@@ -2,11 +2,14 @@ package crud_tests
 
 import (
 	"database/sql"
+	"errors"
 	"os"
 	"reflect"
 	"testing"
 
+	"github.com/craftidev/expenseflow/internal/db"
 	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/utils"
 	"github.com/craftidev/expenseflow/tests"
 )
 
@@ -29,6 +32,7 @@ var validCarTrip = tests.GetValidCarTrip()
 var validExpenseType = tests.GetValidExpenseType()
 var validExpense = tests.GetValidExpense()
 var validLineItem = tests.GetValidLineItem()
+var validReceipt = tests.GetValidReceipt()
 
 func TestCreateModels(t *testing.T) {
     idClient, errClient := crud.CreateClient(DatabaseTest, validClient)
@@ -37,6 +41,7 @@ func TestCreateModels(t *testing.T) {
     idExpenseType, errExpenseType := crud.CreateExpenseType(DatabaseTest, validExpenseType)
     idExpense, errExpense := crud.CreateExpense(DatabaseTest, validExpense)
     idLineItem, errLineItem := crud.CreateLineItem(DatabaseTest, validLineItem)
+    idReceipt, errReceipt := crud.CreateReceipt(DatabaseTest, validReceipt)
 
     errsValid := []struct {
         name string
@@ -49,6 +54,7 @@ func TestCreateModels(t *testing.T) {
         {"ExpenseType", idExpenseType, errExpenseType},
         {"Expense", idExpense, errExpense},
         {"LineItem", idLineItem, errLineItem},
+        {"Receipt", idReceipt, errReceipt},
     }
     for _, e := range errsValid {
         if e.err != nil {
@@ -65,6 +71,7 @@ func TestCreateModels(t *testing.T) {
     _, errClient = crud.CreateClient(DatabaseTest, validClient)
     _, errCarTrip = crud.CreateCarTrip(DatabaseTest, validCarTrip)
     _, errExpenseType = crud.CreateExpenseType(DatabaseTest, validExpenseType)
+    _, errReceipt = crud.CreateReceipt(DatabaseTest, validReceipt)
 
     errsInvalid := []struct {
         name string
@@ -73,6 +80,7 @@ func TestCreateModels(t *testing.T) {
         {"Client", errClient},
         {"CarTrip", errCarTrip},
         {"ExpenseType", errExpenseType},
+        {"Receipt", errReceipt},
     }
     for _, e := range errsInvalid {
         if e.err == nil {
@@ -93,6 +101,7 @@ func TestGetModelsByID(t *testing.T) {
     expenseType, errExpenseType := crud.GetExpenseTypeByID(DatabaseTest, 1)
     expense, errExpense := crud.GetExpenseByID(DatabaseTest, 1)
     lineItem, errLineItem := crud.GetLineItemByID(DatabaseTest, 1)
+    receipt, errReceipt := crud.GetReceiptByID(DatabaseTest, 1)
 
     errsValid := []struct {
         name string
@@ -104,6 +113,7 @@ func TestGetModelsByID(t *testing.T) {
         {"ExpenseType", errExpenseType},
         {"Expense", errExpense},
         {"LineItem", errLineItem},
+        {"Receipt", errReceipt},
     }
     for _, e := range errsValid {
         if e.err != nil {
@@ -111,10 +121,34 @@ func TestGetModelsByID(t *testing.T) {
         }
     }
 
-    compareEntities(t, "Client", validClient, *client)
-    compareEntities(t, "CarTrip", validCarTrip, *carTrip)
-    compareEntities(t, "ExpenseType", validExpenseType, *expenseType)
-    compareEntities(t, "LineItem", validLineItem, *lineItem)
+    // Public IDs are set by the database
+    publicIDs := []string{
+        client.PublicID, session.PublicID, carTrip.PublicID, expenseType.PublicID,
+        expense.PublicID, lineItem.PublicID, receipt.PublicID,
+    }
+    for _, publicID := range publicIDs {
+        if err := db.ValidPublicID(publicID); err != nil {
+            t.Errorf("expected a public ID on every fetched model, got: %v", err)
+        }
+    }
+    byPublicID, err := crud.GetExpenseByPublicID(DatabaseTest, expense.PublicID)
+    if err != nil || byPublicID.ID != expense.ID {
+        t.Errorf("expected the expense found by its public ID, got: %v (%v)", byPublicID, err)
+    }
+    if _, err := crud.GetClientByPublicID(DatabaseTest, "not-a-uuid"); err == nil {
+        t.Errorf("expected an error on an invalid public ID")
+    }
+    expectedClient, expectedCarTrip, expectedExpenseType := validClient, validCarTrip, validExpenseType
+    expectedLineItem, expectedReceipt := validLineItem, validReceipt
+    expectedClient.PublicID, expectedCarTrip.PublicID = client.PublicID, carTrip.PublicID
+    expectedExpenseType.PublicID = expenseType.PublicID
+    expectedLineItem.PublicID, expectedReceipt.PublicID = lineItem.PublicID, receipt.PublicID
+
+    compareEntities(t, "Client", expectedClient, *client)
+    compareEntities(t, "CarTrip", expectedCarTrip, *carTrip)
+    compareEntities(t, "ExpenseType", expectedExpenseType, *expenseType)
+    compareEntities(t, "LineItem", expectedLineItem, *lineItem)
+    compareEntities(t, "Receipt", expectedReceipt, *receipt)
     // Custom manual checks because of time.Time badly handled with deepEqual
     if  session.ID != validSession.ID ||
         session.ClientID != validSession.ClientID ||
@@ -131,7 +165,6 @@ func TestGetModelsByID(t *testing.T) {
         expense.SessionID != validExpense.SessionID ||
         expense.TypeID != validExpense.TypeID ||
         expense.Currency != validExpense.Currency ||
-        expense.ReceiptRelPath != validExpense.ReceiptRelPath ||
         expense.Notes != validExpense.Notes ||
         !expense.DateTime.Equal(validExpense.DateTime) {
             t.Errorf("data fetched for Expense (%v) doesn't match data inserted (%v)",
@@ -147,6 +180,7 @@ func TestUpdateModels(t *testing.T) {
     expenseType := validExpenseType
     expense := validExpense
     lineItem := validLineItem
+    receipt := validReceipt
 
     clientChange := "updated"
     sessionChange := "updated"
@@ -154,6 +188,7 @@ func TestUpdateModels(t *testing.T) {
     expenseTypeChange := "updated"
     expenseChange := sql.NullString{String: "updated", Valid: true}
     lineItemChange := 111.1
+    receiptChange := 3
 
     client.Name = clientChange
     session.Location = sessionChange
@@ -161,6 +196,7 @@ func TestUpdateModels(t *testing.T) {
     expenseType.Name = expenseTypeChange
     expense.Notes = expenseChange
     lineItem.Total = lineItemChange
+    receipt.Position = receiptChange
 
     errClient := crud.UpdateClient(DatabaseTest, client)
     errSession := crud.UpdateSession(DatabaseTest, session)
@@ -168,6 +204,7 @@ func TestUpdateModels(t *testing.T) {
     errExpenseType := crud.UpdateExpenseType(DatabaseTest, expenseType)
     errExpense := crud.UpdateExpense(DatabaseTest, expense)
     errLineItem := crud.UpdateLineItem(DatabaseTest, lineItem)
+    errReceipt := crud.UpdateReceipt(DatabaseTest, receipt)
 
     errsValid := []struct {
     name string
@@ -179,6 +216,7 @@ func TestUpdateModels(t *testing.T) {
         {"ExpenseType", errExpenseType},
         {"Expense", errExpense},
         {"LineItem", errLineItem},
+        {"Receipt", errReceipt},
     }
     for _, e := range errsValid {
         if e.err != nil {
@@ -191,7 +229,8 @@ func TestUpdateModels(t *testing.T) {
         carTripChange != carTrip.DateOnly ||
         expenseTypeChange != expenseType.Name ||
         expenseChange != expense.Notes ||
-        lineItemChange != lineItem.Total {
+        lineItemChange != lineItem.Total ||
+        receiptChange != receipt.Position {
             t.Error("data UPDATEd doesn't match data changed")
     }
 
@@ -214,15 +253,17 @@ func TestUpdateModels(t *testing.T) {
     errClient = crud.UpdateClient(DatabaseTest, client)
     errCarTrip = crud.UpdateCarTrip(DatabaseTest, carTrip)
     errExpenseType = crud.UpdateExpenseType(DatabaseTest, expenseType)
-    if errClient == nil || errCarTrip == nil || errExpenseType == nil {
-        t.Error("expected errors on data UPDATEd with same UNIQUE entry")
+    for _, err := range []error{errClient, errCarTrip, errExpenseType} {
+        if !errors.Is(err, utils.ErrConflict) {
+            t.Errorf("expected a conflict on data UPDATEd with same UNIQUE entry, got: %v", err)
+        }
     }
 }
 
 func TestDeleteModels(t *testing.T) {
     // Invalid delete because of FK
     // ExpenseType: FK in expenses
-    // Expense: FK in line_items
+    // Expense: FK in line_items, receipts
     // Session: FK in car_trips, expenses
     // Client: FK in sessions
     expectedErrClient := crud.DeleteClientByID(DatabaseTest, 1)
@@ -240,7 +281,7 @@ func TestDeleteModels(t *testing.T) {
         {"Expense", expectedErrExpense},
     }
     for _, e := range errsInvalid {
-        if e.err == nil {
+        if !errors.Is(e.err, utils.ErrReferenced) {
             t.Errorf(
                 "expected error on DELETE because of FK for %s, got: %v",
                 e.name, e.err,
@@ -250,6 +291,7 @@ func TestDeleteModels(t *testing.T) {
 
     // Valid DELETEs
     errLineItem := crud.DeleteLineItemByID(DatabaseTest, 1)
+    errReceipt := crud.DeleteReceiptByID(DatabaseTest, 1)
     errCarTrip := crud.DeleteCarTripByID(DatabaseTest, 1)
     errExpense := crud.DeleteExpenseByID(DatabaseTest, 1)
     errExpenseType := crud.DeleteExpenseTypeByID(DatabaseTest, 1)
@@ -261,6 +303,7 @@ func TestDeleteModels(t *testing.T) {
         err  error
     }{
         {"LineItem", errLineItem},
+        {"Receipt", errReceipt},
         {"CarTrip", errCarTrip},
         {"Expense", errExpense},
         {"ExpenseType", errExpenseType},
@@ -274,6 +317,7 @@ func TestDeleteModels(t *testing.T) {
     }
 
     _, errLineItemFetch := crud.GetLineItemByID(DatabaseTest, 1)
+    _, errReceiptFetch := crud.GetReceiptByID(DatabaseTest, 1)
     _, errCarTripFetch := crud.GetCarTripByID(DatabaseTest, 1)
     _, errExpenseFetch := crud.GetExpenseByID(DatabaseTest, 1)
     _, errExpenseTypeFetch := crud.GetExpenseTypeByID(DatabaseTest, 1)
@@ -285,6 +329,7 @@ func TestDeleteModels(t *testing.T) {
         err  error
     }{
         {"LineItem", errLineItemFetch},
+        {"Receipt", errReceiptFetch},
         {"CarTrip", errCarTripFetch},
         {"Expense", errExpenseFetch},
         {"ExpenseType", errExpenseTypeFetch},
@@ -292,9 +337,9 @@ func TestDeleteModels(t *testing.T) {
         {"Client", errClientFetch},
     }
     for _, e := range errsInvalid {
-        if e.err == nil {
+        if !errors.Is(e.err, utils.ErrNotFound) {
             t.Errorf(
-                "expected error on fetching DELETEd data for %s, got: %v",
+                "expected not found on fetching DELETEd data for %s, got: %v",
             e.name, e.err,
         )
         }
@@ -0,0 +1,101 @@
+package crud_tests
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestListTaxRatesValidOn(t *testing.T) {
+    // Seeded by the migration: FR standard rate went from 19.6% to 20% in 2014
+    before, err := crud.ListTaxRatesValidOn(DatabaseTest, "FR", time.Date(2013, 6, 1, 0, 0, 0, 0, time.UTC))
+    if err != nil {
+        t.Fatalf("expected no error listing tax rates, got: %v", err)
+    }
+    after, err := crud.ListTaxRatesValidOn(DatabaseTest, "FR", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+    if err != nil {
+        t.Fatalf("expected no error listing tax rates, got: %v", err)
+    }
+    if !hasRate(before, 19.6) || hasRate(before, 20) {
+        t.Errorf("expected 19.6%% and not 20%% in 2013, got: %v", before)
+    }
+    if !hasRate(after, 20) || hasRate(after, 19.6) {
+        t.Errorf("expected 20%% and not 19.6%% in 2024, got: %v", after)
+    }
+
+    if _, err := crud.CreateTaxRate(DatabaseTest, db.TaxRate{Country: "fr", Label: "standard", Rate: 20}); err == nil {
+        t.Error("expected an error on a lowercase country code")
+    }
+
+    // Zero-rated categories can be listed
+    zero := db.TaxRate{Country: "GB", Label: "zero", Rate: 0}
+    if _, err := crud.CreateTaxRate(DatabaseTest, zero); err != nil {
+        t.Fatalf("expected no error on a 0%% rate, got: %v", err)
+    }
+    rates, err := crud.ListTaxRatesValidOn(DatabaseTest, "GB", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+    if err != nil || !hasRate(rates, 0) {
+        t.Errorf("expected the 0%% rate to be listed, got: %v (%v)", rates, err)
+    }
+}
+
+func TestCheckLineItemTaxeRate(t *testing.T) {
+    expenseTypeID, err := crud.CreateExpenseType(DatabaseTest, db.ExpenseType{Name: "Tax rate check"})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    expense := tests.GetValidExpense()
+    expense.TypeID = expenseTypeID
+    expense.SessionID = sql.NullInt64{}
+    expense.DateTime = time.Date(2013, 6, 1, 12, 0, 0, 0, time.UTC)
+    expense.Country = sql.NullString{String: "FR", Valid: true}
+    expenseID, err := crud.CreateExpense(DatabaseTest, expense)
+    if err != nil {
+        t.Fatalf("failed to create expense: %v", err)
+    }
+
+    cases := map[float64]bool{19.6: true, 20: false, 0: true}
+    for rate, expected := range cases {
+        known, err := crud.CheckLineItemTaxeRate(
+            DatabaseTest, db.LineItem{ExpenseID: expenseID, TaxeRate: rate, Total: 10},
+        )
+        if err != nil || known != expected {
+            t.Errorf("expected rate %v known: %v, got: %v (%v)", rate, expected, known, err)
+        }
+    }
+
+    // Unknown rates are only a warning
+    _, err = crud.CreateLineItem(DatabaseTest, db.LineItem{ExpenseID: expenseID, TaxeRate: 20, Total: 10})
+    if err != nil {
+        t.Errorf("expected no error on an unknown rate, got: %v", err)
+    }
+
+    // New Year's Eve in UTC, already 2014 in Paris: the 2014 rates apply
+    expense.DateTime = time.Date(2013, 12, 31, 23, 30, 0, 0, time.UTC)
+    expense.TimeZone = sql.NullString{String: "Europe/Paris", Valid: true}
+    if expenseID, err = crud.CreateExpense(DatabaseTest, expense); err != nil {
+        t.Fatalf("failed to create expense: %v", err)
+    }
+    cases = map[float64]bool{19.6: false, 20: true}
+    for rate, expected := range cases {
+        known, err := crud.CheckLineItemTaxeRate(
+            DatabaseTest, db.LineItem{ExpenseID: expenseID, TaxeRate: rate, Total: 10},
+        )
+        if err != nil || known != expected {
+            t.Errorf("expected rate %v known on January 1st: %v, got: %v (%v)", rate, expected, known, err)
+        }
+    }
+}
+
+func hasRate(taxRates []db.TaxRate, rate float64) bool {
+    for _, taxRate := range taxRates {
+        if taxRate.Rate == rate {
+            return true
+        }
+    }
+    return false
+}
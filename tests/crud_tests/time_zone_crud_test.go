@@ -0,0 +1,138 @@
+package crud_tests
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestExpenseTimeZone(t *testing.T) {
+    expenseTypeID, err := crud.CreateExpenseType(DatabaseTest, db.ExpenseType{Name: "Time zone check"})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    expense := tests.GetValidExpense()
+    expense.TypeID = expenseTypeID
+    expense.SessionID = sql.NullInt64{}
+    expense.DateTime = time.Date(2024, 6, 30, 22, 30, 0, 0, time.UTC)
+    expense.TimeZone = sql.NullString{String: "Europe/Paris", Valid: true}
+    expenseID, err := crud.CreateExpense(DatabaseTest, expense)
+    if err != nil {
+        t.Fatalf("failed to create expense: %v", err)
+    }
+
+    var stored string
+    err = DatabaseTest.QueryRow("SELECT date_time FROM expenses WHERE id = ?", expenseID).Scan(&stored)
+    if err != nil || stored != "2024-06-30T22:30:00.000000000Z" {
+        t.Errorf("expected an RFC3339 UTC timestamp stored, got: %q (%v)", stored, err)
+    }
+    fetched, err := crud.GetExpenseByID(DatabaseTest, expenseID)
+    if err != nil {
+        t.Fatalf("failed to fetch expense: %v", err)
+    }
+    if  !fetched.DateTime.Equal(expense.DateTime) || fetched.TimeZone != expense.TimeZone ||
+        fetched.LocalDate() != "2024-07-01" {
+        t.Errorf("expected the expense of July 1 in Paris, got: %v (%s)", fetched, fetched.LocalDate())
+    }
+
+    // Written by the sqlite driver before migration 012
+    _, err = DatabaseTest.Exec(
+        "UPDATE expenses SET date_time = '2024-07-01 00:30:00+02:00' WHERE id = ?", expenseID,
+    )
+    if err != nil {
+        t.Fatalf("failed to update expense: %v", err)
+    }
+    fetched, err = crud.GetExpenseByID(DatabaseTest, expenseID)
+    if err != nil || !fetched.DateTime.Equal(expense.DateTime) {
+        t.Errorf("expected the driver layout to still be read, got: %v (%v)", fetched, err)
+    }
+
+    expense.TimeZone.String = "Europe/Atlantis"
+    if _, err := crud.CreateExpense(DatabaseTest, expense); err == nil {
+        t.Error("expected an error on an unknown time zone")
+    }
+}
+
+func TestNullableTimeScan(t *testing.T) {
+    var nt db.NullableTime
+    err := DatabaseTest.QueryRow("SELECT '2024-06-30T22:30:00.000000000Z'").Scan(&nt)
+    if err != nil || !nt.Valid || !nt.Time.Equal(time.Date(2024, 6, 30, 22, 30, 0, 0, time.UTC)) {
+        t.Errorf("expected a valid time, got: %v (%v)", nt, err)
+    }
+    if err := DatabaseTest.QueryRow("SELECT NULL").Scan(&nt); err != nil || nt.Valid {
+        t.Errorf("expected a null time, got: %v (%v)", nt, err)
+    }
+    if err := DatabaseTest.QueryRow("SELECT 'yesterday'").Scan(&nt); err == nil || nt.Valid {
+        t.Errorf("expected an error on an invalid time, got: %v", nt)
+    }
+}
+
+func TestListExpensesBetween(t *testing.T) {
+    expenseTypeID, err := crud.CreateExpenseType(DatabaseTest, db.ExpenseType{Name: "Range check"})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    paris := sql.NullString{String: "Europe/Paris", Valid: true}
+    newYork := sql.NullString{String: "America/New_York", Valid: true}
+    expenses := []struct {
+        dateTime time.Time
+        timeZone sql.NullString
+        days     int64
+        expected bool
+    }{
+        {time.Date(2030, 3, 31, 22, 30, 0, 0, time.UTC), paris, 0, true},  // April 1st in Paris
+        {time.Date(2030, 3, 31, 12, 0, 0, 0, time.UTC), sql.NullString{}, 0, false},
+        {time.Date(2030, 3, 25, 12, 0, 0, 0, time.UTC), sql.NullString{}, 10, true},
+        {time.Date(2030, 3, 25, 12, 0, 0, 0, time.UTC), sql.NullString{}, 7, false}, // until March 31st
+        {time.Date(2030, 4, 30, 23, 0, 0, 0, time.UTC), newYork, 0, true},  // still April 30th
+        {time.Date(2030, 4, 30, 23, 0, 0, 0, time.UTC), paris, 0, false},   // May 1st
+        {time.Date(2029, 4, 5, 12, 0, 0, 0, time.UTC), sql.NullString{}, db.MaxCoveredDays, true},
+    }
+    expected := make([]int64, 0)
+    for _, e := range expenses {
+        expense := tests.GetValidExpense()
+        expense.TypeID = expenseTypeID
+        expense.SessionID = sql.NullInt64{}
+        expense.DateTime = e.dateTime
+        expense.TimeZone = e.timeZone
+        expense.CoveredDays = sql.NullInt64{Int64: e.days, Valid: e.days != 0}
+        expenseID, err := crud.CreateExpense(DatabaseTest, expense)
+        if err != nil {
+            t.Fatalf("failed to create expense: %v", err)
+        }
+        if e.expected {
+            expected = append(expected, expenseID)
+        }
+        lineItem := db.LineItem{ExpenseID: expenseID, TaxeRate: 10, Total: 10}
+        if _, err := crud.CreateLineItem(DatabaseTest, lineItem); err != nil {
+            t.Fatalf("failed to create line item: %v", err)
+        }
+    }
+
+    from, to := time.Date(2030, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, 5, 1, 0, 0, 0, 0, time.UTC)
+    listed, err := crud.ListExpensesBetween(DatabaseTest, from, to)
+    if err != nil {
+        t.Fatalf("expected no error listing expenses, got: %v", err)
+    }
+    ids := make([]int64, len(listed))
+    for i, expense := range listed {
+        ids[i] = expense.ID
+    }
+    if !slices.Equal(ids, expected) {
+        t.Errorf("expected expenses %v in April, got: %v", expected, ids)
+    }
+
+    lineItems, err := crud.ListLineItemsByExpenseIDs(DatabaseTest, ids)
+    if err != nil || len(lineItems) != len(ids) || lineItems[0].ExpenseID != ids[0] {
+        t.Errorf("expected one line item per expense, got: %v (%v)", lineItems, err)
+    }
+    if lineItems, err := crud.ListLineItemsByExpenseIDs(DatabaseTest, nil); err != nil || len(lineItems) != 0 {
+        t.Errorf("expected no line item without expense, got: %v (%v)", lineItems, err)
+    }
+}
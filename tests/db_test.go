@@ -2,8 +2,18 @@ package tests
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/db/migrations"
+	"github.com/craftidev/expenseflow/internal/utils"
 )
 
 
@@ -19,7 +29,6 @@ func TestMain(m *testing.M) {
     os.Exit(exitCode)
 }
 
-// TODO test standard model migration
 func TestInitDB(t *testing.T) {
 	if SingletonDatabaseTest == nil {
 		t.Fatal("Expected the in-memory database to be set up, but it was nil")
@@ -45,3 +54,252 @@ func TestInitDB(t *testing.T) {
 		t.Error("Expected some tables to be created, but none were found")
 	}
 }
+
+func TestInitDBStandardModels(t *testing.T) {
+	database, err := db.ConnectDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to connect to in-memory database: %v", err)
+	}
+	defer database.Close()
+
+	if err := db.InitDB(":memory:", database, "unknown_model"); err == nil {
+		t.Error("Expected an error for an unknown standard model")
+	}
+
+	models, err := db.StandardModels()
+	if err != nil || len(models) == 0 {
+		t.Fatalf("Expected embedded standard models, got: %v (%v)", models, err)
+	}
+	if err := db.InstallStandardModels(database, "orisha_g8"); err != nil {
+		t.Fatalf("Failed to install standard model: %v", err)
+	}
+	// Installing twice keeps existing types
+	if err := db.InstallStandardModels(database, "orisha_g8"); err != nil {
+		t.Fatalf("Failed to re-install standard model: %v", err)
+	}
+
+	var count int
+	if err := database.QueryRow("SELECT COUNT(*) FROM expense_types").Scan(&count); err != nil {
+		t.Fatalf("Failed to count expense types: %v", err)
+	}
+	if count != 10 {
+		t.Errorf("Expected 10 expense types from orisha_g8, got %d", count)
+	}
+
+	installed, err := db.InstalledStandardModels(database)
+	if err != nil || installed["orisha_g8"] == 0 {
+		t.Errorf("Expected orisha_g8 to be recorded as installed, got: %v (%v)", installed, err)
+	}
+
+	// Running again on an up to date schema is a no-op
+	if err := db.InitDB(":memory:", database); err != nil {
+		t.Errorf("Expected no error on up to date schema, got: %v", err)
+	}
+	var version int
+	if err := database.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version < 1 {
+		t.Errorf("Expected schema version to be recorded, got %d (%v)", version, err)
+	}
+}
+
+func TestDiffAndUpgradeStandardModel(t *testing.T) {
+	database := NewTestDatabase(t, "generic")
+
+	// Customize one type, delete another
+	_, err := database.Exec("UPDATE expense_types SET name = 'TAXI' WHERE model_ref = 'generic:TRANSPORT'")
+	if err != nil {
+		t.Fatalf("Failed to customize expense type: %v", err)
+	}
+	if _, err = database.Exec("DELETE FROM expense_types WHERE model_ref = 'generic:FUEL'"); err != nil {
+		t.Fatalf("Failed to delete expense type: %v", err)
+	}
+
+	diffs, err := db.DiffStandardModel(database, "generic")
+	if err != nil {
+		t.Fatalf("Failed to diff standard model: %v", err)
+	}
+	statuses := make(map[string]string)
+	for _, diff := range diffs {
+		statuses[diff.Key] = diff.Status
+	}
+	if statuses["TRANSPORT"] != db.ModelDiffCustomized ||
+		statuses["FUEL"] != db.ModelDiffMissing ||
+		statuses["PARKING"] != db.ModelDiffSame {
+		t.Errorf("Unexpected diff statuses: %v", statuses)
+	}
+
+	// Without overwrite, customizations are kept
+	if _, err := db.UpgradeStandardModel(database, "generic", false); err != nil {
+		t.Fatalf("Failed to upgrade standard model: %v", err)
+	}
+	var name string
+	err = database.QueryRow("SELECT name FROM expense_types WHERE model_ref = 'generic:TRANSPORT'").Scan(&name)
+	if err != nil || name != "TAXI" {
+		t.Errorf("Expected customized name to be kept, got %q (%v)", name, err)
+	}
+	var count int
+	err = database.QueryRow("SELECT COUNT(*) FROM expense_types WHERE model_ref = 'generic:FUEL'").Scan(&count)
+	if err != nil || count != 1 {
+		t.Errorf("Expected missing type to be reinstalled, got %d (%v)", count, err)
+	}
+
+	if _, err := db.UpgradeStandardModel(database, "generic", true); err != nil {
+		t.Fatalf("Failed to upgrade standard model with overwrite: %v", err)
+	}
+	err = database.QueryRow("SELECT name FROM expense_types WHERE model_ref = 'generic:TRANSPORT'").Scan(&name)
+	if err != nil || name != "TRANSPORT" {
+		t.Errorf("Expected name to be reset by overwrite, got %q (%v)", name, err)
+	}
+}
+
+func TestMigrateReceiptsTable(t *testing.T) {
+	database, err := db.ConnectDB(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to connect to in-memory database: %v", err)
+	}
+	defer database.Close()
+
+	// Database as it was before receipts got their own table
+	for i, schemaFile := range []string{
+		"001_create_tables.sql", "002_expense_type_details.sql", "003_vat_recoverable.sql",
+		"004_tax_rates.sql", "005_line_items_zero_rate.sql",
+	} {
+		schema, err := migrations.FS.ReadFile(schemaFile)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", schemaFile, err)
+		}
+		if _, err := database.Exec(string(schema)); err != nil {
+			t.Fatalf("Failed to apply %s: %v", schemaFile, err)
+		}
+		if _, err := database.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			t.Fatalf("Failed to set schema version: %v", err)
+		}
+	}
+	_, err = database.Exec(`
+		INSERT INTO expense_types(name) VALUES ('Hotel');
+		INSERT INTO expenses(type_id, currency, receipt_rel_path, date_time)
+		VALUES (1, 'EUR', 'invoice.pdf', '2024-04-15 10:00:00+00:00'),
+		       (1, 'EUR', NULL, '2024-04-16 10:00:00+00:00'),
+		       (1, 'EUR', 'lost.png', '2024-04-17 10:00:00+00:00');`,
+	)
+	if err != nil {
+		t.Fatalf("Failed to seed old schema: %v", err)
+	}
+	SetReceiptsDir(t, t.TempDir())
+	invoice := []byte("%PDF-1.4 invoice")
+	if err := os.WriteFile(filepath.Join(config.ReceiptsDir, "invoice.pdf"), invoice, 0644); err != nil {
+		t.Fatalf("Failed to write receipt: %v", err)
+	}
+
+	if err := db.InitDB(":memory:", database); err != nil {
+		t.Fatalf("Expected no error on upgrade, got: %v", err)
+	}
+	// Renamed after their content for sync, unless the file is missing
+	relPath := db.ReceiptName(invoice, ".pdf")
+	receipts, err := crud.ListReceipts(database)
+	if err != nil || len(receipts) != 2 ||
+		receipts[0].ExpenseID != 1 || receipts[0].RelPath != relPath ||
+		receipts[1].ExpenseID != 3 || receipts[1].RelPath != "lost.png" {
+		t.Errorf("Expected the receipts to be moved to receipts, got: %v (%v)", receipts, err)
+	}
+	if err := receipts[0].CheckFile(); err != nil {
+		t.Errorf("Expected the receipt file under its new name, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.ReceiptsDir, "invoice.pdf")); !os.IsNotExist(err) {
+		t.Errorf("Expected the old receipt file to be removed, got: %v", err)
+	}
+	expenses, err := crud.ListExpenses(database)
+	if err != nil || len(expenses) != 3 {
+		t.Errorf("Expected expenses to be kept, got: %v (%v)", expenses, err)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "expenseflow.db")
+	database, err := db.ConnectDB(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+	if err := db.InitDB(dbPath, database); err != nil {
+		t.Fatalf("Failed to init database: %v", err)
+	}
+
+	var foreignKeys, busyTimeout int
+	var journalMode string
+	if err := database.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil || foreignKeys != 1 {
+		t.Errorf("Expected foreign keys to be enforced, got %d (%v)", foreignKeys, err)
+	}
+	if err := database.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil || busyTimeout != 5000 {
+		t.Errorf("Expected a busy timeout of 5000 ms, got %d (%v)", busyTimeout, err)
+	}
+	if err := database.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Errorf("Expected WAL journal mode, got %q (%v)", journalMode, err)
+	}
+
+	clientID, err := crud.CreateClient(database, GetValidClient())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	typeID, err := crud.CreateExpenseType(database, GetValidExpenseType())
+	if err != nil {
+		t.Fatalf("Failed to create expense type: %v", err)
+	}
+
+	// Writing a reference to a missing row is invalid
+	session := GetValidSession()
+	session.ClientID = clientID + 100
+	if _, err := crud.CreateSession(database, session); !errors.Is(err, utils.ErrValidation) {
+		t.Errorf("Expected a validation error on a missing client, got: %v", err)
+	}
+	expense := GetValidExpense()
+	expense.TypeID = typeID
+	expense.SessionID = sql.NullInt64{Int64: 100, Valid: true}
+	if _, err := crud.CreateExpense(database, expense); !errors.Is(err, utils.ErrValidation) {
+		t.Errorf("Expected a validation error on a missing session, got: %v", err)
+	}
+
+	// Deleting a referenced row is refused
+	session.ClientID = clientID
+	if _, err := crud.CreateSession(database, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := crud.DeleteClientByID(database, clientID); !errors.Is(err, utils.ErrReferenced) {
+		t.Errorf("Expected a referenced error deleting a client with a session, got: %v", err)
+	}
+}
+
+func TestListMigrations(t *testing.T) {
+	schemaFiles, err := db.ListMigrations(migrations.FS)
+	if err != nil || len(schemaFiles) == 0 || schemaFiles[0].File != "001_create_tables.sql" {
+		t.Fatalf("Expected the embedded schema files from 001, got: %v (%v)", schemaFiles, err)
+	}
+	last := schemaFiles[len(schemaFiles)-1]
+	if last.Version != len(schemaFiles) {
+		t.Errorf("Expected the last schema version to be %d, got: %+v", len(schemaFiles), last)
+	}
+
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	testCases := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"gap", fstest.MapFS{"001_a.sql": file, "003_c.sql": file}},
+		{"duplicate", fstest.MapFS{"001_a.sql": file, "002_b.sql": file, "002_c.sql": file}},
+		{"not numbered", fstest.MapFS{"001_a.sql": file, "b.sql": file}},
+		{"not from 1", fstest.MapFS{"002_b.sql": file}},
+	}
+	for _, tc := range testCases {
+		if _, err := db.ListMigrations(tc.files); err == nil {
+			t.Errorf("Expected an error on schema files with a %s", tc.name)
+		}
+	}
+	// Ordered by version, not by name
+	unpadded := fstest.MapFS{}
+	for i := 1; i <= 10; i++ {
+		unpadded[fmt.Sprintf("%d_step.sql", i)] = file
+	}
+	schemaFiles, err = db.ListMigrations(unpadded)
+	if err != nil || schemaFiles[9].File != "10_step.sql" {
+		t.Errorf("Expected 10_step.sql last, got: %v (%v)", schemaFiles, err)
+	}
+}
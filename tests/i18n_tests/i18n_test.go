@@ -0,0 +1,123 @@
+package i18n_tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+func TestNegotiate(t *testing.T) {
+    cases := []struct {
+        header   string
+        expected string
+    }{
+        {"", "en"},
+        {"fr-CH, fr;q=0.9, en;q=0.8", "fr"},
+        {"de-DE, en;q=0.5, fr;q=0.7", "fr"},
+        {"de, es", "en"},
+        {"fr;q=0, en", "en"},
+        {"*", "en"},
+        {"EN-us", "en"},
+    }
+    for _, tc := range cases {
+        if locale := i18n.Negotiate(tc.header, "en"); locale != tc.expected {
+            t.Errorf("expected %s for %q, got: %s", tc.expected, tc.header, locale)
+        }
+    }
+}
+
+func TestResolve(t *testing.T) {
+    t.Setenv("LC_ALL", "")
+    t.Setenv("LC_MESSAGES", "")
+    t.Setenv("LANG", "fr_FR.UTF-8")
+    if locale := i18n.Resolve(""); locale != "fr" {
+        t.Errorf("expected the locale of LANG, got: %s", locale)
+    }
+    if locale := i18n.Resolve("en-GB"); locale != "en" {
+        t.Errorf("expected the configured locale over LANG, got: %s", locale)
+    }
+    t.Setenv("LANG", "C.UTF-8")
+    if locale := i18n.Resolve(""); locale != i18n.DefaultLocale {
+        t.Errorf("expected the default locale, got: %s", locale)
+    }
+}
+
+func TestFormats(t *testing.T) {
+    en, fr := i18n.NewPrinter("en"), i18n.NewPrinter("fr")
+    date := time.Date(2024, 10, 3, 14, 30, 0, 0, time.UTC)
+    cases := []struct {
+        got      string
+        expected string
+    }{
+        {en.Number(1234567.891, 2), "1,234,567.89"},
+        {fr.Number(1234567.891, 2), "1\u00a0234\u00a0567,89"},
+        {en.Number(-950, 2), "-950.00"},
+        {fr.Number(-1000, 0), "-1\u00a0000"},
+        {en.Decimal(1234.5, 2), "1234.50"},
+        {fr.Decimal(1234.5, 2), "1234,50"},
+        {en.Percent(5.5), "5.50%"},
+        {fr.Percent(5.5), "5,50\u00a0%"},
+        {en.Date(date), "2024-10-03"},
+        {fr.Date(date), "03/10/2024"},
+        {fr.T("report.client", "ACME"), "Client : ACME"},
+        {i18n.NewPrinter("xx").T("report.client", "ACME"), "Client: ACME"},
+    }
+    for _, tc := range cases {
+        if tc.got != tc.expected {
+            t.Errorf("expected %q, got: %q", tc.expected, tc.got)
+        }
+    }
+    if fr.CSVComma() != ';' || en.CSVComma() != ',' {
+        t.Error("expected a ';' separated csv in french only")
+    }
+}
+
+func TestViolations(t *testing.T) {
+    v := utils.Validator{}
+    v.Required("location", false)
+    v.MaxLength("trip_start_location", "Lyon Part-Dieu", 5)
+    v.Positive("line_items[1].total", -3)
+    v.Check(
+        false, "end_at_date_time", utils.ViolationOrder, map[string]any{"after": "start_at_date_time"},
+        "start date must be before end date",
+    )
+    err := v.Err()
+
+    fr := i18n.NewPrinter("fr")
+    expected := "lieu est obligatoire; lieu de départ dépasse la limite de 5; " +
+        "total doit être strictement positif; date de fin doit être après date de début"
+    if message := fr.Error(err); message != expected {
+        t.Errorf("expected %q, got: %q", expected, message)
+    }
+    if message := i18n.NewPrinter("en").Error(err); message != err.Error() {
+        t.Errorf("expected the english messages of the violations, got: %q", message)
+    }
+
+    choice := utils.Violation{
+        Field: "applies_to", Code: utils.ViolationChoice,
+        Params: map[string]any{"allowed": []interface{}{"expense", "session"}},
+    }
+    if message := fr.Violation(choice); message != "s'applique à doit être parmi : expense, session" {
+        t.Errorf("unexpected message of a choice violation: %q", message)
+    }
+    if message := fr.Error(utils.NotFoundError("session not found")); message != "session not found" {
+        t.Errorf("expected the message of an error that is not a validation one, got: %q", message)
+    }
+}
+
+func TestTypeName(t *testing.T) {
+    fr := i18n.NewPrinter("fr")
+    switch {
+    case fr.TypeName("TOLL", "TOLLS") != "Péage":
+        t.Error("expected the french name of a standard type")
+    case i18n.NewPrinter("en").TypeName("TOLL", "PEAGE") != "Tolls":
+        t.Error("expected the english name of a standard type")
+    case fr.TypeName("", "Coworking") != "Coworking":
+        t.Error("expected the name of a type of the user")
+    case fr.TypeName("UNKNOWN", "Other") != "Other":
+        t.Error("expected the name of a standard type without translation")
+    }
+}
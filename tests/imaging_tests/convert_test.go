@@ -0,0 +1,160 @@
+package imaging_tests
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/imaging"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+// Stand-ins for pdftoppm and heif-convert: copy $FAKE_OUTPUT to the path the
+// real tool would write (last argument, plus ".png" for pdftoppm)
+func installFakeTools(t *testing.T, output []byte) {
+    bin := t.TempDir()
+    outputPath := filepath.Join(t.TempDir(), "output")
+    if err := os.WriteFile(outputPath, output, 0644); err != nil {
+        t.Fatalf("failed to write fake output: %v", err)
+    }
+    scripts := map[string]string{
+        "pdftoppm":     "#!/bin/sh\nfor last; do :; done\n/bin/cp \"$FAKE_OUTPUT\" \"$last.png\"\n",
+        "heif-convert": "#!/bin/sh\nfor last; do :; done\n/bin/cp \"$FAKE_OUTPUT\" \"$last\"\n",
+    }
+    for name, script := range scripts {
+        if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+            t.Fatalf("failed to write fake %s: %v", name, err)
+        }
+    }
+    t.Setenv("PATH", bin)
+    t.Setenv("FAKE_OUTPUT", outputPath)
+}
+
+func useTempReceiptsDir(t *testing.T) {
+    receiptsDir, maxSide, quality, thumbnailSide :=
+        config.ReceiptsDir, config.ReceiptMaxSide, config.ReceiptQuality, config.ThumbnailSide
+    t.Cleanup(func() {
+        config.ReceiptsDir, config.ReceiptMaxSide, config.ReceiptQuality, config.ThumbnailSide =
+            receiptsDir, maxSide, quality, thumbnailSide
+    })
+    tests.SetReceiptsDir(t, t.TempDir())
+    config.ReceiptMaxSide, config.ReceiptQuality, config.ThumbnailSide = 2000, 85, 16
+}
+
+func writeSource(t *testing.T, name string, data []byte) string {
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, data, 0644); err != nil {
+        t.Fatalf("failed to write %s: %v", name, err)
+    }
+    return path
+}
+
+func TestStorePDFReceipt(t *testing.T) {
+    useTempReceiptsDir(t)
+    var page bytes.Buffer
+    if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 60, 80))); err != nil {
+        t.Fatalf("failed to encode page: %v", err)
+    }
+    installFakeTools(t, page.Bytes())
+
+    pdf := []byte("%PDF-1.7\n1 0 obj <<>> endobj\n%%EOF\n")
+    relPath, err := db.StoreReceipt(writeSource(t, "Invoice.PDF", pdf))
+    if err != nil {
+        t.Fatalf("failed to store PDF receipt: %v", err)
+    }
+    stored, err := os.ReadFile(filepath.Join(config.ReceiptsDir, relPath))
+    if err != nil || !bytes.Equal(stored, pdf) || filepath.Ext(relPath) != ".pdf" {
+        t.Errorf("expected the PDF to be stored as is, got: %s (%v)", relPath, err)
+    }
+    for _, derived := range []string{db.ReceiptPreviewRelPath(relPath), db.ReceiptThumbnailRelPath(relPath)} {
+        if _, err := os.Stat(filepath.Join(config.ReceiptsDir, derived)); err != nil {
+            t.Errorf("expected %s to be generated: %v", derived, err)
+        }
+    }
+
+    // Without poppler the PDF is still stored, without preview
+    tests.SetReceiptsDir(t, t.TempDir())
+    t.Setenv("PATH", t.TempDir())
+    relPath, err = db.StoreReceipt(writeSource(t, "invoice.pdf", pdf))
+    if err != nil {
+        t.Fatalf("expected PDF stored without preview, got: %v", err)
+    }
+    preview := filepath.Join(config.ReceiptsDir, db.ReceiptPreviewRelPath(relPath))
+    if _, err := os.Stat(preview); err == nil {
+        t.Error("expected no preview without pdftoppm")
+    }
+}
+
+func TestStoreHEICReceipt(t *testing.T) {
+    useTempReceiptsDir(t)
+    installFakeTools(t, sidewaysJPEG(t, 6))
+
+    heic := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+    relPath, err := db.StoreReceipt(writeSource(t, "IMG_0042.HEIC", heic))
+    if err != nil {
+        t.Fatalf("failed to store HEIC receipt: %v", err)
+    }
+    if !strings.HasSuffix(relPath, ".jpg") {
+        t.Errorf("expected HEIC converted to JPEG, got: %s", relPath)
+    }
+    stored, err := os.ReadFile(filepath.Join(config.ReceiptsDir, relPath))
+    if err != nil || bytes.Contains(stored, []byte("Exif")) {
+        t.Errorf("expected converted receipt without EXIF (%v)", err)
+    }
+    if db.ReceiptPreviewRelPath(relPath) != relPath {
+        t.Errorf("expected an image receipt to be its own preview")
+    }
+
+    t.Setenv("PATH", t.TempDir())
+    if _, err := imaging.ConvertHEIC(heic); !errors.Is(err, imaging.ErrMissingTool) {
+        t.Errorf("expected ErrMissingTool, got: %v", err)
+    }
+    _, err = db.StoreReceipt(writeSource(t, "IMG_0043.HEIC", append(heic, 0)))
+    var missing *imaging.MissingToolError
+    if !errors.As(err, &missing) || !slices.Contains(missing.Tools, "heif-convert") ||
+        !strings.Contains(err.Error(), "heif-convert") {
+        t.Errorf("expected an error naming heif-convert, got: %v", err)
+    }
+}
+
+// A receipt failing after its preview is written leaves no file behind
+func TestStoreReceiptCleanup(t *testing.T) {
+    useTempReceiptsDir(t)
+    var page bytes.Buffer
+    if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 60, 80))); err != nil {
+        t.Fatalf("failed to encode page: %v", err)
+    }
+    installFakeTools(t, page.Bytes())
+
+    src := writeSource(t, "invoice.pdf", []byte("%PDF-1.7\n1 0 obj <<>> endobj\n%%EOF\n"))
+    relPath, err := db.StoreReceipt(src)
+    if err != nil {
+        t.Fatalf("failed to store receipt: %v", err)
+    }
+    if err := db.RemoveReceiptFiles(relPath); err != nil {
+        t.Fatalf("failed to remove receipt files: %v", err)
+    }
+
+    // The thumbnail can't be written: a directory is in its place
+    thumbnail := filepath.Join(config.ReceiptsDir, db.ReceiptThumbnailRelPath(relPath))
+    if err := os.Mkdir(thumbnail, 0755); err != nil {
+        t.Fatalf("failed to block thumbnail path: %v", err)
+    }
+    if _, err := db.StoreReceipt(src); err == nil {
+        t.Fatal("expected error writing the thumbnail over a directory")
+    }
+    for _, derived := range []string{relPath, db.ReceiptPreviewRelPath(relPath)} {
+        if _, err := os.Stat(filepath.Join(config.ReceiptsDir, derived)); !os.IsNotExist(err) {
+            t.Errorf("expected %s of the failed receipt to be removed (%v)", derived, err)
+        }
+    }
+}
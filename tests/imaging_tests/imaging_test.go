@@ -0,0 +1,179 @@
+package imaging_tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/imaging"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+var (
+    red  = color.RGBA{255, 0, 0, 255}
+    blue = color.RGBA{0, 0, 255, 255}
+)
+
+// 40x20 blue picture with a red square in the top left corner, as stored by
+// a phone held sideways: EXIF orientation plus a GPS-ish payload
+func sidewaysJPEG(t *testing.T, orientation uint16) []byte {
+    img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+    for y := 0; y < 20; y++ {
+        for x := 0; x < 40; x++ {
+            img.Set(x, y, blue)
+            if x < 10 && y < 10 {
+                img.Set(x, y, red)
+            }
+        }
+    }
+    var buffer bytes.Buffer
+    if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 95}); err != nil {
+        t.Fatalf("failed to encode test JPEG: %v", err)
+    }
+
+    // TIFF header, IFD0 with one orientation entry
+    tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+    entry := make([]byte, 12)
+    binary.BigEndian.PutUint16(entry[0:], 0x0112)
+    binary.BigEndian.PutUint16(entry[2:], 3) // SHORT
+    binary.BigEndian.PutUint32(entry[4:], 1)
+    binary.BigEndian.PutUint16(entry[8:], orientation)
+    tiff = append(tiff, entry...)
+    tiff = append(tiff, 0, 0, 0, 0)
+    tiff = append(tiff, []byte("GPS 44.8378N 0.5792W")...)
+
+    payload := append([]byte("Exif\x00\x00"), tiff...)
+    segment := []byte{0xFF, 0xE1, 0, 0}
+    binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+    segment = append(segment, payload...)
+
+    data := buffer.Bytes()
+    withExif := append([]byte{}, data[:2]...)
+    withExif = append(withExif, segment...)
+    return append(withExif, data[2:]...)
+}
+
+func isRed(c color.Color) bool {
+    r, g, b, _ := c.RGBA()
+    return r > 0xC000 && g < 0x4000 && b < 0x4000
+}
+
+func TestOrientation(t *testing.T) {
+    for _, orientation := range []uint16{1, 3, 6, 8} {
+        if got := imaging.Orientation(sidewaysJPEG(t, orientation)); got != int(orientation) {
+            t.Errorf("expected orientation %d, got: %d", orientation, got)
+        }
+    }
+    if got := imaging.Orientation([]byte("not a jpeg")); got != 1 {
+        t.Errorf("expected orientation 1 for invalid data, got: %d", got)
+    }
+}
+
+func TestProcessRotatesAndStripsExif(t *testing.T) {
+    data := sidewaysJPEG(t, 6)
+    result, err := imaging.Process(data, imaging.Options{Quality: 95, ThumbnailSide: 8})
+    if err != nil {
+        t.Fatalf("failed to process JPEG: %v", err)
+    }
+
+    if bytes.Contains(result.Data, []byte("Exif")) || bytes.Contains(result.Data, []byte("GPS")) {
+        t.Error("expected EXIF metadata to be stripped")
+    }
+    if result.Ext != ".jpg" || result.Width != 20 || result.Height != 40 {
+        t.Errorf("expected 20x40 .jpg, got: %dx%d %s", result.Width, result.Height, result.Ext)
+    }
+    img, err := jpeg.Decode(bytes.NewReader(result.Data))
+    if err != nil {
+        t.Fatalf("failed to decode processed JPEG: %v", err)
+    }
+    // A clockwise turn moves the top left corner to the top right
+    if !isRed(img.At(15, 4)) || isRed(img.At(4, 4)) {
+        t.Errorf("expected red square in the top right corner")
+    }
+
+    thumbnail, err := jpeg.Decode(bytes.NewReader(result.Thumbnail))
+    if err != nil {
+        t.Fatalf("failed to decode thumbnail: %v", err)
+    }
+    if bounds := thumbnail.Bounds(); bounds.Dx() != 4 || bounds.Dy() != 8 {
+        t.Errorf("expected 4x8 thumbnail, got: %dx%d", bounds.Dx(), bounds.Dy())
+    }
+}
+
+func TestProcessUprightJPEGIsNotReencoded(t *testing.T) {
+    data := sidewaysJPEG(t, 1)
+    result, err := imaging.Process(data, imaging.Options{MaxSide: 100})
+    if err != nil {
+        t.Fatalf("failed to process JPEG: %v", err)
+    }
+    stripped, err := imaging.StripJPEGMetadata(data)
+    if err != nil {
+        t.Fatalf("failed to strip JPEG: %v", err)
+    }
+    if !bytes.Equal(result.Data, stripped) || bytes.Contains(result.Data, []byte("Exif")) {
+        t.Error("expected upright JPEG to only lose its metadata")
+    }
+    if result.Thumbnail != nil {
+        t.Error("expected no thumbnail when disabled")
+    }
+}
+
+func TestResize(t *testing.T) {
+    img := image.NewRGBA(image.Rect(0, 0, 300, 100))
+    resized := imaging.Resize(img, 60)
+    if bounds := resized.Bounds(); bounds.Dx() != 60 || bounds.Dy() != 20 {
+        t.Errorf("expected 60x20, got: %dx%d", bounds.Dx(), bounds.Dy())
+    }
+    if imaging.Resize(img, 500) != image.Image(img) || imaging.Resize(img, 0) != image.Image(img) {
+        t.Error("expected small enough images to be left as is")
+    }
+}
+
+func TestStoreReceiptWritesThumbnail(t *testing.T) {
+    receiptsDir, maxSide, quality, thumbnailSide :=
+        config.ReceiptsDir, config.ReceiptMaxSide, config.ReceiptQuality, config.ThumbnailSide
+    defer func() {
+        config.ReceiptsDir, config.ReceiptMaxSide, config.ReceiptQuality, config.ThumbnailSide =
+            receiptsDir, maxSide, quality, thumbnailSide
+    }()
+    tests.SetReceiptsDir(t, t.TempDir())
+    config.ReceiptMaxSide, config.ReceiptQuality, config.ThumbnailSide = 30, 85, 10
+
+    srcPath := filepath.Join(t.TempDir(), "IMG_0001.JPEG")
+    if err := os.WriteFile(srcPath, sidewaysJPEG(t, 8), 0644); err != nil {
+        t.Fatalf("failed to write source receipt: %v", err)
+    }
+    relPath, err := db.StoreReceipt(srcPath)
+    if err != nil {
+        t.Fatalf("failed to store receipt: %v", err)
+    }
+    if filepath.Ext(relPath) != ".jpg" {
+        t.Errorf("expected .jpg receipt, got: %s", relPath)
+    }
+
+    stored, err := os.ReadFile(filepath.Join(config.ReceiptsDir, relPath))
+    if err != nil {
+        t.Fatalf("failed to read stored receipt: %v", err)
+    }
+    storedConfig, err := jpeg.DecodeConfig(bytes.NewReader(stored))
+    if err != nil || storedConfig.Width != 15 || storedConfig.Height != 30 {
+        t.Errorf("expected 15x30 stored receipt, got: %+v (%v)", storedConfig, err)
+    }
+    thumbnailPath := filepath.Join(config.ReceiptsDir, db.ReceiptThumbnailRelPath(relPath))
+    if _, err := os.Stat(thumbnailPath); err != nil {
+        t.Errorf("expected thumbnail: %v", err)
+    }
+
+    again, err := db.StoreReceipt(srcPath)
+    if err != nil || again != relPath {
+        t.Errorf("expected same receipt stored once, got: %s (%v)", again, err)
+    }
+}
@@ -0,0 +1,138 @@
+package logging_tests
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/logging"
+	"github.com/craftidev/expenseflow/internal/utils"
+)
+
+
+func TestRotatingFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "expenseflow.log")
+    file, err := logging.OpenRotatingFile(path, 100, 2)
+    if err != nil {
+        t.Fatalf("failed to open log file: %v", err)
+    }
+    line := []byte(strings.Repeat("x", 59) + "\n")
+    for i := 0; i < 5; i++ {
+        if _, err := file.Write(line); err != nil {
+            t.Fatalf("failed to write log: %v", err)
+        }
+    }
+    if err := file.Close(); err != nil {
+        t.Fatalf("failed to close log file: %v", err)
+    }
+
+    for _, name := range []string{"expenseflow.log", "expenseflow.log.1", "expenseflow.log.2"} {
+        info, err := os.Stat(filepath.Join(filepath.Dir(path), name))
+        if err != nil {
+            t.Errorf("expected %s kept: %v", name, err)
+        } else if info.Size() > 100 {
+            t.Errorf("expected %s under the max size, got: %d bytes", name, info.Size())
+        }
+    }
+    if _, err := os.Stat(path + ".3"); err == nil {
+        t.Errorf("expected only 2 rotated files kept")
+    }
+}
+
+func TestRedaction(t *testing.T) {
+    var output bytes.Buffer
+    handler, err := logging.NewHandler(&output, slog.LevelInfo, logging.FormatJSON)
+    if err != nil {
+        t.Fatalf("failed to create handler: %v", err)
+    }
+    previous := slog.Default()
+    slog.SetDefault(slog.New(handler))
+    defer slog.SetDefault(previous)
+
+    expense := db.Expense{ID: 7, Currency: "EUR", Notes: sql.NullString{String: "dinner with Alice", Valid: true}}
+    slog.Info("expense created", "expense", expense, "token", "secret-token")
+    err = utils.LogError("unable to create expense: %v", &expense)
+    if !strings.Contains(err.Error(), "dinner with Alice") {
+        t.Errorf("expected the returned error to keep the notes, got: %v", err)
+    }
+    slog.Debug("not logged at info level")
+
+    lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("expected 2 records, got: %q", output.String())
+    }
+    for _, secret := range []string{"dinner with Alice", "secret-token"} {
+        if strings.Contains(output.String(), secret) {
+            t.Errorf("expected %q redacted, got: %s", secret, output.String())
+        }
+    }
+
+    var record struct {
+        Level   string
+        Msg     string
+        Source  struct{ File string }
+        Expense map[string]any
+    }
+    if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+        t.Fatalf("expected a JSON record, got: %v", err)
+    }
+    if record.Level != "INFO" || record.Expense["id"] != 7.0 || record.Expense["currency"] != "EUR" {
+        t.Errorf("expected the IDs and amounts kept, got: %+v", record)
+    }
+    if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+        t.Fatalf("expected a JSON record, got: %v", err)
+    }
+    if record.Level != "ERROR" || !strings.HasSuffix(record.Source.File, "logging_test.go") {
+        t.Errorf("expected an error attributed to its caller, got: %+v", record)
+    }
+}
+
+// User values quoted in error messages stay out of the logs
+func TestUserValues(t *testing.T) {
+    var output bytes.Buffer
+    handler, err := logging.NewHandler(&output, slog.LevelInfo, logging.FormatJSON)
+    if err != nil {
+        t.Fatalf("failed to create handler: %v", err)
+    }
+    previous := slog.Default()
+    slog.SetDefault(slog.New(handler))
+    defer slog.SetDefault(previous)
+
+    err = utils.ConflictError("client name already exists: %s", logging.UserValue("Alice Martin"))
+    if err.Error() != "client name already exists: Alice Martin" {
+        t.Errorf("expected the returned error to keep the name, got: %v", err)
+    }
+    v := utils.Validator{}
+    v.Choice("currency", "Bob's secret", []string{"EUR", "USD"})
+    v.Range("total", 123456.78, 0, 1000)
+    err = v.Err()
+    if !strings.Contains(err.Error(), "Bob's secret") || !strings.Contains(err.Error(), "123456.78") {
+        t.Errorf("expected the returned error to quote the values, got: %v", err)
+    }
+
+    for _, secret := range []string{"Alice Martin", "Bob's secret", "123456.78"} {
+        if strings.Contains(output.String(), secret) {
+            t.Errorf("expected %q out of the logs, got: %s", secret, output.String())
+        }
+    }
+    lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("expected 2 records, got: %q", output.String())
+    }
+    var record struct {
+        Level      string
+        Violations []string
+    }
+    if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+        t.Fatalf("expected a JSON record, got: %v", err)
+    }
+    if record.Level != "WARN" || len(record.Violations) != 2 || record.Violations[0] != "currency: not_allowed" {
+        t.Errorf("expected a warning with the violated rules, got: %+v", record)
+    }
+}
@@ -0,0 +1,77 @@
+package models_tests
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/craftidev/expenseflow/internal/db"
+)
+
+
+func percent(sessionID int64, value float64) db.Allocation {
+    return db.Allocation{
+        ExpenseID: 1, SessionID: sessionID, Percentage: sql.NullFloat64{Float64: value, Valid: true},
+    }
+}
+
+func amount(sessionID int64, value float64) db.Allocation {
+    return db.Allocation{
+        ExpenseID: 1, SessionID: sessionID, Amount: sql.NullFloat64{Float64: value, Valid: true},
+    }
+}
+
+func TestAllocationValidation(t *testing.T) {
+    valid := []db.Allocation{percent(1, 100), percent(1, 0.5), amount(1, 12.5)}
+    for _, allocation := range valid {
+        if err := allocation.PreInsertValid(); err != nil {
+            t.Errorf("expected %v to be valid, got: %v", allocation, err)
+        }
+    }
+
+    both := percent(1, 50)
+    both.Amount = sql.NullFloat64{Float64: 10, Valid: true}
+    invalid := []db.Allocation{
+        percent(0, 50),
+        percent(1, 0),
+        percent(1, 100.5),
+        amount(1, -3),
+        both,
+        {ExpenseID: 1, SessionID: 1},
+    }
+    for _, allocation := range invalid {
+        if err := allocation.PreInsertValid(); err == nil {
+            t.Errorf("expected %v to be rejected", allocation)
+        }
+    }
+    if err := percent(1, 50).Valid(); err == nil {
+        t.Errorf("expected an allocation without ID to be rejected by Valid")
+    }
+}
+
+func TestAllocationListShares(t *testing.T) {
+    // A third each: the missing cent goes to one of them
+    shares, err := db.AllocationList{
+        percent(1, 100.0/3), percent(2, 100.0/3), percent(3, 100.0/3),
+    }.Shares(100)
+    if err != nil {
+        t.Fatalf("expected no error, got: %v", err)
+    }
+    if sum := shares[1] + shares[2] + shares[3]; sum < 99.999 || sum > 100.001 {
+        t.Errorf("expected shares to add up to 100, got: %v", shares)
+    }
+
+    shares, err = db.AllocationList{percent(1, 60), amount(2, 48)}.Shares(120)
+    if err != nil || shares[1] != 72 || shares[2] != 48 {
+        t.Errorf("expected 72 and 48, got: %v (%v)", shares, err)
+    }
+
+    if _, err := (db.AllocationList{percent(1, 60), amount(2, 40)}).Shares(120); err == nil {
+        t.Errorf("expected allocations under the total to be rejected")
+    }
+    if _, err := (db.AllocationList{percent(1, 50), percent(1, 50)}).Shares(120); err == nil {
+        t.Errorf("expected a session allocated twice to be rejected")
+    }
+    if shares, err := (db.AllocationList{}).Shares(120); err != nil || len(shares) != 0 {
+        t.Errorf("expected no share without allocation, got: %v (%v)", shares, err)
+    }
+}
@@ -1,8 +1,11 @@
 package models_tests
 
 import (
+	"errors"
+	"slices"
 	"testing"
 
+	"github.com/craftidev/expenseflow/internal/utils"
 	"github.com/craftidev/expenseflow/tests"
 )
 
@@ -28,8 +31,9 @@ func TestClientValidation(t *testing.T) {
     // Test case with invalid client (zero name)
     client.ID = 1
     client.Name = ""
-    if err := client.Valid(); err == nil {
-        t.Error("expected error for invalid client with zero name")
+    err := client.Valid()
+    if !errors.Is(err, utils.ErrValidation) || !slices.Equal(utils.ErrorFields(err), []string{"name"}) {
+        t.Errorf("expected a validation error on the name, got: %v", err)
     }
 
     // Test case with invalid client (name lenght > 100 runes)
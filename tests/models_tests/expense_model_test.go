@@ -1,12 +1,10 @@
 package models_tests
 
 import (
-	"os"
-	"path/filepath"
+	"database/sql"
 	"testing"
 	"time"
 
-	"github.com/craftidev/expenseflow/config"
 	"github.com/craftidev/expenseflow/internal/db"
 	"github.com/craftidev/expenseflow/tests"
 )
@@ -26,13 +24,6 @@ func TestExpensePreInsertValid(t *testing.T) {
 		t.Errorf("expected valid expense with zero-valued SessionID, got error: %v", err)
 	}
 
-	// Nullable ReceiptRelPath
-	validExpense.ReceiptRelPath.Valid = false
-	err = validExpense.PreInsertValid()
-	if err != nil {
-		t.Errorf("expected valid expense with zero-valued ReceiptRelPath, got error: %v", err)
-	}
-
 	// Nullable Notes
 	validExpense.Notes.Valid = false
 	err = validExpense.PreInsertValid()
@@ -48,11 +39,11 @@ func TestExpensePreInsertValid(t *testing.T) {
 	invalidExpenses[3].TypeID = -1
 	invalidExpenses[4].Currency = ""
 	invalidExpenses[5].Currency = "a" + string(make([]rune, 10))
-	invalidExpenses[6].ReceiptRelPath.String = ""
-	invalidExpenses[7].ReceiptRelPath.String = "a" + string(make([]rune, 50))
-	invalidExpenses[8].Notes.String = ""
-	invalidExpenses[9].Notes.String = "a" + string(make([]rune, 150))
-	invalidExpenses[10].DateTime = time.Time{}
+	invalidExpenses[6].Notes.String = ""
+	invalidExpenses[7].Notes.String = "a" + string(make([]rune, 150))
+	invalidExpenses[8].DateTime = time.Time{}
+	invalidExpenses[9].TimeZone = sql.NullString{String: "Europe/Atlantis", Valid: true}
+	invalidExpenses[10].TimeZone = sql.NullString{String: "Local", Valid: true}
 	tests.ValidateEntities(t, invalidExpenses, true, func(e db.Expense) error {
 		return e.PreInsertValid()
 	})
@@ -73,29 +64,24 @@ func TestValid(t *testing.T) {
 
 // Don't re-test what's already tested in PreInsertValid or Valid
 func TestPreReportValid(t *testing.T) {
-	// Valid Expense
+	tests.SetReceiptsDir(t, tests.ReceiptsDirTest)
 	validExpense := tests.GetValidExpense()
+	validReceipt := tests.GetValidReceipt()
 
-	invalidExpenses := tests.InitializeSliceOfValidAny(4, validExpense)
-	invalidExpenses[0].ReceiptRelPath.String = "non_exitent_file.png"
-	invalidExpenses[1].ReceiptRelPath.String = "invalid_receipt_test.txt"
-	invalidExpenses[2].ReceiptRelPath.String = "corrupted_receipt_test.png"
-	invalidExpenses[3].ReceiptRelPath.String = "protected_receipt_test.png"
-
-	// Set permissions to 000 to create a protected file
-	protectedFilePath := filepath.Join(config.ReceiptsDirTest, invalidExpenses[3].ReceiptRelPath.String)
-	err := os.Chmod(protectedFilePath, 0000)
-	if err != nil {
-		t.Fatalf("failed to set file permissions before testing: %v", err)
+	if err := validExpense.PreReportValid(db.ReceiptList{validReceipt}); err != nil {
+		t.Errorf("expected valid expense for report, got error: %v", err)
 	}
 
-	tests.ValidateEntities(t, invalidExpenses, true, func(e db.Expense) error {
-		return e.PreReportValid()
-	})
-
-	// Restore permissions after the test
-	err = os.Chmod(protectedFilePath, 0644)
-	if err != nil {
-		t.Fatalf("failed to restore file permissions: %v", err)
+	otherExpenseReceipt := validReceipt
+	otherExpenseReceipt.ExpenseID = 2
+	missingFileReceipt := validReceipt
+	missingFileReceipt.RelPath = "non_exitent_file.png"
+	invalidReceipts := []db.ReceiptList{
+		nil,
+		{otherExpenseReceipt},
+		{validReceipt, missingFileReceipt},
 	}
+	tests.ValidateEntities(t, invalidReceipts, true, func(rl db.ReceiptList) error {
+		return validExpense.PreReportValid(rl)
+	})
 }
@@ -1,6 +1,8 @@
 package models_tests
 
 import (
+	"database/sql"
+	"slices"
 	"testing"
 
 	"github.com/craftidev/expenseflow/internal/db"
@@ -17,14 +19,34 @@ func TestExpenseTypePreInsertValid(t *testing.T) {
         return et.PreInsertValid()
     })
 
-    invalidExpenseTypes := tests.InitializeSliceOfValidAny(2, validExpenseType)
+    invalidExpenseTypes := tests.InitializeSliceOfValidAny(7, validExpenseType)
     invalidExpenseTypes[0].Name = ""
     invalidExpenseTypes[1].Name = "a" + string(make([]rune, 50))
+    invalidExpenseTypes[2].DefaultTaxeRates = db.TaxeRateList{-1}
+    invalidExpenseTypes[3].DefaultTaxeRates = db.TaxeRateList{61}
+    invalidExpenseTypes[4].DefaultTaxeRates = db.TaxeRateList{1, 2, 3, 4, 5, 6}
+    invalidExpenseTypes[5].AccountingCode = sql.NullString{String: "", Valid: true}
+    invalidExpenseTypes[6].AccountingCode = sql.NullString{
+        String: "a" + string(make([]rune, 20)), Valid: true,
+    }
     tests.ValidateEntities(t, invalidExpenseTypes, true, func(et db.ExpenseType) error {
         return et.PreInsertValid()
     })
 }
 
+func TestTaxeRateListScan(t *testing.T) {
+    var rates db.TaxeRateList
+    if err := rates.Scan("5.5,20"); err != nil || !slices.Equal(rates, db.TaxeRateList{5.5, 20}) {
+        t.Errorf("expected [5.5 20], got: %v (%v)", rates, err)
+    }
+    if err := rates.Scan(nil); err != nil || rates != nil {
+        t.Errorf("expected nil rates from NULL, got: %v (%v)", rates, err)
+    }
+    if err := rates.Scan("5.5,abc"); err == nil {
+        t.Error("expected an error on invalid rates")
+    }
+}
+
 func TestExpenseTypeValid(t *testing.T) {
     validExpenseType := tests.GetValidExpenseType()
 
@@ -35,3 +57,24 @@ func TestExpenseTypeValid(t *testing.T) {
         return et.Valid()
     })
 }
+
+func TestExpenseTypeStandardKey(t *testing.T) {
+    ref := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+    testCases := []struct {
+        expenseType db.ExpenseType
+        expected    string
+    }{
+        {db.ExpenseType{Name: "PEAGE", ModelRef: ref("fr:TOLL")}, "TOLL"},
+        {db.ExpenseType{Name: "MAUT", ModelRef: ref("de:TOLL")}, "TOLL"},
+        {db.ExpenseType{Name: "Autoroute", ModelRef: ref("fr:TOLL")}, ""}, // renamed
+        {db.ExpenseType{Name: "PEAGE", ModelRef: ref("fr:UNKNOWN")}, ""},
+        {db.ExpenseType{Name: "PEAGE", ModelRef: ref("xx:TOLL")}, ""},
+        {db.ExpenseType{Name: "PEAGE", ModelRef: ref("TOLL")}, ""},
+        {db.ExpenseType{Name: "PEAGE"}, ""},
+    }
+    for _, tc := range testCases {
+        if key := tc.expenseType.StandardKey(); key != tc.expected {
+            t.Errorf("expected key %q for %+v, got %q", tc.expected, tc.expenseType, key)
+        }
+    }
+}
@@ -0,0 +1,105 @@
+package models_tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestReceiptPreInsertValid(t *testing.T) {
+    validReceipt := tests.GetValidReceipt()
+
+    validReceipts := tests.InitializeSliceOfValidAny(2, validReceipt)
+    validReceipts[1].ID = 0
+    tests.ValidateEntities(t, validReceipts, false, func(r db.Receipt) error {
+        return r.PreInsertValid()
+    })
+
+    invalidReceipts := tests.InitializeSliceOfValidAny(6, validReceipt)
+    invalidReceipts[0].ExpenseID = 0
+    invalidReceipts[1].ExpenseID = -1
+    invalidReceipts[2].RelPath = ""
+    invalidReceipts[3].RelPath = "a" + string(make([]rune, 50))
+    invalidReceipts[4].RelPath = "../valid_receipt_test.png"
+    invalidReceipts[5].Position = -1
+    tests.ValidateEntities(t, invalidReceipts, true, func(r db.Receipt) error {
+        return r.PreInsertValid()
+    })
+}
+
+func TestReceiptValid(t *testing.T) {
+    validReceipt := tests.GetValidReceipt()
+
+    invalidReceipts := tests.InitializeSliceOfValidAny(2, validReceipt)
+    invalidReceipts[0].ID = -1
+    invalidReceipts[1].ID = 0
+    tests.ValidateEntities(t, invalidReceipts, true, func(r db.Receipt) error {
+        return r.Valid()
+    })
+}
+
+func TestReceiptCheckFile(t *testing.T) {
+    tests.SetReceiptsDir(t, tests.ReceiptsDirTest)
+    validReceipt := tests.GetValidReceipt()
+    if err := validReceipt.CheckFile(); err != nil {
+        t.Errorf("expected valid receipt file, got error: %v", err)
+    }
+
+    invalidReceipts := tests.InitializeSliceOfValidAny(4, validReceipt)
+    invalidReceipts[0].RelPath = "non_exitent_file.png"
+    invalidReceipts[1].RelPath = "invalid_receipt_test.txt"
+    invalidReceipts[2].RelPath = "corrupted_receipt_test.png"
+    invalidReceipts[3].RelPath = "protected_receipt_test.png"
+
+    // Set permissions to 000 to create a protected file
+    protectedFilePath := filepath.Join(tests.ReceiptsDirTest, invalidReceipts[3].RelPath)
+    err := os.Chmod(protectedFilePath, 0000)
+    if err != nil {
+        t.Fatalf("failed to set file permissions before testing: %v", err)
+    }
+
+    if os.Geteuid() == 0 { // root reads it anyway
+        invalidReceipts = invalidReceipts[:3]
+    }
+    tests.ValidateEntities(t, invalidReceipts, true, func(r db.Receipt) error {
+        return r.CheckFile()
+    })
+
+    // Restore permissions after the test
+    err = os.Chmod(protectedFilePath, 0644)
+    if err != nil {
+        t.Fatalf("failed to restore file permissions: %v", err)
+    }
+}
+
+func TestReceiptContentType(t *testing.T) {
+    dir := t.TempDir()
+    files := map[string]string{
+        "invoice.pdf": "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n",
+        "photo.heic":  "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic",
+        "notes.txt":   "not a receipt",
+    }
+    for name, header := range files {
+        if err := os.WriteFile(filepath.Join(dir, name), []byte(header), 0644); err != nil {
+            t.Fatalf("failed to write %s: %v", name, err)
+        }
+    }
+
+    expected := map[string]string{
+        "invoice.pdf": "application/pdf",
+        "photo.heic":  "image/heic",
+    }
+    for name, contentType := range expected {
+        got, err := db.ReceiptContentType(filepath.Join(dir, name))
+        if err != nil || got != contentType {
+            t.Errorf("expected %s for %s, got: %q (%v)", contentType, name, got, err)
+        }
+    }
+    if _, err := db.ReceiptContentType(filepath.Join(dir, "notes.txt")); err == nil {
+        t.Error("expected error on a text file")
+    }
+}
@@ -0,0 +1,95 @@
+package models_tests
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+)
+
+
+func TestParseSchedule(t *testing.T) {
+    valid := map[string]string{
+        "FREQ=MONTHLY":                                "FREQ=MONTHLY",
+        "RRULE:freq=monthly;interval=1;bymonthday=-1": "FREQ=MONTHLY;BYMONTHDAY=-1",
+        "FREQ=WEEKLY;BYDAY=FR,MO;INTERVAL=2":          "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+        "FREQ=YEARLY;COUNT=3;UNTIL=20301231":          "FREQ=YEARLY;COUNT=3;UNTIL=2030-12-31",
+        "FREQ=DAILY;UNTIL=2030-12-31;":                "FREQ=DAILY;UNTIL=2030-12-31",
+    }
+    for rule, expected := range valid {
+        schedule, err := db.ParseSchedule(rule)
+        if err != nil || schedule.String() != expected {
+            t.Errorf("expected %q to parse as %q, got %q (error: %v)", rule, expected, schedule, err)
+        }
+    }
+
+    invalid := []string{
+        "",
+        "FREQ=HOURLY",
+        "INTERVAL=2",
+        "FREQ=MONTHLY;INTERVAL=0",
+        "FREQ=MONTHLY;BYMONTHDAY=32",
+        "FREQ=WEEKLY;BYMONTHDAY=1",
+        "FREQ=MONTHLY;BYDAY=MO",
+        "FREQ=WEEKLY;BYDAY=MO,XX",
+        "FREQ=WEEKLY;BYDAY=MO,MO",
+        "FREQ=DAILY;UNTIL=2030-13-01",
+        "FREQ=DAILY;FREQ=WEEKLY",
+        "FREQ=DAILY;BYHOUR=9",
+        "FREQ",
+    }
+    for _, rule := range invalid {
+        if schedule, err := db.ParseSchedule(rule); err == nil {
+            t.Errorf("expected %q to be rejected, got %q", rule, schedule)
+        }
+    }
+}
+
+func TestScheduleOccurrences(t *testing.T) {
+    cases := []struct {
+        rule     string
+        start    string
+        to       string
+        expected []string
+    }{
+        // Month end: shorter months get their last day
+        {"FREQ=MONTHLY", "2024-01-31", "2024-04-30",
+            []string{"2024-01-31", "2024-02-29", "2024-03-31", "2024-04-30"}},
+        {"FREQ=MONTHLY;BYMONTHDAY=5;INTERVAL=2", "2024-01-10", "2024-08-01",
+            []string{"2024-03-05", "2024-05-05", "2024-07-05"}},
+        {"FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=2", "2024-11-15", "2025-12-31",
+            []string{"2024-11-30", "2024-12-31"}},
+        // 2024-04-03 is a Wednesday
+        {"FREQ=WEEKLY;BYDAY=MO,FR", "2024-04-03", "2024-04-15",
+            []string{"2024-04-05", "2024-04-08", "2024-04-12", "2024-04-15"}},
+        {"FREQ=WEEKLY;INTERVAL=2", "2024-04-03", "2024-05-01",
+            []string{"2024-04-03", "2024-04-17", "2024-05-01"}},
+        {"FREQ=WEEKLY;BYDAY=SU", "2024-04-07", "2024-04-14",
+            []string{"2024-04-07", "2024-04-14"}},
+        {"FREQ=DAILY;INTERVAL=10;UNTIL=2024-01-25", "2024-01-01", "2024-12-31",
+            []string{"2024-01-01", "2024-01-11", "2024-01-21"}},
+        {"FREQ=YEARLY", "2024-02-29", "2026-03-01",
+            []string{"2024-02-29", "2025-02-28", "2026-02-28"}},
+        {"FREQ=MONTHLY", "2024-05-01", "2024-04-30", nil},
+    }
+    for _, c := range cases {
+        schedule, err := db.ParseSchedule(c.rule)
+        if err != nil {
+            t.Fatalf("expected %q to parse, got: %v", c.rule, err)
+        }
+        start, _ := time.Parse(time.DateOnly, c.start)
+        to, _ := time.Parse(time.DateOnly, c.to)
+        occurrences, err := schedule.Occurrences(start, to)
+        if err != nil {
+            t.Fatalf("expected no error for %q, got: %v", c.rule, err)
+        }
+        var dates []string
+        for _, occurrence := range occurrences {
+            dates = append(dates, occurrence.Format(time.DateOnly))
+        }
+        if !slices.Equal(dates, c.expected) {
+            t.Errorf("expected %q from %v to %v to be %v, got: %v", c.rule, c.start, c.to, c.expected, dates)
+        }
+    }
+}
@@ -2,10 +2,12 @@ package models_tests
 
 import (
 	"database/sql"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/utils"
 	"github.com/craftidev/expenseflow/tests"
 )
 
@@ -79,3 +81,34 @@ func TestSesionPreReportValid(t *testing.T) {
         return s.PreReportValid()
     })
 }
+
+func TestSessionViolations(t *testing.T) {
+    session := tests.GetValidSession()
+    session.ClientID = 0
+    session.Location = ""
+    session.TripStartLocation = sql.NullString{String: "a" + string(make([]rune, 100)), Valid: true}
+    session.StartAtDateTime, session.EndAtDateTime = session.EndAtDateTime, session.StartAtDateTime
+
+    err := session.PreInsertValid()
+    if !errors.Is(err, utils.ErrValidation) {
+        t.Fatalf("expected a validation error, got: %v", err)
+    }
+    expected := []utils.Violation{
+        {Field: "client_id", Code: utils.ViolationRange},
+        {Field: "location", Code: utils.ViolationRequired},
+        {Field: "trip_start_location", Code: utils.ViolationTooLong},
+        {Field: "end_at_date_time", Code: utils.ViolationOrder},
+    }
+    violations := utils.ErrorViolations(err)
+    if len(violations) != len(expected) {
+        t.Fatalf("expected %d violations, got: %+v", len(expected), violations)
+    }
+    for i, violation := range violations {
+        if violation.Field != expected[i].Field || violation.Code != expected[i].Code {
+            t.Errorf("expected violation %s:%s, got: %+v", expected[i].Field, expected[i].Code, violation)
+        }
+    }
+    if violations[2].Params["max"] != 100 {
+        t.Errorf("expected the max length in the params, got: %+v", violations[2].Params)
+    }
+}
@@ -0,0 +1,101 @@
+package models_tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestTagPreInsertValid(t *testing.T) {
+    validTag := db.Tag{ID: 1, Name: "billable"}
+
+    validTags := tests.InitializeSliceOfValidAny(2, validTag)
+    validTags[1].Name = "Client X - Q4"
+    tests.ValidateEntities(t, validTags, false, func(tag db.Tag) error {
+        return tag.PreInsertValid()
+    })
+
+    invalidTags := tests.InitializeSliceOfValidAny(4, validTag)
+    invalidTags[0].Name = ""
+    invalidTags[1].Name = strings.Repeat("a", 51)
+    invalidTags[2].Name = " billable"
+    invalidTags[3].Name = "a,b"
+    tests.ValidateEntities(t, invalidTags, true, func(tag db.Tag) error {
+        return tag.PreInsertValid()
+    })
+}
+
+func TestCustomFieldPreInsertValid(t *testing.T) {
+    validField := db.CustomField{
+        ID:        1,
+        Name:      "project",
+        AppliesTo: db.CustomFieldOnExpense,
+        Type:      db.CustomFieldEnum,
+        Options:   db.CustomFieldOptions{"Alpha", "Beta"},
+    }
+
+    validFields := tests.InitializeSliceOfValidAny(3, validField)
+    validFields[1].Type, validFields[1].Options = db.CustomFieldNumber, nil
+    validFields[2].AppliesTo = db.CustomFieldOnSession
+    tests.ValidateEntities(t, validFields, false, func(cf db.CustomField) error {
+        return cf.PreInsertValid()
+    })
+
+    invalidFields := tests.InitializeSliceOfValidAny(8, validField)
+    invalidFields[0].Name = ""
+    invalidFields[1].Name = "po=1"
+    invalidFields[2].AppliesTo = "client"
+    invalidFields[3].Type = "bool"
+    invalidFields[4].Options = nil
+    invalidFields[5].Options = db.CustomFieldOptions{"Alpha", "alpha"}
+    invalidFields[6].Options = db.CustomFieldOptions{"Alpha", " Beta"}
+    invalidFields[7].Type = db.CustomFieldText
+    tests.ValidateEntities(t, invalidFields, true, func(cf db.CustomField) error {
+        return cf.PreInsertValid()
+    })
+}
+
+func TestCustomFieldNormalizeValue(t *testing.T) {
+    cases := []struct {
+        field    db.CustomField
+        value    string
+        expected string // "" when the value is rejected
+    }{
+        {db.CustomField{Name: "po", Type: db.CustomFieldNumber}, "0042.50", "42.5"},
+        {db.CustomField{Name: "po", Type: db.CustomFieldNumber}, " 7 ", "7"},
+        {db.CustomField{Name: "po", Type: db.CustomFieldNumber}, "NaN", ""},
+        {db.CustomField{Name: "po", Type: db.CustomFieldNumber}, "12 EUR", ""},
+        {db.CustomField{Name: "due", Type: db.CustomFieldDate}, "2024-11-01", "2024-11-01"},
+        {db.CustomField{Name: "due", Type: db.CustomFieldDate}, "2024-13-01", ""},
+        {db.CustomField{Name: "due", Type: db.CustomFieldDate}, "01/11/2024", ""},
+        {
+            db.CustomField{Name: "project", Type: db.CustomFieldEnum, Options: db.CustomFieldOptions{"Alpha"}},
+            "ALPHA", "Alpha",
+        },
+        {
+            db.CustomField{Name: "project", Type: db.CustomFieldEnum, Options: db.CustomFieldOptions{"Alpha"}},
+            "Gamma", "",
+        },
+        {db.CustomField{Name: "memo", Type: db.CustomFieldText}, "Team dinner", "Team dinner"},
+        {db.CustomField{Name: "memo", Type: db.CustomFieldText}, strings.Repeat("a", 201), ""},
+        {db.CustomField{Name: "memo", Type: db.CustomFieldText}, "  ", ""},
+    }
+    for _, c := range cases {
+        normalized, err := c.field.NormalizeValue(c.value)
+        if c.expected == "" {
+            if err == nil {
+                t.Errorf("expected %v to reject %q, got %q", c.field.Type, c.value, normalized)
+            }
+            continue
+        }
+        if err != nil || normalized != c.expected {
+            t.Errorf(
+                "expected %v value %q to be %q, got %q (error: %v)",
+                c.field.Type, c.value, c.expected, normalized, err,
+            )
+        }
+    }
+}
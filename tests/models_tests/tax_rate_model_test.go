@@ -0,0 +1,60 @@
+package models_tests
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestTaxRatePreInsertValid(t *testing.T) {
+    validTaxRate := db.TaxRate{
+        ID:        1,
+        Country:   "FR",
+        Label:     "standard",
+        Rate:      20,
+        ValidFrom: sql.NullString{String: "2014-01-01", Valid: true},
+    }
+
+    validTaxRates := tests.InitializeSliceOfValidAny(3, validTaxRate)
+    validTaxRates[1].ValidFrom = sql.NullString{}
+    validTaxRates[2].Label = "zero"
+    validTaxRates[2].Rate = 0
+    tests.ValidateEntities(t, validTaxRates, false, func(tr db.TaxRate) error {
+        return tr.PreInsertValid()
+    })
+
+    invalidTaxRates := tests.InitializeSliceOfValidAny(6, validTaxRate)
+    invalidTaxRates[0].Country = "fr"
+    invalidTaxRates[1].Country = "FRA"
+    invalidTaxRates[2].Label = ""
+    invalidTaxRates[3].Rate = -1
+    invalidTaxRates[4].ValidFrom = sql.NullString{String: "01/01/2014", Valid: true}
+    invalidTaxRates[5].ValidTo = sql.NullString{String: "2013-12-31", Valid: true}
+    tests.ValidateEntities(t, invalidTaxRates, true, func(tr db.TaxRate) error {
+        return tr.PreInsertValid()
+    })
+}
+
+func TestTaxRateValidOn(t *testing.T) {
+    taxRate := db.TaxRate{
+        Country:   "DE",
+        Label:     "standard",
+        Rate:      16,
+        ValidFrom: sql.NullString{String: "2020-07-01", Valid: true},
+        ValidTo:   sql.NullString{String: "2020-12-31", Valid: true},
+    }
+    cases := map[string]bool{
+        "2020-06-30": false,
+        "2020-07-01": true,
+        "2020-12-31": true,
+        "2021-01-01": false,
+    }
+    for date, expected := range cases {
+        if taxRate.ValidOn(date) != expected {
+            t.Errorf("expected ValidOn(%v) to be %v", date, expected)
+        }
+    }
+}
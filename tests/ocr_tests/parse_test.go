@@ -0,0 +1,86 @@
+package ocr_tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/ocr"
+)
+
+
+const frenchReceipt = `BRASSERIE DU PORT
+12 quai des Chartrons
+33000 Bordeaux
+Le 14/03/2024 12:41
+
+2 Menu du jour      31,00
+1 Vin verre          6,50
+
+TOTAL HT            32,55
+TVA 10,0%  25,45   2,55   28,00
+TVA 20,0%   7,10   1,42    8,52
+TOTAL TTC           37,50 EUR
+CB                  37,50 €
+`
+
+func TestParseText(t *testing.T) {
+    extraction := ocr.ParseText(frenchReceipt)
+
+    if extraction.Merchant != "BRASSERIE DU PORT" {
+        t.Errorf("expected merchant BRASSERIE DU PORT, got: %q", extraction.Merchant)
+    }
+    expectedDate := time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)
+    if extraction.Date == nil || !extraction.Date.Equal(expectedDate) {
+        t.Errorf("expected date %v, got: %v", expectedDate, extraction.Date)
+    }
+    if extraction.Currency != "EUR" {
+        t.Errorf("expected EUR, got: %q", extraction.Currency)
+    }
+    if extraction.Total == nil || *extraction.Total != 37.50 {
+        t.Errorf("expected total 37.50, got: %v", extraction.Total)
+    }
+
+    expectedTaxLines := []ocr.TaxLine{
+        {TaxeRate: 10, Total: 28.00, Tax: 2.55},
+        {TaxeRate: 20, Total: 8.52, Tax: 1.42},
+    }
+    if len(extraction.TaxLines) != len(expectedTaxLines) {
+        t.Fatalf("expected %d tax lines, got: %+v", len(expectedTaxLines), extraction.TaxLines)
+    }
+    for i, taxLine := range expectedTaxLines {
+        if extraction.TaxLines[i] != taxLine {
+            t.Errorf("expected tax line %+v, got: %+v", taxLine, extraction.TaxLines[i])
+        }
+    }
+}
+
+func TestParseTextFormats(t *testing.T) {
+    cases := []struct {
+        text     string
+        date     time.Time
+        total    float64
+        currency string
+    }{
+        {"Tankstelle\n2024-11-02\nSumme 1.234,56 EUR", time.Date(2024, 11, 2, 0, 0, 0, 0, time.UTC), 1234.56, "EUR"},
+        {"Corner Shop\n05.01.24\nAmount due 12.40\n£", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), 12.40, "GBP"},
+        // No total line: the largest amount, 31/02 is not a date
+        {"Parking\n31/02/2024 01/03/2024\n3,20\n4,80", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), 4.80, ""},
+    }
+    for _, c := range cases {
+        extraction := ocr.ParseText(c.text)
+        if extraction.Date == nil || !extraction.Date.Equal(c.date) {
+            t.Errorf("%q: expected date %v, got: %v", c.text, c.date, extraction.Date)
+        }
+        if extraction.Total == nil || *extraction.Total != c.total {
+            t.Errorf("%q: expected total %v, got: %v", c.text, c.total, extraction.Total)
+        }
+        if extraction.Currency != c.currency {
+            t.Errorf("%q: expected currency %q, got: %q", c.text, c.currency, extraction.Currency)
+        }
+    }
+
+    empty := ocr.ParseText("")
+    if empty.Date != nil || empty.Total != nil || len(empty.TaxLines) != 0 {
+        t.Errorf("expected nothing from an empty text, got: %+v", empty)
+    }
+}
@@ -0,0 +1,144 @@
+package services_tests
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestAllocateExpense(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    database := tests.NewTestDatabase(t)
+
+    parisID := createAttributesSession(t, database)
+    lyonID, err := crud.CreateSession(database, db.Session{
+        ClientID:        1,
+        Location:        "Lyon",
+        StartAtDateTime: db.NullableTime{Time: time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC), Valid: true},
+    })
+    if err != nil {
+        t.Fatalf("failed to create session: %v", err)
+    }
+    expenseID := createAttributesExpense(t, database, parisID) // 12 EUR, taxe 10%
+
+    if _, err := services.AllocateExpense(database, expenseID, db.AllocationList{
+        {SessionID: parisID, Percentage: sql.NullFloat64{Float64: 50, Valid: true}},
+        {SessionID: lyonID, Amount: sql.NullFloat64{Float64: 5, Valid: true}},
+    }); err == nil {
+        t.Errorf("expected allocations not adding up to the total to be rejected")
+    }
+    if _, err := services.AllocateExpense(database, expenseID, db.AllocationList{
+        {SessionID: 99, Percentage: sql.NullFloat64{Float64: 100, Valid: true}},
+    }); err == nil {
+        t.Errorf("expected an unknown session to be rejected")
+    }
+
+    shares, err := services.AllocateExpense(database, expenseID, db.AllocationList{
+        {SessionID: parisID, Percentage: sql.NullFloat64{Float64: 75, Valid: true}},
+        {SessionID: lyonID, Amount: sql.NullFloat64{Float64: 3, Valid: true}},
+    })
+    if err != nil || len(shares) != 2 || shares[0].Share != 9 || shares[1].Share != 3 {
+        t.Fatalf("expected shares of 9 and 3, got: %+v (%v)", shares, err)
+    }
+    expense, err := crud.GetExpenseByID(database, expenseID)
+    if err != nil || expense.SessionID.Valid {
+        t.Errorf("expected the allocated expense to lose its session, got: %+v (%v)", expense, err)
+    }
+
+    // Each session lists it and reports its share
+    for _, sessionID := range []int64{parisID, lyonID} {
+        expenses, err := crud.ListExpensesByFilter(database, crud.ExpenseFilter{SessionID: sessionID})
+        if err != nil || len(expenses) != 1 {
+            t.Errorf("expected session #%d to list the expense, got: %v (%v)", sessionID, expenses, err)
+        }
+    }
+    report, err := services.BuildSessionReport(database, lyonID)
+    if err != nil || len(report.Expenses) != 1 {
+        t.Fatalf("expected the expense in the report, got: %+v (%v)", report, err)
+    }
+    reported := report.Expenses[0]
+    if  reported.Total != 3 || reported.FullTotal != 12 || reported.SharePercent != 25 ||
+        reported.LineItems[0].Total != 3 || len(report.Totals) != 1 || report.Totals[0].Total != 3 {
+        t.Errorf("expected a share of 3 out of 12, got: %+v, totals: %+v", reported, report.Totals)
+    }
+
+    if err := crud.DeleteSessionByID(database, lyonID); err == nil {
+        t.Errorf("expected a session with allocations to be kept")
+    }
+
+    // A line item added afterwards breaks the fixed amount
+    if _, err := crud.CreateLineItem(database, db.LineItem{
+        ExpenseID: expenseID, TaxeRate: 20, Total: 8,
+    }); err != nil {
+        t.Fatalf("failed to create line item: %v", err)
+    }
+    if _, err := services.BuildSessionReport(database, parisID); err == nil {
+        t.Errorf("expected allocations no longer matching the total to fail the report")
+    }
+
+    if err := services.ClearAllocations(database, expenseID, parisID); err != nil {
+        t.Fatalf("expected no error clearing allocations, got: %v", err)
+    }
+    if allocations, _ := crud.ListAllocationsByExpenseID(database, expenseID); len(allocations) != 0 {
+        t.Errorf("expected no allocation left, got: %v", allocations)
+    }
+    if err := crud.DeleteSessionByID(database, lyonID); err != nil {
+        t.Errorf("expected the session to be deletable without allocations, got: %v", err)
+    }
+}
+
+func TestAllocationsArchiveRoundTrip(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    source := tests.NewTestDatabase(t)
+
+    sessionID := createAttributesSession(t, source)
+    otherID, err := crud.CreateSession(source, db.Session{ClientID: 1, Location: "Lyon"})
+    if err != nil {
+        t.Fatalf("failed to create session: %v", err)
+    }
+    expenseID := createAttributesExpense(t, source, 0)
+    if _, err := services.AllocateExpense(source, expenseID, db.AllocationList{
+        {SessionID: sessionID, Percentage: sql.NullFloat64{Float64: 50, Valid: true}},
+        {SessionID: otherID, Amount: sql.NullFloat64{Float64: 6, Valid: true}},
+    }); err != nil {
+        t.Fatalf("failed to allocate expense: %v", err)
+    }
+
+    archive, err := services.BuildArchive(source)
+    if err != nil || len(archive.Allocations) != 2 {
+        t.Fatalf("expected 2 archived allocations, got: %+v (%v)", archive, err)
+    }
+    var buffer bytes.Buffer
+    if err := services.ExportArchive(source, &buffer); err != nil {
+        t.Fatalf("expected no error on export, got: %v", err)
+    }
+
+    target := tests.NewTestDatabase(t)
+    report, err := services.ImportArchive(target, &buffer, services.ConflictMerge)
+    if err != nil || report.Allocations != 2 {
+        t.Fatalf("expected 2 imported allocations, got: %+v (%v)", report, err)
+    }
+    allocations, err := crud.ListAllocations(target)
+    if err != nil || len(allocations) != 2 || !allocations[0].Percentage.Valid ||
+        allocations[1].Amount.Float64 != 6 {
+        t.Errorf("unexpected imported allocations: %v (%v)", allocations, err)
+    }
+
+    // Allocations over the total are rejected before anything is written
+    archive.Allocations[1].Amount = new(float64)
+    *archive.Allocations[1].Amount = 10
+    broken := tests.NewTestDatabase(t)
+    if _, err := services.ApplyArchive(broken, *archive, services.ConflictMerge); err == nil {
+        t.Errorf("expected allocations over the total to be rejected")
+    }
+    if expenses, _ := crud.ListExpenses(broken); len(expenses) != 0 {
+        t.Errorf("expected nothing imported, got %d expenses", len(expenses))
+    }
+}
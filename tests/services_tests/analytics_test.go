@@ -0,0 +1,190 @@
+package services_tests
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestAnalytics(t *testing.T) {
+    database := tests.NewTestDatabase(t)
+
+    var sessionIDs []int64
+    for _, s := range []struct{ client, location string }{{"Acme", "Paris"}, {"Globex", "Lyon"}} {
+        clientID, err := crud.CreateClient(database, db.Client{Name: s.client})
+        if err != nil {
+            t.Fatalf("failed to create client: %v", err)
+        }
+        sessionID, err := crud.CreateSession(database, db.Session{
+            ClientID:        clientID,
+            Location:        s.location,
+            StartAtDateTime: db.NullableTime{Time: time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC), Valid: true},
+        })
+        if err != nil {
+            t.Fatalf("failed to create session: %v", err)
+        }
+        sessionIDs = append(sessionIDs, sessionID)
+    }
+    parisID, lyonID := sessionIDs[0], sessionIDs[1]
+    hotelID, err := crud.CreateExpenseType(database, db.ExpenseType{Name: "Hotel", Reimbursable: true})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    mealID, err := crud.CreateExpenseType(database, db.ExpenseType{Name: "Meal", Reimbursable: true})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+
+    expenses := []struct {
+        sessionID int64
+        typeID    int64
+        currency  string
+        date      time.Time
+        timeZone  string
+        days      int64
+        merchant  string
+        total     float64
+    }{
+        {parisID, hotelID, "EUR", time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC), "", 3, "Ibis", 300},
+        {lyonID, hotelID, "EUR", time.Date(2024, 3, 12, 20, 0, 0, 0, time.UTC), "", 1, "ibis", 150},
+        // March 31 in UTC, April 1 in Tokyo, split between both sessions
+        {0, mealID, "EUR", time.Date(2024, 3, 31, 16, 0, 0, 0, time.UTC), "Asia/Tokyo", 0, "Bistro", 40},
+        {0, mealID, "EUR", time.Date(2023, 3, 5, 12, 0, 0, 0, time.UTC), "", 0, "", 20},
+        {0, mealID, "USD", time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC), "", 0, "", 10},
+    }
+    var expenseIDs []int64
+    for _, e := range expenses {
+        expenseID, err := crud.CreateExpense(database, db.Expense{
+            SessionID:   sql.NullInt64{Int64: e.sessionID, Valid: e.sessionID != 0},
+            TypeID:      e.typeID,
+            Currency:    e.currency,
+            DateTime:    e.date,
+            TimeZone:    sql.NullString{String: e.timeZone, Valid: e.timeZone != ""},
+            CoveredDays: sql.NullInt64{Int64: e.days, Valid: e.days != 0},
+            Merchant:    sql.NullString{String: e.merchant, Valid: e.merchant != ""},
+        })
+        if err != nil {
+            t.Fatalf("failed to create expense: %v", err)
+        }
+        lineItem := db.LineItem{ExpenseID: expenseID, TaxeRate: 10, Total: e.total}
+        if _, err := crud.CreateLineItem(database, lineItem); err != nil {
+            t.Fatalf("failed to create line item: %v", err)
+        }
+        expenseIDs = append(expenseIDs, expenseID)
+    }
+    if _, err := services.AllocateExpense(database, expenseIDs[2], db.AllocationList{
+        {SessionID: parisID, Percentage: sql.NullFloat64{Float64: 50, Valid: true}},
+        {SessionID: lyonID, Percentage: sql.NullFloat64{Float64: 50, Valid: true}},
+    }); err != nil {
+        t.Fatalf("failed to allocate expense: %v", err)
+    }
+    for _, carTrip := range []db.CarTrip{
+        {DistanceKM: 100, DateOnly: "2024-03-01"},
+        {DistanceKM: 50, DateOnly: "2024-03-20"},
+        {DistanceKM: 30, DateOnly: "2024-04-02"},
+    } {
+        if _, err := crud.CreateCarTrip(database, carTrip); err != nil {
+            t.Fatalf("failed to create car trip: %v", err)
+        }
+    }
+
+    year2024 := services.AnalyticsRange{From: "2024-01-01", To: "2024-12-31"}
+    testCases := []struct {
+        by       string
+        r        services.AnalyticsRange
+        expected []services.SpendGroup
+    }{
+        {services.SpendByType, year2024, []services.SpendGroup{
+            {Key: "Hotel", Currency: "EUR", Total: 450, Expenses: 2},
+            {Key: "Meal", Currency: "EUR", Total: 40, Expenses: 1},
+            {Key: "Meal", Currency: "USD", Total: 10, Expenses: 1},
+        }},
+        {services.SpendByClient, year2024, []services.SpendGroup{
+            {Key: "Acme", Currency: "EUR", Total: 320, Expenses: 2},
+            {Key: "Globex", Currency: "EUR", Total: 170, Expenses: 2},
+            {Key: "", Currency: "USD", Total: 10, Expenses: 1},
+        }},
+        // The meal paid in Tokyo is on April 1
+        {services.SpendByMonth, services.AnalyticsRange{From: "2024-03-01", To: "2024-03-31"}, []services.SpendGroup{
+            {Key: "2024-03", Currency: "EUR", Total: 450, Expenses: 2},
+            {Key: "2024-03", Currency: "USD", Total: 10, Expenses: 1},
+        }},
+        {services.SpendByCurrency, services.AnalyticsRange{}, []services.SpendGroup{
+            {Key: "EUR", Currency: "EUR", Total: 510, Expenses: 4},
+            {Key: "USD", Currency: "USD", Total: 10, Expenses: 1},
+        }},
+    }
+    for _, tc := range testCases {
+        spend, err := services.SpendBy(database, tc.by, tc.r)
+        if err != nil {
+            t.Errorf("expected no error on spend by %s, got: %v", tc.by, err)
+            continue
+        }
+        if len(spend.Groups) != len(tc.expected) {
+            t.Errorf("expected spend by %s: %+v, got: %+v", tc.by, tc.expected, spend.Groups)
+            continue
+        }
+        for i, group := range tc.expected {
+            if spend.Groups[i] != group {
+                t.Errorf("expected spend by %s group %+v, got %+v", tc.by, group, spend.Groups[i])
+            }
+        }
+    }
+    if _, err := services.SpendBy(database, "week", year2024); err == nil {
+        t.Error("expected error on an unknown grouping")
+    }
+    if _, err := services.SpendBy(database, services.SpendByType, services.AnalyticsRange{From: "2024-02-01", To: "2024-01-01"}); err == nil {
+        t.Error("expected error on an empty range")
+    }
+
+    hotels, err := services.HotelPrices(database, year2024)
+    if err != nil {
+        t.Fatalf("expected no error on hotel prices, got: %v", err)
+    }
+    if len(hotels.Cities) != 2 || hotels.Cities[0].City != "Lyon" || hotels.Cities[0].AverageNight != 150 ||
+        hotels.Cities[1].AverageNight != 100 || hotels.Cities[1].Nights != 3 {
+        t.Errorf("expected a night at 150 in Lyon and 100 in Paris, got: %+v", hotels.Cities)
+    }
+
+    merchants, err := services.TopMerchants(database, year2024, 1)
+    if err != nil {
+        t.Fatalf("expected no error on top merchants, got: %v", err)
+    }
+    if len(merchants.Merchants) != 1 || merchants.Merchants[0].Total != 450 || merchants.Merchants[0].Expenses != 2 {
+        t.Errorf("expected both spellings of Ibis on top, got: %+v", merchants.Merchants)
+    }
+
+    distance, err := services.DistanceByMonth(database, year2024)
+    if err != nil {
+        t.Fatalf("expected no error on distance, got: %v", err)
+    }
+    if distance.DistanceKM != 180 || len(distance.Months) != 2 || distance.Months[0].DistanceKM != 150 ||
+        distance.Months[0].Trips != 2 {
+        t.Errorf("expected 150 km in March and 30 in April, got: %+v", distance)
+    }
+
+    comparison, err := services.YearOverYear(database, 2024)
+    if err != nil {
+        t.Fatalf("expected no error on year over year, got: %v", err)
+    }
+    if len(comparison.Months) != 3 {
+        t.Fatalf("expected March and April in EUR, March in USD, got: %+v", comparison.Months)
+    }
+    march, april := comparison.Months[0], comparison.Months[1]
+    if march.Month != 3 || march.Total != 450 || march.PreviousTotal != 20 || march.ChangePercent == nil ||
+        *march.ChangePercent != 2150 {
+        t.Errorf("expected March up 2150%%, got: %+v", march)
+    }
+    if april.Month != 4 || april.Total != 40 || april.ChangePercent != nil {
+        t.Errorf("expected April without change, got: %+v", april)
+    }
+    if len(comparison.Totals) != 2 || comparison.Totals[0].Total != 490 || comparison.Totals[0].PreviousTotal != 20 {
+        t.Errorf("expected 490 EUR against 20, got: %+v", comparison.Totals)
+    }
+}
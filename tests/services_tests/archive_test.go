@@ -0,0 +1,250 @@
+package services_tests
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+var DatabaseTest *sql.DB
+
+func TestMain(m *testing.M) {
+	DatabaseTest = tests.SetupTestDatabase()
+
+	exitCode := m.Run()
+
+	tests.TeardownTestDatabase()
+
+	os.Exit(exitCode)
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    receipt, err := os.ReadFile(
+        filepath.Join(tests.ReceiptsDirTest, "valid_receipt_test.png"),
+    )
+    if err != nil {
+        t.Fatalf("failed to read test receipt: %v", err)
+    }
+    err = os.WriteFile(
+        filepath.Join(config.ReceiptsDir, "valid_receipt_test.png"), receipt, 0644,
+    )
+    if err != nil {
+        t.Fatalf("failed to copy test receipt: %v", err)
+    }
+
+    source := tests.NewTestDatabase(t)
+    seedArchiveData(t, source)
+
+    var buffer bytes.Buffer
+    if err := services.ExportArchive(source, &buffer); err != nil {
+        t.Fatalf("expected no error on export, got: %v", err)
+    }
+    exported := buffer.Bytes()
+
+    // Fresh install: everything is created
+    config.ReceiptsDir = t.TempDir()
+    report, err := services.ImportArchive(
+        DatabaseTest, bytes.NewReader(exported), services.ConflictMerge,
+    )
+    if err != nil {
+        t.Fatalf("expected no error on import, got: %v", err)
+    }
+    if  report.Clients != 1 || report.Sessions != 1 || report.CarTrips != 1 ||
+        report.ExpenseTypes != 1 || report.Expenses != 1 ||
+        report.LineItems != 2 || report.Receipts != 1 {
+            t.Errorf("unexpected import report: %+v", report)
+    }
+    imported, err := crud.GetExpenseTypeByName(DatabaseTest, tests.GetValidExpenseType().Name)
+    if err != nil || imported == nil ||
+        !slices.Equal(imported.DefaultTaxeRates, tests.GetValidExpenseType().DefaultTaxeRates) ||
+        imported.AccountingCode != tests.GetValidExpenseType().AccountingCode {
+        t.Errorf("expected expense type details to be imported, got: %+v (%v)", imported, err)
+    }
+    data, err := os.ReadFile(filepath.Join(tests.ReceiptsDirTest, "valid_receipt_test.png"))
+    if err != nil {
+        t.Fatalf("failed to read receipt: %v", err)
+    }
+    _, err = os.Stat(filepath.Join(config.ReceiptsDir, db.ReceiptName(data, ".png")))
+    if err != nil {
+        t.Errorf("expected receipt file to be imported, got: %v", err)
+    }
+
+    // Same archive again, names are merged
+    report, err = services.ImportArchive(
+        DatabaseTest, bytes.NewReader(exported), services.ConflictMerge,
+    )
+    if err != nil {
+        t.Fatalf("expected no error on merge import, got: %v", err)
+    }
+    if report.Clients != 0 || report.ExpenseTypes != 0 || len(report.MergedNames) != 2 {
+        t.Errorf("expected client and expense type to be merged: %+v", report)
+    }
+    if len(report.SkippedCarTrips) != 1 {
+        t.Errorf("expected car trip on the same date to be skipped: %+v", report)
+    }
+
+    // And renamed
+    report, err = services.ImportArchive(
+        DatabaseTest, bytes.NewReader(exported), services.ConflictRename,
+    )
+    if err != nil {
+        t.Fatalf("expected no error on rename import, got: %v", err)
+    }
+    if report.RenamedNames["ACME"] != "ACME (2)" {
+        t.Errorf("expected client to be renamed, got: %+v", report.RenamedNames)
+    }
+    client, err := crud.GetClientByName(DatabaseTest, "ACME (2)")
+    if err != nil || client == nil {
+        t.Errorf("expected renamed client to exist, got: %v", err)
+    }
+}
+
+func TestArchiveImportInvalid(t *testing.T) {
+    invalidArchives := []string{
+        `{"format_version": 99}`,
+        `{"format_version": 1, "clients": [{"id": 1, "name": ""}]}`,
+        `{"format_version": 1, "sessions": [{"id": 1, "client_id": 7, "location": "Lyon"}]}`,
+        `{"format_version": 1, "unknown_field": true}`,
+    }
+    for i, archive := range invalidArchives {
+        _, err := services.ImportArchive(
+            DatabaseTest, bytes.NewReader([]byte(archive)), services.ConflictMerge,
+        )
+        if err == nil {
+            t.Errorf("expected error on invalid archive number: %d", i)
+        }
+    }
+}
+
+func seedArchiveData(t *testing.T, database *sql.DB) {
+    clientID, err := crud.CreateClient(database, db.Client{Name: "ACME"})
+    if err != nil {
+        t.Fatalf("failed to seed client: %v", err)
+    }
+    session := tests.GetValidSession()
+    session.ClientID = clientID
+    sessionID, err := crud.CreateSession(database, session)
+    if err != nil {
+        t.Fatalf("failed to seed session: %v", err)
+    }
+    carTrip := tests.GetValidCarTrip()
+    carTrip.SessionID = sql.NullInt64{Int64: sessionID, Valid: true}
+    if _, err := crud.CreateCarTrip(database, carTrip); err != nil {
+        t.Fatalf("failed to seed car trip: %v", err)
+    }
+    typeID, err := crud.CreateExpenseType(database, tests.GetValidExpenseType())
+    if err != nil {
+        t.Fatalf("failed to seed expense type: %v", err)
+    }
+    expense := tests.GetValidExpense()
+    expense.SessionID = sql.NullInt64{Int64: sessionID, Valid: true}
+    expense.TypeID = typeID
+    expenseID, err := crud.CreateExpense(database, expense)
+    if err != nil {
+        t.Fatalf("failed to seed expense: %v", err)
+    }
+    receipt := db.Receipt{ExpenseID: expenseID, RelPath: "valid_receipt_test.png"}
+    if _, err := crud.CreateReceipt(database, receipt); err != nil {
+        t.Fatalf("failed to seed receipt: %v", err)
+    }
+    for _, total := range []float64{12.5, 30} {
+        lineItem := tests.GetValidLineItem()
+        lineItem.ExpenseID = expenseID
+        lineItem.Total = total
+        if _, err := crud.CreateLineItem(database, lineItem); err != nil {
+            t.Fatalf("failed to seed line item: %v", err)
+        }
+    }
+}
+
+// Archives before v5 have one receipt_rel_path per expense
+func TestArchiveImportSingleReceipt(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    archive := `{
+        "format_version": 4,
+        "expense_types": [{"id": 1, "name": "Legacy hotel"}],
+        "expenses": [{
+            "id": 1, "type_id": 1, "currency": "EUR",
+            "receipt_rel_path": "legacy.png", "date_time": "2024-04-15T10:00:00Z"
+        }],
+        "receipts": [{"rel_path": "legacy.png", "data": "iVBORw0KGgo="}]
+    }`
+    // Stored under the hash of its content, as sync expects
+    relPath := db.ReceiptName([]byte("\x89PNG\r\n\x1a\n"), ".png")
+    report, err := services.ImportArchive(
+        DatabaseTest, bytes.NewReader([]byte(archive)), services.ConflictRename,
+    )
+    if err != nil {
+        t.Fatalf("expected no error on v4 import, got: %v", err)
+    }
+    expenses, err := crud.ListExpenses(DatabaseTest)
+    if err != nil || report.Expenses != 1 {
+        t.Fatalf("expected the expense to be imported, got: %+v (%v)", report, err)
+    }
+    receipts, err := crud.ListReceiptsByExpenseID(DatabaseTest, expenses[len(expenses)-1].ID)
+    if err != nil || len(receipts) != 1 || receipts[0].RelPath != relPath {
+        t.Errorf("expected the single receipt to be attached, got: %v (%v)", receipts, err)
+    }
+}
+
+// A failure half way rolls back the rows already written and removes the
+// receipt files the archive brought
+func TestArchiveImportRollback(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    existing := db.ReceiptName([]byte("\x89PNG\r\n\x1a\n"), ".png")
+    if err := os.WriteFile(filepath.Join(config.ReceiptsDir, existing), []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+        t.Fatalf("failed to write receipt: %v", err)
+    }
+    _, err := DatabaseTest.Exec(`
+        CREATE TRIGGER block_expenses BEFORE INSERT ON expenses BEGIN
+            SELECT RAISE(ABORT, 'blocked');
+        END`,
+    )
+    if err != nil {
+        t.Fatalf("failed to block expenses: %v", err)
+    }
+    defer DatabaseTest.Exec("DROP TRIGGER block_expenses")
+
+    archive := `{
+        "format_version": 10,
+        "clients": [{"id": 1, "name": "Rolled back client"}],
+        "expense_types": [{"id": 1, "name": "Rolled back type"}],
+        "expenses": [{
+            "id": 1, "type_id": 1, "currency": "EUR", "date_time": "2024-04-15T10:00:00Z",
+            "receipt_rel_paths": ["rolled_back.png", "existing.png"]
+        }],
+        "receipts": [
+            {"rel_path": "rolled_back.png", "data": "iVBORw0KGgoA"},
+            {"rel_path": "existing.png", "data": "iVBORw0KGgo="}
+        ]
+    }`
+    _, err = services.ImportArchive(DatabaseTest, strings.NewReader(archive), services.ConflictRename)
+    if err == nil {
+        t.Fatal("expected error on a blocked expense")
+    }
+    if client, err := crud.GetClientByName(DatabaseTest, "Rolled back client"); err != nil || client != nil {
+        t.Errorf("expected the imported client to be rolled back, got: %v (%v)", client, err)
+    }
+    if expenseType, err := crud.GetExpenseTypeByName(DatabaseTest, "Rolled back type"); err != nil || expenseType != nil {
+        t.Errorf("expected the imported type to be rolled back, got: %v (%v)", expenseType, err)
+    }
+    rolledBack := db.ReceiptName([]byte("\x89PNG\r\n\x1a\n\x00"), ".png")
+    if _, err := os.Stat(filepath.Join(config.ReceiptsDir, rolledBack)); !os.IsNotExist(err) {
+        t.Errorf("expected the receipt written by the import to be removed, got: %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(config.ReceiptsDir, existing)); err != nil {
+        t.Errorf("expected the existing receipt to be kept, got: %v", err)
+    }
+}
@@ -0,0 +1,282 @@
+package services_tests
+
+import (
+	"bytes"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestAttributes(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    database := tests.NewTestDatabase(t)
+
+    project := db.CustomField{
+        Name:      "project",
+        AppliesTo: db.CustomFieldOnExpense,
+        Type:      db.CustomFieldEnum,
+        Options:   db.CustomFieldOptions{"Alpha", "Beta"},
+    }
+    var err error
+    if project.ID, err = crud.CreateCustomField(database, project); err != nil {
+        t.Fatalf("failed to create custom field: %v", err)
+    }
+    if _, err := crud.CreateCustomField(database, db.CustomField{
+        Name: "PROJECT", AppliesTo: db.CustomFieldOnExpense, Type: db.CustomFieldText,
+    }); err == nil {
+        t.Errorf("expected custom field names to be unique, case insensitive")
+    }
+    if _, err := crud.CreateCustomField(database, db.CustomField{
+        Name: "po", AppliesTo: db.CustomFieldOnSession, Type: db.CustomFieldNumber,
+    }); err != nil {
+        t.Fatalf("failed to create custom field: %v", err)
+    }
+
+    sessionID := createAttributesSession(t, database)
+    first := createAttributesExpense(t, database, sessionID)
+    second := createAttributesExpense(t, database, 0)
+
+    err = services.ApplyAttributes(database, db.CustomFieldOnExpense, first, services.Attributes{
+        Tags:   []string{"billable", "Travel"},
+        Fields: map[string]string{"Project": "alpha"},
+    })
+    if err != nil {
+        t.Fatalf("expected no error applying attributes, got: %v", err)
+    }
+    err = services.ApplyAttributes(database, db.CustomFieldOnExpense, second, services.Attributes{
+        Tags:   []string{"BILLABLE"},
+        Fields: map[string]string{"project": "Beta"},
+    })
+    if err != nil {
+        t.Fatalf("expected no error applying attributes, got: %v", err)
+    }
+    err = services.ApplyAttributes(database, db.CustomFieldOnSession, sessionID, services.Attributes{
+        Fields: map[string]string{"po": "0042.50"},
+    })
+    if err != nil {
+        t.Fatalf("expected no error applying attributes, got: %v", err)
+    }
+
+    // Rejected values leave the expense unchanged
+    invalid := []services.Attributes{
+        {Fields: map[string]string{"project": "Gamma"}},
+        {Fields: map[string]string{"unknown": "x"}},
+        {Tags: []string{"a,b"}},
+        {Tags: []string{"new"}, Fields: map[string]string{"po": "42"}}, // a session field
+    }
+    for _, attributes := range invalid {
+        if err := services.ApplyAttributes(
+            database, db.CustomFieldOnExpense, second, attributes,
+        ); err == nil {
+            t.Errorf("expected attributes %+v to be rejected", attributes)
+        }
+    }
+
+    attributes, err := services.GetAttributes(database, db.CustomFieldOnExpense, first)
+    if err != nil || !slices.Equal(attributes.Tags, []string{"billable", "Travel"}) ||
+        attributes.Fields["project"] != "Alpha" {
+        t.Errorf("unexpected attributes of expense #%d: %+v (%v)", first, attributes, err)
+    }
+    attributes, err = services.GetAttributes(database, db.CustomFieldOnSession, sessionID)
+    if err != nil || len(attributes.Tags) != 0 || attributes.Fields["po"] != "42.5" {
+        t.Errorf("unexpected attributes of session #%d: %+v (%v)", sessionID, attributes, err)
+    }
+    tags, err := crud.ListTags(database)
+    if err != nil || len(tags) != 2 {
+        t.Errorf("expected the 2 tags to be shared, got: %v (%v)", tags, err)
+    }
+
+    filters := []struct {
+        attributes services.Attributes
+        sessionID  int64
+        expected   []int64
+    }{
+        {services.Attributes{}, 0, []int64{first, second}},
+        {services.Attributes{Tags: []string{"Billable"}}, 0, []int64{first, second}},
+        {services.Attributes{Tags: []string{"billable", "travel"}}, 0, []int64{first}},
+        {services.Attributes{Fields: map[string]string{"project": "BETA"}}, 0, []int64{second}},
+        {services.Attributes{Tags: []string{"billable"}}, sessionID, []int64{first}},
+        {services.Attributes{Tags: []string{"missing"}}, 0, nil},
+    }
+    for _, f := range filters {
+        resolved, err := services.ResolveAttributes(
+            database, db.CustomFieldOnExpense, f.attributes, false,
+        )
+        if err != nil {
+            t.Fatalf("expected no error resolving %+v, got: %v", f.attributes, err)
+        }
+        expenses, err := crud.ListExpensesByFilter(
+            database, crud.ExpenseFilter{SessionID: f.sessionID, AttributeFilter: resolved},
+        )
+        if err != nil {
+            t.Fatalf("expected no error filtering expenses, got: %v", err)
+        }
+        var ids []int64
+        for _, expense := range expenses {
+            ids = append(ids, expense.ID)
+        }
+        if !slices.Equal(ids, f.expected) {
+            t.Errorf("expected filter %+v to list %v, got: %v", f.attributes, f.expected, ids)
+        }
+    }
+    resolved, err := services.ResolveAttributes(
+        database, db.CustomFieldOnSession, services.Attributes{Fields: map[string]string{"po": "42.50"}}, false,
+    )
+    if err != nil {
+        t.Fatalf("expected no error resolving session filter, got: %v", err)
+    }
+    sessions, err := crud.ListSessionsByFilter(database, resolved)
+    if err != nil || len(sessions) != 1 || sessions[0].ID != sessionID {
+        t.Errorf("expected session #%d to match po=42.50, got: %v (%v)", sessionID, sessions, err)
+    }
+
+    // A used option can't be removed
+    project.Options = db.CustomFieldOptions{"Alpha"}
+    if err := crud.UpdateCustomField(database, project); err == nil {
+        t.Errorf("expected removing a used enum option to be rejected")
+    }
+
+    // An empty value unsets, deleting the expense drops its tags and values
+    err = services.ApplyAttributes(database, db.CustomFieldOnExpense, first, services.Attributes{
+        Fields: map[string]string{"project": ""},
+    })
+    if err != nil {
+        t.Fatalf("expected no error unsetting a field, got: %v", err)
+    }
+    if err := services.RemoveTags(database, db.CustomFieldOnExpense, first, []string{"travel"}); err != nil {
+        t.Fatalf("expected no error removing a tag, got: %v", err)
+    }
+    attributes, err = services.GetAttributes(database, db.CustomFieldOnExpense, first)
+    if err != nil || !slices.Equal(attributes.Tags, []string{"billable"}) || len(attributes.Fields) != 0 {
+        t.Errorf("unexpected attributes after unsetting: %+v (%v)", attributes, err)
+    }
+    lineItems, err := crud.ListLineItemsByExpenseID(database, second)
+    if err != nil || len(lineItems) != 1 {
+        t.Fatalf("failed to list line items: %v (%v)", lineItems, err)
+    }
+    if err := crud.DeleteLineItemByID(database, lineItems[0].ID); err != nil {
+        t.Fatalf("failed to delete line item: %v", err)
+    }
+    if err := crud.DeleteExpenseByID(database, second); err != nil {
+        t.Fatalf("failed to delete expense: %v", err)
+    }
+    all, err := services.MapAttributes(database, db.CustomFieldOnExpense)
+    if err != nil || len(all) != 1 || len(all[first].Tags) != 1 {
+        t.Errorf("expected only expense #%d to keep attributes, got: %+v (%v)", first, all, err)
+    }
+}
+
+func TestAttributesArchiveRoundTrip(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    source := tests.NewTestDatabase(t)
+
+    if _, err := crud.CreateCustomField(source, db.CustomField{
+        Name: "po", AppliesTo: db.CustomFieldOnExpense, Type: db.CustomFieldNumber,
+    }); err != nil {
+        t.Fatalf("failed to create custom field: %v", err)
+    }
+    sessionID := createAttributesSession(t, source)
+    expenseID := createAttributesExpense(t, source, sessionID)
+    err := services.ApplyAttributes(source, db.CustomFieldOnExpense, expenseID, services.Attributes{
+        Tags:   []string{"billable"},
+        Fields: map[string]string{"po": "42"},
+    })
+    if err != nil {
+        t.Fatalf("failed to apply attributes: %v", err)
+    }
+    err = services.ApplyAttributes(source, db.CustomFieldOnSession, sessionID, services.Attributes{
+        Tags: []string{"travel"},
+    })
+    if err != nil {
+        t.Fatalf("failed to apply attributes: %v", err)
+    }
+
+    var buffer bytes.Buffer
+    if err := services.ExportArchive(source, &buffer); err != nil {
+        t.Fatalf("expected no error on export, got: %v", err)
+    }
+
+    // "po" already exists as text: the imported one is renamed
+    target := tests.NewTestDatabase(t)
+    if _, err := crud.CreateCustomField(target, db.CustomField{
+        Name: "po", AppliesTo: db.CustomFieldOnExpense, Type: db.CustomFieldText,
+    }); err != nil {
+        t.Fatalf("failed to create custom field: %v", err)
+    }
+    report, err := services.ImportArchive(target, &buffer, services.ConflictMerge)
+    if err != nil {
+        t.Fatalf("expected no error on import, got: %v", err)
+    }
+    if report.Tags != 2 || report.CustomFields != 1 || report.RenamedNames["po"] != "po (2)" {
+        t.Errorf("unexpected import report: %+v", report)
+    }
+
+    all, err := services.MapAttributes(target, db.CustomFieldOnExpense)
+    if err != nil || len(all) != 1 {
+        t.Fatalf("expected one expense with attributes, got: %+v (%v)", all, err)
+    }
+    for _, attributes := range all {
+        if !slices.Equal(attributes.Tags, []string{"billable"}) ||
+            attributes.Fields["po (2)"] != "42" || len(attributes.Fields) != 1 {
+            t.Errorf("unexpected imported expense attributes: %+v", attributes)
+        }
+    }
+    sessions, err := services.MapAttributes(target, db.CustomFieldOnSession)
+    if err != nil || len(sessions) != 1 {
+        t.Fatalf("expected one session with attributes, got: %+v (%v)", sessions, err)
+    }
+}
+
+func createAttributesSession(t *testing.T, database *sql.DB) int64 {
+    clientID, err := crud.CreateClient(database, db.Client{Name: "Acme"})
+    if err != nil {
+        t.Fatalf("failed to create client: %v", err)
+    }
+    sessionID, err := crud.CreateSession(database, db.Session{
+        ClientID:        clientID,
+        Location:        "Paris",
+        StartAtDateTime: db.NullableTime{Time: time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC), Valid: true},
+    })
+    if err != nil {
+        t.Fatalf("failed to create session: %v", err)
+    }
+    return sessionID
+}
+
+// A taxi expense of 12 EUR, sessionID 0 for none
+func createAttributesExpense(t *testing.T, database *sql.DB, sessionID int64) int64 {
+    expenseType, err := crud.GetExpenseTypeByName(database, "Taxi")
+    if err != nil {
+        t.Fatalf("failed to get expense type: %v", err)
+    }
+    typeID := int64(0)
+    if expenseType != nil {
+        typeID = expenseType.ID
+    } else if typeID, err = crud.CreateExpenseType(
+        database, db.ExpenseType{Name: "Taxi", Reimbursable: true},
+    ); err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    expenseID, err := crud.CreateExpense(database, db.Expense{
+        SessionID: sql.NullInt64{Int64: sessionID, Valid: sessionID != 0},
+        TypeID:    typeID,
+        Currency:  "EUR",
+        DateTime:  time.Date(2024, 4, 15, 10, 0, 0, 0, time.UTC),
+    })
+    if err != nil {
+        t.Fatalf("failed to create expense: %v", err)
+    }
+    if _, err := crud.CreateLineItem(database, db.LineItem{
+        ExpenseID: expenseID, TaxeRate: 10, Total: 12,
+    }); err != nil {
+        t.Fatalf("failed to create line item: %v", err)
+    }
+    return expenseID
+}
@@ -0,0 +1,157 @@
+package services_tests
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/config"
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestDuplicates(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    receipt, err := os.ReadFile(filepath.Join(tests.ReceiptsDirTest, "valid_receipt_test.png"))
+    if err != nil {
+        t.Fatalf("failed to read test receipt: %v", err)
+    }
+    // Same picture under two names
+    for _, name := range []string{"a.png", "b.png"} {
+        if err := os.WriteFile(filepath.Join(config.ReceiptsDir, name), receipt, 0644); err != nil {
+            t.Fatalf("failed to write receipt: %v", err)
+        }
+    }
+
+    database := tests.NewTestDatabase(t)
+    hotelID, err := crud.CreateExpenseType(database, db.ExpenseType{Name: "Hotel", Reimbursable: true})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    taxiID, err := crud.CreateExpenseType(database, db.ExpenseType{Name: "Taxi", Reimbursable: true})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+
+    day := time.Date(2024, 4, 15, 10, 0, 0, 0, time.UTC)
+    expenses := []struct {
+        typeID    int64
+        currency  string
+        date      time.Time
+        receipt   string
+        lineItems []db.LineItem
+    }{
+        {hotelID, "EUR", day, "a.png", []db.LineItem{{TaxeRate: 10, Total: 110}}},
+        // Same receipt the day after, with the breakfast
+        {hotelID, "EUR", day.AddDate(0, 0, 1), "b.png",
+            []db.LineItem{{TaxeRate: 10, Total: 110}, {TaxeRate: 20, Total: 12}}},
+        {hotelID, "USD", day, "", []db.LineItem{{TaxeRate: 10, Total: 110}}},
+        {taxiID, "EUR", day.AddDate(0, 0, 2), "", []db.LineItem{{TaxeRate: 10, Total: 40}}},
+        // Same ride typed twice, no receipt
+        {taxiID, "EUR", day.AddDate(0, 0, 10), "", []db.LineItem{{TaxeRate: 10, Total: 40}}},
+        {taxiID, "EUR", day.AddDate(0, 0, 10).Add(time.Hour), "", []db.LineItem{{TaxeRate: 10, Total: 40}}},
+    }
+    ids := make([]int64, 0, len(expenses))
+    for _, e := range expenses {
+        expense := tests.GetValidExpense()
+        expense.SessionID = sql.NullInt64{}
+        expense.Notes = sql.NullString{}
+        expense.TypeID = e.typeID
+        expense.Currency = e.currency
+        expense.DateTime = e.date
+        expenseID, err := crud.CreateExpense(database, expense)
+        if err != nil {
+            t.Fatalf("failed to create expense: %v", err)
+        }
+        ids = append(ids, expenseID)
+        if e.receipt != "" {
+            receipt := db.Receipt{ExpenseID: expenseID, RelPath: e.receipt}
+            if _, err := crud.CreateReceipt(database, receipt); err != nil {
+                t.Fatalf("failed to create receipt: %v", err)
+            }
+        }
+        for _, lineItem := range e.lineItems {
+            lineItem.ExpenseID = expenseID
+            if _, err := crud.CreateLineItem(database, lineItem); err != nil {
+                t.Fatalf("failed to create line item: %v", err)
+            }
+        }
+    }
+
+    // Merchant only read on the duplicate
+    duplicate, err := crud.GetExpenseByID(database, ids[1])
+    if err != nil {
+        t.Fatalf("failed to get expense: %v", err)
+    }
+    duplicate.Merchant = sql.NullString{String: "HOTEL DU PORT", Valid: true}
+    if err := crud.UpdateExpense(database, *duplicate); err != nil {
+        t.Fatalf("failed to update expense: %v", err)
+    }
+
+    duplicates, err := services.FindDuplicates(database, services.DefaultDuplicateThreshold)
+    if err != nil {
+        t.Fatalf("expected no error on duplicates, got: %v", err)
+    }
+    if len(duplicates) != 2 ||
+        duplicates[0].ExpenseID != ids[1] || duplicates[0].DuplicateOfID != ids[0] ||
+        duplicates[0].Score != 0.9 ||
+        duplicates[1].ExpenseID != ids[5] || duplicates[1].DuplicateOfID != ids[4] ||
+        duplicates[1].Score != 0.85 {
+        t.Errorf("expected the receipt pair then the taxi pair, got: %+v", duplicates)
+    }
+
+    duplicates, err = services.FindDuplicatesOf(database, ids[0], services.DefaultDuplicateThreshold)
+    if err != nil || len(duplicates) != 1 || duplicates[0].ExpenseID != ids[1] {
+        t.Errorf("expected the next day hotel only, got: %+v (%v)", duplicates, err)
+    }
+    if _, err := services.FindDuplicatesOf(database, 999, 0); err == nil {
+        t.Error("expected error for unknown expense")
+    }
+
+    if _, err := services.MergeExpenses(database, ids[0], ids[2]); err == nil {
+        t.Error("expected error merging different currencies")
+    }
+    report, err := services.MergeExpenses(database, ids[0], ids[1])
+    if err != nil {
+        t.Fatalf("expected no error on merge, got: %v", err)
+    }
+    if report.LineItemsMoved != 1 || report.LineItemsSkipped != 1 ||
+        report.ReceiptsMoved != 1 || report.Total != 122 || len(report.Warnings) != 0 {
+        t.Errorf("unexpected merge report: %+v", report)
+    }
+    if _, err := crud.GetExpenseByID(database, ids[1]); err == nil {
+        t.Error("expected the dropped expense to be deleted")
+    }
+    kept, err := crud.GetExpenseByID(database, ids[0])
+    if err != nil || kept.Merchant.String != "HOTEL DU PORT" {
+        t.Errorf("expected the merchant of the dropped expense to be kept, got: %+v (%v)", kept, err)
+    }
+    lineItems, err := crud.ListLineItemsByExpenseID(database, ids[0])
+    if err != nil || len(lineItems) != 2 {
+        t.Errorf("expected 2 line items on the kept expense, got: %v (%v)", lineItems, err)
+    }
+    receipts, err := crud.ListReceiptsByExpenseID(database, ids[0])
+    if err != nil || len(receipts) != 2 || receipts[1].RelPath != "b.png" || receipts[1].Position != 1 {
+        t.Errorf("expected both receipts on the kept expense, got: %v (%v)", receipts, err)
+    }
+
+    // A merge failing on its last step moves nothing
+    _, err = database.Exec(
+        "CREATE TRIGGER block_delete BEFORE DELETE ON expenses BEGIN SELECT RAISE(ABORT, 'blocked'); END",
+    )
+    if err != nil {
+        t.Fatalf("failed to create trigger: %v", err)
+    }
+    if _, err := services.MergeExpenses(database, ids[4], ids[5]); err == nil {
+        t.Fatal("expected error when the dropped expense can't be deleted")
+    }
+    lineItems, err = crud.ListLineItemsByExpenseID(database, ids[5])
+    if err != nil || len(lineItems) != 1 {
+        t.Errorf("expected the line item of the failed merge to stay, got: %v (%v)", lineItems, err)
+    }
+}
@@ -0,0 +1,149 @@
+package services_tests
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestPeriodRange(t *testing.T) {
+    day := time.Date(2024, 5, 8, 15, 0, 0, 0, time.UTC) // a wednesday
+    testCases := []struct {
+        period    string
+        weekStart time.Weekday
+        from      string
+        to        string
+    }{
+        {services.PeriodWeek, time.Monday, "2024-05-06", "2024-05-13"},
+        {services.PeriodWeek, time.Sunday, "2024-05-05", "2024-05-12"},
+        {services.PeriodWeek, time.Wednesday, "2024-05-08", "2024-05-15"},
+        {services.PeriodMonth, time.Monday, "2024-05-01", "2024-06-01"},
+        {services.PeriodQuarter, time.Monday, "2024-04-01", "2024-07-01"},
+    }
+    for _, tc := range testCases {
+        from, to, err := services.PeriodRange(tc.period, day, tc.weekStart)
+        if err != nil {
+            t.Errorf("expected no error on %s range, got: %v", tc.period, err)
+            continue
+        }
+        if from.Format(time.DateOnly) != tc.from || to.Format(time.DateOnly) != tc.to {
+            t.Errorf(
+                "expected %s starting %s to be %s to %s, got %s to %s",
+                tc.period, tc.weekStart, tc.from, tc.to, from.Format(time.DateOnly), to.Format(time.DateOnly),
+            )
+        }
+    }
+    if _, _, err := services.PeriodRange("year", day, time.Monday); err == nil {
+        t.Error("expected error on an unknown period")
+    }
+}
+
+func TestBuildPeriodReport(t *testing.T) {
+    tests.SetReceiptsDir(t, tests.ReceiptsDirTest)
+    database := tests.NewTestDatabase(t)
+
+    clientID, err := crud.CreateClient(database, tests.GetValidClient())
+    if err != nil {
+        t.Fatalf("failed to create client: %v", err)
+    }
+    typeID, err := crud.CreateExpenseType(database, tests.GetValidExpenseType())
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    // From friday to tuesday, across two weeks
+    session := tests.GetValidSession()
+    session.ClientID = clientID
+    session.StartAtDateTime.Time = time.Date(2024, 5, 10, 8, 0, 0, 0, time.UTC)
+    session.EndAtDateTime.Time = time.Date(2024, 5, 14, 18, 0, 0, 0, time.UTC)
+    sessionID, err := crud.CreateSession(database, session)
+    if err != nil {
+        t.Fatalf("failed to create session: %v", err)
+    }
+
+    expenses := []struct {
+        sessionID int64
+        date      time.Time
+        days      int64
+        total     float64
+    }{
+        // 3 nights from saturday, 2 in the first week
+        {sessionID, time.Date(2024, 5, 11, 20, 0, 0, 0, time.UTC), 3, 300},
+        {sessionID, time.Date(2024, 5, 14, 12, 0, 0, 0, time.UTC), 0, 20},
+        {0, time.Date(2024, 5, 7, 12, 0, 0, 0, time.UTC), 0, 15},
+    }
+    for _, e := range expenses {
+        expense := tests.GetValidExpense()
+        expense.SessionID = sql.NullInt64{Int64: e.sessionID, Valid: e.sessionID != 0}
+        expense.TypeID = typeID
+        expense.Currency = "EUR"
+        expense.DateTime = e.date
+        expense.CoveredDays = sql.NullInt64{Int64: e.days, Valid: e.days != 0}
+        expenseID, err := crud.CreateExpense(database, expense)
+        if err != nil {
+            t.Fatalf("failed to create expense: %v", err)
+        }
+        lineItem := db.LineItem{ExpenseID: expenseID, TaxeRate: 10, Total: e.total}
+        if _, err := crud.CreateLineItem(database, lineItem); err != nil {
+            t.Fatalf("failed to create line item: %v", err)
+        }
+    }
+    for _, date := range []string{"2024-05-10", "2024-05-13"} {
+        carTrip := db.CarTrip{
+            SessionID:  sql.NullInt64{Int64: sessionID, Valid: true},
+            DistanceKM: 100,
+            DateOnly:   date,
+        }
+        if _, err := crud.CreateCarTrip(database, carTrip); err != nil {
+            t.Fatalf("failed to create car trip: %v", err)
+        }
+    }
+
+    from, to, _ := services.PeriodRange(services.PeriodWeek, time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC), time.Monday)
+    first, err := services.BuildPeriodReport(database, services.PeriodWeek, from, to)
+    if err != nil {
+        t.Fatalf("expected no error on period report, got: %v", err)
+    }
+    second, err := services.BuildPeriodReport(database, services.PeriodWeek, to, to.AddDate(0, 0, 7))
+    if err != nil {
+        t.Fatalf("expected no error on period report, got: %v", err)
+    }
+    if len(first.Sessions) != 2 || first.Sessions[0].SessionID != sessionID || first.Sessions[1].SessionID != 0 {
+        t.Fatalf("expected the session then the expenses without session, got: %+v", first.Sessions)
+    }
+    sliced := first.Sessions[0]
+    if !sliced.Sliced || sliced.Days != 3 || sliced.TotalDays != 5 || sliced.DistanceKM != 100 {
+        t.Errorf("expected 3 of the 5 days and 100 km in the first week, got: %+v", sliced)
+    }
+    if len(sliced.Expenses) != 1 || sliced.Expenses[0].Total != 200 || sliced.Expenses[0].PeriodDays != 2 {
+        t.Errorf("expected 2 of the 3 hotel nights in the first week, got: %+v", sliced.Expenses)
+    }
+    if len(first.Totals) != 1 || first.Totals[0].Total != 215 {
+        t.Errorf("expected 215 in the first week, got: %+v", first.Totals)
+    }
+    if len(second.Sessions) != 1 || second.Sessions[0].Days != 2 || second.DistanceKM != 100 {
+        t.Errorf("expected the 2 last days of the session in the second week, got: %+v", second.Sessions)
+    }
+    if len(second.Totals) != 1 || second.Totals[0].Total != 120 {
+        t.Errorf("expected the last night and a meal in the second week, got: %+v", second.Totals)
+    }
+
+    var buffer bytes.Buffer
+    if err := services.WritePeriodReport(&buffer, first, services.ReportFormatText, i18n.NewPrinter("en")); err != nil {
+        t.Errorf("expected no error on text period report, got: %v", err)
+    }
+    if !strings.Contains(buffer.String(), "3 of its 5 days in the period") {
+        t.Errorf("expected the sliced session in the text report, got: %s", buffer.String())
+    }
+    if _, err := services.BuildPeriodReport(database, services.PeriodCustom, to, from); err == nil {
+        t.Error("expected error on an empty period")
+    }
+}
@@ -0,0 +1,88 @@
+package services_tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/ocr"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestDraftExpenseFromReceipt(t *testing.T) {
+    date := time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)
+    total := 36.52
+    engine := &ocr.Fake{Extraction: ocr.Extraction{
+        Merchant: "BRASSERIE DU PORT",
+        Date:     &date,
+        Total:    &total,
+        Currency: "EUR",
+        TaxLines: []ocr.TaxLine{{TaxeRate: 10, Total: 28}, {TaxeRate: 20, Total: 8.52}},
+    }}
+
+    draft, err := services.DraftExpenseFromReceipt(
+        context.Background(), engine, "valid_receipt_test.png", "USD",
+    )
+    if err != nil {
+        t.Fatalf("expected no error on draft, got: %v", err)
+    }
+    if len(engine.Calls) != 1 {
+        t.Errorf("expected the engine to be called once, got: %v", engine.Calls)
+    }
+    if !draft.Expense.DateTime.Equal(date) || draft.Expense.Currency != "EUR" ||
+        draft.Expense.Merchant.String != "BRASSERIE DU PORT" || draft.Expense.Notes.Valid ||
+        len(draft.Receipts) != 1 || draft.Receipts[0].RelPath != "valid_receipt_test.png" {
+        t.Errorf("unexpected expense draft: %+v", draft.Expense)
+    }
+    if len(draft.LineItems) != 2 || len(draft.Warnings) != 0 {
+        t.Errorf("expected 2 line items and no warning, got: %+v %v", draft.LineItems, draft.Warnings)
+    }
+
+    // Tax lines not adding up fall back to one line item for the total
+    total = 50
+    engine.Extraction.Date = nil
+    draft, err = services.DraftExpenseFromReceipt(
+        context.Background(), engine, "valid_receipt_test.png", "USD",
+    )
+    if err != nil {
+        t.Fatalf("expected no error on draft, got: %v", err)
+    }
+    if len(draft.LineItems) != 1 || draft.LineItems[0].Total != 50 || len(draft.Warnings) != 2 {
+        t.Errorf("expected a single line item and 2 warnings, got: %+v %v", draft.LineItems, draft.Warnings)
+    }
+
+    typeID, err := crud.CreateExpenseType(DatabaseTest, tests.GetValidExpenseType())
+    if err != nil {
+        typeID = tests.GetValidExpenseType().ID
+    }
+    draft.Expense.TypeID = typeID
+    expenseID, err := services.SaveExpenseDraft(DatabaseTest, draft)
+    if err != nil {
+        t.Fatalf("expected no error on save, got: %v", err)
+    }
+    lineItems, err := crud.ListLineItemsByExpenseID(DatabaseTest, expenseID)
+    if err != nil || len(lineItems) != 1 {
+        t.Errorf("expected the saved line item, got: %v (%v)", lineItems, err)
+    }
+    receipts, err := crud.ListReceiptsByExpenseID(DatabaseTest, expenseID)
+    if err != nil || len(receipts) != 1 {
+        t.Errorf("expected the saved receipt, got: %v (%v)", receipts, err)
+    }
+
+    engine.Err = errors.New("unreadable")
+    if _, err := services.DraftExpenseFromReceipt(
+        context.Background(), engine, "valid_receipt_test.png", "USD",
+    ); err == nil {
+        t.Error("expected the engine error")
+    }
+    // PDF receipts are read from their preview, missing here
+    if _, err := services.DraftExpenseFromReceipt(
+        context.Background(), engine, "invoice.pdf", "USD",
+    ); err == nil || len(engine.Calls) != 3 {
+        t.Errorf("expected error before calling the engine, got: %v", err)
+    }
+}
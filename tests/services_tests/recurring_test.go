@@ -0,0 +1,189 @@
+package services_tests
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestGenerateRecurringExpenses(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    database := tests.NewTestDatabase(t)
+
+    sessionID := createAttributesSession(t, database) // Acme, from 2024-04-15, still running
+    typeID, err := crud.CreateExpenseType(database, db.ExpenseType{Name: "Phone", Reimbursable: true})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    monthly, _ := db.ParseSchedule("FREQ=MONTHLY;BYMONTHDAY=-1")
+    weekly, _ := db.ParseSchedule("FREQ=WEEKLY;BYDAY=MO")
+
+    phone := db.RecurringExpense{
+        Name:        "Phone plan",
+        TypeID:      typeID,
+        Currency:    "EUR",
+        LineItems:   db.LineItemTemplateList{{TaxeRate: 20, Total: 24}, {TaxeRate: 0, Total: 6}},
+        SessionRule: db.RecurringNoSession,
+        Schedule:    monthly,
+        StartDate:   "2024-01-01",
+    }
+    if phone.ID, err = crud.CreateRecurringExpense(database, phone); err != nil {
+        t.Fatalf("failed to create recurring expense: %v", err)
+    }
+    parking := db.RecurringExpense{
+        Name:        "Parking",
+        TypeID:      typeID,
+        Currency:    "EUR",
+        LineItems:   db.LineItemTemplateList{{TaxeRate: 20, Total: 15}},
+        SessionRule: db.RecurringClientSession,
+        ClientID:    sql.NullInt64{Int64: 1, Valid: true},
+        Schedule:    weekly,
+        StartDate:   "2024-04-08",
+    }
+    if parking.ID, err = crud.CreateRecurringExpense(database, parking); err != nil {
+        t.Fatalf("failed to create recurring expense: %v", err)
+    }
+    if _, err := crud.CreateRecurringExpense(database, db.RecurringExpense{
+        Name: "PARKING", TypeID: typeID, Currency: "EUR", LineItems: parking.LineItems,
+        SessionRule: db.RecurringNoSession, Schedule: weekly, StartDate: "2024-04-08",
+    }); err == nil {
+        t.Errorf("expected recurring expense names to be unique, case insensitive")
+    }
+    if err := crud.DeleteExpenseTypeByID(database, typeID); err == nil {
+        t.Errorf("expected an expense type used by a recurring expense to be kept")
+    }
+
+    today := time.Date(2024, 4, 20, 15, 0, 0, 0, time.UTC)
+
+    // Dry run writes nothing
+    report, err := services.GenerateRecurringExpenses(
+        database, services.RecurringOptions{Today: today, DryRun: true},
+    )
+    if err != nil || len(report.Generated) != 2 {
+        t.Fatalf("expected 2 expenses on a dry run, got: %+v (%v)", report, err)
+    }
+    if expenses, _ := crud.ListExpenses(database); len(expenses) != 0 {
+        t.Errorf("expected no expense after a dry run, got %d", len(expenses))
+    }
+
+    // Latest occurrence only: March 31st and April 15th, the rest is missed
+    report, err = services.GenerateRecurringExpenses(
+        database, services.RecurringOptions{Today: today},
+    )
+    if err != nil {
+        t.Fatalf("expected no error generating, got: %v", err)
+    }
+    if  len(report.Generated) != 2 ||
+        report.Generated[0].DateOnly != "2024-04-15" ||
+        report.Generated[0].SessionID == nil || *report.Generated[0].SessionID != sessionID ||
+        report.Generated[1].DateOnly != "2024-03-31" || report.Generated[1].Total != 30 ||
+        report.Missed["Phone plan"] != 2 || report.Missed["Parking"] != 1 {
+        t.Errorf("unexpected report: %+v", report)
+    }
+    lineItems, err := crud.ListLineItemsByExpenseID(database, report.Generated[1].ExpenseID)
+    if err != nil || len(lineItems) != 2 {
+        t.Errorf("expected the 2 line items of the template, got: %v (%v)", lineItems, err)
+    }
+
+    // Idempotent
+    report, err = services.GenerateRecurringExpenses(
+        database, services.RecurringOptions{Today: today},
+    )
+    if err != nil || len(report.Generated) != 0 || len(report.Missed) != 0 {
+        t.Errorf("expected nothing more to generate, got: %+v (%v)", report, err)
+    }
+
+    // Catch up: January, February and April 8th
+    report, err = services.GenerateRecurringExpenses(
+        database, services.RecurringOptions{Today: today, CatchUp: true},
+    )
+    if err != nil || len(report.Generated) != 3 {
+        t.Fatalf("expected 3 missed expenses to be generated, got: %+v (%v)", report, err)
+    }
+    if report.Generated[0].SessionID != nil || len(report.Warnings) != 1 {
+        t.Errorf("expected April 8th without session (before the session), got: %+v", report)
+    }
+    expenses, err := crud.ListExpenses(database)
+    if err != nil || len(expenses) != 5 {
+        t.Errorf("expected 5 generated expenses, got: %d (%v)", len(expenses), err)
+    }
+    occurrences, err := crud.ListRecurringOccurrences(database, phone.ID)
+    if err != nil || len(occurrences) != 3 || occurrences[0].DateOnly != "2024-01-31" {
+        t.Errorf("unexpected phone plan occurrences: %v (%v)", occurrences, err)
+    }
+
+    // Deleting a generated expense keeps its occurrence: not generated again
+    if len(occurrences) > 0 {
+        lineItems, _ := crud.ListLineItemsByExpenseID(database, occurrences[0].ExpenseID)
+        for _, lineItem := range lineItems {
+            if err := crud.DeleteLineItemByID(database, lineItem.ID); err != nil {
+                t.Fatalf("failed to delete line item: %v", err)
+            }
+        }
+        if err := crud.DeleteExpenseByID(database, occurrences[0].ExpenseID); err != nil {
+            t.Fatalf("expected a generated expense to be deleted, got: %v", err)
+        }
+        report, err = services.GenerateRecurringExpenses(
+            database, services.RecurringOptions{Today: today, CatchUp: true},
+        )
+        if err != nil || len(report.Generated) != 0 {
+            t.Errorf("expected the deleted expense not to be generated again, got: %+v (%v)", report, err)
+        }
+    }
+    if expenses, _ := crud.ListExpenses(database); len(expenses) != 4 {
+        t.Errorf("expected 4 expenses after deleting one, got %d", len(expenses))
+    }
+
+    // Deleting the template keeps its expenses
+    if err := crud.DeleteRecurringExpenseByID(database, phone.ID); err != nil {
+        t.Fatalf("failed to delete recurring expense: %v", err)
+    }
+    if expenses, _ := crud.ListExpenses(database); len(expenses) != 4 {
+        t.Errorf("expected the generated expenses to be kept, got %d", len(expenses))
+    }
+}
+
+// A generated expense is only kept with its occurrence
+func TestGenerateRecurringExpensesRollback(t *testing.T) {
+    database := tests.NewTestDatabase(t)
+
+    typeID, err := crud.CreateExpenseType(database, db.ExpenseType{Name: "Phone", Reimbursable: true})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    monthly, _ := db.ParseSchedule("FREQ=MONTHLY;BYMONTHDAY=1")
+    _, err = crud.CreateRecurringExpense(database, db.RecurringExpense{
+        Name: "Phone plan", TypeID: typeID, Currency: "EUR",
+        LineItems: db.LineItemTemplateList{{TaxeRate: 20, Total: 24}},
+        SessionRule: db.RecurringNoSession, Schedule: monthly, StartDate: "2024-01-01",
+    })
+    if err != nil {
+        t.Fatalf("failed to create recurring expense: %v", err)
+    }
+    _, err = database.Exec(
+        "CREATE TRIGGER block_occurrence BEFORE INSERT ON recurring_occurrences " +
+        "BEGIN SELECT RAISE(ABORT, 'blocked'); END",
+    )
+    if err != nil {
+        t.Fatalf("failed to create trigger: %v", err)
+    }
+
+    today := time.Date(2024, 4, 20, 15, 0, 0, 0, time.UTC)
+    if _, err := services.GenerateRecurringExpenses(
+        database, services.RecurringOptions{Today: today},
+    ); err == nil {
+        t.Fatal("expected error when the occurrence can't be recorded")
+    }
+    if expenses, _ := crud.ListExpenses(database); len(expenses) != 0 {
+        t.Errorf("expected no expense without its occurrence, got %d", len(expenses))
+    }
+    if lineItems, _ := crud.ListLineItems(database); len(lineItems) != 0 {
+        t.Errorf("expected no line item without its occurrence, got %d", len(lineItems))
+    }
+}
@@ -0,0 +1,89 @@
+package services_tests
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestBuildSessionReport(t *testing.T) {
+    clientID, err := crud.CreateClient(DatabaseTest, db.Client{Name: "Report client"})
+    if err != nil {
+        t.Fatalf("failed to create client: %v", err)
+    }
+    session := tests.GetValidSession()
+    session.ClientID = clientID
+    sessionID, err := crud.CreateSession(DatabaseTest, session)
+    if err != nil {
+        t.Fatalf("failed to create session: %v", err)
+    }
+    typeID, err := crud.CreateExpenseType(DatabaseTest, db.ExpenseType{Name: "Report type"})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+
+    lineItemsByCurrency := map[string][]db.LineItem{
+        "EUR": {{TaxeRate: 10, Total: 100}, {TaxeRate: 20, Total: 12}},
+        "USD": {{TaxeRate: 10, Total: 50}},
+    }
+    for currency, lineItems := range lineItemsByCurrency {
+        expense := tests.GetValidExpense()
+        expense.SessionID = sql.NullInt64{Int64: sessionID, Valid: true}
+        expense.TypeID = typeID
+        expense.Currency = currency
+        expenseID, err := crud.CreateExpense(DatabaseTest, expense)
+        if err != nil {
+            t.Fatalf("failed to create expense: %v", err)
+        }
+        for _, lineItem := range lineItems {
+            lineItem.ExpenseID = expenseID
+            if _, err := crud.CreateLineItem(DatabaseTest, lineItem); err != nil {
+                t.Fatalf("failed to create line item: %v", err)
+            }
+        }
+    }
+
+    report, err := services.BuildSessionReport(DatabaseTest, sessionID)
+    if err != nil {
+        t.Fatalf("expected no error on report, got: %v", err)
+    }
+    expectedTotals := []services.ReportTotal{
+        {Currency: "EUR", TaxeRate: 10, Total: 100},
+        {Currency: "EUR", TaxeRate: 20, Total: 12},
+        {Currency: "USD", TaxeRate: 10, Total: 50},
+    }
+    if len(report.Expenses) != 2 || len(report.Totals) != len(expectedTotals) {
+        t.Fatalf("unexpected report content: %+v", report)
+    }
+    for i, total := range expectedTotals {
+        if report.Totals[i] != total {
+            t.Errorf("expected total %+v, got %+v", total, report.Totals[i])
+        }
+    }
+
+    formats := []string{
+        services.ReportFormatText,
+        services.ReportFormatJSON,
+        services.ReportFormatCSV,
+        services.ReportFormatPDF,
+    }
+    for _, format := range formats {
+        var buffer bytes.Buffer
+        if err := services.WriteSessionReport(&buffer, report, format, i18n.NewPrinter("en")); err != nil {
+            t.Errorf("expected no error on %s report, got: %v", format, err)
+        }
+        if buffer.Len() == 0 {
+            t.Errorf("expected content for %s report", format)
+        }
+    }
+    if err := services.WriteSessionReport(&bytes.Buffer{}, report, "docx", i18n.NewPrinter("en")); err == nil {
+        t.Error("expected error on unknown report format")
+    }
+}
@@ -0,0 +1,97 @@
+package services_tests
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+// Passes with and without the sqlite_fts5 build tag, go test -tags sqlite_fts5
+// runs it against the FTS5 index
+func TestSearch(t *testing.T) {
+    database := tests.NewTestDatabase(t)
+
+    clientID, err := crud.CreateClient(database, db.Client{Name: "Lyonnaise des Eaux"})
+    if err != nil {
+        t.Fatalf("failed to create client: %v", err)
+    }
+    session := tests.GetValidSession()
+    session.ClientID = clientID
+    session.Location = "Lyon"
+    session.TripStartLocation = sql.NullString{String: "Paris", Valid: true}
+    session.TripEndLocation = sql.NullString{}
+    sessionID, err := crud.CreateSession(database, session)
+    if err != nil {
+        t.Fatalf("failed to create session: %v", err)
+    }
+    typeID, err := crud.CreateExpenseType(database, db.ExpenseType{Name: "Parking", Reimbursable: true})
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    expense := tests.GetValidExpense()
+    expense.SessionID = sql.NullInt64{Int64: sessionID, Valid: true}
+    expense.TypeID = typeID
+    expense.Notes = sql.NullString{String: "Parking gare Part-Dieu, Lyon", Valid: true}
+    expense.ID, err = crud.CreateExpense(database, expense)
+    if err != nil {
+        t.Fatalf("failed to create expense: %v", err)
+    }
+
+    hits, err := services.Search(database, "lyon", 0)
+    if err != nil {
+        t.Fatalf("expected no error on search, got: %v", err)
+    }
+    kinds := make(map[string]bool)
+    for _, hit := range hits {
+        kinds[hit.Kind] = true
+        if !strings.Contains(hit.Snippet, services.SnippetStart+"Lyon") {
+            t.Errorf("expected the match highlighted, got: %q", hit.Snippet)
+        }
+    }
+    if len(hits) != 3 || !kinds["client"] || !kinds["session"] || !kinds["expense"] {
+        t.Errorf("expected client, session and expense hits, got: %+v", hits)
+    }
+
+    // Every term in the same field
+    hits, err = services.Search(database, "PARKING lyon", 0)
+    if err != nil || len(hits) != 1 || hits[0].Kind != "expense" || hits[0].EntityID != expense.ID {
+        t.Errorf("expected the expense only, got: %+v (%v)", hits, err)
+    }
+    hits, err = services.Search(database, "par", 1)
+    if err != nil || len(hits) != 1 {
+        t.Errorf("expected the hits to be limited to 1, got: %+v (%v)", hits, err)
+    }
+
+    // Kept in sync with the tables
+    expense.Notes = sql.NullString{String: "Parking Perrache", Valid: true}
+    if err := crud.UpdateExpense(database, expense); err != nil {
+        t.Fatalf("failed to update expense: %v", err)
+    }
+    hits, err = services.Search(database, "perrache", 0)
+    if err != nil || len(hits) != 1 || hits[0].EntityID != expense.ID || hits[0].Field != "notes" {
+        t.Errorf("expected the updated notes, got: %+v (%v)", hits, err)
+    }
+    if err := crud.DeleteExpenseByID(database, expense.ID); err != nil {
+        t.Fatalf("failed to delete expense: %v", err)
+    }
+    hits, err = services.Search(database, "perrache", 0)
+    if err != nil || len(hits) != 0 {
+        t.Errorf("expected no hit after delete, got: %+v (%v)", hits, err)
+    }
+
+    // Never read as FTS5 syntax or LIKE patterns
+    for _, query := range []string{`"lyon`, "lyon OR paris", "100%", "NEAR(lyon"} {
+        if _, err := services.Search(database, query, 0); err != nil {
+            t.Errorf("expected no error for %q, got: %v", query, err)
+        }
+    }
+    if _, err := services.Search(database, "  ", 0); err == nil {
+        t.Error("expected error for empty query")
+    }
+}
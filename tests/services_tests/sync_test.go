@@ -0,0 +1,247 @@
+package services_tests
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+// Server side of a sync, in process
+type localSyncTransport struct {
+    server *sql.DB
+}
+
+func (l localSyncTransport) Push(changes []services.SyncChange) (*services.SyncResult, error) {
+    return services.ApplySyncChanges(l.server, changes, services.SyncOptions{})
+}
+
+func (l localSyncTransport) Pull(since int64, limit int) (*services.SyncChangeSet, error) {
+    return services.ListSyncChanges(l.server, since, limit)
+}
+
+func TestSyncRoundTrip(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    server, laptop, phone := tests.NewTestDatabase(t), tests.NewTestDatabase(t), tests.NewTestDatabase(t)
+    transport := localSyncTransport{server}
+
+    sessionID := createAttributesSession(t, laptop)
+    expenseID := createAttributesExpense(t, laptop, sessionID)
+    if err := services.ApplyAttributes(laptop, db.CustomFieldOnExpense, expenseID, services.Attributes{
+        Tags: []string{"billable"},
+    }); err != nil {
+        t.Fatalf("failed to tag expense: %v", err)
+    }
+    syncDevice(t, laptop, transport)
+    report := syncDevice(t, phone, transport)
+    if report.Pulled == 0 || len(report.Pull.Conflicts) != 0 {
+        t.Errorf("expected the laptop rows pulled without conflict, got: %+v", report)
+    }
+
+    expenses, err := crud.ListExpensesByFilter(phone, crud.ExpenseFilter{
+        AttributeFilter: crud.AttributeFilter{Tags: []string{"billable"}},
+    })
+    if err != nil || len(expenses) != 1 {
+        t.Fatalf("expected the tagged expense on the phone, got: %v (%v)", expenses, err)
+    }
+    lineItems, err := crud.ListLineItemsByExpenseID(phone, expenses[0].ID)
+    if err != nil || len(lineItems) != 1 || lineItems[0].Total != 12 {
+        t.Errorf("expected its line item, got: %v (%v)", lineItems, err)
+    }
+    session, err := crud.GetSessionByID(phone, expenses[0].SessionID.Int64)
+    if err != nil || session.Location != "Paris" {
+        t.Errorf("expected its session, got: %+v (%v)", session, err)
+    }
+
+    // Nothing changed: nothing to push, the own changes are not pulled back
+    report = syncDevice(t, laptop, transport)
+    if report.Pushed != 0 || report.Pull.Applied != 0 {
+        t.Errorf("expected nothing to sync, got: %+v", report)
+    }
+
+    // Edits on both sides: the latest wins
+    setExpenseNotes(t, phone, expenses[0].ID, "from the phone")
+    time.Sleep(5 * time.Millisecond)
+    setExpenseNotes(t, laptop, expenseID, "from the laptop")
+    syncDevice(t, phone, transport)
+    report = syncDevice(t, laptop, transport)
+    if len(report.Push.Conflicts) != 0 {
+        t.Errorf("expected the latest edit accepted, got: %+v", report.Push)
+    }
+    syncDevice(t, phone, transport)
+    for name, database := range map[string]*sql.DB{"laptop": laptop, "phone": phone, "server": server} {
+        expenses, err := crud.ListExpensesByFilter(database, crud.ExpenseFilter{})
+        if err != nil || len(expenses) != 1 || expenses[0].Notes.String != "from the laptop" {
+            t.Errorf("expected the laptop notes on the %s, got: %+v (%v)", name, expenses, err)
+        }
+    }
+}
+
+func TestSyncConflicts(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    server, laptop, phone := tests.NewTestDatabase(t), tests.NewTestDatabase(t), tests.NewTestDatabase(t)
+    transport := localSyncTransport{server}
+
+    sessionID := createAttributesSession(t, laptop)
+    syncDevice(t, laptop, transport)
+    syncDevice(t, phone, transport)
+
+    // Same client created on both sides: one client, the phone takes the
+    // server public ID
+    for _, database := range []*sql.DB{laptop, phone} {
+        if _, err := crud.CreateClient(database, db.Client{Name: "Globex"}); err != nil {
+            t.Fatalf("failed to create client: %v", err)
+        }
+    }
+    syncDevice(t, laptop, transport)
+    report := syncDevice(t, phone, transport)
+    if len(report.Push.Remapped) == 0 {
+        t.Errorf("expected the phone client merged, got: %+v", report.Push)
+    }
+    syncDevice(t, laptop, transport)
+    for name, database := range map[string]*sql.DB{"laptop": laptop, "phone": phone, "server": server} {
+        clients, err := crud.ListClients(database)
+        if err != nil || len(clients) != 2 {
+            t.Errorf("expected 2 clients on the %s, got: %v (%v)", name, clients, err)
+        }
+    }
+
+    // The laptop deletes the session while the phone adds an expense to it:
+    // the reference wins, the session comes back
+    phoneSessions, err := crud.ListSessions(phone)
+    if err != nil || len(phoneSessions) != 1 {
+        t.Fatalf("expected the session on the phone, got: %v (%v)", phoneSessions, err)
+    }
+    if err := crud.DeleteSessionByID(laptop, sessionID); err != nil {
+        t.Fatalf("failed to delete session: %v", err)
+    }
+    syncDevice(t, laptop, transport)
+    createAttributesExpense(t, phone, phoneSessions[0].ID)
+    report = syncDevice(t, phone, transport)
+    if len(report.Push.Warnings) == 0 {
+        t.Errorf("expected a warning about the session brought back, got: %+v", report.Push)
+    }
+    syncDevice(t, laptop, transport)
+    for name, database := range map[string]*sql.DB{"laptop": laptop, "phone": phone, "server": server} {
+        expenses, err := crud.ListExpensesByFilter(database, crud.ExpenseFilter{SessionID: phoneSessions[0].ID})
+        if err != nil || len(expenses) != 1 {
+            t.Errorf("expected the expense in the session on the %s, got: %v (%v)", name, expenses, err)
+        }
+    }
+
+    // Deleted on the laptop, edited before on the phone: the delete wins and
+    // takes the line items of the expense along
+    phoneExpenses, _ := crud.ListExpensesByFilter(phone, crud.ExpenseFilter{})
+    setExpenseNotes(t, phone, phoneExpenses[0].ID, "too late")
+    time.Sleep(5 * time.Millisecond)
+    laptopExpenses, _ := crud.ListExpensesByFilter(laptop, crud.ExpenseFilter{})
+    lineItems, _ := crud.ListLineItemsByExpenseID(laptop, laptopExpenses[0].ID)
+    for _, lineItem := range lineItems {
+        if err := crud.DeleteLineItemByID(laptop, lineItem.ID); err != nil {
+            t.Fatalf("failed to delete line item: %v", err)
+        }
+    }
+    if err := crud.DeleteExpenseByID(laptop, laptopExpenses[0].ID); err != nil {
+        t.Fatalf("failed to delete expense: %v", err)
+    }
+    syncDevice(t, laptop, transport)
+    report = syncDevice(t, phone, transport)
+    if len(report.Push.Conflicts) == 0 || report.Push.Conflicts[0].Reason != services.SyncConflictDeleted {
+        t.Errorf("expected the phone edit rejected, got: %+v", report.Push)
+    }
+    for name, database := range map[string]*sql.DB{"laptop": laptop, "phone": phone, "server": server} {
+        expenses, err := crud.ListExpensesByFilter(database, crud.ExpenseFilter{})
+        if err != nil || len(expenses) != 0 {
+            t.Errorf("expected no expense on the %s, got: %v (%v)", name, expenses, err)
+        }
+        lineItems, err := crud.ListLineItems(database)
+        if err != nil || len(lineItems) != 0 {
+            t.Errorf("expected no line item on the %s, got: %v (%v)", name, lineItems, err)
+        }
+    }
+}
+
+// A change failing to apply rolls back the whole set, on both ends
+func TestSyncApplyRollback(t *testing.T) {
+    tests.SetReceiptsDir(t, t.TempDir())
+    server, laptop := tests.NewTestDatabase(t), tests.NewTestDatabase(t)
+
+    createAttributesExpense(t, laptop, createAttributesSession(t, laptop))
+    local, err := services.ListSyncChanges(laptop, 0, 0)
+    if err != nil {
+        t.Fatalf("failed to list changes: %v", err)
+    }
+
+    blockLineItems(t, server)
+    if _, err := services.ApplySyncChanges(server, local.Changes, services.SyncOptions{}); err == nil {
+        t.Fatal("expected error pushing a line item that can't be written")
+    }
+    expectNothingSynced(t, "server", server)
+
+    // Pulled by a device
+    if _, err := server.Exec("DROP TRIGGER block_line_items"); err != nil {
+        t.Fatalf("failed to unblock line items: %v", err)
+    }
+    syncDevice(t, laptop, localSyncTransport{server})
+    phone := tests.NewTestDatabase(t)
+    blockLineItems(t, phone)
+    if _, err := services.Sync(phone, localSyncTransport{server}); err == nil {
+        t.Fatal("expected error pulling a line item that can't be written")
+    }
+    expectNothingSynced(t, "phone", phone)
+}
+
+// Line items can't be written: their trigger writes to a table now gone
+func blockLineItems(t *testing.T, database *sql.DB) {
+    t.Helper()
+    for _, statement := range []string{
+        "CREATE TABLE blocker(id INTEGER)",
+        "CREATE TRIGGER block_line_items BEFORE INSERT ON line_items BEGIN INSERT INTO blocker VALUES (1); END",
+        "DROP TABLE blocker",
+    } {
+        if _, err := database.Exec(statement); err != nil {
+            t.Fatalf("failed to block line items: %v", err)
+        }
+    }
+}
+
+func expectNothingSynced(t *testing.T, name string, database *sql.DB) {
+    t.Helper()
+    clients, err := crud.ListClients(database)
+    if err != nil || len(clients) != 0 {
+        t.Errorf("expected no client on the %s, got: %v (%v)", name, clients, err)
+    }
+    expenses, err := crud.ListExpensesByFilter(database, crud.ExpenseFilter{})
+    if err != nil || len(expenses) != 0 {
+        t.Errorf("expected no expense on the %s, got: %v (%v)", name, expenses, err)
+    }
+}
+
+func syncDevice(t *testing.T, database *sql.DB, transport services.SyncTransport) *services.SyncReport {
+    t.Helper()
+    report, err := services.Sync(database, transport)
+    if err != nil {
+        t.Fatalf("failed to sync: %v", err)
+    }
+    if report.Push == nil {
+        report.Push = &services.SyncResult{}
+    }
+    return report
+}
+
+func setExpenseNotes(t *testing.T, database *sql.DB, expenseID int64, notes string) {
+    t.Helper()
+    expense, err := crud.GetExpenseByID(database, expenseID)
+    if err != nil {
+        t.Fatalf("failed to get expense: %v", err)
+    }
+    expense.Notes = sql.NullString{String: notes, Valid: true}
+    if err := crud.UpdateExpense(database, *expense); err != nil {
+        t.Fatalf("failed to update expense: %v", err)
+    }
+}
@@ -0,0 +1,118 @@
+package services_tests
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craftidev/expenseflow/internal/db"
+	"github.com/craftidev/expenseflow/internal/db/crud"
+	"github.com/craftidev/expenseflow/internal/i18n"
+	"github.com/craftidev/expenseflow/internal/services"
+	"github.com/craftidev/expenseflow/tests"
+)
+
+
+func TestBuildVATReport(t *testing.T) {
+    tests.SetReceiptsDir(t, tests.ReceiptsDirTest)
+    database := tests.NewTestDatabase(t)
+
+    hotelID, err := crud.CreateExpenseType(
+        database, db.ExpenseType{Name: "Hotel", Reimbursable: true, VATRecoverable: true},
+    )
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+    giftID, err := crud.CreateExpenseType(
+        database, db.ExpenseType{Name: "Gift", Reimbursable: true, VATRecoverable: false},
+    )
+    if err != nil {
+        t.Fatalf("failed to create expense type: %v", err)
+    }
+
+    day := time.Date(2024, 4, 15, 10, 0, 0, 0, time.UTC)
+    expenses := []struct {
+        typeID    int64
+        date      time.Time
+        receipt   string
+        lineItems []db.LineItem
+        timeZone  string
+    }{
+        {hotelID, day, "valid_receipt_test.png", []db.LineItem{{TaxeRate: 10, Total: 110}}, ""},
+        {hotelID, day, "missing_receipt.png", []db.LineItem{{TaxeRate: 20, Total: 60}}, ""},
+        {giftID, day, "valid_receipt_test.png", []db.LineItem{{TaxeRate: 20, Total: 120}}, ""},
+        // Out of the period
+        {hotelID, day.AddDate(0, 3, 0), "valid_receipt_test.png", []db.LineItem{{TaxeRate: 10, Total: 11}}, ""},
+        // June 30 in UTC, July 1 in Tokyo where it was paid
+        {
+            hotelID, time.Date(2024, 6, 30, 16, 0, 0, 0, time.UTC), "valid_receipt_test.png",
+            []db.LineItem{{TaxeRate: 10, Total: 11}}, "Asia/Tokyo",
+        },
+    }
+    for _, e := range expenses {
+        expense := tests.GetValidExpense()
+        expense.SessionID = sql.NullInt64{}
+        expense.TypeID = e.typeID
+        expense.Currency = "EUR"
+        expense.DateTime = e.date
+        expense.TimeZone = sql.NullString{String: e.timeZone, Valid: e.timeZone != ""}
+        expenseID, err := crud.CreateExpense(database, expense)
+        if err != nil {
+            t.Fatalf("failed to create expense: %v", err)
+        }
+        receipt := db.Receipt{ExpenseID: expenseID, RelPath: e.receipt}
+        if _, err := crud.CreateReceipt(database, receipt); err != nil {
+            t.Fatalf("failed to create receipt: %v", err)
+        }
+        for _, lineItem := range e.lineItems {
+            lineItem.ExpenseID = expenseID
+            if _, err := crud.CreateLineItem(database, lineItem); err != nil {
+                t.Fatalf("failed to create line item: %v", err)
+            }
+        }
+    }
+
+    from := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+    report, err := services.BuildVATReport(database, from, from.AddDate(0, 3, 0))
+    if err != nil {
+        t.Fatalf("expected no error on VAT report, got: %v", err)
+    }
+    expectedGroups := []services.VATGroup{
+        {Currency: "EUR", Type: "Hotel", TaxeRate: 10, Total: 110, Net: 100, Tax: 10},
+        {Currency: "EUR", Type: "Hotel", TaxeRate: 20, Total: 60, Net: 50, Tax: 10},
+    }
+    if len(report.Groups) != len(expectedGroups) {
+        t.Fatalf("unexpected VAT groups: %+v", report.Groups)
+    }
+    for i, group := range expectedGroups {
+        if report.Groups[i] != group {
+            t.Errorf("expected group %+v, got %+v", group, report.Groups[i])
+        }
+    }
+    if len(report.Excluded) != 1 || report.Excluded[0].Type != "Gift" {
+        t.Errorf("expected the non recoverable type to be excluded, got: %+v", report.Excluded)
+    }
+    if len(report.Flagged) != 1 || report.Flagged[0].Tax != 10 {
+        t.Errorf("expected the expense without receipt to be flagged, got: %+v", report.Flagged)
+    }
+
+    var buffer bytes.Buffer
+    if err := services.WriteVATReport(&buffer, report, services.ReportFormatCSV, i18n.NewPrinter("en")); err != nil {
+        t.Errorf("expected no error on csv VAT report, got: %v", err)
+    }
+    if !strings.Contains(buffer.String(), "EUR,Hotel,10,110.00,100.00,10.00\n") {
+        t.Errorf("expected an english csv VAT report, got: %s", buffer.String())
+    }
+    buffer.Reset()
+    if err := services.WriteVATReport(&buffer, report, services.ReportFormatCSV, i18n.NewPrinter("fr")); err != nil {
+        t.Errorf("expected no error on french csv VAT report, got: %v", err)
+    }
+    if !strings.Contains(buffer.String(), "EUR;Hotel;10;110,00;100,00;10,00\n") {
+        t.Errorf("expected a french csv VAT report, got: %s", buffer.String())
+    }
+    if _, err := services.BuildVATReport(database, from, from); err == nil {
+        t.Error("expected error on an empty period")
+    }
+}
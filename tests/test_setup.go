@@ -3,15 +3,32 @@ package tests
 import (
 	"database/sql"
 	"log"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
 
+	"github.com/craftidev/expenseflow/config"
 	"github.com/craftidev/expenseflow/internal/db"
 )
 
 var SingletonDatabaseTest *sql.DB
 
+// Test assets live next to this file in the source tree
+var ReceiptsDirTest = filepath.Join(testsDir(), "assets", "receipts")
+
+func testsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}
+
+// Point config.ReceiptsDir to dir for the test, put back when it ends
+func SetReceiptsDir(t *testing.T, dir string) {
+	previous := config.ReceiptsDir
+	config.ReceiptsDir = dir
+	t.Cleanup(func() { config.ReceiptsDir = previous })
+}
+
 func SetupTestDatabase() *sql.DB {
 	if SingletonDatabaseTest != nil {
 		return SingletonDatabaseTest
@@ -30,6 +47,20 @@ func SetupTestDatabase() *sql.DB {
 	return SingletonDatabaseTest
 }
 
+// Own in-memory database of a test, closed when the test ends, for rows that
+// would get in the way of the other tests on the shared one
+func NewTestDatabase(t *testing.T, standardModels ...string) *sql.DB {
+	database, err := db.ConnectDB(":memory:")
+	if err != nil {
+		t.Fatalf("failed to connect database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := db.InitDB(":memory:", database, standardModels...); err != nil {
+		t.Fatalf("failed to init database: %v", err)
+	}
+	return database
+}
+
 func TeardownTestDatabase() {
 	if SingletonDatabaseTest != nil {
 		if err := db.CloseDB(SingletonDatabaseTest); err != nil {
@@ -108,22 +139,32 @@ func GetValidExpense() db.Expense {
 		SessionID:      sql.NullInt64{Int64: 1, Valid: true},
 		TypeID:         1,
 		Currency:       "USD",
-		ReceiptRelPath: sql.NullString{
-            String: "valid_receipt_test.png",
-            Valid: true,
-        },
 		Notes:          sql.NullString{
             String: "Valid notes here.",
             Valid: true,
         },
 		DateTime:       time.Now(),
+		Country:        sql.NullString{String: "FR", Valid: true},
 	}
 }
 
 func GetValidExpenseType() db.ExpenseType {
     return db.ExpenseType{
-        ID:   1,
-        Name: "Transportation",
+        ID:               1,
+        Name:             "Transportation",
+        DefaultTaxeRates: db.TaxeRateList{10, 5.5},
+        AccountingCode:   sql.NullString{String: "6251", Valid: true},
+        Reimbursable:     true,
+        VATRecoverable:   true,
+    }
+}
+
+func GetValidReceipt() db.Receipt {
+    return db.Receipt{
+        ID:        1,
+        ExpenseID: 1,
+        RelPath:   "valid_receipt_test.png",
+        Position:  0,
     }
 }
 